@@ -0,0 +1,280 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package accesslist contains allow and deny lists evaluated before the
+// phase 1 rules, they let operators block or trust clients without
+// writing rules. Lists can be updated while the WAF is serving requests:
+//
+//	list := accesslist.New()
+//	waf, _ := coraza.NewWAF(coraza.NewWAFConfig().WithAccessList(list))
+//	_ = list.Add(accesslist.Entry{ID: "incident-42", Action: accesslist.Deny, Network: "203.0.113.0/24"})
+//
+// Matches are exposed to the rules and audit logs with the
+// ACCESS_LIST_ACTION and ACCESS_LIST_ENTRY variables.
+package accesslist
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Action is the action applied to the requests matching an entry
+type Action int
+
+const (
+	// Allow skips the evaluation of the phase 1 to 4 rules, phase 5 rules
+	// and audit logging still run
+	Allow Action = iota
+	// Deny interrupts the transaction before the phase 1 rules
+	Deny
+)
+
+// String returns the value of ACCESS_LIST_ACTION for the action
+func (a Action) String() string {
+	switch a {
+	case Allow:
+		return "allow"
+	case Deny:
+		return "deny"
+	}
+	return "unknown"
+}
+
+// Entry scopes an action to the requests matching all its non empty
+// fields
+type Entry struct {
+	// ID identifies the entry, it is required and unique within a list
+	ID string
+	// Action is applied to the matching requests
+	Action Action
+	// Network is the CIDR of the client, like 10.0.0.0/8, a single
+	// address is accepted as a /32 or /128 network
+	Network string
+	// PathPrefix matches the request path, without query string
+	PathPrefix string
+	// Method matches the request method, case insensitive
+	Method string
+	// Status is the status of denied requests, 403 if it is zero
+	Status int
+}
+
+type entry struct {
+	Entry
+	prefixLen int
+}
+
+// match returns true if the path and method match the entry, the
+// network was already matched by the index
+func (e *entry) match(path string, method string) bool {
+	if e.Method != "" && !strings.EqualFold(e.Method, method) {
+		return false
+	}
+	return strings.HasPrefix(path, e.PathPrefix)
+}
+
+// List is a concurrent safe set of entries.
+//
+// Entries are indexed by network, a lookup takes one map access per
+// distinct prefix length stored, at most 33 for IPv4 and 129 for IPv6
+// clients, no matter how many entries are stored. Deny entries take
+// precedence over allow entries.
+type List struct {
+	mu  sync.RWMutex
+	ids map[string]*entry
+	// networks maps the prefix length to the masked networks with that
+	// length, the prefix length is -1 for entries without network
+	networks map[int]map[string][]*entry
+	// v4Lens and v6Lens are the prefix lengths in use, longest first
+	v4Lens []int
+	v6Lens []int
+}
+
+// New returns an empty List
+func New() *List {
+	return &List{
+		ids:      map[string]*entry{},
+		networks: map[int]map[string][]*entry{},
+	}
+}
+
+// Add adds an entry to the list, it fails if the ID is already in use or
+// the network is invalid
+func (l *List) Add(e Entry) error {
+	if e.ID == "" {
+		return errors.New("access list entry ID is required")
+	}
+	if e.Action != Allow && e.Action != Deny {
+		return fmt.Errorf("invalid access list action %d", e.Action)
+	}
+	key, plen, err := parseNetwork(e.Network)
+	if err != nil {
+		return err
+	}
+	ent := &entry{Entry: e, prefixLen: plen}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.ids[e.ID]; ok {
+		return fmt.Errorf("access list entry %q already exists", e.ID)
+	}
+	l.ids[e.ID] = ent
+	nets, ok := l.networks[plen]
+	if !ok {
+		nets = map[string][]*entry{}
+		l.networks[plen] = nets
+		l.updateLens()
+	}
+	nets[key] = append(nets[key], ent)
+	return nil
+}
+
+// Remove removes the entry with the given ID, it returns false if it
+// does not exist
+func (l *List) Remove(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ent, ok := l.ids[id]
+	if !ok {
+		return false
+	}
+	delete(l.ids, id)
+	key, _, _ := parseNetwork(ent.Network)
+	nets := l.networks[ent.prefixLen]
+	entries := nets[key]
+	for i, e := range entries {
+		if e == ent {
+			entries = append(entries[:i], entries[i+1:]...)
+			break
+		}
+	}
+	if len(entries) > 0 {
+		nets[key] = entries
+		return true
+	}
+	delete(nets, key)
+	if len(nets) == 0 {
+		delete(l.networks, ent.prefixLen)
+		l.updateLens()
+	}
+	return true
+}
+
+// Entries returns a copy of the entries of the list, in no particular
+// order
+func (l *List) Entries() []Entry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	entries := make([]Entry, 0, len(l.ids))
+	for _, e := range l.ids {
+		entries = append(entries, e.Entry)
+	}
+	return entries
+}
+
+// Len returns the number of entries
+func (l *List) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.ids)
+}
+
+// Match returns the entry matching the request and true, deny entries
+// are returned before allow entries. ip may be empty or invalid, in that
+// case only the entries without network are matched.
+func (l *List) Match(ip string, path string, method string) (Entry, bool) {
+	addr := net.ParseIP(ip)
+	if ip4 := addr.To4(); ip4 != nil {
+		addr = ip4
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var lens []int
+	switch len(addr) {
+	case net.IPv4len:
+		lens = l.v4Lens
+	case net.IPv6len:
+		lens = l.v6Lens
+	}
+	var allowed *entry
+	check := func(entries []*entry) *entry {
+		for _, e := range entries {
+			if !e.match(path, method) {
+				continue
+			}
+			if e.Action == Deny {
+				return e
+			}
+			if allowed == nil {
+				allowed = e
+			}
+		}
+		return nil
+	}
+	for _, plen := range lens {
+		mask := net.CIDRMask(plen, len(addr)*8)
+		if e := check(l.networks[plen][addr.Mask(mask).String()]); e != nil {
+			return e.Entry, true
+		}
+	}
+	if e := check(l.networks[-1][""]); e != nil {
+		return e.Entry, true
+	}
+	if allowed != nil {
+		return allowed.Entry, true
+	}
+	return Entry{}, false
+}
+
+// updateLens rebuilds the prefix lengths in use, it must be called with
+// the lock held
+func (l *List) updateLens() {
+	var v4, v6 []int
+	for plen := 128; plen >= 0; plen-- {
+		if _, ok := l.networks[plen]; !ok {
+			continue
+		}
+		// IPv4 networks are stored with their 32 bits length, lengths
+		// up to 32 may contain networks of both families
+		if plen <= 32 {
+			v4 = append(v4, plen)
+		}
+		v6 = append(v6, plen)
+	}
+	l.v4Lens = v4
+	l.v6Lens = v6
+}
+
+// parseNetwork returns the masked network and its prefix length, IPv4
+// networks use 32 bits lengths so IPv4-mapped addresses match them
+func parseNetwork(network string) (string, int, error) {
+	if network == "" {
+		return "", -1, nil
+	}
+	if !strings.Contains(network, "/") {
+		ip := net.ParseIP(network)
+		if ip == nil {
+			return "", 0, fmt.Errorf("invalid access list network %q", network)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4.String(), 32, nil
+		}
+		return ip.String(), 128, nil
+	}
+	_, n, err := net.ParseCIDR(network)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid access list network %q", network)
+	}
+	ones, bits := n.Mask.Size()
+	if bits == 128 && n.IP.To4() != nil {
+		// IPv4-mapped networks like ::ffff:10.0.0.0/104
+		ones -= 96
+	}
+	if ones < 0 {
+		return "", 0, fmt.Errorf("invalid access list network %q", network)
+	}
+	return n.IP.String(), ones, nil
+}
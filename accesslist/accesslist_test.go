@@ -0,0 +1,73 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package accesslist
+
+import (
+	"testing"
+)
+
+func TestListMatch(t *testing.T) {
+	l := New()
+	for _, e := range []Entry{
+		{ID: "office", Action: Allow, Network: "10.0.0.0/8"},
+		{ID: "incident", Action: Deny, Network: "10.1.0.0/16", PathPrefix: "/admin"},
+		{ID: "host", Action: Deny, Network: "192.168.1.1", Status: 429},
+		{ID: "v6", Action: Deny, Network: "2001:db8::/32", Method: "post"},
+		{ID: "health", Action: Allow, PathPrefix: "/healthz"},
+	} {
+		if err := l.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		ip, path, method string
+		id               string
+	}{
+		{"10.2.3.4", "/admin", "GET", "office"},
+		{"10.1.3.4", "/admin/users", "GET", "incident"},
+		{"10.1.3.4", "/", "GET", "office"},
+		{"::ffff:10.1.3.4", "/admin", "GET", "incident"},
+		{"192.168.1.1", "/healthz", "GET", "host"},
+		{"192.168.1.2", "/healthz", "GET", "health"},
+		{"2001:db8::1", "/", "POST", "v6"},
+		{"2001:db8::1", "/", "GET", ""},
+		{"", "/healthz", "GET", "health"},
+		{"invalid", "/", "GET", ""},
+	}
+	for _, tt := range tests {
+		e, ok := l.Match(tt.ip, tt.path, tt.method)
+		if ok != (tt.id != "") || e.ID != tt.id {
+			t.Errorf("expected %q for %s %s %s, got %q", tt.id, tt.ip, tt.method, tt.path, e.ID)
+		}
+	}
+
+	if !l.Remove("incident") || l.Remove("incident") {
+		t.Error("expected the entry to be removed once")
+	}
+	if e, _ := l.Match("10.1.3.4", "/admin", "GET"); e.ID != "office" {
+		t.Errorf("expected the removed entry not to match, got %q", e.ID)
+	}
+	if l.Len() != 4 || len(l.Entries()) != 4 {
+		t.Errorf("expected 4 entries, got %d", l.Len())
+	}
+}
+
+func TestListAddErrors(t *testing.T) {
+	l := New()
+	if err := l.Add(Entry{ID: "a", Network: "10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	for name, e := range map[string]Entry{
+		"missing id":   {Network: "10.0.0.0/8"},
+		"duplicate id": {ID: "a"},
+		"invalid cidr": {ID: "b", Network: "10.0.0.0/33"},
+		"invalid ip":   {ID: "c", Network: "10.0.0"},
+		"invalid type": {ID: "d", Action: Action(5)},
+	} {
+		if err := l.Add(e); err == nil {
+			t.Errorf("expected an error for %s", name)
+		}
+	}
+}
@@ -37,6 +37,7 @@ func init() {
 	RegisterPlugin("drop", drop)
 	RegisterPlugin("exec", exec)
 	RegisterPlugin("expirevar", expirevar)
+	RegisterPlugin("header", header)
 	RegisterPlugin("id", id)
 	RegisterPlugin("initcol", initcol)
 	RegisterPlugin("log", log)
@@ -47,9 +48,12 @@ func init() {
 	RegisterPlugin("noauditlog", noauditlog)
 	RegisterPlugin("nolog", nolog)
 	RegisterPlugin("pass", pass)
+	RegisterPlugin("pause", pause)
 	RegisterPlugin("phase", phase)
 	RegisterPlugin("prepend", prepend)
 	RegisterPlugin("redirect", redirect)
+	RegisterPlugin("responseBody", responseBody)
+	RegisterPlugin("responseContentType", responseContentType)
 	RegisterPlugin("rev", rev)
 	RegisterPlugin("setenv", setenv)
 	RegisterPlugin("setvar", setvar)
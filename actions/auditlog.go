@@ -13,6 +13,7 @@ type auditlogFn struct{}
 func (a *auditlogFn) Init(r rules.RuleMetadata, data string) error {
 	// TODO(anuraaga): Confirm this is internal implementation detail
 	r.(*corazawaf.Rule).Audit = true
+	r.(*corazawaf.Rule).AuditSet = true
 	return nil
 }
 
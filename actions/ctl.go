@@ -58,6 +58,11 @@ func (a *ctlFn) Init(r rules.RuleMetadata, data string) error {
 			return err
 		}
 	}
+	if err == nil && a.action == ctlAuditLogParts {
+		// the parts are validated once, they are applied to the parts of
+		// the transaction when the rule matches
+		_, err = types.AuditLogParts(nil).Modify(a.value)
+	}
 	return err
 }
 
@@ -81,7 +86,7 @@ func (a *ctlFn) Evaluate(r rules.RuleMetadata, txS rules.TransactionState) {
 	case ctlRuleRemoveTargetByID:
 		ran, err := rangeToInts(tx.WAF.Rules.GetRules(), a.value)
 		if err != nil {
-			tx.WAF.Logger.Error("[ctl:RuleRemoveTargetByID] invalid range: %s", err.Error())
+			tx.DebugLogger().Error("[ctl:RuleRemoveTargetByID] invalid range: %s", err.Error())
 			return
 		}
 		for _, id := range ran {
@@ -104,46 +109,50 @@ func (a *ctlFn) Evaluate(r rules.RuleMetadata, txS rules.TransactionState) {
 	case ctlAuditEngine:
 		ae, err := types.ParseAuditEngineStatus(a.value)
 		if err != nil {
-			tx.WAF.Logger.Error("[ctl:AuditEngine] %s", err.Error())
+			tx.DebugLogger().Error("[ctl:AuditEngine] %s", err.Error())
 			return
 		}
 		tx.AuditEngine = ae
 	case ctlAuditLogParts:
-		// TODO lets switch it to a string
-		tx.AuditLogParts = types.AuditLogParts(a.value)
+		parts, err := tx.AuditLogParts.Modify(a.value)
+		if err != nil {
+			tx.DebugLogger().Error("[ctl:AuditLogParts] %s", err.Error())
+			return
+		}
+		tx.AuditLogParts = parts
 	case ctlForceRequestBodyVariable:
 		val, ok := parseOnOff(a.value)
 		if !ok {
-			tx.WAF.Logger.Error("[ctl:ForceRequestBodyVariable] unknown value %q", a.value)
+			tx.DebugLogger().Error("[ctl:ForceRequestBodyVariable] unknown value %q", a.value)
 			return
 		}
 		tx.ForceRequestBodyVariable = val
-		tx.WAF.Logger.Debug("[ctl:ForceRequestBodyVariable] Forcing request body var with CTL to %s", val)
+		tx.DebugLogger().Debug("[ctl:ForceRequestBodyVariable] Forcing request body var with CTL to %s", val)
 	case ctlRequestBodyAccess:
 		val, ok := parseOnOff(a.value)
 		if !ok {
-			tx.WAF.Logger.Error("[ctl:RequestBodyAccess] unknown value %q", a.value)
+			tx.DebugLogger().Error("[ctl:RequestBodyAccess] unknown value %q", a.value)
 			return
 		}
 		tx.RequestBodyAccess = val
 	case ctlRequestBodyLimit:
 		limit, err := strconv.ParseInt(a.value, 10, 64)
 		if err != nil {
-			tx.WAF.Logger.Error("[ctl:RequestBodyLimit] Incorrect integer CTL value %q", a.value)
+			tx.DebugLogger().Error("[ctl:RequestBodyLimit] Incorrect integer CTL value %q", a.value)
 			return
 		}
 		tx.RequestBodyLimit = limit
 	case ctlRuleEngine:
 		re, err := types.ParseRuleEngineStatus(a.value)
 		if err != nil {
-			tx.WAF.Logger.Error("[ctl:RuleEngine] %s", err.Error())
+			tx.DebugLogger().Error("[ctl:RuleEngine] %s", err.Error())
 			return
 		}
 		tx.RuleEngine = re
 	case ctlRuleRemoveByID:
 		id, err := strconv.Atoi(a.value)
 		if err != nil {
-			tx.WAF.Logger.Error("[ctl:RuleRemoveByID] %s", err.Error())
+			tx.DebugLogger().Error("[ctl:RuleRemoveByID] %s", err.Error())
 			return
 		}
 		tx.RemoveRuleByID(id)
@@ -164,9 +173,19 @@ func (a *ctlFn) Evaluate(r rules.RuleMetadata, txS rules.TransactionState) {
 	case ctlRequestBodyProcessor:
 		tx.Variables().RequestBodyProcessor().Set(strings.ToUpper(a.value))
 	case ctlHashEngine:
-		// Not supported yet
+		val, ok := parseOnOff(a.value)
+		if !ok {
+			tx.DebugLogger().Error("[ctl:HashEngine] unknown value %q", a.value)
+			return
+		}
+		tx.HashEngine = val
 	case ctlHashEnforcement:
-		// Not supported yet
+		val, ok := parseOnOff(a.value)
+		if !ok {
+			tx.DebugLogger().Error("[ctl:HashEnforcement] unknown value %q", a.value)
+			return
+		}
+		tx.HashEnforcement = val
 	case ctlDebugLogLevel:
 		// lvl, _ := strconv.Atoi(a.Value)
 		// TODO
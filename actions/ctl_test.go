@@ -73,6 +73,26 @@ func TestCtl(t *testing.T) {
 	if tx.RequestBodyLimit != 12345 {
 		t.Error("Failed to set request body limit")
 	}
+
+	tx.AuditLogParts = types.AuditLogParts("ABCFHZ")
+	for _, tt := range []struct{ value, parts string }{
+		{"+EK", "ABCFHZEK"},
+		{"-CE", "ABFHZK"},
+		{"ABZ", "ABZ"},
+	} {
+		if err := ctlf.Init(r, "auditLogParts="+tt.value); err != nil {
+			t.Errorf("failed to init ctl with auditLogParts=%s", tt.value)
+		}
+		ctlf.Evaluate(r, tx)
+		if string(tx.AuditLogParts) != tt.parts {
+			t.Errorf("unexpected audit log parts %q after %s, want %q", tx.AuditLogParts, tt.value, tt.parts)
+		}
+	}
+	for _, value := range []string{"+", "-X", "ABY"} {
+		if err := ctlf.Init(r, "auditLogParts="+value); err == nil {
+			t.Errorf("expected an error for auditLogParts=%s", value)
+		}
+	}
 }
 
 func TestParseCtl(t *testing.T) {
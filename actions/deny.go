@@ -19,10 +19,13 @@ func (a *denyFn) Evaluate(r rules.RuleMetadata, tx rules.TransactionState) {
 	if rid == 0 {
 		rid = r.ParentID()
 	}
+	body, contentType := interruptionBody(r, tx)
 	tx.Interrupt(&types.Interruption{
-		Status: r.Status(),
-		RuleID: rid,
-		Action: "deny",
+		Status:      r.Status(),
+		RuleID:      rid,
+		Action:      types.InterruptionActionDeny,
+		Body:        body,
+		ContentType: contentType,
 	})
 }
 
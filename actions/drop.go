@@ -22,7 +22,7 @@ func (a *dropFn) Evaluate(r rules.RuleMetadata, tx rules.TransactionState) {
 	tx.Interrupt(&types.Interruption{
 		Status: r.Status(),
 		RuleID: rid,
-		Action: "drop",
+		Action: types.InterruptionActionDrop,
 	})
 }
 
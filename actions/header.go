@@ -0,0 +1,95 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package actions
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/macro"
+	"github.com/corazawaf/coraza/v3/rules"
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+// headerFn schedules a response header mutation that will be applied
+// by the connector, the syntax is:
+//
+//	header:'set:X-Frame-Options=DENY'
+//	header:'add:X-Detected-Rule=%{rule.id}'
+//	header:'remove:Server'
+//
+// Header names must be valid HTTP tokens, CR and LF are removed from the
+// expanded values so the macros can't inject headers.
+type headerFn struct {
+	action types.HeaderMutationAction
+	name   string
+	value  macro.Macro
+}
+
+func (a *headerFn) Init(r rules.RuleMetadata, data string) error {
+	op, arg, ok := strings.Cut(data, ":")
+	if !ok {
+		return fmt.Errorf("invalid header action %q", data)
+	}
+	switch strings.ToLower(op) {
+	case "set":
+		a.action = types.HeaderMutationSet
+	case "add":
+		a.action = types.HeaderMutationAdd
+	case "remove":
+		a.action = types.HeaderMutationRemove
+		if !httpguts.ValidHeaderFieldName(arg) {
+			return fmt.Errorf("invalid header name %q", arg)
+		}
+		a.name = arg
+		return nil
+	default:
+		return fmt.Errorf("invalid header operation %q", op)
+	}
+	name, val, ok := strings.Cut(arg, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("invalid key value for header")
+	}
+	if !httpguts.ValidHeaderFieldName(name) {
+		return fmt.Errorf("invalid header name %q", name)
+	}
+	m, err := macro.NewMacro(val)
+	if err != nil {
+		return err
+	}
+	a.name = name
+	a.value = m
+	return nil
+}
+
+func (a *headerFn) Evaluate(r rules.RuleMetadata, tx rules.TransactionState) {
+	// TODO(anuraaga): Confirm this is internal implementation detail
+	t := tx.(*corazawaf.Transaction)
+	m := types.HeaderMutation{
+		Action: a.action,
+		Name:   a.name,
+	}
+	if a.value != nil {
+		m.Value = newlineRemover.Replace(a.value.Expand(tx))
+	}
+	t.AddResponseHeaderMutation(m)
+}
+
+var newlineRemover = strings.NewReplacer("\r", "", "\n", "")
+
+func (a *headerFn) Type() rules.ActionType {
+	return rules.ActionTypeNondisruptive
+}
+
+func header() rules.Action {
+	return &headerFn{}
+}
+
+var (
+	_ rules.Action      = &headerFn{}
+	_ ruleActionWrapper = header
+)
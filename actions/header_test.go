@@ -0,0 +1,43 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package actions
+
+import (
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+func TestHeader(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	tx := waf.NewTransaction()
+	tx.Variables().TX().Set("value", []string{"a\r\nSet-Cookie: x=1"})
+	tests := []struct {
+		data string
+		want types.HeaderMutation
+	}{
+		{"set:X-Frame-Options=DENY", types.HeaderMutation{Action: types.HeaderMutationSet, Name: "X-Frame-Options", Value: "DENY"}},
+		{"add:X-Value=%{tx.value}", types.HeaderMutation{Action: types.HeaderMutationAdd, Name: "X-Value", Value: "aSet-Cookie: x=1"}},
+		{"remove:Server", types.HeaderMutation{Action: types.HeaderMutationRemove, Name: "Server"}},
+	}
+	for _, tt := range tests {
+		a := header()
+		rule := corazawaf.NewRule()
+		if err := a.Init(rule, tt.data); err != nil {
+			t.Fatal(err)
+		}
+		a.Evaluate(rule, tx)
+		m := tx.ResponseHeaderMutations()
+		if got := m[len(m)-1]; got != tt.want {
+			t.Errorf("%s: unexpected mutation %v", tt.data, got)
+		}
+	}
+
+	for _, data := range []string{"set:X-A\r\nX-B=1", "remove:X-A\nX-B", "add:X A=1", "set:=1", "remove:", "replace:X-A=1"} {
+		if err := header().Init(corazawaf.NewRule(), data); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
@@ -13,8 +13,11 @@ type logFn struct {
 
 func (a *logFn) Init(r rules.RuleMetadata, data string) error {
 	// TODO(anuraaga): Confirm this is internal implementation detail
-	r.(*corazawaf.Rule).Log = true
-	r.(*corazawaf.Rule).Audit = true
+	rule := r.(*corazawaf.Rule)
+	rule.Log = true
+	if !rule.AuditSet {
+		rule.Audit = true
+	}
 	return nil
 }
 
@@ -14,6 +14,7 @@ type noauditlogFn struct {
 func (a *noauditlogFn) Init(r rules.RuleMetadata, data string) error {
 	// TODO(anuraaga): Confirm this is internal implementation detail
 	r.(*corazawaf.Rule).Audit = false
+	r.(*corazawaf.Rule).AuditSet = true
 	return nil
 }
 
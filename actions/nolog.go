@@ -13,15 +13,15 @@ type nologFn struct {
 
 func (a *nologFn) Init(r rules.RuleMetadata, data string) error {
 	// TODO(anuraaga): Confirm this is internal implementation detail
-	r.(*corazawaf.Rule).Log = false
-	r.(*corazawaf.Rule).Audit = false
+	rule := r.(*corazawaf.Rule)
+	rule.Log = false
+	if !rule.AuditSet {
+		rule.Audit = false
+	}
 	return nil
 }
 
 func (a *nologFn) Evaluate(r rules.RuleMetadata, tx rules.TransactionState) {
-	// TODO(anuraaga): Confirm this is internal implementation detail
-	// TODO(anuraaga): Confirm this is actually needed.
-	r.(*corazawaf.Rule).Audit = false
 }
 
 func (a *nologFn) Type() rules.ActionType {
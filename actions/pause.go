@@ -0,0 +1,66 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package actions
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+// pauseFn delays the transaction for the given amount of milliseconds,
+// an optional jitter can be added after a tilde, for example pause:3000~500
+// will delay the transaction between 2.5 and 3.5 seconds.
+// The action does not sleep, the delay is applied by the connector.
+type pauseFn struct {
+	duration time.Duration
+	jitter   time.Duration
+}
+
+func (a *pauseFn) Init(r rules.RuleMetadata, data string) error {
+	ms, jitter, hasJitter := strings.Cut(data, "~")
+	d, err := strconv.Atoi(ms)
+	if err != nil || d < 0 {
+		return fmt.Errorf("invalid pause duration %q", data)
+	}
+	a.duration = time.Duration(d) * time.Millisecond
+	if hasJitter {
+		j, err := strconv.Atoi(jitter)
+		if err != nil || j < 0 {
+			return fmt.Errorf("invalid pause jitter %q", data)
+		}
+		a.jitter = time.Duration(j) * time.Millisecond
+	}
+	return nil
+}
+
+func (a *pauseFn) Evaluate(r rules.RuleMetadata, tx rules.TransactionState) {
+	d := a.duration
+	if a.jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(2*a.jitter)+1)) - a.jitter
+		if d < 0 {
+			d = 0
+		}
+	}
+	// TODO(anuraaga): Confirm this is internal implementation detail
+	tx.(*corazawaf.Transaction).AddPause(d)
+}
+
+func (a *pauseFn) Type() rules.ActionType {
+	return rules.ActionTypeDisruptive
+}
+
+func pause() rules.Action {
+	return &pauseFn{}
+}
+
+var (
+	_ rules.Action      = &pauseFn{}
+	_ ruleActionWrapper = pause
+)
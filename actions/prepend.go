@@ -29,7 +29,7 @@ func (a *prependFn) Evaluate(r rules.RuleMetadata, txS rules.TransactionState) {
 	// TODO(anuraaga): This is quite complicated. Evaluate whether plugin API needs to support this.
 	tx := txS.(*corazawaf.Transaction)
 	if !tx.WAF.ContentInjection {
-		tx.WAF.Logger.Debug("append rejected because of ContentInjection")
+		tx.DebugLogger().Debug("append rejected because of ContentInjection")
 		return
 	}
 	data := a.data.Expand(tx)
@@ -40,15 +40,15 @@ func (a *prependFn) Evaluate(r rules.RuleMetadata, txS rules.TransactionState) {
 
 	_, err := buf.Write([]byte(data))
 	if err != nil {
-		tx.WAF.Logger.Debug("failed to write buffer while evaluating prepend action: %s", err.Error())
+		tx.DebugLogger().Debug("failed to write buffer while evaluating prepend action: %s", err.Error())
 	}
 	reader, err := tx.ResponseBodyBuffer.Reader()
 	if err != nil {
-		tx.WAF.Logger.Debug("failed to read response body while evaluating prepend action: %s", err.Error())
+		tx.DebugLogger().Debug("failed to read response body while evaluating prepend action: %s", err.Error())
 	}
 	_, err = io.Copy(buf, reader)
 	if err != nil {
-		tx.WAF.Logger.Debug("failed to append response buffer while evaluating prepend action: %s", err.Error())
+		tx.DebugLogger().Debug("failed to append response buffer while evaluating prepend action: %s", err.Error())
 	}
 	// We overwrite the response body buffer with the new buffer
 	*tx.ResponseBodyBuffer = *buf
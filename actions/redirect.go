@@ -39,11 +39,14 @@ func (a *redirectFn) Evaluate(r rules.RuleMetadata, tx rules.TransactionState) {
 	if rid == 0 {
 		rid = r.ParentID()
 	}
+	body, contentType := interruptionBody(r, tx)
 	tx.Interrupt(&types.Interruption{
-		Status: r.Status(),
-		RuleID: rid,
-		Action: "redirect",
-		Data:   a.target,
+		Status:      r.Status(),
+		RuleID:      rid,
+		Action:      types.InterruptionActionRedirect,
+		Data:        a.target,
+		Body:        body,
+		ContentType: contentType,
 	})
 }
 
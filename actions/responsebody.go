@@ -0,0 +1,87 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package actions
+
+import (
+	"fmt"
+
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/macro"
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+// responseBodyFn sets the body template returned by the deny and
+// redirect actions, macros are expanded when the rule disrupts:
+//
+//	responseBody:'{"error":"blocked","id":"%{unique_id}"}'
+type responseBodyFn struct {
+}
+
+func (a *responseBodyFn) Init(r rules.RuleMetadata, data string) error {
+	if data == "" {
+		return fmt.Errorf("responseBody action requires a parameter")
+	}
+	m, err := macro.NewMacro(data)
+	if err != nil {
+		return err
+	}
+	// TODO(anuraaga): Confirm this is internal implementation detail
+	r.(*corazawaf.Rule).DisruptiveBody = m
+	return nil
+}
+
+func (a *responseBodyFn) Evaluate(r rules.RuleMetadata, tx rules.TransactionState) {
+}
+
+func (a *responseBodyFn) Type() rules.ActionType {
+	return rules.ActionTypeData
+}
+
+func responseBody() rules.Action {
+	return &responseBodyFn{}
+}
+
+// responseContentTypeFn sets the content type of the responseBody
+type responseContentTypeFn struct {
+}
+
+func (a *responseContentTypeFn) Init(r rules.RuleMetadata, data string) error {
+	if data == "" {
+		return fmt.Errorf("responseContentType action requires a parameter")
+	}
+	// TODO(anuraaga): Confirm this is internal implementation detail
+	r.(*corazawaf.Rule).DisruptiveContentType = data
+	return nil
+}
+
+func (a *responseContentTypeFn) Evaluate(r rules.RuleMetadata, tx rules.TransactionState) {
+}
+
+func (a *responseContentTypeFn) Type() rules.ActionType {
+	return rules.ActionTypeData
+}
+
+func responseContentType() rules.Action {
+	return &responseContentTypeFn{}
+}
+
+// interruptionBody expands the response body template of the rule
+func interruptionBody(r rules.RuleMetadata, tx rules.TransactionState) (string, string) {
+	rule, ok := r.(*corazawaf.Rule)
+	if !ok || rule.DisruptiveBody == nil {
+		return "", ""
+	}
+	contentType := rule.DisruptiveContentType
+	if contentType == "" {
+		contentType = "text/html"
+	}
+	return rule.DisruptiveBody.Expand(tx), contentType
+}
+
+var (
+	_ rules.Action      = &responseBodyFn{}
+	_ ruleActionWrapper = responseBody
+	_ rules.Action      = &responseContentTypeFn{}
+	_ ruleActionWrapper = responseContentType
+)
@@ -35,7 +35,7 @@ func (a *setenvFn) Evaluate(r rules.RuleMetadata, tx rules.TransactionState) {
 	v := a.value.Expand(tx)
 	// set env variable
 	if err := os.Setenv(a.key, v); err != nil {
-		tx.DebugLogger().Error("[%s] Error setting env variable for rule %d: %s", tx.ID(), r.ID(), err.Error())
+		tx.DebugLogger().Error("Error setting env variable for rule %d: %s", r.ID(), err.Error())
 	}
 	// TODO is this ok?
 	tx.Variables().Env().Set(a.key, []string{v})
@@ -4,6 +4,7 @@
 package actions
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -14,11 +15,31 @@ import (
 	"github.com/corazawaf/coraza/v3/types/variables"
 )
 
+type setvarOp int
+
+const (
+	setvarSet setvarOp = iota
+	setvarSum
+	setvarSub
+	setvarRemove
+)
+
 type setvarFn struct {
 	key        macro.Macro
 	value      macro.Macro
 	collection variables.RuleVariable
-	isRemove   bool
+	op         setvarOp
+}
+
+// setvarCollections are the collections that can be written with setvar,
+// all of them are created on demand without initcol
+var setvarCollections = map[variables.RuleVariable]struct{}{
+	variables.TX:       {},
+	variables.IP:       {},
+	variables.Global:   {},
+	variables.Session:  {},
+	variables.User:     {},
+	variables.Resource: {},
 }
 
 func (a *setvarFn) Init(r rules.RuleMetadata, data string) error {
@@ -27,97 +48,95 @@ func (a *setvarFn) Init(r rules.RuleMetadata, data string) error {
 	}
 
 	if data[0] == '!' {
-		a.isRemove = true
+		a.op = setvarRemove
 		data = data[1:]
 	}
 
-	var err error
 	key, val, valOk := strings.Cut(data, "=")
+	if valOk && a.op == setvarRemove {
+		return errors.New("setvar: a variable removal cannot have a value")
+	}
+	// both tx.score=+5 (ModSecurity) and tx.score+=5 are supported
+	switch {
+	case strings.HasSuffix(key, "+"):
+		a.op = setvarSum
+		key = key[:len(key)-1]
+	case strings.HasSuffix(key, "-"):
+		a.op = setvarSub
+		key = key[:len(key)-1]
+	case len(val) > 0 && val[0] == '+':
+		a.op = setvarSum
+		val = val[1:]
+	case len(val) > 0 && val[0] == '-':
+		a.op = setvarSub
+		val = val[1:]
+	case !valOk && a.op != setvarRemove:
+		// setvar:tx.foo sets the variable to 1
+		val = "1"
+	}
 
 	colKey, colVal, colOk := strings.Cut(key, ".")
+	var err error
 	a.collection, err = variables.Parse(colKey)
 	if err != nil {
 		return err
 	}
-	if colOk {
-		macro, err := macro.NewMacro(colVal)
-		if err != nil {
-			return err
-		}
-		a.key = macro
+	if _, ok := setvarCollections[a.collection]; !ok {
+		return fmt.Errorf("setvar: collection %s is not writable", a.collection.Name())
 	}
-	if valOk {
-		macro, err := macro.NewMacro(val)
-		if err != nil {
-			return err
-		}
-		a.value = macro
+	if !colOk || colVal == "" {
+		return fmt.Errorf("setvar: missing variable name for collection %s", a.collection.Name())
+	}
+	if a.key, err = macro.NewMacro(colVal); err != nil {
+		return err
+	}
+	if a.value, err = macro.NewMacro(val); err != nil {
+		return err
 	}
 	return nil
 }
 
 func (a *setvarFn) Evaluate(r rules.RuleMetadata, tx rules.TransactionState) {
-	key := a.key.Expand(tx)
+	key := strings.ToLower(a.key.Expand(tx))
 	value := a.value.Expand(tx)
-	tx.DebugLogger().Debug("[%s] Setting var %q to %q by rule %d", tx.ID(), key, value, r.ID())
-	a.evaluateTxCollection(r, tx, strings.ToLower(key), value)
-}
-
-func (a *setvarFn) Type() rules.ActionType {
-	return rules.ActionTypeNondisruptive
-}
+	tx.DebugLogger().Debug("Setting var %q to %q by rule %d", key, value, r.ID())
 
-func (a *setvarFn) evaluateTxCollection(r rules.RuleMetadata, tx rules.TransactionState, key string, value string) {
-	col := (tx.Collection(a.collection)).(*collection.Map)
-	if col == nil {
-		// fmt.Println("Invalid Collection " + a.Collection) LOG error?
+	col, ok := tx.Collection(a.collection).(*collection.Map)
+	if !ok || col == nil {
+		tx.DebugLogger().Error("Invalid collection %s for setvar on rule %d", a.collection.Name(), r.ID())
 		return
 	}
 
-	if a.isRemove {
+	switch a.op {
+	case setvarRemove:
 		col.Remove(key)
-		return
-	}
-	res := ""
-	if r := col.Get(key); len(r) > 0 {
-		res = r[0]
-	}
-	var err error
-	switch {
-	case len(value) == 0:
-		// if nothing to input
-		col.Set(key, []string{""})
-	case value[0] == '+':
-		// if we want to sum
-		sum := 0
-		if len(value) > 1 {
-			sum, err = strconv.Atoi(value[1:])
-			if err != nil {
-				tx.DebugLogger().Error("[%s] Invalid value for setvar %q on rule %d", tx.ID(), value, r.ID())
+	case setvarSum, setvarSub:
+		operand := 0
+		if value != "" {
+			var err error
+			if operand, err = strconv.Atoi(value); err != nil {
+				tx.DebugLogger().Error("Invalid value for setvar %q on rule %d", value, r.ID())
 				return
 			}
 		}
-		val := 0
-		if res != "" {
-			val, err = strconv.Atoi(res)
-			if err != nil {
-				tx.DebugLogger().Error("[%s] Invalid value for setvar %q on rule %d", tx.ID(), res, r.ID())
-				return
-			}
+		if a.op == setvarSub {
+			operand = -operand
 		}
-		col.Set(key, []string{strconv.Itoa(sum + val)})
-	case value[0] == '-':
-		me, _ := strconv.Atoi(value[1:])
-		txv, err := strconv.Atoi(res)
-		if err != nil {
-			return
+		// like ModSecurity, missing or non numeric values count as 0
+		current := 0
+		if res := col.Get(key); len(res) > 0 {
+			current, _ = strconv.Atoi(res[0])
 		}
-		col.Set(key, []string{strconv.Itoa(txv - me)})
+		col.Set(key, []string{strconv.Itoa(current + operand)})
 	default:
 		col.Set(key, []string{value})
 	}
 }
 
+func (a *setvarFn) Type() rules.ActionType {
+	return rules.ActionTypeNondisruptive
+}
+
 func setvar() rules.Action {
 	return &setvarFn{}
 }
@@ -0,0 +1,80 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package actions
+
+import (
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/collection"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/types/variables"
+)
+
+func TestSetvar(t *testing.T) {
+	tests := []struct {
+		data       string
+		collection variables.RuleVariable
+		key        string
+		want       []string
+	}{
+		{"tx.foo=bar", variables.TX, "foo", []string{"bar"}},
+		{"tx.FOO=bar", variables.TX, "foo", []string{"bar"}},
+		{"tx.foo", variables.TX, "foo", []string{"1"}},
+		{"tx.foo=", variables.TX, "foo", []string{""}},
+		{"tx.foo=a=b", variables.TX, "foo", []string{"a=b"}},
+		{"tx.score=+5", variables.TX, "score", []string{"15"}},
+		{"tx.score+=5", variables.TX, "score", []string{"15"}},
+		{"tx.score=-5", variables.TX, "score", []string{"5"}},
+		{"tx.score-=5", variables.TX, "score", []string{"5"}},
+		{"tx.score=+%{tx.critical}", variables.TX, "score", []string{"15"}},
+		{"tx.new=+5", variables.TX, "new", []string{"5"}},
+		{"tx.new=-5", variables.TX, "new", []string{"-5"}},
+		{"tx.text=+5", variables.TX, "text", []string{"5"}},
+		{"tx.%{tx.name}=%{tx.critical}", variables.TX, "dynamic", []string{"5"}},
+		{"!tx.score", variables.TX, "score", nil},
+		{"ip.blocked=1", variables.IP, "blocked", []string{"1"}},
+		{"global.counter=+1", variables.Global, "counter", []string{"1"}},
+		{"session.score=+1", variables.Session, "score", []string{"1"}},
+		{"user.name=%{tx.name}", variables.User, "name", []string{"Dynamic"}},
+		{"resource.hits=+1", variables.Resource, "hits", []string{"1"}},
+	}
+	waf := corazawaf.NewWAF()
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			tx := waf.NewTransaction()
+			txc := tx.Variables().TX()
+			txc.Set("score", []string{"10"})
+			txc.Set("critical", []string{"5"})
+			txc.Set("text", []string{"abc"})
+			txc.Set("name", []string{"Dynamic"})
+
+			a := setvar()
+			rule := corazawaf.NewRule()
+			if err := a.Init(rule, tt.data); err != nil {
+				t.Fatal(err)
+			}
+			a.Evaluate(rule, tx)
+			got := tx.Collection(tt.collection).(*collection.Map).Get(tt.key)
+			if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+				t.Errorf("unexpected value, want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSetvarInitErrors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"tx",
+		"tx.=1",
+		"!tx.foo=1",
+		"args.foo=1",
+		"unknown.foo=1",
+	} {
+		a := setvar()
+		if err := a.Init(corazawaf.NewRule(), data); err == nil {
+			t.Errorf("expected error for %q", data)
+		}
+	}
+}
@@ -19,6 +19,7 @@ func (a *severityFn) Init(r rules.RuleMetadata, data string) error {
 	}
 	// TODO(anuraaga): Confirm this is internal implementation detail
 	r.(*corazawaf.Rule).Severity_ = sev
+	r.(*corazawaf.Rule).HasSeverity_ = true
 	return nil
 }
 
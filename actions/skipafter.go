@@ -16,11 +16,12 @@ type skipafterFn struct {
 
 func (a *skipafterFn) Init(r rules.RuleMetadata, data string) error {
 	a.data = strings.Trim(data, `"`)
+	r.(*corazawaf.Rule).SkipAfter = a.data
 	return nil
 }
 
 func (a *skipafterFn) Evaluate(r rules.RuleMetadata, tx rules.TransactionState) {
-	tx.DebugLogger().Debug("[%s] Starting secmarker %q", tx.ID(), a.data)
+	tx.DebugLogger().Debug("Starting secmarker %q", a.data)
 	// TODO(anuraaga): Confirm this is internal implementation detail
 	tx.(*corazawaf.Transaction).SkipAfter = a.data
 }
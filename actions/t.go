@@ -4,6 +4,8 @@
 package actions
 
 import (
+	"strings"
+
 	"github.com/corazawaf/coraza/v3/internal/corazawaf"
 	"github.com/corazawaf/coraza/v3/rules"
 	transformations "github.com/corazawaf/coraza/v3/transformations"
@@ -20,11 +22,16 @@ func (a *tFn) Init(r rules.RuleMetadata, input string) error {
 		r.(*corazawaf.Rule).ClearTransformations()
 		return nil
 	}
+	rule := r.(*corazawaf.Rule)
+	// urlDecodeUni uses the code points mapping of the WAF
+	if strings.EqualFold(input, "urlDecodeUni") {
+		return rule.AddTransformation(input, transformations.URLDecodeUni(rule.UnicodeMap))
+	}
 	tt, err := transformations.GetTransformation(input)
 	if err != nil {
 		return err
 	}
-	return r.(*corazawaf.Rule).AddTransformation(input, tt)
+	return rule.AddTransformation(input, tt)
 }
 
 func (a *tFn) Evaluate(r rules.RuleMetadata, tx rules.TransactionState) {
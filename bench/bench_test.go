@@ -0,0 +1,80 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package bench
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3"
+)
+
+const directives = `SecRuleEngine On
+SecRequestBodyAccess On
+SecRule ARGS "@rx (?i)(?:<script|onerror=|union\s+select|\.\./|/etc/passwd|jndi:|system\(|\$\(| or 1=1)" "id:1,phase:2,deny,status:403"`
+
+func TestGenerate(t *testing.T) {
+	w := Workload{Requests: 200, MinArgs: 2, MaxArgs: 6, BodySize: 1024, AttackRatio: 0.25, Seed: 7}
+	reqs := Generate(w)
+	if len(reqs) != 200 {
+		t.Fatalf("expected 200 requests, got %d", len(reqs))
+	}
+	if !reflect.DeepEqual(reqs, Generate(w)) {
+		t.Error("expected the same requests for the same seed")
+	}
+	attacks, posts := 0, 0
+	for _, r := range reqs {
+		if r.Attack {
+			attacks++
+		}
+		if r.Method == "POST" {
+			posts++
+			if len(r.Body) == 0 || len(r.Body) > 2*w.BodySize {
+				t.Errorf("unexpected body size %d", len(r.Body))
+			}
+		}
+	}
+	if attacks < 20 || attacks > 80 || posts == 0 {
+		t.Errorf("unexpected distribution, %d attacks and %d POST requests", attacks, posts)
+	}
+}
+
+func TestRun(t *testing.T) {
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(directives))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Run(waf, Generate(Workload{Requests: 100, MinArgs: 1, MaxArgs: 5, BodySize: 256, AttackRatio: 0.3, Seed: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Requests != 100 || res.Attacks == 0 || res.Detected != res.Attacks || res.Interrupted != res.Detected {
+		t.Errorf("expected every attack to be detected, got %s", res)
+	}
+	if res.P50 > res.P90 || res.P90 > res.P99 || res.P99 > res.Max || res.AllocsPerRequest == 0 {
+		t.Errorf("unexpected measures %s", res)
+	}
+	if !strings.HasPrefix(res.String(), "requests=100 ") {
+		t.Errorf("unexpected format %q", res.String())
+	}
+}
+
+func BenchmarkWorkloads(b *testing.B) {
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(directives))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, w := range DefaultWorkloads {
+		reqs := Generate(w)
+		b.Run(w.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := process(waf, reqs[i%len(reqs)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
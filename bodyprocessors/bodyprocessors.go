@@ -4,11 +4,13 @@
 package bodyprocessors
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"strings"
 
+	"github.com/corazawaf/coraza/v3/charset"
 	"github.com/corazawaf/coraza/v3/rules"
 )
 
@@ -25,6 +27,69 @@ type Options struct {
 	FileMode fs.FileMode
 	// DirMode is the mode of the directory that will be created
 	DirMode fs.FileMode
+	// Truncated is true if the body was cut because of the request
+	// body limit, processors may discard the last incomplete token
+	Truncated bool
+	// TruncatedAtSeparator is true if the body was cut right before one of
+	// the ArgumentSeparators, the last argument is then complete
+	TruncatedAtSeparator bool
+	// Charset is the charset of the body when it must be transcoded
+	// to UTF-8, it is empty for UTF-8 bodies or if decoding is disabled
+	Charset string
+	// ArgumentSeparators contains the characters separating urlencoded
+	// arguments, & is used if empty
+	ArgumentSeparators string
+	// ArgumentLimits bounds the arguments added to ARGS_POST
+	ArgumentLimits ArgumentLimits
+	// MaxLines is the maximum number of documents of line delimited
+	// bodies like NDJSON, zero disables it
+	MaxLines int
+	// XMLMaxDepth is the nesting level of the XML elements reported as
+	// an anomaly in REQUEST_XML_ANOMALIES, zero disables it
+	XMLMaxDepth int
+	// XMLMaxElements is the number of XML elements reported as an anomaly
+	// in REQUEST_XML_ANOMALIES, zero disables it
+	XMLMaxElements int
+}
+
+// ErrArgumentsLimit is returned by the body processors when the body
+// exceeds the ArgumentLimits, the arguments parsed before are kept
+var ErrArgumentsLimit = errors.New("arguments limit exceeded")
+
+// ArgumentLimits bounds the number and size of the arguments parsed from
+// a single source, like the query string or the request body, zero values
+// disable each limit
+type ArgumentLimits struct {
+	// Count is the maximum number of arguments
+	Count int
+	// NameLength is the maximum length of an argument name
+	NameLength int
+	// ValueLength is the maximum length of an argument value
+	ValueLength int
+}
+
+// Check returns an error wrapping ErrArgumentsLimit if the argument
+// name=value, being the nth argument of its source, exceeds the limits
+func (l ArgumentLimits) Check(n int, name string, value string) error {
+	switch {
+	case l.Count > 0 && n > l.Count:
+		return fmt.Errorf("%w: more than %d arguments", ErrArgumentsLimit, l.Count)
+	case l.NameLength > 0 && len(name) > l.NameLength:
+		return fmt.Errorf("%w: argument name longer than %d bytes", ErrArgumentsLimit, l.NameLength)
+	case l.ValueLength > 0 && len(value) > l.ValueLength:
+		return fmt.Errorf("%w: argument %q value longer than %d bytes", ErrArgumentsLimit, name, l.ValueLength)
+	}
+	return nil
+}
+
+// transcode returns a reader transcoding the body to UTF-8 as it is read
+// and true if the options declare a supported charset, otherwise the
+// reader is returned as is
+func transcode(reader io.Reader, options Options) (io.Reader, bool) {
+	if options.Charset == "" {
+		return reader, false
+	}
+	return charset.NewReader(reader, options.Charset)
 }
 
 // BodyProcessor interface is used to create
@@ -32,6 +97,8 @@ type Options struct {
 // They are able to read the body, force a collection.
 // Hook to some variable and return data based on special
 // expressions like XPATH, JQ, etc.
+// The readers provided by transactions also implement io.Seeker, large
+// bodies are read from a temporary file instead of memory.
 type BodyProcessor interface {
 	ProcessRequest(reader io.Reader, variables rules.TransactionVariables, options Options) error
 	ProcessResponse(reader io.Reader, variables rules.TransactionVariables, options Options) error
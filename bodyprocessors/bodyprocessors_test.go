@@ -0,0 +1,42 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package bodyprocessors_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/bodyprocessors"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+)
+
+var bodyProcessorTests = []struct {
+	processor string
+	mime      string
+	body      string
+}{
+	{"urlencoded", "application/x-www-form-urlencoded", "a=1&b=2&c"},
+	{"json", "application/json", `{"a":[1,{"b":"c"}]}`},
+	{"xml", "text/xml", `<a><b c="d">e</b></a>`},
+	{"multipart", "multipart/form-data; boundary=xxx", "--xxx\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\n1\r\n--xxx--\r\n"},
+}
+
+func FuzzBodyProcessors(f *testing.F) {
+	for i, tc := range bodyProcessorTests {
+		f.Add(uint8(i), tc.body)
+	}
+	f.Fuzz(func(t *testing.T, idx uint8, body string) {
+		tc := bodyProcessorTests[int(idx)%len(bodyProcessorTests)]
+		bp, err := bodyprocessors.Get(tc.processor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := bodyprocessors.Options{
+			Mime:        tc.mime,
+			StoragePath: t.TempDir(),
+		}
+		_ = bp.ProcessRequest(bytes.NewBufferString(body), corazawaf.NewTransactionVariables(), opts)
+		_ = bp.ProcessResponse(bytes.NewBufferString(body), corazawaf.NewTransactionVariables(), opts)
+	})
+}
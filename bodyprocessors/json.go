@@ -5,6 +5,7 @@ package bodyprocessors
 
 import (
 	"io"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -16,20 +17,32 @@ import (
 type jsonBodyProcessor struct {
 }
 
-func (js *jsonBodyProcessor) ProcessRequest(reader io.Reader, v rules.TransactionVariables, _ Options) error {
-	col := v.ArgsPost()
+func (js *jsonBodyProcessor) ProcessRequest(reader io.Reader, v rules.TransactionVariables, options Options) error {
+	reader, _ = transcode(reader, options)
 	data, err := readJSON(reader)
 	if err != nil {
 		return err
 	}
+	return setJSONArguments(v, data, options)
+}
+
+// setJSONArguments adds the flattened JSON documents to ARGS_POST
+func setJSONArguments(v rules.TransactionVariables, data map[string]string, options Options) error {
+	col := v.ArgsPost()
 	argsGetCol := v.ArgsGet()
-	for key, value := range data {
-		// TODO: This hack prevent GET variables from overriding POST variables
-		for k := range argsGetCol.Data() {
-			if k == key {
-				argsGetCol.Remove(k)
-			}
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	// sorted so the same arguments are kept when the limits are exceeded
+	sort.Strings(keys)
+	for i, key := range keys {
+		value := data[key]
+		if err := options.ArgumentLimits.Check(i+1, key, value); err != nil {
+			return err
 		}
+		// TODO: This hack prevent GET variables from overriding POST variables
+		argsGetCol.Remove(key)
 		col.SetIndex(key, 0, value)
 	}
 	return nil
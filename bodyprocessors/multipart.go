@@ -38,6 +38,7 @@ func (mbp *multipartBodyProcessor) ProcessRequest(reader io.Reader, v rules.Tran
 	filesCombinedSizeCol := v.FilesCombinedSize()
 	filesNamesCol := v.FilesNames()
 	headersNames := v.MultipartPartHeaders()
+	fields := 0
 	for {
 		p, err := mr.NextPart()
 		if err == io.EOF {
@@ -56,8 +57,8 @@ func (mbp *multipartBodyProcessor) ProcessRequest(reader io.Reader, v rules.Tran
 		filename := originFileName(p)
 		if filename != "" {
 			var size int64
-			if !environment.IsTinyGo {
-				// Only copy file to temp when not running in TinyGo
+			if environment.HasAccessToFS {
+				// Only copy file to temp when the filesystem is available
 				temp, err := os.CreateTemp(storagePath, "crzmp*")
 				if err != nil {
 					return err
@@ -86,6 +87,10 @@ func (mbp *multipartBodyProcessor) ProcessRequest(reader io.Reader, v rules.Tran
 				return err
 			}
 			totalSize += int64(len(data))
+			fields++
+			if err := options.ArgumentLimits.Check(fields, p.FormName(), string(data)); err != nil {
+				return err
+			}
 			postCol.Add(p.FormName(), string(data))
 		}
 		filesCombinedSizeCol.Set(fmt.Sprintf("%d", totalSize))
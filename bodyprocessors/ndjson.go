@@ -0,0 +1,66 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package bodyprocessors
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+// ndjsonBodyProcessor parses newline delimited JSON bodies, also known as
+// JSON Lines, each line is a JSON document whose keys are prefixed with
+// its index, like json.0.field. Empty lines are skipped.
+type ndjsonBodyProcessor struct {
+}
+
+func (js *ndjsonBodyProcessor) ProcessRequest(reader io.Reader, v rules.TransactionVariables, options Options) error {
+	reader, _ = transcode(reader, options)
+	data := map[string]string{}
+	br := bufio.NewReader(reader)
+	n := 0
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if doc := strings.TrimSpace(line); doc != "" {
+			if options.MaxLines > 0 && n >= options.MaxLines {
+				// the documents parsed before the limit are kept
+				if err := setJSONArguments(v, data, options); err != nil {
+					return err
+				}
+				return fmt.Errorf("more than %d JSON documents", options.MaxLines)
+			}
+			if !gjson.Valid(doc) {
+				return fmt.Errorf("invalid JSON document %d", n)
+			}
+			readItems(gjson.Parse(doc), strconv.AppendInt([]byte("json."), int64(n), 10), data)
+			n++
+		}
+		if err != nil {
+			break
+		}
+	}
+	return setJSONArguments(v, data, options)
+}
+
+func (js *ndjsonBodyProcessor) ProcessResponse(reader io.Reader, v rules.TransactionVariables, _ Options) error {
+	return nil
+}
+
+var _ BodyProcessor = &ndjsonBodyProcessor{}
+
+func init() {
+	Register("ndjson", func() BodyProcessor {
+		return &ndjsonBodyProcessor{}
+	})
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package bodyprocessors_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/bodyprocessors"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+)
+
+func TestNDJSON(t *testing.T) {
+	bp, err := bodyprocessors.Get("ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		body     string
+		maxLines int
+		args     map[string]string
+		err      bool
+	}{
+		{
+			name: "documents",
+			body: "{\"a\": 1, \"b\": {\"c\": \"x\"}}\n\n{\"a\": [2, 3]}\r\n[4]",
+			args: map[string]string{
+				"json.0.a":   "1",
+				"json.0.b.c": "x",
+				"json.1.a":   "2",
+				"json.1.a.0": "2",
+				"json.1.a.1": "3",
+				"json.2":     "1",
+				"json.2.0":   "4",
+			},
+		},
+		{
+			name:     "max lines",
+			body:     "{\"a\": 1}\n{\"a\": 2}\n{\"a\": 3}\n",
+			maxLines: 2,
+			args:     map[string]string{"json.0.a": "1", "json.1.a": "2"},
+			err:      true,
+		},
+		{
+			name: "invalid document",
+			body: "{\"a\": 1}\n{\"a\": \n",
+			args: map[string]string{},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := corazawaf.NewTransactionVariables()
+			err := bp.ProcessRequest(strings.NewReader(tt.body), v, bodyprocessors.Options{MaxLines: tt.maxLines})
+			if tt.err != (err != nil) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got := len(v.ArgsPost().FindAll()); got != len(tt.args) {
+				t.Errorf("expected %d arguments, got %d", len(tt.args), got)
+			}
+			for k, want := range tt.args {
+				if got := v.ArgsPost().Get(k); len(got) != 1 || got[0] != want {
+					t.Errorf("expected %s=%s, got %v", k, want, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !tinygo
+// +build !tinygo
+
+package bodyprocessors
+
+import (
+	"encoding/xml"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+const (
+	soap11Namespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12Namespace = "http://www.w3.org/2003/05/soap-envelope"
+	wsseNamespace   = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"
+	wsuNamespace    = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
+	dsigNamespace   = "http://www.w3.org/2000/09/xmldsig#"
+)
+
+// soapEnvelope summarizes a SOAP envelope while the document is parsed
+type soapEnvelope struct {
+	namespace       string
+	version         string
+	headers         int
+	bodies          int
+	headerAfterBody bool
+	// operation is the first element of the body unless it is a fault
+	operation   xml.Name
+	fault       bool
+	faultCode   string
+	faultString string
+	// WS-Security header
+	security     bool
+	username     string
+	passwordType string
+	timestamp    bool
+	created      string
+	expires      string
+	signature    bool
+}
+
+// newSOAPEnvelope returns nil if root is not a SOAP 1.1 or 1.2 envelope
+func newSOAPEnvelope(root xml.Name) *soapEnvelope {
+	if root.Local != "Envelope" {
+		return nil
+	}
+	switch root.Space {
+	case soap11Namespace:
+		return &soapEnvelope{namespace: root.Space, version: "1.1"}
+	case soap12Namespace:
+		return &soapEnvelope{namespace: root.Space, version: "1.2"}
+	}
+	return nil
+}
+
+// isEnvelope returns true if name is the element local of the envelope
+// namespace
+func (s *soapEnvelope) isEnvelope(name xml.Name, local string) bool {
+	return name.Space == s.namespace && name.Local == local
+}
+
+// inSecurity returns true if path is inside the WS-Security header
+func (s *soapEnvelope) inSecurity(path []xml.Name) bool {
+	return len(path) > 3 && s.isEnvelope(path[1], "Header") &&
+		path[2] == xml.Name{Space: wsseNamespace, Local: "Security"}
+}
+
+// start records the element opened at the end of path
+func (s *soapEnvelope) start(path []xml.Name, el xml.StartElement) {
+	switch {
+	case len(path) == 2 && s.isEnvelope(el.Name, "Header"):
+		s.headers++
+		s.headerAfterBody = s.headerAfterBody || s.bodies > 0
+	case len(path) == 2 && s.isEnvelope(el.Name, "Body"):
+		s.bodies++
+	case len(path) == 3 && s.isEnvelope(path[1], "Body"):
+		if s.operation.Local != "" || s.fault {
+			return
+		}
+		if s.isEnvelope(el.Name, "Fault") {
+			s.fault = true
+		} else {
+			s.operation = el.Name
+		}
+	case len(path) == 3 && s.isEnvelope(path[1], "Header"):
+		s.security = s.security || el.Name == xml.Name{Space: wsseNamespace, Local: "Security"}
+	case s.inSecurity(path):
+		switch el.Name {
+		case xml.Name{Space: wsseNamespace, Local: "Password"}:
+			// the password is plain text unless it is a digest
+			s.passwordType = "text"
+			for _, attr := range el.Attr {
+				if attr.Name.Local == "Type" && strings.HasSuffix(attr.Value, "#PasswordDigest") {
+					s.passwordType = "digest"
+				}
+			}
+		case xml.Name{Space: wsuNamespace, Local: "Timestamp"}:
+			s.timestamp = true
+		case xml.Name{Space: dsigNamespace, Local: "Signature"}:
+			s.signature = true
+		}
+	}
+}
+
+// text records the character data of the element at the end of path,
+// only the first value of each field is kept
+func (s *soapEnvelope) text(path []xml.Name, data string) {
+	name := path[len(path)-1]
+	switch {
+	case s.inSecurity(path):
+		switch name {
+		case xml.Name{Space: wsseNamespace, Local: "Username"}:
+			setOnce(&s.username, data)
+		case xml.Name{Space: wsuNamespace, Local: "Created"}:
+			setOnce(&s.created, data)
+		case xml.Name{Space: wsuNamespace, Local: "Expires"}:
+			setOnce(&s.expires, data)
+		}
+	case s.fault && len(path) > 3 && s.isEnvelope(path[1], "Body") && s.isEnvelope(path[2], "Fault"):
+		// SOAP 1.1 uses faultcode and faultstring, SOAP 1.2 uses Code/Value
+		// and Reason/Text
+		switch {
+		case len(path) == 4 && name.Local == "faultcode",
+			len(path) == 5 && s.isEnvelope(path[3], "Code") && s.isEnvelope(name, "Value"):
+			setOnce(&s.faultCode, data)
+		case len(path) == 4 && name.Local == "faultstring",
+			len(path) == 5 && s.isEnvelope(path[3], "Reason") && s.isEnvelope(name, "Text"):
+			setOnce(&s.faultString, data)
+		}
+	}
+}
+
+func setOnce(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+// soapAction returns the SOAPAction header of SOAP 1.1 and the action
+// parameter of the SOAP 1.2 content type without quotes
+func soapAction(v rules.TransactionVariables, options Options) []string {
+	var actions []string
+	for _, a := range v.RequestHeaders().Get("soapaction") {
+		if a = strings.Trim(strings.TrimSpace(a), `"`); a != "" {
+			actions = append(actions, a)
+		}
+	}
+	if _, params, err := mime.ParseMediaType(options.Mime); err == nil && params["action"] != "" {
+		actions = append(actions, params["action"])
+	}
+	return actions
+}
+
+// matchesOperation returns true if the last segment of the action, after
+// a slash, hash or colon, is the operation name
+func matchesOperation(action string, operation string) bool {
+	if i := strings.LastIndexAny(action, "/#:"); i >= 0 {
+		action = action[i+1:]
+	}
+	return strings.EqualFold(action, operation)
+}
+
+// setSOAPVariables fills REQUEST_SOAP and reports the envelope anomalies
+// in REQUEST_XML_ANOMALIES
+func setSOAPVariables(s *soapEnvelope, v rules.TransactionVariables, options Options) {
+	col := v.RequestSOAP()
+	set := func(key string, value string) {
+		if value != "" {
+			col.Set(key, []string{value})
+		}
+	}
+	anomaly := func(name string) {
+		v.RequestXMLAnomalies().Set(name, []string{"1"})
+	}
+	set("version", s.version)
+	set("operation", s.operation.Local)
+	set("operation_namespace", s.operation.Space)
+
+	actions := soapAction(v, options)
+	for _, a := range actions {
+		col.Add("action", a)
+		if s.operation.Local != "" && !matchesOperation(a, s.operation.Local) {
+			anomaly("soap_action_mismatch")
+		}
+	}
+	if len(actions) > 1 && actions[0] != actions[len(actions)-1] {
+		anomaly("soap_action_mismatch")
+	}
+	// SOAP 1.1 is sent as text/xml and SOAP 1.2 as application/soap+xml
+	if mt, _, err := mime.ParseMediaType(options.Mime); err == nil {
+		if (s.version == "1.1" && mt == "application/soap+xml") || (s.version == "1.2" && mt == "text/xml") {
+			anomaly("soap_version_mismatch")
+		}
+	}
+
+	if s.fault {
+		set("fault", "1")
+		set("fault_code", s.faultCode)
+		set("fault_string", s.faultString)
+	}
+	switch {
+	case s.bodies == 0:
+		anomaly("soap_missing_body")
+	case s.bodies > 1:
+		anomaly("soap_multiple_bodies")
+	}
+	if s.headers > 1 {
+		anomaly("soap_multiple_headers")
+	}
+	if s.headerAfterBody {
+		anomaly("soap_header_after_body")
+	}
+
+	if !s.security {
+		return
+	}
+	set("wss_security", "1")
+	set("wss_username", s.username)
+	set("wss_password_type", s.passwordType)
+	set("wss_created", s.created)
+	set("wss_expires", s.expires)
+	if s.signature {
+		set("wss_signature", "1")
+	}
+	if s.passwordType == "text" {
+		anomaly("wss_password_text")
+	}
+	if !s.timestamp {
+		anomaly("wss_timestamp_missing")
+	} else if t, err := time.Parse(time.RFC3339, s.expires); err == nil && t.Before(time.Now()) {
+		anomaly("wss_timestamp_expired")
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !tinygo
+// +build !tinygo
+
+package bodyprocessors_test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/bodyprocessors"
+	"github.com/corazawaf/coraza/v3/collection"
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+)
+
+func collectionKeys(c *collection.Map) []string {
+	var keys []string
+	for _, md := range c.FindAll() {
+		keys = append(keys, md.Key()+"="+md.Value())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestSOAP(t *testing.T) {
+	bp, err := bodyprocessors.Get("xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		body      string
+		mime      string
+		action    string
+		options   bodyprocessors.Options
+		soap      []string
+		anomalies []string
+	}{
+		{
+			name: "soap 1.1 with ws-security",
+			body: `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"
+  xmlns:wsse="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"
+  xmlns:wsu="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">
+  <soapenv:Header>
+    <wsse:Security>
+      <wsse:UsernameToken>
+        <wsse:Username>admin</wsse:Username>
+        <wsse:Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordText">secret</wsse:Password>
+      </wsse:UsernameToken>
+      <wsu:Timestamp>
+        <wsu:Created>2000-01-01T00:00:00Z</wsu:Created>
+        <wsu:Expires>2000-01-01T00:05:00Z</wsu:Expires>
+      </wsu:Timestamp>
+    </wsse:Security>
+  </soapenv:Header>
+  <soapenv:Body><m:GetUser xmlns:m="urn:users"><id>1</id></m:GetUser></soapenv:Body>
+</soapenv:Envelope>`,
+			mime:   "text/xml",
+			action: `"urn:users#DeleteUser"`,
+			soap: []string{
+				"action=urn:users#DeleteUser",
+				"operation=GetUser",
+				"operation_namespace=urn:users",
+				"version=1.1",
+				"wss_created=2000-01-01T00:00:00Z",
+				"wss_expires=2000-01-01T00:05:00Z",
+				"wss_password_type=text",
+				"wss_security=1",
+				"wss_username=admin",
+			},
+			anomalies: []string{"soap_action_mismatch=1", "wss_password_text=1", "wss_timestamp_expired=1"},
+		},
+		{
+			name: "soap 1.2 fault",
+			body: `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body><env:Fault>
+  <env:Code><env:Value>env:Sender</env:Value></env:Code>
+  <env:Reason><env:Text xml:lang="en">Bad request</env:Text></env:Reason>
+</env:Fault></env:Body></env:Envelope>`,
+			mime:      `application/soap+xml; charset=utf-8; action="urn:users/GetUser"`,
+			soap:      []string{"action=urn:users/GetUser", "fault=1", "fault_code=env:Sender", "fault_string=Bad request", "version=1.2"},
+			anomalies: nil,
+		},
+		{
+			name: "malformed envelope",
+			body: `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body><op/></s:Body>` +
+				`<s:Header/><s:Body/></s:Envelope>`,
+			mime:      "text/xml",
+			action:    "op",
+			soap:      []string{"action=op", "operation=op", "version=1.2"},
+			anomalies: []string{"soap_header_after_body=1", "soap_multiple_bodies=1", "soap_version_mismatch=1"},
+		},
+		{
+			name:      "limits",
+			body:      `<a><b><c/><c/></b></a>`,
+			options:   bodyprocessors.Options{XMLMaxDepth: 2, XMLMaxElements: 3},
+			anomalies: []string{"depth_exceeded=1", "elements_exceeded=1"},
+		},
+		{
+			name:    "within limits",
+			body:    `<a><b><c/><c/></b></a>`,
+			options: bodyprocessors.Options{XMLMaxDepth: 3, XMLMaxElements: 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := corazawaf.NewTransactionVariables()
+			if tt.action != "" {
+				v.RequestHeaders().Add("soapaction", tt.action)
+			}
+			tt.options.Mime = tt.mime
+			if err := bp.ProcessRequest(strings.NewReader(tt.body), v, tt.options); err != nil {
+				t.Fatal(err)
+			}
+			if got := collectionKeys(v.RequestSOAP()); fmt.Sprint(got) != fmt.Sprint(tt.soap) {
+				t.Errorf("unexpected REQUEST_SOAP %v, want %v", got, tt.soap)
+			}
+			if got := collectionKeys(v.RequestXMLAnomalies()); fmt.Sprint(got) != fmt.Sprint(tt.anomalies) {
+				t.Errorf("unexpected REQUEST_XML_ANOMALIES %v, want %v", got, tt.anomalies)
+			}
+		})
+	}
+}
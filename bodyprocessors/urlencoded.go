@@ -4,10 +4,13 @@
 package bodyprocessors
 
 import (
+	"bufio"
+	"errors"
 	"io"
 	"strconv"
 	"strings"
 
+	"github.com/corazawaf/coraza/v3/charset"
 	"github.com/corazawaf/coraza/v3/internal/url"
 	"github.com/corazawaf/coraza/v3/rules"
 )
@@ -15,21 +18,86 @@ import (
 type urlencodedBodyProcessor struct {
 }
 
-func (*urlencodedBodyProcessor) ProcessRequest(reader io.Reader, v rules.TransactionVariables, options Options) error {
-	buf := new(strings.Builder)
-	if _, err := io.Copy(buf, reader); err != nil {
-		return err
-	}
+// errURLEncodedTruncated is returned when the body was truncated in the middle of an argument
+var errURLEncodedTruncated = errors.New("request body truncated in the middle of an argument, last argument discarded")
 
-	b := buf.String()
-	values := url.ParseQuery(b, '&')
+func (*urlencodedBodyProcessor) ProcessRequest(reader io.Reader, v rules.TransactionVariables, options Options) error {
+	// pairs are parsed as they are read so we don't need to keep
+	// a second copy of the body to split it
+	body := new(strings.Builder)
+	br := bufio.NewReader(reader)
 	argsCol := v.ArgsPost()
-	for k, vs := range values {
-		argsCol.Set(k, vs)
+	// form values are percent encoded so the charset is applied to the
+	// decoded keys and values instead of the raw body
+	decode := func(s string) string { return s }
+	if options.Charset != "" {
+		if d, ok := charset.Get(options.Charset); ok {
+			decode = d
+		}
 	}
+	separators := options.ArgumentSeparators
+	if separators == "" {
+		separators = "&"
+	}
+	var err error
+	n := 0
+	for {
+		pair, rerr := readPair(br, separators)
+		body.WriteString(pair)
+		if rerr != nil && rerr != io.EOF {
+			return rerr
+		}
+		last := rerr == io.EOF
+		if !last {
+			pair = pair[:len(pair)-1]
+		}
+		if last && options.Truncated && !options.TruncatedAtSeparator && pair != "" {
+			// the last pair was cut by the body limit, the value
+			// would be corrupt so we discard it
+			err = errURLEncodedTruncated
+			break
+		}
+		if pair != "" {
+			key, value, _ := strings.Cut(pair, "=")
+			key, value = decode(url.QueryUnescape(key)), decode(url.QueryUnescape(value))
+			n++
+			if err = options.ArgumentLimits.Check(n, key, value); err != nil {
+				// the rest of the body is still kept in REQUEST_BODY
+				if _, rerr := io.Copy(body, br); rerr != nil {
+					return rerr
+				}
+				break
+			}
+			argsCol.Add(key, value)
+		}
+		if last {
+			break
+		}
+	}
+
+	b := body.String()
 	v.RequestBody().Set(b)
 	v.RequestBodyLength().Set(strconv.Itoa(len(b)))
-	return nil
+	return err
+}
+
+// readPair reads until any of the separators, which is included in the
+// returned pair, or until the end of the body
+func readPair(br *bufio.Reader, separators string) (string, error) {
+	if len(separators) == 1 {
+		return br.ReadString(separators[0])
+	}
+	pair := strings.Builder{}
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return pair.String(), err
+		}
+		pair.WriteByte(c)
+		if strings.IndexByte(separators, c) >= 0 {
+			return pair.String(), nil
+		}
+	}
 }
 
 func (*urlencodedBodyProcessor) ProcessResponse(reader io.Reader, v rules.TransactionVariables, options Options) error {
@@ -4,6 +4,7 @@
 package bodyprocessors_test
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
@@ -43,3 +44,111 @@ func TestURLEncode(t *testing.T) {
 		}
 	}
 }
+
+func TestURLEncodeTruncated(t *testing.T) {
+	bp, err := bodyprocessors.Get("urlencoded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		body        string
+		truncated   bool
+		atSeparator bool
+		args        map[string]string
+		err         bool
+	}{
+		{"a=1&b=2&c=3", false, false, map[string]string{"a": "1", "b": "2", "c": "3"}, false},
+		{"a=1&b=2&c=3", true, false, map[string]string{"a": "1", "b": "2"}, true},
+		{"a=1&b=2&c=%4", true, false, map[string]string{"a": "1", "b": "2"}, true},
+		{"a=1&b=2&", true, false, map[string]string{"a": "1", "b": "2"}, false},
+		{"a=1&b=2&c=3", true, true, map[string]string{"a": "1", "b": "2", "c": "3"}, false},
+	}
+	for _, tt := range tests {
+		v := corazawaf.NewTransactionVariables()
+		err := bp.ProcessRequest(strings.NewReader(tt.body), v, bodyprocessors.Options{
+			Truncated:            tt.truncated,
+			TruncatedAtSeparator: tt.atSeparator,
+		})
+		if (err != nil) != tt.err {
+			t.Errorf("unexpected error for %q: %v", tt.body, err)
+		}
+		if v.RequestBody().String() != tt.body {
+			t.Errorf("Expected %s, got %s", tt.body, v.RequestBody().String())
+		}
+		if l := len(v.ArgsPost().Data()); l != len(tt.args) {
+			t.Errorf("Expected %d args for %q, got %d", len(tt.args), tt.body, l)
+		}
+		for k, val := range tt.args {
+			if got := v.ArgsPost().Get(k); len(got) != 1 || got[0] != val {
+				t.Errorf("Expected %s, got %v", val, got)
+			}
+		}
+	}
+}
+
+func TestURLEncodeCharset(t *testing.T) {
+	bp, err := bodyprocessors.Get("urlencoded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := corazawaf.NewTransactionVariables()
+	body := "q=%3Cscript%3E%83e%83X%83g&n%E9=1"
+	if err := bp.ProcessRequest(strings.NewReader(body), v, bodyprocessors.Options{Charset: "shift_jis"}); err != nil {
+		t.Fatal(err)
+	}
+	if q := v.ArgsPost().Get("q"); len(q) != 1 || q[0] != "<script>テスト" {
+		t.Errorf("unexpected value %q", q)
+	}
+	if v.RequestBody().String() != body {
+		t.Error("the raw body must be kept")
+	}
+}
+
+func TestURLEncodeSeparators(t *testing.T) {
+	bp, err := bodyprocessors.Get("urlencoded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := corazawaf.NewTransactionVariables()
+	body := "a=1;b=2&c=3"
+	if err := bp.ProcessRequest(strings.NewReader(body), v, bodyprocessors.Options{ArgumentSeparators: "&;"}); err != nil {
+		t.Fatal(err)
+	}
+	for k, val := range map[string]string{"a": "1", "b": "2", "c": "3"} {
+		if got := v.ArgsPost().Get(k); len(got) != 1 || got[0] != val {
+			t.Errorf("expected %s=%s, got %q", k, val, got)
+		}
+	}
+	if v.RequestBody().String() != body {
+		t.Error("the raw body must be kept")
+	}
+}
+
+func TestURLEncodeArgumentLimits(t *testing.T) {
+	bp, err := bodyprocessors.Get("urlencoded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		limits bodyprocessors.ArgumentLimits
+		args   int
+	}{
+		{bodyprocessors.ArgumentLimits{Count: 2}, 2},
+		{bodyprocessors.ArgumentLimits{NameLength: 1}, 2},
+		{bodyprocessors.ArgumentLimits{ValueLength: 3}, 3},
+	}
+	body := "a=1&b=22&cc=333&d=4444"
+	for _, tt := range tests {
+		v := corazawaf.NewTransactionVariables()
+		err := bp.ProcessRequest(strings.NewReader(body), v, bodyprocessors.Options{ArgumentLimits: tt.limits})
+		if !errors.Is(err, bodyprocessors.ErrArgumentsLimit) {
+			t.Errorf("%+v: expected a limit error, got %v", tt.limits, err)
+		}
+		if n := len(v.ArgsPost().FindAll()); n != tt.args {
+			t.Errorf("%+v: expected %d arguments, got %d", tt.limits, tt.args, n)
+		}
+		if v.RequestBody().String() != body {
+			t.Errorf("%+v: the raw body must be kept", tt.limits)
+		}
+	}
+}
@@ -18,13 +18,23 @@ type xmlBodyProcessor struct {
 }
 
 func (*xmlBodyProcessor) ProcessRequest(reader io.Reader, v rules.TransactionVariables, options Options) error {
-	values, contents, err := readXML(reader)
+	reader, transcoded := transcode(reader, options)
+	doc, err := parseXML(reader, transcoded)
 	if err != nil {
 		return err
 	}
 	col := v.RequestXML()
-	col.Set("//@*", values)
-	col.Set("/*", contents)
+	col.Set("//@*", doc.attrs)
+	col.Set("/*", doc.contents)
+	if options.XMLMaxDepth > 0 && doc.depth > options.XMLMaxDepth {
+		v.RequestXMLAnomalies().Set("depth_exceeded", []string{"1"})
+	}
+	if options.XMLMaxElements > 0 && doc.elements > options.XMLMaxElements {
+		v.RequestXMLAnomalies().Set("elements_exceeded", []string{"1"})
+	}
+	if doc.soap != nil {
+		setSOAPVariables(doc.soap, v, options)
+	}
 	return nil
 }
 
@@ -32,14 +42,32 @@ func (*xmlBodyProcessor) ProcessResponse(reader io.Reader, v rules.TransactionVa
 	return nil
 }
 
-func readXML(reader io.Reader) ([]string, []string, error) {
-	var attrs []string
-	var content []string
+// xmlDocument is the content of an XML body
+type xmlDocument struct {
+	attrs    []string
+	contents []string
+	// depth is the maximum nesting level of the elements
+	depth    int
+	elements int
+	// soap is nil unless the root element is a SOAP envelope
+	soap *soapEnvelope
+}
+
+// parseXML reads the document, the declared encoding is ignored if the
+// reader was already transcoded
+func parseXML(reader io.Reader, transcoded bool) (*xmlDocument, error) {
+	doc := &xmlDocument{}
 	dec := xml.NewDecoder(reader)
+	if transcoded {
+		dec.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+			return input, nil
+		}
+	}
+	var path []xml.Name
 	for {
 		token, err := dec.Token()
 		if err != nil && err != io.EOF {
-			return nil, nil, err
+			return nil, err
 		}
 		if token == nil {
 			break
@@ -47,15 +75,32 @@ func readXML(reader io.Reader) ([]string, []string, error) {
 		switch tok := token.(type) {
 		case xml.StartElement:
 			for _, attr := range tok.Attr {
-				attrs = append(attrs, attr.Value)
+				doc.attrs = append(doc.attrs, attr.Value)
+			}
+			path = append(path, tok.Name)
+			doc.elements++
+			if len(path) > doc.depth {
+				doc.depth = len(path)
+			}
+			if len(path) == 1 {
+				doc.soap = newSOAPEnvelope(tok.Name)
+			} else if doc.soap != nil {
+				doc.soap.start(path, tok)
+			}
+		case xml.EndElement:
+			if len(path) > 0 {
+				path = path[:len(path)-1]
 			}
 		case xml.CharData:
 			if c := strings.TrimSpace(string(tok)); c != "" {
-				content = append(content, c)
+				doc.contents = append(doc.contents, c)
+				if doc.soap != nil && len(path) > 0 {
+					doc.soap.text(path, c)
+				}
 			}
 		}
 	}
-	return attrs, content, nil
+	return doc, nil
 }
 
 var (
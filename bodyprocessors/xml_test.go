@@ -27,10 +27,11 @@ func TestXMLAttribures(t *testing.T) {
 </book>
 
 </bookstore>`
-	attrs, contents, err := readXML(bytes.NewReader([]byte(xmldoc)))
+	doc, err := parseXML(bytes.NewReader([]byte(xmldoc)), false)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
+	attrs, contents := doc.attrs, doc.contents
 	if len(attrs) != 3 {
 		t.Errorf("Expected 3 attributes, got %d", len(attrs))
 	}
@@ -50,3 +51,22 @@ func TestXMLAttribures(t *testing.T) {
 		}
 	}
 }
+
+func TestXMLCharset(t *testing.T) {
+	xmldoc := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><a b=\"caf\xe9\">cr\xe8me</a>"
+	reader, transcoded := transcode(bytes.NewReader([]byte(xmldoc)), Options{Charset: "iso-8859-1"})
+	if !transcoded {
+		t.Fatal("expected the body to be transcoded")
+	}
+	doc, err := parseXML(reader, transcoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs, contents := doc.attrs, doc.contents
+	if len(attrs) != 1 || attrs[0] != "café" {
+		t.Errorf("unexpected attributes %q", attrs)
+	}
+	if len(contents) != 1 || contents[0] != "crème" {
+		t.Errorf("unexpected contents %q", contents)
+	}
+}
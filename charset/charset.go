@@ -0,0 +1,221 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package charset transcodes request bodies declared with a charset
+// other than UTF-8, so rules inspect the same text the application sees.
+// ISO-8859-1, windows-1252, UTF-16 and Shift_JIS are supported, other
+// charsets can be added with Register.
+package charset
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Decoder transcodes data to UTF-8, invalid sequences are replaced
+// with the unicode replacement character
+type Decoder func(data string) string
+
+var (
+	mu       sync.RWMutex
+	decoders = map[string]Decoder{}
+)
+
+// Register registers a decoder for a charset name, names are case
+// insensitive. If the charset is already registered it is overwritten.
+func Register(name string, d Decoder) {
+	mu.Lock()
+	defer mu.Unlock()
+	decoders[normalize(name)] = d
+}
+
+// Get returns the decoder of a charset, it returns false for unknown
+// charsets and for UTF-8 and US-ASCII as they don't need transcoding.
+func Get(name string) (Decoder, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	d, ok := decoders[normalize(name)]
+	return d, ok
+}
+
+// readerChunkSize is the number of bytes transcoded at once by readers
+const readerChunkSize = 32 * 1024
+
+// maxCharLen is the longest encoded character of the supported charsets,
+// a UTF-16 surrogate pair
+const maxCharLen = 4
+
+// NewReader returns a reader transcoding r to UTF-8 as it is read, so
+// bodies are never loaded in memory at once. It returns r and false for
+// unknown charsets and for UTF-8. The byte order mark of a UTF-16 body
+// applies to the whole body.
+func NewReader(r io.Reader, name string) (io.Reader, bool) {
+	decode, ok := Get(name)
+	if !ok {
+		return r, false
+	}
+	return &reader{
+		r:      r,
+		decode: decode,
+		utf16:  normalize(name) == "utf-16",
+		buf:    make([]byte, readerChunkSize),
+	}, true
+}
+
+type reader struct {
+	r      io.Reader
+	decode Decoder
+	utf16  bool
+	// prefix is prepended to the chunks following the first one, it
+	// contains the byte order mark of UTF-16 bodies
+	prefix  string
+	started bool
+	buf     []byte
+	// carry contains the last bytes of the previous chunk, which may be
+	// the start of a character
+	carry []byte
+	out   string
+	err   error
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for r.out == "" {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.fill()
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// fill decodes the next chunk of the underlying reader
+func (r *reader) fill() {
+	n := copy(r.buf, r.carry)
+	m, err := r.r.Read(r.buf[n:])
+	chunk := string(r.buf[:n+m])
+	r.carry = r.carry[:0]
+	if err != nil {
+		r.err = err
+		r.out = r.decode(r.prefix + chunk)
+		return
+	}
+	if !r.started && r.utf16 && len(chunk) < 2 {
+		// wait for the byte order mark
+		r.carry = append(r.carry, chunk...)
+		return
+	}
+	var rest string
+	r.out, rest = r.split(chunk)
+	r.carry = append(r.carry, rest...)
+	if !r.started && len(chunk) > len(rest) {
+		r.started = true
+		if r.utf16 && (strings.HasPrefix(chunk, "\xfe\xff") || strings.HasPrefix(chunk, "\xff\xfe")) {
+			r.prefix = chunk[:2]
+		}
+	}
+}
+
+// split decodes chunk without its last bytes if they are the start of a
+// character continuing in the next chunk, which are returned
+func (r *reader) split(chunk string) (string, string) {
+	for k := 0; k < maxCharLen && k <= len(chunk); k++ {
+		out := r.decode(r.prefix + chunk[:len(chunk)-k])
+		if c, size := utf8.DecodeLastRuneInString(out); size == 0 || c != utf8.RuneError {
+			return out, chunk[len(chunk)-k:]
+		}
+	}
+	// the end of the chunk is invalid
+	return r.decode(r.prefix + chunk), ""
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.Trim(name, " \t\"'"))
+}
+
+// windows1252 maps the bytes 0x80 to 0x9F, the rest of the charset
+// matches the first 256 unicode code points
+var windows1252 = [32]rune{
+	0x20ac, 0x0081, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008d, 0x017d, 0x008f,
+	0x0090, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0x009d, 0x017e, 0x0178,
+}
+
+// decodeWindows1252 is also used for ISO-8859-1, like browsers do
+func decodeWindows1252(data string) string {
+	if isASCII(data) {
+		return data
+	}
+	var sb strings.Builder
+	sb.Grow(len(data) * 2)
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c < 0x80:
+			sb.WriteByte(c)
+		case c < 0xa0:
+			sb.WriteRune(windows1252[c-0x80])
+		default:
+			sb.WriteRune(rune(c))
+		}
+	}
+	return sb.String()
+}
+
+func decodeUTF16(data string, bigEndian bool) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		if bigEndian {
+			units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+		} else {
+			units = append(units, uint16(data[i+1])<<8|uint16(data[i]))
+		}
+	}
+	var sb strings.Builder
+	sb.Grow(len(units))
+	for _, r := range utf16.Decode(units) {
+		sb.WriteRune(r)
+	}
+	if len(data)%2 == 1 {
+		sb.WriteRune(utf8.RuneError)
+	}
+	return sb.String()
+}
+
+// decodeUTF16BOM uses the byte order mark if present and
+// defaults to little endian like browsers do
+func decodeUTF16BOM(data string) string {
+	switch {
+	case strings.HasPrefix(data, "\xfe\xff"):
+		return decodeUTF16(data[2:], true)
+	case strings.HasPrefix(data, "\xff\xfe"):
+		return decodeUTF16(data[2:], false)
+	}
+	return decodeUTF16(data, false)
+}
+
+func isASCII(data string) bool {
+	for i := 0; i < len(data); i++ {
+		if data[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	for _, name := range []string{"iso-8859-1", "iso8859-1", "iso_8859-1", "latin1", "l1", "windows-1252", "cp1252"} {
+		Register(name, decodeWindows1252)
+	}
+	Register("utf-16", decodeUTF16BOM)
+	Register("utf-16le", func(data string) string { return decodeUTF16(data, false) })
+	Register("utf-16be", func(data string) string { return decodeUTF16(data, true) })
+	for _, name := range []string{"shift_jis", "shift-jis", "sjis", "windows-31j", "cp932", "ms_kanji"} {
+		Register(name, decodeShiftJIS)
+	}
+}
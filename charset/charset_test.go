@@ -0,0 +1,94 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package charset
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecoders(t *testing.T) {
+	tests := []struct {
+		charset  string
+		input    string
+		expected string
+	}{
+		{"ISO-8859-1", "caf\xe9", "café"},
+		{"latin1", "plain ascii", "plain ascii"},
+		{"windows-1252", "\x80 \x93q\x94 \x81", "€ “q” \u0081"},
+		{"UTF-16LE", "<\x00s\x00>\x00", "<s>"},
+		{"utf-16be", "\x00<\x00s\x00>", "<s>"},
+		{"utf-16", "\xfe\xff\x00<\x00s\x00>", "<s>"},
+		{"utf-16", "\xff\xfe<\x00s\x00>\x00", "<s>"},
+		{"utf-16", "<\x00\x3d\xd8\x00\xde", "<😀"},
+		{"utf-16le", "<\x00s", "<�"},
+		{"Shift_JIS", "\x83e\x83X\x83g", "テスト"},
+		{"shift_jis", "a\xb1\x82\xa0b", "aｱあb"},
+		{"sjis", "\x81\x20x\xff", "� x�"},
+		{"sjis", "\x81", "�"},
+	}
+	for _, tt := range tests {
+		decode, ok := Get(tt.charset)
+		if !ok {
+			t.Fatalf("charset %q not found", tt.charset)
+		}
+		if got := decode(tt.input); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.charset, tt.expected, got)
+		}
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	tests := []struct {
+		charset  string
+		input    string
+		expected string
+	}{
+		{"latin1", "caf\xe9", "café"},
+		{"utf-16", "\xfe\xff\x00<\xd8\x3d\xde\x00\x00>", "<😀>"},
+		{"utf-16", "\xff\xfe<\x00\x3d\xd8\x00\xde>\x00", "<😀>"},
+		{"utf-16le", "<\x00\x3d\xd8\x00\xdes", "<😀�"},
+		{"shift_jis", "a\x83e\x83X\x83g\xff\xff\xff\xffb", "aテスト����b"},
+		{"shift_jis", strings.Repeat("\x83e", readerChunkSize), strings.Repeat("テ", readerChunkSize)},
+	}
+	for _, tt := range tests {
+		readers := map[string]func(io.Reader) io.Reader{
+			"full":     func(r io.Reader) io.Reader { return r },
+			"one byte": iotest.OneByteReader,
+			"half":     iotest.HalfReader,
+		}
+		for name, wrap := range readers {
+			r, ok := NewReader(wrap(strings.NewReader(tt.input)), tt.charset)
+			if !ok {
+				t.Fatalf("charset %q not found", tt.charset)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("%s with %s reads: expected %q, got %q", tt.charset, name, tt.expected, got)
+			}
+		}
+	}
+	if _, ok := NewReader(strings.NewReader("abc"), "utf-8"); ok {
+		t.Error("utf-8 must not be transcoded")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	if _, ok := Get("utf-8"); ok {
+		t.Error("utf-8 must not be transcoded")
+	}
+	if _, ok := Get("x-test"); ok {
+		t.Fatal("unexpected decoder for x-test")
+	}
+	Register("X-Test", func(string) string { return "test" })
+	decode, ok := Get(` "x-test" `)
+	if !ok || decode("abc") != "test" {
+		t.Error("expected registered decoder")
+	}
+}
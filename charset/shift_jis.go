@@ -0,0 +1,71 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package charset
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// shiftJISIndex returns the position of a double byte character in
+// shiftJISTable, or -1 if the bytes are not a valid pair
+func shiftJISIndex(lead, trail byte) int {
+	var l, t int
+	switch {
+	case lead >= 0x81 && lead <= 0x9f:
+		l = int(lead) - 0x81
+	case lead >= 0xe0 && lead <= 0xfc:
+		l = int(lead) - 0xe0 + 0x1f
+	default:
+		return -1
+	}
+	switch {
+	case trail >= 0x40 && trail <= 0x7e:
+		t = int(trail) - 0x40
+	case trail >= 0x80 && trail <= 0xfc:
+		t = int(trail) - 0x41
+	default:
+		return -1
+	}
+	return l*188 + t
+}
+
+// decodeShiftJIS decodes Shift_JIS with the windows-31j extensions
+// sent by browsers for forms declared as Shift_JIS
+func decodeShiftJIS(data string) string {
+	if isASCII(data) {
+		return data
+	}
+	var sb strings.Builder
+	sb.Grow(len(data) * 3 / 2)
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c < 0x80:
+			sb.WriteByte(c)
+		case c == 0x80:
+			sb.WriteRune(0x80)
+		case c >= 0xa1 && c <= 0xdf:
+			// half width katakana
+			sb.WriteRune(0xff61 + rune(c-0xa1))
+		case c == 0xa0 || c >= 0xfd:
+			sb.WriteRune(utf8.RuneError)
+		case i+1 < len(data):
+			idx := shiftJISIndex(c, data[i+1])
+			if idx == -1 || shiftJISTable[idx] == 0 {
+				sb.WriteRune(utf8.RuneError)
+				// an ascii second byte is decoded on its own, like browsers do
+				if data[i+1] >= 0x80 {
+					i++
+				}
+				continue
+			}
+			sb.WriteRune(rune(shiftJISTable[idx]))
+			i++
+		default:
+			sb.WriteRune(utf8.RuneError)
+		}
+	}
+	return sb.String()
+}
@@ -29,3 +29,11 @@ type Collection interface {
 	// Reset the current CollectionMap
 	Reset()
 }
+
+// Visitor is implemented by the collections that can be iterated
+// without building a []types.MatchData copy of their elements
+type Visitor interface {
+	// Visit calls fn with the key and value of each element, in no
+	// particular order, until fn returns false
+	Visit(fn func(key string, value string) bool)
+}
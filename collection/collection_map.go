@@ -5,6 +5,8 @@ package collection
 
 import (
 	"regexp"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/corazawaf/coraza/v3/internal/corazarules"
 	"github.com/corazawaf/coraza/v3/types"
@@ -14,34 +16,43 @@ import (
 // Map are used to store VARIABLE data
 // for transactions, this data structured is designed
 // to store slices of data for keys
+// Keys are case insensitive, they are indexed in lowercase and the
+// original casing is kept in the values for logging
 // Important: CollectionMaps ARE NOT concurrent safe
 type Map struct {
 	data     map[string][]types.AnchoredVar
 	name     string
 	variable variables.RuleVariable
+	// size is the approximate memory used by data
+	size   int64
+	budget *MemoryBudget
+	arena  *corazarules.Arena
 }
 
 // Get returns a slice of strings for a key
 func (c *Map) Get(key string) []string {
 	var values []string
-	for _, a := range c.data[key] {
+	for _, a := range c.data[canonicalKey(key)] {
 		values = append(values, a.Value)
 	}
 	return values
 }
 
+// First returns the first value for a key without allocating
+func (c *Map) First(key string) (string, bool) {
+	if v := c.data[canonicalKey(key)]; len(v) > 0 {
+		return v[0].Value, true
+	}
+	return "", false
+}
+
 // FindRegex returns a slice of MatchData for the regex
 func (c *Map) FindRegex(key *regexp.Regexp) []types.MatchData {
 	var result []types.MatchData
 	for k, data := range c.data {
 		if key.MatchString(k) {
 			for _, d := range data {
-				result = append(result, &corazarules.MatchData{
-					VariableName_: c.name,
-					Variable_:     c.variable,
-					Key_:          d.Name,
-					Value_:        d.Value,
-				})
+				result = append(result, c.newMatchData(d.Name, d.Value))
 			}
 		}
 	}
@@ -55,14 +66,10 @@ func (c *Map) FindString(key string) []types.MatchData {
 		return c.FindAll()
 	}
 	// if key is not empty
-	if e, ok := c.data[key]; ok {
+	if e, ok := c.data[canonicalKey(key)]; ok {
+		result = c.arena.MatchDataSlice(len(e))
 		for _, aVar := range e {
-			result = append(result, &corazarules.MatchData{
-				VariableName_: c.name,
-				Variable_:     c.variable,
-				Key_:          aVar.Name,
-				Value_:        aVar.Value,
-			})
+			result = append(result, c.newMatchData(aVar.Name, aVar.Value))
 		}
 	}
 	return result
@@ -70,20 +77,51 @@ func (c *Map) FindString(key string) []types.MatchData {
 
 // FindAll returns all the contained elements
 func (c *Map) FindAll() []types.MatchData {
-	var result []types.MatchData
+	n := 0
+	for _, data := range c.data {
+		n += len(data)
+	}
+	if n == 0 {
+		return nil
+	}
+	result := c.arena.MatchDataSlice(n)
 	for _, data := range c.data {
 		for _, d := range data {
-			result = append(result, &corazarules.MatchData{
-				VariableName_: c.name,
-				Variable_:     c.variable,
-				Key_:          d.Name,
-				Value_:        d.Value,
-			})
+			result = append(result, c.newMatchData(d.Name, d.Value))
 		}
 	}
 	return result
 }
 
+// FindFunc returns a slice of MatchData for the elements whose key is
+// accepted by keep, keys are passed with their original case
+func (c *Map) FindFunc(keep func(key string) bool) []types.MatchData {
+	return c.appendFunc(nil, keep)
+}
+
+func (c *Map) appendFunc(result []types.MatchData, keep func(key string) bool) []types.MatchData {
+	for _, data := range c.data {
+		for _, d := range data {
+			if keep(d.Name) {
+				result = append(result, c.newMatchData(d.Name, d.Value))
+			}
+		}
+	}
+	return result
+}
+
+// Visit calls fn with the key, in its original case, and the value of
+// each element until fn returns false
+func (c *Map) Visit(fn func(key string, value string) bool) {
+	for _, data := range c.data {
+		for _, d := range data {
+			if !fn(d.Name, d.Value) {
+				return
+			}
+		}
+	}
+}
+
 func (c *Map) keysRx(rx *regexp.Regexp) []string {
 	var keys []string
 	for k := range c.data {
@@ -104,8 +142,20 @@ func (c *Map) keys() []string {
 
 // AddCS a value to some key with case sensitive vKey
 func (c *Map) AddCS(key string, vKey string, vVal string) {
+	key = canonicalKey(key)
+	n := int64(len(vKey) + len(vVal) + valueOverhead)
+	if _, ok := c.data[key]; !ok {
+		n += int64(len(key) + keyOverhead)
+	}
+	if !c.reserve(n) {
+		return
+	}
 	aVal := types.AnchoredVar{Name: vKey, Value: vVal}
-	c.data[key] = append(c.data[key], aVal)
+	vals, ok := c.data[key]
+	if !ok {
+		vals = c.arena.AnchoredVars(1)
+	}
+	c.data[key] = append(vals, aVal)
 }
 
 // Add a value to some key
@@ -116,6 +166,7 @@ func (c *Map) Add(key string, value string) {
 // AddUniqueCS will add a value to a key if it is not already there
 // with case sensitive vKey
 func (c *Map) AddUniqueCS(key string, vKey string, vVal string) {
+	key = canonicalKey(key)
 	if c.data[key] == nil {
 		c.AddCS(key, vKey, vVal)
 		return
@@ -138,10 +189,27 @@ func (c *Map) AddUnique(key string, value string) {
 // internally converts [] string to []types.AnchoredVar
 // with case sensitive vKey
 func (c *Map) SetCS(key string, vKey string, values []string) {
-	c.data[key] = make([]types.AnchoredVar, 0, len(values))
+	key = canonicalKey(key)
+	n := int64(len(key) + keyOverhead)
+	for _, v := range values {
+		n += int64(len(vKey) + len(v) + valueOverhead)
+	}
+	// the current values are kept if the new ones don't fit once they
+	// are released
+	if old, ok := c.data[key]; ok {
+		n -= entrySize(key, old)
+	}
+	if n > 0 && !c.reserve(n) {
+		return
+	}
+	if n < 0 {
+		c.release(-n)
+	}
+	vals := c.arena.AnchoredVars(len(values))
 	for _, v := range values {
-		c.data[key] = append(c.data[key], types.AnchoredVar{Name: vKey, Value: v})
+		vals = append(vals, types.AnchoredVar{Name: vKey, Value: v})
 	}
+	c.data[key] = vals
 }
 
 // Set will replace the key's value with this slice
@@ -155,15 +223,23 @@ func (c *Map) Set(key string, values []string) {
 // it will be appended
 // with case sensitive vKey
 func (c *Map) SetIndexCS(key string, index int, vKey string, value string) {
+	key = canonicalKey(key)
 	if c.data[key] == nil {
-		c.data[key] = []types.AnchoredVar{{Name: vKey, Value: value}}
+		c.AddCS(key, vKey, value)
 	}
-	vVal := types.AnchoredVar{Name: vKey, Value: value}
 	if len(c.data[key]) <= index {
-		c.data[key] = append(c.data[key], vVal)
+		c.AddCS(key, vKey, value)
 		return
 	}
-	c.data[key][index] = vVal
+	old := c.data[key][index]
+	n := int64(len(vKey) + len(value) - len(old.Name) - len(old.Value))
+	if n > 0 && !c.reserve(n) {
+		return
+	}
+	if n < 0 {
+		c.release(-n)
+	}
+	c.data[key][index] = types.AnchoredVar{Name: vKey, Value: value}
 }
 
 // SetIndex will place the value under the index
@@ -175,9 +251,24 @@ func (c *Map) SetIndex(key string, index int, value string) {
 
 // Remove deletes the key from the CollectionMap
 func (c *Map) Remove(key string) {
+	key = canonicalKey(key)
+	values, ok := c.data[key]
+	if !ok {
+		return
+	}
+	c.release(entrySize(key, values))
 	delete(c.data, key)
 }
 
+// entrySize returns the memory accounted for a key and its values
+func entrySize(key string, values []types.AnchoredVar) int64 {
+	n := int64(len(key) + keyOverhead)
+	for _, v := range values {
+		n += int64(len(v.Name) + len(v.Value) + valueOverhead)
+	}
+	return n
+}
+
 // Name returns the name for the current CollectionMap
 func (c *Map) Name() string {
 	return c.name
@@ -188,6 +279,49 @@ func (c *Map) Reset() {
 	for k := range c.data {
 		delete(c.data, k)
 	}
+	c.release(c.size)
+}
+
+// Size returns the approximate memory in bytes used by the values
+func (c *Map) Size() int64 {
+	return c.size
+}
+
+// SetMemoryBudget shares a memory budget with other collections, the
+// values exceeding it are not added. It must be set while the collection
+// is empty.
+func (c *Map) SetMemoryBudget(b *MemoryBudget) {
+	c.budget = b
+}
+
+// SetArena allocates the entries of the collection and the MatchData it
+// returns from the arena, they must not be used once the arena is reset.
+// A nil arena allocates them on the heap. It must be set while the
+// collection is empty.
+func (c *Map) SetArena(a *corazarules.Arena) {
+	c.arena = a
+}
+
+func (c *Map) newMatchData(key string, value string) types.MatchData {
+	md := c.arena.NewMatchData()
+	md.VariableName_ = c.name
+	md.Variable_ = c.variable
+	md.Key_ = key
+	md.Value_ = value
+	return md
+}
+
+func (c *Map) reserve(n int64) bool {
+	if !c.budget.reserve(c.name, n) {
+		return false
+	}
+	c.size += n
+	return true
+}
+
+func (c *Map) release(n int64) {
+	c.budget.release(n)
+	c.size -= n
 }
 
 // Data returns all the data in the CollectionMap
@@ -202,7 +336,21 @@ func (c *Map) Data() map[string][]string {
 	return result
 }
 
-var _ Collection = &Map{}
+// canonicalKey returns the lowercase key used to index the values, it
+// doesn't allocate for keys already in lowercase
+func canonicalKey(key string) string {
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; ('A' <= c && c <= 'Z') || c >= utf8.RuneSelf {
+			return strings.ToLower(key)
+		}
+	}
+	return key
+}
+
+var (
+	_ Collection = &Map{}
+	_ Visitor    = &Map{}
+)
 
 // NewMap returns a collection of key->[]values
 func NewMap(variable variables.RuleVariable) *Map {
@@ -37,3 +37,56 @@ func TestCollectionMap(t *testing.T) {
 		t.Errorf("Error should find regex, got %d", l)
 	}
 }
+
+func TestCollectionVisit(t *testing.T) {
+	get := NewMap(variables.ArgsGet)
+	post := NewMap(variables.ArgsPost)
+	get.AddCS("a", "A", "1")
+	get.Add("b", "2")
+	post.Add("c", "3")
+	args := NewProxy(variables.Args, get, post)
+
+	visited := map[string]string{}
+	args.Visit(func(key string, value string) bool {
+		visited[key] = value
+		return true
+	})
+	if len(visited) != 3 || visited["A"] != "1" || visited["c"] != "3" {
+		t.Errorf("unexpected elements %v", visited)
+	}
+	n := 0
+	args.Visit(func(string, string) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("expected the visit to stop, got %d elements", n)
+	}
+	if m := args.FindFunc(func(key string) bool { return key != "b" }); len(m) != 2 {
+		t.Errorf("expected 2 elements, got %d", len(m))
+	}
+}
+
+func TestCollectionMapCaseInsensitive(t *testing.T) {
+	c := NewMap(variables.RequestHeaders)
+	c.Add("User-Agent", "curl")
+	c.AddUnique("user-agent", "curl")
+	c.SetIndex("X-ID", 0, "1")
+	if v := c.Get("USER-AGENT"); len(v) != 1 || v[0] != "curl" {
+		t.Errorf("unexpected values %v", v)
+	}
+	if v, ok := c.First("x-id"); !ok || v != "1" {
+		t.Errorf("unexpected value %q", v)
+	}
+	m := c.FindString("user-agent")
+	if len(m) != 1 || m[0].Key() != "User-Agent" {
+		t.Errorf("expected the original casing to be kept, got %v", m)
+	}
+	if _, ok := c.Data()["user-agent"]; !ok {
+		t.Error("expected the key to be indexed in lowercase")
+	}
+	c.Remove("USER-AGENT")
+	if len(c.Get("user-agent")) != 0 {
+		t.Error("expected the key to be removed")
+	}
+}
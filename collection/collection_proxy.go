@@ -47,6 +47,31 @@ func (c *Proxy) FindAll() []types.MatchData {
 	return res
 }
 
+// FindFunc returns a slice of MatchData for the elements of the proxied
+// collections whose key is accepted by keep
+func (c *Proxy) FindFunc(keep func(key string) bool) []types.MatchData {
+	var res []types.MatchData
+	for _, c := range c.data {
+		res = c.appendFunc(res, keep)
+	}
+	return res
+}
+
+// Visit calls fn with the key and value of each element of the proxied
+// collections until fn returns false
+func (c *Proxy) Visit(fn func(key string, value string) bool) {
+	stopped := false
+	for _, c := range c.data {
+		c.Visit(func(key string, value string) bool {
+			stopped = !fn(key, value)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
 // Name returns the name for the current CollectionProxy
 func (c *Proxy) Name() string {
 	return c.name
@@ -61,6 +86,16 @@ func (c *Proxy) Get(key string) []string {
 	return res
 }
 
+// First returns the first value for a key found in the proxied maps
+func (c *Proxy) First(key string) (string, bool) {
+	for _, c := range c.data {
+		if v, ok := c.First(key); ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
 // Data returns merged data from all CollectionMap
 func (c *Proxy) Data() map[string][]string {
 	res := map[string][]string{}
@@ -76,7 +111,10 @@ func (c *Proxy) Data() map[string][]string {
 func (c *Proxy) Reset() {
 }
 
-var _ Collection = &Proxy{}
+var (
+	_ Collection = &Proxy{}
+	_ Visitor    = &Proxy{}
+)
 
 // NewProxy returns a Proxy collection that merges all collections
 func NewProxy(variable variables.RuleVariable, data ...*Map) *Proxy {
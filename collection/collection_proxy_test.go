@@ -62,3 +62,20 @@ func TestCollectionProxy(t *testing.T) {
 		t.Error("Error finding regex")
 	}
 }
+
+func TestCollectionProxyFirst(t *testing.T) {
+	c1 := NewMap(variables.ArgsPost)
+	c2 := NewMap(variables.ArgsGet)
+	proxy := NewProxy(variables.Args, c1, c2)
+	c2.Set("key", []string{"first", "second"})
+
+	if v, ok := c2.First("key"); !ok || v != "first" {
+		t.Errorf("unexpected first value %q", v)
+	}
+	if v, ok := proxy.First("key"); !ok || v != "first" {
+		t.Errorf("unexpected first value %q", v)
+	}
+	if _, ok := proxy.First("missing"); ok {
+		t.Error("unexpected value for missing key")
+	}
+}
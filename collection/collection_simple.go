@@ -20,6 +20,7 @@ type Simple struct {
 	data     string
 	name     string
 	variable variables.RuleVariable
+	arena    *corazarules.Arena
 }
 
 // FindRegex returns a slice of MatchData for the regex
@@ -34,13 +35,22 @@ func (c *Simple) FindString(key string) []types.MatchData {
 
 // FindAll returns a single MatchData for the current data
 func (c *Simple) FindAll() []types.MatchData {
-	return []types.MatchData{
-		&corazarules.MatchData{
-			VariableName_: c.name,
-			Variable_:     c.variable,
-			Value_:        c.data,
-		},
-	}
+	md := c.arena.NewMatchData()
+	md.VariableName_ = c.name
+	md.Variable_ = c.variable
+	md.Value_ = c.data
+	return []types.MatchData{md}
+}
+
+// SetArena allocates the MatchData returned by the collection from the
+// arena, see Map.SetArena
+func (c *Simple) SetArena(a *corazarules.Arena) {
+	c.arena = a
+}
+
+// Visit calls fn with an empty key and the value
+func (c *Simple) Visit(fn func(key string, value string) bool) {
+	fn("", c.data)
 }
 
 // String returns the first string occurrence of a key
@@ -75,7 +85,10 @@ func (c *Simple) Reset() {
 	c.data = ""
 }
 
-var _ Collection = &Simple{}
+var (
+	_ Collection = &Simple{}
+	_ Visitor    = &Simple{}
+)
 
 // NewSimple creates a new CollectionSimple
 func NewSimple(variable variables.RuleVariable) *Simple {
@@ -18,6 +18,8 @@ type SizeProxy struct {
 	data     []*Map
 	name     string
 	variable variables.RuleVariable
+	// keys is true if the size of the keys is counted too
+	keys bool
 }
 
 // FindRegex returns a slice of MatchData for the regex
@@ -41,6 +43,11 @@ func (c *SizeProxy) FindAll() []types.MatchData {
 	}
 }
 
+// Visit calls fn with an empty key and the combined size
+func (c *SizeProxy) Visit(fn func(key string, value string) bool) {
+	fn("", strconv.FormatInt(c.Size(), 10))
+}
+
 // Size returns the size of all the collections values
 func (c *SizeProxy) Size() int64 {
 	i := 0
@@ -49,6 +56,9 @@ func (c *SizeProxy) Size() int64 {
 		for _, data := range d.data {
 			for _, v := range data {
 				i += len(v.Value)
+				if c.keys {
+					i += len(v.Name)
+				}
 			}
 		}
 	}
@@ -65,7 +75,10 @@ func (c *SizeProxy) Reset() {
 	// do nothing
 }
 
-var _ Collection = &SizeProxy{}
+var (
+	_ Collection = &SizeProxy{}
+	_ Visitor    = &SizeProxy{}
+)
 
 // NewCollectionSizeProxy returns a collection that
 // only returns the total sum of all the collections values
@@ -76,3 +89,12 @@ func NewCollectionSizeProxy(variable variables.RuleVariable, data ...*Map) *Size
 		data:     data,
 	}
 }
+
+// NewCollectionCombinedSizeProxy returns a collection that returns the
+// total sum of all the collections keys and values, like
+// ARGS_COMBINED_SIZE counts the names and the values of the arguments
+func NewCollectionCombinedSizeProxy(variable variables.RuleVariable, data ...*Map) *SizeProxy {
+	p := NewCollectionSizeProxy(variable, data...)
+	p.keys = true
+	return p
+}
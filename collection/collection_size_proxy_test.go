@@ -32,3 +32,16 @@ func TestCollectionSizeProxy(t *testing.T) {
 	}
 
 }
+
+func TestCollectionCombinedSizeProxy(t *testing.T) {
+	c1 := NewMap(variables.ArgsPost)
+	c2 := NewMap(variables.ArgsGet)
+	proxy := NewCollectionCombinedSizeProxy(variables.ArgsCombinedSize, c1, c2)
+
+	c1.Set("key1", []string{"value1", "value2"})
+	c2.Set("key3", []string{"value3"})
+	// names are counted once per value
+	if proxy.Size() != 30 {
+		t.Errorf("Error finding size for combined size proxy, got %d", proxy.Size())
+	}
+}
@@ -67,6 +67,36 @@ func (c *TranslationProxy) FindAll() []types.MatchData {
 	return res
 }
 
+// FindFunc returns a slice of MatchData for the keys of the proxied
+// collections accepted by keep
+func (c *TranslationProxy) FindFunc(keep func(key string) bool) []types.MatchData {
+	var res []types.MatchData
+	for _, c := range c.data {
+		for k := range c.data {
+			if keep(k) {
+				res = append(res, &corazarules.MatchData{
+					VariableName_: c.name,
+					Variable_:     c.variable,
+					Value_:        k,
+				})
+			}
+		}
+	}
+	return res
+}
+
+// Visit calls fn with each key of the proxied collections, as both the
+// key and the value, until fn returns false
+func (c *TranslationProxy) Visit(fn func(key string, value string) bool) {
+	for _, c := range c.data {
+		for k := range c.data {
+			if !fn(k, k) {
+				return
+			}
+		}
+	}
+}
+
 // Data returns the keys of all Proxy collections
 func (c *TranslationProxy) Data() []string {
 	var res []string
@@ -96,7 +126,10 @@ func (c *TranslationProxy) Get(index int) string {
 	return ""
 }
 
-var _ Collection = &TranslationProxy{}
+var (
+	_ Collection = &TranslationProxy{}
+	_ Visitor    = &TranslationProxy{}
+)
 
 // NewTranslationProxy creates a translation proxy
 // Translation proxies are used to merge variable keys from multiple collections
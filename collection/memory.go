@@ -0,0 +1,80 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package collection
+
+// Approximate overhead of the Map entries, on top of the length of the
+// strings: the AnchoredVar and the map bucket slot of each key
+const (
+	valueOverhead = 32
+	keyOverhead   = 48
+)
+
+// MemoryBudget limits the approximate memory used by a group of
+// collections, like the request data of a transaction. Collections stop
+// adding values once the limit is exceeded.
+// Important: MemoryBudget is NOT concurrent safe
+type MemoryBudget struct {
+	limit      int64
+	used       int64
+	exceeded   bool
+	onExceeded func(name string)
+}
+
+// NewMemoryBudget returns a budget without limit
+func NewMemoryBudget() *MemoryBudget {
+	return &MemoryBudget{}
+}
+
+// SetLimit sets the limit in bytes, zero disables it. onExceeded is
+// called with the name of the collection the first time a value is
+// rejected, it may be nil.
+func (b *MemoryBudget) SetLimit(limit int64, onExceeded func(name string)) {
+	b.limit = limit
+	b.onExceeded = onExceeded
+}
+
+// Used returns the bytes used by the collections
+func (b *MemoryBudget) Used() int64 {
+	return b.used
+}
+
+// Exceeded returns true if a value was rejected since the last Reset
+func (b *MemoryBudget) Exceeded() bool {
+	return b.exceeded
+}
+
+// Reset clears the usage, it must be called after resetting the
+// collections
+func (b *MemoryBudget) Reset() {
+	b.used = 0
+	b.exceeded = false
+}
+
+// reserve returns false if n bytes don't fit in the budget
+func (b *MemoryBudget) reserve(name string, n int64) bool {
+	if b == nil {
+		return true
+	}
+	if b.limit > 0 && b.used+n > b.limit {
+		if !b.exceeded {
+			b.exceeded = true
+			if b.onExceeded != nil {
+				b.onExceeded(name)
+			}
+		}
+		return false
+	}
+	b.used += n
+	return true
+}
+
+func (b *MemoryBudget) release(n int64) {
+	if b == nil {
+		return
+	}
+	b.used -= n
+	if b.used < 0 {
+		b.used = 0
+	}
+}
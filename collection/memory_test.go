@@ -0,0 +1,66 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package collection
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/types/variables"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	budget := NewMemoryBudget()
+	var exceeded []string
+	budget.SetLimit(300, func(name string) { exceeded = append(exceeded, name) })
+	args := NewMap(variables.ArgsGet)
+	headers := NewMap(variables.RequestHeaders)
+	args.SetMemoryBudget(budget)
+	headers.SetMemoryBudget(budget)
+
+	args.Add("a", "1")
+	headers.Add("host", "example.com")
+	if budget.Used() != args.Size()+headers.Size() || budget.Used() == 0 {
+		t.Fatalf("unexpected usage %d", budget.Used())
+	}
+	for i := 0; i < 10; i++ {
+		args.Add("b", "1234567890")
+	}
+	if budget.Used() > 300 {
+		t.Errorf("expected the usage to stay under the limit, got %d", budget.Used())
+	}
+	if !budget.Exceeded() || len(exceeded) != 1 || exceeded[0] != "ARGS_GET" {
+		t.Errorf("expected a single exceeded notification, got %v", exceeded)
+	}
+	if n := len(args.Get("b")); n == 0 || n == 10 {
+		t.Errorf("expected some values to be discarded, got %d", n)
+	}
+
+	args.Remove("b")
+	args.Set("a", []string{"2"})
+	args.SetIndex("a", 0, "3")
+	if budget.Used() != args.Size()+headers.Size() {
+		t.Errorf("expected the usage to follow the collections, got %d", budget.Used())
+	}
+
+	// values that don't fit keep the current ones, the replaced values
+	// are counted as released
+	used := budget.Used()
+	args.Set("a", []string{strings.Repeat("x", 300)})
+	if v := args.Get("a"); len(v) != 1 || v[0] != "3" || budget.Used() != used {
+		t.Errorf("expected the current value to be kept, got %v", v)
+	}
+	// the new value fills the budget once the current one is released
+	args.Set("a", []string{strings.Repeat("x", int(301-used))})
+	if v := args.Get("a"); len(v) != 1 || v[0] == "3" {
+		t.Errorf("expected the value to be replaced within the budget, got %v", v)
+	}
+
+	args.Reset()
+	headers.Reset()
+	budget.Reset()
+	if budget.Used() != 0 || budget.Exceeded() || args.Size() != 0 {
+		t.Errorf("expected the budget to be reset, got %d", budget.Used())
+	}
+}
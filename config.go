@@ -6,8 +6,13 @@ package coraza
 import (
 	"io/fs"
 
+	"github.com/corazawaf/coraza/v3/accesslist"
 	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/internal/seclang"
 	"github.com/corazawaf/coraza/v3/loggers"
+	"github.com/corazawaf/coraza/v3/openapi"
+	"github.com/corazawaf/coraza/v3/profiler"
+	"github.com/corazawaf/coraza/v3/ratelimit"
 	"github.com/corazawaf/coraza/v3/types"
 )
 
@@ -44,9 +49,109 @@ type WAFConfig interface {
 	// It contains the severity so the cb can decide to skip it or not
 	WithErrorCallback(logger func(rule types.MatchedRule)) WAFConfig
 
+	// WithErrorEventCallback configures a callback receiving a structured
+	// event for each logged rule, the events can be filtered by severity.
+	WithErrorEventCallback(config ErrorCallbackConfig) WAFConfig
+
 	// WithRootFS configures the root file system.
 	WithRootFS(fs fs.FS) WAFConfig
-}
+
+	// WithCRSPlugin registers a CRS 4 plugin, like the WordPress rule
+	// exclusions, from its file system. The *-config.conf, *-before.conf
+	// and *-after.conf files of the plugin are loaded where the directives
+	// include the files of the same kind of the CRS plugins directory:
+	//
+	//	Include @owasp_crs/plugins/*-config.conf
+	//	Include @owasp_crs/plugins/*-before.conf
+	//	Include @owasp_crs/rules/*.conf
+	//	Include @owasp_crs/plugins/*-after.conf
+	//
+	// The files are read from the root of the plugin file system or from
+	// its plugins directory. Creating the WAF fails if the directives
+	// don't include the plugin files.
+	WithCRSPlugin(plugin fs.FS) WAFConfig
+
+	// WithCandidateDirectives evaluates every transaction in shadow mode against
+	// a candidate ruleset parsed from the given directives, it shares the WAF
+	// configuration but never interrupts transactions. cb is called with the
+	// divergences between both rulesets when the transaction is logged.
+	WithCandidateDirectives(directives string, cb func(diff types.RuleSetDiff)) WAFConfig
+
+	// WithRateLimitStore configures the store keeping the counters of the
+	// @rateLimit operator, counters are kept in memory by default.
+	WithRateLimitStore(store ratelimit.Store) WAFConfig
+
+	// WithAccessList configures the allow and deny list evaluated before
+	// the phase 1 rules, the list can be updated after the WAF is created.
+	WithAccessList(list *accesslist.List) WAFConfig
+
+	// WithOpenAPI enforces an OpenAPI specification before the phase 1 and
+	// phase 2 rules, the requests violating it are rejected with a 400
+	// status if the action is openapi.Reject and the rule engine is On.
+	WithOpenAPI(spec *openapi.Spec, action openapi.Action) WAFConfig
+
+	// WithProfile learns the arguments of every endpoint in the profile, or
+	// checks the requests against it before the phase 2 rules depending on
+	// the mode. The profile can be exported once enough traffic was learned.
+	WithProfile(profile *profiler.Profile, mode profiler.Mode) WAFConfig
+
+	// WithSeverityBlock denies with the status the requests matched by the
+	// non disruptive rules at least as severe as the severity, like
+	// SecSeverityBlock. It overrides the directives.
+	WithSeverityBlock(severity types.RuleSeverity, status int) WAFConfig
+
+	// WithTransactionPool configures the reuse of the closed transactions.
+	// Disabling it suits long-lived transactions, otherwise the buffers
+	// larger than maxBufferSize bytes are released instead of being reused,
+	// zero means no limit.
+	WithTransactionPool(enabled bool, maxBufferSize int) WAFConfig
+
+	// WithTransactionArena allocates the match data, the matched rules and
+	// the collection entries of the transactions by slabs reused with the
+	// pooled transactions, like SecTransactionArena.
+	// The matched rules must not be used once a transaction is closed.
+	WithTransactionArena() WAFConfig
+
+	// WithParallelRules tests the independent rules of a phase with the
+	// number of goroutines, like SecParallelRuleWorkers. The rules that can
+	// match are then evaluated in order, the results don't change.
+	WithParallelRules(workers int) WAFConfig
+
+	// WithLenientParsing ignores the unknown directives and actions with a
+	// warning instead of failing.
+	WithLenientParsing() WAFConfig
+
+	// WithUnknownDirectiveHandler configures a handler for the directives
+	// unknown to the parser, like vendor specific annotations. The handler
+	// returns ErrUnknownDirective for the directives it doesn't implement.
+	WithUnknownDirectiveHandler(h func(directive string, args string) error) WAFConfig
+
+	// WithIDGenerator configures the function generating the IDs of the
+	// transactions created with NewTransaction, like the request or trace
+	// IDs of the upstream. It must be safe for concurrent use, random IDs
+	// are used if it returns an empty ID.
+	WithIDGenerator(gen func() string) WAFConfig
+
+	// WithBodyProcessor routes the request bodies of a media type, like
+	// application/vnd.api+json, to a body processor like JSON, overriding
+	// the one chosen from the Content-Type. Custom processors are
+	// registered with bodyprocessors.Register.
+	WithBodyProcessor(mediaType string, processor string) WAFConfig
+
+	// WithBodyProcessorSniffing chooses the JSON or XML body processor
+	// from the first bytes of the request bodies whose Content-Type has
+	// no body processor.
+	WithBodyProcessorSniffing() WAFConfig
+
+	// WithMethodBodyProcessor sets the body processor of the requests of a
+	// method, like PROPFIND, whose Content-Type has no body processor.
+	// The WebDAV methods use XML by default, NONE removes the processor.
+	WithMethodBodyProcessor(method string, processor string) WAFConfig
+}
+
+// ErrUnknownDirective is returned by the unknown directive handlers for
+// the directives they don't implement.
+var ErrUnknownDirective = seclang.ErrUnknownDirective
 
 // NewWAFConfig creates a new WAFConfig with the default settings.
 func NewWAFConfig() WAFConfig {
@@ -99,6 +204,26 @@ func NewAuditLogConfig() AuditLogConfig {
 	return &auditLogConfig{}
 }
 
+// ErrorCallbackConfig controls the structured error callback.
+type ErrorCallbackConfig interface {
+	// WithCallback sets the function receiving the events.
+	WithCallback(cb func(event types.ErrorEvent)) ErrorCallbackConfig
+
+	// WithSeverities only delivers the events of rules with one of the given
+	// severities, rules without severity are skipped.
+	WithSeverities(severities ...types.RuleSeverity) ErrorCallbackConfig
+
+	// WithMinSeverity only delivers the events of rules at least as severe
+	// as the given severity, rules without severity are skipped.
+	WithMinSeverity(severity types.RuleSeverity) ErrorCallbackConfig
+}
+
+// NewErrorCallbackConfig returns a new ErrorCallbackConfig delivering the
+// events of every logged rule.
+func NewErrorCallbackConfig() ErrorCallbackConfig {
+	return &errorCallbackConfig{}
+}
+
 type wafRule struct {
 	rule *corazawaf.Rule
 	str  string
@@ -106,14 +231,49 @@ type wafRule struct {
 }
 
 type wafConfig struct {
-	rules            []wafRule
-	auditLog         *auditLogConfig
-	contentInjection bool
-	requestBody      *requestBodyConfig
-	responseBody     *responseBodyConfig
-	debugLogger      loggers.DebugLogger
-	errorCallback    func(rule types.MatchedRule)
-	fsRoot           fs.FS
+	rules                 []wafRule
+	auditLog              *auditLogConfig
+	contentInjection      bool
+	requestBody           *requestBodyConfig
+	responseBody          *responseBodyConfig
+	debugLogger           loggers.DebugLogger
+	errorCallback         func(rule types.MatchedRule)
+	errorEvents           *errorCallbackConfig
+	fsRoot                fs.FS
+	crsPlugins            []fs.FS
+	candidate             string
+	candidateDiffCb       func(diff types.RuleSetDiff)
+	rateLimitStore        ratelimit.Store
+	accessList            *accesslist.List
+	openAPI               *openapi.Spec
+	openAPIAction         openapi.Action
+	profile               *profiler.Profile
+	profileMode           profiler.Mode
+	blockSeverity         types.RuleSeverity
+	blockSeverityStatus   int
+	txPool                *txPoolConfig
+	txArena               bool
+	parallelRuleWorkers   int
+	lenient               bool
+	unknownDirective      func(directive string, args string) error
+	idGenerator           func() string
+	bodyProcessors        []bodyProcessorRoute
+	bodyProcessorSniffing bool
+	methodBodyProcessors  []bodyProcessorRoute
+	// limits set by the options, 0 if unset
+	requestBodyLimit         int64
+	requestBodyInMemoryLimit int64
+	responseBodyLimit        int64
+}
+
+type txPoolConfig struct {
+	enabled       bool
+	maxBufferSize int
+}
+
+type bodyProcessorRoute struct {
+	mediaType string
+	processor string
 }
 
 func (c *wafConfig) WithRules(rules ...*corazawaf.Rule) WAFConfig {
@@ -176,12 +336,118 @@ func (c *wafConfig) WithErrorCallback(logger func(rule types.MatchedRule)) WAFCo
 	return ret
 }
 
+func (c *wafConfig) WithErrorEventCallback(config ErrorCallbackConfig) WAFConfig {
+	ret := c.clone()
+	ret.errorEvents = config.(*errorCallbackConfig)
+	return ret
+}
+
 func (c *wafConfig) WithRootFS(fs fs.FS) WAFConfig {
 	ret := c.clone()
 	ret.fsRoot = fs
 	return ret
 }
 
+func (c *wafConfig) WithCRSPlugin(plugin fs.FS) WAFConfig {
+	ret := c.clone()
+	ret.crsPlugins = append(append([]fs.FS(nil), c.crsPlugins...), plugin)
+	return ret
+}
+
+func (c *wafConfig) WithCandidateDirectives(directives string, cb func(diff types.RuleSetDiff)) WAFConfig {
+	ret := c.clone()
+	ret.candidate = directives
+	ret.candidateDiffCb = cb
+	return ret
+}
+
+func (c *wafConfig) WithRateLimitStore(store ratelimit.Store) WAFConfig {
+	ret := c.clone()
+	ret.rateLimitStore = store
+	return ret
+}
+
+func (c *wafConfig) WithAccessList(list *accesslist.List) WAFConfig {
+	ret := c.clone()
+	ret.accessList = list
+	return ret
+}
+
+func (c *wafConfig) WithOpenAPI(spec *openapi.Spec, action openapi.Action) WAFConfig {
+	ret := c.clone()
+	ret.openAPI = spec
+	ret.openAPIAction = action
+	return ret
+}
+
+func (c *wafConfig) WithProfile(profile *profiler.Profile, mode profiler.Mode) WAFConfig {
+	ret := c.clone()
+	ret.profile = profile
+	ret.profileMode = mode
+	return ret
+}
+
+func (c *wafConfig) WithSeverityBlock(severity types.RuleSeverity, status int) WAFConfig {
+	ret := c.clone()
+	ret.blockSeverity = severity
+	ret.blockSeverityStatus = status
+	return ret
+}
+
+func (c *wafConfig) WithTransactionPool(enabled bool, maxBufferSize int) WAFConfig {
+	ret := c.clone()
+	ret.txPool = &txPoolConfig{enabled: enabled, maxBufferSize: maxBufferSize}
+	return ret
+}
+
+func (c *wafConfig) WithTransactionArena() WAFConfig {
+	ret := c.clone()
+	ret.txArena = true
+	return ret
+}
+
+func (c *wafConfig) WithParallelRules(workers int) WAFConfig {
+	ret := c.clone()
+	ret.parallelRuleWorkers = workers
+	return ret
+}
+
+func (c *wafConfig) WithLenientParsing() WAFConfig {
+	ret := c.clone()
+	ret.lenient = true
+	return ret
+}
+
+func (c *wafConfig) WithUnknownDirectiveHandler(h func(directive string, args string) error) WAFConfig {
+	ret := c.clone()
+	ret.unknownDirective = h
+	return ret
+}
+
+func (c *wafConfig) WithIDGenerator(gen func() string) WAFConfig {
+	ret := c.clone()
+	ret.idGenerator = gen
+	return ret
+}
+
+func (c *wafConfig) WithBodyProcessor(mediaType string, processor string) WAFConfig {
+	ret := c.clone()
+	ret.bodyProcessors = append(append([]bodyProcessorRoute(nil), c.bodyProcessors...), bodyProcessorRoute{mediaType, processor})
+	return ret
+}
+
+func (c *wafConfig) WithMethodBodyProcessor(method string, processor string) WAFConfig {
+	ret := c.clone()
+	ret.methodBodyProcessors = append(append([]bodyProcessorRoute(nil), c.methodBodyProcessors...), bodyProcessorRoute{method, processor})
+	return ret
+}
+
+func (c *wafConfig) WithBodyProcessorSniffing() WAFConfig {
+	ret := c.clone()
+	ret.bodyProcessorSniffing = true
+	return ret
+}
+
 func (c *wafConfig) clone() *wafConfig {
 	ret := *c // copy
 	rules := make([]wafRule, len(c.rules))
@@ -271,3 +537,35 @@ func (c *auditLogConfig) clone() *auditLogConfig {
 	ret := *c // copy
 	return &ret
 }
+
+type errorCallbackConfig struct {
+	cb         func(event types.ErrorEvent)
+	severities []types.RuleSeverity
+}
+
+func (c *errorCallbackConfig) WithCallback(cb func(event types.ErrorEvent)) ErrorCallbackConfig {
+	ret := c.clone()
+	ret.cb = cb
+	return ret
+}
+
+func (c *errorCallbackConfig) WithSeverities(severities ...types.RuleSeverity) ErrorCallbackConfig {
+	ret := c.clone()
+	ret.severities = append([]types.RuleSeverity(nil), severities...)
+	return ret
+}
+
+func (c *errorCallbackConfig) WithMinSeverity(severity types.RuleSeverity) ErrorCallbackConfig {
+	ret := c.clone()
+	ret.severities = nil
+	// lower values are more severe
+	for s := types.RuleSeverityEmergency; s <= severity; s++ {
+		ret.severities = append(ret.severities, s)
+	}
+	return ret
+}
+
+func (c *errorCallbackConfig) clone() *errorCallbackConfig {
+	ret := *c // copy
+	return &ret
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package contentencoding decompresses response bodies declared with a
+// Content-Encoding, so the outbound rules inspect the content instead of
+// the compressed bytes. gzip, deflate and br are supported, other codings
+// can be added with Register.
+package contentencoding
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Decoder returns a reader with the decompressed content of r
+type Decoder func(r io.Reader) (io.Reader, error)
+
+var (
+	mu       sync.RWMutex
+	decoders = map[string]Decoder{}
+)
+
+// Register registers a decoder for a content coding, names are case
+// insensitive. If the coding is already registered it is overwritten.
+func Register(name string, d Decoder) {
+	mu.Lock()
+	defer mu.Unlock()
+	decoders[normalize(name)] = d
+}
+
+// Get returns the decoder of a content coding, it returns false for
+// unknown codings and for identity as it doesn't need decoding.
+func Get(name string) (Decoder, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	d, ok := decoders[normalize(name)]
+	return d, ok
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func decodeGzip(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// decodeDeflate accepts zlib streams as specified by HTTP and the raw
+// deflate streams sent by some servers
+func decodeDeflate(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	// the zlib header is a multiple of 31 with the deflate method
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+func decodeBrotli(r io.Reader) (io.Reader, error) {
+	return brotli.NewReader(r), nil
+}
+
+func init() {
+	Register("gzip", decodeGzip)
+	Register("x-gzip", decodeGzip)
+	Register("deflate", decodeDeflate)
+	Register("br", decodeBrotli)
+}
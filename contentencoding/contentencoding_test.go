@@ -0,0 +1,79 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package contentencoding
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func compress(t *testing.T, newWriter func(io.Writer) io.WriteCloser, data string) string {
+	t.Helper()
+	buf := bytes.Buffer{}
+	w := newWriter(&buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestDecoders(t *testing.T) {
+	const data = "<html>secret</html>"
+	rawDeflate := func(w io.Writer) io.WriteCloser {
+		fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+		return fw
+	}
+	tests := []struct {
+		coding string
+		input  string
+	}{
+		{"gzip", compress(t, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }, data)},
+		{"X-Gzip", compress(t, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }, data)},
+		{"deflate", compress(t, func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }, data)},
+		{" deflate", compress(t, rawDeflate, data)},
+		{"br", compress(t, func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }, data)},
+	}
+	for _, tt := range tests {
+		decode, ok := Get(tt.coding)
+		if !ok {
+			t.Fatalf("coding %q not found", tt.coding)
+		}
+		r, err := decode(strings.NewReader(tt.input))
+		if err != nil {
+			t.Fatalf("%s: %s", tt.coding, err.Error())
+		}
+		out, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.coding, err.Error())
+		}
+		if string(out) != data {
+			t.Errorf("%s: expected %q, got %q", tt.coding, data, out)
+		}
+	}
+
+	decode, _ := Get("gzip")
+	if _, err := decode(strings.NewReader("not gzip")); err == nil {
+		t.Error("expected an error for invalid data")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	if _, ok := Get("identity"); ok {
+		t.Error("identity must not be decoded")
+	}
+	Register("Test", func(r io.Reader) (io.Reader, error) { return r, nil })
+	if _, ok := Get("test"); !ok {
+		t.Error("expected the registered coding")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !tinygo
+// +build !tinygo
+
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// IPFeed periodically downloads a list of IP addresses and CIDR networks
+// over HTTP and replaces the content of an IPSet with it
+type IPFeed struct {
+	// URL of the feed, one entry per line
+	URL string
+
+	// Set is the IPSet updated by the feed
+	Set *IPSet
+
+	// Interval between updates, defaults to one hour
+	Interval time.Duration
+
+	// Client is used to download the feed, defaults to a client
+	// with a 30 seconds timeout
+	Client *http.Client
+
+	// OnError is called when an update fails, the set keeps
+	// its previous content
+	OnError func(err error)
+}
+
+// Update downloads the feed and replaces the content of the set
+func (f *IPFeed) Update(ctx context.Context) error {
+	client := f.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.URL, nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d fetching %s", res.StatusCode, f.URL)
+	}
+	return f.Set.ReplaceFrom(res.Body)
+}
+
+// Run updates the set immediately and then every Interval until
+// the context is done
+func (f *IPFeed) Run(ctx context.Context) {
+	interval := f.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := f.Update(ctx); err != nil && f.OnError != nil && ctx.Err() == nil {
+			f.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !tinygo
+// +build !tinygo
+
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIPFeed(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		fmt.Fprintf(w, "# feed\n10.0.0.%d\n", n)
+	}))
+	defer ts.Close()
+
+	s := NewIPSet()
+	f := &IPFeed{URL: ts.URL, Set: s, Interval: 10 * time.Millisecond}
+	if err := f.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Contains(net.ParseIP("10.0.0.1")) {
+		t.Fatal("expected feed entries in the set")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		f.Run(ctx)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&requests) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if s.Contains(net.ParseIP("10.0.0.1")) {
+		t.Error("expected set to be replaced by the periodic updates")
+	}
+
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	before := s.Len()
+	if err := (&IPFeed{URL: notFound.URL, Set: s}).Update(context.Background()); err == nil {
+		t.Error("expected error for unexpected status code")
+	}
+	if s.Len() != before {
+		t.Error("failed update must not modify the set")
+	}
+}
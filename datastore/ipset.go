@@ -0,0 +1,153 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package datastore contains data sets that can be updated at runtime
+// and used by operators like @ipMatchFromDatastore, so threat intelligence
+// feeds apply without reloading the rules.
+package datastore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/corazawaf/coraza/v3/internal/iptrie"
+)
+
+// IPSet is a concurrent safe set of IP addresses and CIDR networks
+type IPSet struct {
+	mu   sync.RWMutex
+	trie *iptrie.Trie
+}
+
+// NewIPSet creates an empty IPSet
+func NewIPSet() *IPSet {
+	return &IPSet{
+		trie: iptrie.New(),
+	}
+}
+
+// parseIPEntry parses an IP address or a CIDR network, single
+// addresses are returned as a network with a full mask
+func parseIPEntry(entry string) (*net.IPNet, error) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		_, n, err := net.ParseCIDR(entry)
+		return n, err
+	}
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", entry)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// Add adds an IP address or a CIDR network to the set
+func (s *IPSet) Add(entry string) error {
+	n, err := parseIPEntry(entry)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trie.Insert(n)
+	return nil
+}
+
+// Remove removes an IP address or a CIDR network from the set,
+// addresses are not removed from the networks containing them
+func (s *IPSet) Remove(entry string) error {
+	n, err := parseIPEntry(entry)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trie.Remove(n)
+	return nil
+}
+
+// Replace atomically replaces the content of the set, it fails
+// without modifying the set if any of the entries is invalid
+func (s *IPSet) Replace(entries []string) error {
+	trie := iptrie.New()
+	for _, e := range entries {
+		n, err := parseIPEntry(e)
+		if err != nil {
+			return err
+		}
+		trie.Insert(n)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trie = trie
+	return nil
+}
+
+// ReplaceFrom replaces the content of the set with the entries read from r,
+// one IP address or CIDR network per line. Empty lines and comments starting
+// with # or ; are ignored, as well as anything after the first whitespace
+// so feeds with extra columns can be used.
+func (s *IPSet) ReplaceFrom(r io.Reader) error {
+	var entries []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" || l[0] == '#' || l[0] == ';' {
+			continue
+		}
+		if i := strings.IndexAny(l, " \t;#"); i != -1 {
+			l = l[:i]
+		}
+		entries = append(entries, l)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return s.Replace(entries)
+}
+
+// Contains returns true if the IP address is in the set or
+// in any of its networks
+func (s *IPSet) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.trie.Contains(ip)
+}
+
+// Len returns the number of addresses and networks in the set
+func (s *IPSet) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.trie.Len()
+}
+
+var (
+	ipSetsMu sync.RWMutex
+	ipSets   = map[string]*IPSet{}
+)
+
+// RegisterIPSet makes the set available to operators by name,
+// if a set already exists with the same name it will be overwritten
+func RegisterIPSet(name string, set *IPSet) {
+	ipSetsMu.Lock()
+	defer ipSetsMu.Unlock()
+	ipSets[name] = set
+}
+
+// GetIPSet returns the set registered with the name
+func GetIPSet(name string) (*IPSet, bool) {
+	ipSetsMu.RLock()
+	defer ipSetsMu.RUnlock()
+	s, ok := ipSets[name]
+	return s, ok
+}
@@ -0,0 +1,72 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package datastore
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestIPSet(t *testing.T) {
+	s := NewIPSet()
+	for _, e := range []string{"192.168.0.1", "10.0.0.0/8", "2001:db8::/32", "::1"} {
+		if err := s.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Add("invalid"); err == nil {
+		t.Error("expected error for invalid entry")
+	}
+	tests := map[string]bool{
+		"192.168.0.1": true,
+		"192.168.0.2": false,
+		"10.20.30.40": true,
+		"2001:db8::1": true,
+		"::1":         true,
+		"2001:db9::1": false,
+	}
+	for ip, expected := range tests {
+		if s.Contains(net.ParseIP(ip)) != expected {
+			t.Errorf("unexpected result for %s", ip)
+		}
+	}
+	if s.Contains(nil) {
+		t.Error("nil IP must not match")
+	}
+
+	if err := s.Remove("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	if s.Contains(net.ParseIP("10.20.30.40")) {
+		t.Error("expected network to be removed")
+	}
+	if s.Len() != 3 {
+		t.Errorf("expected 3 entries, got %d", s.Len())
+	}
+
+	if err := s.Replace([]string{"1.1.1.1", "bad"}); err == nil {
+		t.Error("expected error for invalid entry")
+	}
+	if s.Len() != 3 {
+		t.Error("failed replace must not modify the set")
+	}
+	if err := s.ReplaceFrom(strings.NewReader("# comment\n; comment\n\n1.1.1.1\n5.6.0.0/16 ; SBL123\n")); err != nil {
+		t.Fatal(err)
+	}
+	if s.Len() != 2 || !s.Contains(net.ParseIP("5.6.7.8")) || s.Contains(net.ParseIP("192.168.0.1")) {
+		t.Error("unexpected set content after replace")
+	}
+}
+
+func TestRegisterIPSet(t *testing.T) {
+	s := NewIPSet()
+	RegisterIPSet("test", s)
+	if got, ok := GetIPSet("test"); !ok || got != s {
+		t.Error("failed to get registered set")
+	}
+	if _, ok := GetIPSet("unknown"); ok {
+		t.Error("unexpected set")
+	}
+}
@@ -0,0 +1,11 @@
+module github.com/corazawaf/coraza/v3/echo
+
+go 1.18
+
+require (
+	github.com/corazawaf/coraza/v3 v3.0.0-20220914101451-05d352c89b24
+	github.com/labstack/echo/v4 v4.9.1
+)
+
+// the middleware uses APIs that are not released yet
+replace github.com/corazawaf/coraza/v3 => ../
@@ -0,0 +1,245 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package echo provides an echo middleware inspecting requests and
+// responses with a WAF. Interruptions are returned as *echo.HTTPError, so
+// they are rendered by the HTTPErrorHandler of the server, unless the rule
+// defines its own response body.
+//
+// Routes needing additional rules can be inspected by a WAF created from
+// the same configuration:
+//
+//	cfg := coraza.NewWAFConfig().WithDirectivesFromFile("coraza.conf")
+//	waf, _ := coraza.NewWAF(cfg)
+//	loginWAF, _ := coraza.NewWAF(cfg.WithDirectives(`SecRule ARGS_POST:user "@rx [^a-z]" "id:100,phase:2,deny"`))
+//	e.Use(corazaecho.Middleware(waf, corazaecho.Options{
+//		Routes: map[string]coraza.WAF{"/login": loginWAF},
+//		Skip: func(c echo.Context) bool { return c.Path() == "/healthz" },
+//	}))
+package echo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/corazawaf/coraza/v3"
+	txhttp "github.com/corazawaf/coraza/v3/http"
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/labstack/echo/v4"
+)
+
+type Logger func(msg string, args ...interface{})
+
+// Options configures the middleware
+type Options struct {
+	// Skip returns true for requests served without inspection
+	Skip func(c echo.Context) bool
+
+	// Routes maps route patterns, as returned by Context.Path, to the WAF
+	// inspecting them instead of the default one. The middleware must be
+	// registered with Use, routes are not resolved yet with Pre.
+	Routes map[string]coraza.WAF
+
+	// Logger receives the errors of the middleware, they are discarded
+	// if it is nil
+	Logger Logger
+}
+
+// Middleware inspects the requests with the WAF before calling the next
+// handler, and the responses before they are sent
+func Middleware(waf coraza.WAF, opts Options) echo.MiddlewareFunc {
+	l := opts.Logger
+	if l == nil {
+		l = func(string, ...interface{}) {}
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if opts.Skip != nil && opts.Skip(c) {
+				return next(c)
+			}
+			w := waf
+			if rw, ok := opts.Routes[c.Path()]; ok {
+				w = rw
+			}
+			tx := w.NewTransaction()
+			defer func() {
+				// We run phase 5 rules and create audit logs (if enabled)
+				tx.ProcessLogging()
+				// we remove temporary files and free some memory
+				if err := tx.Close(); err != nil {
+					l("failed to close the transaction: %v", err)
+				}
+			}()
+
+			if tx.IsRuleEngineOff() {
+				return next(c)
+			}
+
+			req := c.Request()
+			if it, err := txhttp.ProcessRequest(tx, req); err != nil {
+				l("failed to process request: %v", err)
+				return err
+			} else if it != nil {
+				return interrupt(c, tx, it)
+			}
+
+			res := c.Response()
+			rw := &responseWriter{ResponseWriter: res.Writer, tx: tx, ctx: req.Context(), proto: req.Proto}
+			res.Writer = rw
+			err := next(c)
+			if err != nil && !res.Committed {
+				// the error response is built by the error handler, the
+				// response phases must see it
+				c.Error(err)
+				err = nil
+			}
+			res.Writer = rw.ResponseWriter
+			if it, ferr := rw.finish(); ferr != nil {
+				l("failed to process response: %v", ferr)
+			} else if it != nil {
+				// the handler response was discarded
+				res.Committed = false
+				res.Size = 0
+				return interrupt(c, tx, it)
+			}
+			return err
+		}
+	}
+}
+
+// interrupt returns the error rendering the interruption, responses with
+// a body or a redirection are written directly
+func interrupt(c echo.Context, tx types.Transaction, it *types.Interruption) error {
+	txhttp.PauseTransaction(c.Request().Context(), tx)
+	if it.IsDrop() {
+		if h, ok := c.Response().Writer.(http.Hijacker); ok {
+			if conn, _, err := h.Hijack(); err == nil {
+				_ = conn.Close()
+				return nil
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+	h := c.Response().Header()
+	txhttp.ApplyResponseHeaderMutations(h, tx.ResponseHeaderMutations())
+	// the handler may have set the length of its own body
+	h.Del(echo.HeaderContentLength)
+	status := it.Status
+	switch {
+	case it.Action == types.InterruptionActionRedirect:
+		if status == 0 {
+			status = http.StatusFound
+		}
+		h.Set(echo.HeaderLocation, it.Data)
+		return c.NoContent(status)
+	case status == 0:
+		status = http.StatusServiceUnavailable
+	}
+	if it.Body != "" {
+		return c.Blob(status, it.ContentType, []byte(it.Body))
+	}
+	return echo.NewHTTPError(status).SetInternal(fmt.Errorf("request interrupted by rule %d", it.RuleID))
+}
+
+// responseWriter runs the response headers phase right before the headers
+// are sent, the body is buffered only if the rules inspect it
+type responseWriter struct {
+	http.ResponseWriter
+	tx    types.Transaction
+	ctx   context.Context
+	proto string
+
+	status          int
+	headerProcessed bool
+	buffering       bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if !w.headerProcessed {
+		w.status = code
+		w.processHeaders()
+	}
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.processHeaders()
+	switch {
+	case w.tx.IsInterrupted():
+		// the response is replaced once the handler returns
+		return len(b), nil
+	case w.buffering:
+		return w.tx.ResponseBodyWriter().Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush is ignored while the body is buffered
+func (w *responseWriter) Flush() {
+	w.processHeaders()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && !w.buffering && !w.tx.IsInterrupted() {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) processHeaders() {
+	if w.headerProcessed {
+		return
+	}
+	w.headerProcessed = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	for k, vv := range w.Header() {
+		for _, v := range vv {
+			w.tx.AddResponseHeader(k, v)
+		}
+	}
+	if it := w.tx.ProcessResponseHeaders(w.status, w.proto); it != nil {
+		return
+	}
+	if w.tx.IsResponseBodyAccessible() && w.tx.IsResponseBodyProcessable() {
+		w.buffering = true
+		return
+	}
+	w.writeHeader()
+}
+
+func (w *responseWriter) writeHeader() {
+	txhttp.PauseTransaction(w.ctx, w.tx)
+	txhttp.ApplyResponseHeaderMutations(w.Header(), w.tx.ResponseHeaderMutations())
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// finish evaluates the response body and sends the buffered response,
+// it returns the interruption replacing the response if any
+func (w *responseWriter) finish() (*types.Interruption, error) {
+	if !w.headerProcessed {
+		// nothing was written, the response is sent by echo
+		return nil, nil
+	}
+	if it := w.tx.Interruption(); it != nil {
+		return it, nil
+	}
+	if !w.buffering {
+		return nil, nil
+	}
+	it, err := w.tx.ProcessResponseBody()
+	if err != nil {
+		w.ResponseWriter.WriteHeader(http.StatusInternalServerError)
+		return nil, err
+	}
+	if it != nil {
+		return it, nil
+	}
+	w.writeHeader()
+	reader, err := w.tx.ResponseBodyReader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to release the response body reader: %v", err)
+	}
+	if _, err := io.Copy(w.ResponseWriter, reader); err != nil {
+		return nil, fmt.Errorf("failed to copy the response body: %v", err)
+	}
+	return nil, nil
+}
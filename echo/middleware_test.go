@@ -0,0 +1,105 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package echo
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3"
+	"github.com/labstack/echo/v4"
+)
+
+func newWAF(t *testing.T, directives string) coraza.WAF {
+	t.Helper()
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(`
+		SecRuleEngine On
+		SecRequestBodyAccess On
+		SecResponseBodyAccess On
+		SecResponseBodyMimeType text/plain
+	` + directives))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return waf
+}
+
+func newServer(t *testing.T, waf coraza.WAF, opts Options) *echo.Echo {
+	t.Helper()
+	e := echo.New()
+	e.Use(Middleware(waf, opts))
+	hello := func(c echo.Context) error {
+		body, _ := io.ReadAll(c.Request().Body)
+		return c.String(http.StatusOK, "hello "+string(body))
+	}
+	e.POST("/", hello)
+	e.POST("/login", hello)
+	e.GET("/healthz", func(c echo.Context) error { return c.String(http.StatusOK, "secret") })
+	e.GET("/error", func(c echo.Context) error { return echo.NewHTTPError(http.StatusTeapot, "secret") })
+	return e
+}
+
+func serve(e *echo.Echo, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddlewareRequest(t *testing.T) {
+	e := newServer(t, newWAF(t, `SecRule ARGS:id "@eq 0" "id:1,phase:1,deny,status:403"
+		SecRule ARGS_POST:name "@streq admin" "id:2,phase:2,deny,status:401"`), Options{})
+
+	if w := serve(e, "POST", "/?id=0", ""); w.Code != 403 {
+		t.Errorf("expected 403, got %d", w.Code)
+	}
+	if w := serve(e, "POST", "/", "name=admin"); w.Code != 401 {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+	if w := serve(e, "POST", "/", "name=guest"); w.Code != 200 || w.Body.String() != "hello name=guest" {
+		t.Errorf("expected the handler response, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestMiddlewareResponse(t *testing.T) {
+	e := newServer(t, newWAF(t, `SecRule REQUEST_URI "@beginsWith /" "id:1,phase:1,pass,header:'set:X-Frame-Options=DENY'"
+		SecRule RESPONSE_BODY "@contains secret" "id:2,phase:4,deny,status:403"
+		SecRule RESPONSE_STATUS "@eq 418" "id:3,phase:3,deny,status:403"`), Options{})
+
+	w := serve(e, "POST", "/", "world")
+	if w.Code != 200 || w.Header().Get("X-Frame-Options") != "DENY" || w.Body.String() != "hello world" {
+		t.Errorf("unexpected response %d %v %q", w.Code, w.Header(), w.Body.String())
+	}
+	w = serve(e, "GET", "/healthz", "")
+	if w.Code != 403 || strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("expected the response to be denied, got %d %q", w.Code, w.Body.String())
+	}
+	// responses built by the error handler are inspected too
+	if w := serve(e, "GET", "/error", ""); w.Code != 403 {
+		t.Errorf("expected the error response to be denied, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestMiddlewareRoutes(t *testing.T) {
+	waf := newWAF(t, "")
+	loginWAF := newWAF(t, `SecRule ARGS_POST:user "@rx [^a-z]" "id:100,phase:2,deny,status:400"`)
+	e := newServer(t, newWAF(t, `SecRule RESPONSE_BODY "@contains secret" "id:1,phase:4,deny"`), Options{
+		Routes: map[string]coraza.WAF{"/login": loginWAF, "/": waf},
+		Skip:   func(c echo.Context) bool { return c.Path() == "/healthz" },
+	})
+
+	if w := serve(e, "POST", "/login", "user=<script>"); w.Code != 400 {
+		t.Errorf("expected the route rules to deny the request, got %d", w.Code)
+	}
+	if w := serve(e, "POST", "/", "user=<script>"); w.Code != 200 {
+		t.Errorf("expected the default rules to allow the request, got %d", w.Code)
+	}
+	if w := serve(e, "GET", "/healthz", ""); w.Code != 200 || w.Body.String() != "secret" {
+		t.Errorf("expected the route to be skipped, got %d", w.Code)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package extproc
+
+import (
+	"strconv"
+
+	"github.com/corazawaf/coraza/v3/envoy"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	filterv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fromProto converts a ProcessingRequest to the message of the stream
+func fromProto(req *extprocv3.ProcessingRequest) *envoy.Request {
+	r := &envoy.Request{}
+	switch m := req.Request.(type) {
+	case *extprocv3.ProcessingRequest_RequestHeaders:
+		r.RequestHeaders = fromHeaders(m.RequestHeaders.GetHeaders(), m.RequestHeaders.GetEndOfStream())
+		r.Attributes = fromAttributes(m.RequestHeaders.GetAttributes())
+	case *extprocv3.ProcessingRequest_RequestBody:
+		r.RequestBody = fromBody(m.RequestBody)
+	case *extprocv3.ProcessingRequest_RequestTrailers:
+		r.RequestTrailers = fromHeaders(m.RequestTrailers.GetTrailers(), true)
+	case *extprocv3.ProcessingRequest_ResponseHeaders:
+		r.ResponseHeaders = fromHeaders(m.ResponseHeaders.GetHeaders(), m.ResponseHeaders.GetEndOfStream())
+	case *extprocv3.ProcessingRequest_ResponseBody:
+		r.ResponseBody = fromBody(m.ResponseBody)
+	case *extprocv3.ProcessingRequest_ResponseTrailers:
+		r.ResponseTrailers = fromHeaders(m.ResponseTrailers.GetTrailers(), true)
+	}
+	return r
+}
+
+func fromHeaders(hm *corev3.HeaderMap, endOfStream bool) *envoy.Headers {
+	h := &envoy.Headers{EndOfStream: endOfStream}
+	for _, hv := range hm.GetHeaders() {
+		h.Headers = append(h.Headers, envoy.HeaderValue{Key: hv.GetKey(), Value: hv.GetValue()})
+	}
+	return h
+}
+
+func fromBody(b *extprocv3.HttpBody) *envoy.Body {
+	return &envoy.Body{Body: b.GetBody(), EndOfStream: b.GetEndOfStream()}
+}
+
+// fromAttributes flattens the request attributes, Envoy groups them in a
+// struct per filter namespace keyed by the attribute name
+func fromAttributes(attrs map[string]*structpb.Struct) map[string]string {
+	res := map[string]string{}
+	for _, st := range attrs {
+		for k, v := range st.GetFields() {
+			switch kind := v.GetKind().(type) {
+			case *structpb.Value_StringValue:
+				res[k] = kind.StringValue
+			case *structpb.Value_NumberValue:
+				res[k] = strconv.FormatInt(int64(kind.NumberValue), 10)
+			}
+		}
+	}
+	return res
+}
+
+// toProto converts the response of the stream to the ProcessingResponse
+// answering req, which must use the same message type
+func (s *Server) toProto(req *extprocv3.ProcessingRequest, res *envoy.Response) *extprocv3.ProcessingResponse {
+	if ir := res.ImmediateResponse; ir != nil {
+		return &extprocv3.ProcessingResponse{
+			Response: &extprocv3.ProcessingResponse_ImmediateResponse{
+				ImmediateResponse: &extprocv3.ImmediateResponse{
+					Status:  &typev3.HttpStatus{Code: typev3.StatusCode(ir.Status)},
+					Headers: toHeaderMutation(ir.Headers),
+					Body:    ir.Body,
+					Details: ir.Details,
+				},
+			},
+		}
+	}
+
+	pr := &extprocv3.ProcessingResponse{ModeOverride: s.modeOverride(res.ModeOverride)}
+	common := &extprocv3.CommonResponse{HeaderMutation: toHeaderMutation(res.HeaderMutation)}
+	switch req.Request.(type) {
+	case *extprocv3.ProcessingRequest_RequestHeaders:
+		pr.Response = &extprocv3.ProcessingResponse_RequestHeaders{RequestHeaders: &extprocv3.HeadersResponse{Response: common}}
+	case *extprocv3.ProcessingRequest_RequestBody:
+		pr.Response = &extprocv3.ProcessingResponse_RequestBody{RequestBody: &extprocv3.BodyResponse{Response: common}}
+	case *extprocv3.ProcessingRequest_RequestTrailers:
+		pr.Response = &extprocv3.ProcessingResponse_RequestTrailers{RequestTrailers: &extprocv3.TrailersResponse{}}
+	case *extprocv3.ProcessingRequest_ResponseHeaders:
+		pr.Response = &extprocv3.ProcessingResponse_ResponseHeaders{ResponseHeaders: &extprocv3.HeadersResponse{Response: common}}
+	case *extprocv3.ProcessingRequest_ResponseBody:
+		pr.Response = &extprocv3.ProcessingResponse_ResponseBody{ResponseBody: &extprocv3.BodyResponse{Response: common}}
+	case *extprocv3.ProcessingRequest_ResponseTrailers:
+		// the mutations of a trailers response apply to the trailers, the
+		// response headers were already sent
+		pr.Response = &extprocv3.ProcessingResponse_ResponseTrailers{ResponseTrailers: &extprocv3.TrailersResponse{}}
+	}
+	return pr
+}
+
+func toHeaderMutation(hm *envoy.HeaderMutation) *extprocv3.HeaderMutation {
+	if hm == nil {
+		return nil
+	}
+	res := &extprocv3.HeaderMutation{RemoveHeaders: hm.RemoveHeaders}
+	for _, o := range hm.SetHeaders {
+		res.SetHeaders = append(res.SetHeaders, &corev3.HeaderValueOption{
+			Header: &corev3.HeaderValue{Key: o.Header.Key, Value: o.Header.Value},
+			// Envoy appends by default
+			Append: wrapperspb.Bool(o.Append),
+		})
+	}
+	return res
+}
+
+// modeOverride applies the body modes of the stream to the processing
+// mode of the filter, it returns nil if the mode of the filter is unknown
+func (s *Server) modeOverride(pm *envoy.ProcessingMode) *filterv3.ProcessingMode {
+	if pm == nil || s.opts.ProcessingMode == nil {
+		return nil
+	}
+	mode := proto.Clone(s.opts.ProcessingMode).(*filterv3.ProcessingMode)
+	if m, ok := toBodyMode(pm.RequestBodyMode); ok {
+		mode.RequestBodyMode = m
+	}
+	if m, ok := toBodyMode(pm.ResponseBodyMode); ok {
+		mode.ResponseBodyMode = m
+	}
+	return mode
+}
+
+func toBodyMode(m envoy.BodyMode) (filterv3.ProcessingMode_BodySendMode, bool) {
+	switch m {
+	case envoy.BodyModeNone:
+		return filterv3.ProcessingMode_NONE, true
+	case envoy.BodyModeStreamed:
+		return filterv3.ProcessingMode_STREAMED, true
+	case envoy.BodyModeBuffered:
+		return filterv3.ProcessingMode_BUFFERED, true
+	case envoy.BodyModeBufferedPartial:
+		return filterv3.ProcessingMode_BUFFERED_PARTIAL, true
+	}
+	return 0, false
+}
@@ -0,0 +1,30 @@
+module github.com/corazawaf/coraza/v3/envoy/extproc
+
+go 1.18
+
+require (
+	github.com/corazawaf/coraza/v3 v3.0.0-20220914101451-05d352c89b24
+	github.com/envoyproxy/go-control-plane v0.10.3
+	google.golang.org/grpc v1.50.1
+	google.golang.org/protobuf v1.28.1
+)
+
+require (
+	github.com/andybalholm/brotli v1.0.4 // indirect
+	github.com/cncf/xds/go v0.0.0-20220314180256-7f1daf1720fc // indirect
+	github.com/corazawaf/libinjection-go v0.1.2 // indirect
+	github.com/envoyproxy/protoc-gen-validate v0.6.7 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/magefile/mage v1.14.0 // indirect
+	github.com/petar-dambovaliev/aho-corasick v0.0.0-20211021192214-5ab2d9280aa9 // indirect
+	github.com/tidwall/gjson v1.14.3 // indirect
+	github.com/tidwall/match v1.1.1 // indirect
+	github.com/tidwall/pretty v1.2.1 // indirect
+	golang.org/x/net v0.1.0 // indirect
+	golang.org/x/sys v0.2.0 // indirect
+	golang.org/x/text v0.4.0 // indirect
+	google.golang.org/genproto v0.0.0-20220329172620-7be39ac1afc7 // indirect
+)
+
+// the service uses APIs that are not released yet
+replace github.com/corazawaf/coraza/v3 => ../../
@@ -0,0 +1,87 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package extproc implements the Envoy external processing service
+// (envoy.service.ext_proc.v3.ExternalProcessor) with a WAF. Every Process
+// stream corresponds to one HTTP request and is evaluated by an
+// envoy.Stream:
+//
+//	srv := grpc.NewServer()
+//	extprocv3.RegisterExternalProcessorServer(srv, extproc.NewServer(waf, extproc.Options{}))
+//
+// The request_attributes of the filter may include source.address,
+// source.port, destination.address, destination.port and request.protocol
+// to populate the connection variables.
+package extproc
+
+import (
+	"errors"
+	"io"
+
+	"github.com/corazawaf/coraza/v3"
+	"github.com/corazawaf/coraza/v3/envoy"
+	filterv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Options configures the server
+type Options struct {
+	// ProcessingMode is the processing_mode configured in the filter. Envoy
+	// replaces the whole mode with the overrides, so the bodies that won't
+	// be inspected are only skipped if it is set, which also requires
+	// allow_mode_override in the filter.
+	ProcessingMode *filterv3.ProcessingMode
+}
+
+// Server is an ExternalProcessorServer evaluating the streams with a WAF
+type Server struct {
+	extprocv3.UnimplementedExternalProcessorServer
+
+	waf  coraza.WAF
+	opts Options
+}
+
+var _ extprocv3.ExternalProcessorServer = (*Server)(nil)
+
+// NewServer creates a server evaluating the streams with waf
+func NewServer(waf coraza.WAF, opts Options) *Server {
+	return &Server{waf: waf, opts: opts}
+}
+
+// Process evaluates the messages of a stream with a new transaction, the
+// transaction is closed when Envoy ends the stream
+func (s *Server) Process(srv extprocv3.ExternalProcessor_ProcessServer) (err error) {
+	stream := envoy.NewStream(s.waf)
+	defer func() {
+		if cerr := stream.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	for {
+		req, err := srv.Recv()
+		if errors.Is(err, io.EOF) || status.Code(err) == codes.Canceled {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		res, err := stream.Process(fromProto(req))
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if res.CloseStream {
+			// ext_proc can't reset the client connection, failing the
+			// stream makes Envoy end the request without forwarding it
+			return status.Error(codes.PermissionDenied, "connection dropped")
+		}
+		// requests in asynchronous mode don't expect a response
+		if req.AsyncMode {
+			continue
+		}
+		if err := srv.Send(s.toProto(req, res)); err != nil {
+			return err
+		}
+	}
+}
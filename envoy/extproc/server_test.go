@@ -0,0 +1,141 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package extproc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	filterv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func newClient(t *testing.T, directives string, opts Options) extprocv3.ExternalProcessorClient {
+	t.Helper()
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(`
+		SecRuleEngine On
+		SecRequestBodyAccess On
+	` + directives))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	extprocv3.RegisterExternalProcessorServer(srv, NewServer(waf, opts))
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return extprocv3.NewExternalProcessorClient(conn)
+}
+
+func requestHeaders(path string, endOfStream bool) *extprocv3.ProcessingRequest {
+	attrs, _ := structpb.NewStruct(map[string]interface{}{
+		"source.address":   "10.0.0.1",
+		"source.port":      51000,
+		"request.protocol": "HTTP/2",
+	})
+	return &extprocv3.ProcessingRequest{
+		Request: &extprocv3.ProcessingRequest_RequestHeaders{
+			RequestHeaders: &extprocv3.HttpHeaders{
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+					{Key: ":method", Value: "POST"},
+					{Key: ":path", Value: path},
+					{Key: ":authority", Value: "example.com"},
+					{Key: "content-type", Value: "application/x-www-form-urlencoded"},
+				}},
+				Attributes:  map[string]*structpb.Struct{"envoy.filters.http.ext_proc": attrs},
+				EndOfStream: endOfStream,
+			},
+		},
+	}
+}
+
+func send(t *testing.T, stream extprocv3.ExternalProcessor_ProcessClient, req *extprocv3.ProcessingRequest) *extprocv3.ProcessingResponse {
+	t.Helper()
+	if err := stream.Send(req); err != nil {
+		t.Fatal(err)
+	}
+	res, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestProcessRequest(t *testing.T) {
+	client := newClient(t, `SecRule REMOTE_ADDR "@ipMatch 10.0.0.0/8" "id:1,phase:1,chain,pass,header:'set:X-Checked=1'"
+			SecRule REQUEST_PROTOCOL "@streq HTTP/2.0" ""
+		SecRule ARGS_POST:pass "@streq secret" "id:2,phase:2,deny,status:401"`, Options{})
+	stream, err := client.Process(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := send(t, stream, requestHeaders("/login", false))
+	if res.GetRequestHeaders() == nil {
+		t.Fatalf("expected a request headers response, got %v", res)
+	}
+	res = send(t, stream, &extprocv3.ProcessingRequest{
+		Request: &extprocv3.ProcessingRequest_RequestBody{
+			RequestBody: &extprocv3.HttpBody{Body: []byte("user=admin&pass=secret"), EndOfStream: true},
+		},
+	})
+	ir := res.GetImmediateResponse()
+	if ir == nil || ir.GetStatus().GetCode() != 401 || ir.GetDetails() != "coraza_rule_2" {
+		t.Fatalf("expected an immediate response, got %v", res)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessResponse(t *testing.T) {
+	client := newClient(t, `SecRule RESPONSE_STATUS "@eq 200" "id:1,phase:3,pass,header:'set:X-Frame-Options=DENY'"`, Options{
+		ProcessingMode: &filterv3.ProcessingMode{
+			RequestBodyMode:  filterv3.ProcessingMode_BUFFERED,
+			ResponseBodyMode: filterv3.ProcessingMode_BUFFERED,
+		},
+	})
+	stream, err := client.Process(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := send(t, stream, requestHeaders("/", true)); res.GetRequestHeaders() == nil {
+		t.Fatalf("expected a request headers response, got %v", res)
+	}
+	res := send(t, stream, &extprocv3.ProcessingRequest{
+		Request: &extprocv3.ProcessingRequest_ResponseHeaders{
+			ResponseHeaders: &extprocv3.HttpHeaders{Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+				{Key: ":status", Value: "200"},
+				{Key: "content-type", Value: "image/png"},
+			}}},
+		},
+	})
+	hm := res.GetResponseHeaders().GetResponse().GetHeaderMutation()
+	if len(hm.GetSetHeaders()) != 1 || hm.GetSetHeaders()[0].GetHeader().GetKey() != "X-Frame-Options" || hm.GetSetHeaders()[0].GetAppend().GetValue() {
+		t.Errorf("expected the header to be set, got %v", hm)
+	}
+	// the response body is not inspected, the request body mode is kept
+	mode := res.GetModeOverride()
+	if mode.GetResponseBodyMode() != filterv3.ProcessingMode_NONE || mode.GetRequestBodyMode() != filterv3.ProcessingMode_BUFFERED {
+		t.Errorf("unexpected mode override %v", mode)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package envoy
+
+import "strings"
+
+// HeaderValue is a header of an ext_proc HeaderMap, pseudo headers like
+// :path or :status are included as Envoy sends them
+type HeaderValue struct {
+	Key   string
+	Value string
+}
+
+// Headers is an HttpHeaders message, it is used for headers and trailers
+type Headers struct {
+	Headers []HeaderValue
+
+	// EndOfStream is true if no body will follow
+	EndOfStream bool
+}
+
+// Get returns the first value of a header, keys are case insensitive
+// as Envoy sends them in lowercase
+func (h *Headers) Get(key string) string {
+	for _, hv := range h.Headers {
+		if strings.EqualFold(hv.Key, key) {
+			return hv.Value
+		}
+	}
+	return ""
+}
+
+// Body is an HttpBody message, in streamed mode it contains a chunk
+type Body struct {
+	Body []byte
+
+	// EndOfStream is true for the last chunk
+	EndOfStream bool
+}
+
+// Request is a ProcessingRequest, exactly one of the message fields is set
+type Request struct {
+	RequestHeaders   *Headers
+	RequestBody      *Body
+	RequestTrailers  *Headers
+	ResponseHeaders  *Headers
+	ResponseBody     *Body
+	ResponseTrailers *Headers
+
+	// Attributes are the ext_proc request attributes configured in the
+	// filter, source.address, source.port, destination.address,
+	// destination.port and request.protocol are used when present
+	Attributes map[string]string
+}
+
+// BodyMode mirrors ProcessingMode.BodySendMode
+type BodyMode int
+
+const (
+	// BodyModeDefault keeps the mode configured in the filter
+	BodyModeDefault BodyMode = iota
+	// BodyModeNone does not send the body to the processor
+	BodyModeNone
+	// BodyModeStreamed sends the body in chunks while it is forwarded,
+	// interruptions found in the body can't stop data already sent
+	BodyModeStreamed
+	// BodyModeBuffered buffers the whole body before sending it
+	BodyModeBuffered
+	// BodyModeBufferedPartial buffers the body up to the Envoy buffer limit
+	BodyModeBufferedPartial
+)
+
+// ProcessingMode overrides the body modes of the filter for the current
+// stream, fields left to BodyModeDefault keep the filter configuration
+type ProcessingMode struct {
+	RequestBodyMode  BodyMode
+	ResponseBodyMode BodyMode
+}
+
+// HeaderValueOption is a header to set or append
+type HeaderValueOption struct {
+	Header HeaderValue
+
+	// Append adds the value instead of overwriting the header
+	Append bool
+}
+
+// HeaderMutation mirrors the ext_proc HeaderMutation message
+type HeaderMutation struct {
+	SetHeaders    []HeaderValueOption
+	RemoveHeaders []string
+}
+
+// ImmediateResponse ends the stream with a local reply, it is
+// used for interruptions
+type ImmediateResponse struct {
+	Status  int
+	Headers *HeaderMutation
+	Body    string
+
+	// Details is set as the Envoy response code details
+	Details string
+}
+
+// Response is a ProcessingResponse, it answers the Request with the same
+// message type. If ImmediateResponse is set the other fields are ignored.
+type Response struct {
+	HeaderMutation    *HeaderMutation
+	ImmediateResponse *ImmediateResponse
+
+	// ModeOverride is set after the headers to skip bodies that won't be
+	// inspected, it requires allow_mode_override in the filter
+	ModeOverride *ProcessingMode
+
+	// CloseStream is true if the client connection must be reset
+	// without a response, the gRPC stream should end with an error
+	CloseStream bool
+}
@@ -0,0 +1,269 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package envoy maps the messages of the Envoy external processing filter
+// (ext_proc) onto the phases of a Coraza transaction. The message types
+// mirror the envoy.service.ext_proc.v3 protos without depending on them,
+// the gRPC ExternalProcessor service converting the protos is implemented
+// by the envoy/extproc module:
+//
+//	srv := grpc.NewServer()
+//	extprocv3.RegisterExternalProcessorServer(srv, extproc.NewServer(waf, extproc.Options{}))
+//
+// Request bodies must use a buffered body mode for rules in phase 2 to
+// block the request before it reaches the upstream.
+package envoy
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3"
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+// Stream processes the messages of a single ext_proc stream, which
+// corresponds to one HTTP request. Streams are not safe for concurrent use.
+type Stream struct {
+	tx    types.Transaction
+	proto string
+
+	requestBodyProcessed  bool
+	responseBodyProcessed bool
+	// mutationsSent is the number of response header mutations already
+	// returned, mutations scheduled later are returned with the body
+	mutationsSent int
+}
+
+// NewStream creates a stream with a new transaction of the WAF
+func NewStream(waf coraza.WAF) *Stream {
+	return &Stream{tx: waf.NewTransaction(), proto: "HTTP/1.1"}
+}
+
+// Transaction returns the transaction of the stream
+func (s *Stream) Transaction() types.Transaction {
+	return s.tx
+}
+
+// Process evaluates the phase matching the message and returns the
+// response Envoy expects for it
+func (s *Stream) Process(req *Request) (*Response, error) {
+	switch {
+	case req.RequestHeaders != nil:
+		return s.processRequestHeaders(req.RequestHeaders, req.Attributes)
+	case req.RequestBody != nil:
+		return s.processRequestBody(req.RequestBody)
+	case req.RequestTrailers != nil:
+		return s.finishRequestBody()
+	case req.ResponseHeaders != nil:
+		return s.processResponseHeaders(req.ResponseHeaders)
+	case req.ResponseBody != nil:
+		return s.processResponseBody(req.ResponseBody)
+	case req.ResponseTrailers != nil:
+		return s.finishResponseBody()
+	}
+	return nil, errors.New("empty processing request")
+}
+
+// Close runs the logging phase and closes the transaction, it must be
+// called when the ext_proc stream ends
+func (s *Stream) Close() error {
+	s.tx.ProcessLogging()
+	return s.tx.Close()
+}
+
+func (s *Stream) processRequestHeaders(h *Headers, attrs map[string]string) (*Response, error) {
+	tx := s.tx
+	cport, _ := strconv.Atoi(attrs["source.port"])
+	sport, _ := strconv.Atoi(attrs["destination.port"])
+	tx.ProcessConnection(attrs["source.address"], cport, attrs["destination.address"], sport)
+	if p := attrs["request.protocol"]; p != "" {
+		s.proto = p
+	}
+	tx.ProcessURI(h.Get(":path"), h.Get(":method"), s.proto)
+	// the pseudo headers are added to REQUEST_PSEUDO_HEADERS, :authority
+	// is also used as the Host header. Envoy sends the pseudo headers for
+	// HTTP/1 requests too, so they are only kept in the request line and
+	// the Host header to avoid reporting them as an anomaly
+	multiplexed := isMultiplexed(s.proto)
+	for _, hv := range h.Headers {
+		if !multiplexed && strings.HasPrefix(hv.Key, ":") {
+			if hv.Key == ":authority" && h.Get("host") == "" {
+				tx.AddRequestHeader("Host", hv.Value)
+			}
+			continue
+		}
+		tx.AddRequestHeader(hv.Key, hv.Value)
+	}
+	if it := tx.ProcessRequestHeaders(); it != nil {
+		return s.interrupt(it), nil
+	}
+	if h.EndOfStream {
+		return s.finishRequestBody()
+	}
+	res := &Response{}
+	if !tx.IsRequestBodyAccessible() {
+		res.ModeOverride = &ProcessingMode{RequestBodyMode: BodyModeNone}
+	}
+	return res, nil
+}
+
+// isMultiplexed returns whether Envoy reports an HTTP/2 or HTTP/3 request
+func isMultiplexed(proto string) bool {
+	p := strings.ToUpper(proto)
+	return strings.HasPrefix(p, "HTTP/2") || strings.HasPrefix(p, "HTTP/3")
+}
+
+func (s *Stream) processRequestBody(b *Body) (*Response, error) {
+	if s.requestBodyProcessed {
+		return &Response{}, nil
+	}
+	if s.tx.IsRequestBodyAccessible() && len(b.Body) > 0 {
+		it, _, err := s.tx.WriteRequestBody(b.Body)
+		if err != nil {
+			return nil, err
+		}
+		if it != nil {
+			return s.interrupt(it), nil
+		}
+	}
+	if b.EndOfStream {
+		return s.finishRequestBody()
+	}
+	return &Response{}, nil
+}
+
+// finishRequestBody evaluates the request body phase, it runs once even
+// for requests without body
+func (s *Stream) finishRequestBody() (*Response, error) {
+	if s.requestBodyProcessed {
+		return &Response{}, nil
+	}
+	s.requestBodyProcessed = true
+	it, err := s.tx.ProcessRequestBody()
+	if err != nil {
+		return nil, err
+	}
+	if it != nil {
+		return s.interrupt(it), nil
+	}
+	return &Response{}, nil
+}
+
+func (s *Stream) processResponseHeaders(h *Headers) (*Response, error) {
+	tx := s.tx
+	// requests without body or trailers don't notify their end
+	if res, err := s.finishRequestBody(); err != nil || res.ImmediateResponse != nil || res.CloseStream {
+		return res, err
+	}
+	status, err := strconv.Atoi(h.Get(":status"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid response status %q", h.Get(":status"))
+	}
+	for _, hv := range h.Headers {
+		if strings.HasPrefix(hv.Key, ":") {
+			continue
+		}
+		tx.AddResponseHeader(hv.Key, hv.Value)
+	}
+	if it := tx.ProcessResponseHeaders(status, s.proto); it != nil {
+		return s.interrupt(it), nil
+	}
+	if h.EndOfStream {
+		return s.finishResponseBody()
+	}
+	res := &Response{HeaderMutation: s.pendingMutations()}
+	if !tx.IsResponseBodyAccessible() || !tx.IsResponseBodyProcessable() {
+		res.ModeOverride = &ProcessingMode{ResponseBodyMode: BodyModeNone}
+	}
+	return res, nil
+}
+
+func (s *Stream) processResponseBody(b *Body) (*Response, error) {
+	if s.responseBodyProcessed {
+		return &Response{}, nil
+	}
+	if s.tx.IsResponseBodyAccessible() && s.tx.IsResponseBodyProcessable() && len(b.Body) > 0 {
+		if _, err := s.tx.ResponseBodyWriter().Write(b.Body); err != nil {
+			return nil, err
+		}
+	}
+	if b.EndOfStream {
+		return s.finishResponseBody()
+	}
+	return &Response{}, nil
+}
+
+// finishResponseBody evaluates the response body phase, header mutations
+// scheduled by it can only be applied in buffered mode
+func (s *Stream) finishResponseBody() (*Response, error) {
+	if s.responseBodyProcessed {
+		return &Response{}, nil
+	}
+	s.responseBodyProcessed = true
+	it, err := s.tx.ProcessResponseBody()
+	if err != nil {
+		return nil, err
+	}
+	if it != nil {
+		return s.interrupt(it), nil
+	}
+	return &Response{HeaderMutation: s.pendingMutations()}, nil
+}
+
+// pendingMutations converts the response header mutations scheduled
+// since the last response, it returns nil if there are none
+func (s *Stream) pendingMutations() *HeaderMutation {
+	mutations := s.tx.ResponseHeaderMutations()
+	if len(mutations) <= s.mutationsSent {
+		return nil
+	}
+	hm := &HeaderMutation{}
+	for _, m := range mutations[s.mutationsSent:] {
+		switch m.Action {
+		case types.HeaderMutationSet:
+			hm.SetHeaders = append(hm.SetHeaders, HeaderValueOption{Header: HeaderValue{Key: m.Name, Value: m.Value}})
+		case types.HeaderMutationAdd:
+			hm.SetHeaders = append(hm.SetHeaders, HeaderValueOption{Header: HeaderValue{Key: m.Name, Value: m.Value}, Append: true})
+		case types.HeaderMutationRemove:
+			hm.RemoveHeaders = append(hm.RemoveHeaders, m.Name)
+		}
+	}
+	s.mutationsSent = len(mutations)
+	return hm
+}
+
+// interrupt converts an interruption into a local reply
+func (s *Stream) interrupt(it *types.Interruption) *Response {
+	if it.IsDrop() {
+		return &Response{CloseStream: true}
+	}
+	s.mutationsSent = 0
+	hm := s.pendingMutations()
+	if hm == nil {
+		hm = &HeaderMutation{}
+	}
+	status := it.Status
+	switch {
+	case it.Action == types.InterruptionActionRedirect:
+		if status == 0 {
+			status = 302
+		}
+		hm.SetHeaders = append(hm.SetHeaders, HeaderValueOption{Header: HeaderValue{Key: "location", Value: it.Data}})
+	case status == 0:
+		status = 503
+	}
+	if it.Body != "" && it.ContentType != "" {
+		hm.SetHeaders = append(hm.SetHeaders, HeaderValueOption{Header: HeaderValue{Key: "content-type", Value: it.ContentType}})
+	}
+	return &Response{
+		ImmediateResponse: &ImmediateResponse{
+			Status:  status,
+			Headers: hm,
+			Body:    it.Body,
+			Details: "coraza_rule_" + strconv.Itoa(it.RuleID),
+		},
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package envoy
+
+import (
+	"testing"
+
+	"github.com/corazawaf/coraza/v3"
+)
+
+func newStream(t *testing.T, directives string) *Stream {
+	t.Helper()
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(`
+		SecRuleEngine On
+		SecRequestBodyAccess On
+		SecResponseBodyAccess On
+		SecResponseBodyMimeType text/plain
+	` + directives))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStream(waf)
+	t.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return s
+}
+
+func requestHeaders(endOfStream bool) *Request {
+	return &Request{
+		RequestHeaders: &Headers{
+			Headers: []HeaderValue{
+				{":method", "POST"},
+				{":path", "/login?user=admin"},
+				{":authority", "example.com"},
+				{"content-type", "application/x-www-form-urlencoded"},
+			},
+			EndOfStream: endOfStream,
+		},
+		Attributes: map[string]string{
+			"source.address":   "10.0.0.1",
+			"source.port":      "51000",
+			"request.protocol": "HTTP/2",
+		},
+	}
+}
+
+func process(t *testing.T, s *Stream, req *Request) *Response {
+	t.Helper()
+	res, err := s.Process(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestStreamRequestHeaders(t *testing.T) {
+	s := newStream(t, `SecRule REQUEST_HEADERS:Host "@streq example.com" "id:1,phase:1,chain,deny,status:403"
+		SecRule REMOTE_ADDR "@ipMatch 10.0.0.0/8" "chain"
+		SecRule REQUEST_PROTOCOL "@streq HTTP/2.0" ""`)
+	res := process(t, s, requestHeaders(false))
+	ir := res.ImmediateResponse
+	if ir == nil || ir.Status != 403 || ir.Details != "coraza_rule_1" {
+		t.Fatalf("expected immediate response, got %+v", res)
+	}
+}
+
+func TestStreamHTTP1PseudoHeaders(t *testing.T) {
+	s := newStream(t, `SecRule REQUEST_PROTOCOL_ANOMALIES "@unconditionalMatch" "id:1,phase:1,deny,status:400"
+		SecRule REQUEST_HEADERS:Host "!@streq example.com" "id:2,phase:1,deny,status:403"`)
+	req := requestHeaders(false)
+	req.Attributes["request.protocol"] = "HTTP/1.1"
+	if res := process(t, s, req); res.ImmediateResponse != nil {
+		t.Fatalf("unexpected immediate response %+v", res.ImmediateResponse)
+	}
+}
+
+func TestStreamBufferedBody(t *testing.T) {
+	s := newStream(t, `SecRule ARGS_POST:pass "@streq secret" "id:1,phase:2,deny,status:401"`)
+	if res := process(t, s, requestHeaders(false)); res.ImmediateResponse != nil || res.ModeOverride != nil {
+		t.Fatalf("unexpected response to headers %+v", res)
+	}
+	if res := process(t, s, &Request{RequestBody: &Body{Body: []byte("user=admin&pa")}}); res.ImmediateResponse != nil {
+		t.Fatal("partial chunks must not be evaluated")
+	}
+	res := process(t, s, &Request{RequestBody: &Body{Body: []byte("ss=secret"), EndOfStream: true}})
+	if res.ImmediateResponse == nil || res.ImmediateResponse.Status != 401 {
+		t.Fatalf("expected body to be blocked, got %+v", res)
+	}
+}
+
+func TestStreamResponse(t *testing.T) {
+	s := newStream(t, `SecRule REQUEST_URI "@contains login" "id:1,phase:1,pass,header:'set:X-Frame-Options=DENY'"
+		SecRule RESPONSE_STATUS "@eq 200" "id:2,phase:3,pass,header:'add:X-Checked=1'"
+		SecRule RESPONSE_BODY "@contains password" "id:3,phase:4,redirect:https://example.com/"`)
+	process(t, s, requestHeaders(true))
+	res := process(t, s, &Request{ResponseHeaders: &Headers{Headers: []HeaderValue{
+		{":status", "200"},
+		{"content-type", "text/plain"},
+	}}})
+	if res.ImmediateResponse != nil || res.HeaderMutation == nil || len(res.HeaderMutation.SetHeaders) != 2 {
+		t.Fatalf("expected header mutations, got %+v", res)
+	}
+	res = process(t, s, &Request{ResponseBody: &Body{Body: []byte("the password is 123"), EndOfStream: true}})
+	ir := res.ImmediateResponse
+	if ir == nil || ir.Status != 302 {
+		t.Fatalf("expected redirect, got %+v", res)
+	}
+	found := false
+	for _, h := range ir.Headers.SetHeaders {
+		if h.Header.Key == "location" && h.Header.Value == "https://example.com/" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected location header, got %+v", ir.Headers)
+	}
+}
+
+func TestStreamSkipsUninspectedBodies(t *testing.T) {
+	s := newStream(t, "")
+	process(t, s, requestHeaders(true))
+	res := process(t, s, &Request{ResponseHeaders: &Headers{Headers: []HeaderValue{
+		{":status", "200"},
+		{"content-type", "image/png"},
+	}}})
+	if res.ModeOverride == nil || res.ModeOverride.ResponseBodyMode != BodyModeNone {
+		t.Errorf("expected the response body to be skipped, got %+v", res)
+	}
+	if _, err := s.Process(&Request{}); err == nil {
+		t.Error("expected error for empty request")
+	}
+}
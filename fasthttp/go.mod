@@ -0,0 +1,17 @@
+module github.com/corazawaf/coraza/v3/fasthttp
+
+go 1.18
+
+require (
+	github.com/corazawaf/coraza/v3 v3.0.0-20220914101451-05d352c89b24
+	github.com/valyala/fasthttp v1.41.0
+)
+
+require (
+	github.com/andybalholm/brotli v1.0.4 // indirect
+	github.com/klauspost/compress v1.15.9 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+)
+
+// the middleware uses APIs that are not released yet
+replace github.com/corazawaf/coraza/v3 => ../
@@ -0,0 +1,217 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package fasthttp wraps fasthttp request handlers with a WAF. The
+// transaction is populated straight from the RequestCtx, the request is
+// never converted to net/http types and the request body is inspected
+// from the buffer fasthttp already read.
+package fasthttp
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/corazawaf/coraza/v3"
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/valyala/fasthttp"
+)
+
+// Logger receives the errors of the handler
+type Logger func(msg string, args ...interface{})
+
+var (
+	// NoopLogger discards the errors
+	NoopLogger = func(msg string, args ...interface{}) {}
+	// StdLogger writes the errors with the standard logger of the log
+	// package, which prints to stderr unless its output is changed
+	StdLogger = log.Printf
+)
+
+// ProcessRequest fills the transaction variables of phases 1 and 2 from
+// the request context, it stops after an interruption
+func ProcessRequest(tx types.Transaction, ctx *fasthttp.RequestCtx) (*types.Interruption, error) {
+	var (
+		cport  int
+		sport  int
+		server string
+	)
+	if addr, ok := ctx.RemoteAddr().(*net.TCPAddr); ok {
+		cport = addr.Port
+	}
+	if addr, ok := ctx.LocalAddr().(*net.TCPAddr); ok {
+		server = addr.IP.String()
+		sport = addr.Port
+	}
+	tx.ProcessConnection(ctx.RemoteIP().String(), cport, server, sport)
+	tx.ProcessURI(string(ctx.RequestURI()), string(ctx.Method()), string(ctx.Request.Header.Protocol()))
+	// VisitAll includes Host, Content-Type, User-Agent and Cookie which
+	// fasthttp stores apart from the other headers
+	ctx.Request.Header.VisitAll(func(key, value []byte) {
+		tx.AddRequestHeader(string(key), string(value))
+	})
+
+	if it := tx.ProcessRequestHeaders(); it != nil {
+		return it, nil
+	}
+
+	if tx.IsRequestBodyAccessible() {
+		if ctx.Request.IsBodyStream() {
+			// streamed bodies are read up to the body limit and
+			// transparently reassembled for the handler
+			stream := ctx.RequestBodyStream()
+			it, _, err := tx.ReadRequestBodyFrom(stream)
+			if err != nil {
+				return nil, fmt.Errorf("failed to append request body: %s", err.Error())
+			}
+			if it != nil {
+				return it, nil
+			}
+			rbr, err := tx.RequestBodyReader()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get the request body: %s", err.Error())
+			}
+			ctx.Request.SetBodyStream(io.MultiReader(rbr, stream), -1)
+		} else if body := ctx.PostBody(); len(body) > 0 {
+			it, _, err := tx.WriteRequestBody(body)
+			if err != nil {
+				return nil, fmt.Errorf("failed to append request body: %s", err.Error())
+			}
+			if it != nil {
+				return it, nil
+			}
+		}
+	}
+
+	return tx.ProcessRequestBody()
+}
+
+// ProcessResponse evaluates phases 3 and 4 on the response built by the
+// handler, fasthttp buffers the whole response so it can still be replaced
+// with WriteInterruptionResponse. Without interruption the response header
+// mutations are applied.
+func ProcessResponse(tx types.Transaction, ctx *fasthttp.RequestCtx) (*types.Interruption, error) {
+	ctx.Response.Header.VisitAll(func(key, value []byte) {
+		tx.AddResponseHeader(string(key), string(value))
+	})
+	if it := tx.ProcessResponseHeaders(ctx.Response.StatusCode(), string(ctx.Request.Header.Protocol())); it != nil {
+		return it, nil
+	}
+
+	if tx.IsResponseBodyAccessible() && tx.IsResponseBodyProcessable() && !ctx.Response.IsBodyStream() {
+		if _, err := tx.ResponseBodyWriter().Write(ctx.Response.Body()); err != nil {
+			return nil, fmt.Errorf("failed to append response body: %s", err.Error())
+		}
+		it, err := tx.ProcessResponseBody()
+		if err != nil {
+			return nil, err
+		}
+		if it != nil {
+			return it, nil
+		}
+	}
+
+	pauseTransaction(ctx, tx)
+	applyResponseHeaderMutations(&ctx.Response.Header, tx.ResponseHeaderMutations())
+	return nil, nil
+}
+
+// WrapHandler inspects the requests with the WAF before calling h and
+// its responses before they are sent
+func WrapHandler(waf coraza.WAF, l Logger, h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		tx := waf.NewTransaction()
+		defer func() {
+			// We run phase 5 rules and create audit logs (if enabled)
+			tx.ProcessLogging()
+			// we remove temporary files and free some memory
+			if err := tx.Close(); err != nil {
+				l("failed to close the transaction: %v", err)
+			}
+		}()
+
+		// Early return, Coraza is not going to process any rule
+		if tx.IsRuleEngineOff() {
+			h(ctx)
+			return
+		}
+
+		if it, err := ProcessRequest(tx, ctx); err != nil {
+			l("failed to process request: %v", err)
+			return
+		} else if it != nil {
+			WriteInterruptionResponse(ctx, tx, it)
+			return
+		}
+
+		h(ctx)
+
+		if it, err := ProcessResponse(tx, ctx); err != nil {
+			ctx.Response.ResetBody()
+			ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+			l("failed to process response: %v", err)
+		} else if it != nil {
+			WriteInterruptionResponse(ctx, tx, it)
+		}
+	}
+}
+
+// WriteInterruptionResponse replaces the response with the one of the
+// interruption, dropped connections are closed without a response
+func WriteInterruptionResponse(ctx *fasthttp.RequestCtx, tx types.Transaction, it *types.Interruption) {
+	pauseTransaction(ctx, tx)
+	ctx.Response.Reset()
+	if it.IsDrop() {
+		ctx.HijackSetNoResponse(true)
+		// the connection is closed once the hijack handler returns
+		ctx.Hijack(func(net.Conn) {})
+		return
+	}
+	applyResponseHeaderMutations(&ctx.Response.Header, tx.ResponseHeaderMutations())
+	status := it.Status
+	switch {
+	case it.Action == types.InterruptionActionRedirect:
+		if status == 0 {
+			status = fasthttp.StatusFound
+		}
+		ctx.Response.Header.Set(fasthttp.HeaderLocation, it.Data)
+	case status == 0:
+		status = fasthttp.StatusServiceUnavailable
+	}
+	ctx.SetStatusCode(status)
+	if it.Body != "" {
+		ctx.SetContentType(it.ContentType)
+		ctx.SetBodyString(it.Body)
+	}
+}
+
+// applyResponseHeaderMutations applies the header mutations in order
+func applyResponseHeaderMutations(h *fasthttp.ResponseHeader, mutations []types.HeaderMutation) {
+	for _, m := range mutations {
+		switch m.Action {
+		case types.HeaderMutationSet:
+			h.Set(m.Name, m.Value)
+		case types.HeaderMutationAdd:
+			h.Add(m.Name, m.Value)
+		case types.HeaderMutationRemove:
+			h.Del(m.Name)
+		}
+	}
+}
+
+// pauseTransaction waits for the delay requested by the pause action,
+// it returns early if the server shuts down
+func pauseTransaction(ctx *fasthttp.RequestCtx, tx types.Transaction) {
+	d := tx.PauseDuration()
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package fasthttp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3"
+	"github.com/valyala/fasthttp"
+)
+
+func newRequestCtx(method, uri, contentType, body string) *fasthttp.RequestCtx {
+	var req fasthttp.Request
+	req.Header.SetMethod(method)
+	req.SetRequestURI(uri)
+	req.Header.SetHost("example.com")
+	if contentType != "" {
+		req.Header.SetContentType(contentType)
+	}
+	req.SetBodyString(body)
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(&req, &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 51000}, nil)
+	return ctx
+}
+
+func wrap(t *testing.T, directives string, h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	t.Helper()
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(`
+		SecRuleEngine On
+		SecRequestBodyAccess On
+		SecResponseBodyAccess On
+		SecResponseBodyMimeType text/plain
+	` + directives))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return WrapHandler(waf, NoopLogger, h)
+}
+
+func hello(ctx *fasthttp.RequestCtx) {
+	ctx.SetContentType("text/plain")
+	ctx.SetBodyString("hello " + string(ctx.PostBody()))
+}
+
+func TestWrapHandlerRequest(t *testing.T) {
+	h := wrap(t, `SecRule REQUEST_HEADERS:Host "@streq example.com" "id:1,phase:1,chain,deny,status:403"
+		SecRule REMOTE_ADDR "@ipMatch 10.0.0.0/8" "chain"
+		SecRule ARGS_GET:id "@eq 0" ""
+		SecRule ARGS_POST:name "@streq admin" "id:2,phase:2,deny,status:401"`, hello)
+
+	ctx := newRequestCtx("GET", "/?id=0", "", "")
+	h(ctx)
+	if ctx.Response.StatusCode() != 403 {
+		t.Errorf("expected 403, got %d", ctx.Response.StatusCode())
+	}
+
+	ctx = newRequestCtx("POST", "/", "application/x-www-form-urlencoded", "name=admin")
+	h(ctx)
+	if ctx.Response.StatusCode() != 401 {
+		t.Errorf("expected 401, got %d", ctx.Response.StatusCode())
+	}
+
+	ctx = newRequestCtx("POST", "/", "application/x-www-form-urlencoded", "name=guest")
+	h(ctx)
+	if ctx.Response.StatusCode() != 200 || string(ctx.Response.Body()) != "hello name=guest" {
+		t.Errorf("expected the handler response, got %d %q", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+}
+
+func TestWrapHandlerResponse(t *testing.T) {
+	h := wrap(t, `SecRule REQUEST_URI "@beginsWith /" "id:1,phase:1,pass,header:'set:X-Frame-Options=DENY'"
+		SecRule RESPONSE_BODY "@contains secret" "id:2,phase:4,redirect:https://example.com/"`, hello)
+
+	ctx := newRequestCtx("POST", "/", "text/plain", "world")
+	h(ctx)
+	if string(ctx.Response.Header.Peek("X-Frame-Options")) != "DENY" || string(ctx.Response.Body()) != "hello world" {
+		t.Errorf("unexpected response %q", ctx.Response.String())
+	}
+
+	ctx = newRequestCtx("POST", "/", "text/plain", "secret")
+	h(ctx)
+	if ctx.Response.StatusCode() != 302 || string(ctx.Response.Header.Peek("Location")) != "https://example.com/" {
+		t.Errorf("expected redirect, got %q", ctx.Response.String())
+	}
+	if len(ctx.Response.Body()) != 0 {
+		t.Errorf("expected the response body to be discarded, got %q", ctx.Response.Body())
+	}
+}
@@ -0,0 +1,15 @@
+module github.com/corazawaf/coraza/v3/fiber
+
+go 1.18
+
+require (
+	github.com/corazawaf/coraza/v3 v3.0.0-20220914101451-05d352c89b24
+	github.com/corazawaf/coraza/v3/fasthttp v0.0.0-00010101000000-000000000000
+	github.com/gofiber/fiber/v2 v2.38.1
+)
+
+// the middleware uses APIs that are not released yet
+replace (
+	github.com/corazawaf/coraza/v3 => ../
+	github.com/corazawaf/coraza/v3/fasthttp => ../fasthttp
+)
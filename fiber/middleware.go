@@ -0,0 +1,111 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package fiber provides a fiber middleware inspecting requests and
+// responses with a WAF, the transaction is populated from the underlying
+// fasthttp request. Interruptions are returned as *fiber.Error, so they are
+// rendered by the ErrorHandler of the app, unless the rule defines its own
+// response body.
+//
+// Paths needing additional rules can be inspected by a WAF created from
+// the same configuration:
+//
+//	cfg := coraza.NewWAFConfig().WithDirectivesFromFile("coraza.conf")
+//	waf, _ := coraza.NewWAF(cfg)
+//	loginWAF, _ := coraza.NewWAF(cfg.WithDirectives(`SecRule ARGS_POST:user "@rx [^a-z]" "id:100,phase:2,deny"`))
+//	app.Use(corazafiber.Middleware(waf, corazafiber.Options{
+//		Routes: map[string]coraza.WAF{"/login": loginWAF},
+//		Skip: func(c *fiber.Ctx) bool { return c.Path() == "/healthz" },
+//	}))
+package fiber
+
+import (
+	"github.com/corazawaf/coraza/v3"
+	corazafasthttp "github.com/corazawaf/coraza/v3/fasthttp"
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/gofiber/fiber/v2"
+)
+
+type Logger func(msg string, args ...interface{})
+
+// Options configures the middleware
+type Options struct {
+	// Skip returns true for requests served without inspection
+	Skip func(c *fiber.Ctx) bool
+
+	// Routes maps request paths, as returned by Ctx.Path, to the WAF
+	// inspecting them instead of the default one. Fiber resolves the route
+	// after the middlewares registered with Use, so the keys are paths
+	// and not route patterns.
+	Routes map[string]coraza.WAF
+
+	// Logger receives the errors of the middleware, they are discarded
+	// if it is nil
+	Logger Logger
+}
+
+// Middleware inspects the requests with the WAF before calling the next
+// handler, and the responses before they are sent
+func Middleware(waf coraza.WAF, opts Options) fiber.Handler {
+	l := opts.Logger
+	if l == nil {
+		l = func(string, ...interface{}) {}
+	}
+	return func(c *fiber.Ctx) error {
+		if opts.Skip != nil && opts.Skip(c) {
+			return c.Next()
+		}
+		w := waf
+		if rw, ok := opts.Routes[c.Path()]; ok {
+			w = rw
+		}
+		tx := w.NewTransaction()
+		defer func() {
+			// We run phase 5 rules and create audit logs (if enabled)
+			tx.ProcessLogging()
+			// we remove temporary files and free some memory
+			if err := tx.Close(); err != nil {
+				l("failed to close the transaction: %v", err)
+			}
+		}()
+
+		if tx.IsRuleEngineOff() {
+			return c.Next()
+		}
+
+		if it, err := corazafasthttp.ProcessRequest(tx, c.Context()); err != nil {
+			l("failed to process request: %v", err)
+			return err
+		} else if it != nil {
+			return interrupt(c, tx, it)
+		}
+
+		if err := c.Next(); err != nil {
+			// the error response is built by the error handler, the
+			// response phases must see it
+			if err := c.App().Config().ErrorHandler(c, err); err != nil {
+				return err
+			}
+		}
+
+		it, err := corazafasthttp.ProcessResponse(tx, c.Context())
+		if err != nil {
+			l("failed to process response: %v", err)
+			return err
+		}
+		if it != nil {
+			return interrupt(c, tx, it)
+		}
+		return nil
+	}
+}
+
+// interrupt replaces the response with the one of the interruption, it
+// returns the error rendering it if the rule defines no response body
+func interrupt(c *fiber.Ctx, tx types.Transaction, it *types.Interruption) error {
+	corazafasthttp.WriteInterruptionResponse(c.Context(), tx, it)
+	if it.IsDrop() || it.Action == types.InterruptionActionRedirect || it.Body != "" {
+		return nil
+	}
+	return fiber.NewError(c.Response().StatusCode())
+}
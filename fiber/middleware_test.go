@@ -0,0 +1,103 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package fiber
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3"
+	"github.com/gofiber/fiber/v2"
+)
+
+func newWAF(t *testing.T, directives string) coraza.WAF {
+	t.Helper()
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(`
+		SecRuleEngine On
+		SecRequestBodyAccess On
+		SecResponseBodyAccess On
+		SecResponseBodyMimeType text/plain
+	` + directives))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return waf
+}
+
+func newApp(t *testing.T, waf coraza.WAF, opts Options) *fiber.App {
+	t.Helper()
+	app := fiber.New()
+	app.Use(Middleware(waf, opts))
+	hello := func(c *fiber.Ctx) error {
+		return c.SendString("hello " + string(c.Body()))
+	}
+	app.Post("/", hello)
+	app.Post("/login", hello)
+	app.Get("/healthz", func(c *fiber.Ctx) error { return c.SendString("secret") })
+	app.Get("/error", func(c *fiber.Ctx) error { return fiber.NewError(fiber.StatusTeapot, "secret") })
+	return app
+}
+
+func serve(t *testing.T, app *fiber.App, method, target, body string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, string(b)
+}
+
+func TestMiddlewareRequest(t *testing.T) {
+	app := newApp(t, newWAF(t, `SecRule ARGS:id "@eq 0" "id:1,phase:1,deny,status:403"
+		SecRule ARGS_POST:name "@streq admin" "id:2,phase:2,deny,status:401"`), Options{})
+
+	if code, _ := serve(t, app, "POST", "/?id=0", ""); code != 403 {
+		t.Errorf("expected 403, got %d", code)
+	}
+	if code, _ := serve(t, app, "POST", "/", "name=admin"); code != 401 {
+		t.Errorf("expected 401, got %d", code)
+	}
+	if code, body := serve(t, app, "POST", "/", "name=guest"); code != 200 || body != "hello name=guest" {
+		t.Errorf("expected the handler response, got %d %q", code, body)
+	}
+}
+
+func TestMiddlewareResponse(t *testing.T) {
+	app := newApp(t, newWAF(t, `SecRule RESPONSE_BODY "@contains secret" "id:1,phase:4,deny,status:403"`), Options{})
+
+	if code, body := serve(t, app, "GET", "/healthz", ""); code != 403 || strings.Contains(body, "secret") {
+		t.Errorf("expected the response to be denied, got %d %q", code, body)
+	}
+	// responses built by the error handler are inspected too
+	if code, body := serve(t, app, "GET", "/error", ""); code != 403 || strings.Contains(body, "secret") {
+		t.Errorf("expected the error response to be denied, got %d %q", code, body)
+	}
+}
+
+func TestMiddlewareRoutes(t *testing.T) {
+	waf := newWAF(t, "")
+	loginWAF := newWAF(t, `SecRule ARGS_POST:user "@rx [^a-z]" "id:100,phase:2,deny,status:400"`)
+	app := newApp(t, newWAF(t, `SecRule RESPONSE_BODY "@contains secret" "id:1,phase:4,deny"`), Options{
+		Routes: map[string]coraza.WAF{"/login": loginWAF, "/": waf},
+		Skip:   func(c *fiber.Ctx) bool { return c.Path() == "/healthz" },
+	})
+
+	if code, _ := serve(t, app, "POST", "/login", "user=<script>"); code != 400 {
+		t.Errorf("expected the route rules to deny the request, got %d", code)
+	}
+	if code, _ := serve(t, app, "POST", "/", "user=<script>"); code != 200 {
+		t.Errorf("expected the default rules to allow the request, got %d", code)
+	}
+	if code, body := serve(t, app, "GET", "/healthz", ""); code != 200 || body != "secret" {
+		t.Errorf("expected the route to be skipped, got %d %q", code, body)
+	}
+}
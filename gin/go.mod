@@ -0,0 +1,11 @@
+module github.com/corazawaf/coraza/v3/gin
+
+go 1.18
+
+require (
+	github.com/corazawaf/coraza/v3 v3.0.0-20220914101451-05d352c89b24
+	github.com/gin-gonic/gin v1.8.1
+)
+
+// the middleware uses APIs that are not released yet
+replace github.com/corazawaf/coraza/v3 => ../
@@ -0,0 +1,250 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package gin provides a gin middleware inspecting requests and responses
+// with a WAF. Interrupted requests are aborted with gin's own
+// AbortWithStatus, so the remaining handlers of the chain are skipped.
+//
+// Routes needing additional rules can be inspected by a WAF created from
+// the same configuration:
+//
+//	cfg := coraza.NewWAFConfig().WithDirectivesFromFile("coraza.conf")
+//	waf, _ := coraza.NewWAF(cfg)
+//	loginWAF, _ := coraza.NewWAF(cfg.WithDirectives(`SecRule ARGS_POST:user "@rx [^a-z]" "id:100,phase:2,deny"`))
+//	r.Use(corazagin.Middleware(waf, corazagin.Options{
+//		Routes: map[string]coraza.WAF{"/login": loginWAF},
+//		Skip: func(c *gin.Context) bool { return c.FullPath() == "/healthz" },
+//	}))
+package gin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/corazawaf/coraza/v3"
+	txhttp "github.com/corazawaf/coraza/v3/http"
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/gin-gonic/gin"
+)
+
+type Logger func(msg string, args ...interface{})
+
+// Options configures the middleware
+type Options struct {
+	// Skip returns true for requests served without inspection
+	Skip func(c *gin.Context) bool
+
+	// Routes maps route patterns, as returned by Context.FullPath, to the
+	// WAF inspecting them instead of the default one
+	Routes map[string]coraza.WAF
+
+	// Logger receives the errors of the middleware, they are discarded
+	// if it is nil
+	Logger Logger
+}
+
+// Middleware inspects the requests with the WAF before calling the next
+// handlers, and the responses before they are sent
+func Middleware(waf coraza.WAF, opts Options) gin.HandlerFunc {
+	l := opts.Logger
+	if l == nil {
+		l = func(string, ...interface{}) {}
+	}
+	return func(c *gin.Context) {
+		if opts.Skip != nil && opts.Skip(c) {
+			c.Next()
+			return
+		}
+		w := waf
+		if rw, ok := opts.Routes[c.FullPath()]; ok {
+			w = rw
+		}
+		tx := w.NewTransaction()
+		defer func() {
+			// We run phase 5 rules and create audit logs (if enabled)
+			tx.ProcessLogging()
+			// we remove temporary files and free some memory
+			if err := tx.Close(); err != nil {
+				l("failed to close the transaction: %v", err)
+			}
+		}()
+
+		if tx.IsRuleEngineOff() {
+			c.Next()
+			return
+		}
+
+		if it, err := txhttp.ProcessRequest(tx, c.Request); err != nil {
+			l("failed to process request: %v", err)
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		} else if it != nil {
+			abort(c, tx, it)
+			return
+		}
+
+		rw := &responseWriter{ResponseWriter: c.Writer, tx: tx, ctx: c.Request.Context(), proto: c.Request.Proto}
+		c.Writer = rw
+		c.Next()
+		c.Writer = rw.ResponseWriter
+		if err := rw.finish(c); err != nil {
+			l("failed to process response: %v", err)
+		}
+	}
+}
+
+// abort replaces the response with the one of the interruption and
+// aborts the handler chain
+func abort(c *gin.Context, tx types.Transaction, it *types.Interruption) {
+	txhttp.PauseTransaction(c.Request.Context(), tx)
+	_ = c.Error(fmt.Errorf("request interrupted by rule %d", it.RuleID)).SetType(gin.ErrorTypePrivate)
+	if it.IsDrop() {
+		if conn, _, err := c.Writer.Hijack(); err == nil {
+			_ = conn.Close()
+			c.Abort()
+			return
+		}
+		panic(http.ErrAbortHandler)
+	}
+	h := c.Writer.Header()
+	txhttp.ApplyResponseHeaderMutations(h, tx.ResponseHeaderMutations())
+	// the handlers may have set the length of their own body
+	h.Del("Content-Length")
+	status := it.Status
+	switch {
+	case it.Action == types.InterruptionActionRedirect:
+		if status == 0 {
+			status = http.StatusFound
+		}
+		c.Header("Location", it.Data)
+	case status == 0:
+		status = http.StatusServiceUnavailable
+	}
+	if it.Body != "" {
+		c.Data(status, it.ContentType, []byte(it.Body))
+		c.Abort()
+		return
+	}
+	c.AbortWithStatus(status)
+}
+
+// responseWriter runs the response headers phase right before the headers
+// are sent, the body is buffered only if the rules inspect it
+type responseWriter struct {
+	gin.ResponseWriter
+	tx    types.Transaction
+	ctx   context.Context
+	proto string
+
+	status          int
+	headerProcessed bool
+	buffering       bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if !w.headerProcessed && code > 0 {
+		w.status = code
+	}
+}
+
+func (w *responseWriter) WriteHeaderNow() {
+	w.processHeaders()
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.processHeaders()
+	switch {
+	case w.tx.IsInterrupted():
+		// the response is replaced once the handlers return
+		return len(b), nil
+	case w.buffering:
+		return w.tx.ResponseBodyWriter().Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *responseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *responseWriter) Written() bool {
+	return w.headerProcessed
+}
+
+// Flush is ignored while the body is buffered
+func (w *responseWriter) Flush() {
+	w.processHeaders()
+	if !w.buffering && !w.tx.IsInterrupted() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *responseWriter) processHeaders() {
+	if w.headerProcessed {
+		return
+	}
+	w.headerProcessed = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	for k, vv := range w.Header() {
+		for _, v := range vv {
+			w.tx.AddResponseHeader(k, v)
+		}
+	}
+	if it := w.tx.ProcessResponseHeaders(w.status, w.proto); it != nil {
+		return
+	}
+	if w.tx.IsResponseBodyAccessible() && w.tx.IsResponseBodyProcessable() {
+		w.buffering = true
+		return
+	}
+	w.writeHeader()
+}
+
+func (w *responseWriter) writeHeader() {
+	txhttp.PauseTransaction(w.ctx, w.tx)
+	txhttp.ApplyResponseHeaderMutations(w.Header(), w.tx.ResponseHeaderMutations())
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// finish evaluates the response body and sends the buffered response, or
+// the one of the interruption
+func (w *responseWriter) finish(c *gin.Context) error {
+	w.processHeaders()
+	if it := w.tx.Interruption(); it != nil {
+		abort(c, w.tx, it)
+		return nil
+	}
+	if !w.buffering {
+		return nil
+	}
+	it, err := w.tx.ProcessResponseBody()
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return err
+	}
+	if it != nil {
+		abort(c, w.tx, it)
+		return nil
+	}
+	w.writeHeader()
+	reader, err := w.tx.ResponseBodyReader()
+	if err != nil {
+		return fmt.Errorf("failed to release the response body reader: %v", err)
+	}
+	if _, err := io.Copy(w.ResponseWriter, reader); err != nil {
+		return fmt.Errorf("failed to copy the response body: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package gin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3"
+	"github.com/gin-gonic/gin"
+)
+
+func newWAF(t *testing.T, directives string) coraza.WAF {
+	t.Helper()
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(`
+		SecRuleEngine On
+		SecRequestBodyAccess On
+		SecResponseBodyAccess On
+		SecResponseBodyMimeType text/plain
+	` + directives))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return waf
+}
+
+func newRouter(t *testing.T, waf coraza.WAF, opts Options) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware(waf, opts))
+	echo := func(c *gin.Context) {
+		body, _ := c.GetRawData()
+		c.String(http.StatusOK, "hello %s", body)
+	}
+	r.POST("/", echo)
+	r.POST("/login", echo)
+	r.GET("/healthz", func(c *gin.Context) { c.String(http.StatusOK, "secret") })
+	return r
+}
+
+func serve(r http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddlewareRequest(t *testing.T) {
+	r := newRouter(t, newWAF(t, `SecRule ARGS:id "@eq 0" "id:1,phase:1,deny,status:403"
+		SecRule ARGS_POST:name "@streq admin" "id:2,phase:2,deny,status:401"`), Options{})
+
+	if w := serve(r, "POST", "/?id=0", ""); w.Code != 403 {
+		t.Errorf("expected 403, got %d", w.Code)
+	}
+	if w := serve(r, "POST", "/", "name=admin"); w.Code != 401 {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+	if w := serve(r, "POST", "/", "name=guest"); w.Code != 200 || w.Body.String() != "hello name=guest" {
+		t.Errorf("expected the handler response, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestMiddlewareResponse(t *testing.T) {
+	r := newRouter(t, newWAF(t, `SecRule REQUEST_URI "@beginsWith /" "id:1,phase:1,pass,header:'set:X-Frame-Options=DENY'"
+		SecRule RESPONSE_BODY "@contains secret" "id:2,phase:4,deny,status:403"`), Options{})
+
+	w := serve(r, "POST", "/", "world")
+	if w.Code != 200 || w.Header().Get("X-Frame-Options") != "DENY" || w.Body.String() != "hello world" {
+		t.Errorf("unexpected response %d %v %q", w.Code, w.Header(), w.Body.String())
+	}
+	w = serve(r, "GET", "/healthz", "")
+	if w.Code != 403 || w.Body.Len() != 0 {
+		t.Errorf("expected the response to be denied, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestMiddlewareRoutes(t *testing.T) {
+	waf := newWAF(t, "")
+	loginWAF := newWAF(t, `SecRule ARGS_POST:user "@rx [^a-z]" "id:100,phase:2,deny,status:400"`)
+	r := newRouter(t, newWAF(t, `SecRule RESPONSE_BODY "@contains secret" "id:1,phase:4,deny"`), Options{
+		Routes: map[string]coraza.WAF{"/login": loginWAF, "/": waf},
+		Skip:   func(c *gin.Context) bool { return c.FullPath() == "/healthz" },
+	})
+
+	if w := serve(r, "POST", "/login", "user=<script>"); w.Code != 400 {
+		t.Errorf("expected the route rules to deny the request, got %d", w.Code)
+	}
+	if w := serve(r, "POST", "/", "user=<script>"); w.Code != 200 {
+		t.Errorf("expected the default rules to allow the request, got %d", w.Code)
+	}
+	if w := serve(r, "GET", "/healthz", ""); w.Code != 200 || w.Body.String() != "secret" {
+		t.Errorf("expected the route to be skipped, got %d", w.Code)
+	}
+}
@@ -13,8 +13,10 @@ go 1.18
 // - libinjection-go
 // - aho-corasick
 // - gjson
+// - brotli
 
 require (
+	github.com/andybalholm/brotli v1.0.4
 	github.com/anuraaga/go-modsecurity v0.0.0-20220824035035-b9a4099778df
 	github.com/corazawaf/libinjection-go v0.1.2
 	github.com/foxcpp/go-mockdns v1.0.0
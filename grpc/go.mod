@@ -0,0 +1,12 @@
+module github.com/corazawaf/coraza/v3/grpc
+
+go 1.18
+
+require (
+	github.com/corazawaf/coraza/v3 v3.0.0-20220914101451-05d352c89b24
+	google.golang.org/grpc v1.50.1
+	google.golang.org/protobuf v1.28.1
+)
+
+// the interceptors use APIs that are not released yet
+replace github.com/corazawaf/coraza/v3 => ../
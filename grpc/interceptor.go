@@ -0,0 +1,266 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package grpc provides gRPC server interceptors inspecting calls with a
+// WAF. The incoming metadata is evaluated as request headers, REQUEST_URI
+// is the full method name like /package.Service/Method.
+//
+// With Options.InspectMessages every message is serialized with protojson
+// and evaluated as the body of its own transaction, the JSON body
+// processor must be enabled for gRPC requests:
+//
+//	SecRule REQUEST_HEADERS:Content-Type "@beginsWith application/grpc" \
+//		"id:100,phase:1,pass,nolog,ctl:requestBodyProcessor=JSON"
+//
+// and application/grpc added to SecResponseBodyMimeType for the responses.
+//
+// Interrupted calls fail with RESOURCE_EXHAUSTED if the rule status is 429
+// and PERMISSION_DENIED otherwise.
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/corazawaf/coraza/v3"
+	txhttp "github.com/corazawaf/coraza/v3/http"
+	"github.com/corazawaf/coraza/v3/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Options configures the interceptors
+type Options struct {
+	// InspectMessages evaluates the request and response messages as
+	// bodies, each message in its own transaction
+	InspectMessages bool
+}
+
+// UnaryServerInterceptor inspects unary calls, the handler is not called
+// if the request is interrupted
+func UnaryServerInterceptor(waf coraza.WAF, opts Options) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		tx := waf.NewTransaction()
+		defer finish(tx)
+		if tx.IsRuleEngineOff() {
+			return handler(ctx, req)
+		}
+
+		var msg interface{}
+		if opts.InspectMessages {
+			msg = req
+		}
+		it, err := processRequest(ctx, tx, info.FullMethod, msg)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if it != nil {
+			return nil, interruptionError(ctx, tx, it)
+		}
+
+		resp, herr := handler(ctx, req)
+		msg = nil
+		if opts.InspectMessages && herr == nil {
+			msg = resp
+		}
+		if it, err := processResponse(tx, status.Code(herr), msg); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		} else if it != nil {
+			return nil, interruptionError(ctx, tx, it)
+		}
+		return resp, herr
+	}
+}
+
+// StreamServerInterceptor inspects the metadata of streaming calls before
+// calling the handler and, with Options.InspectMessages, each message
+// received or sent. Interrupted messages fail RecvMsg and SendMsg.
+func StreamServerInterceptor(waf coraza.WAF, opts Options) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		tx := waf.NewTransaction()
+		defer finish(tx)
+		if tx.IsRuleEngineOff() {
+			return handler(srv, ss)
+		}
+		it, err := processRequest(ctx, tx, info.FullMethod, nil)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if it != nil {
+			return interruptionError(ctx, tx, it)
+		}
+		if opts.InspectMessages {
+			ss = &serverStream{ServerStream: ss, waf: waf, method: info.FullMethod}
+		}
+		herr := handler(srv, ss)
+		if it, err := processResponse(tx, status.Code(herr), nil); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		} else if it != nil {
+			return interruptionError(ctx, tx, it)
+		}
+		return herr
+	}
+}
+
+// serverStream evaluates every message of a stream
+type serverStream struct {
+	grpc.ServerStream
+	waf    coraza.WAF
+	method string
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.inspect(m, nil)
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	if err := s.inspect(nil, m); err != nil {
+		return err
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// inspect evaluates a message in a new transaction with the metadata of
+// the stream
+func (s *serverStream) inspect(req interface{}, resp interface{}) error {
+	ctx := s.Context()
+	tx := s.waf.NewTransaction()
+	defer finish(tx)
+	it, err := processRequest(ctx, tx, s.method, req)
+	if err == nil && it == nil && resp != nil {
+		it, err = processResponse(tx, codes.OK, resp)
+	}
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if it != nil {
+		return interruptionError(ctx, tx, it)
+	}
+	return nil
+}
+
+// processRequest evaluates the request phases, msg is used as the request
+// body if not nil
+func processRequest(ctx context.Context, tx types.Transaction, method string, msg interface{}) (*types.Interruption, error) {
+	var (
+		client string
+		cport  int
+	)
+	if p, ok := peer.FromContext(ctx); ok {
+		if addr, ok := p.Addr.(*net.TCPAddr); ok {
+			client = addr.IP.String()
+			cport = addr.Port
+		}
+	}
+	tx.ProcessConnection(client, cport, "", 0)
+	tx.ProcessURI(method, http.MethodPost, "HTTP/2")
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, vs := range md {
+		for _, v := range vs {
+			tx.AddRequestHeader(k, v)
+		}
+	}
+	if a := md.Get(":authority"); len(a) > 0 {
+		tx.AddRequestHeader("Host", a[0])
+	}
+	if it := tx.ProcessRequestHeaders(); it != nil {
+		return it, nil
+	}
+	if msg != nil && tx.IsRequestBodyAccessible() {
+		body, err := marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		if it, _, err := tx.WriteRequestBody(body); err != nil || it != nil {
+			return it, err
+		}
+	}
+	return tx.ProcessRequestBody()
+}
+
+// processResponse evaluates the response phases, msg is used as the
+// response body if not nil
+func processResponse(tx types.Transaction, code codes.Code, msg interface{}) (*types.Interruption, error) {
+	tx.AddResponseHeader("Content-Type", "application/grpc")
+	tx.AddResponseHeader("Grpc-Status", fmt.Sprint(int(code)))
+	if it := tx.ProcessResponseHeaders(httpStatus(code), "HTTP/2"); it != nil {
+		return it, nil
+	}
+	if msg != nil && tx.IsResponseBodyAccessible() && tx.IsResponseBodyProcessable() {
+		body, err := marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.ResponseBodyWriter().Write(body); err != nil {
+			return nil, err
+		}
+	}
+	return tx.ProcessResponseBody()
+}
+
+func marshal(msg interface{}) ([]byte, error) {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("unsupported message type %T", msg)
+	}
+	return protojson.Marshal(m)
+}
+
+// httpStatus maps gRPC codes to the HTTP status evaluated as
+// RESPONSE_STATUS
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// interruptionError returns the status error of an interruption
+func interruptionError(ctx context.Context, tx types.Transaction, it *types.Interruption) error {
+	txhttp.PauseTransaction(ctx, tx)
+	code := codes.PermissionDenied
+	if it.Status == http.StatusTooManyRequests {
+		code = codes.ResourceExhausted
+	}
+	return status.Errorf(code, "request interrupted by rule %d", it.RuleID)
+}
+
+// finish runs the logging phase and releases the transaction
+func finish(tx types.Transaction) {
+	tx.ProcessLogging()
+	// Close only fails removing temporary files, the transaction is
+	// released anyway
+	_ = tx.Close()
+}
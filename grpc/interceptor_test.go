@@ -0,0 +1,83 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func newWAF(t *testing.T, directives string) coraza.WAF {
+	t.Helper()
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(`
+		SecRuleEngine On
+		SecRequestBodyAccess On
+		SecResponseBodyAccess On
+		SecResponseBodyMimeType application/grpc
+		SecRule REQUEST_HEADERS:Content-Type "@beginsWith application/grpc" "id:100,phase:1,pass,nolog,ctl:requestBodyProcessor=JSON"
+	` + directives))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return waf
+}
+
+var info = &grpc.UnaryServerInfo{FullMethod: "/test.Echo/Say"}
+
+func call(t *testing.T, interceptor grpc.UnaryServerInterceptor, md metadata.MD, req string, resp string) codes.Code {
+	t.Helper()
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	_, err := interceptor(ctx, wrapperspb.String(req), info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return wrapperspb.String(resp), nil
+	})
+	return status.Code(err)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor(newWAF(t, `SecRule REQUEST_URI "@streq /test.Echo/Say" "id:1,phase:1,chain,deny"
+			SecRule REQUEST_HEADERS:x-user "@streq guest" ""
+		SecRule ARGS_POST "@contains attack" "id:2,phase:2,deny,status:429"
+		SecRule RESPONSE_BODY "@contains secret" "id:3,phase:4,deny"`), Options{InspectMessages: true})
+	md := metadata.Pairs("content-type", "application/grpc", "x-user", "admin")
+
+	if code := call(t, interceptor, metadata.Pairs("content-type", "application/grpc", "x-user", "guest"), "", ""); code != codes.PermissionDenied {
+		t.Errorf("expected the metadata to be denied, got %s", code)
+	}
+	if code := call(t, interceptor, md, "an attack", ""); code != codes.ResourceExhausted {
+		t.Errorf("expected the message to be rate limited, got %s", code)
+	}
+	if code := call(t, interceptor, md, "hello", "secret"); code != codes.PermissionDenied {
+		t.Errorf("expected the response to be denied, got %s", code)
+	}
+	if code := call(t, interceptor, md, "hello", "world"); code != codes.OK {
+		t.Errorf("expected the call to succeed, got %s", code)
+	}
+}
+
+func TestUnaryServerInterceptorWithoutMessages(t *testing.T) {
+	interceptor := UnaryServerInterceptor(newWAF(t, `SecRule ARGS_POST "@contains attack" "id:1,phase:2,deny"`), Options{})
+	if code := call(t, interceptor, metadata.Pairs("content-type", "application/grpc"), "an attack", ""); code != codes.OK {
+		t.Errorf("expected the message to be ignored, got %s", code)
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	for code, want := range map[codes.Code]int{
+		codes.OK:                200,
+		codes.PermissionDenied:  403,
+		codes.ResourceExhausted: 429,
+		codes.Internal:          500,
+	} {
+		if got := httpStatus(code); got != want {
+			t.Errorf("expected %d for %s, got %d", want, code, got)
+		}
+	}
+}
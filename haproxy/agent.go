@@ -0,0 +1,391 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package haproxy implements a SPOE agent, HAProxy sends the requests and
+// responses with the SPOP protocol and enforces the result with ACLs on the
+// variables set by the agent. The messages are declared in the SPOE
+// configuration:
+//
+//	[coraza]
+//	spoe-agent coraza-agent
+//	    messages    coraza-req coraza-res
+//	    option      var-prefix coraza
+//	    timeout     hello 2s
+//	    timeout     idle  2m
+//	    timeout     processing 500ms
+//	    use-backend coraza-spoa
+//	    log         global
+//
+//	spoe-message coraza-req
+//	    args id=unique-id src-ip=src src-port=src_port dst-ip=dst dst-port=dst_port method=method path=path query=query version=req.ver headers=req.hdrs body=req.body
+//	    event on-frontend-http-request
+//
+//	spoe-message coraza-res
+//	    args id=unique-id version=res.ver status=status headers=res.hdrs body=res.body
+//	    event on-http-response
+//
+// and enforced in the frontend, which must set unique-id-format:
+//
+//	filter spoe engine coraza config /etc/haproxy/coraza.cfg
+//	http-request redirect code 302 location %[var(txn.coraza.data)] if { var(txn.coraza.action) -m str redirect }
+//	http-request deny deny_status 403 if { var(txn.coraza.action) -m str deny }
+//	http-request silent-drop if { var(txn.coraza.action) -m str drop }
+//	http-response deny deny_status 403 if { var(txn.coraza.action) -m str deny }
+//
+// Bodies are only available with option http-buffer-request and are
+// truncated to tune.bufsize.
+package haproxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/corazawaf/coraza/v3"
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+const (
+	// DefaultRequestMessage is the name of the SPOE message with the request
+	DefaultRequestMessage = "coraza-req"
+	// DefaultResponseMessage is the name of the SPOE message with the response
+	DefaultResponseMessage = "coraza-res"
+
+	defaultMaxFrameSize   = 16384
+	defaultTransactionTTL = 30 * time.Second
+)
+
+// Agent is a SPOE agent evaluating the requests and responses sent by
+// HAProxy, the result is returned as transaction scoped variables.
+// Agents are safe for concurrent use by multiple connections.
+type Agent struct {
+	// RequestMessage is the name of the message evaluated with the
+	// request phases
+	RequestMessage string
+
+	// ResponseMessage is the name of the message evaluated with the
+	// response phases
+	ResponseMessage string
+
+	// TransactionTTL is how long a transaction waits for its response
+	// message before it is logged and closed
+	TransactionTTL time.Duration
+
+	// MaxFrameSize is the largest frame accepted by the agent, HAProxy
+	// may negotiate a smaller one
+	MaxFrameSize uint32
+
+	waf coraza.WAF
+
+	mu        sync.Mutex
+	pending   map[string]*pendingTransaction
+	lastSweep time.Time
+}
+
+// pendingTransaction is a transaction waiting for the response message
+type pendingTransaction struct {
+	tx      types.Transaction
+	expires time.Time
+}
+
+// NewAgent creates an agent for the WAF with the default settings
+func NewAgent(waf coraza.WAF) *Agent {
+	return &Agent{
+		RequestMessage:  DefaultRequestMessage,
+		ResponseMessage: DefaultResponseMessage,
+		TransactionTTL:  defaultTransactionTTL,
+		MaxFrameSize:    defaultMaxFrameSize,
+		waf:             waf,
+		pending:         map[string]*pendingTransaction{},
+	}
+}
+
+// Serve accepts HAProxy connections on the listener until it fails
+func (a *Agent) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			_ = a.ServeConn(conn)
+		}()
+	}
+}
+
+// ServeConn handles a single HAProxy connection, it returns when
+// HAProxy disconnects or the connection fails
+func (a *Agent) ServeConn(conn io.ReadWriteCloser) error {
+	defer conn.Close()
+	f, err := readFrame(conn, a.MaxFrameSize)
+	if err != nil {
+		return err
+	}
+	if f.typ != frameHAProxyHello {
+		return a.disconnect(conn, statusInvalidFrame, "expected HAPROXY-HELLO")
+	}
+	hello, err := decodeKVList(f.payload)
+	if err != nil {
+		return a.disconnect(conn, statusInvalidFrame, err.Error())
+	}
+	versions, _ := hello["supported-versions"].(string)
+	if !supportsVersion(versions, "2.0") {
+		return a.disconnect(conn, statusUnsupportedVersion, "unsupported version "+versions)
+	}
+	frameSize := a.MaxFrameSize
+	if max, ok := hello["max-frame-size"].(uint64); ok && uint32(max) < frameSize {
+		frameSize = uint32(max)
+	}
+	var payload []byte
+	payload = appendString(payload, "version")
+	payload = appendData(payload, "2.0")
+	payload = appendString(payload, "max-frame-size")
+	payload = appendData(payload, frameSize)
+	payload = appendString(payload, "capabilities")
+	payload = appendData(payload, "pipelining")
+	if err := writeFrame(conn, &frame{typ: frameAgentHello, flags: flagFin, payload: payload}); err != nil {
+		return err
+	}
+	if hc, _ := hello["healthcheck"].(bool); hc {
+		return nil
+	}
+
+	for {
+		f, err := readFrame(conn, frameSize)
+		switch {
+		case err == errFrameTooBig:
+			return a.disconnect(conn, statusFrameTooBig, err.Error())
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		}
+		switch f.typ {
+		case frameNotify:
+			msgs, err := decodeMessages(f.payload)
+			if err != nil {
+				return a.disconnect(conn, statusInvalidFrame, err.Error())
+			}
+			var actions []byte
+			for _, msg := range msgs {
+				if actions, err = a.process(actions, msg); err != nil {
+					return a.disconnect(conn, statusIOError, err.Error())
+				}
+			}
+			ack := &frame{typ: frameAck, flags: flagFin, streamID: f.streamID, frameID: f.frameID, payload: actions}
+			if err := writeFrame(conn, ack); err != nil {
+				return err
+			}
+		case frameHAProxyDisconnect:
+			return a.disconnect(conn, statusNormal, "")
+		default:
+			return a.disconnect(conn, statusInvalidFrame, fmt.Sprintf("unexpected frame type %d", f.typ))
+		}
+	}
+}
+
+func (a *Agent) disconnect(w io.Writer, status uint32, msg string) error {
+	var payload []byte
+	payload = appendString(payload, "status-code")
+	payload = appendData(payload, status)
+	payload = appendString(payload, "message")
+	payload = appendData(payload, msg)
+	if err := writeFrame(w, &frame{typ: frameAgentDisconnect, flags: flagFin, payload: payload}); err != nil {
+		return err
+	}
+	if status != statusNormal {
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// process evaluates a message and appends the resulting actions,
+// unknown messages are ignored
+func (a *Agent) process(actions []byte, msg message) ([]byte, error) {
+	switch msg.name {
+	case a.RequestMessage:
+		return a.processRequest(actions, msg.args)
+	case a.ResponseMessage:
+		return a.processResponse(actions, msg.args)
+	}
+	return actions, nil
+}
+
+func (a *Agent) processRequest(actions []byte, args map[string]interface{}) ([]byte, error) {
+	id := argString(args["id"])
+	var tx types.Transaction
+	if id != "" {
+		tx = a.waf.NewTransactionWithID(id)
+	} else {
+		tx = a.waf.NewTransaction()
+	}
+	tx.ProcessConnection(argString(args["src-ip"]), argInt(args["src-port"]), argString(args["dst-ip"]), argInt(args["dst-port"]))
+	uri := argString(args["path"])
+	if q := argString(args["query"]); q != "" {
+		uri += "?" + q
+	}
+	tx.ProcessURI(uri, argString(args["method"]), "HTTP/"+argString(args["version"]))
+	forEachHeader(argString(args["headers"]), tx.AddRequestHeader)
+
+	it := tx.ProcessRequestHeaders()
+	var err error
+	if body := argString(args["body"]); it == nil && body != "" && tx.IsRequestBodyAccessible() {
+		it, _, err = tx.WriteRequestBody([]byte(body))
+	}
+	if it == nil && err == nil {
+		it, err = tx.ProcessRequestBody()
+	}
+	// interrupted requests never reach the response events
+	if err != nil || it != nil || id == "" {
+		finish(tx)
+	} else {
+		a.store(id, tx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return appendResult(actions, tx, it), nil
+}
+
+func (a *Agent) processResponse(actions []byte, args map[string]interface{}) ([]byte, error) {
+	tx := a.load(argString(args["id"]))
+	if tx == nil {
+		return actions, nil
+	}
+	defer finish(tx)
+	forEachHeader(argString(args["headers"]), tx.AddResponseHeader)
+	it := tx.ProcessResponseHeaders(argInt(args["status"]), "HTTP/"+argString(args["version"]))
+	if it == nil && tx.IsResponseBodyAccessible() && tx.IsResponseBodyProcessable() {
+		if body := argString(args["body"]); body != "" {
+			if _, err := tx.ResponseBodyWriter().Write([]byte(body)); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		if it, err = tx.ProcessResponseBody(); err != nil {
+			return nil, err
+		}
+	}
+	return appendResult(actions, tx, it), nil
+}
+
+// appendResult sets the variables HAProxy ACLs use to enforce the result,
+// with the SPOE var-prefix coraza they are txn.coraza.action, status,
+// data, rule_id and matched_rules
+func appendResult(actions []byte, tx types.Transaction, it *types.Interruption) []byte {
+	action, status, data, ruleID := "allow", 0, "", 0
+	if it != nil {
+		action, status, data, ruleID = it.Action, it.Status, it.Data, it.RuleID
+		if status == 0 && action == types.InterruptionActionDeny {
+			status = 403
+		}
+	}
+	actions = appendSetVar(actions, "action", action)
+	actions = appendSetVar(actions, "status", status)
+	actions = appendSetVar(actions, "rule_id", ruleID)
+	actions = appendSetVar(actions, "matched_rules", len(tx.MatchedRules()))
+	if data != "" {
+		actions = appendSetVar(actions, "data", data)
+	}
+	return actions
+}
+
+func (a *Agent) store(id string, tx types.Transaction) {
+	now := time.Now()
+	// expired transactions are finished once the lock is released, the
+	// logging phase can be slow
+	var expired []types.Transaction
+	a.mu.Lock()
+	if now.Sub(a.lastSweep) > a.TransactionTTL {
+		a.lastSweep = now
+		for k, p := range a.pending {
+			if now.After(p.expires) {
+				delete(a.pending, k)
+				expired = append(expired, p.tx)
+			}
+		}
+	}
+	if p, ok := a.pending[id]; ok {
+		expired = append(expired, p.tx)
+	}
+	a.pending[id] = &pendingTransaction{tx: tx, expires: now.Add(a.TransactionTTL)}
+	a.mu.Unlock()
+	for _, tx := range expired {
+		finish(tx)
+	}
+}
+
+func (a *Agent) load(id string) types.Transaction {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	p, ok := a.pending[id]
+	if !ok {
+		return nil
+	}
+	delete(a.pending, id)
+	return p.tx
+}
+
+// finish runs the logging phase and releases the transaction
+func finish(tx types.Transaction) {
+	tx.ProcessLogging()
+	// Close only fails removing temporary files, the transaction is
+	// released anyway
+	_ = tx.Close()
+}
+
+func supportsVersion(versions string, version string) bool {
+	for _, v := range strings.Split(versions, ",") {
+		if strings.TrimSpace(v) == version {
+			return true
+		}
+	}
+	return false
+}
+
+// forEachHeader calls fn for each header of a raw header block as
+// returned by the req.hdrs and res.hdrs fetches
+func forEachHeader(raw string, fn func(key string, value string)) {
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || key == "" {
+			continue
+		}
+		fn(key, strings.TrimSpace(value))
+	}
+}
+
+func argString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case net.IP:
+		return v.String()
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	}
+	return ""
+}
+
+func argInt(v interface{}) int {
+	switch v := v.(type) {
+	case int64:
+		return int(v)
+	case uint64:
+		return int(v)
+	case string:
+		i, _ := strconv.Atoi(v)
+		return i
+	}
+	return 0
+}
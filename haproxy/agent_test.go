@@ -0,0 +1,251 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package haproxy
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/corazawaf/coraza/v3"
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+func TestVarintRoundTrip(t *testing.T) {
+	for _, v := range []uint64{0, 1, 239, 240, 2287, 2288, 264431, 264432, 1<<32 - 1, 1<<64 - 1} {
+		b := appendVarint(nil, v)
+		got, n, err := decodeVarint(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != v || n != len(b) {
+			t.Errorf("expected %d in %d bytes, got %d in %d", v, len(b), got, n)
+		}
+	}
+	if _, _, err := decodeVarint([]byte{0xf0}); err != errTruncated {
+		t.Errorf("expected truncated error, got %v", err)
+	}
+}
+
+// client plays the HAProxy side of a connection
+type client struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func newClient(t *testing.T, directives string) *client {
+	t.Helper()
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(`
+		SecRuleEngine On
+		SecRequestBodyAccess On
+	` + directives))
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := NewAgent(waf)
+	conn, agentConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- agent.ServeConn(agentConn)
+	}()
+	c := &client{t: t, conn: conn}
+	t.Cleanup(func() {
+		c.send(&frame{typ: frameHAProxyDisconnect, flags: flagFin})
+		if f := c.receive(); f.typ != frameAgentDisconnect {
+			t.Errorf("expected AGENT-DISCONNECT, got %d", f.typ)
+		}
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		conn.Close()
+	})
+	return c
+}
+
+func (c *client) send(f *frame) {
+	c.t.Helper()
+	if err := writeFrame(c.conn, f); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) receive() *frame {
+	c.t.Helper()
+	f, err := readFrame(c.conn, 1<<20)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return f
+}
+
+func (c *client) hello() map[string]interface{} {
+	c.t.Helper()
+	var payload []byte
+	payload = appendString(payload, "supported-versions")
+	payload = appendData(payload, "2.0")
+	payload = appendString(payload, "max-frame-size")
+	payload = appendData(payload, uint32(8192))
+	payload = appendString(payload, "capabilities")
+	payload = appendData(payload, "pipelining")
+	c.send(&frame{typ: frameHAProxyHello, flags: flagFin, payload: payload})
+	f := c.receive()
+	if f.typ != frameAgentHello {
+		c.t.Fatalf("expected AGENT-HELLO, got %d", f.typ)
+	}
+	kv, err := decodeKVList(f.payload)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return kv
+}
+
+// notify sends a single message and returns the variables set in the ACK
+func (c *client) notify(streamID uint64, name string, args ...string) map[string]interface{} {
+	c.t.Helper()
+	payload := appendString(nil, name)
+	payload = append(payload, byte(len(args)/2))
+	for i := 0; i < len(args); i += 2 {
+		payload = appendString(payload, args[i])
+		payload = appendData(payload, args[i+1])
+	}
+	c.send(&frame{typ: frameNotify, flags: flagFin, streamID: streamID, frameID: 1, payload: payload})
+	f := c.receive()
+	if f.typ != frameAck || f.streamID != streamID || f.frameID != 1 {
+		c.t.Fatalf("unexpected ACK %+v", f)
+	}
+	vars := map[string]interface{}{}
+	b := f.payload
+	for len(b) > 0 {
+		if b[0] != actionSetVar || b[1] != 3 || b[2] != scopeTransaction {
+			c.t.Fatalf("unexpected action %v", b[:3])
+		}
+		b = b[3:]
+		name, n, err := decodeBytes(b)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		b = b[n:]
+		v, n, err := decodeData(b)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		b = b[n:]
+		vars[string(name)] = v
+	}
+	return vars
+}
+
+func TestAgentHello(t *testing.T) {
+	c := newClient(t, "")
+	kv := c.hello()
+	if kv["version"] != "2.0" || kv["max-frame-size"] != uint64(8192) {
+		t.Errorf("unexpected AGENT-HELLO %v", kv)
+	}
+}
+
+func TestAgentUnsupportedVersion(t *testing.T) {
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, agentConn := net.Pipe()
+	defer conn.Close()
+	done := make(chan error, 1)
+	go func() {
+		done <- NewAgent(waf).ServeConn(agentConn)
+	}()
+	payload := appendString(nil, "supported-versions")
+	payload = appendData(payload, "1.0")
+	if err := writeFrame(conn, &frame{typ: frameHAProxyHello, flags: flagFin, payload: payload}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := readFrame(conn, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv, err := decodeKVList(f.payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.typ != frameAgentDisconnect || kv["status-code"] != uint64(statusUnsupportedVersion) {
+		t.Errorf("expected unsupported version, got %d %v", f.typ, kv)
+	}
+	if err := <-done; err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestAgentRequest(t *testing.T) {
+	c := newClient(t, `SecRule ARGS:q "@contains attack" "id:1,phase:1,deny,status:406"
+		SecRule REQUEST_HEADERS:User-Agent "@streq scanner" "id:2,phase:1,redirect:https://example.com/"
+		SecRule ARGS_POST:pass "@streq secret" "id:3,phase:2,drop"`)
+	c.hello()
+	request := []string{"id", "1", "src-ip", "10.0.0.1", "method", "GET", "path", "/", "version", "1.1"}
+
+	vars := c.notify(1, DefaultRequestMessage, append(request, "query", "q=attack")...)
+	if vars["action"] != "deny" || vars["status"] != int64(406) || vars["rule_id"] != int64(1) {
+		t.Errorf("expected deny, got %v", vars)
+	}
+	vars = c.notify(2, DefaultRequestMessage, append(request, "headers", "Host: example.com\r\nUser-Agent: scanner\r\n")...)
+	if vars["action"] != "redirect" || vars["data"] != "https://example.com/" {
+		t.Errorf("expected redirect, got %v", vars)
+	}
+	vars = c.notify(3, DefaultRequestMessage, append(request,
+		"headers", "Content-Type: application/x-www-form-urlencoded\r\n", "body", "pass=secret")...)
+	if vars["action"] != "drop" {
+		t.Errorf("expected drop, got %v", vars)
+	}
+	vars = c.notify(4, DefaultRequestMessage, request...)
+	if vars["action"] != "allow" || vars["rule_id"] != int64(0) {
+		t.Errorf("expected allow, got %v", vars)
+	}
+}
+
+func TestAgentResponse(t *testing.T) {
+	c := newClient(t, `SecRule RESPONSE_STATUS "@eq 500" "id:1,phase:3,deny"`)
+	c.hello()
+	c.notify(1, DefaultRequestMessage, "id", "a", "method", "GET", "path", "/", "version", "1.1")
+	vars := c.notify(2, DefaultResponseMessage, "id", "a", "version", "1.1", "status", "500")
+	if vars["action"] != "deny" || vars["status"] != int64(403) || vars["matched_rules"] != int64(1) {
+		t.Errorf("expected deny, got %v", vars)
+	}
+	// the transaction is released after the response
+	if vars := c.notify(3, DefaultResponseMessage, "id", "a", "status", "500"); len(vars) != 0 {
+		t.Errorf("expected no variables, got %v", vars)
+	}
+}
+
+// lockingTransaction uses the agent while it is finished
+type lockingTransaction struct {
+	types.Transaction
+	agent    *Agent
+	finished bool
+}
+
+func (tx *lockingTransaction) ProcessLogging() {
+	tx.agent.load("other")
+	tx.finished = true
+}
+
+func (tx *lockingTransaction) Close() error {
+	return nil
+}
+
+func TestAgentStoreFinishesUnlocked(t *testing.T) {
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAgent(waf)
+	a.TransactionTTL = time.Nanosecond
+	replaced := &lockingTransaction{agent: a}
+	a.store("a", replaced)
+	expired := &lockingTransaction{agent: a}
+	a.store("b", expired)
+	time.Sleep(time.Millisecond)
+	a.store("a", &lockingTransaction{agent: a})
+	if !replaced.finished || !expired.finished {
+		t.Error("expected the replaced and expired transactions to be finished")
+	}
+}
@@ -0,0 +1,302 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package haproxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// SPOP version 2.0, see doc/SPOE.txt in the HAProxy sources
+
+type frameType byte
+
+const (
+	frameHAProxyHello      frameType = 1
+	frameHAProxyDisconnect frameType = 2
+	frameNotify            frameType = 3
+	frameAgentHello        frameType = 101
+	frameAgentDisconnect   frameType = 102
+	frameAck               frameType = 103
+)
+
+// flagFin marks the last fragment of a frame, fragmentation is not
+// negotiated so every frame sent by the agent is complete
+const flagFin uint32 = 1
+
+type dataType byte
+
+const (
+	typeNull   dataType = 0
+	typeBool   dataType = 1
+	typeInt32  dataType = 2
+	typeUint32 dataType = 3
+	typeInt64  dataType = 4
+	typeUint64 dataType = 5
+	typeIPv4   dataType = 6
+	typeIPv6   dataType = 7
+	typeString dataType = 8
+	typeBinary dataType = 9
+
+	// flagTrue is set in the type byte of true booleans
+	flagTrue = 0x10
+)
+
+// Variable scopes of the set-var and unset-var actions
+const (
+	scopeProcess byte = iota
+	scopeSession
+	scopeTransaction
+	scopeRequest
+	scopeResponse
+)
+
+const (
+	actionSetVar byte = 1
+)
+
+// disconnect status codes
+const (
+	statusNormal             = 0
+	statusIOError            = 1
+	statusFrameTooBig        = 3
+	statusInvalidFrame       = 4
+	statusUnsupportedVersion = 8
+)
+
+var errTruncated = errors.New("truncated data")
+
+type frame struct {
+	typ      frameType
+	flags    uint32
+	streamID uint64
+	frameID  uint64
+	payload  []byte
+}
+
+// errFrameTooBig is returned by readFrame for frames exceeding the
+// negotiated size
+var errFrameTooBig = errors.New("frame is too big")
+
+func readFrame(r io.Reader, maxSize uint32) (*frame, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(hdr[:])
+	if size > maxSize {
+		return nil, errFrameTooBig
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	if len(buf) < 5 {
+		return nil, errTruncated
+	}
+	f := &frame{
+		typ:   frameType(buf[0]),
+		flags: binary.BigEndian.Uint32(buf[1:5]),
+	}
+	rest := buf[5:]
+	var n int
+	var err error
+	if f.streamID, n, err = decodeVarint(rest); err != nil {
+		return nil, err
+	}
+	rest = rest[n:]
+	if f.frameID, n, err = decodeVarint(rest); err != nil {
+		return nil, err
+	}
+	f.payload = rest[n:]
+	return f, nil
+}
+
+func writeFrame(w io.Writer, f *frame) error {
+	buf := make([]byte, 4, 4+5+20+len(f.payload))
+	buf = append(buf, byte(f.typ), byte(f.flags>>24), byte(f.flags>>16), byte(f.flags>>8), byte(f.flags))
+	buf = appendVarint(buf, f.streamID)
+	buf = appendVarint(buf, f.frameID)
+	buf = append(buf, f.payload...)
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+	_, err := w.Write(buf)
+	return err
+}
+
+// appendVarint encodes integers with the SPOP variable length encoding,
+// values below 240 use a single byte
+func appendVarint(b []byte, v uint64) []byte {
+	if v < 240 {
+		return append(b, byte(v))
+	}
+	b = append(b, byte(v)|240)
+	v = (v - 240) >> 4
+	for v >= 128 {
+		b = append(b, byte(v)|128)
+		v = (v - 128) >> 7
+	}
+	return append(b, byte(v))
+}
+
+func decodeVarint(b []byte) (uint64, int, error) {
+	if len(b) == 0 {
+		return 0, 0, errTruncated
+	}
+	v := uint64(b[0])
+	if v < 240 {
+		return v, 1, nil
+	}
+	shift := uint(4)
+	for i := 1; i < len(b) && i < 10; i++ {
+		v += uint64(b[i]) << shift
+		if b[i] < 128 {
+			return v, i + 1, nil
+		}
+		shift += 7
+	}
+	return 0, 0, errTruncated
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendVarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func decodeBytes(b []byte) ([]byte, int, error) {
+	l, n, err := decodeVarint(b)
+	if err != nil {
+		return nil, 0, err
+	}
+	if uint64(len(b)-n) < l {
+		return nil, 0, errTruncated
+	}
+	return b[n : n+int(l)], n + int(l), nil
+}
+
+// appendData encodes a typed value, only the types sent by the agent
+// are supported
+func appendData(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, byte(typeNull))
+	case bool:
+		if v {
+			return append(b, byte(typeBool)|flagTrue)
+		}
+		return append(b, byte(typeBool))
+	case int:
+		return appendVarint(append(b, byte(typeInt64)), uint64(v))
+	case string:
+		return appendString(append(b, byte(typeString)), v)
+	case uint32:
+		return appendVarint(append(b, byte(typeUint32)), uint64(v))
+	}
+	panic(fmt.Sprintf("unsupported SPOP data type %T", v))
+}
+
+// decodeData decodes a typed value, integers are returned as int64 or
+// uint64, addresses as net.IP and binaries as []byte
+func decodeData(b []byte) (interface{}, int, error) {
+	if len(b) == 0 {
+		return nil, 0, errTruncated
+	}
+	t := dataType(b[0] & 0x0f)
+	rest := b[1:]
+	switch t {
+	case typeNull:
+		return nil, 1, nil
+	case typeBool:
+		return b[0]&flagTrue != 0, 1, nil
+	case typeInt32, typeInt64:
+		v, n, err := decodeVarint(rest)
+		return int64(v), n + 1, err
+	case typeUint32, typeUint64:
+		v, n, err := decodeVarint(rest)
+		return v, n + 1, err
+	case typeIPv4, typeIPv6:
+		l := net.IPv4len
+		if t == typeIPv6 {
+			l = net.IPv6len
+		}
+		if len(rest) < l {
+			return nil, 0, errTruncated
+		}
+		return net.IP(append([]byte(nil), rest[:l]...)), l + 1, nil
+	case typeString:
+		v, n, err := decodeBytes(rest)
+		return string(v), n + 1, err
+	case typeBinary:
+		v, n, err := decodeBytes(rest)
+		return v, n + 1, err
+	}
+	return nil, 0, fmt.Errorf("unknown data type %d", t)
+}
+
+// decodeKVList decodes name and value pairs until the end of b
+func decodeKVList(b []byte) (map[string]interface{}, error) {
+	kv := map[string]interface{}{}
+	for len(b) > 0 {
+		name, n, err := decodeBytes(b)
+		if err != nil {
+			return nil, err
+		}
+		b = b[n:]
+		v, n, err := decodeData(b)
+		if err != nil {
+			return nil, err
+		}
+		b = b[n:]
+		kv[string(name)] = v
+	}
+	return kv, nil
+}
+
+// message is a SPOE message from a NOTIFY frame
+type message struct {
+	name string
+	args map[string]interface{}
+}
+
+// decodeMessages decodes the messages of a NOTIFY frame
+func decodeMessages(b []byte) ([]message, error) {
+	var msgs []message
+	for len(b) > 0 {
+		name, n, err := decodeBytes(b)
+		if err != nil {
+			return nil, err
+		}
+		b = b[n:]
+		if len(b) == 0 {
+			return nil, errTruncated
+		}
+		nbArgs := int(b[0])
+		b = b[1:]
+		msg := message{name: string(name), args: make(map[string]interface{}, nbArgs)}
+		for i := 0; i < nbArgs; i++ {
+			key, n, err := decodeBytes(b)
+			if err != nil {
+				return nil, err
+			}
+			b = b[n:]
+			v, n, err := decodeData(b)
+			if err != nil {
+				return nil, err
+			}
+			b = b[n:]
+			msg.args[string(key)] = v
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// appendSetVar encodes a set-var action in the transaction scope
+func appendSetVar(b []byte, name string, v interface{}) []byte {
+	b = append(b, actionSetVar, 3, scopeTransaction)
+	b = appendString(b, name)
+	return appendData(b, v)
+}
@@ -69,6 +69,21 @@ func (i *rwInterceptor) Header() http.Header {
 
 var _ http.ResponseWriter = (*rwInterceptor)(nil)
 
+// ApplyResponseHeaderMutations applies the header mutations requested by
+// the rules to h in order
+func ApplyResponseHeaderMutations(h http.Header, mutations []types.HeaderMutation) {
+	for _, m := range mutations {
+		switch m.Action {
+		case types.HeaderMutationSet:
+			h.Set(m.Name, m.Value)
+		case types.HeaderMutationAdd:
+			h.Add(m.Name, m.Value)
+		case types.HeaderMutationRemove:
+			h.Del(m.Name)
+		}
+	}
+}
+
 // wrap wraps the interceptor into a response writer that also preserves
 // the http interfaces implemented by the original response writer to avoid
 // the observer effect. It also returns the response processor which takes care
@@ -82,13 +97,20 @@ func wrap(w http.ResponseWriter, r *http.Request, tx types.Transaction) (
 
 	i := &rwInterceptor{w: w, tx: tx, proto: r.Proto}
 
+	// writeHeader applies the header mutations scheduled by the rules
+	// right before sending the response headers
+	writeHeader := func(tx types.Transaction, statusCode int) {
+		PauseTransaction(r.Context(), tx)
+		ApplyResponseHeaderMutations(w.Header(), tx.ResponseHeaderMutations())
+		w.WriteHeader(statusCode)
+	}
+
 	responseProcessor := func(tx types.Transaction, r *http.Request) error {
 		// We look for interruptions determined at phase 4 (response headers)
 		// as body hasn't being analized yet.
 		if tx.IsInterrupted() {
 			// phase 4 interruption stops execution
-			w.WriteHeader(i.statusCode)
-			return nil
+			return writeInterruptionResponse(r.Context(), w, tx, i.statusCode)
 		}
 
 		if tx.IsResponseBodyAccessible() && tx.IsResponseBodyProcessable() {
@@ -96,8 +118,7 @@ func wrap(w http.ResponseWriter, r *http.Request, tx types.Transaction) (
 				w.WriteHeader(http.StatusInternalServerError)
 				return err
 			} else if it != nil {
-				w.WriteHeader(obtainStatusCodeFromInterruptionOrDefault(it, i.statusCode))
-				return nil
+				return writeInterruptionResponse(r.Context(), w, tx, obtainStatusCodeFromInterruptionOrDefault(it, i.statusCode))
 			}
 
 			// we release the buffer
@@ -110,13 +131,13 @@ func wrap(w http.ResponseWriter, r *http.Request, tx types.Transaction) (
 			// this is the last opportunity we have to report the resolved status code
 			// as next step is write into the response writer (triggering a 200 in the
 			// response status code.)
-			i.w.WriteHeader(i.statusCode)
+			writeHeader(tx, i.statusCode)
 			if _, err := io.Copy(w, reader); err != nil {
 				i.w.WriteHeader(http.StatusInternalServerError)
 				return fmt.Errorf("failed to copy the response body: %v", err)
 			}
 		} else {
-			i.w.WriteHeader(i.statusCode)
+			writeHeader(tx, i.statusCode)
 		}
 
 		return nil
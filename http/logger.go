@@ -9,9 +9,13 @@ package http
 
 import "log"
 
+// Logger receives the errors of the middleware
 type Logger func(msg string, args ...interface{})
 
 var (
+	// NoopLogger discards the errors
 	NoopLogger = func(msg string, args ...interface{}) {}
-	StdLogger  = log.Printf
+	// StdLogger writes the errors with the standard logger of the log
+	// package, which prints to stderr unless its output is changed
+	StdLogger = log.Printf
 )
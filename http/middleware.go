@@ -8,22 +8,30 @@
 package http
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/corazawaf/coraza/v3"
 	"github.com/corazawaf/coraza/v3/types"
 )
 
-// processRequest fills all transaction variables from an http.Request object
+// errUnverifiedCertificate is the verification result of the client
+// certificates accepted without verifying their chain
+var errUnverifiedCertificate = errors.New("certificate not verified")
+
+// ProcessRequest fills all transaction variables from an http.Request object
 // Most implementations of Coraza will probably use http.Request objects
-// so this will implement all phase 0, 1 and 2 variables
+// so this will implement all phase 0, 1 and 2 variables, it is shared by
+// the middlewares of the net/http based frameworks.
 // Note: This function will stop after an interruption
 // Note: Do not manually fill any request variables
-func processRequest(tx types.Transaction, req *http.Request) (*types.Interruption, error) {
+func ProcessRequest(tx types.Transaction, req *http.Request) (*types.Interruption, error) {
 	var (
 		client string
 		cport  int
@@ -36,8 +44,19 @@ func processRequest(tx types.Transaction, req *http.Request) (*types.Interruptio
 	}
 
 	var in *types.Interruption
+	// the server already read the request headers, the body timing is
+	// measured from the call of the handler
+	tx.SetRequestStartTime(time.Now())
 	// There is no socket access in the request object, so we neither know the server client nor port.
 	tx.ProcessConnection(client, cport, "", 0)
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		// the chains are only verified if the server requires it
+		var verifyErr error
+		if len(req.TLS.VerifiedChains) == 0 {
+			verifyErr = errUnverifiedCertificate
+		}
+		tx.SetClientCertificate(req.TLS.PeerCertificates[0], verifyErr)
+	}
 	tx.ProcessURI(req.URL.String(), req.Method, req.Proto)
 	for k, vr := range req.Header {
 		for _, v := range vr {
@@ -59,7 +78,7 @@ func processRequest(tx types.Transaction, req *http.Request) (*types.Interruptio
 		// body inspection, otherwise we just let the request follow its
 		// regular flow.
 		if req.Body != nil && req.Body != http.NoBody {
-			it, _, err := tx.ReadRequestBodyFrom(req.Body)
+			it, _, err := tx.ReadRequestBodyFrom(bodyChunkNotifier{Reader: req.Body, tx: tx})
 			if err != nil {
 				return nil, fmt.Errorf("failed to append request body: %s", err.Error())
 			}
@@ -100,6 +119,21 @@ func processRequest(tx types.Transaction, req *http.Request) (*types.Interruptio
 	return tx.ProcessRequestBody()
 }
 
+// bodyChunkNotifier notifies the transaction of every read of the request
+// body, they are the body chunks timed by REQUEST_BODY_CHUNK_INTERVAL
+type bodyChunkNotifier struct {
+	io.Reader
+	tx types.Transaction
+}
+
+func (r bodyChunkNotifier) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.tx.NotifyBodyChunk(n, time.Now())
+	}
+	return n, err
+}
+
 func WrapHandler(waf coraza.WAF, l Logger, h http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		tx := waf.NewTransaction()
@@ -123,11 +157,13 @@ func WrapHandler(waf coraza.WAF, l Logger, h http.Handler) http.Handler {
 		// ProcessRequest is just a wrapper around ProcessConnection, ProcessURI,
 		// ProcessRequestHeaders and ProcessRequestBody.
 		// It fails if any of these functions returns an error and it stops on interruption.
-		if it, err := processRequest(tx, r); err != nil {
+		if it, err := ProcessRequest(tx, r); err != nil {
 			l("failed to process request: %v", err)
 			return
 		} else if it != nil {
-			w.WriteHeader(obtainStatusCodeFromInterruptionOrDefault(it, http.StatusOK))
+			if err := writeInterruptionResponse(r.Context(), w, tx, obtainStatusCodeFromInterruptionOrDefault(it, http.StatusOK)); err != nil {
+				l("failed to write the interruption response: %v", err)
+			}
 			return
 		}
 
@@ -145,17 +181,96 @@ func WrapHandler(waf coraza.WAF, l Logger, h http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// WrapHandlerGroup wraps the handler with the WAF registered in the group
+// for the request host, requests for hosts without a WAF are served by h
+// without inspection.
+func WrapHandlerGroup(g *coraza.WAFGroup, l Logger, h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		waf, ok := g.ForHost(r.Host)
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		WrapHandler(waf, l, h).ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
 // obtainStatusCodeFromInterruptionOrDefault returns the desired status code derived from the interruption
-// on a "deny" action or a default value.
+// on a "deny" or "redirect" action or a default value.
 func obtainStatusCodeFromInterruptionOrDefault(it *types.Interruption, defaultStatusCode int) int {
-	if it.Action == "deny" {
+	switch it.Action {
+	case types.InterruptionActionDeny:
 		statusCode := it.Status
 		if statusCode == 0 {
 			statusCode = 503
 		}
 
+		return statusCode
+	case types.InterruptionActionRedirect:
+		statusCode := it.Status
+		if statusCode == 0 {
+			statusCode = http.StatusFound
+		}
+
 		return statusCode
 	}
 
 	return defaultStatusCode
 }
+
+// writeInterruptionResponse sends the status code and, if the rule defined
+// one, the response body of an interrupted transaction
+func writeInterruptionResponse(ctx context.Context, w http.ResponseWriter, tx types.Transaction, statusCode int) error {
+	PauseTransaction(ctx, tx)
+	it := tx.Interruption()
+	if it.IsDrop() {
+		dropConnection(w)
+		return nil
+	}
+	h := w.Header()
+	ApplyResponseHeaderMutations(h, tx.ResponseHeaderMutations())
+	if it != nil && it.Action == types.InterruptionActionRedirect {
+		h.Set("Location", it.Data)
+	}
+	if it == nil || it.Body == "" {
+		w.WriteHeader(statusCode)
+		return nil
+	}
+	h.Set("Content-Type", it.ContentType)
+	// the upstream handler may have set the length of its own body
+	h.Del("Content-Length")
+	w.WriteHeader(statusCode)
+	_, err := io.WriteString(w, it.Body)
+	return err
+}
+
+// dropConnection closes the client connection without sending a response
+func dropConnection(w http.ResponseWriter) {
+	if h, ok := w.(http.Hijacker); ok {
+		if conn, _, err := h.Hijack(); err == nil {
+			_ = conn.Close()
+			return
+		}
+	}
+	// HTTP/2 and writers that cannot be hijacked abort the handler instead,
+	// the server resets the stream or closes the connection.
+	panic(http.ErrAbortHandler)
+}
+
+// PauseTransaction waits for the delay requested by the pause action,
+// it returns early if ctx is canceled. It is used by the integrations
+// of other frameworks too.
+func PauseTransaction(ctx context.Context, tx types.Transaction) {
+	d := tx.PauseDuration()
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
@@ -10,8 +10,12 @@ package http
 import (
 	"bufio"
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
@@ -19,6 +23,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/corazawaf/coraza/v3"
 	"github.com/corazawaf/coraza/v3/internal/corazawaf"
@@ -32,7 +37,7 @@ func TestProcessRequest(t *testing.T) {
 	req, _ := http.NewRequest("POST", "https://www.coraza.io/test", strings.NewReader("test=456"))
 	waf := corazawaf.NewWAF()
 	tx := waf.NewTransaction()
-	if _, err := processRequest(tx, req); err != nil {
+	if _, err := ProcessRequest(tx, req); err != nil {
 		t.Fatal(err)
 	}
 	if tx.Variables().RequestMethod().String() != "POST" {
@@ -43,12 +48,62 @@ func TestProcessRequest(t *testing.T) {
 	}
 }
 
+func TestProcessRequestBodyTiming(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	if err := seclang.NewParser(waf).FromString(`
+		SecRequestBodyAccess On
+		SecRule REQUEST_BODY_CHUNKS "@eq 2" "id:1,phase:2,pass,log,chain"
+			SecRule REQUEST_BODY_CHUNK_SIZE "@eq 8" ""
+	`); err != nil {
+		t.Fatal(err)
+	}
+	// the body arrives in two reads
+	body := io.MultiReader(strings.NewReader("test=456"), strings.NewReader("&a=12345"))
+	req, _ := http.NewRequest("POST", "https://www.coraza.io/test", body)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	tx := waf.NewTransaction()
+	defer tx.Close()
+	if _, err := ProcessRequest(tx, req); err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.MatchedRules()) != 1 {
+		t.Errorf("expected the body chunks to be notified, got %d matched rules", len(tx.MatchedRules()))
+	}
+}
+
+func TestProcessRequestClientCertificate(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "client"}}
+	for _, tt := range []struct {
+		verified bool
+		want     string
+	}{
+		{true, "SUCCESS"},
+		{false, "FAILED:certificate not verified"},
+	} {
+		req, _ := http.NewRequest("GET", "https://www.coraza.io/test", nil)
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		if tt.verified {
+			req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+		}
+		tx := corazawaf.NewWAF().NewTransaction()
+		if _, err := ProcessRequest(tx, req); err != nil {
+			t.Fatal(err)
+		}
+		if have := tx.Variables().SSLClientVerify().String(); have != tt.want {
+			t.Errorf("want SSL_CLIENT_VERIFY %q, have %q", tt.want, have)
+		}
+		if tx.Variables().SSLClientSDNCN().String() != "client" {
+			t.Error("failed to set the client certificate")
+		}
+	}
+}
+
 func TestProcessRequestEngineOff(t *testing.T) {
 	req, _ := http.NewRequest("POST", "https://www.coraza.io/test", strings.NewReader("test=456"))
 	waf := corazawaf.NewWAF()
 	waf.RuleEngine = types.RuleEngineOff
 	tx := waf.NewTransaction()
-	if _, err := processRequest(tx, req); err != nil {
+	if _, err := ProcessRequest(tx, req); err != nil {
 		t.Fatal(err)
 	}
 	if tx.Variables().RequestMethod().String() != "POST" {
@@ -68,7 +123,7 @@ func TestProcessRequestMultipart(t *testing.T) {
 
 	req := createMultipartRequest(t)
 
-	if _, err := processRequest(tx, req); err != nil {
+	if _, err := ProcessRequest(tx, req); err != nil {
 		t.Fatal(err)
 	}
 
@@ -161,7 +216,7 @@ func TestDirectiveSecAuditLog(t *testing.T) {
 		t.Errorf("Description HTTP request parsing failed")
 	}
 
-	_, err = processRequest(tx, req)
+	_, err = ProcessRequest(tx, req)
 	if err != nil {
 		t.Errorf("Failed to load the HTTP request")
 	}
@@ -194,18 +249,23 @@ func errLogger(t *testing.T) func(rule types.MatchedRule) {
 }
 
 type debugLogger struct {
-	t *testing.T
+	t      *testing.T
+	fields []loggers.Field
 }
 
-func (l *debugLogger) Info(message string, args ...interface{}) { l.t.Logf(message, args...) }
+func (l *debugLogger) log(message string, args ...interface{}) {
+	l.t.Logf(message+" %v", append(args, l.fields)...)
+}
 
-func (l *debugLogger) Warn(message string, args ...interface{}) { l.t.Logf(message, args...) }
+func (l *debugLogger) Info(message string, args ...interface{}) { l.log(message, args...) }
 
-func (l *debugLogger) Error(message string, args ...interface{}) { l.t.Logf(message, args...) }
+func (l *debugLogger) Warn(message string, args ...interface{}) { l.log(message, args...) }
 
-func (l *debugLogger) Debug(message string, args ...interface{}) { l.t.Logf(message, args...) }
+func (l *debugLogger) Error(message string, args ...interface{}) { l.log(message, args...) }
 
-func (l *debugLogger) Trace(message string, args ...interface{}) { l.t.Logf(message, args...) }
+func (l *debugLogger) Debug(message string, args ...interface{}) { l.log(message, args...) }
+
+func (l *debugLogger) Trace(message string, args ...interface{}) { l.log(message, args...) }
 
 func (l *debugLogger) SetLevel(level loggers.LogLevel) {
 	l.t.Logf("Setting level to %q", level.String())
@@ -215,17 +275,22 @@ func (l *debugLogger) SetOutput(w io.WriteCloser) {
 	l.t.Log("ignoring SecDebugLog directive, debug logs are always routed to proxy logs")
 }
 
+func (l *debugLogger) With(fields ...loggers.Field) loggers.DebugLogger {
+	return &debugLogger{t: l.t, fields: append(append([]loggers.Field{}, l.fields...), fields...)}
+}
+
 type httpTest struct {
-	http2            bool
-	reqURI           string
-	reqBody          string
-	echoReqBody      bool
-	reqBodyLimit     int
-	respHeaders      map[string]string
-	respBody         string
-	expectedProto    string
-	expectedStatus   int
-	expectedRespBody string
+	http2               bool
+	reqURI              string
+	reqBody             string
+	echoReqBody         bool
+	reqBodyLimit        int
+	respHeaders         map[string]string
+	respBody            string
+	expectedProto       string
+	expectedStatus      int
+	expectedRespBody    string
+	expectedRespHeaders map[string]string
 }
 
 func TestHttpServer(t *testing.T) {
@@ -282,6 +347,41 @@ func TestHttpServer(t *testing.T) {
 			expectedStatus:   403,
 			expectedRespBody: "", // blocking at response body phase means returning it empty
 		},
+		"args blocking with response body": {
+			reqURI:           "/hello?page=block",
+			expectedProto:    "HTTP/1.1",
+			expectedStatus:   403,
+			expectedRespBody: "blocked by rule 2",
+			expectedRespHeaders: map[string]string{
+				"content-type": "text/plain",
+			},
+		},
+		"args redirect with response body": {
+			reqURI:           "/hello?page=moved",
+			expectedProto:    "HTTP/1.1",
+			expectedStatus:   302,
+			expectedRespBody: "moved by rule 3",
+			expectedRespHeaders: map[string]string{
+				"location":     "https://example.com/moved",
+				"content-type": "text/plain",
+			},
+		},
+		"response body blocking with response body": {
+			reqURI:           "/hello",
+			respBody:         "secret=xxxx",
+			expectedProto:    "HTTP/1.1",
+			expectedStatus:   403,
+			expectedRespBody: "blocked by rule 201",
+		},
+		"response headers mutation": {
+			reqURI:         "/headers",
+			expectedProto:  "HTTP/1.1",
+			expectedStatus: 201,
+			expectedRespHeaders: map[string]string{
+				"coraza-middleware": "",
+				"x-frame-options":   "DENY",
+			},
+		},
 	}
 
 	// Perform tests
@@ -295,9 +395,13 @@ func TestHttpServer(t *testing.T) {
 	SecResponseBodyAccess On
 	SecResponseBodyMimeType text/plain
 	SecRule ARGS:id "@eq 0" "id:1, phase:1,deny, status:403,msg:'Invalid id',log,auditlog"
+	SecRule ARGS:page "@streq block" "id:2, phase:1,deny, status:403,responseContentType:text/plain,responseBody:'blocked by rule %{rule.id}'"
+	SecRule ARGS:page "@streq moved" "id:3, phase:1,redirect:https://example.com/moved,responseContentType:text/plain,responseBody:'moved by rule %{rule.id}'"
 	SecRule REQUEST_BODY "@contains eval" "id:100, phase:2,deny, status:403,msg:'Invalid request body',log,auditlog"
 	SecRule RESPONSE_HEADERS:Foo "@pm bar" "id:199,phase:3,deny,t:lowercase,deny, status:401,msg:'Invalid response header',log,auditlog"
 	SecRule RESPONSE_BODY "@contains password" "id:200, phase:4,deny, status:403,msg:'Invalid response body',log,auditlog"
+	SecRule RESPONSE_BODY "@contains secret" "id:201, phase:4,deny, status:403,responseBody:'blocked by rule %{rule.id}'"
+	SecRule REQUEST_URI "@beginsWith /headers" "id:300,phase:3,pass,nolog,header:'remove:Coraza-Middleware',header:'set:X-Frame-Options=DENY'"
 `).WithErrorCallback(errLogger(t)).WithDebugLogger(&debugLogger{t: t})
 			if l := tCase.reqBodyLimit; l > 0 {
 				conf = conf.WithRequestBodyAccess(coraza.NewRequestBodyConfig().WithLimit(l).WithInMemoryLimit(l))
@@ -354,6 +458,192 @@ func TestHttpServerWithRuleEngineOff(t *testing.T) {
 	}
 }
 
+func TestHttpServerDrop(t *testing.T) {
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().
+		WithDirectives(`
+	SecRuleEngine On
+	SecRule ARGS:id "@eq 0" "id:1, phase:1,drop,log"
+	SecRule RESPONSE_HEADERS:Foo "@streq bar" "id:2, phase:3,drop,log"
+	`).WithErrorCallback(errLogger(t)).WithDebugLogger(&debugLogger{t: t}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, http2 := range map[string]bool{"HTTP/1.1": false, "HTTP/2": true} {
+		t.Run(name, func(t *testing.T) {
+			ts := httptest.NewUnstartedServer(WrapHandler(waf, t.Logf, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Foo", req.URL.Query().Get("foo"))
+				w.WriteHeader(201)
+			})))
+			ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+			if http2 {
+				ts.EnableHTTP2 = true
+				ts.StartTLS()
+			} else {
+				ts.Start()
+			}
+			defer ts.Close()
+
+			for _, uri := range []string{"/hello?id=0", "/hello?foo=bar"} {
+				res, err := ts.Client().Get(ts.URL + uri)
+				if err == nil {
+					_ = res.Body.Close()
+					t.Errorf("expected the connection to be dropped for %s, got status %d", uri, res.StatusCode)
+				}
+			}
+
+			res, err := ts.Client().Get(ts.URL + "/hello")
+			if err != nil {
+				t.Fatalf("unexpected error when performing the request: %v", err)
+			}
+			_ = res.Body.Close()
+			if want, have := 201, res.StatusCode; want != have {
+				t.Errorf("unexpected status code, want: %d, have: %d", want, have)
+			}
+		})
+	}
+}
+
+func TestHttpServerPause(t *testing.T) {
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().
+		WithDirectives(`
+	SecRuleEngine On
+	SecRule ARGS:id "@eq 1" "id:1, phase:1,pause:100,log"
+	SecRule ARGS:id "@eq 2" "id:2, phase:3,pause:100,log"
+	`).WithErrorCallback(errLogger(t)).WithDebugLogger(&debugLogger{t: t}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		reqURI         string
+		expectedStatus int
+		expectPause    bool
+	}{
+		"no pause":          {reqURI: "/hello?id=0", expectedStatus: 201},
+		"pause":             {reqURI: "/hello?id=1", expectedStatus: 201, expectPause: true},
+		"pause on response": {reqURI: "/hello?id=2", expectedStatus: 201, expectPause: true},
+	}
+	for name, tCase := range tests {
+		t.Run(name, func(t *testing.T) {
+			ts := httptest.NewServer(WrapHandler(waf, t.Logf, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(201)
+			})))
+			defer ts.Close()
+
+			start := time.Now()
+			res, err := ts.Client().Get(ts.URL + tCase.reqURI)
+			if err != nil {
+				t.Fatalf("unexpected error when performing the request: %v", err)
+			}
+			_ = res.Body.Close()
+			if want, have := tCase.expectedStatus, res.StatusCode; want != have {
+				t.Errorf("unexpected status code, want: %d, have: %d", want, have)
+			}
+			if paused := time.Since(start) >= 100*time.Millisecond; paused != tCase.expectPause {
+				t.Errorf("unexpected pause, want: %t, have: %t", tCase.expectPause, paused)
+			}
+		})
+	}
+}
+
+func TestHttpServerWAFGroup(t *testing.T) {
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().
+		WithDirectives(`SecRule REQUEST_URI "@beginsWith /admin" "id:1,phase:1,deny,status:403,log"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := coraza.NewWAFGroup()
+	g.Add("protected.example.com", waf)
+
+	ts := httptest.NewServer(WrapHandlerGroup(g, t.Logf, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(201)
+	})))
+	defer ts.Close()
+
+	for host, expectedStatus := range map[string]int{
+		"protected.example.com": 403,
+		"public.example.com":    201,
+	} {
+		req, _ := http.NewRequest("GET", ts.URL+"/admin", nil)
+		req.Host = host
+		res, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error when performing the request: %v", err)
+		}
+		_ = res.Body.Close()
+		if want, have := expectedStatus, res.StatusCode; want != have {
+			t.Errorf("unexpected status code for %s, want: %d, have: %d", host, want, have)
+		}
+	}
+}
+
+// serveRewrittenHTML serves body as an html document declaring its
+// Content-Length and returns the body received by the client
+func serveRewrittenHTML(t *testing.T, directives string, body string) string {
+	t.Helper()
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(directives))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(WrapHandler(waf, t.Logf, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, _ = w.Write([]byte(body))
+	})))
+	defer ts.Close()
+
+	res, err := ts.Client().Get(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("unexpected error when performing the request: %v", err)
+	}
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("unexpected error when reading the response body: %v", err)
+	}
+	if want, have := int64(len(resBody)), res.ContentLength; want != have {
+		t.Errorf("unexpected Content-Length, want: %d, have: %d", want, have)
+	}
+	return string(resBody)
+}
+
+func TestHttpServerSignedLinksContentLength(t *testing.T) {
+	body := serveRewrittenHTML(t, `
+	SecResponseBodyAccess On
+	SecHashEngine On
+	SecHashKey "my_key" KeyOnly
+	SecHashMethodRx HashHref "product"
+	`, `<html><body><a href="/product?id=1">product</a></body></html>`)
+	if !strings.Contains(body, `href="/product?id=1&amp;hmac=`) {
+		t.Errorf("expected the link to be signed, got %q", body)
+	}
+}
+
+func TestHttpServerHoneypotsContentLength(t *testing.T) {
+	body := serveRewrittenHTML(t, `
+	SecResponseBodyAccess On
+	SecContentInjection On
+	SecHoneypotField website
+	SecHoneypotPath /trap
+	`, `<html><body><form method="post" action="/login"></form></body></html>`)
+	if !strings.Contains(body, `name="website"`) || !strings.Contains(body, `href="/trap"`) {
+		t.Errorf("expected the honeypots to be injected, got %q", body)
+	}
+}
+
+func TestHttpServerStreamOutputBodyContentLength(t *testing.T) {
+	body := serveRewrittenHTML(t, `
+	SecRuleEngine On
+	SecResponseBodyAccess On
+	SecStreamOutBodyInspection On
+	SecRule STREAM_OUTPUT_BODY "@rsub s/secret/[redacted]/" "id:1,phase:4,pass,log,t:none"
+	`, `<html><body>the secret</body></html>`)
+	if want, have := `<html><body>the [redacted]</body></html>`, body; want != have {
+		t.Errorf("unexpected response body, want: %q, have %q", want, have)
+	}
+}
+
 func runAgainstWAF(t *testing.T, tCase httpTest, waf coraza.WAF) {
 	t.Helper()
 	serverErrC := make(chan error, 1)
@@ -400,7 +690,12 @@ func runAgainstWAF(t *testing.T, tCase httpTest, waf coraza.WAF) {
 	req, _ := http.NewRequest("POST", ts.URL+tCase.reqURI, reqBody)
 	// TODO(jcchavezs): Fix it once the discussion in https://github.com/corazawaf/coraza/issues/438 is settled
 	req.Header.Add("content-type", "application/x-www-form-urlencoded")
-	res, err := ts.Client().Do(req)
+	client := ts.Client()
+	// redirects are checked in the response
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	res, err := client.Do(req)
 	if err != nil {
 		t.Fatalf("unexpected error when performing the request: %v", err)
 	}
@@ -409,6 +704,12 @@ func runAgainstWAF(t *testing.T, tCase httpTest, waf coraza.WAF) {
 		t.Errorf("unexpected status code, want: %d, have: %d", want, have)
 	}
 
+	for k, want := range tCase.expectedRespHeaders {
+		if have := res.Header.Get(k); want != have {
+			t.Errorf("unexpected response header %q, want: %q, have: %q", k, want, have)
+		}
+	}
+
 	resBody, err := io.ReadAll(res.Body)
 	if err != nil {
 		t.Fatalf("unexpected error when reading the response body: %v", err)
@@ -447,6 +748,15 @@ func TestObtainStatusCodeFromInterruptionOrDefault(t *testing.T) {
 			interruptionCode:   202,
 			expectedCode:       202,
 		},
+		"action redirect with no code": {
+			interruptionAction: "redirect",
+			expectedCode:       302,
+		},
+		"action redirect with code": {
+			interruptionAction: "redirect",
+			interruptionCode:   301,
+			expectedCode:       301,
+		},
 		"default code": {
 			defaultCode:  204,
 			expectedCode: 204,
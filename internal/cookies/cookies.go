@@ -0,0 +1,151 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package cookies parses request Cookie headers for both the Netscape
+// (version 0, RFC 6265) and the RFC 2965 (version 1) formats.
+package cookies
+
+import (
+	"errors"
+	"strings"
+
+	urlutil "github.com/corazawaf/coraza/v3/internal/url"
+)
+
+var (
+	// ErrEmptyName is returned for cookies like =value
+	ErrEmptyName = errors.New("empty cookie name")
+	// ErrInvalidName is returned for cookie names with control characters,
+	// whitespace or separators
+	ErrInvalidName = errors.New("invalid character in cookie name")
+	// ErrUnterminatedQuote is returned for quoted values without the closing quote
+	ErrUnterminatedQuote = errors.New("unterminated quoted cookie value")
+)
+
+// DefaultV0Separators are the separators of version 0 cookies
+const DefaultV0Separators = ";"
+
+// Options configures the cookie parser
+type Options struct {
+	// Version is the expected cookie format, 0 or 1. Version 0 headers
+	// starting with a $Version attribute are parsed as version 1.
+	Version int
+
+	// V0Separators contains the characters separating version 0 cookies,
+	// DefaultV0Separators is used if empty
+	V0Separators string
+}
+
+// Cookie is a request cookie, names and values are url decoded
+type Cookie struct {
+	Name  string
+	Value string
+}
+
+// Parse returns the cookies of a Cookie header in order, duplicate names
+// are preserved. Malformed cookies are returned as well, as they are still
+// interesting for inspection, the error describes the first problem found.
+func Parse(header string, opts Options) ([]Cookie, error) {
+	separators := opts.V0Separators
+	if separators == "" {
+		separators = DefaultV0Separators
+	}
+	v1 := opts.Version == 1 || strings.HasPrefix(strings.TrimLeft(header, " \t"), "$Version")
+	if v1 {
+		separators = ";,"
+	}
+
+	var (
+		res      []Cookie
+		firstErr error
+	)
+	setErr := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	for header != "" {
+		var pair string
+		pair, header = nextPair(header, separators, v1)
+		pair = strings.Trim(pair, " \t")
+		if pair == "" {
+			continue
+		}
+		name, value, hasValue := strings.Cut(pair, "=")
+		name = strings.TrimRight(name, " \t")
+		value = strings.TrimLeft(value, " \t")
+		if v1 && strings.HasPrefix(name, "$") {
+			// $Version, $Path, $Domain and $Port are attributes of the cookies
+			continue
+		}
+		switch {
+		case name == "" && hasValue:
+			setErr(ErrEmptyName)
+		case !validName(name):
+			setErr(ErrInvalidName)
+		}
+		if len(value) > 0 && value[0] == '"' {
+			unquoted, ok := unquote(value, v1)
+			if !ok {
+				setErr(ErrUnterminatedQuote)
+			} else {
+				value = unquoted
+			}
+		}
+		res = append(res, Cookie{
+			Name:  urlutil.QueryUnescape(name),
+			Value: urlutil.QueryUnescape(value),
+		})
+	}
+	return res, firstErr
+}
+
+// nextPair returns the next name=value pair and the rest of the header,
+// separators within quoted values are ignored for version 1 cookies
+func nextPair(header string, separators string, v1 bool) (string, string) {
+	quoted := false
+	for i := 0; i < len(header); i++ {
+		c := header[i]
+		switch {
+		case v1 && c == '"':
+			quoted = !quoted
+		case v1 && quoted && c == '\\':
+			i++
+		case !quoted && strings.IndexByte(separators, c) != -1:
+			return header[:i], header[i+1:]
+		}
+	}
+	return header, ""
+}
+
+// unquote removes the quotes of a value, version 1 values can also
+// contain escaped characters
+func unquote(value string, v1 bool) (string, bool) {
+	if len(value) < 2 || value[len(value)-1] != '"' {
+		return value, false
+	}
+	value = value[1 : len(value)-1]
+	if !v1 || !strings.Contains(value, "\\") {
+		return value, true
+	}
+	var sb strings.Builder
+	sb.Grow(len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		sb.WriteByte(value[i])
+	}
+	return sb.String(), true
+}
+
+// validName returns true if name is an RFC 6265 token
+func validName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte("()<>@,;:\\\"/[]?={}", c) != -1 {
+			return false
+		}
+	}
+	return true
+}
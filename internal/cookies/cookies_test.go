@@ -0,0 +1,108 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cookies
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		opts    Options
+		cookies []Cookie
+		err     error
+	}{
+		{
+			name:    "simple",
+			header:  "a=1; b=2",
+			cookies: []Cookie{{"a", "1"}, {"b", "2"}},
+		},
+		{
+			name:    "duplicates keep order",
+			header:  "a=1; b=2; a=3",
+			cookies: []Cookie{{"a", "1"}, {"b", "2"}, {"a", "3"}},
+		},
+		{
+			name:    "quoted value",
+			header:  `a="x y"; b=""`,
+			cookies: []Cookie{{"a", "x y"}, {"b", ""}},
+		},
+		{
+			name:    "url decoded",
+			header:  "a%20b=c%3Dd",
+			cookies: []Cookie{{"a b", "c=d"}},
+		},
+		{
+			name:    "no value",
+			header:  "flag; a=1",
+			cookies: []Cookie{{"flag", ""}, {"a", "1"}},
+		},
+		{
+			name:    "empty pairs",
+			header:  ";; a=1 ;",
+			cookies: []Cookie{{"a", "1"}},
+		},
+		{
+			name:    "empty name",
+			header:  "=evil; a=1",
+			cookies: []Cookie{{"", "evil"}, {"a", "1"}},
+			err:     ErrEmptyName,
+		},
+		{
+			name:    "invalid name",
+			header:  "a b=1",
+			cookies: []Cookie{{"a b", "1"}},
+			err:     ErrInvalidName,
+		},
+		{
+			name:    "unterminated quote",
+			header:  `a="abc; b=2`,
+			cookies: []Cookie{{"a", `"abc`}, {"b", "2"}},
+			err:     ErrUnterminatedQuote,
+		},
+		{
+			name:    "v0 ignores separators in quotes",
+			header:  `a="x;y"`,
+			cookies: []Cookie{{"a", `"x`}, {"y\"", ""}},
+			err:     ErrUnterminatedQuote,
+		},
+		{
+			name:    "v0 custom separators",
+			header:  "a=1, b=2; c=3",
+			opts:    Options{V0Separators: ";,"},
+			cookies: []Cookie{{"a", "1"}, {"b", "2"}, {"c", "3"}},
+		},
+		{
+			name:    "v1 attributes",
+			header:  `$Version="1"; a="1"; $Path="/"; b="2"; $Domain="example.com"`,
+			cookies: []Cookie{{"a", "1"}, {"b", "2"}},
+		},
+		{
+			name:    "v1 quoted separators and escapes",
+			header:  `a="x;y, \"z\""; b=2`,
+			opts:    Options{Version: 1},
+			cookies: []Cookie{{"a", `x;y, "z"`}, {"b", "2"}},
+		},
+		{
+			name:    "v1 comma separator",
+			header:  "a=1, b=2",
+			opts:    Options{Version: 1},
+			cookies: []Cookie{{"a", "1"}, {"b", "2"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cookies, err := Parse(tt.header, tt.opts)
+			if err != tt.err {
+				t.Errorf("expected error %v, got %v", tt.err, err)
+			}
+			if !reflect.DeepEqual(cookies, tt.cookies) {
+				t.Errorf("expected %q, got %q", tt.cookies, cookies)
+			}
+		})
+	}
+}
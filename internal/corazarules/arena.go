@@ -0,0 +1,121 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazarules
+
+import "github.com/corazawaf/coraza/v3/types"
+
+const (
+	// arenaSlabSize is the number of elements allocated at once
+	arenaSlabSize = 256
+	// arenaMaxSlabs is the number of slabs kept by Reset, the slabs of a
+	// transaction with more matches are released to the GC
+	arenaMaxSlabs = 16
+)
+
+// Arena allocates the MatchData, the MatchedRule, the match data slices and
+// the collection entries of a transaction by slabs, they are released
+// together with Reset and the slabs are reused by the next transaction.
+// The elements returned before Reset must not be used after it. A nil
+// Arena allocates every element on the heap.
+// Important: Arena is NOT concurrent safe
+type Arena struct {
+	matchData     slabs[MatchData]
+	matchedRules  slabs[MatchedRule]
+	matchDataRefs slabs[types.MatchData]
+	anchoredVars  slabs[types.AnchoredVar]
+}
+
+// NewMatchData returns a zeroed MatchData
+func (a *Arena) NewMatchData() *MatchData {
+	if a == nil {
+		return &MatchData{}
+	}
+	return &a.matchData.take(1)[0]
+}
+
+// NewMatchedRule returns a zeroed MatchedRule
+func (a *Arena) NewMatchedRule() *MatchedRule {
+	if a == nil {
+		return &MatchedRule{}
+	}
+	return &a.matchedRules.take(1)[0]
+}
+
+// MatchDataSlice returns an empty slice with room for n elements, the
+// elements appended beyond n are allocated on the heap
+func (a *Arena) MatchDataSlice(n int) []types.MatchData {
+	if a == nil {
+		return make([]types.MatchData, 0, n)
+	}
+	return a.matchDataRefs.take(n)[:0]
+}
+
+// AnchoredVars returns an empty slice with room for n collection entries,
+// the entries appended beyond n are allocated on the heap
+func (a *Arena) AnchoredVars(n int) []types.AnchoredVar {
+	if a == nil {
+		return make([]types.AnchoredVar, 0, n)
+	}
+	return a.anchoredVars.take(n)[:0]
+}
+
+// Reset releases every element of the arena
+func (a *Arena) Reset() {
+	if a == nil {
+		return
+	}
+	a.matchData.reset()
+	a.matchedRules.reset()
+	a.matchDataRefs.reset()
+	a.anchoredVars.reset()
+}
+
+// slabs is a list of fixed size slices, the elements never move so the
+// pointers to them stay valid until reset
+type slabs[T any] struct {
+	list [][]T
+	// cur is the index of the slab being filled and used the number of
+	// its elements in use
+	cur  int
+	used int
+}
+
+// take returns n consecutive elements, their capacity is n so appending
+// to them doesn't overwrite the next elements. Requests larger than a
+// slab are allocated on the heap.
+func (s *slabs[T]) take(n int) []T {
+	if n > arenaSlabSize {
+		return make([]T, n)
+	}
+	if len(s.list) == 0 || s.used+n > arenaSlabSize {
+		if len(s.list) > 0 {
+			s.cur++
+		}
+		s.used = 0
+		if s.cur == len(s.list) {
+			s.list = append(s.list, make([]T, arenaSlabSize))
+		}
+	}
+	e := s.list[s.cur][s.used : s.used+n : s.used+n]
+	s.used += n
+	return e
+}
+
+func (s *slabs[T]) reset() {
+	// the elements are zeroed so the slabs don't keep their strings
+	var zero T
+	for i := 0; i < len(s.list) && i <= s.cur; i++ {
+		used := arenaSlabSize
+		if i == s.cur {
+			used = s.used
+		}
+		for j := range s.list[i][:used] {
+			s.list[i][j] = zero
+		}
+	}
+	if len(s.list) > arenaMaxSlabs {
+		s.list = s.list[:arenaMaxSlabs]
+	}
+	s.cur, s.used = 0, 0
+}
@@ -13,14 +13,16 @@ type RuleMetadata struct {
 	Line_     int
 	Rev_      string
 	Severity_ types.RuleSeverity
-	Version_  string
-	Tags_     []string
-	Maturity_ int
-	Accuracy_ int
-	Operator_ string
-	Phase_    types.RulePhase
-	Raw_      string
-	SecMark_  string
+	// HasSeverity_ is false for rules without the severity action
+	HasSeverity_ bool
+	Version_     string
+	Tags_        []string
+	Maturity_    int
+	Accuracy_    int
+	Operator_    string
+	Phase_       types.RulePhase
+	Raw_         string
+	SecMark_     string
 }
 
 func (r *RuleMetadata) ID() int {
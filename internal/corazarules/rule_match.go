@@ -21,12 +21,20 @@ type MatchData struct {
 	Variable_ variables.RuleVariable
 	// Key of the variable, blank if no key is required
 	Key_ string
-	// Value of the current VARIABLE:KEY
+	// Value of the current VARIABLE:KEY, after the transformations for
+	// matched rules
 	Value_ string
+	// Value before the transformations
+	RawValue_ string
 	// Macro expanded message
 	Message_ string
 	// Macro expanded logdata
 	Data_ string
+	// Captures of the operator, index 0 is the full match
+	Captures_ []string
+	// ChainLevel_ is 0 for the chain starter, 1 for the first chained
+	// rule and so on
+	ChainLevel_ int
 }
 
 func (m *MatchData) VariableName() string {
@@ -45,6 +53,10 @@ func (m *MatchData) Value() string {
 	return m.Value_
 }
 
+func (m *MatchData) RawValue() string {
+	return m.RawValue_
+}
+
 func (m *MatchData) Message() string {
 	return m.Message_
 }
@@ -53,9 +65,18 @@ func (m *MatchData) Data() string {
 	return m.Data_
 }
 
+func (m *MatchData) Captures() []string {
+	return m.Captures_
+}
+
+func (m *MatchData) ChainLevel() int {
+	return m.ChainLevel_
+}
+
 // IsNil is used to check whether the MatchData is empty
 func (m MatchData) IsNil() bool {
-	return m == MatchData{}
+	return m.VariableName_ == "" && m.Variable_ == 0 && m.Key_ == "" && m.Value_ == "" &&
+		m.RawValue_ == "" && m.Message_ == "" && m.Data_ == "" && len(m.Captures_) == 0 && m.ChainLevel_ == 0
 }
 
 // MatchedRule contains a list of macro expanded messages,
@@ -77,6 +98,9 @@ type MatchedRule struct {
 	ClientIPAddress_ string
 	// A slice of matched variables
 	MatchedDatas_ []types.MatchData
+	// Chain_ contains the metadata of the chain starter followed by the
+	// chained rules
+	Chain_ []types.RuleMetadata
 
 	Rule_ types.RuleMetadata
 }
@@ -117,11 +141,32 @@ func (mr *MatchedRule) Rule() types.RuleMetadata {
 	return mr.Rule_
 }
 
+func (mr *MatchedRule) Chain() []types.RuleMetadata {
+	if len(mr.Chain_) == 0 && mr.Rule_ != nil {
+		return []types.RuleMetadata{mr.Rule_}
+	}
+	return mr.Chain_
+}
+
+func (mr *MatchedRule) ChainMatches(level int) []types.MatchData {
+	var res []types.MatchData
+	for _, md := range mr.MatchedDatas_ {
+		if md.ChainLevel() == level {
+			res = append(res, md)
+		}
+	}
+	return res
+}
+
 func (mr MatchedRule) details(matchData types.MatchData) string {
 	log := &strings.Builder{}
 
 	msg := matchData.Message()
 	data := matchData.Data()
+	if msg == "" && data == "" {
+		// the matches of the chained rules get the message of the rule
+		msg, data = mr.Message_, mr.Data_
+	}
 	if len(msg) > 200 {
 		msg = msg[:200]
 	}
@@ -180,12 +225,15 @@ func (mr MatchedRule) AuditLog(code int) string {
 
 // ErrorLog returns the same as audit log but without matchData
 func (mr MatchedRule) ErrorLog(code int) string {
-	msg := mr.MatchedDatas_[0].Message()
-	for _, md := range mr.MatchedDatas_ {
-		// Use 1st set message of rule chain as message
-		if md.Message() != "" {
-			msg = md.Message()
-			break
+	msg := mr.Message_
+	if msg == "" {
+		msg = mr.MatchedDatas_[0].Message()
+		for _, md := range mr.MatchedDatas_ {
+			// Use 1st set message of rule chain as message
+			if md.Message() != "" {
+				msg = md.Message()
+				break
+			}
 		}
 	}
 	if len(msg) > 200 {
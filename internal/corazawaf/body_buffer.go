@@ -5,6 +5,7 @@ package corazawaf
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"os"
 
@@ -13,13 +14,18 @@ import (
 )
 
 // BodyBuffer is used to read RequestBody and ResponseBody objects
-// It will handle memory usage for buffering and processing
+// It will handle memory usage for buffering and processing, once the
+// data exceeds the memory limit it is spooled to a temporary file only
+// readable by the current user, the file is removed on Reset.
 // It implements io.Copy(bodyBuffer, someReader) by inherit io.Writer
 type BodyBuffer struct {
 	options types.BodyBufferOptions
 	buffer  *bytes.Buffer
 	writer  *os.File
 	length  int64
+	// discarded is true if data beyond the memory limit was dropped, which
+	// only happens without filesystem access
+	discarded bool
 }
 
 var (
@@ -31,16 +37,8 @@ func (br *BodyBuffer) WriteTo(w io.Writer) (int64, error) {
 	if br.writer == nil {
 		return br.buffer.WriteTo(w)
 	}
-
-	b := make([]byte, br.length)
-
-	n, err := br.writer.Read(b)
-	if err != nil {
-		return 0, err
-	}
-
-	n, err = w.Write(b[:n])
-	return int64(n), err
+	// the file offset is at the end after writing, so we read it by position
+	return io.Copy(w, io.NewSectionReader(br.writer, 0, br.length))
 }
 
 // Write appends data to the body buffer by chunks
@@ -52,8 +50,9 @@ func (br *BodyBuffer) Write(data []byte) (n int, err error) {
 
 	l := int64(len(data)) + br.length
 	if l > br.options.MemoryLimit {
-		if environment.IsTinyGo {
+		if !environment.HasAccessToFS {
 			maxWritingDataLen := br.options.MemoryLimit - br.length
+			br.discarded = true
 			if maxWritingDataLen == 0 {
 				return 0, nil
 			}
@@ -81,32 +80,81 @@ func (br *BodyBuffer) Write(data []byte) (n int, err error) {
 }
 
 type bodyBufferReader struct {
-	pos int
+	pos int64
 	br  *BodyBuffer
 }
 
+var (
+	_ io.ReadSeeker = (*bodyBufferReader)(nil)
+	_ io.WriterTo   = (*bodyBufferReader)(nil)
+)
+
 func (b *bodyBufferReader) Read(p []byte) (n int, err error) {
-	if environment.IsTinyGo || b.br.writer == nil {
+	if !environment.HasAccessToFS || b.br.writer == nil {
 		buf := b.br.buffer.Bytes()
-		n = len(p)
-		if b.pos+n > len(buf) {
-			n = len(buf) - b.pos
-		}
-		if n == 0 {
+		if b.pos >= int64(len(buf)) {
 			return 0, io.EOF
 		}
-		copy(p, buf[b.pos:b.pos+n])
-		b.pos += n
+		n = copy(p, buf[b.pos:])
+		b.pos += int64(n)
 		return
 	}
 
-	n, err = b.br.writer.ReadAt(p, int64(b.pos))
-	b.pos += n
+	if b.pos >= b.br.length {
+		return 0, io.EOF
+	}
+	n, err = b.br.writer.ReadAt(p, b.pos)
+	b.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
 	return
 }
 
-// Reader Returns a working reader for the body buffer in memory or file
-func (br *BodyBuffer) Reader() (io.Reader, error) {
+// WriteTo writes the rest of the body to w without intermediate
+// buffers when the body is in memory
+func (b *bodyBufferReader) WriteTo(w io.Writer) (int64, error) {
+	if !environment.HasAccessToFS || b.br.writer == nil {
+		buf := b.br.buffer.Bytes()
+		if b.pos >= int64(len(buf)) {
+			return 0, nil
+		}
+		n, err := w.Write(buf[b.pos:])
+		b.pos += int64(n)
+		return int64(n), err
+	}
+	if b.pos >= b.br.length {
+		return 0, nil
+	}
+	n, err := io.Copy(w, io.NewSectionReader(b.br.writer, b.pos, b.br.length-b.pos))
+	b.pos += n
+	return n, err
+}
+
+// Seek sets the offset of the next Read, so body processors can
+// read the body more than once without copying it
+func (b *bodyBufferReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = b.pos + offset
+	case io.SeekEnd:
+		abs = b.br.length + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	b.pos = abs
+	return abs, nil
+}
+
+// Reader Returns a working reader for the body buffer in memory or file,
+// readers are independent and can be used concurrently with other readers
+func (br *BodyBuffer) Reader() (io.ReadSeeker, error) {
 	return &bodyBufferReader{
 		br: br,
 	}, nil
@@ -121,7 +169,8 @@ func (br *BodyBuffer) Size() int64 {
 func (br *BodyBuffer) Reset() error {
 	br.buffer.Reset()
 	br.length = 0
-	if !environment.IsTinyGo && br.writer != nil {
+	br.discarded = false
+	if environment.HasAccessToFS && br.writer != nil {
 		w := br.writer
 		br.writer = nil
 		if err := w.Close(); err != nil {
@@ -133,6 +182,14 @@ func (br *BodyBuffer) Reset() error {
 	return nil
 }
 
+// shrink drops the memory buffer if its capacity exceeds size, so a
+// pooled buffer doesn't keep the memory of a large body
+func (br *BodyBuffer) shrink(size int) {
+	if br.buffer.Cap() > size {
+		br.buffer = &bytes.Buffer{}
+	}
+}
+
 // NewBodyBuffer Initializes a body reader
 // After writing memLimit bytes to the memory buffer, data will be
 // written to a temporary file
@@ -1,8 +1,8 @@
 // Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
 // SPDX-License-Identifier: Apache-2.0
 
-//go:build tinygo
-// +build tinygo
+//go:build tinygo || coraza.no_fs_access
+// +build tinygo coraza.no_fs_access
 
 package corazawaf
 
@@ -36,7 +36,7 @@ func TestBodyReaderMemory(t *testing.T) {
 }
 
 func TestBodyReaderFile(t *testing.T) {
-	if environment.IsTinyGo {
+	if !environment.HasAccessToFS {
 		return // t.Skip doesn't work on TinyGo
 	}
 
@@ -92,3 +92,94 @@ func TestBodyReaderWriteFromReader(t *testing.T) {
 	}
 	_ = br.Reset()
 }
+
+func TestBodyBufferSpool(t *testing.T) {
+	if !environment.HasAccessToFS {
+		return // t.Skip doesn't work on TinyGo
+	}
+
+	br := NewBodyBuffer(types.BodyBufferOptions{
+		TmpPath:     t.TempDir(),
+		MemoryLimit: 4,
+	})
+	for _, chunk := range []string{"ab", "cd", "ef", "gh"} {
+		if _, err := br.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if br.writer == nil {
+		t.Fatal("expected the body to be spooled to disk")
+	}
+	if br.buffer.Len() != 0 {
+		t.Error("expected the memory buffer to be released")
+	}
+	info, err := os.Stat(br.writer.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		t.Errorf("temporary file must only be accessible by the owner, got %s", perm)
+	}
+
+	buf := new(strings.Builder)
+	if _, err := br.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "abcdefgh" {
+		t.Errorf("unexpected body %q", buf.String())
+	}
+
+	reader, err := br.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Seek(-3, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	tail, err := io.ReadAll(reader)
+	if err != nil || string(tail) != "fgh" {
+		t.Errorf("unexpected tail %q: %v", tail, err)
+	}
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	all, err := io.ReadAll(reader)
+	if err != nil || string(all) != "abcdefgh" {
+		t.Errorf("unexpected body %q: %v", all, err)
+	}
+	if _, err := reader.Seek(-1, io.SeekStart); err == nil {
+		t.Error("expected error for negative position")
+	}
+
+	name := br.writer.Name()
+	if err := br.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); err == nil {
+		t.Error("temporary file was not deleted")
+	}
+}
+
+func TestBodyBufferSeekMemory(t *testing.T) {
+	br := NewBodyBuffer(types.BodyBufferOptions{
+		TmpPath:     t.TempDir(),
+		MemoryLimit: 100,
+	})
+	if _, err := br.Write([]byte("abcdef")); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := br.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Seek(2, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Seek(1, io.SeekCurrent); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(reader)
+	if err != nil || string(rest) != "def" {
+		t.Errorf("unexpected data %q: %v", rest, err)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"io"
+	"sort"
+
+	"github.com/corazawaf/coraza/v3/internal/sync"
+	"github.com/corazawaf/coraza/v3/profiler"
+	"github.com/corazawaf/coraza/v3/ratelimit"
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+// NewCandidate returns a WAF sharing the configuration of w but without
+// rules, the candidate ruleset can then be loaded into it and attached
+// to w with SetCandidate. It must be called after w is configured.
+func (w *WAF) NewCandidate() *WAF {
+	c := *w
+	c.txPool = sync.NewPool(func() interface{} { return new(Transaction) })
+	c.Rules = NewRuleGroup()
+	c.candidate = nil
+	c.candidateDiffCb = nil
+	// shadow evaluations must not consume the rate limits of w
+	c.RateLimitStore = ratelimit.NewMemoryStore()
+	// nor count the connections twice
+	c.connections = nil
+	c.ruleStats = newRuleStats()
+	return &c
+}
+
+// SetCandidate attaches a candidate WAF, every transaction created by w
+// will also be evaluated against the candidate rules in shadow mode.
+// The candidate never interrupts the transaction and does not write
+// audit logs, instead, when the transaction is logged cb is called if the
+// candidate rules diverge from the active rules.
+func (w *WAF) SetCandidate(candidate *WAF, cb func(types.RuleSetDiff)) {
+	if candidate != nil {
+		candidate.AuditEngine = types.AuditEngineOff
+		candidate.ErrorLogCb = nil
+		candidate.ErrorEventCb = nil
+		// the transactions are already learned by w
+		if candidate.ProfileMode == profiler.Learn {
+			candidate.Profile = nil
+		}
+	}
+	w.candidate = candidate
+	w.candidateDiffCb = cb
+}
+
+// processShadowRequestBody copies the buffered request body to the
+// shadow transaction and evaluates it
+func (tx *Transaction) processShadowRequestBody() {
+	shadow := tx.shadow
+	if tx.requestBodyBuffer.length > 0 && shadow.requestBodyBuffer.length == 0 {
+		if r, err := tx.requestBodyBuffer.Reader(); err == nil {
+			if _, err := io.Copy(shadow.requestBodyBuffer, r); err != nil {
+				shadow.debugLogger.Error("failed to copy request body to the candidate transaction: %s", err.Error())
+			}
+		}
+	}
+	shadow.requestBodyTruncated = tx.requestBodyTruncated
+	shadow.requestBodyCutAtSeparator = tx.requestBodyCutAtSeparator
+	if _, err := shadow.ProcessRequestBody(); err != nil {
+		shadow.debugLogger.Error("failed to process the candidate request body: %s", err.Error())
+	}
+}
+
+// processShadowResponseBody copies the buffered response body to the
+// shadow transaction and evaluates it
+func (tx *Transaction) processShadowResponseBody() {
+	shadow := tx.shadow
+	if tx.ResponseBodyBuffer.length > 0 && shadow.ResponseBodyBuffer.length == 0 {
+		if r, err := tx.ResponseBodyBuffer.Reader(); err == nil {
+			if _, err := io.Copy(shadow.ResponseBodyBuffer, r); err != nil {
+				shadow.debugLogger.Error("failed to copy response body to the candidate transaction: %s", err.Error())
+			}
+		}
+	}
+	if _, err := shadow.ProcessResponseBody(); err != nil {
+		shadow.debugLogger.Error("failed to process the candidate response body: %s", err.Error())
+	}
+}
+
+// candidateDiff compares the rules matched by the transaction with
+// the ones matched by its shadow transaction
+func (tx *Transaction) candidateDiff() (types.RuleSetDiff, bool) {
+	diff := types.RuleSetDiff{
+		TransactionID:         tx.id,
+		ActiveInterruption:    tx.interruption,
+		CandidateInterruption: tx.shadow.interruption,
+	}
+	active := matchedRuleIDs(tx.matchedRules)
+	candidate := matchedRuleIDs(tx.shadow.matchedRules)
+	for _, id := range sortedKeys(active) {
+		if !candidate[id] {
+			diff.ActiveOnly = append(diff.ActiveOnly, id)
+		}
+	}
+	for _, id := range sortedKeys(candidate) {
+		if !active[id] {
+			diff.CandidateOnly = append(diff.CandidateOnly, id)
+		}
+	}
+	divergent := len(diff.ActiveOnly) > 0 || len(diff.CandidateOnly) > 0 ||
+		!sameInterruption(diff.ActiveInterruption, diff.CandidateInterruption)
+	return diff, divergent
+}
+
+func matchedRuleIDs(mrs []types.MatchedRule) map[int]bool {
+	ids := make(map[int]bool, len(mrs))
+	for _, mr := range mrs {
+		ids[mr.Rule().ID()] = true
+	}
+	return ids
+}
+
+func sortedKeys(m map[int]bool) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+func sameInterruption(a *types.Interruption, b *types.Interruption) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Action == b.Action && a.Status == b.Status && a.RuleID == b.RuleID
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/rules"
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/corazawaf/coraza/v3/types/variables"
+)
+
+type testOperator func(string) bool
+
+func (o testOperator) Evaluate(_ rules.TransactionState, value string) bool {
+	return o(value)
+}
+
+func newCandidateTestRule(t *testing.T, id int, phase types.RulePhase, v variables.RuleVariable, match string, disruptive bool) *Rule {
+	t.Helper()
+	r := NewRule()
+	r.ID_ = id
+	r.Phase_ = phase
+	if err := r.AddVariable(v, "", false); err != nil {
+		t.Fatal(err)
+	}
+	r.SetOperator(testOperator(func(value string) bool { return value == match }), "@streq", match)
+	if disruptive {
+		r.Disruptive = true
+		r.DisruptiveStatus = 403
+		if err := r.AddAction("deny", denyTestAction{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+type denyTestAction struct{}
+
+func (denyTestAction) Init(rules.RuleMetadata, string) error { return nil }
+
+func (denyTestAction) Evaluate(r rules.RuleMetadata, tx rules.TransactionState) {
+	tx.Interrupt(&types.Interruption{
+		Status: 403,
+		RuleID: r.ID(),
+		Action: types.InterruptionActionDeny,
+	})
+}
+
+func (denyTestAction) Type() rules.ActionType { return rules.ActionTypeDisruptive }
+
+func TestCandidateRules(t *testing.T) {
+	waf := NewWAF()
+	waf.RequestBodyAccess = true
+	if err := waf.Rules.Add(newCandidateTestRule(t, 1, types.PhaseRequestHeaders, variables.RequestURI, "/a?id=1", false)); err != nil {
+		t.Fatal(err)
+	}
+	candidate := waf.NewCandidate()
+	if err := candidate.Rules.Add(newCandidateTestRule(t, 2, types.PhaseRequestHeaders, variables.Args, "1", false)); err != nil {
+		t.Fatal(err)
+	}
+	if err := candidate.Rules.Add(newCandidateTestRule(t, 3, types.PhaseRequestBody, variables.RequestBody, "a=blocked", true)); err != nil {
+		t.Fatal(err)
+	}
+	var diffs []types.RuleSetDiff
+	waf.SetCandidate(candidate, func(diff types.RuleSetDiff) {
+		diffs = append(diffs, diff)
+	})
+
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/a?id=1", "POST", "HTTP/1.1")
+	tx.AddRequestHeader("Content-Type", "application/x-www-form-urlencoded")
+	if it := tx.ProcessRequestHeaders(); it != nil {
+		t.Fatalf("unexpected interruption %v", it)
+	}
+	if _, _, err := tx.WriteRequestBody([]byte("a=blocked")); err != nil {
+		t.Fatal(err)
+	}
+	if it, err := tx.ProcessRequestBody(); err != nil || it != nil {
+		t.Fatalf("candidate rules must not interrupt, got %v %v", it, err)
+	}
+	tx.ProcessLogging()
+	if err := tx.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diffs) != 1 {
+		t.Fatalf("expected 1 diff, got %d", len(diffs))
+	}
+	diff := diffs[0]
+	if !reflect.DeepEqual(diff.ActiveOnly, []int{1}) || !reflect.DeepEqual(diff.CandidateOnly, []int{2, 3}) {
+		t.Errorf("unexpected diff %+v", diff)
+	}
+	if diff.ActiveInterruption != nil || diff.CandidateInterruption == nil || diff.CandidateInterruption.RuleID != 3 {
+		t.Errorf("unexpected interruptions %+v", diff)
+	}
+
+	// equivalent rulesets don't report anything
+	diffs = nil
+	tx = waf.NewTransaction()
+	tx.ProcessURI("/b", "GET", "HTTP/1.1")
+	tx.ProcessRequestHeaders()
+	tx.ProcessLogging()
+	if len(diffs) != 0 {
+		t.Errorf("expected no diff, got %+v", diffs)
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"github.com/corazawaf/coraza/v3/internal/memoize"
+	"github.com/corazawaf/coraza/v3/internal/sync"
+)
+
+// CloneWithOverrides returns a child WAF sharing the rules and the
+// configuration of w. Rules can be added, removed or updated in the child
+// without affecting w, shared rules are copied before being modified.
+// The child must be configured before creating transactions.
+func (w *WAF) CloneWithOverrides() *WAF {
+	c := *w
+	c.txPool = sync.NewPool(func() interface{} { return new(Transaction) })
+	c.Rules = w.Rules.clone()
+	c.ruleStats = newRuleStats()
+	c.Memoizer = memoize.NewScope()
+	c.ResponseBodyMimeTypes = append([]string(nil), w.ResponseBodyMimeTypes...)
+	c.ComponentNames = append([]string(nil), w.ComponentNames...)
+	c.HashKey = append([]byte(nil), w.HashKey...)
+	c.HashMethods = append([]HashMethod(nil), w.HashMethods...)
+	c.SignedCookies = append([]string(nil), w.SignedCookies...)
+	c.CookieSignKey = append([]byte(nil), w.CookieSignKey...)
+	c.CSRFKey = append([]byte(nil), w.CSRFKey...)
+	c.CSRFExempt = append([]string(nil), w.CSRFExempt...)
+	c.HoneypotFields = append([]string(nil), w.HoneypotFields...)
+	c.HoneypotPaths = append([]string(nil), w.HoneypotPaths...)
+	if w.bodyProcessors != nil {
+		c.bodyProcessors = make(map[string]string, len(w.bodyProcessors))
+		for k, v := range w.bodyProcessors {
+			c.bodyProcessors[k] = v
+		}
+	}
+	if w.methodBodyProcessors != nil {
+		c.methodBodyProcessors = make(map[string]string, len(w.methodBodyProcessors))
+		for k, v := range w.methodBodyProcessors {
+			c.methodBodyProcessors[k] = v
+		}
+	}
+	return &c
+}
+
+// clone returns a RuleGroup sharing the rules of rg, shared rules
+// must be obtained with FindByIDForUpdate before being modified
+func (rg *RuleGroup) clone() RuleGroup {
+	c := RuleGroup{
+		rules:  append([]*Rule(nil), rg.rules...),
+		shared: make(map[*Rule]struct{}, len(rg.rules)),
+	}
+	for _, r := range rg.rules {
+		c.shared[r] = struct{}{}
+	}
+	return c
+}
+
+// FindByIDForUpdate returns the rule with the requested ID, if the rule
+// is shared with another RuleGroup it is copied first so it can be safely
+// modified
+func (rg *RuleGroup) FindByIDForUpdate(id int) *Rule {
+	for i, r := range rg.rules {
+		if r.ID_ != id {
+			continue
+		}
+		if _, ok := rg.shared[r]; ok {
+			delete(rg.shared, r)
+			r = r.clone()
+			rg.rules[i] = r
+			rg.plan = nil
+		}
+		return r
+	}
+	return nil
+}
+
+// clone returns a copy of the rule that can be modified without
+// affecting r, chained rules are still shared
+func (r *Rule) clone() *Rule {
+	c := *r
+	c.variables = make([]ruleVariableParams, len(r.variables))
+	for i, v := range r.variables {
+		v.Exceptions = append([]ruleVariableException(nil), v.Exceptions...)
+		c.variables[i] = v
+	}
+	c.transformations = append([]ruleTransformationParams(nil), r.transformations...)
+	c.actions = append([]ruleActionParams(nil), r.actions...)
+	return &c
+}
@@ -0,0 +1,255 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/corazawaf/coraza/v3/collection"
+	"github.com/corazawaf/coraza/v3/internal/corazarules"
+	"github.com/corazawaf/coraza/v3/transformations"
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/corazawaf/coraza/v3/types/variables"
+)
+
+// noSeverity is the value of HIGHEST_SEVERITY when no rule with
+// severity matched, like ModSecurity
+const noSeverity = "255"
+
+// computedVariable refreshes a variable computed on access, like
+// DURATION, TIME_* or PERF_*, so it is not calculated for every transaction
+func (tx *Transaction) computedVariable(v variables.RuleVariable) collection.Collection {
+	switch v {
+	case variables.HighestSeverity:
+		tx.variables.highestSeverity.Set(tx.highestSeverity())
+		return tx.variables.highestSeverity
+	case variables.Duration:
+		d := time.Since(time.Unix(0, tx.Timestamp))
+		tx.variables.duration.Set(strconv.FormatInt(d.Milliseconds(), 10))
+		return tx.variables.duration
+	case variables.PerfPhase1, variables.PerfPhase2, variables.PerfPhase3,
+		variables.PerfPhase4, variables.PerfPhase5, variables.PerfCombined:
+		stats := tx.PerfStats()
+		d := stats.Combined
+		if v != variables.PerfCombined {
+			d = stats.Phases[types.RulePhase(v-variables.PerfPhase1+1)]
+		}
+		col := tx.variables.perf[v-variables.PerfPhase1]
+		col.Set(strconv.FormatInt(d.Microseconds(), 10))
+		return col
+	case variables.PerfRules:
+		tx.variables.perfRules.Reset()
+		for id, d := range tx.PerfStats().Rules {
+			tx.variables.perfRules.Set(strconv.Itoa(id), []string{strconv.FormatInt(d.Microseconds(), 10)})
+		}
+		return tx.variables.perfRules
+	case variables.RequestHeadersRaw:
+		tx.variables.requestHeadersRaw.Set(string(tx.requestHeadersRaw))
+		return tx.variables.requestHeadersRaw
+	case variables.RequestBodyDuration:
+		tx.variables.requestBodyDuration.Set(strconv.FormatInt(tx.bodyTiming.duration().Milliseconds(), 10))
+		return tx.variables.requestBodyDuration
+	case variables.RequestBodyChunks:
+		tx.variables.requestBodyChunks.Set(strconv.Itoa(tx.bodyTiming.chunks))
+		return tx.variables.requestBodyChunks
+	case variables.RequestBodyChunkInterval:
+		tx.variables.requestBodyChunkInterval.Set(strconv.FormatInt(tx.bodyTiming.interval().Milliseconds(), 10))
+		return tx.variables.requestBodyChunkInterval
+	case variables.RequestBodyChunkSize:
+		tx.variables.requestBodyChunkSize.Set(strconv.FormatInt(tx.bodyTiming.chunkSize(), 10))
+		return tx.variables.requestBodyChunkSize
+	case variables.FullRequest:
+		tx.variables.fullRequest.Set(tx.buildFullRequest())
+		return tx.variables.fullRequest
+	case variables.FullRequestLength:
+		tx.variables.fullRequestLength.Set(strconv.FormatInt(tx.fullRequestLength(), 10))
+		return tx.variables.fullRequestLength
+	case variables.RequestURILowercase, variables.RequestFilenameDecoded, variables.RequestFilenameNormalized,
+		variables.PathNormalizationChanged:
+		n := tx.normalizeURI()
+		value := n.lowercaseURI
+		switch v {
+		case variables.RequestFilenameDecoded:
+			value = n.decodedFilename
+		case variables.RequestFilenameNormalized:
+			value = n.normalizedFilename
+		case variables.PathNormalizationChanged:
+			value = "0"
+			if n.normalizedFilename != n.decodedFilename {
+				value = "1"
+			}
+		}
+		col := tx.variables.uriNormalized[v-variables.RequestURILowercase]
+		col.Set(value)
+		return col
+	}
+
+	now := time.Now()
+	var value string
+	switch v {
+	case variables.Time:
+		value = now.Format("15:04:05")
+	case variables.TimeDay:
+		value = now.Format("02")
+	case variables.TimeEpoch:
+		value = strconv.FormatInt(now.Unix(), 10)
+	case variables.TimeHour:
+		value = now.Format("15")
+	case variables.TimeMin:
+		value = now.Format("04")
+	case variables.TimeMon:
+		value = strconv.Itoa(int(now.Month()) - 1)
+	case variables.TimeSec:
+		value = now.Format("05")
+	case variables.TimeWday:
+		value = strconv.Itoa(int(now.Weekday()))
+	case variables.TimeYear:
+		value = now.Format("2006")
+	default:
+		return nil
+	}
+	col := tx.variables.time[v-variables.Time]
+	col.Set(value)
+	return col
+}
+
+// uriNormalization contains the normalizations of REQUEST_URI and
+// REQUEST_FILENAME, they are computed again only if the URI changes
+type uriNormalization struct {
+	uri          string
+	lowercaseURI string
+
+	filename           string
+	decodedFilename    string
+	normalizedFilename string
+}
+
+// normalizePathWin computes REQUEST_FILENAME_NORMALIZED, the decoded
+// filename uses the urlDecodeUni transformation of the WAF
+var normalizePathWin, _ = transformations.GetTransformation("normalizePathWin")
+
+// normalizeURI returns the normalizations of the current request URI
+func (tx *Transaction) normalizeURI() *uriNormalization {
+	n := &tx.uriNormalization
+	if uri := tx.variables.requestURI.String(); uri != n.uri {
+		n.uri = uri
+		n.lowercaseURI = strings.ToLower(uri)
+	}
+	if filename := tx.variables.requestFilename.String(); filename != n.filename {
+		n.filename = filename
+		n.decodedFilename, _ = transformations.URLDecodeUni(tx.WAF.UnicodeMap)(filename)
+		n.normalizedFilename, _ = normalizePathWin(n.decodedFilename)
+	}
+	return n
+}
+
+// bodyTiming contains the arrival of the request body chunks
+type bodyTiming struct {
+	// start is set by SetRequestStartTime, it may be zero
+	start  time.Time
+	first  time.Time
+	last   time.Time
+	chunks int
+	size   int64
+}
+
+// duration returns the time between the start of the request, or the
+// first chunk, and the last chunk
+func (bt *bodyTiming) duration() time.Duration {
+	if bt.chunks == 0 {
+		return 0
+	}
+	start := bt.start
+	if start.IsZero() {
+		start = bt.first
+	}
+	if d := bt.last.Sub(start); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// interval returns the average time between two chunks
+func (bt *bodyTiming) interval() time.Duration {
+	if bt.chunks < 2 {
+		return 0
+	}
+	return bt.last.Sub(bt.first) / time.Duration(bt.chunks-1)
+}
+
+// chunkSize returns the average size of the chunks
+func (bt *bodyTiming) chunkSize() int64 {
+	if bt.chunks == 0 {
+		return 0
+	}
+	return bt.size / int64(bt.chunks)
+}
+
+// fullRequest is the last FULL_REQUEST built, it is valid while the
+// request line, the headers and the body are unchanged
+type fullRequest struct {
+	valid   bool
+	line    string
+	headers int
+	body    int64
+	value   string
+}
+
+// buildFullRequest returns the request line, the raw headers and the body
+// separated by new lines like ModSecurity
+func (tx *Transaction) buildFullRequest() string {
+	c := &tx.fullRequest
+	line := tx.variables.requestLine.String()
+	if c.valid && c.line == line && c.headers == len(tx.requestHeadersRaw) && c.body == tx.requestBodyBuffer.Size() {
+		return c.value
+	}
+	sb := strings.Builder{}
+	sb.Grow(int(tx.fullRequestLength()))
+	sb.WriteString(line)
+	sb.WriteByte('\n')
+	sb.Write(tx.requestHeadersRaw)
+	sb.WriteByte('\n')
+	// BodyBuffer.WriteTo drains the memory buffer, so we read the body
+	// through a reader to keep it available for the connector
+	if reader, err := tx.requestBodyBuffer.Reader(); err != nil {
+		tx.debugLogger.Error("Failed to read the request body for FULL_REQUEST: %s", err.Error())
+	} else if _, err := io.Copy(&sb, reader); err != nil {
+		tx.debugLogger.Error("Failed to read the request body for FULL_REQUEST: %s", err.Error())
+	}
+	*c = fullRequest{
+		valid:   true,
+		line:    line,
+		headers: len(tx.requestHeadersRaw),
+		body:    tx.requestBodyBuffer.Size(),
+		value:   sb.String(),
+	}
+	return c.value
+}
+
+// fullRequestLength returns the length of FULL_REQUEST without building it
+func (tx *Transaction) fullRequestLength() int64 {
+	return int64(len(tx.variables.requestLine.String())+len(tx.requestHeadersRaw)+2) + tx.requestBodyBuffer.Size()
+}
+
+// highestSeverity returns the most severe (lowest) severity of the
+// matched rules declaring a severity
+func (tx *Transaction) highestSeverity() string {
+	highest := -1
+	for _, mr := range tx.matchedRules {
+		r, ok := mr.Rule().(*corazarules.RuleMetadata)
+		if !ok || !r.HasSeverity_ {
+			continue
+		}
+		if s := r.Severity_.Int(); highest == -1 || s < highest {
+			highest = s
+		}
+	}
+	if highest == -1 {
+		return noSeverity
+	}
+	return strconv.Itoa(highest)
+}
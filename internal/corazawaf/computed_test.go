@@ -0,0 +1,240 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/corazawaf/coraza/v3/types/variables"
+)
+
+func TestComputedTimeVariables(t *testing.T) {
+	tx := NewWAF().NewTransaction()
+	before := time.Now()
+	values := map[variables.RuleVariable]string{}
+	for v := variables.Time; v <= variables.TimeYear; v++ {
+		values[v] = tx.Collection(v).FindAll()[0].Value()
+	}
+	if len(values[variables.Time]) != len("15:04:05") {
+		t.Errorf("unexpected TIME %q", values[variables.Time])
+	}
+	epoch, err := strconv.ParseInt(values[variables.TimeEpoch], 10, 64)
+	if err != nil || epoch < before.Unix() || epoch > time.Now().Unix() {
+		t.Errorf("unexpected TIME_EPOCH %q", values[variables.TimeEpoch])
+	}
+	if values[variables.TimeYear] != strconv.Itoa(before.Year()) {
+		t.Errorf("unexpected TIME_YEAR %q", values[variables.TimeYear])
+	}
+	if mon, _ := strconv.Atoi(values[variables.TimeMon]); mon != int(before.Month())-1 {
+		t.Errorf("unexpected TIME_MON %q", values[variables.TimeMon])
+	}
+	if wday, _ := strconv.Atoi(values[variables.TimeWday]); wday != int(before.Weekday()) {
+		t.Errorf("unexpected TIME_WDAY %q", values[variables.TimeWday])
+	}
+	for _, v := range []variables.RuleVariable{variables.TimeDay, variables.TimeHour, variables.TimeMin, variables.TimeSec} {
+		if len(values[v]) != 2 {
+			t.Errorf("expected two digits for %s, got %q", v.Name(), values[v])
+		}
+	}
+}
+
+func TestComputedDuration(t *testing.T) {
+	tx := NewWAF().NewTransaction()
+	tx.Timestamp = time.Now().Add(-1500 * time.Millisecond).UnixNano()
+	d, err := strconv.Atoi(tx.Collection(variables.Duration).FindAll()[0].Value())
+	if err != nil || d < 1500 || d > 60000 {
+		t.Errorf("unexpected DURATION %d", d)
+	}
+}
+
+func TestComputedHighestSeverity(t *testing.T) {
+	waf := NewWAF()
+	tx := waf.NewTransaction()
+	highest := func() string {
+		return tx.Collection(variables.HighestSeverity).FindAll()[0].Value()
+	}
+	if v := highest(); v != "255" {
+		t.Errorf("expected 255 without matches, got %q", v)
+	}
+	for _, s := range []struct {
+		severity    types.RuleSeverity
+		hasSeverity bool
+	}{{types.RuleSeverityWarning, true}, {0, false}, {types.RuleSeverityCritical, true}, {types.RuleSeverityNotice, true}} {
+		r := NewRule()
+		r.Severity_ = s.severity
+		r.HasSeverity_ = s.hasSeverity
+		tx.MatchRule(r, nil)
+	}
+	if v := highest(); v != "2" {
+		t.Errorf("expected critical severity, got %q", v)
+	}
+}
+
+func TestComputedPerfVariables(t *testing.T) {
+	waf := NewWAF()
+	waf.RulePerfTime = time.Nanosecond
+	r := NewRule()
+	r.ID_ = 1
+	r.Phase_ = types.PhaseRequestHeaders
+	if err := waf.Rules.Add(r); err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.ProcessRequestHeaders()
+	stats := tx.PerfStats()
+	if _, ok := stats.Phases[types.PhaseRequestHeaders]; !ok {
+		t.Error("expected phase 1 to be timed")
+	}
+	if d, ok := stats.Rules[1]; !ok || d <= 0 {
+		t.Errorf("expected rule 1 to be timed, got %v", stats.Rules)
+	}
+	if len(tx.Collection(variables.PerfRules).FindString("1")) != 1 {
+		t.Error("expected rule 1 in PERF_RULES")
+	}
+
+	tx.stopWatches[types.PhaseRequestHeaders] = int64(1500 * time.Microsecond)
+	tx.stopWatches[types.PhaseRequestBody] = int64(3 * time.Millisecond)
+	for v, expected := range map[variables.RuleVariable]string{
+		variables.PerfPhase1:   "1500",
+		variables.PerfPhase2:   "3000",
+		variables.PerfPhase3:   "0",
+		variables.PerfCombined: "4500",
+	} {
+		if got := tx.Collection(v).FindAll()[0].Value(); got != expected {
+			t.Errorf("expected %s for %s, got %q", expected, v.Name(), got)
+		}
+	}
+
+	waf.RulePerfTime = time.Hour
+	if rules := tx.PerfStats().Rules; len(rules) != 0 {
+		t.Errorf("expected no rule above the threshold, got %v", rules)
+	}
+}
+
+func TestComputedURINormalization(t *testing.T) {
+	tx := NewWAF().NewTransaction()
+	value := func(v variables.RuleVariable) string {
+		return tx.Collection(v).FindAll()[0].Value()
+	}
+	tx.ProcessURI("/Admin/%252e%252e/./x//Config.PHP%5c..%5cetc/?Id=1", "GET", "HTTP/1.1")
+	if v := value(variables.RequestURILowercase); v != "/admin/%252e%252e/./x//config.php%5c..%5cetc/?id=1" {
+		t.Errorf("unexpected REQUEST_URI_LOWERCASE %q", v)
+	}
+	if v := value(variables.RequestFilenameDecoded); v != "/Admin/.././x//Config.PHP\\..\\etc/" {
+		t.Errorf("unexpected REQUEST_FILENAME_DECODED %q", v)
+	}
+	if v := value(variables.RequestFilenameNormalized); v != "/x/etc/" {
+		t.Errorf("unexpected REQUEST_FILENAME_NORMALIZED %q", v)
+	}
+	if v := value(variables.PathNormalizationChanged); v != "1" {
+		t.Errorf("unexpected PATH_NORMALIZATION_CHANGED %q", v)
+	}
+	// the normalizations follow the URI
+	tx.ProcessURI("/a/c%c0%af%2e./d", "GET", "HTTP/1.1")
+	if v := value(variables.RequestFilenameNormalized); v != "/a/d" {
+		t.Errorf("unexpected REQUEST_FILENAME_NORMALIZED %q", v)
+	}
+	tx.ProcessURI("/a/c+d/", "GET", "HTTP/1.1")
+	if v := value(variables.PathNormalizationChanged); v != "0" {
+		t.Errorf("unexpected PATH_NORMALIZATION_CHANGED %q", v)
+	}
+}
+
+func TestComputedFullRequest(t *testing.T) {
+	waf := NewWAF()
+	waf.RequestBodyAccess = true
+	tx := waf.NewTransaction()
+	value := func(v variables.RuleVariable) string {
+		return tx.Collection(v).FindAll()[0].Value()
+	}
+	tx.ProcessURI("/login?a=1", "POST", "HTTP/1.1")
+	tx.AddRequestHeader("Host", "example.com")
+	tx.AddRequestHeader("Content-Type", "application/x-www-form-urlencoded")
+	tx.ProcessRequestHeaders()
+	head := value(variables.FullRequest)
+	if _, _, err := tx.WriteRequestBody([]byte("user=admin&pass=x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ProcessRequestBody(); err != nil {
+		t.Fatal(err)
+	}
+	full := value(variables.FullRequest)
+	if full != head+"user=admin&pass=x" {
+		t.Errorf("unexpected FULL_REQUEST %q", full)
+	}
+	if !strings.HasPrefix(full, "POST /login?a=1 HTTP/1.1\n") {
+		t.Errorf("expected the request line in FULL_REQUEST %q", full)
+	}
+	if v := value(variables.FullRequestLength); v != strconv.Itoa(len(full)) {
+		t.Errorf("unexpected FULL_REQUEST_LENGTH %q, expected %d", v, len(full))
+	}
+	if v := value(variables.RequestBodyLength); v != "17" {
+		t.Errorf("unexpected REQUEST_BODY_LENGTH %q", v)
+	}
+	// names and values of every argument
+	if v := value(variables.ArgsCombinedSize); v != strconv.Itoa(len("a1useradminpassx")) {
+		t.Errorf("unexpected ARGS_COMBINED_SIZE %q", v)
+	}
+}
+
+func TestComputedFullRequestKeepsBody(t *testing.T) {
+	waf := NewWAF()
+	waf.RequestBodyAccess = true
+	if err := waf.Rules.Add(newCandidateTestRule(t, 1, types.PhaseRequestBody, variables.FullRequest, "", false)); err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/", "POST", "HTTP/1.1")
+	tx.AddRequestHeader("Content-Type", "text/plain")
+	tx.ProcessRequestHeaders()
+	if _, _, err := tx.WriteRequestBody([]byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ProcessRequestBody(); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := tx.RequestBodyReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "hello world" {
+		t.Errorf("unexpected request body %q after FULL_REQUEST", body)
+	}
+}
+
+func TestComputedBodyTiming(t *testing.T) {
+	tx := NewWAF().NewTransaction()
+	value := func(v variables.RuleVariable) string {
+		return tx.Collection(v).FindAll()[0].Value()
+	}
+	if v := value(variables.RequestBodyChunkInterval); v != "0" {
+		t.Errorf("unexpected REQUEST_BODY_CHUNK_INTERVAL %q without chunks", v)
+	}
+	start := time.Unix(1700000000, 0)
+	tx.SetRequestStartTime(start)
+	// a slow body sending a few bytes every 10 seconds
+	for i := 1; i <= 4; i++ {
+		tx.NotifyBodyChunk(2, start.Add(time.Duration(i)*10*time.Second))
+	}
+	tests := map[variables.RuleVariable]string{
+		variables.RequestBodyDuration:      "40000",
+		variables.RequestBodyChunks:        "4",
+		variables.RequestBodyChunkInterval: "10000",
+		variables.RequestBodyChunkSize:     "2",
+	}
+	for v, want := range tests {
+		if have := value(v); have != want {
+			t.Errorf("unexpected %s %q, want %q", v.Name(), have, want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+// connectionsKeyPrefix keeps the connection rates apart from the
+// counters of the @rateLimit operator in the rate limit store
+const connectionsKeyPrefix = "conn:"
+
+// connectionTracker counts the transactions of every client address being
+// processed. The WAF doesn't see the connections of the server, a keep
+// alive connection processing no request is not counted.
+// It is concurrent safe and shared by the clones of a WAF.
+type connectionTracker struct {
+	mu     sync.Mutex
+	active map[string]int
+}
+
+func newConnectionTracker() *connectionTracker {
+	return &connectionTracker{active: map[string]int{}}
+}
+
+// open records a transaction of the address and returns the number of
+// transactions of the address being processed
+func (c *connectionTracker) open(addr string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active[addr]++
+	return c.active[addr]
+}
+
+// close releases a transaction recorded with open
+func (c *connectionTracker) close(addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.active[addr] <= 1 {
+		delete(c.active, addr)
+		return
+	}
+	c.active[addr]--
+}
+
+// trackConnection records the transaction of the client address and sets
+// the CONN_* variables, the transaction is interrupted if the address
+// exceeds the limits and the connection engine is On. The connection
+// engine has its own mode, it interrupts under SecRuleEngine DetectionOnly
+// too.
+func (tx *Transaction) trackConnection(client string) {
+	if tx.WAF.connections == nil {
+		// shadow transactions are counted by the active transaction
+		return
+	}
+	if tx.connectionAddr != "" {
+		// ProcessConnection was called again
+		tx.WAF.connections.close(tx.connectionAddr)
+	}
+	tx.connectionAddr = client
+	n := tx.WAF.connections.open(client)
+	tx.variables.connConcurrent.Set(strconv.Itoa(n))
+	exceeded := tx.WAF.ConnectionLimit > 0 && n > tx.WAF.ConnectionLimit
+	if tx.WAF.ConnectionRateLimit > 0 && tx.WAF.RateLimitStore != nil {
+		rate, err := tx.WAF.RateLimitStore.Increment(connectionsKeyPrefix+client, time.Now(), tx.WAF.ConnectionRateWindow)
+		if err != nil {
+			tx.debugLogger.Error("Failed to count the connections of %s: %s", client, err.Error())
+		} else {
+			tx.variables.connRate.Set(strconv.Itoa(rate))
+			exceeded = exceeded || rate > tx.WAF.ConnectionRateLimit
+		}
+	}
+	if !exceeded {
+		tx.variables.connLimitExceeded.Set("0")
+		return
+	}
+	tx.variables.connLimitExceeded.Set("1")
+	tx.debugLogger.Debug("Connection limits exceeded by %s", client)
+	if tx.WAF.ConnectionEngine == types.ConnectionEngineOn {
+		// tx.Interrupt only interrupts when the rule engine is On
+		tx.interruption = &types.Interruption{
+			Action: types.InterruptionActionDeny,
+			Status: 429,
+		}
+	}
+}
+
+// shadowConnection copies the CONN_* variables to the shadow transaction,
+// which is not tracked
+func (tx *Transaction) shadowConnection() {
+	tx.shadow.variables.connConcurrent.Set(tx.variables.connConcurrent.String())
+	tx.shadow.variables.connRate.Set(tx.variables.connRate.String())
+	tx.shadow.variables.connLimitExceeded.Set(tx.variables.connLimitExceeded.String())
+}
+
+// releaseConnection releases the transaction recorded by trackConnection
+func (tx *Transaction) releaseConnection() {
+	if tx.WAF.connections == nil || tx.connectionAddr == "" {
+		return
+	}
+	tx.WAF.connections.close(tx.connectionAddr)
+	tx.connectionAddr = ""
+}
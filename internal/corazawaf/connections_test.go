@@ -0,0 +1,115 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+func TestConnectionEngineConcurrentLimit(t *testing.T) {
+	waf := NewWAF()
+	waf.ConnectionEngine = types.ConnectionEngineOn
+	waf.ConnectionLimit = 2
+	var txs []*Transaction
+	for i := 0; i < 3; i++ {
+		tx := waf.NewTransaction()
+		tx.ProcessConnection("10.0.0.1", 40000+i, "127.0.0.1", 80)
+		txs = append(txs, tx)
+	}
+	if v := txs[2].variables.connConcurrent.String(); v != "3" {
+		t.Errorf("unexpected CONN_CONCURRENT %q", v)
+	}
+	if txs[1].interruption != nil || txs[1].variables.connLimitExceeded.String() != "0" {
+		t.Error("unexpected interruption under the limit")
+	}
+	if it := txs[2].ProcessRequestHeaders(); it == nil || it.Action != types.InterruptionActionDeny || it.Status != 429 {
+		t.Errorf("expected a 429 interruption, got %v", it)
+	}
+	if txs[2].variables.connLimitExceeded.String() != "1" {
+		t.Error("expected CONN_LIMIT_EXCEEDED")
+	}
+	// other clients are not limited
+	other := waf.NewTransaction()
+	other.ProcessConnection("10.0.0.2", 40000, "127.0.0.1", 80)
+	if other.interruption != nil {
+		t.Error("unexpected interruption of another client")
+	}
+	other.Close()
+
+	for _, tx := range txs {
+		tx.Close()
+	}
+	if n := len(waf.connections.active); n != 0 {
+		t.Errorf("expected the connections to be released, %d addresses left", n)
+	}
+}
+
+func TestConnectionEngineDetectionOnly(t *testing.T) {
+	waf := NewWAF()
+	waf.ConnectionEngine = types.ConnectionEngineDetectionOnly
+	waf.ConnectionRateLimit = 1
+	waf.ConnectionRateWindow = time.Hour
+	for i, exceeded := range []string{"0", "1"} {
+		tx := waf.NewTransaction()
+		tx.ProcessConnection("10.0.0.1", 40000, "127.0.0.1", 80)
+		if v := tx.variables.connLimitExceeded.String(); v != exceeded {
+			t.Errorf("unexpected CONN_LIMIT_EXCEEDED %q for transaction %d", v, i)
+		}
+		if tx.interruption != nil {
+			t.Error("unexpected interruption in DetectionOnly")
+		}
+		tx.Close()
+	}
+}
+
+func TestConnectionEngineOnUnderRuleEngineDetectionOnly(t *testing.T) {
+	waf := NewWAF()
+	waf.RuleEngine = types.RuleEngineDetectionOnly
+	waf.ConnectionEngine = types.ConnectionEngineOn
+	waf.ConnectionLimit = 1
+	first, second := waf.NewTransaction(), waf.NewTransaction()
+	defer first.Close()
+	defer second.Close()
+	first.ProcessConnection("10.0.0.1", 40000, "127.0.0.1", 80)
+	second.ProcessConnection("10.0.0.1", 40001, "127.0.0.1", 80)
+	if it := second.ProcessRequestHeaders(); it == nil || it.Status != 429 {
+		t.Errorf("expected the connection engine to interrupt, got %v", it)
+	}
+}
+
+func TestConnectionEngineOff(t *testing.T) {
+	waf := NewWAF()
+	waf.ConnectionLimit = 1
+	tx := waf.NewTransaction()
+	tx.ProcessConnection("10.0.0.1", 40000, "127.0.0.1", 80)
+	defer tx.Close()
+	if tx.variables.connConcurrent.String() != "" || len(waf.connections.active) != 0 {
+		t.Error("unexpected connection tracking")
+	}
+}
+
+func TestConnectionEngineCandidate(t *testing.T) {
+	waf := NewWAF()
+	waf.RuleEngine = types.RuleEngineOn
+	waf.ConnectionEngine = types.ConnectionEngineOn
+	waf.ConnectionLimit = 1
+	waf.SetCandidate(waf.NewCandidate(), nil)
+	tx := waf.NewTransaction()
+	tx.ProcessConnection("10.0.0.1", 40000, "127.0.0.1", 80)
+	if it := tx.ProcessRequestHeaders(); it != nil {
+		t.Errorf("unexpected interruption %v", it)
+	}
+	if v := tx.shadow.variables.connConcurrent.String(); v != "1" {
+		t.Errorf("unexpected CONN_CONCURRENT %q in the shadow transaction", v)
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(waf.connections.active); n != 0 {
+		t.Errorf("expected the connections to be released, %d addresses left", n)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// csrfHeader is the request header checked for the token before the
+// CSRF parameter, it is used by scripts reading the csrf-token meta
+const csrfHeader = "x-csrf-token"
+
+// csrfParam returns the name of the form field storing CSRF tokens
+func (w *WAF) csrfParam() string {
+	if w.CSRFParam == "" {
+		return "csrf_token"
+	}
+	return w.CSRFParam
+}
+
+// csrfExempt returns true if the path starts with one of the CSRFExempt
+// prefixes
+func (w *WAF) csrfExempt(path string) bool {
+	for _, p := range w.CSRFExempt {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// csrfToken returns the CSRF token of the session, it is empty if the
+// rules didn't set SESSIONID
+func (tx *Transaction) csrfToken() string {
+	sid := tx.variables.sessionID.String()
+	if sid == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, tx.WAF.CSRFKey)
+	mac.Write([]byte(sid))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// isStateChanging returns true for the methods that must carry a token
+func isStateChanging(method string) bool {
+	switch strings.ToUpper(method) {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return false
+	}
+	return true
+}
+
+// verifyCSRF checks the token of the state changing requests of a
+// session, from the X-CSRF-Token header or the CSRF parameter. Failures
+// are set in CSRF_ERROR and CSRF_ERROR_MSG for the phase 2 rules.
+func (tx *Transaction) verifyCSRF() {
+	token := tx.csrfToken()
+	if token == "" {
+		return
+	}
+	tx.variables.csrfToken.Set(token)
+	if !isStateChanging(tx.variables.requestMethod.String()) ||
+		tx.WAF.csrfExempt(tx.variables.requestFilename.String()) {
+		return
+	}
+	sent := tx.variables.requestHeaders.Get(csrfHeader)
+	if len(sent) == 0 {
+		sent = tx.variables.argsPost.Get(tx.WAF.csrfParam())
+	}
+	if len(sent) == 0 {
+		tx.variables.csrfError.Set("1")
+		tx.variables.csrfErrorMsg.Set("missing CSRF token")
+		return
+	}
+	for _, s := range sent {
+		if !hmac.Equal([]byte(s), []byte(token)) {
+			tx.variables.csrfError.Set("1")
+			tx.variables.csrfErrorMsg.Set("invalid CSRF token")
+			return
+		}
+	}
+}
+
+var (
+	// csrfFormRx finds the opening tag of the forms using the POST method
+	csrfFormRx = regexp.MustCompile(`(?is)<form\b[^>]*?\smethod\s*=\s*["']?post\b[^>]*>`)
+	// csrfActionRx finds the action attribute of a form tag
+	csrfActionRx = regexp.MustCompile(`(?is)\saction\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	// csrfHeadRx finds the opening tag of the head element
+	csrfHeadRx = regexp.MustCompile(`(?is)<head\b[^>]*>`)
+)
+
+// csrfSameOrigin returns true if the form posts to the origin of the
+// request, the token must not be sent to other sites. Forms without
+// action post to the current document.
+func (tx *Transaction) csrfSameOrigin(form string) bool {
+	m := csrfActionRx.FindStringSubmatch(form)
+	if m == nil {
+		return true
+	}
+	action := strings.TrimSpace(html.UnescapeString(m[1] + m[2] + m[3]))
+	u, err := url.Parse(action)
+	if err != nil {
+		return false
+	}
+	if u.Scheme != "" && !strings.EqualFold(u.Scheme, "http") && !strings.EqualFold(u.Scheme, "https") {
+		return false
+	}
+	if u.Host == "" {
+		// scheme relative actions like //example.com have a host
+		return u.Scheme == ""
+	}
+	for _, h := range tx.variables.requestHeaders.Get("host") {
+		if strings.EqualFold(h, u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// injectCSRFToken adds a hidden field with the session token to the POST
+// forms of an html document posting to the same origin, and a csrf-token
+// meta element to its head
+func (tx *Transaction) injectCSRFToken(body string) (string, bool) {
+	token := tx.csrfToken()
+	if token == "" {
+		return body, false
+	}
+	tx.variables.csrfToken.Set(token)
+	field := `<input type="hidden" name="` + html.EscapeString(tx.WAF.csrfParam()) + `" value="` + token + `">`
+	res := csrfFormRx.ReplaceAllStringFunc(body, func(m string) string {
+		if !tx.csrfSameOrigin(m) {
+			return m
+		}
+		return m + field
+	})
+	if loc := csrfHeadRx.FindStringIndex(res); loc != nil {
+		res = res[:loc[1]] + `<meta name="csrf-token" content="` + token + `">` + res[loc[1]:]
+	}
+	return res, res != body
+}
@@ -0,0 +1,150 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+func newCSRFWAF() *WAF {
+	waf := NewWAF()
+	waf.CSRFProtection = true
+	waf.CSRFKey = []byte("secret")
+	waf.CSRFExempt = []string{"/hooks/"}
+	waf.ContentInjection = true
+	return waf
+}
+
+func TestCSRFTokenInjection(t *testing.T) {
+	tx := newCSRFWAF().NewTransaction()
+	tx.variables.sessionID.Set("abc")
+	tx.ResponseBodyAccess = true
+	tx.RuleEngine = types.RuleEngineOn
+	tx.AddResponseHeader("Content-Type", "text/html; charset=utf-8")
+	tx.AddRequestHeader("Host", "example.com")
+	body := `<html><head><title>t</title></head><form method="post" action="/a"></form><form action="/search"></form>` +
+		`<form method="post" action="https://evil.com/steal"></form><form method="post" action="//evil.com/steal"></form>` +
+		`<form method="post" action="https://example.com/b"></form><form data-method="post" action="/c"></form></html>`
+	if _, err := tx.ResponseBodyBuffer.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ProcessResponseBody(); err != nil {
+		t.Fatal(err)
+	}
+	token := tx.csrfToken()
+	res := tx.variables.responseBody.String()
+	if !strings.Contains(res, `<form method="post" action="/a"><input type="hidden" name="csrf_token" value="`+token+`">`) {
+		t.Errorf("expected the post form to carry the token, got %q", res)
+	}
+	if !strings.Contains(res, `<form method="post" action="https://example.com/b"><input type="hidden"`) {
+		t.Errorf("expected the same origin form to carry the token, got %q", res)
+	}
+	if !strings.Contains(res, `<form action="/search"></form>`) || !strings.Contains(res, `<form data-method="post" action="/c"></form>`) {
+		t.Errorf("expected the get forms to be untouched, got %q", res)
+	}
+	if strings.Count(res, `type="hidden"`) != 2 {
+		t.Errorf("expected the cross origin forms to be untouched, got %q", res)
+	}
+	if !strings.Contains(res, `<head><meta name="csrf-token" content="`+token+`">`) {
+		t.Errorf("expected the token in the head, got %q", res)
+	}
+	if tx.variables.csrfToken.String() != token {
+		t.Error("expected CSRF_TOKEN to be set")
+	}
+
+	// responses without session are not modified
+	tx = newCSRFWAF().NewTransaction()
+	tx.ResponseBodyAccess = true
+	tx.RuleEngine = types.RuleEngineOn
+	tx.AddResponseHeader("Content-Type", "text/html")
+	if _, err := tx.ResponseBodyBuffer.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ProcessResponseBody(); err != nil {
+		t.Fatal(err)
+	}
+	if tx.variables.responseBody.String() != body {
+		t.Error("expected the body without session to be untouched")
+	}
+}
+
+func TestCSRFTokenInjectionContentLength(t *testing.T) {
+	tx := newCSRFWAF().NewTransaction()
+	tx.variables.sessionID.Set("abc")
+	tx.ResponseBodyAccess = true
+	tx.RuleEngine = types.RuleEngineOn
+	body := `<html><form method="post" action="/a"></form></html>`
+	tx.AddResponseHeader("Content-Type", "text/html")
+	tx.AddResponseHeader("Content-Length", strconv.Itoa(len(body)))
+	if _, err := tx.ResponseBodyBuffer.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ProcessResponseBody(); err != nil {
+		t.Fatal(err)
+	}
+	injected := tx.variables.responseBody.String()
+	if injected == body {
+		t.Fatal("expected the token to be injected")
+	}
+	want := types.HeaderMutation{Action: types.HeaderMutationSet, Name: "Content-Length", Value: strconv.Itoa(len(injected))}
+	if m := tx.ResponseHeaderMutations(); len(m) != 1 || m[0] != want {
+		t.Errorf("unexpected response header mutations %v", m)
+	}
+}
+
+func TestCSRFVerification(t *testing.T) {
+	waf := newCSRFWAF()
+	token := func() string {
+		tx := waf.NewTransaction()
+		tx.variables.sessionID.Set("abc")
+		return tx.csrfToken()
+	}()
+	tests := []struct {
+		name    string
+		method  string
+		uri     string
+		header  string
+		body    string
+		session string
+		err     string
+	}{
+		{"header", "POST", "/a", token, "", "abc", ""},
+		{"form", "POST", "/a", "", "csrf_token=" + token, "abc", ""},
+		{"missing", "DELETE", "/a", "", "", "abc", "missing CSRF token"},
+		{"invalid", "POST", "/a", "", "csrf_token=x", "abc", "invalid CSRF token"},
+		{"other session", "POST", "/a", token, "", "def", "invalid CSRF token"},
+		{"safe method", "GET", "/a", "", "", "abc", ""},
+		{"exempt", "POST", "/hooks/github", "", "", "abc", ""},
+		{"no session", "POST", "/a", "", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := waf.NewTransaction()
+			tx.RequestBodyAccess = true
+			tx.ProcessURI(tt.uri, tt.method, "HTTP/1.1")
+			tx.AddRequestHeader("Content-Type", "application/x-www-form-urlencoded")
+			if tt.header != "" {
+				tx.AddRequestHeader("X-CSRF-Token", tt.header)
+			}
+			tx.ProcessRequestHeaders()
+			tx.variables.sessionID.Set(tt.session)
+			if _, _, err := tx.WriteRequestBody([]byte(tt.body)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tx.ProcessRequestBody(); err != nil {
+				t.Fatal(err)
+			}
+			if have := tx.variables.csrfErrorMsg.String(); have != tt.err {
+				t.Errorf("want error %q, have %q", tt.err, have)
+			}
+			if (tx.variables.csrfError.String() == "1") != (tt.err != "") {
+				t.Error("unexpected CSRF_ERROR")
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+// HashMethodType identifies the kind of HTML element a hash method
+// will sign, it matches the SecHashMethodRx and SecHashMethodPm types
+type HashMethodType int
+
+const (
+	// HashHref signs href attributes from <a> elements
+	HashHref HashMethodType = iota
+	// HashFormAction signs action attributes from <form> elements
+	HashFormAction
+	// HashIframeSrc signs src attributes from <iframe> elements
+	HashIframeSrc
+	// HashFrameSrc signs src attributes from <frame> elements
+	HashFrameSrc
+	// HashLocation signs the Location response header
+	HashLocation
+)
+
+// ParseHashMethodType parses a hash method type like HashHref
+func ParseHashMethodType(t string) (HashMethodType, error) {
+	switch strings.ToLower(t) {
+	case "hashhref":
+		return HashHref, nil
+	case "hashformaction":
+		return HashFormAction, nil
+	case "hashiframesrc":
+		return HashIframeSrc, nil
+	case "hashframesrc":
+		return HashFrameSrc, nil
+	case "hashlocation":
+		return HashLocation, nil
+	}
+	return -1, fmt.Errorf("invalid hash method type %q", t)
+}
+
+// HashKeyMode defines which transaction data is bound to the hash key
+type HashKeyMode int
+
+const (
+	// HashKeyOnly signs links only with the configured key
+	HashKeyOnly HashKeyMode = iota
+	// HashKeySessionID binds signed links to the SESSIONID variable
+	HashKeySessionID
+	// HashKeyRemoteIP binds signed links to the REMOTE_ADDR variable
+	HashKeyRemoteIP
+)
+
+// ParseHashKeyMode parses the second argument of SecHashKey
+func ParseHashKeyMode(m string) (HashKeyMode, error) {
+	switch strings.ToLower(m) {
+	case "", "keyonly":
+		return HashKeyOnly, nil
+	case "sessionid":
+		return HashKeySessionID, nil
+	case "remoteip":
+		return HashKeyRemoteIP, nil
+	}
+	return -1, fmt.Errorf("invalid hash key mode %q", m)
+}
+
+// HashMethod describes which links must be signed by the hash engine.
+// Links are selected either with a regular expression or with a list
+// of words, only one of them is used.
+type HashMethod struct {
+	Type  HashMethodType
+	Rx    *regexp.Regexp
+	Words []string
+}
+
+// Matches returns true if the link must be signed
+func (h HashMethod) Matches(link string) bool {
+	if h.Rx != nil {
+		return h.Rx.MatchString(link)
+	}
+	for _, w := range h.Words {
+		if strings.Contains(link, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// hashLinkRx finds attributes of the elements supported by the hash engine,
+// attribute names must follow a space so data-href is not matched
+var hashLinkRx = regexp.MustCompile(`(?is)<(a|form|iframe|frame)\b[^>]*?\s(href|action|src)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+func hashMethodTypeFor(tag string, attr string) (HashMethodType, bool) {
+	switch {
+	case tag == "a" && attr == "href":
+		return HashHref, true
+	case tag == "form" && attr == "action":
+		return HashFormAction, true
+	case tag == "iframe" && attr == "src":
+		return HashIframeSrc, true
+	case tag == "frame" && attr == "src":
+		return HashFrameSrc, true
+	}
+	return 0, false
+}
+
+// hashParam returns the name of the parameter used to store hashes
+func (w *WAF) hashParam() string {
+	if w.HashParam == "" {
+		return "hmac"
+	}
+	return w.HashParam
+}
+
+// hashKey returns the key used to sign links for this transaction
+func (tx *Transaction) hashKey() []byte {
+	key := tx.WAF.HashKey
+	switch tx.WAF.HashKeyMode {
+	case HashKeySessionID:
+		key = append(append([]byte{}, key...), tx.variables.sessionID.String()...)
+	case HashKeyRemoteIP:
+		key = append(append([]byte{}, key...), tx.variables.remoteAddr.String()...)
+	}
+	return key
+}
+
+// signURI returns the hex encoded hmac for the uri
+func (tx *Transaction) signURI(uri string) string {
+	mac := hmac.New(sha256.New, tx.hashKey())
+	mac.Write([]byte(uri))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// resolveLink returns the request URI a link points to from the page of
+// the transaction, the relative links are signed as the browser requests
+// them
+func (tx *Transaction) resolveLink(link string) string {
+	base, err := url.Parse(tx.variables.requestURI.String())
+	if err != nil {
+		return link
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	return base.ResolveReference(ref).RequestURI()
+}
+
+// SignLink appends the hash parameter to a link, links pointing to
+// other hosts are returned unmodified.
+func (tx *Transaction) SignLink(link string) string {
+	if link == "" || strings.Contains(link, "://") || strings.HasPrefix(link, "//") ||
+		strings.HasPrefix(strings.ToLower(link), "javascript:") || link[0] == '#' {
+		return link
+	}
+	fragment := ""
+	if i := strings.IndexByte(link, '#'); i != -1 {
+		link, fragment = link[:i], link[i:]
+	}
+	sep := "?"
+	if strings.Contains(link, "?") {
+		sep = "&"
+	}
+	return link + sep + tx.WAF.hashParam() + "=" + tx.signURI(tx.resolveLink(link)) + fragment
+}
+
+// HashEnforced returns true if the signatures are enforced for the
+// transaction, it can be changed with ctl:hashEnforcement
+func (tx *Transaction) HashEnforced() bool {
+	return tx.HashEnforcement
+}
+
+// ValidateHash returns true if the uri contains a valid hash parameter
+// generated by this WAF instance
+func (tx *Transaction) ValidateHash(uri string) bool {
+	if i := strings.IndexByte(uri, '#'); i != -1 {
+		uri = uri[:i]
+	}
+	path, query, ok := strings.Cut(uri, "?")
+	if !ok {
+		return false
+	}
+	param := tx.WAF.hashParam() + "="
+	var (
+		hash string
+		rest []string
+	)
+	for _, p := range strings.Split(query, "&") {
+		if strings.HasPrefix(p, param) {
+			hash = p[len(param):]
+			continue
+		}
+		rest = append(rest, p)
+	}
+	if hash == "" {
+		return false
+	}
+	unsigned := path
+	if len(rest) > 0 {
+		unsigned += "?" + strings.Join(rest, "&")
+	}
+	expected := tx.signURI(unsigned)
+	return hmac.Equal([]byte(hash), []byte(expected))
+}
+
+// signLinks rewrites the links of an html document, adding the
+// hash parameter to the links matching the WAF hash methods
+func (tx *Transaction) signLinks(body string) (string, bool) {
+	methods := tx.WAF.HashMethods
+	if len(methods) == 0 {
+		return body, false
+	}
+	changed := false
+	res := hashLinkRx.ReplaceAllStringFunc(body, func(m string) string {
+		sm := hashLinkRx.FindStringSubmatchIndex(m)
+		tag := strings.ToLower(m[sm[2]:sm[3]])
+		attr := strings.ToLower(m[sm[4]:sm[5]])
+		mt, ok := hashMethodTypeFor(tag, attr)
+		if !ok {
+			return m
+		}
+		start, end := sm[6], sm[7]
+		if start == -1 {
+			start, end = sm[8], sm[9]
+		}
+		// attributes are signed as the browser requests them, with the
+		// entities like &amp; decoded
+		link := html.UnescapeString(m[start:end])
+		for _, h := range methods {
+			if h.Type == mt && h.Matches(link) {
+				changed = true
+				return m[:start] + html.EscapeString(tx.SignLink(link)) + m[end:]
+			}
+		}
+		return m
+	})
+	return res, changed
+}
+
+// signLocation schedules the signature of the Location header of the
+// response if it matches a HashLocation method
+func (tx *Transaction) signLocation() {
+	locations := tx.variables.responseHeaders.Get("location")
+	if len(locations) == 0 {
+		return
+	}
+	link := locations[0]
+	for _, h := range tx.WAF.HashMethods {
+		if h.Type != HashLocation || !h.Matches(link) {
+			continue
+		}
+		if signed := tx.SignLink(link); signed != link {
+			tx.AddResponseHeaderMutation(types.HeaderMutation{Action: types.HeaderMutationSet, Name: "Location", Value: signed})
+		}
+		return
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+func newHashTransaction() *Transaction {
+	waf := NewWAF()
+	waf.HashEngine = true
+	waf.HashKey = []byte("secret")
+	waf.HashMethods = []HashMethod{
+		{Type: HashHref, Rx: regexp.MustCompile(`product`)},
+		{Type: HashFormAction, Words: []string{"login"}},
+		{Type: HashLocation, Words: []string{"/product"}},
+	}
+	return waf.NewTransaction()
+}
+
+func TestSignAndValidateLink(t *testing.T) {
+	tx := newHashTransaction()
+	signed := tx.SignLink("/product?id=1")
+	if !strings.HasPrefix(signed, "/product?id=1&hmac=") {
+		t.Fatalf("unexpected signed link %q", signed)
+	}
+	if !tx.ValidateHash(signed) {
+		t.Errorf("expected %q to be valid", signed)
+	}
+	if tx.ValidateHash(strings.Replace(signed, "id=1", "id=2", 1)) {
+		t.Error("expected tampered link to be invalid")
+	}
+	if tx.ValidateHash("/product?id=1") {
+		t.Error("expected unsigned link to be invalid")
+	}
+	if l := tx.SignLink("https://example.com/product"); l != "https://example.com/product" {
+		t.Errorf("external links must not be signed, got %q", l)
+	}
+}
+
+func TestSignRelativeLinks(t *testing.T) {
+	tests := []struct {
+		link    string
+		request string
+	}{
+		{"page.html", "/docs/page.html"},
+		{"../product?id=1", "/product?id=1"},
+		{"?p=2", "/docs/index.html?p=2"},
+		{"?p=2#top", "/docs/index.html?p=2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.link, func(t *testing.T) {
+			page := "/docs/index.html?p=1"
+			tx := newHashTransaction()
+			tx.ProcessURI(page, "GET", "HTTP/1.1")
+			signed := tx.SignLink(tt.link)
+			// the browser resolves the signed link against the page
+			base, _ := url.Parse(page)
+			ref, err := url.Parse(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			uri := base.ResolveReference(ref).RequestURI()
+			tx2 := tx.WAF.NewTransaction()
+			if !strings.HasPrefix(uri, tt.request) {
+				t.Fatalf("unexpected request %q for %q", uri, signed)
+			}
+			if !tx2.ValidateHash(uri) {
+				t.Errorf("expected %q to be valid", uri)
+			}
+		})
+	}
+}
+
+func TestHashKeyRemoteIP(t *testing.T) {
+	tx := newHashTransaction()
+	tx.WAF.HashKeyMode = HashKeyRemoteIP
+	tx.ProcessConnection("127.0.0.1", 1234, "", 0)
+	signed := tx.SignLink("/product")
+	tx2 := tx.WAF.NewTransaction()
+	tx2.ProcessConnection("127.0.0.2", 1234, "", 0)
+	if tx2.ValidateHash(signed) {
+		t.Error("expected hash bound to a different ip to be invalid")
+	}
+}
+
+func TestResponseBodyLinksAreSigned(t *testing.T) {
+	tx := newHashTransaction()
+	tx.ResponseBodyAccess = true
+	tx.RuleEngine = types.RuleEngineOn
+	tx.AddResponseHeader("content-type", "text/html")
+	body := `<a href="/product?id=1">p</a><a href="/other">o</a><form method="post" action='/login'></form>` +
+		`<a href="/product?id=2&amp;page=3">q</a><a data-href="/product?id=4" href="/other">r</a>`
+	if _, err := tx.ResponseBodyBuffer.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ProcessResponseBody(); err != nil {
+		t.Fatal(err)
+	}
+	res := tx.variables.responseBody.String()
+	if !strings.Contains(res, `href="/product?id=1&amp;hmac=`) {
+		t.Errorf("expected product link to be signed, got %q", res)
+	}
+	// the entities are decoded before signing
+	if !strings.Contains(res, `href="/product?id=2&amp;page=3&amp;hmac=`+tx.signURI("/product?id=2&page=3")+`"`) {
+		t.Errorf("expected the decoded link to be signed, got %q", res)
+	}
+	if !strings.Contains(res, `<a data-href="/product?id=4" href="/other">`) {
+		t.Errorf("expected data-href to be untouched, got %q", res)
+	}
+	if !strings.Contains(res, `href="/other"`) {
+		t.Errorf("expected other link to be untouched, got %q", res)
+	}
+	if !strings.Contains(res, `action='/login?hmac=`) {
+		t.Errorf("expected form action to be signed, got %q", res)
+	}
+	r, err := tx.ResponseBodyReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(strings.Builder)
+	if _, err := io.Copy(buf, r); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != res {
+		t.Error("expected response body buffer to contain the signed body")
+	}
+	if err := tx.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestResponseBodyLinksRequireHTML(t *testing.T) {
+	tx := newHashTransaction()
+	tx.ResponseBodyAccess = true
+	tx.RuleEngine = types.RuleEngineOn
+	tx.WAF.ResponseBodyMimeTypes = []string{"text/plain"}
+	tx.AddResponseHeader("content-type", "text/plain")
+	body := `<a href="/product?id=1">p</a>`
+	if _, err := tx.ResponseBodyBuffer.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ProcessResponseBody(); err != nil {
+		t.Fatal(err)
+	}
+	if res := tx.variables.responseBody.String(); res != body {
+		t.Errorf("expected the text body to be untouched, got %q", res)
+	}
+}
+
+func TestLocationIsSigned(t *testing.T) {
+	tx := newHashTransaction()
+	tx.RuleEngine = types.RuleEngineOn
+	tx.AddResponseHeader("Location", "/product?id=1")
+	tx.ProcessResponseHeaders(302, "HTTP/1.1")
+	mutations := tx.ResponseHeaderMutations()
+	if len(mutations) != 1 || mutations[0].Name != "Location" || !tx.ValidateHash(mutations[0].Value) {
+		t.Fatalf("expected the location to be signed, got %v", mutations)
+	}
+
+	tx = newHashTransaction()
+	tx.RuleEngine = types.RuleEngineOn
+	tx.AddResponseHeader("Location", "/other")
+	tx.ProcessResponseHeaders(302, "HTTP/1.1")
+	if mutations := tx.ResponseHeaderMutations(); len(mutations) != 0 {
+		t.Errorf("expected the location to be untouched, got %v", mutations)
+	}
+}
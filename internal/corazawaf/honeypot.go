@@ -0,0 +1,72 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// checkHoneypotPath sets HONEYPOT_PATH if the client requested one of the
+// trap paths, they are only linked from hidden elements so humans never
+// reach them
+func (tx *Transaction) checkHoneypotPath() {
+	path := tx.variables.requestFilename.String()
+	for _, p := range tx.WAF.HoneypotPaths {
+		if path == p {
+			tx.debugLogger.Debug("Honeypot path %q requested", p)
+			tx.variables.honeypotPath.Set(p)
+			return
+		}
+	}
+}
+
+// checkHoneypotFields sets the decoy fields submitted with a value in
+// HONEYPOT_FIELDS, browsers submit them empty as they are not displayed
+func (tx *Transaction) checkHoneypotFields() {
+	for _, name := range tx.WAF.HoneypotFields {
+		values := append(tx.variables.argsGet.Get(name), tx.variables.argsPost.Get(name)...)
+		for _, v := range values {
+			if v != "" {
+				tx.debugLogger.Debug("Honeypot field %q submitted", name)
+				tx.variables.honeypotFields.Add(name, v)
+			}
+		}
+	}
+}
+
+var (
+	// honeypotFormRx finds the opening tag of the forms
+	honeypotFormRx = regexp.MustCompile(`(?is)<form\b[^>]*>`)
+	// honeypotBodyRx finds the closing tag of the body element
+	honeypotBodyRx = regexp.MustCompile(`(?i)</body\s*>`)
+)
+
+// injectHoneypots adds the decoy fields to the forms of an html document,
+// and hidden links to the trap paths at the end of its body. The fields
+// are text inputs moved off screen as bots skip the hidden inputs.
+func (tx *Transaction) injectHoneypots(body string) (string, bool) {
+	res := body
+	if len(tx.WAF.HoneypotFields) > 0 {
+		fields := strings.Builder{}
+		for _, name := range tx.WAF.HoneypotFields {
+			fields.WriteString(`<input type="text" name="` + html.EscapeString(name) +
+				`" value="" autocomplete="off" tabindex="-1" aria-hidden="true" style="position:absolute;left:-10000px">`)
+		}
+		res = honeypotFormRx.ReplaceAllStringFunc(res, func(m string) string {
+			return m + fields.String()
+		})
+	}
+	if len(tx.WAF.HoneypotPaths) > 0 {
+		if loc := honeypotBodyRx.FindStringIndex(res); loc != nil {
+			links := strings.Builder{}
+			for _, p := range tx.WAF.HoneypotPaths {
+				links.WriteString(`<a href="` + html.EscapeString(p) + `" rel="nofollow" tabindex="-1" aria-hidden="true" style="display:none"></a>`)
+			}
+			res = res[:loc[0]] + links.String() + res[loc[0]:]
+		}
+	}
+	return res, res != body
+}
@@ -0,0 +1,93 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+func newHoneypotWAF() *WAF {
+	waf := NewWAF()
+	waf.HoneypotFields = []string{"website"}
+	waf.HoneypotPaths = []string{"/admin/backup.zip"}
+	waf.ContentInjection = true
+	return waf
+}
+
+func TestHoneypotInjection(t *testing.T) {
+	tx := newHoneypotWAF().NewTransaction()
+	tx.ResponseBodyAccess = true
+	tx.RuleEngine = types.RuleEngineOn
+	tx.AddResponseHeader("Content-Type", "text/html")
+	body := `<html><body><form method="post" action="/a"></form><FORM action="/search"></FORM></BODY></html>`
+	if _, err := tx.ResponseBodyBuffer.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ProcessResponseBody(); err != nil {
+		t.Fatal(err)
+	}
+	res := tx.variables.responseBody.String()
+	if strings.Count(res, `<input type="text" name="website" value=""`) != 2 {
+		t.Errorf("expected the decoy field in both forms, got %q", res)
+	}
+	if !strings.Contains(res, `<a href="/admin/backup.zip" rel="nofollow" tabindex="-1" aria-hidden="true" style="display:none"></a></BODY>`) {
+		t.Errorf("expected the trap link at the end of the body, got %q", res)
+	}
+
+	// non html responses are not modified
+	tx = newHoneypotWAF().NewTransaction()
+	tx.ResponseBodyAccess = true
+	tx.RuleEngine = types.RuleEngineOn
+	tx.AddResponseHeader("Content-Type", "text/plain")
+	if _, err := tx.ResponseBodyBuffer.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ProcessResponseBody(); err != nil {
+		t.Fatal(err)
+	}
+	if tx.variables.responseBody.String() != body {
+		t.Error("expected the text body to be untouched")
+	}
+}
+
+func TestHoneypotDetection(t *testing.T) {
+	waf := newHoneypotWAF()
+	tests := []struct {
+		name   string
+		uri    string
+		body   string
+		path   string
+		fields string
+	}{
+		{"human", "/a", "name=john&website=", "", ""},
+		{"field in body", "/a", "name=john&website=http://spam", "", "http://spam"},
+		{"field in query", "/a?website=x", "", "", "x"},
+		{"trap path", "/admin/backup.zip", "", "/admin/backup.zip", ""},
+		{"other path", "/admin/backup.zip.old", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := waf.NewTransaction()
+			tx.RequestBodyAccess = true
+			tx.ProcessURI(tt.uri, "POST", "HTTP/1.1")
+			tx.AddRequestHeader("Content-Type", "application/x-www-form-urlencoded")
+			tx.ProcessRequestHeaders()
+			if _, _, err := tx.WriteRequestBody([]byte(tt.body)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tx.ProcessRequestBody(); err != nil {
+				t.Fatal(err)
+			}
+			if have := tx.variables.honeypotPath.String(); have != tt.path {
+				t.Errorf("want HONEYPOT_PATH %q, have %q", tt.path, have)
+			}
+			if have := strings.Join(tx.variables.honeypotFields.Get("website"), ","); have != tt.fields {
+				t.Errorf("want HONEYPOT_FIELDS %q, have %q", tt.fields, have)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"strings"
 
 	"github.com/corazawaf/coraza/v3/loggers"
 )
@@ -18,37 +19,50 @@ type stdDebugLogger struct {
 	Level  loggers.LogLevel
 }
 
-var _ loggers.DebugLogger = (*stdDebugLogger)(nil)
+var _ loggers.FieldLogger = (*stdDebugLogger)(nil)
 
-func (l *stdDebugLogger) formatLog(level loggers.LogLevel, message string, args ...interface{}) {
-	if l.Level >= level {
+func (l *stdDebugLogger) formatLog(level loggers.LogLevel, fields []loggers.Field, message string, args ...interface{}) {
+	if l.Level < level {
+		return
+	}
+	if len(fields) == 0 {
 		l.logger.Printf("[%s] %s", level.String(), fmt.Sprintf(message, args...))
+		return
+	}
+	// fields are written in logfmt style after the message
+	sb := strings.Builder{}
+	for _, f := range fields {
+		sb.WriteByte(' ')
+		sb.WriteString(f.Key)
+		sb.WriteByte('=')
+		fmt.Fprint(&sb, f.Value)
 	}
+	l.logger.Printf("[%s] %s%s", level.String(), fmt.Sprintf(message, args...), sb.String())
 }
 
 // Info logs an info message
 func (l *stdDebugLogger) Info(message string, args ...interface{}) {
-	l.formatLog(loggers.LogLevelInfo, message, args...)
+	l.formatLog(loggers.LogLevelInfo, nil, message, args...)
 }
 
 // Warn logs a warning message
 func (l *stdDebugLogger) Warn(message string, args ...interface{}) {
-	l.formatLog(loggers.LogLevelWarn, message, args...)
+	l.formatLog(loggers.LogLevelWarn, nil, message, args...)
 }
 
 // Error logs an error message
 func (l *stdDebugLogger) Error(message string, args ...interface{}) {
-	l.formatLog(loggers.LogLevelError, message, args...)
+	l.formatLog(loggers.LogLevelError, nil, message, args...)
 }
 
 // Debug logs a debug message
 func (l *stdDebugLogger) Debug(message string, args ...interface{}) {
-	l.formatLog(loggers.LogLevelDebug, message, args...)
+	l.formatLog(loggers.LogLevelDebug, nil, message, args...)
 }
 
 // Trace logs a trace message
 func (l *stdDebugLogger) Trace(message string, args ...interface{}) {
-	l.formatLog(loggers.LogLevelTrace, message, args...)
+	l.formatLog(loggers.LogLevelTrace, nil, message, args...)
 }
 
 // SetLevel sets the log level
@@ -68,3 +82,59 @@ func (l *stdDebugLogger) SetOutput(w io.WriteCloser) {
 	l.logger.SetOutput(w)
 	l.Closer = w
 }
+
+// With returns a logger that writes the fields with every message
+func (l *stdDebugLogger) With(fields ...loggers.Field) loggers.DebugLogger {
+	return &stdFieldsDebugLogger{parent: l, fields: fields}
+}
+
+// stdFieldsDebugLogger shares the output and level of its parent so
+// changes to the WAF logger are visible to transaction loggers
+type stdFieldsDebugLogger struct {
+	parent *stdDebugLogger
+	fields []loggers.Field
+}
+
+var _ loggers.FieldLogger = (*stdFieldsDebugLogger)(nil)
+
+// Info logs an info message
+func (l *stdFieldsDebugLogger) Info(message string, args ...interface{}) {
+	l.parent.formatLog(loggers.LogLevelInfo, l.fields, message, args...)
+}
+
+// Warn logs a warning message
+func (l *stdFieldsDebugLogger) Warn(message string, args ...interface{}) {
+	l.parent.formatLog(loggers.LogLevelWarn, l.fields, message, args...)
+}
+
+// Error logs an error message
+func (l *stdFieldsDebugLogger) Error(message string, args ...interface{}) {
+	l.parent.formatLog(loggers.LogLevelError, l.fields, message, args...)
+}
+
+// Debug logs a debug message
+func (l *stdFieldsDebugLogger) Debug(message string, args ...interface{}) {
+	l.parent.formatLog(loggers.LogLevelDebug, l.fields, message, args...)
+}
+
+// Trace logs a trace message
+func (l *stdFieldsDebugLogger) Trace(message string, args ...interface{}) {
+	l.parent.formatLog(loggers.LogLevelTrace, l.fields, message, args...)
+}
+
+// SetLevel sets the log level of the parent logger
+func (l *stdFieldsDebugLogger) SetLevel(level loggers.LogLevel) {
+	l.parent.SetLevel(level)
+}
+
+// SetOutput sets the output of the parent logger
+func (l *stdFieldsDebugLogger) SetOutput(w io.WriteCloser) {
+	l.parent.SetOutput(w)
+}
+
+// With returns a logger with the current and the new fields
+func (l *stdFieldsDebugLogger) With(fields ...loggers.Field) loggers.DebugLogger {
+	fs := make([]loggers.Field, 0, len(l.fields)+len(fields))
+	fs = append(append(fs, l.fields...), fields...)
+	return &stdFieldsDebugLogger{parent: l.parent, fields: fs}
+}
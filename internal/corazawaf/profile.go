@@ -0,0 +1,43 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"strconv"
+
+	"github.com/corazawaf/coraza/v3/profiler"
+)
+
+// profileRequest returns the parts of the request learned and checked by
+// the profiler
+func (tx *Transaction) profileRequest() profiler.Request {
+	return profiler.Request{
+		Method: tx.variables.requestMethod.String(),
+		Path:   tx.variables.requestFilename.String(),
+		Query:  tx.variables.argsGet.Data(),
+		Body:   tx.variables.argsPost.Data(),
+	}
+}
+
+// checkProfile sets the deviations of the request from the profile in
+// PROFILE_VIOLATION for the phase 2 rules
+func (tx *Transaction) checkProfile() {
+	for _, v := range tx.WAF.Profile.Check(tx.profileRequest()) {
+		tx.debugLogger.Debug("Profile violation %s at %s: %s", v.Kind, v.Location, v.Message)
+		tx.variables.profileViolation.Add(v.Kind, v.Location)
+	}
+}
+
+// learnProfile records the request in the profile, the interrupted
+// transactions and the ones answered with an error status are not
+// learned to keep attacks and invalid requests out of the profile
+func (tx *Transaction) learnProfile() {
+	if tx.interruption != nil {
+		return
+	}
+	if status, err := strconv.Atoi(tx.variables.responseStatus.String()); err == nil && status >= 400 {
+		return
+	}
+	tx.WAF.Profile.Learn(tx.profileRequest())
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"strconv"
+
+	"github.com/corazawaf/coraza/v3/internal/corazarules"
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+// Anomaly scores of the CRS, the names of CRS 4 come first
+var (
+	inboundAnomalyScores  = []string{"blocking_inbound_anomaly_score", "anomaly_score"}
+	outboundAnomalyScores = []string{"blocking_outbound_anomaly_score", "outbound_anomaly_score"}
+)
+
+// Result returns the verdict of the transaction, it is meant to be called
+// once the transaction was processed
+func (tx *Transaction) Result() types.Result {
+	res := types.Result{
+		Action:                "pass",
+		RuleEngine:            tx.RuleEngine,
+		InboundAnomalyScore:   tx.anomalyScore(inboundAnomalyScores),
+		OutboundAnomalyScore:  tx.anomalyScore(outboundAnomalyScores),
+		MatchedRules:          make([]types.ResultRule, 0, len(tx.matchedRules)),
+		Perf:                  tx.PerfStats(),
+		RequestBodyTruncated:  tx.requestBodyTruncated,
+		ResponseBodyTruncated: tx.responseBodyTruncated,
+	}
+	res.AnomalyScore = res.InboundAnomalyScore + res.OutboundAnomalyScore
+	if it := tx.interruption; it != nil {
+		res.Action = it.Action
+		res.Status = it.Status
+		res.RuleID = it.RuleID
+	}
+	for _, mr := range tx.matchedRules {
+		r := mr.Rule()
+		rr := types.ResultRule{
+			ID:         r.ID(),
+			Phase:      r.Phase(),
+			Severity:   r.Severity(),
+			Disruptive: mr.Disruptive(),
+		}
+		if m, ok := r.(*corazarules.RuleMetadata); ok {
+			rr.HasSeverity = m.HasSeverity_
+		}
+		res.MatchedRules = append(res.MatchedRules, rr)
+	}
+	return res
+}
+
+// anomalyScore returns the first TX variable set among names as an
+// integer, or 0
+func (tx *Transaction) anomalyScore(names []string) int {
+	for _, name := range names {
+		if v := tx.variables.tx.Get(name); len(v) > 0 {
+			s, err := strconv.Atoi(v[0])
+			if err != nil {
+				return 0
+			}
+			return s
+		}
+	}
+	return 0
+}
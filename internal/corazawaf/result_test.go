@@ -0,0 +1,76 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/corazawaf/coraza/v3/types/variables"
+)
+
+func TestTransactionResult(t *testing.T) {
+	waf := NewWAF()
+	warning := newCandidateTestRule(t, 1, types.PhaseRequestHeaders, variables.RequestURI, "/a", false)
+	warning.Severity_ = types.RuleSeverityWarning
+	warning.HasSeverity_ = true
+	if err := waf.Rules.Add(warning); err != nil {
+		t.Fatal(err)
+	}
+	if err := waf.Rules.Add(newCandidateTestRule(t, 2, types.PhaseRequestHeaders, variables.RequestMethod, "PUT", true)); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/a", "GET", "HTTP/1.1")
+	tx.ProcessRequestHeaders()
+	res := tx.Result()
+	if res.Action != "pass" || res.Status != 0 || res.RuleID != 0 {
+		t.Errorf("unexpected verdict %s/%d/%d", res.Action, res.Status, res.RuleID)
+	}
+	if len(res.MatchedRules) != 1 || res.MatchedRules[0] != (types.ResultRule{ID: 1, Phase: types.PhaseRequestHeaders, Severity: types.RuleSeverityWarning, HasSeverity: true}) {
+		t.Errorf("unexpected matched rules %+v", res.MatchedRules)
+	}
+	if _, ok := res.Perf.Phases[types.PhaseRequestHeaders]; !ok {
+		t.Error("expected the request headers phase timing")
+	}
+	tx.Close()
+
+	tx = waf.NewTransaction()
+	tx.ProcessURI("/b", "PUT", "HTTP/1.1")
+	tx.variables.tx.Set("blocking_inbound_anomaly_score", []string{"10"})
+	tx.variables.tx.Set("blocking_outbound_anomaly_score", []string{"4"})
+	tx.ProcessRequestHeaders()
+	res = tx.Result()
+	if res.Action != types.InterruptionActionDeny || res.Status != 403 || res.RuleID != 2 {
+		t.Errorf("unexpected verdict %s/%d/%d", res.Action, res.Status, res.RuleID)
+	}
+	if len(res.MatchedRules) != 1 || !res.MatchedRules[0].Disruptive {
+		t.Errorf("expected the disruptive rule, got %+v", res.MatchedRules)
+	}
+	if res.AnomalyScore != 14 || res.InboundAnomalyScore != 10 || res.OutboundAnomalyScore != 4 {
+		t.Errorf("unexpected anomaly scores %d = %d + %d", res.AnomalyScore, res.InboundAnomalyScore, res.OutboundAnomalyScore)
+	}
+	tx.Close()
+}
+
+func TestTransactionResultResponseBodyTruncated(t *testing.T) {
+	waf := NewWAF()
+	waf.ResponseBodyLimit = 4
+	for body, truncated := range map[string]bool{"abc": false, "abcd": false, "abcde": true} {
+		tx := waf.NewTransaction()
+		tx.ResponseBodyAccess = true
+		tx.AddResponseHeader("content-type", "text/html")
+		if _, err := tx.ResponseBodyWriter().Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx.ProcessResponseBody(); err != nil {
+			t.Fatal(err)
+		}
+		if res := tx.Result(); res.ResponseBodyTruncated != truncated {
+			t.Errorf("%q: expected truncated %t, got %t", body, truncated, res.ResponseBodyTruncated)
+		}
+		tx.Close()
+	}
+}
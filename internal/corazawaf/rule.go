@@ -13,8 +13,10 @@ import (
 	"unsafe"
 
 	"github.com/corazawaf/coraza/v3/internal/corazarules"
+	"github.com/corazawaf/coraza/v3/loggers"
 	"github.com/corazawaf/coraza/v3/macro"
 	"github.com/corazawaf/coraza/v3/rules"
+	"github.com/corazawaf/coraza/v3/transformations"
 	"github.com/corazawaf/coraza/v3/types"
 	"github.com/corazawaf/coraza/v3/types/variables"
 )
@@ -80,12 +82,27 @@ type ruleVariableParams struct {
 	Exceptions []ruleVariableException
 }
 
+// excluded returns true if the lowercase key matches an exception
+func (rv ruleVariableParams) excluded(lkey string) bool {
+	for _, ex := range rv.Exceptions {
+		// Since keys are case sensitive we need to check with lower case
+		if (ex.KeyRx != nil && ex.KeyRx.MatchString(lkey)) || strings.ToLower(ex.KeyStr) == lkey {
+			return true
+		}
+	}
+	return false
+}
+
 type ruleTransformationParams struct {
 	// The transformation to be used, used for logging
 	Name string
 
 	// The transformation function to be used
 	Function rules.Transformation
+
+	// ID identifies the chain of transformations ending with this one,
+	// it is used to cache intermediate results
+	ID int
 }
 
 // Rule is used to test a Transaction against certain operators
@@ -126,6 +143,13 @@ type Rule struct {
 	// by disruptive rules
 	DisruptiveStatus int
 
+	// DisruptiveBody is the response body template that will be set to
+	// interruptions by disruptive rules
+	DisruptiveBody macro.Macro
+
+	// DisruptiveContentType is the content type of DisruptiveBody
+	DisruptiveContentType string
+
 	// Message text to be macro expanded and logged
 	// In future versions we might use a special type of string that
 	// supports cached macro expansions. For performance
@@ -140,12 +164,25 @@ type Rule struct {
 	// If true, triggering this rule write to the audit log
 	Audit bool
 
+	// AuditSet is true if auditlog or noauditlog were used, they take
+	// precedence over the audit logging implied by log and nolog
+	AuditSet bool
+
 	// If true, the transformations will be multi matched
 	MultiMatch bool
 
-	// Used for error logging
+	// Disruptive is true if the rule has a disruptive action blocking
+	// the request, it is used for error logging
 	Disruptive bool
 
+	// SkipAfter is the marker targeted by the skipAfter action of the
+	// rule, it is used to validate the markers once the rules are loaded
+	SkipAfter string
+
+	// UnicodeMap is the code points mapping of the WAF used by the
+	// urlDecodeUni transformation of the rule
+	UnicodeMap *transformations.UnicodeMap
+
 	HasChain bool
 }
 
@@ -160,8 +197,17 @@ func (r *Rule) Status() int {
 // Evaluate will evaluate the current rule for the indicated transaction
 // If the operator matches, actions will be evaluated, and it will return
 // the matched variables, keys and values (MatchData)
-func (r *Rule) Evaluate(tx rules.TransactionState, cache map[transformationKey]*transformationValue) []types.MatchData {
-	return r.doEvaluate(tx.(*Transaction), cache)
+func (r *Rule) Evaluate(tx rules.TransactionState, cache map[transformationKey]*transformationValue) (matchedValues []types.MatchData) {
+	t := tx.(*Transaction)
+	// a faulty operator or action must not take down the whole server,
+	// the panic is reported through RULE_ERROR and the rule does not match
+	defer func() {
+		if err := recover(); err != nil {
+			t.generateRuleError(r, err)
+			matchedValues = nil
+		}
+	}()
+	return r.doEvaluate(t, cache)
 }
 
 func (r *Rule) doEvaluate(tx *Transaction, cache map[transformationKey]*transformationValue) []types.MatchData {
@@ -172,27 +218,26 @@ func (r *Rule) doEvaluate(tx *Transaction, cache map[transformationKey]*transfor
 	if rid == 0 {
 		rid = r.ParentID_
 	}
+	logger := tx.ruleLogger(rid)
+	trace := tx.WAF.debugLogLevel >= loggers.LogLevelTrace
 
 	var matchedValues []types.MatchData
 	// we log if we are the parent rule
-	tx.WAF.Logger.Debug("[%s] [%d] Evaluating rule %d", tx.id, rid, r.ID_)
-	defer tx.WAF.Logger.Debug("[%s] [%d] Finish evaluating rule %d", tx.id, rid, r.ID_)
-	ruleCol := tx.variables.rule
-	ruleCol.SetIndex("id", 0, strconv.Itoa(rid))
-	if r.Msg != nil {
-		ruleCol.SetIndex("msg", 0, r.Msg.String())
-	}
-	ruleCol.SetIndex("rev", 0, r.Rev_)
-	if r.LogData != nil {
-		ruleCol.SetIndex("logdata", 0, r.LogData.String())
-	}
-	ruleCol.SetIndex("severity", 0, r.Severity_.String())
+	logger.Debug("Evaluating rule %d", r.ID_)
+	defer logger.Debug("Finish evaluating rule %d", r.ID_)
+	r.setRuleVariable(tx, rid)
 	// SecMark and SecAction uses nil operator
 	if r.operator == nil {
-		tx.WAF.Logger.Debug("[%s] [%d] Forcing rule %d to match", tx.id, rid, r.ID_)
-		md := &corazarules.MatchData{}
-		matchedValues = append(matchedValues, md)
+		logger.Debug("Forcing rule %d to match", r.ID_)
+		md := tx.arena.NewMatchData()
+		matchedValues = append(tx.arena.MatchDataSlice(1), md)
 		r.matchVariable(tx, md)
+		if r.Msg != nil {
+			md.Message_ = r.Msg.Expand(tx)
+		}
+		if r.LogData != nil {
+			md.Data_ = r.LogData.Expand(tx)
+		}
 	} else {
 		ecol := tx.ruleRemoveTargetByID[r.ID_]
 		for _, v := range r.variables {
@@ -205,24 +250,59 @@ func (r *Rule) doEvaluate(tx *Transaction, cache map[transformationKey]*transfor
 			}
 
 			values = tx.GetField(v)
-			tx.WAF.Logger.Debug("[%s] [%d] Expanding %d arguments for rule %d", tx.id, rid, len(values), r.ID_)
+			logger.Debug("Expanding %d arguments for rule %d", len(values), r.ID_)
 			for i, arg := range values {
-				tx.WAF.Logger.Debug("[%s] [%d] Transforming argument %q for rule %d", tx.id, rid, arg.Value(), r.ID_)
-				args, errs := r.transformArg(arg, i, cache)
-				if len(errs) > 0 {
-					tx.WAF.Logger.Debug("[%s] [%d] Error transforming argument %q for rule %d: %v", tx.id, rid, arg.Value(), r.ID_, errs)
+				if trace {
+					logger.Trace("Variable %s:%s expanded to %q", arg.VariableName(), arg.Key(), arg.Value())
+				}
+				var args []string
+				if ro, ok := r.operator.Operator.(rules.RawInputOperator); ok && ro.RawInput() {
+					// the operator requested the value before transformations
+					args = []string{arg.Value()}
+				} else {
+					logger.Debug("Transforming argument %q for rule %d", arg.Value(), r.ID_)
+					if trace {
+						r.traceTransformations(logger, arg.Value())
+					}
+					var errs []error
+					args, errs = r.transformArg(arg, i, cache, &tx.WAF.TransformationCache)
+					if len(errs) > 0 {
+						logger.Debug("Error transforming argument %q for rule %d: %v", arg.Value(), r.ID_, errs)
+					}
+					logger.Debug("Arguments transformed for rule %d: %v", r.ID_, args)
 				}
-				tx.WAF.Logger.Debug("[%s] [%d] Arguments transformed for rule %d: %v", tx.id, rid, r.ID_, args)
 
 				// args represents the transformed variables
 				for _, carg := range args {
-					match := r.executeOperator(carg, tx)
+					tx.captures = tx.captures[:0]
+					var match bool
+					if tx.literalsAbsent(r, carg) {
+						// the operator can't match a value without its literals
+						match = r.operator.Negation
+					} else {
+						match = r.executeOperator(carg, tx)
+					}
+					if rt := tx.ruleTrace; rt != nil {
+						rt.Variables = append(rt.Variables, types.VariableTrace{
+							Variable:         arg.VariableName(),
+							Key:              arg.Key(),
+							Value:            arg.Value(),
+							TransformedValue: carg,
+							Operator:         r.operator.Function + " " + r.operator.Data,
+							Matched:          match,
+						})
+					}
 					if match {
-						mr := &corazarules.MatchData{
+						mr := tx.arena.NewMatchData()
+						*mr = corazarules.MatchData{
 							VariableName_: v.Variable.Name(),
 							Variable_:     arg.Variable(),
 							Key_:          arg.Key(),
 							Value_:        carg,
+							RawValue_:     arg.Value(),
+						}
+						if len(tx.captures) > 0 {
+							mr.Captures_ = append([]string(nil), tx.captures...)
 						}
 						// Set the txn variables for expansions before usage
 						r.matchVariable(tx, mr)
@@ -233,19 +313,18 @@ func (r *Rule) doEvaluate(tx *Transaction, cache map[transformationKey]*transfor
 						if r.LogData != nil {
 							mr.Data_ = r.LogData.Expand(tx)
 						}
+						if matchedValues == nil && tx.arena != nil {
+							matchedValues = tx.arena.MatchDataSlice(len(values))
+						}
 						matchedValues = append(matchedValues, mr)
 
-						tx.WAF.Logger.Debug("[%s] [%d] Evaluating operator \"%s %s\" against %q: MATCH",
-							tx.id,
-							rid,
+						logger.Debug("Evaluating operator \"%s %s\" against %q: MATCH",
 							r.operator.Function,
 							r.operator.Data,
 							carg,
 						)
 					} else {
-						tx.WAF.Logger.Debug("[%s] [%d] Evaluating operator \"%s %s\" against %q: NO MATCH",
-							tx.id,
-							rid,
+						logger.Debug("Evaluating operator \"%s %s\" against %q: NO MATCH",
 							r.operator.Function,
 							r.operator.Data,
 							carg,
@@ -263,25 +342,49 @@ func (r *Rule) doEvaluate(tx *Transaction, cache map[transformationKey]*transfor
 	// disruptive actions are only evaluated by parent rules
 	if r.ParentID_ == 0 {
 		// we only run the chains for the parent rule
+		level := 0
 		for nr := r.Chain; nr != nil; {
-			tx.WAF.Logger.Debug("[%s] [%d] Evaluating rule chain for %d", tx.id, rid, r.ID_)
+			logger.Debug("Evaluating rule chain for %d", r.ID_)
 			matchedChainValues := nr.Evaluate(tx, cache)
 			if len(matchedChainValues) == 0 {
 				return matchedChainValues
 			}
+			level++
+			for _, md := range matchedChainValues {
+				if cmd, ok := md.(*corazarules.MatchData); ok {
+					cmd.ChainLevel_ = level
+				}
+			}
 			matchedValues = append(matchedValues, matchedChainValues...)
 			nr = nr.Chain
 		}
-		// we need to add disruptive actions in the end, otherwise they would be triggered without their chains.
-		if tx.RuleEngine != types.RuleEngineDetectionOnly {
-			tx.WAF.Logger.Debug("[%s] [%d] Disrupting transaction by rule %d", tx.id, rid, r.ID_)
-			for _, a := range r.actions {
-				if a.Function.Type() == rules.ActionTypeDisruptive || a.Function.Type() == rules.ActionTypeFlow {
-					tx.WAF.Logger.Debug("[%s] [%d] Evaluating action %s for rule %d", tx.id, rid, a.Name, r.ID_)
-					a.Function.Evaluate(r, tx)
+		// we need to add disruptive and flow actions in the end, otherwise they
+		// would be triggered without their chains. Flow actions like skipAfter
+		// are also evaluated in DetectionOnly mode.
+		for _, a := range r.actions {
+			switch a.Function.Type() {
+			case rules.ActionTypeDisruptive:
+				if tx.RuleEngine == types.RuleEngineDetectionOnly {
+					continue
 				}
+				logger.Debug("Disrupting transaction by rule %d", r.ID_)
+			case rules.ActionTypeFlow:
+			default:
+				continue
 			}
-
+			logger.Debug("Evaluating action %s for rule %d", a.Name, r.ID_)
+			a.Function.Evaluate(r, tx)
+			if rt := tx.ruleTrace; rt != nil {
+				rt.Actions = append(rt.Actions, a.Name)
+			}
+		}
+		if tx.interruption == nil && tx.WAF.blocksSeverity(r) {
+			logger.Debug("Disrupting transaction by rule %d with severity %s", r.ID_, r.Severity_.String())
+			tx.Interrupt(&types.Interruption{
+				Status: tx.WAF.BlockSeverityStatus,
+				RuleID: r.ID_,
+				Action: types.InterruptionActionDeny,
+			})
 		}
 		if r.ID_ != 0 {
 			// we avoid matching chains and secmarkers
@@ -291,7 +394,22 @@ func (r *Rule) doEvaluate(tx *Transaction, cache map[transformationKey]*transfor
 	return matchedValues
 }
 
-func (r *Rule) transformArg(arg types.MatchData, argIdx int, cache map[transformationKey]*transformationValue) ([]string, []error) {
+// setRuleVariable populates the RULE variable with the metadata of the
+// evaluated rule
+func (r *Rule) setRuleVariable(tx *Transaction, rid int) {
+	ruleCol := tx.variables.rule
+	ruleCol.SetIndex("id", 0, strconv.Itoa(rid))
+	if r.Msg != nil {
+		ruleCol.SetIndex("msg", 0, r.Msg.String())
+	}
+	ruleCol.SetIndex("rev", 0, r.Rev_)
+	if r.LogData != nil {
+		ruleCol.SetIndex("logdata", 0, r.LogData.String())
+	}
+	ruleCol.SetIndex("severity", 0, r.Severity_.String())
+}
+
+func (r *Rule) transformArg(arg types.MatchData, argIdx int, cache map[transformationKey]*transformationValue, cfg *TransformationCacheConfig) ([]string, []error) {
 	if r.MultiMatch {
 		// TODO in the future, we don't need to run every transformation
 		// We could try for each until found
@@ -300,7 +418,7 @@ func (r *Rule) transformArg(arg types.MatchData, argIdx int, cache map[transform
 		switch {
 		case len(r.transformations) == 0:
 			return []string{arg.Value()}, nil
-		case arg.VariableName() == "TX":
+		case arg.VariableName() == "TX" || cache == nil || !cfg.Enabled:
 			// no cache for TX
 			arg, errs := r.executeTransformations(arg.Value())
 			return []string{arg}, errs
@@ -314,18 +432,7 @@ func (r *Rule) transformArg(arg types.MatchData, argIdx int, cache map[transform
 				argVariable:       arg.Variable(),
 				transformationsID: r.transformationsID,
 			}
-			if cached, ok := cache[key]; ok {
-				return cached.args, cached.errs
-			} else {
-				ars, es := r.executeTransformations(arg.Value())
-				args := []string{ars}
-				errs := es
-				cache[key] = &transformationValue{
-					args: args,
-					errs: es,
-				}
-				return args, errs
-			}
+			return r.executeCachedTransformations(arg.Value(), key, cache, cfg)
 		}
 	}
 }
@@ -335,8 +442,9 @@ func (r *Rule) matchVariable(tx *Transaction, m *corazarules.MatchData) {
 	if rid == 0 {
 		rid = r.ParentID_
 	}
+	logger := tx.ruleLogger(rid)
 	if !m.IsNil() {
-		tx.WAF.Logger.Debug("[%s] [%d] Matching rule %d %s:%s", tx.id, rid, r.ID_, m.VariableName(), m.Key())
+		logger.Debug("Matching rule %d %s:%s", r.ID_, m.VariableName(), m.Key())
 	}
 	// we must match the vars before running the chains
 
@@ -344,8 +452,11 @@ func (r *Rule) matchVariable(tx *Transaction, m *corazarules.MatchData) {
 	tx.matchVariable(m)
 	for _, a := range r.actions {
 		if a.Function.Type() == rules.ActionTypeNondisruptive {
-			tx.WAF.Logger.Debug("[%s] [%d] Evaluating action %s for rule %d", tx.id, rid, a.Name, r.ID_)
+			logger.Debug("Evaluating action %s for rule %d", a.Name, r.ID_)
 			a.Function.Evaluate(r, tx)
+			if rt := tx.ruleTrace; rt != nil {
+				rt.Actions = append(rt.Actions, a.Name)
+			}
 		}
 	}
 }
@@ -353,6 +464,9 @@ func (r *Rule) matchVariable(tx *Transaction, m *corazarules.MatchData) {
 // AddAction adds an action to the rule
 func (r *Rule) AddAction(name string, action rules.Action) error {
 	// TODO add more logic, like one persistent action per rule etc
+	if action.Type() == rules.ActionTypeDisruptive && name != "pass" && name != "allow" {
+		r.Disruptive = true
+	}
 	r.actions = append(r.actions, ruleActionParams{
 		Name:     name,
 		Function: action,
@@ -365,10 +479,17 @@ func (r *Rule) AddAction(name string, action rules.Action) error {
 // it will be used to match the variable, in case of string it will
 // be a fixed match, in case of nil it will match everything
 func (r *Rule) AddVariable(v variables.RuleVariable, key string, iscount bool) error {
+	// Prevent sigsev
+	if r == nil {
+		return fmt.Errorf("cannot add a variable to an undefined rule")
+	}
 	var re *regexp.Regexp
 	if len(key) > 2 && key[0] == '/' && key[len(key)-1] == '/' {
 		key = key[1 : len(key)-1]
-		re = regexp.MustCompile(key)
+		var err error
+		if re, err = regexp.Compile(key); err != nil {
+			return err
+		}
 	}
 
 	r.variables = append(r.variables, ruleVariableParams{
@@ -394,7 +515,10 @@ func (r *Rule) AddVariableNegation(v variables.RuleVariable, key string) error {
 	var re *regexp.Regexp
 	if len(key) > 2 && key[0] == '/' && key[len(key)-1] == '/' {
 		key = key[1 : len(key)-1]
-		re = regexp.MustCompile(key)
+		var err error
+		if re, err = regexp.Compile(key); err != nil {
+			return err
+		}
 	}
 	// Prevent sigsev
 	if r == nil {
@@ -435,8 +559,8 @@ func (r *Rule) AddTransformation(name string, t rules.Transformation) error {
 	if t == nil || name == "" {
 		return fmt.Errorf("invalid transformation %q not found", name)
 	}
-	r.transformations = append(r.transformations, ruleTransformationParams{name, t})
 	r.transformationsID = transformationID(r.transformationsID, name)
+	r.transformations = append(r.transformations, ruleTransformationParams{name, t, r.transformationsID})
 	return nil
 }
 
@@ -444,6 +568,7 @@ func (r *Rule) AddTransformation(name string, t rules.Transformation) error {
 // it is mostly used by the "none" transformation
 func (r *Rule) ClearTransformations() {
 	r.transformations = []ruleTransformationParams{}
+	r.transformationsID = 0
 }
 
 // SetOperator sets the operator of the rule
@@ -494,6 +619,21 @@ func (r *Rule) executeTransformations(value string) (string, []error) {
 	return value, errs
 }
 
+// traceTransformations logs the output of every transformation step,
+// it is only used with the highest debug log level as the
+// transformations are executed again.
+func (r *Rule) traceTransformations(logger loggers.DebugLogger, value string) {
+	for _, t := range r.transformations {
+		v, err := t.Function(value)
+		if err != nil {
+			logger.Trace("Transformation %s failed: %s", t.Name, err.Error())
+			continue
+		}
+		logger.Trace("Transformation %s: %q", t.Name, v)
+		value = v
+	}
+}
+
 // NewRule returns a new initialized rule
 func NewRule() *Rule {
 	return &Rule{
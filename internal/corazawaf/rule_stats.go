@@ -0,0 +1,120 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+// ruleStats counts the rule matches of a WAF, and the rules skipped
+// because their targets were empty, the counters are created on the first
+// match and incremented atomically
+type ruleStats struct {
+	// phases is the first field to be 64-bit aligned on 32-bit platforms
+	phases [types.PhaseLogging + 1]uint64
+
+	mu      sync.RWMutex
+	rules   map[int]*uint64
+	tags    map[string]*uint64
+	skipped map[int]*uint64
+}
+
+func newRuleStats() *ruleStats {
+	return &ruleStats{
+		rules:   map[int]*uint64{},
+		tags:    map[string]*uint64{},
+		skipped: map[int]*uint64{},
+	}
+}
+
+// record counts a match of the rule in the phase
+func (s *ruleStats) record(r *Rule, phase types.RulePhase) {
+	if s == nil {
+		return
+	}
+	if phase <= types.PhaseLogging {
+		atomic.AddUint64(&s.phases[phase], 1)
+	}
+	atomic.AddUint64(s.ruleCounter(s.rules, r.ID_), 1)
+	for _, tag := range r.Tags_ {
+		atomic.AddUint64(s.tagCounter(tag), 1)
+	}
+}
+
+// skip counts an evaluation of the rule skipped because its targets were
+// empty
+func (s *ruleStats) skip(r *Rule) {
+	if s == nil {
+		return
+	}
+	atomic.AddUint64(s.ruleCounter(s.skipped, r.ID_), 1)
+}
+
+// ruleCounter returns the counter of the rule in rules or skipped
+func (s *ruleStats) ruleCounter(counters map[int]*uint64, id int) *uint64 {
+	s.mu.RLock()
+	c, ok := counters[id]
+	s.mu.RUnlock()
+	if ok {
+		return c
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok = counters[id]; !ok {
+		c = new(uint64)
+		counters[id] = c
+	}
+	return c
+}
+
+func (s *ruleStats) tagCounter(tag string) *uint64 {
+	s.mu.RLock()
+	c, ok := s.tags[tag]
+	s.mu.RUnlock()
+	if ok {
+		return c
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok = s.tags[tag]; !ok {
+		c = new(uint64)
+		s.tags[tag] = c
+	}
+	return c
+}
+
+// RuleStats returns a snapshot of the rule matches counted since the WAF
+// was created, the rules and tags without matches are not included
+func (w *WAF) RuleStats() types.RuleStats {
+	stats := types.RuleStats{
+		Rules:   map[int]uint64{},
+		Tags:    map[string]uint64{},
+		Phases:  map[types.RulePhase]uint64{},
+		Skipped: map[int]uint64{},
+	}
+	s := w.ruleStats
+	if s == nil {
+		return stats
+	}
+	for phase := range s.phases {
+		if n := atomic.LoadUint64(&s.phases[phase]); n > 0 {
+			stats.Phases[types.RulePhase(phase)] = n
+		}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for id, c := range s.rules {
+		stats.Rules[id] = atomic.LoadUint64(c)
+	}
+	for tag, c := range s.tags {
+		stats.Tags[tag] = atomic.LoadUint64(c)
+	}
+	for id, c := range s.skipped {
+		stats.Skipped[id] = atomic.LoadUint64(c)
+	}
+	return stats
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// the transaction pool of tinygo builds is not concurrent safe
+//go:build !tinygo
+// +build !tinygo
+
+package corazawaf
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+func TestRuleStats(t *testing.T) {
+	waf := NewWAF()
+	for id, phase := range map[int]types.RulePhase{1: types.PhaseRequestHeaders, 2: types.PhaseResponseHeaders} {
+		r := NewRule()
+		r.ID_ = id
+		r.Phase_ = phase
+		r.Tags_ = []string{"attack-sqli"}
+		if err := waf.Rules.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tx := waf.NewTransaction()
+			defer tx.Close()
+			tx.ProcessRequestHeaders()
+		}()
+	}
+	wg.Wait()
+
+	stats := waf.RuleStats()
+	if len(stats.Rules) != 1 || stats.Rules[1] != 10 {
+		t.Errorf("expected 10 matches of rule 1, got %v", stats.Rules)
+	}
+	if stats.Tags["attack-sqli"] != 10 || stats.Phases[types.PhaseRequestHeaders] != 10 {
+		t.Errorf("unexpected tag and phase matches %v %v", stats.Tags, stats.Phases)
+	}
+	if clone := waf.CloneWithOverrides(); len(clone.RuleStats().Rules) != 0 {
+		t.Error("expected the clone to have its own counters")
+	}
+}
@@ -6,6 +6,8 @@ package corazawaf
 import (
 	"testing"
 
+	"github.com/corazawaf/coraza/v3/rules"
+	"github.com/corazawaf/coraza/v3/types"
 	"github.com/corazawaf/coraza/v3/types/variables"
 )
 
@@ -57,3 +59,45 @@ func TestVariablesRxAreCaseSensitive(t *testing.T) {
 		t.Error("variable key is not case insensitive")
 	}
 }
+
+func TestAddVariableInvalidRegex(t *testing.T) {
+	rule := NewRule()
+	if err := rule.AddVariable(variables.Args, "/(/", false); err == nil {
+		t.Error("expected error for invalid regex key")
+	}
+	if err := rule.AddVariableNegation(variables.Args, "/(/"); err == nil {
+		t.Error("expected error for invalid regex exception")
+	}
+}
+
+type panickingOperator struct{}
+
+func (panickingOperator) Evaluate(rules.TransactionState, string) bool {
+	panic("unexpected input")
+}
+
+func TestRuleEvaluatePanicRecovery(t *testing.T) {
+	waf := NewWAF()
+	rule := NewRule()
+	rule.ID_ = 10
+	rule.Phase_ = types.PhaseRequestHeaders
+	if err := rule.AddVariable(variables.RequestURI, "", false); err != nil {
+		t.Fatal(err)
+	}
+	rule.SetOperator(panickingOperator{}, "@panic", "")
+	if err := waf.Rules.Add(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/", "GET", "HTTP/1.1")
+	if it := tx.ProcessRequestHeaders(); it != nil {
+		t.Errorf("unexpected interruption %v", it)
+	}
+	if v := tx.variables.ruleError.String(); v != "1" {
+		t.Errorf("expected RULE_ERROR to be 1, got %q", v)
+	}
+	if v := tx.variables.ruleErrorMsg.String(); v != "rule 10: unexpected input" {
+		t.Errorf("unexpected RULE_ERROR_MSG %q", v)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/corazawaf/coraza/v3/internal/strings"
+	"github.com/corazawaf/coraza/v3/rules"
 	"github.com/corazawaf/coraza/v3/types"
 	"github.com/corazawaf/coraza/v3/types/variables"
 )
@@ -18,6 +19,13 @@ import (
 // after compilation
 type RuleGroup struct {
 	rules []*Rule
+
+	// shared contains the rules inherited from a cloned WAF
+	shared map[*Rule]struct{}
+
+	// plan contains the independent rules evaluated concurrently, it is
+	// nil until Plan is called
+	plan *rulePlan
 }
 
 // Add a rule to the collection
@@ -32,6 +40,7 @@ func (rg *RuleGroup) Add(rule *Rule) error {
 		return fmt.Errorf("there is a another rule with id %d", rule.ID_)
 	}
 	rg.rules = append(rg.rules, rule)
+	rg.plan = nil
 	return nil
 }
 
@@ -57,6 +66,7 @@ func (rg *RuleGroup) DeleteByID(id int) {
 			copy(rg.rules[i:], rg.rules[i+1:])
 			rg.rules[len(rg.rules)-1] = nil
 			rg.rules = rg.rules[:len(rg.rules)-1]
+			rg.plan = nil
 		}
 	}
 }
@@ -88,24 +98,73 @@ func (rg *RuleGroup) Count() int {
 	return len(rg.rules)
 }
 
+// ReloadDataFiles reloads the data files of the operators implementing
+// rules.ReloadableOperator, like @pmFromFile and @ipMatchFromFile. Every
+// operator is reloaded even if one fails, the error reports the first
+// failure and the failed operators keep their previous data.
+func (rg *RuleGroup) ReloadDataFiles() error {
+	var firstErr error
+	for _, r := range rg.rules {
+		for cr := r; cr != nil; cr = cr.Chain {
+			if cr.operator == nil {
+				continue
+			}
+			ro, ok := cr.operator.Operator.(rules.ReloadableOperator)
+			if !ok {
+				continue
+			}
+			if err := ro.Reload(); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("failed to reload the data of rule %d: %w", r.ID_, err)
+			}
+		}
+	}
+	return firstErr
+}
+
 // Clear will remove each and every rule stored
 func (rg *RuleGroup) Clear() {
 	rg.rules = []*Rule{}
+	rg.plan = nil
 }
 
 // Eval rules for the specified phase, between 1 and 5
 // Returns true if transaction is disrupted
 func (rg *RuleGroup) Eval(phase types.RulePhase, tx *Transaction) bool {
-	tx.WAF.Logger.Debug("[%s] Evaluating phase %d", tx.id, int(phase))
+	tx.debugLogger.Debug("Evaluating phase %d", int(phase))
 	tx.LastPhase = phase
+	if tx.accessListAllowed && phase != types.PhaseLogging {
+		tx.debugLogger.Debug("Skipping phase %d, the request is allowed by the access list", int(phase))
+		return false
+	}
 	usedRules := 0
 	ts := time.Now().UnixNano()
 	transformationCache := tx.transformationCache
 	for k := range transformationCache {
 		delete(transformationCache, k)
 	}
+	tx.emptyVariables = [types.VariablesCount]uint8{}
+	// the rules are not skipped while tracing, and the independent rules
+	// are not evaluated concurrently while timing the rules
+	prefilter := rg.plan != nil && !tx.tracing
+	for k := range tx.literalScans {
+		delete(tx.literalScans, k)
+	}
+	if prefilter && rg.plan.literalCount > 0 {
+		tx.literalPlan = rg.plan
+	}
+	var plan *phasePlan
+	if prefilter && tx.WAF.ParallelRuleWorkers > 0 && tx.WAF.RulePerfTime == 0 {
+		plan = &rg.plan.phases[phase]
+		if cap(tx.planState) < len(rg.rules) {
+			tx.planState = make([]uint8, len(rg.rules))
+		}
+		tx.planState = tx.planState[:len(rg.rules)]
+		for i := range tx.planState {
+			tx.planState[i] = planPending
+		}
+	}
 RulesLoop:
-	for _, r := range tx.WAF.Rules.GetRules() {
+	for i, r := range rg.rules {
 		if tx.interruption != nil && phase != types.PhaseLogging {
 			break RulesLoop
 		}
@@ -115,11 +174,9 @@ RulesLoop:
 		}
 
 		// we skip the rule in case it's in the excluded list
-		for _, trb := range tx.ruleRemoveByID {
-			if trb == r.ID_ {
-				tx.WAF.Logger.Debug("[%s] Skipping rule %d", tx.id, r.ID_)
-				continue RulesLoop
-			}
+		if tx.ruleRemoved(r.ID_) {
+			tx.debugLogger.Debug("Skipping rule %d", r.ID_)
+			continue RulesLoop
 		}
 
 		// we always evaluate secmarkers
@@ -127,12 +184,15 @@ RulesLoop:
 			if r.SecMark_ == tx.SkipAfter {
 				tx.SkipAfter = ""
 			} else {
-				tx.WAF.Logger.Debug("[%s] Skipping rule %d because of SkipAfter, expecting %s and got: %q", tx.id, r.ID_, tx.SkipAfter, r.SecMark_)
+				tx.debugLogger.Debug("Skipping rule %d because of SkipAfter, expecting %s and got: %q", r.ID_, tx.SkipAfter, r.SecMark_)
 			}
 			continue
 		}
 		if tx.Skip > 0 {
-			tx.Skip--
+			// markers are not counted by skip
+			if r.SecMark_ == "" {
+				tx.Skip--
+			}
 			// Skipping rule
 			continue
 		}
@@ -141,12 +201,63 @@ RulesLoop:
 		tx.variables.matchedVars.Reset()
 		tx.variables.matchedVarsNames.Reset()
 
-		r.Evaluate(tx, transformationCache)
+		if prefilter && rg.plan.targetsEmpty(tx, i) {
+			tx.debugLogger.Debug("Skipping rule %d, its targets are empty", r.ID_)
+			r.setRuleVariable(tx, r.ID_)
+			tx.WAF.ruleStats.skip(r)
+			usedRules++
+			continue
+		}
+		if plan != nil && plan.group[i] >= 0 {
+			if tx.planState[i] == planPending {
+				rg.evalGroup(tx, plan.groups[plan.group[i]])
+			}
+			if tx.planState[i] == planNoMatch {
+				r.setRuleVariable(tx, r.ID_)
+				usedRules++
+				continue
+			}
+		}
+
+		var start time.Time
+		perf := tx.WAF.RulePerfTime > 0
+		if tx.tracing || perf {
+			start = time.Now()
+		}
+		if tx.tracing {
+			tx.ruleTrace = &types.RuleTrace{
+				RuleID: r.ID_,
+				Phase:  phase,
+			}
+		}
+		matched := r.Evaluate(tx, transformationCache)
+		if perf {
+			if tx.ruleDurations == nil {
+				tx.ruleDurations = map[int]time.Duration{}
+			}
+			tx.ruleDurations[r.ID_] += time.Since(start)
+		}
+		if rt := tx.ruleTrace; rt != nil {
+			rt.Matched = len(matched) > 0
+			rt.Duration = time.Since(start)
+			tx.trace = append(tx.trace, *rt)
+			tx.ruleTrace = nil
+		}
 		tx.Capture = false // we reset captures
+		if prefilter && rg.plan.mutatesInputs[i] {
+			tx.emptyVariables = [types.VariablesCount]uint8{}
+		}
 		usedRules++
 	}
-	tx.WAF.Logger.Debug("[%s] Finished phase %d", tx.id, int(phase))
-	tx.stopWatches[phase] = time.Now().UnixNano() - ts
+	tx.literalPlan = nil
+	// skip and skipAfter don't cross phases
+	if tx.SkipAfter != "" {
+		tx.debugLogger.Debug("SecMarker %q not found in phase %d", tx.SkipAfter, int(phase))
+		tx.SkipAfter = ""
+	}
+	tx.Skip = 0
+	tx.debugLogger.Debug("Finished phase %d", int(phase))
+	tx.stopWatches[phase] += time.Now().UnixNano() - ts
 	return tx.interruption != nil
 }
 
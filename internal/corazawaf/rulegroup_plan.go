@@ -0,0 +1,499 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	ahocorasick "github.com/petar-dambovaliev/aho-corasick"
+
+	"github.com/corazawaf/coraza/v3/collection"
+	"github.com/corazawaf/coraza/v3/rules"
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/corazawaf/coraza/v3/types/variables"
+)
+
+// The rules of a phase are evaluated in order, but most of them only
+// test the request or the response with an operator and don't depend on
+// the rules evaluated before them. The planner groups these independent
+// rules, the operators of a group are tested concurrently when the
+// evaluation reaches it, and the rules that can't match are then skipped
+// by the sequential evaluation. The rules that can match are evaluated as
+// usual, so the actions, chains, skips and markers keep their semantics,
+// their operators are executed twice but few rules match most requests.
+//
+// A rule is independent if its operator has no side effect and its
+// targets are inputs of the transaction that the rules can't modify. A
+// rule with another operator, like @rsub or @restpath, may modify the
+// inputs and ends the current group.
+//
+// The planner also indexes the targets of the rules, a rule whose targets
+// are all empty can't match and is skipped without running its
+// transformations, like the ARGS_POST rules of a request without body.
+//
+// Finally the literals required by the operators, like the words of an
+// @rx pattern, are compiled into a single automaton. Every transformed
+// value is scanned once for the literals of all the rules, and the
+// operators of the rules whose literals are absent are not executed.
+
+// independentOperators are the operators without side effects, their
+// captures are only written when the transaction is capturing
+var independentOperators = map[string]struct{}{
+	"beginsWith": {}, "contains": {}, "detectSQLi": {}, "detectXSS": {},
+	"endsWith": {}, "eq": {}, "ge": {}, "gt": {}, "ipMatch": {},
+	"ipMatchFromDataset": {}, "ipMatchFromFile": {}, "le": {}, "lt": {},
+	"noMatch": {}, "pm": {}, "pmFromFile": {}, "rx": {}, "streq": {},
+	"unconditionalMatch": {}, "validateByteRange": {},
+	"validateNid": {}, "validateUrlEncoding": {}, "validateUtf8Encoding": {},
+	"verifyCC": {}, "verifyCPF": {}, "verifySSN": {}, "within": {},
+}
+
+// inputVariables are the variables populated by the connector and the
+// body processors, they are not modified by the rules of a phase
+var inputVariables = map[variables.RuleVariable]struct{}{
+	variables.ResponseContentType: {}, variables.UniqueID: {},
+	variables.ArgsCombinedSize: {}, variables.AuthType: {},
+	variables.FilesCombinedSize: {}, variables.FullRequest: {},
+	variables.FullRequestLength: {}, variables.InboundDataError: {},
+	variables.MultipartBoundaryQuoted: {}, variables.MultipartBoundaryWhitespace: {},
+	variables.MultipartCrlfLfLines: {}, variables.MultipartDataAfter: {},
+	variables.MultipartDataBefore: {}, variables.MultipartFileLimitExceeded: {},
+	variables.MultipartHeaderFolding: {}, variables.MultipartInvalidHeaderFolding: {},
+	variables.MultipartInvalidPart: {}, variables.MultipartInvalidQuoting: {},
+	variables.MultipartLfLine: {}, variables.MultipartMissingSemicolon: {},
+	variables.MultipartStrictError: {}, variables.MultipartUnmatchedBoundary: {},
+	variables.OutboundDataError: {}, variables.PathInfo: {},
+	variables.QueryString: {}, variables.RemoteAddr: {}, variables.RemoteHost: {},
+	variables.RemotePort: {}, variables.ReqbodyError: {}, variables.ReqbodyErrorMsg: {},
+	variables.ReqbodyProcessorError: {}, variables.ReqbodyProcessorErrorMsg: {},
+	variables.RequestBasename: {}, variables.RequestBody: {},
+	variables.RequestBodyLength: {}, variables.RequestFilename: {},
+	variables.RequestLine: {}, variables.RequestMethod: {},
+	variables.RequestProtocol: {}, variables.RequestURI: {},
+	variables.RequestURIRaw: {}, variables.ResponseBody: {},
+	variables.ResponseContentLength: {}, variables.ResponseProtocol: {},
+	variables.ResponseStatus: {}, variables.ServerAddr: {},
+	variables.ServerName: {}, variables.ServerPort: {}, variables.StatusLine: {},
+	variables.ResponseHeadersNames: {}, variables.RequestHeadersNames: {},
+	variables.Args: {}, variables.ArgsGet: {}, variables.ArgsPost: {},
+	variables.ArgsPath: {}, variables.FilesSizes: {}, variables.FilesNames: {},
+	variables.FilesTmpContent: {}, variables.MultipartFilename: {},
+	variables.MultipartName: {}, variables.Files: {},
+	variables.RequestCookies: {}, variables.RequestHeaders: {},
+	variables.ResponseHeaders: {}, variables.RequestCookiesNames: {},
+	variables.FilesTmpNames: {}, variables.ArgsNames: {},
+	variables.ArgsGetNames: {}, variables.ArgsPostNames: {},
+	variables.UrlencodedError: {}, variables.ResponseXML: {},
+	variables.RequestXML: {}, variables.XML: {},
+	variables.MultipartPartHeaders: {}, variables.RequestHeadersRaw: {},
+	variables.RequestCookiesError: {}, variables.RequestCookiesErrorMsg: {},
+	variables.StreamInputBody: {}, variables.StreamOutputBody: {},
+	variables.ResponseBodyDecompressionError: {}, variables.RequestBodyDecompressionError: {},
+	variables.RequestPseudoHeaders: {}, variables.RequestProtocolAnomalies: {},
+	variables.RequestSOAP: {}, variables.RequestXMLAnomalies: {},
+	variables.TLSJA3: {}, variables.TLSJA3Hash: {}, variables.TLSJA4: {},
+	variables.SSLClientVerify: {}, variables.SSLClientSDN: {},
+	variables.SSLClientSDNCN: {}, variables.SSLClientIDN: {},
+	variables.SSLClientMSerial: {}, variables.SSLClientVStart: {},
+	variables.SSLClientVEnd: {}, variables.SSLClientVRemain: {},
+	variables.SSLClientSAN: {}, variables.RequestURILowercase: {},
+	variables.RequestFilenameDecoded: {}, variables.RequestFilenameNormalized: {},
+	variables.PathNormalizationChanged: {},
+}
+
+// rulePlan contains the groups of independent rules of every phase
+type rulePlan struct {
+	phases [types.PhaseLogging + 1]phasePlan
+	// targets contains the variables targeted by every rule of the
+	// RuleGroup, nil for the rules that can match without values
+	targets [][]variables.RuleVariable
+	// mutatesInputs is true for the rules that may modify the inputs of
+	// the transaction
+	mutatesInputs []bool
+	// literals contains the indexes in literalScanner of the literals
+	// required by the operator of the rules and chained rules having them
+	literals       map[*Rule][]int
+	literalScanner ahocorasick.AhoCorasick
+	literalCount   int
+}
+
+type phasePlan struct {
+	// group is the index in groups of the group of every rule of the
+	// RuleGroup, -1 for the rules evaluated sequentially
+	group []int
+	// groups contains the indexes of the rules of every group
+	groups [][]int
+}
+
+// Plan indexes the targets of the rules and groups the independent rules
+// of every phase so they can be evaluated concurrently, see
+// WAF.ParallelRuleWorkers. It must be called once the rules are loaded,
+// adding, removing or updating rules discards the plan.
+func (rg *RuleGroup) Plan() {
+	plan := &rulePlan{
+		targets:       make([][]variables.RuleVariable, len(rg.rules)),
+		mutatesInputs: make([]bool, len(rg.rules)),
+	}
+	for i, r := range rg.rules {
+		plan.targets[i] = r.targets()
+		plan.mutatesInputs[i] = !r.preservesInputs()
+	}
+	plan.planLiterals(rg.rules)
+	for phase := types.PhaseRequestHeaders; phase <= types.PhaseLogging; phase++ {
+		pp := &plan.phases[phase]
+		pp.group = make([]int, len(rg.rules))
+		var current []int
+		closeGroup := func() {
+			if len(current) > 1 {
+				for _, i := range current {
+					pp.group[i] = len(pp.groups)
+				}
+				pp.groups = append(pp.groups, current)
+			}
+			current = nil
+		}
+		for i, r := range rg.rules {
+			pp.group[i] = -1
+			if r.Phase_ != phase && r.Phase_ != 0 {
+				continue
+			}
+			if r.independent() {
+				current = append(current, i)
+			}
+			if plan.mutatesInputs[i] {
+				closeGroup()
+			}
+		}
+		closeGroup()
+	}
+	rg.plan = plan
+}
+
+// planLiterals builds the automaton scanning the values for the literals
+// required by the operators of the rules
+func (p *rulePlan) planLiterals(rs []*Rule) {
+	ids := map[string]int{}
+	var patterns []string
+	p.literals = map[*Rule][]int{}
+	for _, r := range rs {
+		for cr := r; cr != nil; cr = cr.Chain {
+			if cr.operator == nil {
+				continue
+			}
+			lo, ok := cr.operator.Operator.(rules.LiteralOperator)
+			if !ok {
+				continue
+			}
+			literals := lo.Literals()
+			if len(literals) == 0 {
+				continue
+			}
+			rids := make([]int, 0, len(literals))
+			for _, l := range literals {
+				id, ok := ids[l]
+				if !ok {
+					id = len(patterns)
+					ids[l] = id
+					patterns = append(patterns, l)
+				}
+				rids = append(rids, id)
+			}
+			p.literals[cr] = rids
+		}
+	}
+	if len(patterns) == 0 {
+		return
+	}
+	// the literals overlap, every occurrence is reported
+	builder := ahocorasick.NewAhoCorasickBuilder(ahocorasick.Opts{
+		AsciiCaseInsensitive: true,
+		MatchKind:            ahocorasick.StandardMatch,
+		DFA:                  true,
+	})
+	p.literalScanner = builder.Build(patterns)
+	p.literalCount = len(patterns)
+}
+
+// literalKey identifies a scanned value, like transformationKey it relies
+// on the address of the string, which is kept alive by the scan
+type literalKey struct {
+	data   uintptr
+	length int
+}
+
+// literalScan records which literals of the plan a value contains
+type literalScan struct {
+	value string
+	found []uint64
+}
+
+// literalsAbsent returns true if the value contains none of the literals
+// required by the operator of the rule, the operator can't match it
+func (tx *Transaction) literalsAbsent(r *Rule, value string) bool {
+	p := tx.literalPlan
+	if p == nil {
+		return false
+	}
+	ids, ok := p.literals[r]
+	if !ok {
+		return false
+	}
+	found := tx.scanLiterals(p, value)
+	for _, id := range ids {
+		if found[id/64]&(1<<(id%64)) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// scanLiterals returns the bitset of the literals contained by the value,
+// a value is scanned once per phase
+func (tx *Transaction) scanLiterals(p *rulePlan, value string) []uint64 {
+	key := literalKey{(*reflect.StringHeader)(unsafe.Pointer(&value)).Data, len(value)}
+	if s, ok := tx.literalScans[key]; ok {
+		return s.found
+	}
+	s := &literalScan{value: value, found: make([]uint64, (p.literalCount+63)/64)}
+	iter := p.literalScanner.IterOverlapping(value)
+	for m := iter.Next(); m != nil; m = iter.Next() {
+		id := m.Pattern()
+		s.found[id/64] |= 1 << (id % 64)
+	}
+	if tx.literalScans == nil {
+		tx.literalScans = map[literalKey]*literalScan{}
+	}
+	tx.literalScans[key] = s
+	return s.found
+}
+
+// targets returns the distinct variables targeted by the rule, or nil if
+// the rule can match without values: rules without operator match
+// unconditionally and the count of an empty target is zero
+func (r *Rule) targets() []variables.RuleVariable {
+	if r.operator == nil {
+		return nil
+	}
+	var targets []variables.RuleVariable
+	for _, v := range r.variables {
+		if v.Count {
+			return nil
+		}
+		if !variableInSlice(v.Variable, targets) {
+			targets = append(targets, v.Variable)
+		}
+	}
+	return targets
+}
+
+func variableInSlice(v variables.RuleVariable, vs []variables.RuleVariable) bool {
+	for _, x := range vs {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// targetsEmpty returns true if every target of the rule i is empty
+func (p *rulePlan) targetsEmpty(tx *Transaction, i int) bool {
+	targets := p.targets[i]
+	if len(targets) == 0 {
+		return false
+	}
+	for _, v := range targets {
+		if !tx.emptyVariable(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// independent returns true if the rule can be tested without depending on
+// the rules evaluated before it. The count of a target is not monotonic,
+// removing a target with ctl:ruleRemoveTargetById could make it match.
+func (r *Rule) independent() bool {
+	if r.operator == nil || len(r.variables) == 0 || !independentOperator(r.operator) {
+		return false
+	}
+	for _, v := range r.variables {
+		if _, ok := inputVariables[v.Variable]; !ok || v.Count {
+			return false
+		}
+	}
+	return true
+}
+
+// preservesInputs returns true if the evaluation of the rule and its
+// chain doesn't modify the inputs of the transaction
+func (r *Rule) preservesInputs() bool {
+	for cr := r; cr != nil; cr = cr.Chain {
+		if cr.operator == nil {
+			continue
+		}
+		if _, ok := independentOperators[operatorName(cr.operator)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// independentOperator returns true if the operator has no side effect
+// and its argument has no macro
+func independentOperator(op *ruleOperatorParams) bool {
+	_, ok := independentOperators[operatorName(op)]
+	return ok && !strings.Contains(op.Data, "%{")
+}
+
+func operatorName(op *ruleOperatorParams) string {
+	return strings.TrimPrefix(strings.TrimPrefix(op.Function, "!"), "@")
+}
+
+// Values of Transaction.emptyVariables
+const (
+	variableUnknown uint8 = iota
+	variableEmpty
+	variableNotEmpty
+)
+
+// emptyVariable returns true if the variable has no value. The result is
+// kept for the inputs until a rule modifying them is evaluated.
+func (tx *Transaction) emptyVariable(v variables.RuleVariable) bool {
+	_, input := inputVariables[v]
+	if input && tx.emptyVariables[v] != variableUnknown {
+		return tx.emptyVariables[v] == variableEmpty
+	}
+	empty := true
+	switch col := tx.Collection(v).(type) {
+	case nil:
+	case collection.Visitor:
+		col.Visit(func(string, string) bool {
+			empty = false
+			return false
+		})
+	default:
+		empty = false
+	}
+	if input {
+		tx.emptyVariables[v] = variableNotEmpty
+		if empty {
+			tx.emptyVariables[v] = variableEmpty
+		}
+	}
+	return empty
+}
+
+// Values of Transaction.planState
+const (
+	planPending uint8 = iota
+	planNoMatch
+	planMayMatch
+)
+
+// planTarget is a value of a target of a rule, idx is the index of the
+// value in the values of the target, it identifies the cached
+// transformations
+type planTarget struct {
+	value types.MatchData
+	idx   int
+}
+
+// planJob is an independent rule to test
+type planJob struct {
+	rule    *Rule
+	idx     int
+	targets []planTarget
+}
+
+// evalGroup tests the rules of a group concurrently and records in
+// tx.planState whether each of them can match
+func (rg *RuleGroup) evalGroup(tx *Transaction, group []int) {
+	jobs := make([]planJob, 0, len(group))
+	for _, i := range group {
+		r := rg.rules[i]
+		tx.planState[i] = planMayMatch
+		if tx.ruleRemoved(r.ID_) {
+			// the rule is skipped by the sequential evaluation
+			continue
+		}
+		// the targets are collected sequentially, the collections and
+		// the arena are not concurrent safe
+		job := planJob{rule: r, idx: i}
+		ecol := tx.ruleRemoveTargetByID[r.ID_]
+		for _, v := range r.variables {
+			for _, c := range ecol {
+				if c.Variable == v.Variable {
+					v.Exceptions = append(v.Exceptions[:len(v.Exceptions):len(v.Exceptions)], ruleVariableException{c.KeyStr, nil})
+				}
+			}
+			for idx, value := range tx.GetField(v) {
+				job.targets = append(job.targets, planTarget{value, idx})
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	tx.debugLogger.Debug("Testing %d independent rules with %d workers", len(jobs), tx.WAF.ParallelRuleWorkers)
+
+	var next int32 = -1
+	work := func() {
+		var cache map[transformationKey]*transformationValue
+		if tx.WAF.TransformationCache.Enabled {
+			cache = map[transformationKey]*transformationValue{}
+		}
+		for {
+			j := int(atomic.AddInt32(&next, 1))
+			if j >= len(jobs) {
+				return
+			}
+			if !jobs[j].rule.mayMatch(tx, jobs[j].targets, cache) {
+				tx.planState[jobs[j].idx] = planNoMatch
+			}
+		}
+	}
+	workers := tx.WAF.ParallelRuleWorkers
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+	wg := sync.WaitGroup{}
+	for w := 1; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work()
+		}()
+	}
+	work()
+	wg.Wait()
+}
+
+// mayMatch tests the operator of the rule against its targets, it
+// returns true if the rule can match or if the operator failed, the rule
+// is then evaluated sequentially
+func (r *Rule) mayMatch(tx *Transaction, targets []planTarget, cache map[transformationKey]*transformationValue) (matched bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			matched = true
+		}
+	}()
+	raw := false
+	if ro, ok := r.operator.Operator.(rules.RawInputOperator); ok {
+		raw = ro.RawInput()
+	}
+	for _, t := range targets {
+		args := []string{t.value.Value()}
+		if !raw {
+			args, _ = r.transformArg(t.value, t.idx, cache, &tx.WAF.TransformationCache)
+		}
+		for _, arg := range args {
+			if r.executeOperator(arg, tx) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -4,9 +4,16 @@
 package corazawaf
 
 import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/corazawaf/coraza/v3/macro"
+	"github.com/corazawaf/coraza/v3/rules"
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/corazawaf/coraza/v3/types/variables"
 )
 
 func TestRG(t *testing.T) {
@@ -40,3 +47,195 @@ func TestRG(t *testing.T) {
 		t.Error("Failed to remove rule from rulegroup")
 	}
 }
+
+func TestPlan(t *testing.T) {
+	rg := NewRuleGroup()
+	add := func(r *Rule) {
+		t.Helper()
+		if err := rg.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(newCandidateTestRule(t, 1, types.PhaseRequestHeaders, variables.Args, "a", false))
+	add(newCandidateTestRule(t, 2, types.PhaseRequestHeaders, variables.TX, "a", false))
+	add(newCandidateTestRule(t, 3, types.PhaseRequestHeaders, variables.RequestURI, "a", true))
+	rsub := newCandidateTestRule(t, 4, types.PhaseRequestHeaders, variables.Args, "a", false)
+	rsub.SetOperator(testOperator(func(string) bool { return false }), "@rsub", "s/a/b/")
+	add(rsub)
+	add(newCandidateTestRule(t, 5, types.PhaseRequestHeaders, variables.Args, "a", false))
+	add(newCandidateTestRule(t, 6, types.PhaseRequestBody, variables.Args, "a", false))
+	count := newCandidateTestRule(t, 7, types.PhaseRequestHeaders, variables.Args, "a", false)
+	if err := count.AddVariable(variables.Args, "", true); err != nil {
+		t.Fatal(err)
+	}
+	add(count)
+	add(newCandidateTestRule(t, 8, types.PhaseRequestHeaders, variables.Args, "a", false))
+
+	rg.Plan()
+	pp := rg.plan.phases[types.PhaseRequestHeaders]
+	// rules 1 and 3 are grouped, 5 and 8 are grouped after the @rsub rule
+	want := []int{0, -1, 0, -1, 1, -1, -1, 1}
+	if !reflect.DeepEqual(pp.group, want) {
+		t.Errorf("unexpected groups %v, want %v", pp.group, want)
+	}
+	if err := rg.Add(NewRule()); err != nil {
+		t.Fatal(err)
+	}
+	if rg.plan != nil {
+		t.Error("expected the plan to be discarded")
+	}
+}
+
+func TestParallelEval(t *testing.T) {
+	newWAF := func(workers int) *WAF {
+		waf := NewWAF()
+		waf.ParallelRuleWorkers = workers
+		for i := 1; i <= 20; i++ {
+			r := newCandidateTestRule(t, i, types.PhaseRequestHeaders, variables.Args, "x"+strconv.Itoa(i), false)
+			r.Log = true
+			if err := waf.Rules.Add(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := waf.Rules.Add(newCandidateTestRule(t, 21, types.PhaseRequestHeaders, variables.Args, "attack", true)); err != nil {
+			t.Fatal(err)
+		}
+		waf.Rules.Plan()
+		return waf
+	}
+	sequential, parallel := newWAF(0), newWAF(4)
+	eval := func(waf *WAF, args ...string) ([]int, *types.Interruption) {
+		tx := waf.NewTransaction()
+		defer tx.Close()
+		for i, a := range args {
+			tx.AddArgument(types.ArgumentGET, "a"+strconv.Itoa(i), a)
+		}
+		tx.RemoveRuleByID(7)
+		it := tx.ProcessRequestHeaders()
+		var ids []int
+		for _, mr := range tx.MatchedRules() {
+			ids = append(ids, mr.Rule().ID())
+		}
+		return ids, it
+	}
+	for _, args := range [][]string{
+		{"y"},
+		{"x3", "x7", "x12"},
+		{"x1", "attack", "x20"},
+	} {
+		seqIDs, seqIt := eval(sequential, args...)
+		parIDs, parIt := eval(parallel, args...)
+		if !reflect.DeepEqual(seqIDs, parIDs) || !reflect.DeepEqual(seqIt, parIt) {
+			t.Errorf("unexpected parallel evaluation of %v: %v %v, want %v %v", args, parIDs, parIt, seqIDs, seqIt)
+		}
+	}
+	if ids, it := eval(parallel, "x3", "attack"); !reflect.DeepEqual(ids, []int{3, 21}) || it == nil || it.RuleID != 21 {
+		t.Errorf("unexpected matched rules %v and interruption %v", ids, it)
+	}
+}
+
+// argsPathOperator sets ARGS_PATH like @restpath
+type argsPathOperator struct{}
+
+func (argsPathOperator) Evaluate(tx rules.TransactionState, _ string) bool {
+	tx.Variables().ArgsPath().SetIndex("id", 0, "1")
+	return true
+}
+
+func TestPrefilter(t *testing.T) {
+	waf := NewWAF()
+	add := func(r *Rule) {
+		t.Helper()
+		if err := waf.Rules.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	negated := newCandidateTestRule(t, 1, types.PhaseRequestHeaders, variables.ArgsPost, "x", false)
+	negated.SetOperator(testOperator(func(value string) bool { return value == "x" }), "!@streq", "x")
+	negated.operator.Negation = true
+	add(negated)
+	count := newCandidateTestRule(t, 2, types.PhaseRequestHeaders, variables.ArgsPost, "0", false)
+	count.variables[0].Count = true
+	add(count)
+	add(newCandidateTestRule(t, 3, types.PhaseRequestHeaders, variables.ArgsPath, "1", false))
+	restpath := newCandidateTestRule(t, 4, types.PhaseRequestHeaders, variables.RequestURI, "", false)
+	restpath.SetOperator(argsPathOperator{}, "@restpath", "/users/{id}")
+	add(restpath)
+	add(newCandidateTestRule(t, 5, types.PhaseRequestHeaders, variables.ArgsPath, "1", false))
+	waf.Rules.Plan()
+
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/users/1", "GET", "HTTP/1.1")
+	tx.ProcessRequestHeaders()
+	var ids []int
+	for _, mr := range tx.MatchedRules() {
+		ids = append(ids, mr.Rule().ID())
+	}
+	// rule 5 is evaluated once @restpath populated ARGS_PATH
+	if want := []int{2, 4, 5}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("unexpected matched rules %v, want %v", ids, want)
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatal(err)
+	}
+	stats := waf.RuleStats()
+	if want := map[int]uint64{1: 1, 3: 1}; !reflect.DeepEqual(stats.Skipped, want) {
+		t.Errorf("unexpected skipped rules %v, want %v", stats.Skipped, want)
+	}
+}
+
+// literalOperator matches the values containing its literal and counts
+// its evaluations
+type literalOperator struct {
+	literal string
+	calls   *int
+}
+
+func (o literalOperator) Evaluate(_ rules.TransactionState, value string) bool {
+	*o.calls++
+	return strings.Contains(strings.ToLower(value), o.literal)
+}
+
+func (o literalOperator) Literals() []string {
+	return []string{o.literal}
+}
+
+func TestLiteralPrequalification(t *testing.T) {
+	waf := NewWAF()
+	calls := 0
+	r := newCandidateTestRule(t, 1, types.PhaseRequestHeaders, variables.ArgsGet, "", false)
+	r.SetOperator(literalOperator{"attack", &calls}, "@rx", "attack")
+	if err := waf.Rules.Add(r); err != nil {
+		t.Fatal(err)
+	}
+	negated := newCandidateTestRule(t, 2, types.PhaseRequestHeaders, variables.ArgsGet, "", false)
+	negated.SetOperator(literalOperator{"benign", &calls}, "!@rx", "benign")
+	negated.operator.Negation = true
+	if err := waf.Rules.Add(negated); err != nil {
+		t.Fatal(err)
+	}
+	waf.Rules.Plan()
+
+	tx := waf.NewTransaction()
+	tx.AddArgument(types.ArgumentGET, "a", "benign")
+	tx.AddArgument(types.ArgumentGET, "b", "ATTACK")
+	tx.AddArgument(types.ArgumentGET, "c", "other")
+	tx.ProcessRequestHeaders()
+	matches := map[int][]string{}
+	for _, mr := range tx.MatchedRules() {
+		for _, md := range mr.MatchedDatas() {
+			matches[mr.Rule().ID()] = append(matches[mr.Rule().ID()], md.Key())
+		}
+		sort.Strings(matches[mr.Rule().ID()])
+	}
+	if want := map[int][]string{1: {"b"}, 2: {"b", "c"}}; !reflect.DeepEqual(matches, want) {
+		t.Errorf("unexpected matches %v, want %v", matches, want)
+	}
+	// the operators only run for the values containing their literals
+	if calls != 2 {
+		t.Errorf("unexpected operator evaluations %d, want 2", calls)
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
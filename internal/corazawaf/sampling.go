@@ -0,0 +1,73 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+// SamplingKey defines how transactions are selected for enforcement
+// when the rule engine sampling is enabled
+type SamplingKey int
+
+const (
+	// SamplingRandom selects transactions randomly
+	SamplingRandom SamplingKey = iota
+	// SamplingClientIP selects transactions by the hash of REMOTE_ADDR,
+	// so a client is always enforced or never enforced
+	SamplingClientIP
+)
+
+// ParseSamplingKey parses the second argument of SecRuleEngineSampling
+func ParseSamplingKey(k string) (SamplingKey, error) {
+	switch strings.ToLower(k) {
+	case "", "random":
+		return SamplingRandom, nil
+	case "clientip", "remoteip":
+		return SamplingClientIP, nil
+	}
+	return -1, fmt.Errorf("invalid sampling key %q", k)
+}
+
+// samplingBuckets is the resolution of the sampling rate
+const samplingBuckets = 10000
+
+// sampled returns true if the transaction identified by key must be
+// enforced according to the sampling rate
+func (w *WAF) sampled(key string) bool {
+	var bucket uint32
+	if w.RuleEngineSampleKey == SamplingClientIP {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		bucket = h.Sum32() % samplingBuckets
+	} else {
+		bucket = uint32(rand.Intn(samplingBuckets))
+	}
+	return float64(bucket) < w.RuleEngineSampleRate*samplingBuckets/100
+}
+
+// applyRuleEngineSampling downgrades the rule engine to DetectionOnly
+// for the transactions that are not selected for enforcement
+func (tx *Transaction) applyRuleEngineSampling(key string) {
+	if tx.ruleEngineOverridden || tx.WAF.RuleEngine != types.RuleEngineOn || tx.WAF.RuleEngineSampleRate >= 100 {
+		return
+	}
+	if tx.WAF.sampled(key) {
+		tx.RuleEngine = types.RuleEngineOn
+	} else {
+		tx.RuleEngine = types.RuleEngineDetectionOnly
+	}
+}
+
+// SetRuleEngine overrides the rule engine status for this transaction,
+// the WAF sampling policy is ignored once it is called
+func (tx *Transaction) SetRuleEngine(status types.RuleEngineStatus) {
+	tx.ruleEngineOverridden = true
+	tx.RuleEngine = status
+}
@@ -0,0 +1,127 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+// signedCookieSuffix is appended to the name of a signed cookie to name
+// the cookie carrying its signature, like SESSIONID.sig
+const signedCookieSuffix = ".sig"
+
+// isSignedCookie returns true if the cookie is listed in SignedCookies
+func (w *WAF) isSignedCookie(name string) bool {
+	for _, c := range w.SignedCookies {
+		if strings.EqualFold(c, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// cookieSignature returns the signature of a cookie issued at the given
+// unix time, names are case insensitive. The signature is formatted as
+// issued.hmac so requests can check its age.
+func (tx *Transaction) cookieSignature(name string, value string, issued int64) string {
+	key := tx.WAF.CookieSignKey
+	if tx.WAF.CookieSignKeyMode == HashKeyRemoteIP {
+		key = append(append([]byte{}, key...), tx.variables.remoteAddr.String()...)
+	}
+	ts := strconv.FormatInt(issued, 10)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.ToLower(name)))
+	mac.Write([]byte{'='})
+	mac.Write([]byte(value))
+	mac.Write([]byte{0})
+	mac.Write([]byte(ts))
+	return ts + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validCookieSignature returns true if sig signs the cookie and didn't
+// expire
+func (tx *Transaction) validCookieSignature(name string, value string, sig string) bool {
+	ts, _, ok := strings.Cut(sig, ".")
+	if !ok {
+		return false
+	}
+	issued, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	if !hmac.Equal([]byte(sig), []byte(tx.cookieSignature(name, value, issued))) {
+		return false
+	}
+	if maxAge := tx.WAF.CookieSignMaxAge; maxAge > 0 {
+		age := time.Unix(0, tx.Timestamp).Sub(time.Unix(issued, 0))
+		if age > maxAge {
+			tx.debugLogger.Debug("Signed cookie %q expired %s ago", name, age-maxAge)
+			return false
+		}
+	}
+	return true
+}
+
+// signResponseCookies schedules a Set-Cookie with the signature of every
+// signed cookie set by the response, it keeps the attributes of the
+// original cookie so both expire together. The cookies of the upstream
+// are not modified.
+func (tx *Transaction) signResponseCookies() {
+	for _, h := range tx.variables.responseHeaders.Get("set-cookie") {
+		pair, attrs, _ := strings.Cut(h, ";")
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !tx.WAF.isSignedCookie(name) {
+			continue
+		}
+		issued := time.Unix(0, tx.Timestamp).Unix()
+		sig := name + signedCookieSuffix + "=" + tx.cookieSignature(name, strings.TrimSpace(value), issued)
+		if attrs != "" {
+			sig += ";" + attrs
+		}
+		tx.AddResponseHeaderMutation(types.HeaderMutation{Action: types.HeaderMutationAdd, Name: "Set-Cookie", Value: sig})
+	}
+}
+
+// verifySignedCookies checks the signed request cookies, the values
+// without signature are set in REQUEST_COOKIES_UNSIGNED and the values
+// not matching any valid signature in REQUEST_COOKIES_TAMPERED. Cookies
+// forged by a third party have no valid signature, but a session fixation
+// attacker can plant a cookie and the signature the WAF issued to them,
+// which is only detected if the signatures are bound to the client address
+// with CookieSignKeyMode or expire after CookieSignMaxAge.
+func (tx *Transaction) verifySignedCookies() {
+	for _, name := range tx.WAF.SignedCookies {
+		values := tx.variables.requestCookies.Get(name)
+		if len(values) == 0 {
+			continue
+		}
+		sigs := tx.variables.requestCookies.Get(name + signedCookieSuffix)
+		for _, v := range values {
+			if len(sigs) == 0 {
+				tx.debugLogger.Debug("Signed cookie %q has no signature", name)
+				tx.variables.requestCookiesUnsigned.Add(name, v)
+				continue
+			}
+			valid := false
+			for _, sig := range sigs {
+				if tx.validCookieSignature(name, v, sig) {
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				tx.debugLogger.Debug("Signed cookie %q has an invalid signature", name)
+				tx.variables.requestCookiesTampered.Add(name, v)
+			}
+		}
+	}
+}
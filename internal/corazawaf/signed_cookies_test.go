@@ -0,0 +1,118 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+func newSignedCookiesWAF() *WAF {
+	waf := NewWAF()
+	waf.SignedCookies = []string{"SESSIONID"}
+	waf.CookieSignKey = []byte("secret")
+	return waf
+}
+
+// signedCookie returns the Set-Cookie scheduled for the signature of the
+// response cookie
+func signedCookie(t *testing.T, waf *WAF, ip string, setCookie string) string {
+	t.Helper()
+	tx := waf.NewTransaction()
+	tx.ProcessConnection(ip, 1234, "", 0)
+	tx.AddResponseHeader("Set-Cookie", "theme=dark")
+	tx.AddResponseHeader("Set-Cookie", setCookie)
+	tx.ProcessResponseHeaders(200, "HTTP/1.1")
+	mutations := tx.ResponseHeaderMutations()
+	if len(mutations) != 1 || mutations[0].Action != types.HeaderMutationAdd || mutations[0].Name != "Set-Cookie" {
+		t.Fatalf("expected a Set-Cookie to be added, got %v", mutations)
+	}
+	return mutations[0].Value
+}
+
+func TestSignResponseCookies(t *testing.T) {
+	waf := newSignedCookiesWAF()
+	sig := signedCookie(t, waf, "127.0.0.1", "sessionid=abc; Path=/; HttpOnly")
+	if !strings.HasPrefix(sig, "sessionid.sig=") || !strings.HasSuffix(sig, "; Path=/; HttpOnly") {
+		t.Errorf("unexpected signature cookie %q", sig)
+	}
+	signature := strings.TrimPrefix(strings.Split(sig, ";")[0], "sessionid.sig=")
+
+	tests := []struct {
+		name     string
+		ip       string
+		cookie   string
+		tampered string
+		unsigned string
+	}{
+		{"valid", "127.0.0.1", "SESSIONID=abc; SESSIONID.sig=" + signature, "", ""},
+		{"tampered", "127.0.0.1", "SESSIONID=abd; SESSIONID.sig=" + signature, "abd", ""},
+		{"unsigned", "127.0.0.1", "SESSIONID=abc", "", "abc"},
+		{"tossed", "127.0.0.1", "SESSIONID=evil; SESSIONID=abc; SESSIONID.sig=" + signature, "evil", ""},
+		{"other cookies", "127.0.0.1", "theme=dark", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := waf.NewTransaction()
+			tx.ProcessConnection(tt.ip, 1234, "", 0)
+			tx.AddRequestHeader("Cookie", tt.cookie)
+			tx.ProcessRequestHeaders()
+			if have := strings.Join(tx.variables.requestCookiesTampered.Get("sessionid"), ","); have != tt.tampered {
+				t.Errorf("want tampered %q, have %q", tt.tampered, have)
+			}
+			if have := strings.Join(tx.variables.requestCookiesUnsigned.Get("sessionid"), ","); have != tt.unsigned {
+				t.Errorf("want unsigned %q, have %q", tt.unsigned, have)
+			}
+		})
+	}
+}
+
+func TestCookieSignKeyRemoteIP(t *testing.T) {
+	waf := newSignedCookiesWAF()
+	waf.CookieSignKeyMode = HashKeyRemoteIP
+	sig := strings.Split(signedCookie(t, waf, "127.0.0.1", "SESSIONID=abc"), ";")[0]
+
+	tx := waf.NewTransaction()
+	tx.ProcessConnection("127.0.0.2", 1234, "", 0)
+	tx.AddRequestHeader("Cookie", "SESSIONID=abc; "+sig)
+	tx.ProcessRequestHeaders()
+	if len(tx.variables.requestCookiesTampered.Get("sessionid")) != 1 {
+		t.Error("expected a signature bound to a different ip to be invalid")
+	}
+}
+
+func TestCookieSignMaxAge(t *testing.T) {
+	waf := newSignedCookiesWAF()
+	waf.CookieSignMaxAge = time.Hour
+	sig := strings.Split(signedCookie(t, waf, "127.0.0.1", "SESSIONID=abc"), ";")[0]
+
+	for _, tt := range []struct {
+		age      time.Duration
+		tampered int
+	}{
+		{time.Minute, 0},
+		{2 * time.Hour, 1},
+	} {
+		tx := waf.NewTransaction()
+		tx.Timestamp = time.Now().Add(tt.age).UnixNano()
+		tx.AddRequestHeader("Cookie", "SESSIONID=abc; "+sig)
+		tx.ProcessRequestHeaders()
+		if have := len(tx.variables.requestCookiesTampered.Get("sessionid")); have != tt.tampered {
+			t.Errorf("unexpected tampered cookies for a signature issued %s ago, want %d, have %d", tt.age, tt.tampered, have)
+		}
+	}
+
+	// the issue time can't be changed without the key
+	issued, mac, _ := strings.Cut(strings.TrimPrefix(sig, "SESSIONID.sig="), ".")
+	forged := "SESSIONID.sig=" + issued + "0." + mac
+	tx := waf.NewTransaction()
+	tx.AddRequestHeader("Cookie", "SESSIONID=abc; "+forged)
+	tx.ProcessRequestHeaders()
+	if len(tx.variables.requestCookiesTampered.Get("sessionid")) != 1 {
+		t.Error("expected a signature with a forged issue time to be invalid")
+	}
+}
@@ -5,22 +5,33 @@ package corazawaf
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/x509"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"mime"
 	"net/url"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/corazawaf/coraza/v3/accesslist"
 	"github.com/corazawaf/coraza/v3/bodyprocessors"
 	"github.com/corazawaf/coraza/v3/collection"
+	"github.com/corazawaf/coraza/v3/contentencoding"
+	"github.com/corazawaf/coraza/v3/internal/cookies"
 	"github.com/corazawaf/coraza/v3/internal/corazarules"
 	stringsutil "github.com/corazawaf/coraza/v3/internal/strings"
 	urlutil "github.com/corazawaf/coraza/v3/internal/url"
 	"github.com/corazawaf/coraza/v3/loggers"
+	"github.com/corazawaf/coraza/v3/openapi"
+	"github.com/corazawaf/coraza/v3/profiler"
+	"github.com/corazawaf/coraza/v3/ratelimit"
 	"github.com/corazawaf/coraza/v3/rules"
 	"github.com/corazawaf/coraza/v3/types"
 	"github.com/corazawaf/coraza/v3/types/variables"
@@ -43,6 +54,44 @@ type Transaction struct {
 	// True if the transaction has been disrupted by any rule
 	interruption *types.Interruption
 
+	// Response header changes scheduled by rules
+	responseHeaderMutations []types.HeaderMutation
+
+	// Time the connector must delay the transaction, set by the pause action
+	pause time.Duration
+
+	// tracing is true if the rule evaluation must be recorded
+	tracing bool
+
+	// trace contains the evaluation of each rule when tracing is enabled
+	trace []types.RuleTrace
+
+	// ruleTrace is the trace of the rule being evaluated
+	ruleTrace *types.RuleTrace
+
+	// shadow evaluates the same request against the candidate WAF, if any
+	shadow *Transaction
+
+	// ruleEngineOverridden is true if SetRuleEngine was called, the
+	// sampling policy is not applied afterwards
+	ruleEngineOverridden bool
+
+	// accessListAllowed is true if the request matched an allow entry of
+	// the access list, only the phase 5 rules are evaluated
+	accessListAllowed bool
+
+	// connectionAddr is the client address tracked by the connection
+	// engine, it is released by Close
+	connectionAddr string
+
+	// bodyTiming contains the arrival of the request body chunks notified
+	// by the connector
+	bodyTiming bodyTiming
+
+	// openAPIOperation is the operation of the WAF OpenAPI specification
+	// matching the request, the request body is validated against it
+	openAPIOperation *openapi.Operation
+
 	// This is used to store log messages
 	Logdata string
 
@@ -68,9 +117,30 @@ type Transaction struct {
 	// Handles request body buffers
 	requestBodyBuffer *BodyBuffer
 
+	// True if bytes were discarded from the request body because of the
+	// RequestBodyLimit and the ProcessPartial limit action
+	requestBodyTruncated bool
+
+	// True if the first byte discarded from the request body is an
+	// argument separator, the last urlencoded argument is then complete
+	requestBodyCutAtSeparator bool
+
+	// requestBodyOverflow is the byte read beyond the RequestBodyLimit from
+	// a reader of unknown size, it is returned by RequestBodyReader after
+	// the buffered body
+	requestBodyOverflow []byte
+
+	// streamInputBody is the request body written back to the buffer the
+	// last time, it detects the changes made by the rules to
+	// STREAM_INPUT_BODY
+	streamInputBody string
+
 	// Handles response body buffers
 	ResponseBodyBuffer *BodyBuffer
 
+	// True if bytes beyond the ResponseBodyLimit were not inspected
+	responseBodyTruncated bool
+
 	// Body processor used to parse JSON, XML, etc
 	bodyProcessor bodyprocessors.BodyProcessor
 
@@ -83,6 +153,9 @@ type Transaction struct {
 	// {85: {variables.RequestHeaders, "user-agent"}}
 	ruleRemoveTargetByID map[int][]ruleVariableParams
 
+	// operatorState is the state kept by operators for the transaction
+	operatorState map[interface{}]interface{}
+
 	// Will skip this number of rules, this value will be decreased on each skip
 	Skip int
 
@@ -91,12 +164,34 @@ type Transaction struct {
 	// We must reuse it in the future
 	Capture bool
 
-	// Contains duration in useconds per phase
+	// captures contains the values captured by the last evaluated
+	// operator, they are copied to the MatchData
+	captures []string
+
+	// Contains duration in nanoseconds per phase
 	stopWatches map[types.RulePhase]int64
 
+	// requestHeadersRaw contains the request headers as received,
+	// it backs REQUEST_HEADERS_RAW
+	requestHeadersRaw []byte
+
+	// uriNormalization caches the normalizations of the request URI
+	// shared by the rules
+	uriNormalization uriNormalization
+
+	// fullRequest caches FULL_REQUEST, it is only built if a rule uses it
+	fullRequest fullRequest
+
+	// ruleDurations contains the cumulative evaluation time of each rule,
+	// it is only populated when WAF.RulePerfTime is set
+	ruleDurations map[int]time.Duration
+
 	// Contains a WAF instance for the current transaction
 	WAF *WAF
 
+	// debugLogger writes the transaction ID with every message
+	debugLogger loggers.DebugLogger
+
 	// Timestamp of the request
 	Timestamp int64
 
@@ -107,6 +202,24 @@ type Transaction struct {
 	variables TransactionVariables
 
 	transformationCache map[transformationKey]*transformationValue
+
+	// arena allocates the match data of the transaction when
+	// WAF.TransactionArena is set, it is reset on Close
+	arena *corazarules.Arena
+
+	// planState records for every rule of the phase whether the
+	// concurrent evaluation of the independent rules found it can match
+	planState []uint8
+
+	// emptyVariables records during a phase which inputs have no value,
+	// it is used to skip the rules whose targets are all empty
+	emptyVariables [types.VariablesCount]uint8
+
+	// literalPlan is the plan of the phase being evaluated when the
+	// operators are pre-qualified by their literals, literalScans caches
+	// the scans of the values during the phase
+	literalPlan  *rulePlan
+	literalScans map[literalKey]*literalScan
 }
 
 func (tx *Transaction) ID() string {
@@ -129,10 +242,6 @@ func (tx *Transaction) Collection(idx variables.RuleVariable) collection.Collect
 		return tx.variables.authType
 	case variables.FilesCombinedSize:
 		return tx.variables.filesCombinedSize
-	case variables.FullRequest:
-		return tx.variables.fullRequest
-	case variables.FullRequestLength:
-		return tx.variables.fullRequestLength
 	case variables.InboundDataError:
 		return tx.variables.inboundDataError
 	case variables.MatchedVar:
@@ -223,14 +332,20 @@ func (tx *Transaction) Collection(idx variables.RuleVariable) collection.Collect
 		return tx.variables.serverPort
 	case variables.Sessionid:
 		return tx.variables.sessionID
-	case variables.HighestSeverity:
-		return tx.variables.highestSeverity
+	case variables.HighestSeverity, variables.Duration, variables.Time, variables.TimeDay,
+		variables.TimeEpoch, variables.TimeHour, variables.TimeMin, variables.TimeMon,
+		variables.TimeSec, variables.TimeWday, variables.TimeYear, variables.PerfPhase1,
+		variables.PerfPhase2, variables.PerfPhase3, variables.PerfPhase4, variables.PerfPhase5,
+		variables.PerfCombined, variables.PerfRules, variables.RequestHeadersRaw,
+		variables.RequestURILowercase, variables.RequestFilenameDecoded, variables.RequestFilenameNormalized,
+		variables.PathNormalizationChanged, variables.FullRequest, variables.FullRequestLength,
+		variables.RequestBodyDuration, variables.RequestBodyChunks, variables.RequestBodyChunkInterval,
+		variables.RequestBodyChunkSize:
+		return tx.computedVariable(idx)
 	case variables.StatusLine:
 		return tx.variables.statusLine
 	case variables.InboundErrorData:
 		return tx.variables.inboundErrorData
-	case variables.Duration:
-		return tx.variables.duration
 	case variables.ResponseHeadersNames:
 		return tx.variables.responseHeadersNames
 	case variables.RequestHeadersNames:
@@ -290,8 +405,106 @@ func (tx *Transaction) Collection(idx variables.RuleVariable) collection.Collect
 		return tx.variables.env
 	case variables.IP:
 		return tx.variables.ip
+	case variables.Global:
+		return tx.variables.global
+	case variables.Session:
+		return tx.variables.session
+	case variables.User:
+		return tx.variables.user
+	case variables.Resource:
+		return tx.variables.resource
 	case variables.UrlencodedError:
 		return tx.variables.urlencodedError
+	case variables.RequestCookiesError:
+		return tx.variables.requestCookiesError
+	case variables.AccessListAction:
+		return tx.variables.accessListAction
+	case variables.AccessListEntry:
+		return tx.variables.accessListEntry
+	case variables.MemoryLimitExceeded:
+		return tx.variables.memoryLimitExceeded
+	case variables.StreamInputBody:
+		return tx.variables.streamInputBody
+	case variables.StreamOutputBody:
+		return tx.variables.streamOutputBody
+	case variables.ResponseBodyDecompressionError:
+		return tx.variables.responseBodyDecompressionError
+	case variables.RequestBodyDecompressionError:
+		return tx.variables.requestBodyDecompressionError
+	case variables.RequestPseudoHeaders:
+		return tx.variables.requestPseudoHeaders
+	case variables.RequestProtocolAnomalies:
+		return tx.variables.requestProtocolAnomalies
+	case variables.RequestSOAP:
+		return tx.variables.requestSOAP
+	case variables.RequestXMLAnomalies:
+		return tx.variables.requestXMLAnomalies
+	case variables.OpenAPIOperation:
+		return tx.variables.openAPIOperation
+	case variables.OpenAPIViolations:
+		return tx.variables.openAPIViolations
+	case variables.RequestCookiesTampered:
+		return tx.variables.requestCookiesTampered
+	case variables.RequestCookiesUnsigned:
+		return tx.variables.requestCookiesUnsigned
+	case variables.CSRFToken:
+		return tx.variables.csrfToken
+	case variables.CSRFError:
+		return tx.variables.csrfError
+	case variables.CSRFErrorMsg:
+		return tx.variables.csrfErrorMsg
+	case variables.TLSJA3:
+		return tx.variables.tlsJA3
+	case variables.TLSJA3Hash:
+		return tx.variables.tlsJA3Hash
+	case variables.TLSJA4:
+		return tx.variables.tlsJA4
+	case variables.SSLClientVerify:
+		return tx.variables.sslClientVerify
+	case variables.SSLClientSDN:
+		return tx.variables.sslClientSDN
+	case variables.SSLClientSDNCN:
+		return tx.variables.sslClientSDNCN
+	case variables.SSLClientIDN:
+		return tx.variables.sslClientIDN
+	case variables.SSLClientMSerial:
+		return tx.variables.sslClientMSerial
+	case variables.SSLClientVStart:
+		return tx.variables.sslClientVStart
+	case variables.SSLClientVEnd:
+		return tx.variables.sslClientVEnd
+	case variables.SSLClientVRemain:
+		return tx.variables.sslClientVRemain
+	case variables.SSLClientSAN:
+		return tx.variables.sslClientSAN
+	case variables.ProfileViolation:
+		return tx.variables.profileViolation
+	case variables.RequestURIScheme:
+		return tx.variables.requestURIScheme
+	case variables.RequestURIHost:
+		return tx.variables.requestURIHost
+	case variables.RequestURIUserinfo:
+		return tx.variables.requestURIUserinfo
+	case variables.RequestURIFragment:
+		return tx.variables.requestURIFragment
+	case variables.RequestURIExtraQuery:
+		return tx.variables.requestURIExtraQuery
+	case variables.ConnConcurrent:
+		return tx.variables.connConcurrent
+	case variables.ConnRate:
+		return tx.variables.connRate
+	case variables.ConnLimitExceeded:
+		return tx.variables.connLimitExceeded
+	case variables.HoneypotPath:
+		return tx.variables.honeypotPath
+	case variables.HoneypotFields:
+		return tx.variables.honeypotFields
+	case variables.RequestCookiesErrorMsg:
+		return tx.variables.requestCookiesErrorMsg
+	case variables.RuleError:
+		return tx.variables.ruleError
+	case variables.RuleErrorMsg:
+		return tx.variables.ruleErrorMsg
 	case variables.ResponseArgs:
 		// TODO(anuraaga): This collection seems to be missing.
 		return nil
@@ -319,15 +532,33 @@ func (tx *Transaction) ContentInjection() bool {
 }
 
 func (tx *Transaction) DebugLogger() loggers.DebugLogger {
-	return tx.WAF.Logger
+	return tx.debugLogger
+}
+
+// ruleLogger returns the transaction logger with the rule ID field, the
+// field is only added from the debug level to avoid an allocation for
+// every rule evaluation when the messages are discarded anyway.
+func (tx *Transaction) ruleLogger(rid int) loggers.DebugLogger {
+	if tx.WAF.debugLogLevel < loggers.LogLevelDebug {
+		return tx.debugLogger
+	}
+	return loggers.With(tx.debugLogger, loggers.Int(loggers.FieldRuleID, rid))
 }
 
+// ResponseBodyReader returns a reader over the buffered response body,
+// including the part spooled to disk, it is valid until Close
 func (tx *Transaction) ResponseBodyReader() (io.Reader, error) {
 	return tx.ResponseBodyBuffer.Reader()
 }
 
+// RequestBodyReader returns a reader over the buffered request body,
+// including the part spooled to disk, it is valid until Close
 func (tx *Transaction) RequestBodyReader() (io.Reader, error) {
-	return tx.requestBodyBuffer.Reader()
+	r, err := tx.requestBodyBuffer.Reader()
+	if err != nil || len(tx.requestBodyOverflow) == 0 {
+		return r, err
+	}
+	return io.MultiReader(r, bytes.NewReader(tx.requestBodyOverflow)), nil
 }
 
 // AddRequestHeader Adds a request header
@@ -339,26 +570,43 @@ func (tx *Transaction) AddRequestHeader(key string, value string) {
 	if key == "" {
 		return
 	}
+	if tx.shadow != nil {
+		tx.shadow.AddRequestHeader(key, value)
+	}
+	if key[0] == ':' {
+		// HTTP/2 and HTTP/3 pseudo headers are not request headers
+		name := strings.ToLower(key[1:])
+		tx.variables.requestPseudoHeaders.AddCS(name, key, value)
+		return
+	}
+	tx.requestHeadersRaw = append(append(append(append(tx.requestHeadersRaw, key...), ": "...), value...), '\n')
 	keyl := strings.ToLower(key)
 	tx.variables.requestHeadersNames.AddUniqueCS(keyl, key, keyl)
 	tx.variables.requestHeaders.AddCS(keyl, key, value)
 
 	if keyl == "content-type" {
 		val := strings.ToLower(value)
-		if val == "application/x-www-form-urlencoded" {
+		// the media type may be followed by parameters like charset
+		if rbp, ok := tx.WAF.bodyProcessor(val); ok {
+			tx.variables.reqbodyProcessor.Set(rbp)
+		} else if strings.HasPrefix(val, "application/x-www-form-urlencoded") {
 			tx.variables.reqbodyProcessor.Set("URLENCODED")
 		} else if strings.HasPrefix(val, "multipart/form-data") {
 			tx.variables.reqbodyProcessor.Set("MULTIPART")
 		}
 	} else if keyl == "cookie" {
-		// Cookies use the same syntax as GET params but with semicolon (;) separator
-		values := urlutil.ParseQuery(value, ';')
-		for k, vr := range values {
-			kl := strings.ToLower(k)
-			tx.variables.requestCookiesNames.AddUniqueCS(kl, k, kl)
-			for _, v := range vr {
-				tx.variables.requestCookies.AddCS(kl, k, v)
-			}
+		cs, err := cookies.Parse(value, cookies.Options{
+			Version:      tx.WAF.CookieFormat,
+			V0Separators: tx.WAF.CookieV0Separators,
+		})
+		for _, c := range cs {
+			kl := strings.ToLower(c.Name)
+			tx.variables.requestCookiesNames.AddUniqueCS(kl, c.Name, kl)
+			tx.variables.requestCookies.AddCS(kl, c.Name, c.Value)
+		}
+		if err != nil {
+			tx.variables.requestCookiesError.Set("1")
+			tx.variables.requestCookiesErrorMsg.Set(err.Error())
 		}
 	}
 }
@@ -370,6 +618,9 @@ func (tx *Transaction) AddResponseHeader(key string, value string) {
 	if key == "" {
 		return
 	}
+	if tx.shadow != nil {
+		tx.shadow.AddResponseHeader(key, value)
+	}
 	keyl := strings.ToLower(key)
 	tx.variables.responseHeadersNames.AddUniqueCS(keyl, key, keyl)
 	tx.variables.responseHeaders.AddCS(keyl, key, value)
@@ -389,15 +640,38 @@ func (tx *Transaction) Capturing() bool {
 // that supports capture, like @rx
 func (tx *Transaction) CaptureField(index int, value string) {
 	if tx.Capture {
-		tx.WAF.Logger.Debug("[%s] Capturing field %d with value %q", tx.id, index, value)
+		tx.debugLogger.Debug("Capturing field %d with value %q", index, value)
 		i := strconv.Itoa(index)
 		tx.variables.tx.SetIndex(i, 0, value)
+		for len(tx.captures) <= index {
+			tx.captures = append(tx.captures, "")
+		}
+		tx.captures[index] = value
 	}
 }
 
+// OperatorState returns the value kept by operators under key, it is
+// created with init the first time
+func (tx *Transaction) OperatorState(key interface{}, init func() interface{}) interface{} {
+	if v, ok := tx.operatorState[key]; ok {
+		return v
+	}
+	if tx.operatorState == nil {
+		tx.operatorState = map[interface{}]interface{}{}
+	}
+	v := init()
+	tx.operatorState[key] = v
+	return v
+}
+
+// RateLimitStore returns the rate limit store of the WAF
+func (tx *Transaction) RateLimitStore() ratelimit.Store {
+	return tx.WAF.RateLimitStore
+}
+
 // this function is used to control which variables are reset after a new rule is evaluated
 func (tx *Transaction) resetCaptures() {
-	tx.WAF.Logger.Debug("[%s] Reseting captured variables", tx.id)
+	tx.debugLogger.Debug("Reseting captured variables")
 	// We reset capture 0-9
 	ctx := tx.variables.tx
 	// RUNE 48 = 0
@@ -407,6 +681,15 @@ func (tx *Transaction) resetCaptures() {
 	}
 }
 
+var (
+	// ErrInvalidRequestLine is returned by ParseRequestReader when the
+	// request line is missing or malformed
+	ErrInvalidRequestLine = errors.New("invalid request line")
+	// ErrInvalidRequestHeader is returned by ParseRequestReader when a
+	// request header is malformed
+	ErrInvalidRequestHeader = errors.New("invalid request header")
+)
+
 // ParseRequestReader Parses binary request including body,
 // it does only support http/1.1 and http/1.0
 // This function does not run ProcessConnection
@@ -418,10 +701,15 @@ func (tx *Transaction) ParseRequestReader(data io.Reader) (*types.Interruption,
 	// Maybe some time I will create a prettier fix
 	scanner := bufio.NewScanner(data)
 	// read request line
-	scanner.Scan()
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidRequestLine, err.Error())
+		}
+		return nil, ErrInvalidRequestLine
+	}
 	spl := strings.SplitN(scanner.Text(), " ", 3)
-	if len(spl) != 3 {
-		return nil, fmt.Errorf("invalid request line")
+	if len(spl) != 3 || spl[0] == "" || spl[1] == "" {
+		return nil, ErrInvalidRequestLine
 	}
 	tx.ProcessURI(spl[1], spl[0], spl[2])
 	for scanner.Scan() {
@@ -431,13 +719,16 @@ func (tx *Transaction) ParseRequestReader(data io.Reader) (*types.Interruption,
 			break
 		}
 		key, val, ok := strings.Cut(l, ":")
-		if !ok {
-			return nil, fmt.Errorf("invalid request header")
-		}
 		k := strings.Trim(key, " ")
+		if !ok || k == "" {
+			return nil, ErrInvalidRequestHeader
+		}
 		v := strings.Trim(val, " ")
 		tx.AddRequestHeader(k, v)
 	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRequestHeader, err.Error())
+	}
 	if it := tx.ProcessRequestHeaders(); it != nil {
 		return it, nil
 	}
@@ -468,6 +759,9 @@ func (tx *Transaction) ParseRequestReader(data io.Reader) (*types.Interruption,
 			}
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read request body: %s", err.Error())
+	}
 	return tx.ProcessRequestBody()
 }
 
@@ -503,7 +797,7 @@ func (tx *Transaction) matchVariable(match *corazarules.MatchData) {
 
 // MatchRule Matches a rule to be logged
 func (tx *Transaction) MatchRule(r *Rule, mds []types.MatchData) {
-	tx.WAF.Logger.Debug("[%s] rule %d matched", tx.id, r.ID_)
+	tx.debugLogger.Debug("rule %d matched", r.ID_)
 	// tx.MatchedRules = append(tx.MatchedRules, mr)
 
 	// If the rule is set to audit, we log the transaction to the audit log
@@ -511,35 +805,75 @@ func (tx *Transaction) MatchRule(r *Rule, mds []types.MatchData) {
 		tx.audit = true
 	}
 
-	// set highest_severity
-	hs := tx.variables.highestSeverity
-	maxSeverity, _ := types.ParseRuleSeverity(hs.String())
-	if r.Severity_ > maxSeverity {
-		hs.Set(strconv.Itoa(r.Severity_.Int()))
-	}
-
-	mr := &corazarules.MatchedRule{
+	mr := tx.arena.NewMatchedRule()
+	*mr = corazarules.MatchedRule{
 		URI_:             tx.variables.requestURI.String(),
 		TransactionID_:   tx.id,
 		ServerIPAddress_: tx.variables.serverAddr.String(),
 		ClientIPAddress_: tx.variables.remoteAddr.String(),
 		Rule_:            &r.RuleMetadata,
 		MatchedDatas_:    mds,
+		Disruptive_:      (r.Disruptive || tx.WAF.blocksSeverity(r)) && tx.RuleEngine == types.RuleEngineOn,
+	}
+	if r.Chain != nil {
+		mr.Chain_ = []types.RuleMetadata{&r.RuleMetadata}
+		for nr := r.Chain; nr != nil; nr = nr.Chain {
+			mr.Chain_ = append(mr.Chain_, &nr.RuleMetadata)
+		}
 	}
 
-	for _, md := range mds {
-		// Use 1st set message of rule chain as message
-		if md.Message() != "" {
-			mr.Message_ = md.Message()
-			mr.Data_ = md.Data()
-			break
+	// msg and logdata are expanded once the whole chain matched, so they
+	// can refer to the captures and the matched variable of the chained
+	// rules, like ModSecurity
+	if r.Msg != nil {
+		mr.Message_ = r.Msg.Expand(tx)
+	}
+	if r.LogData != nil {
+		mr.Data_ = r.LogData.Expand(tx)
+	}
+	if mr.Message_ == "" {
+		for _, md := range mds {
+			// Use 1st set message of rule chain as message
+			if md.Message() != "" {
+				mr.Message_ = md.Message()
+				mr.Data_ = md.Data()
+				break
+			}
 		}
 	}
 
 	tx.matchedRules = append(tx.matchedRules, mr)
+	tx.WAF.ruleStats.record(r, tx.LastPhase)
 	if tx.WAF.ErrorLogCb != nil && r.Log {
 		tx.WAF.ErrorLogCb(mr)
 	}
+	if r.Log && tx.WAF.acceptsErrorEvent(r) {
+		tx.WAF.ErrorEventCb(newErrorEvent(r, mr))
+	}
+}
+
+func newErrorEvent(r *Rule, mr *corazarules.MatchedRule) types.ErrorEvent {
+	event := types.ErrorEvent{
+		RuleID:        r.ID_,
+		Tags:          r.Tags_,
+		Severity:      r.Severity_,
+		HasSeverity:   r.HasSeverity_,
+		Message:       mr.Message_,
+		Data:          mr.Data_,
+		MatchedDatas:  mr.MatchedDatas_,
+		Disruptive:    mr.Disruptive_,
+		TransactionID: mr.TransactionID_,
+		ClientIP:      mr.ClientIPAddress_,
+		URI:           mr.URI_,
+		MatchedRule:   mr,
+	}
+	if len(mr.MatchedDatas_) > 0 {
+		md := mr.MatchedDatas_[0]
+		event.Variable = md.Variable().Name()
+		event.Key = md.Key()
+		event.Value = md.Value()
+	}
+	return event
 }
 
 // GetStopWatch is used to debug phase durations
@@ -556,17 +890,58 @@ func (tx *Transaction) GetStopWatch() string {
 	return sw
 }
 
+// rulesPerformance formats the rules exceeding WAF.RulePerfTime
+// like ModSecurity does in the audit log: id=usec, id=usec
+func (tx *Transaction) rulesPerformance() string {
+	rules := tx.PerfStats().Rules
+	if len(rules) == 0 {
+		return ""
+	}
+	ids := make([]int, 0, len(rules))
+	for id := range rules {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	var sb strings.Builder
+	for i, id := range ids {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, "%d=%d", id, rules[id].Microseconds())
+	}
+	return sb.String()
+}
+
 // GetField Retrieve data from collections applying exceptions
 // In future releases we may remove de exceptions slice and
 // make it easier to use
 func (tx *Transaction) GetField(rv ruleVariableParams) []types.MatchData {
-	collection := rv.Variable
 	col := tx.Collection(rv.Variable)
 	if col == nil {
 		return []types.MatchData{}
 	}
 
 	var matches []types.MatchData
+	// wildcard and regex keys of keyed collections are selected while
+	// iterating them, without copying the whole collection
+	if kc, ok := col.(keyedCollection); ok && (rv.KeyRx != nil || len(rv.KeyStr) == 0) {
+		selected := func(key string) bool {
+			lkey := strings.ToLower(key)
+			return (rv.KeyRx == nil || rv.KeyRx.MatchString(lkey)) && !rv.excluded(lkey)
+		}
+		if rv.Count {
+			count := 0
+			kc.Visit(func(key string, _ string) bool {
+				if selected(key) {
+					count++
+				}
+				return true
+			})
+			return tx.countField(rv, count)
+		}
+		return kc.FindFunc(selected)
+	}
+
 	// Now that we have access to the collection, we can apply the exceptions
 	if rv.KeyRx == nil {
 		if len(rv.KeyStr) == 0 {
@@ -578,41 +953,59 @@ func (tx *Transaction) GetField(rv ruleVariableParams) []types.MatchData {
 		matches = col.FindRegex(rv.KeyRx)
 	}
 
-	var rmi []int
-	for i, c := range matches {
-		for _, ex := range rv.Exceptions {
-			lkey := strings.ToLower(c.Key())
-			// in case it matches the regex or the keyStr
-			// Since keys are case sensitive we need to check with lower case
-			if (ex.KeyRx != nil && ex.KeyRx.MatchString(lkey)) || strings.ToLower(ex.KeyStr) == lkey {
-				// we remove the exception from the list of values
-				// we tried with standard append, but it fails... let's do some hacking
-				// m2 := append(matches[:i], matches[i+1:]...)
-				rmi = append(rmi, i)
+	if len(rv.Exceptions) > 0 {
+		kept := matches[:0]
+		for _, c := range matches {
+			if !rv.excluded(strings.ToLower(c.Key())) {
+				kept = append(kept, c)
 			}
 		}
+		matches = kept
 	}
-	// we read the list of indexes backwards
-	// then we remove each one of them because of the exceptions
-	for i := len(rmi) - 1; i >= 0; i-- {
-		if len(matches) < rmi[i]+1 {
-			matches = matches[:rmi[i]-1]
-		} else {
-			matches = append(matches[:rmi[i]], matches[rmi[i]+1:]...)
+	if rv.Count {
+		return tx.countField(rv, len(matches))
+	}
+	return matches
+}
+
+// keyedCollection is implemented by the collections whose elements can
+// be selected by key without an intermediate copy
+type keyedCollection interface {
+	collection.Visitor
+	FindFunc(keep func(key string) bool) []types.MatchData
+}
+
+func (tx *Transaction) countField(rv ruleVariableParams, count int) []types.MatchData {
+	md := tx.arena.NewMatchData()
+	md.VariableName_ = rv.Variable.Name()
+	md.Variable_ = rv.Variable
+	md.Key_ = rv.KeyStr
+	md.Value_ = strconv.Itoa(count)
+	return append(tx.arena.MatchDataSlice(1), md)
+}
+
+// setArena allocates the match data of the transaction and the entries
+// of its collections from the arena, or from the heap if it is nil
+func (tx *Transaction) setArena(a *corazarules.Arena) {
+	tx.arena = a
+	for v := byte(1); v < types.VariablesCount; v++ {
+		switch col := tx.Collection(variables.RuleVariable(v)).(type) {
+		case *collection.Map:
+			col.SetArena(a)
+		case *collection.Simple:
+			col.SetArena(a)
 		}
 	}
-	if rv.Count {
-		count := len(matches)
-		matches = []types.MatchData{
-			&corazarules.MatchData{
-				VariableName_: collection.Name(),
-				Variable_:     collection,
-				Key_:          rv.KeyStr,
-				Value_:        strconv.Itoa(count),
-			},
+}
+
+// ruleRemoved returns true if the rule was removed with ctl:ruleRemoveById
+func (tx *Transaction) ruleRemoved(id int) bool {
+	for _, trb := range tx.ruleRemoveByID {
+		if trb == id {
+			return true
 		}
 	}
-	return matches
+	return false
 }
 
 // RemoveRuleTargetByID Removes the VARIABLE:KEY from the rule ID
@@ -649,18 +1042,151 @@ func (tx *Transaction) ProcessConnection(client string, cPort int, server string
 
 	tx.variables.remoteAddr.Set(client)
 	tx.variables.remotePort.Set(p)
+	if tx.WAF.RuleEngineSampleKey == SamplingClientIP {
+		tx.applyRuleEngineSampling(client)
+	}
 	tx.variables.serverAddr.Set(server)
 	tx.variables.serverPort.Set(p2)
+	if tx.WAF.ConnectionEngine != types.ConnectionEngineOff {
+		tx.trackConnection(client)
+	}
+	if tx.shadow != nil {
+		tx.shadow.ProcessConnection(client, cPort, server, sPort)
+		tx.shadowConnection()
+	}
+}
+
+// SetTLSFingerprint sets TLS_JA3, TLS_JA3_HASH and TLS_JA4, ja3 is either
+// the JA3 string or its MD5 hash
+func (tx *Transaction) SetTLSFingerprint(ja3 string, ja4 string) {
+	if tx.shadow != nil {
+		tx.shadow.SetTLSFingerprint(ja3, ja4)
+	}
+	switch {
+	case ja3 == "":
+	case isMD5Hex(ja3):
+		tx.variables.tlsJA3Hash.Set(strings.ToLower(ja3))
+	default:
+		sum := md5.Sum([]byte(ja3))
+		tx.variables.tlsJA3.Set(ja3)
+		tx.variables.tlsJA3Hash.Set(hex.EncodeToString(sum[:]))
+	}
+	if ja4 != "" {
+		tx.variables.tlsJA4.Set(ja4)
+	}
+}
+
+// sslTimeFormat is the format of SSL_CLIENT_V_START and SSL_CLIENT_V_END
+const sslTimeFormat = "Jan _2 15:04:05 2006 GMT"
+
+// SetClientCertificate sets the SSL_CLIENT variables from the client
+// certificate and the result of its verification
+func (tx *Transaction) SetClientCertificate(cert *x509.Certificate, verifyErr error) {
+	if tx.shadow != nil {
+		tx.shadow.SetClientCertificate(cert, verifyErr)
+	}
+	if cert == nil {
+		tx.variables.sslClientVerify.Set("NONE")
+		return
+	}
+	if verifyErr != nil {
+		tx.variables.sslClientVerify.Set("FAILED:" + verifyErr.Error())
+	} else {
+		tx.variables.sslClientVerify.Set("SUCCESS")
+	}
+	tx.variables.sslClientSDN.Set(cert.Subject.String())
+	tx.variables.sslClientSDNCN.Set(cert.Subject.CommonName)
+	tx.variables.sslClientIDN.Set(cert.Issuer.String())
+	if cert.SerialNumber != nil {
+		tx.variables.sslClientMSerial.Set(strings.ToUpper(cert.SerialNumber.Text(16)))
+	}
+	tx.variables.sslClientVStart.Set(cert.NotBefore.UTC().Format(sslTimeFormat))
+	tx.variables.sslClientVEnd.Set(cert.NotAfter.UTC().Format(sslTimeFormat))
+	remain := int(time.Until(cert.NotAfter).Hours() / 24)
+	tx.variables.sslClientVRemain.Set(strconv.Itoa(remain))
+	for _, n := range cert.DNSNames {
+		tx.variables.sslClientSAN.Add("dns", n)
+	}
+	for _, e := range cert.EmailAddresses {
+		tx.variables.sslClientSAN.Add("email", e)
+	}
+	for _, ip := range cert.IPAddresses {
+		tx.variables.sslClientSAN.Add("ip", ip.String())
+	}
+	for _, u := range cert.URIs {
+		tx.variables.sslClientSAN.Add("uri", u.String())
+	}
+}
+
+// SetRequestStartTime sets when the connector started receiving the
+// request, the request body duration is measured from it
+func (tx *Transaction) SetRequestStartTime(t time.Time) {
+	if tx.shadow != nil {
+		tx.shadow.SetRequestStartTime(t)
+	}
+	tx.bodyTiming.start = t
+}
+
+// NotifyBodyChunk records the arrival of a request body chunk
+func (tx *Transaction) NotifyBodyChunk(size int, t time.Time) {
+	if tx.shadow != nil {
+		tx.shadow.NotifyBodyChunk(size, t)
+	}
+	bt := &tx.bodyTiming
+	if bt.chunks == 0 {
+		bt.first = t
+	}
+	bt.last = t
+	bt.chunks++
+	bt.size += int64(size)
+}
+
+// isMD5Hex returns true for a JA3 fingerprint already hashed by the
+// connector
+func isMD5Hex(s string) bool {
+	if len(s) != 2*md5.Size {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
 }
 
 // ExtractArguments transforms an url encoded string to a map and creates
 // ARGS_POST|GET
 func (tx *Transaction) ExtractArguments(orig types.ArgumentType, uri string) {
-	data := urlutil.ParseQuery(uri, '&')
-	for k, vs := range data {
-		for _, v := range vs {
-			tx.AddArgument(orig, k, v)
+	if tx.shadow != nil {
+		tx.shadow.ExtractArguments(orig, uri)
+	}
+	tx.extractArguments(orig, uri)
+}
+
+func (tx *Transaction) extractArguments(orig types.ArgumentType, uri string) {
+	n := 0
+	urlutil.ForEachQueryPair(uri, tx.WAF.ArgumentSeparator, func(k string, v string) bool {
+		n++
+		if err := tx.WAF.ArgumentLimits.Check(n, k, v); err != nil {
+			tx.variables.urlencodedError.Set(err.Error())
+			if tx.WAF.ArgumentsLimitAction == types.RequestBodyLimitActionReject {
+				tx.setLimitInterruption()
+			}
+			return false
 		}
+		tx.addArgument(orig, k, v)
+		return true
+	})
+}
+
+// setLimitInterruption sets INBOUND_ERROR_DATA because the arguments or
+// the decompressed request body exceeded their limits, the transaction is
+// only interrupted if the rule engine is On
+func (tx *Transaction) setLimitInterruption() {
+	tx.variables.inboundErrorData.Set("1")
+	if tx.interruption != nil || tx.RuleEngine != types.RuleEngineOn {
+		return
+	}
+	tx.interruption = &types.Interruption{
+		Status: 403,
+		Action: types.InterruptionActionDeny,
 	}
 }
 
@@ -668,7 +1194,13 @@ func (tx *Transaction) ExtractArguments(orig types.ArgumentType, uri string) {
 // This will set ARGS_(GET|POST), ARGS, ARGS_NAMES, ARGS_COMBINED_SIZE and
 // ARGS_(GET|POST)_NAMES
 func (tx *Transaction) AddArgument(argType types.ArgumentType, key string, value string) {
-	// TODO implement ARGS value limit using ArgumentsLimit
+	if tx.shadow != nil {
+		tx.shadow.AddArgument(argType, key, value)
+	}
+	tx.addArgument(argType, key, value)
+}
+
+func (tx *Transaction) addArgument(argType types.ArgumentType, key string, value string) {
 	var vals *collection.Map
 	switch argType {
 	case types.ArgumentGET:
@@ -680,9 +1212,8 @@ func (tx *Transaction) AddArgument(argType types.ArgumentType, key string, value
 	default:
 		return
 	}
-	keyl := strings.ToLower(key)
-
-	vals.AddCS(keyl, key, value)
+	// the key is indexed in lowercase and kept as is for logging
+	vals.Add(key, value)
 }
 
 // ProcessURI Performs the analysis on the URI and all the query string variables.
@@ -696,6 +1227,10 @@ func (tx *Transaction) AddArgument(argType types.ArgumentType, key string, value
 //
 // note: This function won't add GET arguments, they must be added with AddArgument
 func (tx *Transaction) ProcessURI(uri string, method string, httpVersion string) {
+	if tx.shadow != nil {
+		tx.shadow.ProcessURI(uri, method, httpVersion)
+	}
+	httpVersion = normalizeProtocol(httpVersion)
 	tx.variables.requestMethod.Set(method)
 	tx.variables.requestProtocol.Set(httpVersion)
 	tx.variables.requestURIRaw.Set(uri)
@@ -703,16 +1238,35 @@ func (tx *Transaction) ProcessURI(uri string, method string, httpVersion string)
 	// TODO modsecurity uses HTTP/${VERSION} instead of just version, let's check it out
 	tx.variables.requestLine.Set(fmt.Sprintf("%s %s %s", method, uri, httpVersion))
 
-	var err error
-
-	// we remove anchors
+	tx.variables.requestURIScheme.Reset()
+	tx.variables.requestURIHost.Reset()
+	tx.variables.requestURIUserinfo.Reset()
+	tx.variables.requestURIFragment.Reset()
+	tx.variables.requestURIExtraQuery.Reset()
+	// we remove anchors, they are kept for the rules as they are evasion
+	// markers
 	if in := strings.Index(uri, "#"); in != -1 {
+		tx.variables.requestURIFragment.Set(uri[in:])
 		uri = uri[:in]
 	}
+	if in := strings.IndexByte(uri, '?'); in != -1 {
+		if extra := strings.IndexByte(uri[in+1:], '?'); extra != -1 {
+			tx.variables.requestURIExtraQuery.Set(uri[in+1+extra:])
+		}
+	}
 	path := ""
-	parsedURL, err := url.Parse(uri)
 	query := ""
-	if err != nil {
+	if uri == "*" || method == "CONNECT" {
+		// the asterisk-form of OPTIONS targets the server and the
+		// authority-form of CONNECT the host and port of the tunnel,
+		// they are not parsed as paths
+		tx.variables.requestURI.Set(uri)
+		if uri == "*" {
+			path = uri
+		} else {
+			tx.variables.requestURIHost.Set(uri)
+		}
+	} else if parsedURL, err := parseRequestTarget(uri); err != nil {
 		tx.variables.urlencodedError.Set(err.Error())
 		path = uri
 		tx.variables.requestURI.Set(uri)
@@ -729,10 +1283,21 @@ func (tx *Transaction) ProcessURI(uri string, method string, httpVersion string)
 			tx.Variables.RequestUri.Set(uri)
 		*/
 	} else {
-		tx.ExtractArguments(types.ArgumentGET, parsedURL.RawQuery)
+		tx.extractArguments(types.ArgumentGET, parsedURL.RawQuery)
 		tx.variables.requestURI.Set(parsedURL.String())
 		path = parsedURL.Path
 		query = parsedURL.RawQuery
+		if parsedURL.Scheme != "" {
+			// absolute-form, sent to proxies
+			tx.variables.requestURIScheme.Set(parsedURL.Scheme)
+			tx.variables.requestURIHost.Set(parsedURL.Host)
+			if parsedURL.User != nil {
+				tx.variables.requestURIUserinfo.Set(parsedURL.User.String())
+			}
+			if path == "" && parsedURL.Opaque == "" {
+				path = "/"
+			}
+		}
 	}
 	offset := strings.LastIndexAny(path, "/\\")
 	if offset != -1 && len(path) > offset+1 {
@@ -745,6 +1310,135 @@ func (tx *Transaction) ProcessURI(uri string, method string, httpVersion string)
 	tx.variables.queryString.Set(query)
 }
 
+// parseRequestTarget parses the origin-form and absolute-form request
+// targets, unlike url.Parse a path starting with // has no host
+func parseRequestTarget(uri string) (*url.URL, error) {
+	if strings.HasPrefix(uri, "/") {
+		return url.ParseRequestURI(uri)
+	}
+	return url.Parse(uri)
+}
+
+// normalizeProtocol returns the HTTP/2 and HTTP/3 versions in the
+// HTTP/x.y form used for HTTP/1, like Go does, whatever the connector
+// reports, like h2 or HTTP/2
+func normalizeProtocol(proto string) string {
+	switch strings.ToLower(proto) {
+	case "h2", "h2c", "http/2", "http/2.0", "2", "2.0":
+		return "HTTP/2.0"
+	case "h3", "http/3", "http/3.0", "3", "3.0":
+		return "HTTP/3.0"
+	}
+	return proto
+}
+
+// connectionSpecificHeaders are forbidden in HTTP/2 and HTTP/3 requests,
+// they are used to smuggle requests through HTTP/1 backends
+var connectionSpecificHeaders = []string{"connection", "keep-alive", "proxy-connection", "transfer-encoding", "upgrade"}
+
+// checkRequestProtocol completes the request line and the Host header with
+// the pseudo headers and reports the ambiguities between them in
+// REQUEST_PROTOCOL_ANOMALIES, proxies and backends may resolve them
+// differently
+func (tx *Transaction) checkRequestProtocol() {
+	v := tx.variables
+	anomaly := func(name string) {
+		v.requestProtocolAnomalies.Set(name, []string{"1"})
+	}
+	proto := v.requestProtocol.String()
+	multiplexed := strings.HasPrefix(proto, "HTTP/2") || strings.HasPrefix(proto, "HTTP/3")
+	if !multiplexed && len(v.requestPseudoHeaders.FindAll()) > 0 {
+		anomaly("pseudo_header_in_http1")
+	}
+
+	hosts := v.requestHeaders.Get("host")
+	if len(hosts) > 1 {
+		anomaly("multiple_host_headers")
+	}
+	if authority, ok := v.requestPseudoHeaders.First("authority"); ok {
+		if len(hosts) == 0 {
+			// HTTP/2 requests carry the host in :authority
+			v.requestHeadersNames.AddUniqueCS("host", "Host", "host")
+			v.requestHeaders.AddCS("host", "Host", authority)
+		}
+		scheme, _ := v.requestPseudoHeaders.First("scheme")
+		if hostMismatch(hosts, authority, scheme) {
+			anomaly("authority_host_mismatch")
+		}
+	}
+	if uriHost := v.requestURIHost.String(); uriHost != "" {
+		// the proxies route absolute-form requests with the host of the
+		// target and the backends may use the Host header
+		if hostMismatch(hosts, uriHost, v.requestURIScheme.String()) {
+			anomaly("uri_host_mismatch")
+		}
+	}
+	if method, ok := v.requestPseudoHeaders.First("method"); ok {
+		if m := v.requestMethod.String(); m == "" {
+			v.requestMethod.Set(method)
+		} else if m != method {
+			anomaly("method_mismatch")
+		}
+	}
+	if path, ok := v.requestPseudoHeaders.First("path"); ok {
+		if uri := v.requestURIRaw.String(); uri != "" && uri != path {
+			anomaly("path_mismatch")
+		}
+	}
+
+	if multiplexed {
+		for _, h := range connectionSpecificHeaders {
+			if len(v.requestHeaders.Get(h)) > 0 {
+				anomaly("connection_specific_header")
+			}
+		}
+	}
+	lengths := v.requestHeaders.Get("content-length")
+	for _, l := range lengths {
+		if l != lengths[0] {
+			anomaly("multiple_content_length")
+		}
+	}
+	if len(lengths) > 0 && len(v.requestHeaders.Get("transfer-encoding")) > 0 {
+		anomaly("transfer_encoding_with_content_length")
+	}
+}
+
+// defaultPorts are the ports implied by the schemes when they are omitted
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"ws":    "80",
+	"https": "443",
+	"wss":   "443",
+}
+
+// hostMismatch returns true if any of the hosts is not the same as host,
+// the hosts are compared without case and the default port of the scheme
+func hostMismatch(hosts []string, host string, scheme string) bool {
+	host = canonicalHost(host, scheme)
+	for _, h := range hosts {
+		if canonicalHost(h, scheme) != host {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalHost returns the host in lowercase without the default port
+// of the scheme
+func canonicalHost(host string, scheme string) string {
+	host = strings.ToLower(host)
+	port, ok := defaultPorts[strings.ToLower(scheme)]
+	if !ok {
+		return host
+	}
+	// the port follows the closing bracket of IPv6 addresses
+	if i := strings.LastIndexByte(host, ':'); i > strings.LastIndexByte(host, ']') && host[i+1:] == port {
+		return host[:i]
+	}
+	return host
+}
+
 // ProcessRequestHeaders Performs the analysis on the request readers.
 //
 // This method perform the analysis on the request headers, notice however
@@ -752,18 +1446,39 @@ func (tx *Transaction) ProcessURI(uri string, method string, httpVersion string)
 //
 // note: Remember to check for a possible intervention.
 func (tx *Transaction) ProcessRequestHeaders() *types.Interruption {
+	if tx.shadow != nil {
+		tx.shadow.ProcessRequestHeaders()
+	}
 	if tx.RuleEngine == types.RuleEngineOff {
 		// Rule engine is disabled
 		return nil
 	}
 	if tx.LastPhase >= types.PhaseRequestHeaders {
 		// Phase already evaluated
-		tx.WAF.Logger.Error("ProcessRequestHeaders has already been called")
+		tx.debugLogger.Error("ProcessRequestHeaders has already been called")
 		return tx.interruption
 	}
 
 	if tx.interruption != nil {
-		tx.WAF.Logger.Error("Calling ProcessRequestHeaders but there is a preexisting interruption")
+		tx.debugLogger.Error("Calling ProcessRequestHeaders but there is a preexisting interruption")
+		return tx.interruption
+	}
+
+	tx.checkRequestProtocol()
+	if len(tx.WAF.SignedCookies) > 0 {
+		tx.verifySignedCookies()
+	}
+	if len(tx.WAF.HoneypotPaths) > 0 {
+		tx.checkHoneypotPath()
+	}
+
+	if tx.WAF.AccessList != nil && tx.matchAccessList() {
+		return tx.interruption
+	}
+
+	if tx.WAF.OpenAPI != nil && !tx.accessListAllowed && tx.checkOpenAPI() {
+		// the phase is considered evaluated
+		tx.LastPhase = types.PhaseRequestHeaders
 		return tx.interruption
 	}
 
@@ -771,11 +1486,91 @@ func (tx *Transaction) ProcessRequestHeaders() *types.Interruption {
 	return tx.interruption
 }
 
+// matchAccessList evaluates the access list of the WAF, it returns true
+// if a deny entry interrupted the transaction
+func (tx *Transaction) matchAccessList() bool {
+	e, ok := tx.WAF.AccessList.Match(tx.variables.remoteAddr.String(), tx.variables.requestFilename.String(), tx.variables.requestMethod.String())
+	if !ok {
+		return false
+	}
+	tx.variables.accessListAction.Set(e.Action.String())
+	tx.variables.accessListEntry.Set(e.ID)
+	tx.audit = true
+	if e.Action == accesslist.Allow {
+		tx.debugLogger.Debug("Request allowed by access list entry %q", e.ID)
+		tx.accessListAllowed = true
+		return false
+	}
+	tx.debugLogger.Debug("Request denied by access list entry %q", e.ID)
+	status := e.Status
+	if status == 0 {
+		status = 403
+	}
+	tx.Interrupt(&types.Interruption{
+		Action: "deny",
+		Status: status,
+	})
+	// the phase is considered evaluated
+	tx.LastPhase = types.PhaseRequestHeaders
+	return tx.interruption != nil
+}
+
+// checkOpenAPI checks the request line, headers and cookies against the
+// OpenAPI specification of the WAF, it returns true if a violation
+// interrupted the transaction
+func (tx *Transaction) checkOpenAPI() bool {
+	op, violations := tx.WAF.OpenAPI.CheckRequest(openapi.Request{
+		Method: tx.variables.requestMethod.String(),
+		Path:   tx.variables.requestFilename.String(),
+		Query:  tx.variables.argsGet.Data(),
+		Header: tx.variables.requestHeaders.Data(),
+		Cookie: tx.variables.requestCookies.Data(),
+	})
+	tx.openAPIOperation = op
+	if op != nil {
+		tx.variables.openAPIOperation.Set(op.ID())
+	}
+	return tx.setOpenAPIViolations(violations)
+}
+
+// checkOpenAPIBody validates the request body against the operation
+// matched by checkOpenAPI, it returns true if a violation interrupted the
+// transaction
+func (tx *Transaction) checkOpenAPIBody(body io.Reader) bool {
+	if tx.openAPIOperation == nil {
+		return false
+	}
+	mime := ""
+	if m := tx.variables.requestHeaders.Get("content-type"); len(m) > 0 {
+		mime = m[0]
+	}
+	return tx.setOpenAPIViolations(tx.openAPIOperation.CheckBody(mime, body))
+}
+
+func (tx *Transaction) setOpenAPIViolations(violations []openapi.Violation) bool {
+	if len(violations) == 0 {
+		return false
+	}
+	for _, v := range violations {
+		tx.debugLogger.Debug("OpenAPI violation %s at %s: %s", v.Kind, v.Location, v.Message)
+		tx.variables.openAPIViolations.Add(v.Kind, v.Location)
+	}
+	if tx.WAF.OpenAPIAction != openapi.Reject || tx.RuleEngine != types.RuleEngineOn {
+		return false
+	}
+	tx.audit = true
+	tx.Interrupt(&types.Interruption{
+		Action: "deny",
+		Status: 400,
+	})
+	return tx.interruption != nil
+}
+
 func setAndReturnBodyLimitInterruption(tx *Transaction) (*types.Interruption, int, error) {
 	tx.variables.inboundErrorData.Set("1")
 	tx.interruption = &types.Interruption{
 		Status: 403,
-		Action: "deny",
+		Action: types.InterruptionActionDeny,
 	}
 	return tx.interruption, 0, nil
 }
@@ -800,6 +1595,10 @@ func (tx *Transaction) WriteRequestBody(b []byte) (*types.Interruption, int, err
 		}
 
 		if tx.WAF.RequestBodyLimitAction == types.RequestBodyLimitActionProcessPartial {
+			// the previous chunk ended at the limit, these bytes are dropped
+			if len(b) > 0 {
+				tx.truncateRequestBody(b[0], true)
+			}
 			return nil, 0, nil
 		}
 	}
@@ -817,6 +1616,9 @@ func (tx *Transaction) WriteRequestBody(b []byte) (*types.Interruption, int, err
 
 		if tx.WAF.RequestBodyLimitAction == types.RequestBodyLimitActionProcessPartial {
 			writingBytes = tx.RequestBodyLimit - tx.requestBodyBuffer.length
+			if writingBytes < int64(len(b)) {
+				tx.truncateRequestBody(b[writingBytes], true)
+			}
 			runProcessRequestBody = true
 		}
 	}
@@ -855,6 +1657,12 @@ func (tx *Transaction) ReadRequestBodyFrom(r io.Reader) (*types.Interruption, in
 		}
 
 		if tx.WAF.RequestBodyLimitAction == types.RequestBodyLimitActionProcessPartial {
+			// the previous chunk ended at the limit, the reader is dropped
+			if l, ok := r.(ByteLenger); !ok {
+				tx.truncateRequestBodyFrom(r)
+			} else if l.Len() > 0 {
+				tx.truncateRequestBody(peekByte(r))
+			}
 			return nil, 0, nil
 		}
 	}
@@ -862,6 +1670,7 @@ func (tx *Transaction) ReadRequestBodyFrom(r io.Reader) (*types.Interruption, in
 	var (
 		writingBytes          int64
 		runProcessRequestBody = false
+		truncated             = false
 	)
 	if l, ok := r.(ByteLenger); ok {
 		writingBytes = int64(l.Len())
@@ -872,6 +1681,7 @@ func (tx *Transaction) ReadRequestBodyFrom(r io.Reader) (*types.Interruption, in
 
 			if tx.WAF.RequestBodyLimitAction == types.RequestBodyLimitActionProcessPartial {
 				writingBytes = tx.RequestBodyLimit - tx.requestBodyBuffer.length
+				truncated = writingBytes < int64(l.Len())
 				runProcessRequestBody = true
 			}
 		}
@@ -883,6 +1693,10 @@ func (tx *Transaction) ReadRequestBodyFrom(r io.Reader) (*types.Interruption, in
 	if err != nil && err != io.EOF {
 		return nil, int(w), err
 	}
+	if truncated {
+		// the next byte of the reader is the first one discarded
+		tx.truncateRequestBody(peekByte(r))
+	}
 
 	if tx.requestBodyBuffer.length == tx.RequestBodyLimit {
 		if tx.WAF.RequestBodyLimitAction == types.RequestBodyLimitActionReject {
@@ -890,6 +1704,11 @@ func (tx *Transaction) ReadRequestBodyFrom(r io.Reader) (*types.Interruption, in
 		}
 
 		if tx.WAF.RequestBodyLimitAction == types.RequestBodyLimitActionProcessPartial {
+			if _, ok := r.(ByteLenger); !ok {
+				// we cannot know the size of the reader, a body of exactly
+				// the limit is not truncated
+				tx.truncateRequestBodyFrom(r)
+			}
 			runProcessRequestBody = true
 		}
 	}
@@ -901,6 +1720,72 @@ func (tx *Transaction) ReadRequestBodyFrom(r io.Reader) (*types.Interruption, in
 	return tx.interruption, int(w), err
 }
 
+// truncateRequestBody marks the request body as truncated, next is the
+// first discarded byte if known is true
+func (tx *Transaction) truncateRequestBody(next byte, known bool) {
+	if tx.requestBodyTruncated {
+		// only the first discarded byte follows the buffered body
+		return
+	}
+	tx.requestBodyTruncated = true
+	separators := tx.WAF.ArgumentSeparator
+	if separators == "" {
+		separators = "&"
+	}
+	tx.requestBodyCutAtSeparator = known && strings.IndexByte(separators, next) >= 0
+}
+
+// truncateRequestBodyFrom marks the request body as truncated if r, of
+// unknown size, has more bytes. The byte read from a reader that can't
+// unread it is kept for RequestBodyReader, as the remaining bytes are
+// still read by the connector.
+func (tx *Transaction) truncateRequestBodyFrom(r io.Reader) {
+	if tx.requestBodyTruncated {
+		return
+	}
+	var (
+		next   = make([]byte, 1)
+		unread bool
+		err    error
+	)
+	if bs, ok := r.(io.ByteScanner); ok {
+		if next[0], err = bs.ReadByte(); err == nil {
+			unread = bs.UnreadByte() == nil
+		}
+	} else {
+		_, err = io.ReadFull(r, next)
+	}
+	switch {
+	case err == io.EOF:
+		// the body is exactly the limit
+		return
+	case err != nil:
+		tx.truncateRequestBody(0, false)
+		return
+	}
+	if !unread {
+		tx.requestBodyOverflow = next
+	}
+	tx.truncateRequestBody(next[0], true)
+}
+
+// peekByte returns the next byte of r without consuming it, known is false
+// if r can't unread it or has no more bytes
+func peekByte(r io.Reader) (next byte, known bool) {
+	bs, ok := r.(io.ByteScanner)
+	if !ok {
+		return 0, false
+	}
+	c, err := bs.ReadByte()
+	if err != nil {
+		return 0, false
+	}
+	if err := bs.UnreadByte(); err != nil {
+		return 0, false
+	}
+	return c, true
+}
+
 // ProcessRequestBody Performs the request body (if any)
 //
 // This method perform the analysis on the request body. It is optional to
@@ -909,24 +1794,37 @@ func (tx *Transaction) ReadRequestBodyFrom(r io.Reader) (*types.Interruption, in
 //
 // Remember to check for a possible intervention.
 func (tx *Transaction) ProcessRequestBody() (*types.Interruption, error) {
+	if tx.shadow != nil {
+		tx.processShadowRequestBody()
+	}
 	if tx.RuleEngine == types.RuleEngineOff {
 		return nil, nil
 	}
 
 	if tx.LastPhase >= types.PhaseRequestBody {
 		// Phase already evaluated
-		tx.WAF.Logger.Error("ProcessRequestBody has already been called")
+		tx.debugLogger.Error("ProcessRequestBody has already been called")
 		return tx.interruption, nil
 	}
 
 	if tx.interruption != nil {
-		tx.WAF.Logger.Error("Calling ProcessRequestBody but there is a preexisting interruption")
+		tx.debugLogger.Error("Calling ProcessRequestBody but there is a preexisting interruption")
 		return tx.interruption, nil
 	}
 
+	if tx.WAF.StreamInBodyInspection && tx.requestBodyBuffer.length > 0 {
+		if err := tx.setStreamInputBody(); err != nil {
+			return nil, err
+		}
+	}
+
+	tx.variables.requestBodyLength.Set(strconv.FormatInt(tx.requestBodyBuffer.length, 10))
 	// we won't process empty request bodies or disabled RequestBodyAccess
 	if !tx.RequestBodyAccess || tx.requestBodyBuffer.length == 0 {
-		tx.WAF.Rules.Eval(types.PhaseRequestBody, tx)
+		if tx.RequestBodyAccess && tx.checkOpenAPIBody(nil) {
+			return tx.interruption, nil
+		}
+		tx.evalRequestBody()
 		return tx.interruption, nil
 	}
 	mime := ""
@@ -938,42 +1836,175 @@ func (tx *Transaction) ProcessRequestBody() (*types.Interruption, error) {
 	if err != nil {
 		return nil, err
 	}
+	if tx.WAF.RequestBodyDecompression {
+		if reader, err = tx.decompressRequestBody(reader); err != nil {
+			return nil, err
+		}
+		if tx.interruption != nil {
+			return tx.interruption, nil
+		}
+	}
+
+	// the body is validated from the buffer, which is read again by the
+	// body processor
+	if tx.openAPIOperation != nil {
+		if tx.checkOpenAPIBody(reader) {
+			return tx.interruption, nil
+		}
+		if _, err := reader.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
 
 	rbp := tx.variables.reqbodyProcessor.String()
 
 	// Default variables.ReqbodyProcessor values
 	// XML and JSON must be forced with ctl:requestBodyProcessor=JSON
-	if tx.ForceRequestBodyVariable {
+	// or set for the request method, like XML for the WebDAV methods
+	if p, ok := tx.WAF.methodBodyProcessor(tx.variables.requestMethod.String()); ok && rbp == "" {
+		rbp = p
+		tx.variables.reqbodyProcessor.Set(rbp)
+	} else if tx.ForceRequestBodyVariable {
 		// We force URLENCODED if mime is x-www... or we have an empty RBP and ForceRequestBodyVariable
 		rbp = "URLENCODED"
 		tx.variables.reqbodyProcessor.Set(rbp)
 	}
-	tx.WAF.Logger.Debug("[%s] Attempting to process request body using %q", tx.id, rbp)
+	tx.debugLogger.Debug("Attempting to process request body using %q", rbp)
 	rbp = strings.ToLower(rbp)
+	if rbp == "" && tx.WAF.RequestBodyProcessorSniffing {
+		if rbp, err = sniffBodyProcessor(reader); err != nil {
+			return nil, err
+		}
+		if rbp != "" {
+			tx.debugLogger.Debug("Sniffed request body processor %q", rbp)
+			tx.variables.reqbodyProcessor.Set(strings.ToUpper(rbp))
+		}
+	}
 	if rbp == "" {
 		// so there is no bodyprocessor, we don't want to generate an error
-		tx.WAF.Rules.Eval(types.PhaseRequestBody, tx)
+		tx.evalRequestBody()
 		return tx.interruption, nil
 	}
 	bodyprocessor, err := bodyprocessors.Get(rbp)
 	if err != nil {
 		tx.generateReqbodyError(errors.New("invalid body processor"))
-		tx.WAF.Rules.Eval(types.PhaseRequestBody, tx)
+		tx.evalRequestBody()
 		return tx.interruption, nil
 	}
 	if err := bodyprocessor.ProcessRequest(reader, tx.Variables(), bodyprocessors.Options{
-		Mime:        mime,
-		StoragePath: tx.WAF.UploadDir,
+		Mime:                 mime,
+		StoragePath:          tx.WAF.UploadDir,
+		Truncated:            tx.requestBodyTruncated,
+		TruncatedAtSeparator: tx.requestBodyCutAtSeparator,
+		Charset:              tx.requestBodyCharset(mime),
+		// urlencoded bodies are split like the query string
+		ArgumentSeparators: tx.WAF.ArgumentSeparator,
+		ArgumentLimits:     tx.WAF.ArgumentLimits,
+		MaxLines:           tx.WAF.RequestBodyLinesLimit,
+		XMLMaxDepth:        tx.WAF.RequestBodyXMLDepthLimit,
+		XMLMaxElements:     tx.WAF.RequestBodyXMLElementsLimit,
 	}); err != nil {
 		tx.generateReqbodyError(err)
-		tx.WAF.Rules.Eval(types.PhaseRequestBody, tx)
+		if errors.Is(err, bodyprocessors.ErrArgumentsLimit) && tx.WAF.ArgumentsLimitAction == types.RequestBodyLimitActionReject {
+			tx.setLimitInterruption()
+			if tx.interruption != nil {
+				return tx.interruption, nil
+			}
+		}
+		tx.evalRequestBody()
 		return tx.interruption, nil
 	}
 
-	tx.WAF.Rules.Eval(types.PhaseRequestBody, tx)
+	tx.evalRequestBody()
 	return tx.interruption, nil
 }
 
+// setStreamInputBody copies the buffered request body to STREAM_INPUT_BODY
+func (tx *Transaction) setStreamInputBody() error {
+	reader, err := tx.requestBodyBuffer.Reader()
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	tx.streamInputBody = string(body)
+	tx.variables.streamInputBody.Set(tx.streamInputBody)
+	return nil
+}
+
+// evalRequestBody evaluates the request body phase and writes back
+// STREAM_INPUT_BODY if the rules modified it
+func (tx *Transaction) evalRequestBody() {
+	if tx.WAF.CSRFProtection {
+		tx.verifyCSRF()
+	}
+	if len(tx.WAF.HoneypotFields) > 0 {
+		tx.checkHoneypotFields()
+	}
+	if tx.WAF.Profile != nil && tx.WAF.ProfileMode == profiler.Enforce && !tx.accessListAllowed {
+		tx.checkProfile()
+	}
+	tx.WAF.Rules.Eval(types.PhaseRequestBody, tx)
+	if !tx.WAF.StreamInBodyInspection {
+		return
+	}
+	body := tx.variables.streamInputBody.String()
+	if body == tx.streamInputBody {
+		return
+	}
+	tx.streamInputBody = body
+	if err := tx.requestBodyBuffer.Reset(); err != nil {
+		tx.debugLogger.Error("Failed to replace the request body: %s", err.Error())
+		return
+	}
+	if _, err := tx.requestBodyBuffer.Write([]byte(body)); err != nil {
+		tx.debugLogger.Error("Failed to replace the request body: %s", err.Error())
+	}
+}
+
+// sniffBodyProcessor guesses the body processor from the first bytes of
+// the body, JSON and XML are recognized. The reader is rewound.
+func sniffBodyProcessor(reader io.ReadSeeker) (string, error) {
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(reader, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	b := bytes.TrimLeft(bytes.TrimPrefix(buf[:n], []byte("\xef\xbb\xbf")), " \t\r\n")
+	switch {
+	case len(b) == 0:
+		return "", nil
+	case b[0] == '{' || b[0] == '[':
+		return "json", nil
+	case b[0] == '<':
+		return "xml", nil
+	}
+	return "", nil
+}
+
+// requestBodyCharset returns the charset declared by the request
+// Content-Type if the body must be transcoded
+func (tx *Transaction) requestBodyCharset(contentType string) string {
+	if !tx.WAF.RequestBodyCharsetDecoding || contentType == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch cs := strings.ToLower(params["charset"]); cs {
+	case "", "utf-8", "utf8", "us-ascii":
+		return ""
+	default:
+		return cs
+	}
+}
+
 // ProcessResponseHeaders Perform the analysis on the response readers.
 //
 // This method perform the analysis on the response headers, notice however
@@ -981,29 +2012,60 @@ func (tx *Transaction) ProcessRequestBody() (*types.Interruption, error) {
 //
 // note: Remember to check for a possible intervention.
 func (tx *Transaction) ProcessResponseHeaders(code int, proto string) *types.Interruption {
+	if tx.shadow != nil {
+		tx.shadow.ProcessResponseHeaders(code, proto)
+	}
 	if tx.RuleEngine == types.RuleEngineOff {
 		return nil
 	}
 
 	if tx.LastPhase >= types.PhaseResponseHeaders {
 		// Phase already evaluated
-		tx.WAF.Logger.Error("ProcessResponseHeaders has already been called")
+		tx.debugLogger.Error("ProcessResponseHeaders has already been called")
 		return tx.interruption
 	}
 
 	if tx.interruption != nil {
-		tx.WAF.Logger.Error("Calling ProcessResponseHeaders but there is a preexisting interruption")
+		tx.debugLogger.Error("Calling ProcessResponseHeaders but there is a preexisting interruption")
 		return tx.interruption
 	}
 
 	c := strconv.Itoa(code)
 	tx.variables.responseStatus.Set(c)
 	tx.variables.responseProtocol.Set(proto)
+	tx.maskServerSignature()
+	if len(tx.WAF.SignedCookies) > 0 {
+		tx.signResponseCookies()
+	}
+	if tx.HashEngine {
+		tx.signLocation()
+	}
 
 	tx.WAF.Rules.Eval(types.PhaseResponseHeaders, tx)
 	return tx.interruption
 }
 
+// maskServerSignature schedules the change of the Server header configured
+// with SecServerSignature, mutations of the rules are applied after it.
+// RESPONSE_HEADERS keeps the header sent by the upstream.
+func (tx *Transaction) maskServerSignature() {
+	hasServer := len(tx.variables.responseHeaders.Get("server")) > 0
+	switch tx.WAF.ServerSignatureMode {
+	case types.ServerSignatureRemove:
+		if hasServer {
+			tx.AddResponseHeaderMutation(types.HeaderMutation{Action: types.HeaderMutationRemove, Name: "Server"})
+		}
+	case types.ServerSignatureInject:
+		if tx.WAF.ServerSignature != "" {
+			tx.AddResponseHeaderMutation(types.HeaderMutation{Action: types.HeaderMutationSet, Name: "Server", Value: tx.WAF.ServerSignature})
+		}
+	default:
+		if hasServer && tx.WAF.ServerSignature != "" {
+			tx.AddResponseHeaderMutation(types.HeaderMutation{Action: types.HeaderMutationSet, Name: "Server", Value: tx.WAF.ServerSignature})
+		}
+	}
+}
+
 // IsResponseBodyProcessable returns true if the response body meets the
 // criteria to be processed, response headers must be set before this.
 // The content-type response header must be in the SecResponseBodyMimeType
@@ -1027,53 +2089,273 @@ func (tx *Transaction) ResponseBodyWriter() io.Writer {
 //
 // note Remember to check for a possible intervention.
 func (tx *Transaction) ProcessResponseBody() (*types.Interruption, error) {
+	if tx.shadow != nil {
+		tx.processShadowResponseBody()
+	}
 	if tx.RuleEngine == types.RuleEngineOff {
 		return nil, nil
 	}
 
 	if tx.LastPhase >= types.PhaseResponseBody {
 		// Phase already evaluated
-		tx.WAF.Logger.Error("ProcessResponseBody has already been called")
+		tx.debugLogger.Error("ProcessResponseBody has already been called")
 		return tx.interruption, nil
 	}
 
 	if tx.interruption != nil {
-		tx.WAF.Logger.Error("Calling ProcessResponseBody but there is a preexisting interruption")
+		tx.debugLogger.Error("Calling ProcessResponseBody but there is a preexisting interruption")
 		return tx.interruption, nil
 	}
 
 	if !tx.ResponseBodyAccess || !tx.IsResponseBodyProcessable() {
-		tx.WAF.Logger.Debug("[%s] Skipping response body processing (Access: %t)", tx.id, tx.ResponseBodyAccess)
+		tx.debugLogger.Debug("Skipping response body processing (Access: %t)", tx.ResponseBodyAccess)
 		tx.WAF.Rules.Eval(types.PhaseResponseBody, tx)
 		return tx.interruption, nil
 	}
-	tx.WAF.Logger.Debug("[%s] Attempting to process response body", tx.id)
+	tx.debugLogger.Debug("Attempting to process response body")
 	reader, err := tx.ResponseBodyBuffer.Reader()
 	if err != nil {
 		return tx.interruption, err
 	}
-	reader = io.LimitReader(reader, tx.WAF.ResponseBodyLimit)
 	buf := new(strings.Builder)
-	length, err := io.Copy(buf, reader)
+	length, err := io.Copy(buf, io.LimitReader(reader, tx.WAF.ResponseBodyLimit))
 	if err != nil {
 		return tx.interruption, err
 	}
 
-	if tx.ResponseBodyBuffer.Size() >= tx.WAF.ResponseBodyLimit {
+	// the bytes beyond the limit were dropped by the buffer or not read
+	truncated := tx.ResponseBodyBuffer.discarded || tx.ResponseBodyBuffer.Size() > tx.WAF.ResponseBodyLimit
+	tx.responseBodyTruncated = truncated
+	if truncated {
 		tx.variables.outboundDataError.Set("1")
 	}
 
+	body := buf.String()
+	// decompressed bodies are inspected but never written back, the
+	// response keeps its Content-Encoding
+	decompressed := false
+	if tx.WAF.ResponseBodyDecompression {
+		body, decompressed = tx.decompressResponseBody(body, truncated)
+	}
+	// truncated bodies are not signed, otherwise the response would be cut,
+	// and only html documents contain links
+	if tx.HashEngine && !truncated && !decompressed &&
+		strings.Contains(strings.ToLower(tx.variables.responseContentType.String()), "html") {
+		if signed, ok := tx.signLinks(body); ok {
+			if err := tx.replaceResponseBody(signed); err != nil {
+				return tx.interruption, err
+			}
+			body = signed
+			length = int64(len(body))
+		}
+	}
+	if tx.WAF.CSRFProtection && tx.WAF.ContentInjection && !truncated && !decompressed &&
+		strings.Contains(strings.ToLower(tx.variables.responseContentType.String()), "html") {
+		if injected, ok := tx.injectCSRFToken(body); ok {
+			if err := tx.replaceResponseBody(injected); err != nil {
+				return tx.interruption, err
+			}
+			body = injected
+			length = int64(len(body))
+		}
+	}
+	if (len(tx.WAF.HoneypotFields) > 0 || len(tx.WAF.HoneypotPaths) > 0) && tx.WAF.ContentInjection && !truncated && !decompressed &&
+		strings.Contains(strings.ToLower(tx.variables.responseContentType.String()), "html") {
+		if injected, ok := tx.injectHoneypots(body); ok {
+			if err := tx.replaceResponseBody(injected); err != nil {
+				return tx.interruption, err
+			}
+			body = injected
+			length = int64(len(body))
+		}
+	}
+
 	tx.variables.responseContentLength.Set(strconv.FormatInt(length, 10))
-	tx.variables.responseBody.Set(buf.String())
+	tx.variables.responseBody.Set(body)
+	// truncated bodies are not streamed, otherwise the response would be cut
+	stream := tx.WAF.StreamOutBodyInspection && !truncated && !decompressed
+	if stream {
+		tx.variables.streamOutputBody.Set(body)
+	}
 	tx.WAF.Rules.Eval(types.PhaseResponseBody, tx)
+	if stream {
+		if out := tx.variables.streamOutputBody.String(); out != body {
+			if err := tx.replaceResponseBody(out); err != nil {
+				return tx.interruption, err
+			}
+		}
+	}
 	return tx.interruption, nil
 }
 
+var (
+	errDecompressionLimit = errors.New("decompressed body exceeds the body limit")
+	errDecompressionRatio = errors.New("decompressed body exceeds the decompression ratio")
+)
+
+// decompressBody decodes a body of size bytes with the codings of a
+// Content-Encoding header, it returns false if the body is not encoded or
+// a coding is not supported. The decompressed body is cut at limit bytes
+// and at ratio times the compressed size, errDecompressionLimit and
+// errDecompressionRatio are returned along with the cut body.
+func (tx *Transaction) decompressBody(body io.Reader, size int64, header string, limit int64, ratio int, truncated bool) (string, bool, error) {
+	// responses to HEAD requests and 204 or 304 responses declare the
+	// coding of a body that isn't sent
+	if size == 0 {
+		return "", false, nil
+	}
+	var (
+		r       = body
+		decoded bool
+		err     error
+	)
+	codings := strings.Split(header, ",")
+	// the codings are listed in the order they were applied
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.TrimSpace(codings[i])
+		if coding == "" || strings.EqualFold(coding, "identity") {
+			continue
+		}
+		decode, ok := contentencoding.Get(coding)
+		if !ok {
+			tx.debugLogger.Debug("Skipping body decompression, unsupported content coding %q", coding)
+			return "", false, nil
+		}
+		if r, err = decode(r); err != nil {
+			return "", false, err
+		}
+		decoded = true
+	}
+	if !decoded {
+		return "", false, nil
+	}
+
+	limitErr := errDecompressionLimit
+	if ratio > 0 && size*int64(ratio) < limit {
+		limit = size * int64(ratio)
+		limitErr = errDecompressionRatio
+	}
+	buf := new(strings.Builder)
+	n, err := io.Copy(buf, io.LimitReader(r, limit+1))
+	// a truncated body can't be decompressed to the end
+	if err != nil && !(truncated && errors.Is(err, io.ErrUnexpectedEOF)) {
+		return "", false, err
+	}
+	if n > limit {
+		return buf.String()[:limit], true, limitErr
+	}
+	return buf.String(), true, nil
+}
+
+// decompressResponseBody decompresses the response body, decompression
+// errors are reported in RESPONSE_BODY_DECOMPRESSION_ERROR
+func (tx *Transaction) decompressResponseBody(body string, truncated bool) (string, bool) {
+	header := strings.Join(tx.variables.responseHeaders.Get("content-encoding"), ",")
+	if header == "" {
+		return body, false
+	}
+	decompressed, ok, err := tx.decompressBody(strings.NewReader(body), int64(len(body)), header,
+		tx.WAF.ResponseBodyLimit, tx.WAF.ResponseBodyDecompressionRatio, truncated)
+	switch {
+	case errors.Is(err, errDecompressionLimit):
+		tx.variables.outboundDataError.Set("1")
+	case errors.Is(err, errDecompressionRatio):
+		tx.variables.responseBodyDecompressionError.Set("1")
+		tx.debugLogger.Warn("Response body exceeds the decompression ratio of %d, it is cut", tx.WAF.ResponseBodyDecompressionRatio)
+	case err != nil:
+		tx.variables.responseBodyDecompressionError.Set("1")
+		tx.debugLogger.Error("Failed to decompress the response body: %s", err.Error())
+		return body, false
+	}
+	if !ok {
+		return body, false
+	}
+	return decompressed, true
+}
+
+// decompressRequestBody returns a reader with the decompressed request
+// body, decompression errors are reported in
+// REQUEST_BODY_DECOMPRESSION_ERROR and bodies exceeding the limits are
+// rejected with the Reject request body limit action
+func (tx *Transaction) decompressRequestBody(body io.ReadSeeker) (io.ReadSeeker, error) {
+	header := strings.Join(tx.variables.requestHeaders.Get("content-encoding"), ",")
+	if header == "" {
+		return body, nil
+	}
+	// the discarded compressed bytes say nothing about the decompressed
+	// arguments
+	tx.requestBodyCutAtSeparator = false
+	decompressed, ok, err := tx.decompressBody(body, tx.requestBodyBuffer.length, header,
+		tx.RequestBodyLimit, tx.WAF.RequestBodyDecompressionRatio, tx.requestBodyTruncated)
+	switch {
+	case errors.Is(err, errDecompressionLimit), errors.Is(err, errDecompressionRatio):
+		if errors.Is(err, errDecompressionLimit) {
+			tx.variables.inboundDataError.Set("1")
+		} else {
+			tx.variables.requestBodyDecompressionError.Set("1")
+		}
+		tx.debugLogger.Warn("Request body decompression stopped: %s", err.Error())
+		if tx.WAF.RequestBodyLimitAction == types.RequestBodyLimitActionReject {
+			tx.setLimitInterruption()
+		}
+	case err != nil:
+		tx.variables.requestBodyDecompressionError.Set("1")
+		tx.debugLogger.Error("Failed to decompress the request body: %s", err.Error())
+		// the encoded body is inspected as is
+		return tx.requestBodyBuffer.Reader()
+	}
+	if !ok {
+		return tx.requestBodyBuffer.Reader()
+	}
+	return strings.NewReader(decompressed), nil
+}
+
+// replaceResponseBody overwrites the buffered response body, it is used
+// when the WAF has to modify the response, like the hash engine does
+func (tx *Transaction) replaceResponseBody(body string) error {
+	if err := tx.ResponseBodyBuffer.Reset(); err != nil {
+		return err
+	}
+	if _, err := tx.ResponseBodyBuffer.Write([]byte(body)); err != nil {
+		return err
+	}
+	// the Content-Length declared upstream no longer matches the body
+	if len(tx.variables.responseHeaders.Get("content-length")) > 0 {
+		tx.setResponseHeaderMutation(types.HeaderMutation{
+			Action: types.HeaderMutationSet,
+			Name:   "Content-Length",
+			Value:  strconv.Itoa(len(body)),
+		})
+	}
+	return nil
+}
+
+// setResponseHeaderMutation schedules m replacing the mutations of the same
+// action and header, the body can be rewritten more than once
+func (tx *Transaction) setResponseHeaderMutation(m types.HeaderMutation) {
+	for i, o := range tx.responseHeaderMutations {
+		if o.Action == m.Action && strings.EqualFold(o.Name, m.Name) {
+			tx.responseHeaderMutations[i] = m
+			return
+		}
+	}
+	tx.AddResponseHeaderMutation(m)
+}
+
 // ProcessLogging Logging all information relative to this transaction.
 // An error log
 // At this point there is not need to hold the connection, the response can be
 // delivered prior to the execution of this method.
 func (tx *Transaction) ProcessLogging() {
+	if tx.shadow != nil {
+		tx.shadow.ProcessLogging()
+		if diff, ok := tx.candidateDiff(); ok && tx.WAF.candidateDiffCb != nil {
+			tx.WAF.candidateDiffCb(diff)
+		}
+	}
+	if tx.WAF.Profile != nil && tx.WAF.ProfileMode == profiler.Learn {
+		tx.learnProfile()
+	}
 	// If Rule engine is disabled, Log phase rules are not going to be evaluated.
 	// This avoids trying to rely on variables not set by previous rules that
 	// have not been executed
@@ -1083,13 +2365,13 @@ func (tx *Transaction) ProcessLogging() {
 
 	if tx.AuditEngine == types.AuditEngineOff {
 		// Audit engine disabled
-		tx.WAF.Logger.Debug("[%s] Transaction not marked for audit logging, AuditEngine is disabled", tx.id)
+		tx.debugLogger.Debug("Transaction not marked for audit logging, AuditEngine is disabled")
 		return
 	}
 
 	if tx.AuditEngine == types.AuditEngineRelevantOnly && !tx.audit {
 		// Transaction marked not for audit logging
-		tx.WAF.Logger.Debug("[%s] Transaction not marked for audit logging, AuditEngine is RelevantOnly and we got noauditlog", tx.id)
+		tx.debugLogger.Debug("Transaction not marked for audit logging, AuditEngine is RelevantOnly and we got noauditlog")
 		return
 	}
 
@@ -1098,16 +2380,16 @@ func (tx *Transaction) ProcessLogging() {
 		status := tx.variables.responseStatus.String()
 		if re != nil && !re.Match([]byte(status)) {
 			// Not relevant status
-			tx.WAF.Logger.Debug("[%s] Transaction status not marked for audit logging", tx.id)
+			tx.debugLogger.Debug("Transaction status not marked for audit logging")
 			return
 		}
 	}
 
-	tx.WAF.Logger.Debug("[%s] Transaction marked for audit logging", tx.id)
+	tx.debugLogger.Debug("Transaction marked for audit logging")
 	if writer := tx.WAF.AuditLogWriter; writer != nil {
 		// We don't log if there is an empty audit logger
 		if err := writer.Write(tx.AuditLog()); err != nil {
-			tx.WAF.Logger.Error(err.Error())
+			tx.debugLogger.Error(err.Error())
 		}
 	}
 }
@@ -1140,6 +2422,57 @@ func (tx *Transaction) MatchedRules() []types.MatchedRule {
 	return tx.matchedRules
 }
 
+// AddResponseHeaderMutation schedules a change to the response headers
+func (tx *Transaction) AddResponseHeaderMutation(m types.HeaderMutation) {
+	tx.responseHeaderMutations = append(tx.responseHeaderMutations, m)
+}
+
+func (tx *Transaction) ResponseHeaderMutations() []types.HeaderMutation {
+	return tx.responseHeaderMutations
+}
+
+// EnableTracing records the evaluation of each rule
+func (tx *Transaction) EnableTracing() {
+	tx.tracing = true
+}
+
+// Trace returns the evaluation of the rules since tracing was enabled
+func (tx *Transaction) Trace() []types.RuleTrace {
+	return tx.trace
+}
+
+// PerfStats returns the time spent evaluating each phase and the rules
+// exceeding WAF.RulePerfTime
+func (tx *Transaction) PerfStats() types.PerfStats {
+	stats := types.PerfStats{
+		Phases: make(map[types.RulePhase]time.Duration, len(tx.stopWatches)),
+		Rules:  map[int]time.Duration{},
+	}
+	for phase, d := range tx.stopWatches {
+		stats.Phases[phase] = time.Duration(d)
+		stats.Combined += time.Duration(d)
+	}
+	for id, d := range tx.ruleDurations {
+		if d >= tx.WAF.RulePerfTime {
+			stats.Rules[id] = d
+		}
+	}
+	return stats
+}
+
+// AddPause increases the time the transaction will be delayed,
+// the total is capped by WAF.PauseLimit
+func (tx *Transaction) AddPause(d time.Duration) {
+	tx.pause += d
+	if l := tx.WAF.PauseLimit; l > 0 && tx.pause > l {
+		tx.pause = l
+	}
+}
+
+func (tx *Transaction) PauseDuration() time.Duration {
+	return tx.pause
+}
+
 // AuditLog returns an AuditLog struct, used to write audit logs
 func (tx *Transaction) AuditLog() *loggers.AuditLog {
 	al := &loggers.AuditLog{}
@@ -1168,6 +2501,17 @@ func (tx *Transaction) AuditLog() *loggers.AuditLog {
 			// body and headers are audit parts
 		},
 	}
+	if verify := tx.variables.sslClientVerify.String(); verify != "" && verify != "NONE" {
+		al.Transaction.ClientCertificate = &loggers.AuditClientCertificate{
+			Verify:  verify,
+			Subject: tx.variables.sslClientSDN.String(),
+			Issuer:  tx.variables.sslClientIDN.String(),
+			Serial:  tx.variables.sslClientMSerial.String(),
+		}
+		if t, err := time.Parse(sslTimeFormat, tx.variables.sslClientVEnd.String()); err == nil {
+			al.Transaction.ClientCertificate.NotAfter = t.Format(time.RFC3339)
+		}
+	}
 	rengine := tx.RuleEngine.String()
 
 	al.Transaction.Request.Headers = tx.variables.requestHeaders.Data()
@@ -1183,6 +2527,8 @@ func (tx *Transaction) AuditLog() *loggers.AuditLog {
 		RuleEngine: rengine,
 		Stopwatch:  tx.GetStopWatch(),
 		Rulesets:   tx.WAF.ComponentNames,
+
+		RulesPerformance: tx.rulesPerformance(),
 	}
 	/*
 	* TODO:
@@ -1213,23 +2559,31 @@ func (tx *Transaction) AuditLog() *loggers.AuditLog {
 	var mrs []loggers.AuditMessage
 	for _, mr := range tx.matchedRules {
 		r := mr.Rule()
+		md, ok := r.(*corazarules.RuleMetadata)
+		hasSeverity := ok && md.HasSeverity_
 		for _, matchData := range mr.MatchedDatas() {
+			// the matches of the chained rules get the message of the rule
+			msg, data := matchData.Message(), matchData.Data()
+			if msg == "" && data == "" {
+				msg, data = mr.Message(), mr.Data()
+			}
 			mrs = append(mrs, loggers.AuditMessage{
 				Actionset: strings.Join(tx.WAF.ComponentNames, " "),
-				Message:   matchData.Message(),
+				Message:   msg,
 				Data: loggers.AuditMessageData{
-					File:     mr.Rule().File(),
-					Line:     mr.Rule().Line(),
-					ID:       r.ID(),
-					Rev:      r.Revision(),
-					Msg:      matchData.Message(),
-					Data:     matchData.Data(),
-					Severity: r.Severity(),
-					Ver:      r.Version(),
-					Maturity: r.Maturity(),
-					Accuracy: r.Accuracy(),
-					Tags:     r.Tags(),
-					Raw:      r.Raw(),
+					File:        mr.Rule().File(),
+					Line:        mr.Rule().Line(),
+					ID:          r.ID(),
+					Rev:         r.Revision(),
+					Msg:         msg,
+					Data:        data,
+					Severity:    r.Severity(),
+					HasSeverity: hasSeverity,
+					Ver:         r.Version(),
+					Maturity:    r.Maturity(),
+					Accuracy:    r.Accuracy(),
+					Tags:        r.Tags(),
+					Raw:         r.Raw(),
 				},
 			})
 		}
@@ -1242,9 +2596,17 @@ func (tx *Transaction) AuditLog() *loggers.AuditLog {
 // This method helps the GC to clean up the transaction faster and release resources
 // It also allows caches the transaction back into the sync.Pool
 func (tx *Transaction) Close() error {
-	defer tx.WAF.txPool.Put(tx)
+	defer tx.WAF.releaseTransaction(tx)
+	tx.releaseConnection()
 	tx.variables.reset()
+	tx.arena.Reset()
 	var errs []error
+	if tx.shadow != nil {
+		if err := tx.shadow.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		tx.shadow = nil
+	}
 	if err := tx.requestBodyBuffer.Reset(); err != nil {
 		errs = append(errs, err)
 	}
@@ -1252,7 +2614,7 @@ func (tx *Transaction) Close() error {
 		errs = append(errs, err)
 	}
 
-	tx.WAF.Logger.Debug("[%s] Transaction finished, disrupted: %t", tx.id, tx.IsInterrupted())
+	tx.debugLogger.Debug("Transaction finished, disrupted: %t", tx.IsInterrupted())
 
 	switch {
 	case len(errs) == 0:
@@ -1317,6 +2679,18 @@ func (tx *Transaction) Debug() string {
 	return res
 }
 
+// generateRuleError generates the error variables for a rule
+// whose evaluation panicked
+func (tx *Transaction) generateRuleError(r *Rule, err interface{}) {
+	rid := r.ID_
+	if rid == 0 {
+		rid = r.ParentID_
+	}
+	tx.variables.ruleError.Set("1")
+	tx.variables.ruleErrorMsg.Set(fmt.Sprintf("rule %d: %v", rid, err))
+	tx.debugLogger.Error("Recovered from panic evaluating rule %d: %v", rid, err)
+}
+
 // generateReqbodyError generates all the error variables for the request body parser
 func (tx *Transaction) generateReqbodyError(err error) {
 	tx.variables.reqbodyError.Set("1")
@@ -1328,105 +2702,211 @@ func (tx *Transaction) generateReqbodyError(err error) {
 // TransactionVariables has pointers to all the variables of the transaction
 type TransactionVariables struct {
 	// Simple Variables
-	userID                        *collection.Simple
-	urlencodedError               *collection.Simple
-	responseContentType           *collection.Simple
-	uniqueID                      *collection.Simple
-	argsCombinedSize              *collection.SizeProxy
-	authType                      *collection.Simple
-	filesCombinedSize             *collection.Simple
-	fullRequest                   *collection.Simple
-	fullRequestLength             *collection.Simple
-	inboundDataError              *collection.Simple
-	matchedVar                    *collection.Simple
-	matchedVarName                *collection.Simple
-	multipartBoundaryQuoted       *collection.Simple
-	multipartBoundaryWhitespace   *collection.Simple
-	multipartCrlfLfLines          *collection.Simple
-	multipartDataAfter            *collection.Simple
-	multipartDataBefore           *collection.Simple
-	multipartFileLimitExceeded    *collection.Simple
-	multipartHeaderFolding        *collection.Simple
-	multipartInvalidHeaderFolding *collection.Simple
-	multipartInvalidPart          *collection.Simple
-	multipartInvalidQuoting       *collection.Simple
-	multipartLfLine               *collection.Simple
-	multipartMissingSemicolon     *collection.Simple
-	multipartStrictError          *collection.Simple
-	multipartUnmatchedBoundary    *collection.Simple
-	outboundDataError             *collection.Simple
-	pathInfo                      *collection.Simple
-	queryString                   *collection.Simple
-	remoteAddr                    *collection.Simple
-	remoteHost                    *collection.Simple
-	remotePort                    *collection.Simple
-	reqbodyError                  *collection.Simple
-	reqbodyErrorMsg               *collection.Simple
-	reqbodyProcessorError         *collection.Simple
-	reqbodyProcessorErrorMsg      *collection.Simple
-	reqbodyProcessor              *collection.Simple
-	requestBasename               *collection.Simple
-	requestBody                   *collection.Simple
-	requestBodyLength             *collection.Simple
-	requestFilename               *collection.Simple
-	requestLine                   *collection.Simple
-	requestMethod                 *collection.Simple
-	requestProtocol               *collection.Simple
-	requestURI                    *collection.Simple
-	requestURIRaw                 *collection.Simple
-	responseBody                  *collection.Simple
-	responseContentLength         *collection.Simple
-	responseProtocol              *collection.Simple
-	responseStatus                *collection.Simple
-	serverAddr                    *collection.Simple
-	serverName                    *collection.Simple
-	serverPort                    *collection.Simple
-	sessionID                     *collection.Simple
-	highestSeverity               *collection.Simple
-	statusLine                    *collection.Simple
-	inboundErrorData              *collection.Simple
+	userID                         *collection.Simple
+	urlencodedError                *collection.Simple
+	requestCookiesError            *collection.Simple
+	requestCookiesErrorMsg         *collection.Simple
+	accessListAction               *collection.Simple
+	accessListEntry                *collection.Simple
+	openAPIOperation               *collection.Simple
+	csrfToken                      *collection.Simple
+	csrfError                      *collection.Simple
+	csrfErrorMsg                   *collection.Simple
+	tlsJA3                         *collection.Simple
+	tlsJA3Hash                     *collection.Simple
+	tlsJA4                         *collection.Simple
+	sslClientVerify                *collection.Simple
+	sslClientSDN                   *collection.Simple
+	sslClientSDNCN                 *collection.Simple
+	sslClientIDN                   *collection.Simple
+	sslClientMSerial               *collection.Simple
+	sslClientVStart                *collection.Simple
+	sslClientVEnd                  *collection.Simple
+	sslClientVRemain               *collection.Simple
+	honeypotPath                   *collection.Simple
+	requestURIScheme               *collection.Simple
+	requestURIHost                 *collection.Simple
+	requestURIUserinfo             *collection.Simple
+	requestURIFragment             *collection.Simple
+	requestURIExtraQuery           *collection.Simple
+	connConcurrent                 *collection.Simple
+	connRate                       *collection.Simple
+	connLimitExceeded              *collection.Simple
+	requestBodyDuration            *collection.Simple
+	requestBodyChunks              *collection.Simple
+	requestBodyChunkInterval       *collection.Simple
+	requestBodyChunkSize           *collection.Simple
+	memoryLimitExceeded            *collection.Simple
+	streamInputBody                *collection.Simple
+	streamOutputBody               *collection.Simple
+	responseBodyDecompressionError *collection.Simple
+	requestBodyDecompressionError  *collection.Simple
+	ruleError                      *collection.Simple
+	ruleErrorMsg                   *collection.Simple
+	responseContentType            *collection.Simple
+	uniqueID                       *collection.Simple
+	argsCombinedSize               *collection.SizeProxy
+	authType                       *collection.Simple
+	filesCombinedSize              *collection.Simple
+	fullRequest                    *collection.Simple
+	fullRequestLength              *collection.Simple
+	inboundDataError               *collection.Simple
+	matchedVar                     *collection.Simple
+	matchedVarName                 *collection.Simple
+	multipartBoundaryQuoted        *collection.Simple
+	multipartBoundaryWhitespace    *collection.Simple
+	multipartCrlfLfLines           *collection.Simple
+	multipartDataAfter             *collection.Simple
+	multipartDataBefore            *collection.Simple
+	multipartFileLimitExceeded     *collection.Simple
+	multipartHeaderFolding         *collection.Simple
+	multipartInvalidHeaderFolding  *collection.Simple
+	multipartInvalidPart           *collection.Simple
+	multipartInvalidQuoting        *collection.Simple
+	multipartLfLine                *collection.Simple
+	multipartMissingSemicolon      *collection.Simple
+	multipartStrictError           *collection.Simple
+	multipartUnmatchedBoundary     *collection.Simple
+	outboundDataError              *collection.Simple
+	pathInfo                       *collection.Simple
+	queryString                    *collection.Simple
+	remoteAddr                     *collection.Simple
+	remoteHost                     *collection.Simple
+	remotePort                     *collection.Simple
+	reqbodyError                   *collection.Simple
+	reqbodyErrorMsg                *collection.Simple
+	reqbodyProcessorError          *collection.Simple
+	reqbodyProcessorErrorMsg       *collection.Simple
+	reqbodyProcessor               *collection.Simple
+	requestBasename                *collection.Simple
+	requestBody                    *collection.Simple
+	requestBodyLength              *collection.Simple
+	requestFilename                *collection.Simple
+	requestLine                    *collection.Simple
+	requestMethod                  *collection.Simple
+	requestProtocol                *collection.Simple
+	requestURI                     *collection.Simple
+	requestURIRaw                  *collection.Simple
+	responseBody                   *collection.Simple
+	responseContentLength          *collection.Simple
+	responseProtocol               *collection.Simple
+	responseStatus                 *collection.Simple
+	serverAddr                     *collection.Simple
+	serverName                     *collection.Simple
+	serverPort                     *collection.Simple
+	sessionID                      *collection.Simple
+	highestSeverity                *collection.Simple
+	statusLine                     *collection.Simple
+	inboundErrorData               *collection.Simple
 	// Custom
 	env      *collection.Map
 	tx       *collection.Map
 	rule     *collection.Map
 	duration *collection.Simple
+	// time contains the TIME_* variables computed on access
+	time [variables.TimeYear - variables.Time + 1]*collection.Simple
+	// perf contains the PERF_PHASE* and PERF_COMBINED variables computed on access
+	perf      [variables.PerfCombined - variables.PerfPhase1 + 1]*collection.Simple
+	perfRules *collection.Map
+	// requestHeadersRaw is computed on access from Transaction.requestHeadersRaw
+	requestHeadersRaw *collection.Simple
+	// uriNormalized contains REQUEST_URI_LOWERCASE, the REQUEST_FILENAME_*
+	// normalizations and PATH_NORMALIZATION_CHANGED computed on access
+	// from Transaction.uriNormalization
+	uriNormalized [variables.PathNormalizationChanged - variables.RequestURILowercase + 1]*collection.Simple
 	// Proxy Variables
 	args *collection.Proxy
 	// Maps Variables
-	argsGet              *collection.Map
-	argsPost             *collection.Map
-	argsPath             *collection.Map
-	filesTmpNames        *collection.Map
-	geo                  *collection.Map
-	files                *collection.Map
-	requestCookies       *collection.Map
-	requestHeaders       *collection.Map
-	responseHeaders      *collection.Map
-	multipartName        *collection.Map
-	matchedVarsNames     *collection.Map
-	multipartFilename    *collection.Map
-	matchedVars          *collection.Map
-	filesSizes           *collection.Map
-	filesNames           *collection.Map
-	filesTmpContent      *collection.Map
-	responseHeadersNames *collection.Map
-	requestHeadersNames  *collection.Map
-	requestCookiesNames  *collection.Map
-	xml                  *collection.Map
-	requestXML           *collection.Map
-	responseXML          *collection.Map
-	multipartPartHeaders *collection.Map
+	argsGet                  *collection.Map
+	argsPost                 *collection.Map
+	argsPath                 *collection.Map
+	filesTmpNames            *collection.Map
+	geo                      *collection.Map
+	files                    *collection.Map
+	requestCookies           *collection.Map
+	requestHeaders           *collection.Map
+	responseHeaders          *collection.Map
+	multipartName            *collection.Map
+	matchedVarsNames         *collection.Map
+	multipartFilename        *collection.Map
+	matchedVars              *collection.Map
+	filesSizes               *collection.Map
+	filesNames               *collection.Map
+	filesTmpContent          *collection.Map
+	responseHeadersNames     *collection.Map
+	requestHeadersNames      *collection.Map
+	requestCookiesNames      *collection.Map
+	xml                      *collection.Map
+	requestXML               *collection.Map
+	responseXML              *collection.Map
+	multipartPartHeaders     *collection.Map
+	requestPseudoHeaders     *collection.Map
+	requestProtocolAnomalies *collection.Map
+	requestSOAP              *collection.Map
+	requestXMLAnomalies      *collection.Map
+	openAPIViolations        *collection.Map
+	requestCookiesTampered   *collection.Map
+	requestCookiesUnsigned   *collection.Map
+	sslClientSAN             *collection.Map
+	profileViolation         *collection.Map
+	honeypotFields           *collection.Map
 	// Persistent variables
-	ip *collection.Map
+	ip       *collection.Map
+	global   *collection.Map
+	session  *collection.Map
+	user     *collection.Map
+	resource *collection.Map
 	// Translation Proxy Variables
 	argsNames     *collection.TranslationProxy
 	argsGetNames  *collection.TranslationProxy
 	argsPostNames *collection.TranslationProxy
+	// memory is shared by the collections of request and response data
+	memory *collection.MemoryBudget
 }
 
 func NewTransactionVariables() *TransactionVariables {
 	v := &TransactionVariables{}
 	v.urlencodedError = collection.NewSimple(variables.UrlencodedError)
+	v.requestCookiesError = collection.NewSimple(variables.RequestCookiesError)
+	v.requestCookiesErrorMsg = collection.NewSimple(variables.RequestCookiesErrorMsg)
+	v.accessListAction = collection.NewSimple(variables.AccessListAction)
+	v.accessListEntry = collection.NewSimple(variables.AccessListEntry)
+	v.openAPIOperation = collection.NewSimple(variables.OpenAPIOperation)
+	v.csrfToken = collection.NewSimple(variables.CSRFToken)
+	v.csrfError = collection.NewSimple(variables.CSRFError)
+	v.csrfErrorMsg = collection.NewSimple(variables.CSRFErrorMsg)
+	v.tlsJA3 = collection.NewSimple(variables.TLSJA3)
+	v.tlsJA3Hash = collection.NewSimple(variables.TLSJA3Hash)
+	v.tlsJA4 = collection.NewSimple(variables.TLSJA4)
+	v.sslClientVerify = collection.NewSimple(variables.SSLClientVerify)
+	v.sslClientSDN = collection.NewSimple(variables.SSLClientSDN)
+	v.sslClientSDNCN = collection.NewSimple(variables.SSLClientSDNCN)
+	v.sslClientIDN = collection.NewSimple(variables.SSLClientIDN)
+	v.sslClientMSerial = collection.NewSimple(variables.SSLClientMSerial)
+	v.sslClientVStart = collection.NewSimple(variables.SSLClientVStart)
+	v.sslClientVEnd = collection.NewSimple(variables.SSLClientVEnd)
+	v.sslClientVRemain = collection.NewSimple(variables.SSLClientVRemain)
+	v.honeypotPath = collection.NewSimple(variables.HoneypotPath)
+	v.requestURIScheme = collection.NewSimple(variables.RequestURIScheme)
+	v.requestURIHost = collection.NewSimple(variables.RequestURIHost)
+	v.requestURIUserinfo = collection.NewSimple(variables.RequestURIUserinfo)
+	v.requestURIFragment = collection.NewSimple(variables.RequestURIFragment)
+	v.requestURIExtraQuery = collection.NewSimple(variables.RequestURIExtraQuery)
+	v.connConcurrent = collection.NewSimple(variables.ConnConcurrent)
+	v.connRate = collection.NewSimple(variables.ConnRate)
+	v.connLimitExceeded = collection.NewSimple(variables.ConnLimitExceeded)
+	v.requestBodyDuration = collection.NewSimple(variables.RequestBodyDuration)
+	v.requestBodyChunks = collection.NewSimple(variables.RequestBodyChunks)
+	v.requestBodyChunkInterval = collection.NewSimple(variables.RequestBodyChunkInterval)
+	v.requestBodyChunkSize = collection.NewSimple(variables.RequestBodyChunkSize)
+	v.honeypotFields = collection.NewMap(variables.HoneypotFields)
+	v.memoryLimitExceeded = collection.NewSimple(variables.MemoryLimitExceeded)
+	v.streamInputBody = collection.NewSimple(variables.StreamInputBody)
+	v.streamOutputBody = collection.NewSimple(variables.StreamOutputBody)
+	v.responseBodyDecompressionError = collection.NewSimple(variables.ResponseBodyDecompressionError)
+	v.requestBodyDecompressionError = collection.NewSimple(variables.RequestBodyDecompressionError)
+	v.ruleError = collection.NewSimple(variables.RuleError)
+	v.ruleErrorMsg = collection.NewSimple(variables.RuleErrorMsg)
 	v.responseContentType = collection.NewSimple(variables.ResponseContentType)
 	v.uniqueID = collection.NewSimple(variables.UniqueID)
 	v.authType = collection.NewSimple(variables.AuthType)
@@ -1482,6 +2962,17 @@ func NewTransactionVariables() *TransactionVariables {
 	v.statusLine = collection.NewSimple(variables.StatusLine)
 	v.inboundErrorData = collection.NewSimple(variables.InboundErrorData)
 	v.duration = collection.NewSimple(variables.Duration)
+	for i := range v.time {
+		v.time[i] = collection.NewSimple(variables.Time + variables.RuleVariable(i))
+	}
+	for i := range v.perf {
+		v.perf[i] = collection.NewSimple(variables.PerfPhase1 + variables.RuleVariable(i))
+	}
+	v.perfRules = collection.NewMap(variables.PerfRules)
+	v.requestHeadersRaw = collection.NewSimple(variables.RequestHeadersRaw)
+	for i := range v.uriNormalized {
+		v.uriNormalized[i] = collection.NewSimple(variables.RequestURILowercase + variables.RuleVariable(i))
+	}
 	v.responseHeadersNames = collection.NewMap(variables.ResponseHeadersNames)
 	v.requestHeadersNames = collection.NewMap(variables.RequestHeadersNames)
 	v.userID = collection.NewSimple(variables.Userid)
@@ -1502,6 +2993,10 @@ func NewTransactionVariables() *TransactionVariables {
 	v.rule = collection.NewMap(variables.Rule)
 	v.env = collection.NewMap(variables.Env)
 	v.ip = collection.NewMap(variables.IP)
+	v.global = collection.NewMap(variables.Global)
+	v.session = collection.NewMap(variables.Session)
+	v.user = collection.NewMap(variables.User)
+	v.resource = collection.NewMap(variables.Resource)
 	v.files = collection.NewMap(variables.Files)
 	v.matchedVarsNames = collection.NewMap(variables.MatchedVarsNames)
 	v.filesNames = collection.NewMap(variables.FilesNames)
@@ -1510,8 +3005,33 @@ func NewTransactionVariables() *TransactionVariables {
 	v.responseXML = collection.NewMap(variables.ResponseXML)
 	v.requestXML = collection.NewMap(variables.RequestXML)
 	v.multipartPartHeaders = collection.NewMap(variables.MultipartPartHeaders)
-
-	v.argsCombinedSize = collection.NewCollectionSizeProxy(variables.ArgsCombinedSize, v.argsGet, v.argsPost)
+	v.requestPseudoHeaders = collection.NewMap(variables.RequestPseudoHeaders)
+	v.requestProtocolAnomalies = collection.NewMap(variables.RequestProtocolAnomalies)
+	v.requestSOAP = collection.NewMap(variables.RequestSOAP)
+	v.requestXMLAnomalies = collection.NewMap(variables.RequestXMLAnomalies)
+	v.openAPIViolations = collection.NewMap(variables.OpenAPIViolations)
+	v.requestCookiesTampered = collection.NewMap(variables.RequestCookiesTampered)
+	v.requestCookiesUnsigned = collection.NewMap(variables.RequestCookiesUnsigned)
+	v.sslClientSAN = collection.NewMap(variables.SSLClientSAN)
+	v.profileViolation = collection.NewMap(variables.ProfileViolation)
+
+	// like ModSecurity, the names of the arguments are counted
+	v.argsCombinedSize = collection.NewCollectionCombinedSizeProxy(variables.ArgsCombinedSize, v.argsGet, v.argsPost, v.argsPath)
+
+	// the request and response data share the transaction memory limit,
+	// the collections written by the rules are not limited
+	v.memory = collection.NewMemoryBudget()
+	for _, c := range []*collection.Map{
+		v.argsGet, v.argsPost, v.argsPath,
+		v.requestHeaders, v.requestHeadersNames, v.requestPseudoHeaders,
+		v.responseHeaders, v.responseHeadersNames,
+		v.requestCookies, v.requestCookiesNames,
+		v.files, v.filesNames, v.filesSizes, v.filesTmpNames, v.filesTmpContent,
+		v.multipartFilename, v.multipartName, v.multipartPartHeaders,
+		v.requestXML, v.responseXML, v.requestSOAP,
+	} {
+		c.SetMemoryBudget(v.memory)
+	}
 
 	// XML is a pointer to RequestXML
 	v.xml = v.requestXML
@@ -1547,6 +3067,110 @@ func (v *TransactionVariables) UrlencodedError() *collection.Simple {
 	return v.urlencodedError
 }
 
+func (v *TransactionVariables) RuleError() *collection.Simple {
+	return v.ruleError
+}
+
+func (v *TransactionVariables) RuleErrorMsg() *collection.Simple {
+	return v.ruleErrorMsg
+}
+
+func (v *TransactionVariables) RequestCookiesError() *collection.Simple {
+	return v.requestCookiesError
+}
+
+func (v *TransactionVariables) RequestCookiesErrorMsg() *collection.Simple {
+	return v.requestCookiesErrorMsg
+}
+
+func (v *TransactionVariables) AccessListAction() *collection.Simple {
+	return v.accessListAction
+}
+
+func (v *TransactionVariables) AccessListEntry() *collection.Simple {
+	return v.accessListEntry
+}
+
+func (v *TransactionVariables) OpenAPIOperation() *collection.Simple {
+	return v.openAPIOperation
+}
+
+func (v *TransactionVariables) CSRFToken() *collection.Simple {
+	return v.csrfToken
+}
+
+func (v *TransactionVariables) CSRFError() *collection.Simple {
+	return v.csrfError
+}
+
+func (v *TransactionVariables) CSRFErrorMsg() *collection.Simple {
+	return v.csrfErrorMsg
+}
+
+func (v *TransactionVariables) TLSJA3() *collection.Simple {
+	return v.tlsJA3
+}
+
+func (v *TransactionVariables) TLSJA3Hash() *collection.Simple {
+	return v.tlsJA3Hash
+}
+
+func (v *TransactionVariables) TLSJA4() *collection.Simple {
+	return v.tlsJA4
+}
+
+func (v *TransactionVariables) SSLClientVerify() *collection.Simple {
+	return v.sslClientVerify
+}
+
+func (v *TransactionVariables) SSLClientSDN() *collection.Simple {
+	return v.sslClientSDN
+}
+
+func (v *TransactionVariables) SSLClientSDNCN() *collection.Simple {
+	return v.sslClientSDNCN
+}
+
+func (v *TransactionVariables) SSLClientIDN() *collection.Simple {
+	return v.sslClientIDN
+}
+
+func (v *TransactionVariables) SSLClientMSerial() *collection.Simple {
+	return v.sslClientMSerial
+}
+
+func (v *TransactionVariables) SSLClientVStart() *collection.Simple {
+	return v.sslClientVStart
+}
+
+func (v *TransactionVariables) SSLClientVEnd() *collection.Simple {
+	return v.sslClientVEnd
+}
+
+func (v *TransactionVariables) SSLClientVRemain() *collection.Simple {
+	return v.sslClientVRemain
+}
+
+func (v *TransactionVariables) MemoryLimitExceeded() *collection.Simple {
+	return v.memoryLimitExceeded
+}
+
+func (v *TransactionVariables) StreamInputBody() *collection.Simple {
+	return v.streamInputBody
+}
+
+func (v *TransactionVariables) StreamOutputBody() *collection.Simple {
+	return v.streamOutputBody
+}
+
+func (v *TransactionVariables) ResponseBodyDecompressionError() *collection.Simple {
+	return v.responseBodyDecompressionError
+}
+
+func (v *TransactionVariables) RequestBodyDecompressionError() *collection.Simple {
+	return v.requestBodyDecompressionError
+}
+
 func (v *TransactionVariables) ResponseContentType() *collection.Simple {
 	return v.responseContentType
 }
@@ -1879,10 +3503,62 @@ func (v *TransactionVariables) ResponseXML() *collection.Map {
 	return v.responseXML
 }
 
+func (v *TransactionVariables) RequestPseudoHeaders() *collection.Map {
+	return v.requestPseudoHeaders
+}
+
+func (v *TransactionVariables) RequestProtocolAnomalies() *collection.Map {
+	return v.requestProtocolAnomalies
+}
+
+func (v *TransactionVariables) RequestSOAP() *collection.Map {
+	return v.requestSOAP
+}
+
+func (v *TransactionVariables) RequestXMLAnomalies() *collection.Map {
+	return v.requestXMLAnomalies
+}
+
+func (v *TransactionVariables) OpenAPIViolations() *collection.Map {
+	return v.openAPIViolations
+}
+
+func (v *TransactionVariables) RequestCookiesTampered() *collection.Map {
+	return v.requestCookiesTampered
+}
+
+func (v *TransactionVariables) RequestCookiesUnsigned() *collection.Map {
+	return v.requestCookiesUnsigned
+}
+
+func (v *TransactionVariables) SSLClientSAN() *collection.Map {
+	return v.sslClientSAN
+}
+
+func (v *TransactionVariables) ProfileViolation() *collection.Map {
+	return v.profileViolation
+}
+
 func (v *TransactionVariables) IP() *collection.Map {
 	return v.ip
 }
 
+func (v *TransactionVariables) Global() *collection.Map {
+	return v.global
+}
+
+func (v *TransactionVariables) Session() *collection.Map {
+	return v.session
+}
+
+func (v *TransactionVariables) User() *collection.Map {
+	return v.user
+}
+
+func (v *TransactionVariables) Resource() *collection.Map {
+	return v.resource
+}
+
 func (v *TransactionVariables) ArgsNames() *collection.TranslationProxy {
 	return v.argsNames
 }
@@ -1895,9 +3571,104 @@ func (v *TransactionVariables) ArgsPostNames() *collection.TranslationProxy {
 	return v.argsPostNames
 }
 
+func (v *TransactionVariables) HoneypotPath() *collection.Simple {
+	return v.honeypotPath
+}
+
+func (v *TransactionVariables) RequestURIScheme() *collection.Simple {
+	return v.requestURIScheme
+}
+
+func (v *TransactionVariables) RequestURIHost() *collection.Simple {
+	return v.requestURIHost
+}
+
+func (v *TransactionVariables) RequestURIUserinfo() *collection.Simple {
+	return v.requestURIUserinfo
+}
+
+func (v *TransactionVariables) RequestURIFragment() *collection.Simple {
+	return v.requestURIFragment
+}
+
+func (v *TransactionVariables) RequestURIExtraQuery() *collection.Simple {
+	return v.requestURIExtraQuery
+}
+
+func (v *TransactionVariables) ConnConcurrent() *collection.Simple {
+	return v.connConcurrent
+}
+
+func (v *TransactionVariables) ConnRate() *collection.Simple {
+	return v.connRate
+}
+
+func (v *TransactionVariables) ConnLimitExceeded() *collection.Simple {
+	return v.connLimitExceeded
+}
+
+func (v *TransactionVariables) RequestBodyDuration() *collection.Simple {
+	return v.requestBodyDuration
+}
+
+func (v *TransactionVariables) RequestBodyChunks() *collection.Simple {
+	return v.requestBodyChunks
+}
+
+func (v *TransactionVariables) RequestBodyChunkInterval() *collection.Simple {
+	return v.requestBodyChunkInterval
+}
+
+func (v *TransactionVariables) RequestBodyChunkSize() *collection.Simple {
+	return v.requestBodyChunkSize
+}
+
+func (v *TransactionVariables) HoneypotFields() *collection.Map {
+	return v.honeypotFields
+}
+
 func (v *TransactionVariables) reset() {
 	v.userID.Reset()
 	v.urlencodedError.Reset()
+	v.ruleError.Reset()
+	v.ruleErrorMsg.Reset()
+	v.requestCookiesErrorMsg.Reset()
+	v.accessListAction.Reset()
+	v.accessListEntry.Reset()
+	v.openAPIOperation.Reset()
+	v.csrfToken.Reset()
+	v.csrfError.Reset()
+	v.csrfErrorMsg.Reset()
+	v.tlsJA3.Reset()
+	v.tlsJA3Hash.Reset()
+	v.tlsJA4.Reset()
+	v.sslClientVerify.Reset()
+	v.sslClientSDN.Reset()
+	v.sslClientSDNCN.Reset()
+	v.sslClientIDN.Reset()
+	v.sslClientMSerial.Reset()
+	v.sslClientVStart.Reset()
+	v.sslClientVEnd.Reset()
+	v.sslClientVRemain.Reset()
+	v.honeypotPath.Reset()
+	v.requestURIScheme.Reset()
+	v.requestURIHost.Reset()
+	v.requestURIUserinfo.Reset()
+	v.requestURIFragment.Reset()
+	v.requestURIExtraQuery.Reset()
+	v.connConcurrent.Reset()
+	v.connRate.Reset()
+	v.connLimitExceeded.Reset()
+	v.requestBodyDuration.Reset()
+	v.requestBodyChunks.Reset()
+	v.requestBodyChunkInterval.Reset()
+	v.requestBodyChunkSize.Reset()
+	v.honeypotFields.Reset()
+	v.memoryLimitExceeded.Reset()
+	v.streamInputBody.Reset()
+	v.streamOutputBody.Reset()
+	v.responseBodyDecompressionError.Reset()
+	v.requestBodyDecompressionError.Reset()
 	v.responseContentType.Reset()
 	v.uniqueID.Reset()
 	v.argsCombinedSize.Reset()
@@ -1981,8 +3752,23 @@ func (v *TransactionVariables) reset() {
 	v.requestXML.Reset()
 	v.responseXML.Reset()
 	v.multipartPartHeaders.Reset()
+	v.requestPseudoHeaders.Reset()
+	v.requestProtocolAnomalies.Reset()
+	v.requestSOAP.Reset()
+	v.requestXMLAnomalies.Reset()
+	v.openAPIViolations.Reset()
+	v.requestCookiesTampered.Reset()
+	v.requestCookiesUnsigned.Reset()
+	v.sslClientSAN.Reset()
+	v.profileViolation.Reset()
 	v.ip.Reset()
+	v.global.Reset()
+	v.session.Reset()
+	v.user.Reset()
+	v.resource.Reset()
+	v.perfRules.Reset()
 	v.argsNames.Reset()
 	v.argsGetNames.Reset()
 	v.argsPostNames.Reset()
+	v.memory.Reset()
 }
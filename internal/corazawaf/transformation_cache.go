@@ -0,0 +1,72 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+// TransformationCacheConfig controls the per transaction cache of
+// transformation results, configured with SecCacheTransformations.
+// Results are cached by variable and chain of transformations, so
+// rules sharing a prefix like t:urlDecodeUni,t:lowercase reuse the
+// results of each other within a phase.
+type TransformationCacheConfig struct {
+	// Enabled turns the cache on
+	Enabled bool
+	// Incremental caches the result of every step of the chain instead
+	// of only the final result
+	Incremental bool
+	// MinLen is the minimum length of the values to cache
+	MinLen int
+	// MaxLen is the maximum length of the values to cache, 0 means unlimited
+	MaxLen int
+	// MaxItems is the maximum number of cached results per transaction,
+	// 0 means unlimited
+	MaxItems int
+}
+
+// cacheable returns true if a value can be stored in a cache holding n items
+func (c *TransformationCacheConfig) cacheable(value string, n int) bool {
+	return len(value) >= c.MinLen &&
+		(c.MaxLen == 0 || len(value) <= c.MaxLen) &&
+		(c.MaxItems == 0 || n < c.MaxItems)
+}
+
+// executeCachedTransformations runs the transformations of the rule starting
+// from the longest chain prefix already cached for the variable
+func (r *Rule) executeCachedTransformations(value string, key transformationKey, cache map[transformationKey]*transformationValue, cfg *TransformationCacheConfig) ([]string, []error) {
+	if cached, ok := cache[key]; ok {
+		return cached.args, cached.errs
+	}
+
+	var errs []error
+	start := 0
+	for i := len(r.transformations) - 2; i >= 0; i-- {
+		key.transformationsID = r.transformations[i].ID
+		if cached, ok := cache[key]; ok {
+			value = cached.args[0]
+			errs = append(errs, cached.errs...)
+			start = i + 1
+			break
+		}
+	}
+
+	cacheable := cfg.cacheable(value, len(cache))
+	last := len(r.transformations) - 1
+	for i := start; i <= last; i++ {
+		t := r.transformations[i]
+		v, err := t.Function(value)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			value = v
+		}
+		if cacheable && (i == last || cfg.Incremental) {
+			key.transformationsID = t.ID
+			cache[key] = &transformationValue{
+				args: []string{value},
+				// errors are copied as the slice keeps growing
+				errs: append([]error(nil), errs...),
+			}
+		}
+	}
+	return []string{value}, errs
+}
@@ -0,0 +1,93 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package corazawaf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/corazawaf/coraza/v3/types/variables"
+)
+
+func TestTransformationCache(t *testing.T) {
+	calls := map[string]int{}
+	counting := func(name string, fn func(string) string) func(string) (string, error) {
+		return func(s string) (string, error) {
+			calls[name]++
+			return fn(s), nil
+		}
+	}
+	lower := counting("lower", strings.ToLower)
+	trim := counting("trim", strings.TrimSpace)
+	upper := counting("upper", strings.ToUpper)
+
+	tests := []struct {
+		name      string
+		cfg       TransformationCacheConfig
+		wantLower int
+		wantTrim  int
+	}{
+		{"disabled", TransformationCacheConfig{}, 4, 2},
+		{"incremental", TransformationCacheConfig{Enabled: true, Incremental: true}, 1, 1},
+		{"final results only", TransformationCacheConfig{Enabled: true}, 3, 1},
+		{"values too short", TransformationCacheConfig{Enabled: true, Incremental: true, MinLen: 100}, 4, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = map[string]int{}
+			waf := NewWAF()
+			waf.TransformationCache = tt.cfg
+			var got []string
+			addRule := func(id int, transformations ...string) {
+				r := NewRule()
+				r.ID_ = id
+				r.Phase_ = types.PhaseRequestHeaders
+				if err := r.AddVariable(variables.ArgsGet, "", false); err != nil {
+					t.Fatal(err)
+				}
+				for _, name := range transformations {
+					fn := map[string]func(string) (string, error){"lower": lower, "trim": trim, "upper": upper}[name]
+					if err := r.AddTransformation(name, fn); err != nil {
+						t.Fatal(err)
+					}
+				}
+				r.SetOperator(testOperator(func(value string) bool {
+					got = append(got, value)
+					return false
+				}), "@test", "")
+				if err := waf.Rules.Add(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			addRule(1, "lower", "trim")
+			addRule(2, "lower", "trim")
+			addRule(3, "lower", "upper")
+			addRule(4, "lower")
+
+			tx := waf.NewTransaction()
+			tx.AddArgument(types.ArgumentGET, "a", " Value ")
+			tx.ProcessRequestHeaders()
+
+			want := []string{"value", "value", " VALUE ", " value "}
+			if strings.Join(got, "|") != strings.Join(want, "|") {
+				t.Errorf("unexpected transformed values %q", got)
+			}
+			if calls["lower"] != tt.wantLower || calls["trim"] != tt.wantTrim || calls["upper"] != 1 {
+				t.Errorf("unexpected transformation calls %v", calls)
+			}
+		})
+	}
+}
+
+func TestClearTransformationsResetsCacheID(t *testing.T) {
+	r := NewRule()
+	if err := r.AddTransformation("lower", func(s string) (string, error) { return s, nil }); err != nil {
+		t.Fatal(err)
+	}
+	r.ClearTransformations()
+	if r.transformationsID != 0 {
+		t.Errorf("expected transformation chain to be reset, got %d", r.transformationsID)
+	}
+}
@@ -4,6 +4,7 @@
 package corazawaf
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -14,10 +15,21 @@ import (
 	"strings"
 	"time"
 
+	"github.com/corazawaf/coraza/v3/accesslist"
+	"github.com/corazawaf/coraza/v3/bodyprocessors"
+	"github.com/corazawaf/coraza/v3/internal/corazarules"
+	"github.com/corazawaf/coraza/v3/internal/environment"
 	ioutils "github.com/corazawaf/coraza/v3/internal/io"
+	"github.com/corazawaf/coraza/v3/internal/memoize"
 	stringutils "github.com/corazawaf/coraza/v3/internal/strings"
 	"github.com/corazawaf/coraza/v3/internal/sync"
 	"github.com/corazawaf/coraza/v3/loggers"
+	"github.com/corazawaf/coraza/v3/openapi"
+	"github.com/corazawaf/coraza/v3/profiler"
+	"github.com/corazawaf/coraza/v3/ratelimit"
+	"github.com/corazawaf/coraza/v3/regex"
+	"github.com/corazawaf/coraza/v3/rules"
+	"github.com/corazawaf/coraza/v3/transformations"
 	"github.com/corazawaf/coraza/v3/types"
 )
 
@@ -54,6 +66,11 @@ type WAF struct {
 	// Request body in memory limit
 	RequestBodyInMemoryLimit int64
 
+	// requestBodyInMemoryLimitSet is true if the in-memory limit was set
+	// with SetRequestBodyInMemoryLimit, otherwise Validate lowers the
+	// default to a smaller request body limit
+	requestBodyInMemoryLimitSet bool
+
 	// If true, transactions will have access to the response body
 	ResponseBodyAccess bool
 
@@ -87,6 +104,10 @@ type WAF struct {
 	// Instructs the waf to change the Server response header
 	ServerSignature string
 
+	// ServerSignatureMode selects whether the Server header is rewritten,
+	// injected or removed
+	ServerSignatureMode types.ServerSignatureMode
+
 	// This directory will be used to store page files
 	TmpDir string
 
@@ -110,8 +131,45 @@ type WAF struct {
 
 	RequestBodyLimitAction types.RequestBodyLimitAction
 
+	// ArgumentSeparator contains the characters separating the urlencoded
+	// arguments of the query string and the request body, & by default
 	ArgumentSeparator string
 
+	// StreamInBodyInspection copies the raw request body to
+	// STREAM_INPUT_BODY, the changes made by the rules are written back
+	// to the request body
+	StreamInBodyInspection bool
+
+	// StreamOutBodyInspection copies the raw response body to
+	// STREAM_OUTPUT_BODY, the changes made by the rules are written back
+	// to the response body
+	StreamOutBodyInspection bool
+
+	// TransactionMemoryLimit is the approximate memory in bytes the request
+	// and response data collections of a transaction can use, the values
+	// exceeding it are discarded and MEMORY_LIMIT_EXCEEDED is set. Zero
+	// disables the limit
+	TransactionMemoryLimit int64
+
+	// ArgumentLimits bounds the number and size of the arguments parsed
+	// from the query string and from the request body, zero values
+	// disable each limit
+	ArgumentLimits bodyprocessors.ArgumentLimits
+
+	// RequestBodyLinesLimit is the maximum number of documents of the line
+	// delimited request bodies like NDJSON, zero disables it
+	RequestBodyLinesLimit int
+
+	// RequestBodyXMLDepthLimit and RequestBodyXMLElementsLimit flag the
+	// XML request bodies exceeding them in REQUEST_XML_ANOMALIES, zero
+	// disables them
+	RequestBodyXMLDepthLimit    int
+	RequestBodyXMLElementsLimit int
+	// ArgumentsLimitAction interrupts the transaction if it is Reject and
+	// the arguments exceed ArgumentLimits, with ProcessPartial the
+	// arguments parsed before reaching the limits are kept
+	ArgumentsLimitAction types.RequestBodyLimitAction
+
 	// ProducerConnector is used by connectors to identify the producer
 	// on audit logs, for example, apache-modcoraza
 	ProducerConnector string
@@ -125,30 +183,386 @@ type WAF struct {
 
 	ErrorLogCb func(rule types.MatchedRule)
 
+	// ErrorEventCb receives the structured version of the error logs
+	// of the severities in errorEventSeverities
+	ErrorEventCb         func(event types.ErrorEvent)
+	errorEventSeverities uint8
+
+	// idGenerator returns the IDs of the transactions created without one
+	idGenerator func() string
+
+	// bodyProcessors maps the request media types to the body processors
+	// overriding the ones chosen from the Content-Type
+	bodyProcessors map[string]string
+
+	// methodBodyProcessors maps the request methods to the body processors
+	// used when neither the Content-Type nor a rule chose one
+	methodBodyProcessors map[string]string
+
+	// RequestBodyProcessorSniffing chooses the JSON or XML body processor
+	// from the first bytes of the request bodies whose Content-Type has no
+	// body processor
+	RequestBodyProcessorSniffing bool
+
 	// AuditLogWriter is used to write audit logs
 	AuditLogWriter loggers.LogWriter
+
+	// If true, links from responses will be signed and
+	// @validateHash will enforce the signatures
+	HashEngine bool
+
+	// HashKey is the key used to sign links
+	HashKey []byte
+
+	// HashKeyMode defines which transaction data is bound to HashKey
+	HashKeyMode HashKeyMode
+
+	// HashParam is the name of the parameter storing link signatures
+	HashParam string
+
+	// HashMethods contains the elements that will be signed
+	HashMethods []HashMethod
+
+	// SignedCookies contains the names of the cookies signed in the
+	// responses and verified in the requests
+	SignedCookies []string
+
+	// CookieSignKey is the key used to sign cookies
+	CookieSignKey []byte
+
+	// CookieSignKeyMode defines which transaction data is bound to
+	// CookieSignKey, only HashKeyOnly and HashKeyRemoteIP are supported
+	CookieSignKeyMode HashKeyMode
+
+	// CookieSignMaxAge is the time a cookie signature is valid since it
+	// was issued, 0 doesn't expire the signatures
+	CookieSignMaxAge time.Duration
+
+	// If true, the state changing requests of a session must carry its
+	// CSRF token, which is injected in the html responses if
+	// ContentInjection is enabled
+	CSRFProtection bool
+
+	// CSRFKey is the key used to derive the CSRF tokens from SESSIONID
+	CSRFKey []byte
+
+	// CSRFParam is the name of the form field storing CSRF tokens
+	CSRFParam string
+
+	// CSRFExempt contains the path prefixes not requiring a CSRF token
+	CSRFExempt []string
+
+	// HoneypotFields are the names of the decoy fields injected in the
+	// html forms if ContentInjection is enabled, a value submitted for
+	// them is set in HONEYPOT_FIELDS
+	HoneypotFields []string
+
+	// HoneypotPaths are the trap paths linked from hidden elements of the
+	// html responses if ContentInjection is enabled, a request for them
+	// sets HONEYPOT_PATH
+	HoneypotPaths []string
+
+	// PauseLimit is the maximum time a transaction can be delayed by
+	// the pause action, zero means no limit
+	PauseLimit time.Duration
+
+	// BlockSeverity is the least severe severity of the non disruptive
+	// rules denying the requests they match
+	BlockSeverity types.RuleSeverity
+
+	// BlockSeverityStatus is the status of the interruptions caused by
+	// BlockSeverity, zero disables the severity based blocking
+	BlockSeverityStatus int
+
+	// ruleStats counts the rule matches of the transactions
+	ruleStats *ruleStats
+
+	// TransactionPoolDisabled prevents closed transactions from being
+	// reused, for example if most transactions are long-lived
+	TransactionPoolDisabled bool
+
+	// TransactionPoolMaxBufferSize is the capacity above which the buffers
+	// of a closed transaction are released instead of being reused with
+	// it, zero means no limit
+	TransactionPoolMaxBufferSize int
+
+	// TransactionArena allocates the match data, the matched rules and the
+	// collection entries of the transactions by slabs reused with the
+	// pooled transactions. The matched rules and their match data,
+	// including the ones passed to the error callbacks, must not be used
+	// once the transaction is closed.
+	TransactionArena bool
+
+	// ParallelRuleWorkers is the number of goroutines testing the
+	// independent rules of a phase concurrently, see RuleGroup.Plan. Zero
+	// evaluates every rule sequentially.
+	ParallelRuleWorkers int
+
+	// CookieFormat is the version of the request cookies, 0 for Netscape
+	// cookies and 1 for RFC 2965 cookies
+	CookieFormat int
+
+	// CookieV0Separators contains the characters separating version 0
+	// cookies, ; is used if empty
+	CookieV0Separators string
+
+	// RequestBodyCharsetDecoding transcodes request bodies to UTF-8 using
+	// the charset parameter of the Content-Type header
+	RequestBodyCharsetDecoding bool
+
+	// RequestBodyDecompression decompresses the request bodies declared
+	// with a Content-Encoding registered in the contentencoding package
+	// before the body processors parse them
+	RequestBodyDecompression bool
+
+	// RequestBodyDecompressionRatio bounds the size of the decompressed
+	// request body to this multiple of the compressed size like
+	// ResponseBodyDecompressionRatio, the decompressed body is always
+	// bounded by RequestBodyLimit. Bodies exceeding the limits are
+	// rejected with the Reject RequestBodyLimitAction
+	RequestBodyDecompressionRatio int
+
+	// ResponseBodyDecompression decompresses the response bodies declared
+	// with a Content-Encoding registered in the contentencoding package
+	// before the response body phase
+	ResponseBodyDecompression bool
+
+	// ResponseBodyDecompressionRatio bounds the size of the decompressed
+	// response body to this multiple of the compressed size, bodies
+	// exceeding it are cut and RESPONSE_BODY_DECOMPRESSION_ERROR is set.
+	// Zero disables it, the decompressed body is always bounded by
+	// ResponseBodyLimit
+	ResponseBodyDecompressionRatio int
+
+	// RulePerfTime enables timing each rule, rules whose cumulative
+	// evaluation time reaches it are reported in PERF_RULES, zero disables it
+	RulePerfTime time.Duration
+
+	// debugLogLevel is the level set with SetDebugLogLevel, rule
+	// evaluation traces are only written for LogLevelTrace
+	debugLogLevel loggers.LogLevel
+
+	// RuleEngineSampleRate is the percentage of transactions, between 0 and
+	// 100, enforced when the rule engine is On, the rest of them run in
+	// DetectionOnly mode
+	RuleEngineSampleRate float64
+
+	// RuleEngineSampleKey defines how transactions are sampled
+	RuleEngineSampleKey SamplingKey
+
+	// RegexEngine compiles the regular expressions of the @rx operator,
+	// it must be set before the rules are parsed
+	RegexEngine regex.Engine
+
+	// Memoizer references the artifacts compiled by the operators of the
+	// WAF, which are shared with other WAFs, it is released on Close
+	Memoizer *memoize.Scope
+
+	// UnicodeMap is the code points mapping of t:urlDecodeUni, the rules
+	// reference it so it may be set after they are parsed
+	UnicodeMap *transformations.UnicodeMap
+
+	// TransformationCache configures the per transaction cache of
+	// transformation results
+	TransformationCache TransformationCacheConfig
+
+	// RateLimitStore keeps the counters of the @rateLimit operator
+	RateLimitStore ratelimit.Store
+
+	// ConnectionEngine tracks the transactions of the client addresses
+	// started with ProcessConnection, the CONN_* variables are only set
+	// if it is not Off
+	ConnectionEngine types.ConnectionEngineStatus
+
+	// ConnectionLimit is the number of transactions of a client address
+	// processed at once, 0 is unlimited
+	ConnectionLimit int
+
+	// ConnectionRateLimit is the number of transactions a client address
+	// can start within ConnectionRateWindow, 0 is unlimited. The rates are
+	// counted in RateLimitStore.
+	ConnectionRateLimit  int
+	ConnectionRateWindow time.Duration
+
+	// connections is shared by the clones of the WAF, it is nil for the
+	// candidate WAF as the active WAF already counts its transactions
+	connections *connectionTracker
+
+	// AccessList is evaluated before the phase 1 rules, it is optional
+	AccessList *accesslist.List
+
+	// OpenAPI is enforced before the phase 1 and phase 2 rules, it is
+	// optional
+	OpenAPI *openapi.Spec
+
+	// OpenAPIAction is applied to the requests violating OpenAPI
+	OpenAPIAction openapi.Action
+
+	// Profile learns or enforces the arguments of every endpoint depending
+	// on ProfileMode, it is optional
+	Profile *profiler.Profile
+
+	// ProfileMode selects whether Profile is learned or enforced
+	ProfileMode profiler.Mode
+
+	// ProfileFile is the path the learned Profile is written to when the
+	// WAF is closed
+	ProfileFile string
+
+	// candidate is evaluated in shadow mode for every transaction
+	candidate *WAF
+
+	// candidateDiffCb receives the divergences between the rules of
+	// this WAF and the candidate rules
+	candidateDiffCb func(types.RuleSetDiff)
 }
 
 // NewTransaction Creates a new initialized transaction for this WAF instance
 func (w *WAF) NewTransaction() *Transaction {
-	return w.newTransactionWithID(stringutils.RandomString(19))
+	return w.newTransactionWithID(w.newID())
 }
 
+// NewTransactionWithID creates a transaction with an ID provided by the
+// caller, like the upstream request or trace ID, so the logs of both
+// systems can be correlated. A generated ID is used if id is empty.
 func (w *WAF) NewTransactionWithID(id string) *Transaction {
 	if len(strings.TrimSpace(id)) == 0 {
-		id = stringutils.RandomString(19)
+		id = w.newID()
 		w.Logger.Warn("Empty ID passed for new transaction")
 	}
 	return w.newTransactionWithID(id)
 }
 
+// SetIDGenerator sets the function generating the IDs of the
+// transactions created without one, it must be safe for concurrent use.
+// A nil generator restores the random IDs.
+func (w *WAF) SetIDGenerator(gen func() string) {
+	w.idGenerator = gen
+}
+
+// SetBodyProcessor routes the request bodies of a media type, like
+// application/vnd.api+json, to a processor registered in the
+// bodyprocessors package. The media type is matched without its
+// parameters and case insensitively.
+func (w *WAF) SetBodyProcessor(mediaType string, processor string) error {
+	if _, err := bodyprocessors.Get(processor); err != nil {
+		return err
+	}
+	if w.bodyProcessors == nil {
+		w.bodyProcessors = map[string]string{}
+	}
+	w.bodyProcessors[strings.ToLower(strings.TrimSpace(mediaType))] = strings.ToUpper(processor)
+	return nil
+}
+
+// SetMethodBodyProcessor sets the processor of the request bodies of a
+// method, like PROPFIND, whose Content-Type has no body processor. NONE
+// removes the processor of the method.
+func (w *WAF) SetMethodBodyProcessor(method string, processor string) error {
+	method = strings.ToUpper(strings.TrimSpace(method))
+	if method == "" {
+		return errors.New("empty request method")
+	}
+	if strings.EqualFold(processor, "none") {
+		delete(w.methodBodyProcessors, method)
+		return nil
+	}
+	if _, err := bodyprocessors.Get(processor); err != nil {
+		return err
+	}
+	if w.methodBodyProcessors == nil {
+		w.methodBodyProcessors = map[string]string{}
+	}
+	w.methodBodyProcessors[method] = strings.ToUpper(processor)
+	return nil
+}
+
+// methodBodyProcessor returns the processor set for the request method
+func (w *WAF) methodBodyProcessor(method string) (string, bool) {
+	p, ok := w.methodBodyProcessors[method]
+	return p, ok
+}
+
+// defaultMethodBodyProcessors returns the processors of the WebDAV and
+// CalDAV methods, their bodies are XML documents
+func defaultMethodBodyProcessors() map[string]string {
+	return map[string]string{
+		"ACL":        "XML",
+		"LOCK":       "XML",
+		"MKCALENDAR": "XML",
+		"PROPFIND":   "XML",
+		"PROPPATCH":  "XML",
+		"REPORT":     "XML",
+		"SEARCH":     "XML",
+	}
+}
+
+// bodyProcessor returns the processor set for the media type of a
+// Content-Type header
+func (w *WAF) bodyProcessor(contentType string) (string, bool) {
+	if len(w.bodyProcessors) == 0 {
+		return "", false
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	p, ok := w.bodyProcessors[strings.ToLower(strings.TrimSpace(mediaType))]
+	return p, ok
+}
+
+// newID returns a transaction ID from the generator, or a random one if
+// there is no generator or it returns an empty ID
+func (w *WAF) newID() string {
+	if w.idGenerator != nil {
+		if id := w.idGenerator(); len(strings.TrimSpace(id)) > 0 {
+			return id
+		}
+	}
+	return stringutils.RandomString(19)
+}
+
+// releaseTransaction returns a closed transaction to the pool, the buffers
+// larger than TransactionPoolMaxBufferSize are released first so a single
+// large request doesn't pin their memory in the pool
+func (w *WAF) releaseTransaction(tx *Transaction) {
+	if w.TransactionPoolDisabled {
+		return
+	}
+	if size := w.TransactionPoolMaxBufferSize; size > 0 {
+		if tx.requestBodyBuffer != nil {
+			tx.requestBodyBuffer.shrink(size)
+			tx.ResponseBodyBuffer.shrink(size)
+		}
+		if cap(tx.requestHeadersRaw) > size {
+			tx.requestHeadersRaw = nil
+		}
+	}
+	w.txPool.Put(tx)
+}
+
 // NewTransactionWithID Creates a new initialized transaction for this WAF instance
 // Using the specified ID
 func (w *WAF) newTransactionWithID(id string) *Transaction {
 	tx := w.txPool.Get().(*Transaction)
 	tx.id = id
-	tx.matchedRules = []types.MatchedRule{}
+	if tx.arena != nil {
+		// the matched rules of the previous transaction are in the arena,
+		// the slice can be reused
+		for i := range tx.matchedRules {
+			tx.matchedRules[i] = nil
+		}
+		tx.matchedRules = tx.matchedRules[:0]
+	} else {
+		tx.matchedRules = []types.MatchedRule{}
+	}
 	tx.interruption = nil
+	tx.responseHeaderMutations = nil
+	tx.pause = 0
+	tx.tracing = false
+	tx.trace = nil
+	tx.ruleTrace = nil
+	tx.shadow = nil
+	if w.candidate != nil {
+		tx.shadow = w.candidate.newTransactionWithID(id)
+	}
 	tx.Logdata = ""
 	tx.SkipAfter = ""
 	tx.AuditEngine = w.AuditEngine
@@ -159,32 +573,66 @@ func (w *WAF) newTransactionWithID(id string) *Transaction {
 	tx.ResponseBodyAccess = w.ResponseBodyAccess
 	tx.ResponseBodyLimit = w.ResponseBodyLimit
 	tx.RuleEngine = w.RuleEngine
-	tx.HashEngine = false
-	tx.HashEnforcement = false
+	tx.ruleEngineOverridden = false
+	tx.accessListAllowed = false
+	tx.connectionAddr = ""
+	tx.bodyTiming = bodyTiming{}
+	tx.openAPIOperation = nil
+	tx.HashEngine = w.HashEngine
+	tx.HashEnforcement = w.HashEngine
 	tx.LastPhase = 0
+	tx.requestBodyTruncated = false
+	tx.requestBodyCutAtSeparator = false
+	tx.requestBodyOverflow = nil
+	tx.responseBodyTruncated = false
+	tx.streamInputBody = ""
 	tx.bodyProcessor = nil
 	tx.ruleRemoveByID = nil
 	tx.ruleRemoveTargetByID = map[int][]ruleVariableParams{}
+	tx.operatorState = nil
 	tx.Skip = 0
 	tx.Capture = false
+	tx.captures = tx.captures[:0]
 	tx.stopWatches = map[types.RulePhase]int64{}
+	tx.ruleDurations = nil
+	tx.requestHeadersRaw = tx.requestHeadersRaw[:0]
+	tx.uriNormalization = uriNormalization{}
+	tx.fullRequest = fullRequest{}
 	tx.WAF = w
+	if w.RuleEngineSampleKey == SamplingRandom {
+		tx.applyRuleEngineSampling("")
+	}
+	tx.debugLogger = loggers.With(w.Logger, loggers.String(loggers.FieldTransactionID, id))
 	tx.Timestamp = time.Now().UnixNano()
 	tx.audit = false
 
 	// Always non-nil if buffers / collections were already initialized so we don't do any of them
 	// based on the presence of RequestBodyBuffer.
 	if tx.requestBodyBuffer == nil {
+		requestMemoryLimit, responseMemoryLimit := w.RequestBodyInMemoryLimit, w.RequestBodyInMemoryLimit
+		if !environment.HasAccessToFS {
+			// bodies can't be spooled to disk, they are kept in memory
+			// up to the body limits
+			requestMemoryLimit, responseMemoryLimit = w.RequestBodyLimit, w.ResponseBodyLimit
+		}
 		tx.requestBodyBuffer = NewBodyBuffer(types.BodyBufferOptions{
 			TmpPath:     w.TmpDir,
-			MemoryLimit: w.RequestBodyInMemoryLimit,
+			MemoryLimit: requestMemoryLimit,
 		})
 		tx.ResponseBodyBuffer = NewBodyBuffer(types.BodyBufferOptions{
 			TmpPath:     w.TmpDir,
-			MemoryLimit: w.RequestBodyInMemoryLimit,
+			MemoryLimit: responseMemoryLimit,
 		})
 		tx.variables = *NewTransactionVariables()
 		tx.transformationCache = map[transformationKey]*transformationValue{}
+		tx.literalScans = map[literalKey]*literalScan{}
+	}
+	if w.TransactionArena != (tx.arena != nil) {
+		if w.TransactionArena {
+			tx.setArena(&corazarules.Arena{})
+		} else {
+			tx.setArena(nil)
+		}
 	}
 
 	// set capture variables
@@ -196,7 +644,8 @@ func (w *WAF) newTransactionWithID(id string) *Transaction {
 	// Some defaults
 	tx.variables.filesCombinedSize.Set("0")
 	tx.variables.urlencodedError.Set("0")
-	tx.variables.fullRequestLength.Set("0")
+	tx.variables.ruleError.Set("0")
+	tx.variables.requestCookiesError.Set("0")
 	tx.variables.multipartBoundaryQuoted.Set("0")
 	tx.variables.multipartBoundaryWhitespace.Set("0")
 	tx.variables.multipartCrlfLfLines.Set("0")
@@ -212,14 +661,21 @@ func (w *WAF) newTransactionWithID(id string) *Transaction {
 	tx.variables.multipartStrictError.Set("0")
 	tx.variables.multipartUnmatchedBoundary.Set("0")
 	tx.variables.outboundDataError.Set("0")
+	tx.variables.responseBodyDecompressionError.Set("0")
+	tx.variables.requestBodyDecompressionError.Set("0")
 	tx.variables.reqbodyError.Set("0")
 	tx.variables.reqbodyProcessorError.Set("0")
 	tx.variables.requestBodyLength.Set("0")
 	tx.variables.duration.Set("0")
-	tx.variables.highestSeverity.Set("0")
+	tx.variables.highestSeverity.Set("255")
 	tx.variables.uniqueID.Set(tx.id)
+	tx.variables.memoryLimitExceeded.Set("0")
+	tx.variables.memory.SetLimit(w.TransactionMemoryLimit, func(name string) {
+		tx.variables.memoryLimitExceeded.Set("1")
+		tx.debugLogger.Warn("Transaction memory limit of %d bytes exceeded, discarding %s values", w.TransactionMemoryLimit, name)
+	})
 
-	w.Logger.Debug("New transaction created with id %q", tx.id)
+	tx.debugLogger.Debug("New transaction created")
 
 	return tx
 }
@@ -253,6 +709,71 @@ func (w *WAF) SetDebugLogPath(path string) error {
 	return nil
 }
 
+// ReloadDataFiles reloads the data files of the operators of the rules
+// and of the candidate rules, see RuleGroup.ReloadDataFiles
+func (w *WAF) ReloadDataFiles() error {
+	err := w.Rules.ReloadDataFiles()
+	if w.candidate != nil {
+		if cerr := w.candidate.Rules.ReloadDataFiles(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// SaveProfile writes the learned Profile to ProfileFile, nothing is
+// written if the profile is enforced or no file is configured. It fails
+// if the engine has no filesystem access.
+func (w *WAF) SaveProfile() error {
+	if w.Profile == nil || w.ProfileMode != profiler.Learn || w.ProfileFile == "" {
+		return nil
+	}
+	if !environment.HasAccessToFS {
+		return errors.New("the profile can't be saved without filesystem access")
+	}
+	data, err := w.Profile.Export()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(w.ProfileFile, data, 0600)
+}
+
+// SetRequestBodyInMemoryLimit sets the in-memory limit of the request
+// bodies, Validate rejects it if it exceeds the request body limit
+func (w *WAF) SetRequestBodyInMemoryLimit(limit int64) {
+	w.RequestBodyInMemoryLimit = limit
+	w.requestBodyInMemoryLimitSet = true
+}
+
+// Validate returns an error if the configuration of the WAF is
+// inconsistent, like an in-memory limit set above the request body limit.
+// The default in-memory limit is lowered to a smaller request body limit.
+// It is called once the directives and options were applied.
+func (w *WAF) Validate() error {
+	if !w.requestBodyInMemoryLimitSet && w.RequestBodyLimit > 0 && w.RequestBodyInMemoryLimit > w.RequestBodyLimit {
+		w.RequestBodyInMemoryLimit = w.RequestBodyLimit
+	}
+	switch {
+	case w.RequestBodyLimit <= 0:
+		return fmt.Errorf("request body limit should be bigger than 0, got %d", w.RequestBodyLimit)
+	case w.RequestBodyInMemoryLimit < 0:
+		return fmt.Errorf("request body in-memory limit should not be negative, got %d", w.RequestBodyInMemoryLimit)
+	case w.RequestBodyInMemoryLimit > w.RequestBodyLimit:
+		return fmt.Errorf("request body in-memory limit %d exceeds the request body limit %d", w.RequestBodyInMemoryLimit, w.RequestBodyLimit)
+	case w.ResponseBodyLimit <= 0:
+		return fmt.Errorf("response body limit should be bigger than 0, got %d", w.ResponseBodyLimit)
+	case w.RuleEngineSampleRate < 0 || w.RuleEngineSampleRate > 100:
+		return fmt.Errorf("rule engine sample rate should be between 0 and 100, got %g", w.RuleEngineSampleRate)
+	case w.TransactionPoolMaxBufferSize < 0:
+		return fmt.Errorf("transaction pool buffer size should not be negative, got %d", w.TransactionPoolMaxBufferSize)
+	case w.ParallelRuleWorkers < 0:
+		return fmt.Errorf("parallel rule workers should not be negative, got %d", w.ParallelRuleWorkers)
+	case w.ConnectionRateLimit > 0 && w.ConnectionRateWindow <= 0:
+		return errors.New("connection rate limit requires a positive window")
+	}
+	return nil
+}
+
 // NewWAF creates a new WAF instance with default variables
 func NewWAF() *WAF {
 	logger := &stdDebugLogger{
@@ -265,22 +786,43 @@ func NewWAF() *WAF {
 	}
 	waf := &WAF{
 		// Initializing pool for transactions
-		txPool:                   sync.NewPool(func() interface{} { return new(Transaction) }),
-		ArgumentSeparator:        "&",
-		AuditLogWriter:           logWriter,
-		AuditEngine:              types.AuditEngineOff,
-		AuditLogParts:            types.AuditLogParts("ABCFHZ"),
-		RequestBodyInMemoryLimit: 131072,
-		RequestBodyLimit:         134217728, // 10mb
-		ResponseBodyMimeTypes:    []string{"text/html", "text/plain"},
-		ResponseBodyLimit:        524288,
-		ResponseBodyAccess:       false,
-		RuleEngine:               types.RuleEngineOn,
-		Rules:                    NewRuleGroup(),
-		TmpDir:                   "/tmp",
-		AuditLogRelevantStatus:   regexp.MustCompile(`.*`),
-		RequestBodyAccess:        false,
-		Logger:                   logger,
+		txPool:                         sync.NewPool(func() interface{} { return new(Transaction) }),
+		ArgumentSeparator:              "&",
+		AuditLogWriter:                 logWriter,
+		AuditEngine:                    types.AuditEngineOff,
+		AuditLogParts:                  types.AuditLogParts("ABCFHZ"),
+		RequestBodyInMemoryLimit:       131072,
+		RequestBodyLimit:               134217728, // 10mb
+		ResponseBodyMimeTypes:          []string{"text/html", "text/plain"},
+		ResponseBodyLimit:              524288,
+		ResponseBodyAccess:             false,
+		RuleEngine:                     types.RuleEngineOn,
+		Rules:                          NewRuleGroup(),
+		TmpDir:                         "/tmp",
+		AuditLogRelevantStatus:         regexp.MustCompile(`.*`),
+		RequestBodyAccess:              false,
+		Logger:                         logger,
+		PauseLimit:                     10 * time.Second,
+		ruleStats:                      newRuleStats(),
+		methodBodyProcessors:           defaultMethodBodyProcessors(),
+		RuleEngineSampleRate:           100,
+		RateLimitStore:                 ratelimit.NewMemoryStore(),
+		ConnectionEngine:               types.ConnectionEngineOff,
+		ConnectionRateWindow:           time.Minute,
+		connections:                    newConnectionTracker(),
+		RegexEngine:                    regex.Default,
+		Memoizer:                       memoize.NewScope(),
+		UnicodeMap:                     &transformations.UnicodeMap{},
+		RequestBodyCharsetDecoding:     true,
+		RequestBodyLinesLimit:          10000,
+		RequestBodyDecompression:       true,
+		RequestBodyDecompressionRatio:  100,
+		ResponseBodyDecompression:      true,
+		ResponseBodyDecompressionRatio: 100,
+		TransformationCache: TransformationCacheConfig{
+			Enabled:     true,
+			Incremental: true,
+		},
 	}
 	// We initialize a basic audit log writer that discards output
 	if err := logWriter.Init(types.Config{}); err != nil {
@@ -293,10 +835,16 @@ func NewWAF() *WAF {
 	return waf
 }
 
-// SetDebugLogLevel changes the debug level of the WAF instance
+// SetDebugLogLevel changes the debug level of the WAF instance,
+// lvl is a ModSecurity debug log level between 0 and 9
 func (w *WAF) SetDebugLogLevel(lvl int) error {
+	level, err := loggers.ModSecurityLogLevel(lvl)
+	if err != nil {
+		return err
+	}
+	w.debugLogLevel = level
 	// setLevel is concurrent safe
-	w.Logger.SetLevel(loggers.LogLevel(lvl))
+	w.Logger.SetLevel(level)
 	return nil
 }
 
@@ -306,3 +854,41 @@ func (w *WAF) SetDebugLogLevel(lvl int) error {
 func (w *WAF) SetErrorCallback(cb func(rule types.MatchedRule)) {
 	w.ErrorLogCb = cb
 }
+
+// SetErrorEventCallback sets the callback receiving the structured
+// error events, if severities are passed only the rules with one of
+// those severities are delivered, otherwise every logged rule is.
+func (w *WAF) SetErrorEventCallback(cb func(event types.ErrorEvent), severities ...types.RuleSeverity) {
+	w.ErrorEventCb = cb
+	w.errorEventSeverities = 0
+	for _, s := range severities {
+		w.errorEventSeverities |= 1 << uint(s)
+	}
+}
+
+// blocksSeverity reports whether the matches of a rule deny the request
+// because of BlockSeverity, the rules with a disruptive action, allow
+// included, are not escalated
+func (w *WAF) blocksSeverity(r *Rule) bool {
+	if w.BlockSeverityStatus == 0 || !r.HasSeverity_ || r.Severity_ > w.BlockSeverity {
+		return false
+	}
+	for _, a := range r.actions {
+		if a.Function.Type() == rules.ActionTypeDisruptive && a.Name != "pass" {
+			return false
+		}
+	}
+	return true
+}
+
+// acceptsErrorEvent reports whether the error event callback must be
+// called for a rule
+func (w *WAF) acceptsErrorEvent(r *Rule) bool {
+	if w.ErrorEventCb == nil {
+		return false
+	}
+	if w.errorEventSeverities == 0 {
+		return true
+	}
+	return r.HasSeverity_ && w.errorEventSeverities&(1<<uint(r.Severity_)) != 0
+}
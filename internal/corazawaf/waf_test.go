@@ -6,7 +6,13 @@ package corazawaf
 import (
 	"io"
 	"os"
+	"strconv"
 	"testing"
+
+	"github.com/corazawaf/coraza/v3/internal/corazarules"
+	"github.com/corazawaf/coraza/v3/loggers"
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/corazawaf/coraza/v3/types/variables"
 )
 
 func TestNewTransaction(t *testing.T) {
@@ -38,6 +44,25 @@ func TestNewTransaction(t *testing.T) {
 	}
 }
 
+func TestIDGenerator(t *testing.T) {
+	waf := NewWAF()
+	ids := []string{"trace-1", ""}
+	waf.SetIDGenerator(func() string {
+		id := ids[0]
+		ids = ids[1:]
+		return id
+	})
+	if tx := waf.NewTransaction(); tx.id != "trace-1" || tx.variables.uniqueID.String() != "trace-1" {
+		t.Errorf("expected the generated ID, got %q", tx.id)
+	}
+	if tx := waf.NewTransaction(); tx.id == "" {
+		t.Error("expected a random ID if the generator returns an empty one")
+	}
+	if tx := waf.NewTransactionWithID("upstream"); tx.id != "upstream" {
+		t.Errorf("expected the explicit ID, got %q", tx.id)
+	}
+}
+
 func TestSetDebugLogPath(t *testing.T) {
 	waf := NewWAF()
 
@@ -70,3 +95,157 @@ func TestSetDebugLogPath(t *testing.T) {
 		})
 	}
 }
+
+func TestTransactionDebugLoggerFields(t *testing.T) {
+	waf := NewWAF()
+	l := &inspectableLogger{}
+	waf.Logger.SetOutput(l)
+	waf.Logger.SetLevel(loggers.LogLevelDebug)
+	tx := waf.NewTransactionWithID("abc")
+	tx.DebugLogger().Debug("hello %s", "world")
+	rl := loggers.With(tx.DebugLogger(), loggers.Int(loggers.FieldRuleID, 1))
+	rl.Error("rule")
+	want := []string{
+		"[DEBUG] New transaction created tx_id=abc\n",
+		"[DEBUG] hello world tx_id=abc\n",
+		"[ERROR] rule tx_id=abc rule_id=1\n",
+	}
+	if len(l.entries) != len(want) {
+		t.Fatalf("unexpected entries %q", l.entries)
+	}
+	for i, w := range want {
+		if l.entries[i] != w {
+			t.Errorf("unexpected entry, want %q, have %q", w, l.entries[i])
+		}
+	}
+}
+
+type countingPool struct {
+	puts int
+}
+
+func (p *countingPool) Get() interface{} {
+	return new(Transaction)
+}
+
+func (p *countingPool) Put(x interface{}) {
+	p.puts++
+}
+
+func TestTransactionPool(t *testing.T) {
+	waf := NewWAF()
+	pool := &countingPool{}
+	waf.txPool = pool
+	waf.TransactionPoolMaxBufferSize = 1024
+
+	tx := waf.NewTransaction()
+	tx.RequestBodyAccess = true
+	if _, _, err := tx.WriteRequestBody(make([]byte, 4096)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if pool.puts != 1 {
+		t.Fatal("expected the transaction to be pooled")
+	}
+	if c := tx.requestBodyBuffer.buffer.Cap(); c > 1024 {
+		t.Errorf("expected the oversized buffer to be released, got a capacity of %d", c)
+	}
+
+	waf.TransactionPoolDisabled = true
+	if err := waf.NewTransaction().Close(); err != nil {
+		t.Fatal(err)
+	}
+	if pool.puts != 1 {
+		t.Error("expected the transaction not to be pooled")
+	}
+}
+
+// reusingPool returns the last transaction put
+type reusingPool struct {
+	tx *Transaction
+}
+
+func (p *reusingPool) Get() interface{} {
+	if tx := p.tx; tx != nil {
+		p.tx = nil
+		return tx
+	}
+	return new(Transaction)
+}
+
+func (p *reusingPool) Put(x interface{}) {
+	p.tx = x.(*Transaction)
+}
+
+func TestTransactionArena(t *testing.T) {
+	waf := NewWAF()
+	waf.txPool = &reusingPool{}
+	waf.TransactionArena = true
+	rule := NewRule()
+	rule.ID_ = 1
+
+	var (
+		prev    *corazarules.MatchedRule
+		prevArg *types.MatchData
+	)
+	for i := 0; i < 3; i++ {
+		tx := waf.NewTransaction()
+		if tx.arena == nil {
+			t.Fatal("expected the transaction to have an arena")
+		}
+		value := "v" + strconv.Itoa(i)
+		// more arguments than the elements of a slab
+		for a := 0; a < 300; a++ {
+			tx.AddArgument(types.ArgumentGET, "a"+strconv.Itoa(a), value)
+		}
+		mds := tx.GetField(ruleVariableParams{Variable: variables.ArgsGet})
+		if len(mds) != 300 {
+			t.Fatalf("expected 300 matches, got %d", len(mds))
+		}
+		for _, md := range mds {
+			if md.Value() != value || md.Variable() != variables.ArgsGet {
+				t.Fatalf("unexpected match data %+v", md)
+			}
+		}
+		// the match data slices are reused too
+		arg := tx.GetField(ruleVariableParams{Variable: variables.ArgsGet, KeyStr: "a0"})
+		if len(arg) != 1 || arg[0].Value() != value {
+			t.Fatalf("unexpected match data %v", arg)
+		}
+		if prevArg != nil && &arg[0] != prevArg {
+			t.Error("expected the match data slice to be reused")
+		}
+		prevArg = &arg[0]
+		tx.MatchRule(rule, mds)
+		if len(tx.MatchedRules()) != 1 {
+			t.Fatalf("expected 1 matched rule, got %d", len(tx.MatchedRules()))
+		}
+		mr := tx.MatchedRules()[0].(*corazarules.MatchedRule)
+		if prev != nil && mr != prev {
+			t.Error("expected the matched rule to be reused")
+		}
+		prev = mr
+		if err := tx.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if mr.Rule_ != nil || mr.MatchedDatas_ != nil {
+			t.Error("expected the matched rule to be released on close")
+		}
+	}
+
+	waf.TransactionArena = false
+	tx := waf.NewTransaction()
+	if tx.arena != nil {
+		t.Error("expected the arena to be removed")
+	}
+	tx.AddArgument(types.ArgumentGET, "a", "b")
+	tx.MatchRule(rule, tx.GetField(ruleVariableParams{Variable: variables.ArgsGet}))
+	if tx.MatchedRules()[0].(*corazarules.MatchedRule) == prev {
+		t.Error("expected the matched rule to be allocated on the heap")
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,11 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !tinygo && !coraza.no_fs_access
+// +build !tinygo,!coraza.no_fs_access
+
+package environment
+
+// HasAccessToFS indicates whether the engine may create files, like the
+// temporary files of large bodies and uploads or the audit log files.
+var HasAccessToFS = true
@@ -0,0 +1,13 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build tinygo || coraza.no_fs_access
+// +build tinygo coraza.no_fs_access
+
+package environment
+
+// HasAccessToFS indicates whether the engine may create files, like the
+// temporary files of large bodies and uploads or the audit log files.
+// Proxy-wasm hosts don't provide a filesystem, bodies are truncated to
+// the memory limit instead.
+var HasAccessToFS = false
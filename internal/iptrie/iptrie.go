@@ -0,0 +1,186 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package iptrie implements a path compressed binary radix tree of IPv4
+// and IPv6 networks, lookups take at most 32 or 128 bit comparisons no
+// matter how many networks are stored.
+package iptrie
+
+import (
+	"math/bits"
+	"net"
+)
+
+type node struct {
+	// key contains the network address, only the first plen bits are used
+	key  []byte
+	plen int
+	// terminal is true if the network was inserted, otherwise the node
+	// only splits two branches
+	terminal bool
+	child    [2]*node
+}
+
+// Trie is a set of IP networks, it is not concurrent safe for writes
+type Trie struct {
+	v4 *node
+	v6 *node
+	n  int
+}
+
+// New returns an empty Trie
+func New() *Trie {
+	return &Trie{}
+}
+
+// normalize returns the 4 bytes form of IPv4 addresses, including
+// IPv4-mapped IPv6 addresses, and the root for the address family
+func (t *Trie) normalize(ip net.IP) (net.IP, **node) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4, &t.v4
+	}
+	if ip16 := ip.To16(); ip16 != nil {
+		return ip16, &t.v6
+	}
+	return nil, nil
+}
+
+// network returns the key and prefix length of a network
+func (t *Trie) network(n *net.IPNet) (net.IP, int, **node) {
+	key, root := t.normalize(n.IP)
+	if key == nil {
+		return nil, 0, nil
+	}
+	ones, size := n.Mask.Size()
+	if size == 128 && len(key) == net.IPv4len {
+		// IPv4-mapped networks like ::ffff:10.0.0.0/104
+		ones -= 96
+	}
+	if ones < 0 || ones > len(key)*8 {
+		return nil, 0, nil
+	}
+	return key.Mask(net.CIDRMask(ones, len(key)*8)), ones, root
+}
+
+// bit returns the bit at position i
+func bit(key []byte, i int) int {
+	return int(key[i/8]>>(7-uint(i%8))) & 1
+}
+
+// commonPrefixLen returns the number of leading bits shared
+// by a and b, up to max
+func commonPrefixLen(a []byte, b []byte, max int) int {
+	n := 0
+	for i := 0; n < max; i++ {
+		if x := a[i] ^ b[i]; x != 0 {
+			n += bits.LeadingZeros8(x)
+			break
+		}
+		n += 8
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// Insert adds the network to the trie
+func (t *Trie) Insert(n *net.IPNet) {
+	key, plen, p := t.network(n)
+	if p == nil {
+		return
+	}
+	for {
+		cur := *p
+		if cur == nil {
+			*p = &node{key: key, plen: plen, terminal: true}
+			t.n++
+			return
+		}
+		max := cur.plen
+		if plen < max {
+			max = plen
+		}
+		common := commonPrefixLen(cur.key, key, max)
+		if common < cur.plen {
+			// the new network diverges inside the current node, we split it
+			split := &node{key: key, plen: common}
+			split.child[bit(cur.key, common)] = cur
+			if common == plen {
+				split.terminal = true
+			} else {
+				split.child[bit(key, common)] = &node{key: key, plen: plen, terminal: true}
+			}
+			*p = split
+			t.n++
+			return
+		}
+		if plen == cur.plen {
+			if !cur.terminal {
+				cur.terminal = true
+				t.n++
+			}
+			return
+		}
+		p = &cur.child[bit(key, cur.plen)]
+	}
+}
+
+// Remove deletes the network from the trie, networks contained
+// in it are not removed
+func (t *Trie) Remove(n *net.IPNet) {
+	key, plen, p := t.network(n)
+	if p == nil {
+		return
+	}
+	for {
+		cur := *p
+		if cur == nil || cur.plen > plen || commonPrefixLen(cur.key, key, cur.plen) < cur.plen {
+			return
+		}
+		if cur.plen == plen {
+			if !cur.terminal {
+				return
+			}
+			cur.terminal = false
+			t.n--
+			switch {
+			case cur.child[0] == nil && cur.child[1] == nil:
+				*p = nil
+			case cur.child[0] == nil:
+				*p = cur.child[1]
+			case cur.child[1] == nil:
+				*p = cur.child[0]
+			}
+			return
+		}
+		p = &cur.child[bit(key, cur.plen)]
+	}
+}
+
+// Contains returns true if the IP address is contained in any network
+func (t *Trie) Contains(ip net.IP) bool {
+	key, p := t.normalize(ip)
+	if p == nil {
+		return false
+	}
+	size := len(key) * 8
+	for cur := *p; cur != nil; {
+		if commonPrefixLen(cur.key, key, cur.plen) < cur.plen {
+			return false
+		}
+		if cur.terminal {
+			return true
+		}
+		if cur.plen == size {
+			return false
+		}
+		cur = cur.child[bit(key, cur.plen)]
+	}
+	return false
+}
+
+// Len returns the number of networks in the trie
+func (t *Trie) Len() int {
+	return t.n
+}
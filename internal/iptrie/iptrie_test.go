@@ -0,0 +1,102 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package iptrie
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+func mustCIDR(t testing.TB, s string) *net.IPNet {
+	t.Helper()
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestTrie(t *testing.T) {
+	tr := New()
+	for _, c := range []string{"10.0.0.0/8", "192.168.1.0/24", "192.168.1.128/25", "1.2.3.4/32", "2001:db8::/32", "::1/128", "0.0.0.0/1"} {
+		tr.Insert(mustCIDR(t, c))
+	}
+	tests := map[string]bool{
+		"10.1.2.3":         true,
+		"11.1.2.3":         true, // 0.0.0.0/1
+		"192.168.1.1":      true,
+		"192.168.1.200":    true,
+		"192.168.2.1":      false,
+		"1.2.3.4":          true,
+		"200.1.1.1":        false,
+		"2001:db8:1::1":    true,
+		"2001:db9::1":      false,
+		"::1":              true,
+		"::2":              false,
+		"::ffff:10.0.0.1":  true,
+		"::ffff:200.0.0.1": false,
+	}
+	for ip, expected := range tests {
+		if got := tr.Contains(net.ParseIP(ip)); got != expected {
+			t.Errorf("unexpected result for %s, want %t, got %t", ip, expected, got)
+		}
+	}
+	if tr.Contains(nil) {
+		t.Error("nil IP must not match")
+	}
+	if tr.Len() != 7 {
+		t.Errorf("expected 7 networks, got %d", tr.Len())
+	}
+
+	tr.Remove(mustCIDR(t, "0.0.0.0/1"))
+	tr.Remove(mustCIDR(t, "192.168.1.0/24"))
+	tr.Remove(mustCIDR(t, "172.16.0.0/12"))
+	if tr.Contains(net.ParseIP("11.1.2.3")) || tr.Contains(net.ParseIP("192.168.1.1")) {
+		t.Error("expected networks to be removed")
+	}
+	if !tr.Contains(net.ParseIP("192.168.1.200")) || !tr.Contains(net.ParseIP("10.1.2.3")) {
+		t.Error("expected remaining networks to match")
+	}
+	if tr.Len() != 5 {
+		t.Errorf("expected 5 networks, got %d", tr.Len())
+	}
+}
+
+func TestTrieLinearEquivalence(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tr := New()
+	var nets []*net.IPNet
+	for i := 0; i < 2000; i++ {
+		n := mustCIDR(t, fmt.Sprintf("%d.%d.%d.%d/%d", r.Intn(256), r.Intn(256), r.Intn(256), r.Intn(256), 8+r.Intn(25)))
+		nets = append(nets, n)
+		tr.Insert(n)
+	}
+	for i := 0; i < 20000; i++ {
+		ip := net.IPv4(byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)))
+		expected := false
+		for _, n := range nets {
+			if n.Contains(ip) {
+				expected = true
+				break
+			}
+		}
+		if tr.Contains(ip) != expected {
+			t.Fatalf("unexpected result for %s", ip)
+		}
+	}
+}
+
+func BenchmarkTrieContains(b *testing.B) {
+	tr := New()
+	for i := 0; i < 100000; i++ {
+		tr.Insert(mustCIDR(b, fmt.Sprintf("%d.%d.%d.0/24", 1+i/65536, (i/256)%256, i%256)))
+	}
+	ip := net.ParseIP("200.1.1.1")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.Contains(ip)
+	}
+}
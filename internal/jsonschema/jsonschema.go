@@ -0,0 +1,713 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package jsonschema validates JSON documents against the validation
+// keywords of JSON Schema drafts 4 to 2020-12 that don't need external
+// resources: type, enum, const, the numeric, string, array and object
+// constraints including the tuple forms of items, the allOf, anyOf, oneOf
+// and not combinations, the local $ref to definitions and the nullable
+// keyword of OpenAPI 3.0. The format keyword is ignored.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidationError is the first violation of the schema found in a
+// document
+type ValidationError struct {
+	// Path locates the invalid value like $.items[2].name
+	Path string
+	// Keyword is the schema keyword rejecting the value, like type or
+	// required
+	Keyword string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Schema is a compiled JSON Schema, it is safe for concurrent use
+type Schema struct {
+	root *node
+}
+
+type node struct {
+	// boolean schemas accept or reject everything
+	always *bool
+
+	types []string
+	enum  []interface{}
+	// constant is set if hasConst
+	constant interface{}
+	hasConst bool
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	// prefixItems validate the items at their position, items validates
+	// the rest
+	prefixItems []*node
+	items       *node
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	properties        map[string]*node
+	patternProperties []patternNode
+	// additionalProperties is nil if any property is allowed
+	additionalProperties *node
+	required             []string
+	minProperties        *int
+	maxProperties        *int
+
+	allOf []*node
+	anyOf []*node
+	oneOf []*node
+	not   *node
+
+	// ref is resolved after compiling the whole document
+	ref string
+	// target is the resolved ref
+	target *node
+}
+
+type patternNode struct {
+	re     *regexp.Regexp
+	schema *node
+}
+
+// Compiler compiles the schemas of a document referencing each other,
+// like the components of an OpenAPI specification. It is not concurrent
+// safe.
+type Compiler struct {
+	doc  interface{}
+	refs map[string]*node
+}
+
+// NewCompiler parses a JSON document containing schemas
+func NewCompiler(data []byte) (*Compiler, error) {
+	doc, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return &Compiler{doc: doc, refs: map[string]*node{}}, nil
+}
+
+// Compile compiles the schema at the JSON pointer ref, like
+// #/components/schemas/user, # is the whole document
+func (c *Compiler) Compile(ref string) (*Schema, error) {
+	root, err := c.lookup(ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.resolve(root, map[*node]bool{}); err != nil {
+		return nil, err
+	}
+	return &Schema{root: root}, nil
+}
+
+// Compile parses a JSON Schema document
+func Compile(data []byte) (*Schema, error) {
+	c, err := NewCompiler(data)
+	if err != nil {
+		return nil, err
+	}
+	return c.Compile("#")
+}
+
+// decode unmarshals the document read from r keeping the numbers as
+// json.Number
+func decode(r io.Reader) (interface{}, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after the JSON document")
+	}
+	return v, nil
+}
+
+func (c *Compiler) compile(v interface{}) (*node, error) {
+	if b, ok := v.(bool); ok {
+		return &node{always: &b}, nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid schema %v", v)
+	}
+	n := &node{}
+	var err error
+	if ref, ok := m["$ref"].(string); ok {
+		n.ref = ref
+	}
+	switch t := m["type"].(type) {
+	case string:
+		n.types = []string{t}
+	case []interface{}:
+		for _, s := range t {
+			if s, ok := s.(string); ok {
+				n.types = append(n.types, s)
+			}
+		}
+	}
+	// OpenAPI 3.0 schemas use nullable instead of the null type
+	if nullable, _ := m["nullable"].(bool); nullable && len(n.types) > 0 {
+		n.types = append(n.types, "null")
+	}
+	if e, ok := m["enum"].([]interface{}); ok {
+		n.enum = e
+	}
+	if cv, ok := m["const"]; ok {
+		n.constant, n.hasConst = cv, true
+	}
+	for key, field := range map[string]**float64{
+		"minimum":    &n.minimum,
+		"maximum":    &n.maximum,
+		"multipleOf": &n.multipleOf,
+	} {
+		if *field, err = number(m, key); err != nil {
+			return nil, err
+		}
+	}
+	if n.exclusiveMinimum, err = exclusive(m, "exclusiveMinimum", &n.minimum); err != nil {
+		return nil, err
+	}
+	if n.exclusiveMaximum, err = exclusive(m, "exclusiveMaximum", &n.maximum); err != nil {
+		return nil, err
+	}
+	for key, field := range map[string]**int{
+		"minLength":     &n.minLength,
+		"maxLength":     &n.maxLength,
+		"minItems":      &n.minItems,
+		"maxItems":      &n.maxItems,
+		"minProperties": &n.minProperties,
+		"maxProperties": &n.maxProperties,
+	} {
+		f, err := number(m, key)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			i := int(*f)
+			*field = &i
+		}
+	}
+	if p, ok := m["pattern"].(string); ok {
+		if n.pattern, err = regexp.Compile(p); err != nil {
+			return nil, err
+		}
+	}
+	n.uniqueItems, _ = m["uniqueItems"].(bool)
+	if err := c.compileItems(n, m); err != nil {
+		return nil, err
+	}
+	if props, ok := m["properties"].(map[string]interface{}); ok {
+		n.properties = map[string]*node{}
+		for k, p := range props {
+			if n.properties[k], err = c.compile(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if props, ok := m["patternProperties"].(map[string]interface{}); ok {
+		for _, k := range sortedKeys(props) {
+			re, err := regexp.Compile(k)
+			if err != nil {
+				return nil, err
+			}
+			s, err := c.compile(props[k])
+			if err != nil {
+				return nil, err
+			}
+			n.patternProperties = append(n.patternProperties, patternNode{re: re, schema: s})
+		}
+	}
+	if ap, ok := m["additionalProperties"]; ok {
+		if n.additionalProperties, err = c.compile(ap); err != nil {
+			return nil, err
+		}
+	}
+	if req, ok := m["required"].([]interface{}); ok {
+		for _, r := range req {
+			if r, ok := r.(string); ok {
+				n.required = append(n.required, r)
+			}
+		}
+	}
+	for key, field := range map[string]*[]*node{
+		"allOf": &n.allOf,
+		"anyOf": &n.anyOf,
+		"oneOf": &n.oneOf,
+	} {
+		list, _ := m[key].([]interface{})
+		for _, s := range list {
+			sn, err := c.compile(s)
+			if err != nil {
+				return nil, err
+			}
+			*field = append(*field, sn)
+		}
+	}
+	if not, ok := m["not"]; ok {
+		if n.not, err = c.compile(not); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// compileItems compiles the array form of items with additionalItems
+// used up to draft 2019-09, and prefixItems with items of draft 2020-12
+func (c *Compiler) compileItems(n *node, m map[string]interface{}) error {
+	prefix, isTuple := m["prefixItems"].([]interface{})
+	rest, hasRest := m["items"]
+	if tuple, ok := rest.([]interface{}); ok {
+		prefix, isTuple = tuple, true
+		rest, hasRest = m["additionalItems"]
+	}
+	if isTuple {
+		n.prefixItems = make([]*node, 0, len(prefix))
+		for _, s := range prefix {
+			sn, err := c.compile(s)
+			if err != nil {
+				return err
+			}
+			n.prefixItems = append(n.prefixItems, sn)
+		}
+	}
+	if hasRest {
+		var err error
+		if n.items, err = c.compile(rest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// number returns the numeric keyword key of m, or nil if it is missing
+func number(m map[string]interface{}, key string) (*float64, error) {
+	v, ok := m[key]
+	if !ok {
+		return nil, nil
+	}
+	num, ok := v.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a number", key)
+	}
+	f, err := num.Float64()
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// exclusive returns the exclusive limit key of m, draft 4 used booleans
+// turning the inclusive limit exclusive
+func exclusive(m map[string]interface{}, key string, limit **float64) (*float64, error) {
+	if b, ok := m[key].(bool); ok {
+		if !b {
+			return nil, nil
+		}
+		l := *limit
+		*limit = nil
+		return l, nil
+	}
+	return number(m, key)
+}
+
+// resolve links the $ref of n and its subschemas, visited avoids
+// looping on recursive schemas
+func (c *Compiler) resolve(n *node, visited map[*node]bool) error {
+	if n == nil || visited[n] {
+		return nil
+	}
+	visited[n] = true
+	if n.ref != "" {
+		target, err := c.lookup(n.ref)
+		if err != nil {
+			return err
+		}
+		n.target = target
+		if err := c.resolve(target, visited); err != nil {
+			return err
+		}
+	}
+	children := []*node{n.items, n.additionalProperties, n.not}
+	children = append(children, n.prefixItems...)
+	children = append(children, n.allOf...)
+	children = append(children, n.anyOf...)
+	children = append(children, n.oneOf...)
+	for _, p := range n.properties {
+		children = append(children, p)
+	}
+	for _, p := range n.patternProperties {
+		children = append(children, p.schema)
+	}
+	for _, child := range children {
+		if err := c.resolve(child, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup compiles the subschema at the JSON pointer ref, only the
+// references local to the document are supported
+func (c *Compiler) lookup(ref string) (*node, error) {
+	if n, ok := c.refs[ref]; ok {
+		return n, nil
+	}
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported reference %q", ref)
+	}
+	v := c.doc
+	var tokens []string
+	if ref != "#" {
+		tokens = strings.Split(ref[2:], "/")
+	}
+	for _, token := range tokens {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch cur := v.(type) {
+		case map[string]interface{}:
+			v = cur[token]
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(cur) {
+				return nil, fmt.Errorf("invalid reference %q", ref)
+			}
+			v = cur[i]
+		default:
+			v = nil
+		}
+		if v == nil {
+			return nil, fmt.Errorf("invalid reference %q", ref)
+		}
+	}
+	n, err := c.compile(v)
+	if err != nil {
+		return nil, err
+	}
+	c.refs[ref] = n
+	return n, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validate returns a *ValidationError with the first violation of the
+// schema in the JSON document data, or the syntax error if data is not
+// JSON
+func (s *Schema) Validate(data []byte) error {
+	return s.ValidateReader(bytes.NewReader(data))
+}
+
+// ValidateReader is like Validate for the JSON document read from r, the
+// document is decoded as it is read instead of being buffered
+func (s *Schema) ValidateReader(r io.Reader) error {
+	doc, err := decode(r)
+	if err != nil {
+		return &ValidationError{Path: "$", Keyword: "type", Message: "invalid JSON: " + err.Error()}
+	}
+	if err := s.root.validate(doc, "$", 0); err != nil {
+		return err
+	}
+	return nil
+}
+
+// maxRefDepth stops the schemas referencing themselves without consuming
+// the document, like {"$ref": "#"}
+const maxRefDepth = 64
+
+// validate returns the first violation of n in v, depth counts the
+// references followed without consuming the document
+func (n *node) validate(v interface{}, path string, depth int) *ValidationError {
+	fail := func(keyword string, format string, args ...interface{}) *ValidationError {
+		return &ValidationError{Path: path, Keyword: keyword, Message: fmt.Sprintf(format, args...)}
+	}
+	if n.always != nil {
+		if !*n.always {
+			return fail("false", "no value is allowed")
+		}
+		return nil
+	}
+	if n.target != nil {
+		if depth > maxRefDepth {
+			return fail("$ref", "too many nested references")
+		}
+		if err := n.target.validate(v, path, depth+1); err != nil {
+			return err
+		}
+	}
+	if len(n.types) > 0 && !matchesType(v, n.types) {
+		return fail("type", "expected %s, got %s", strings.Join(n.types, " or "), typeOf(v))
+	}
+	if n.enum != nil {
+		found := false
+		for _, e := range n.enum {
+			if equal(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fail("enum", "value is not one of the enum values")
+		}
+	}
+	if n.hasConst && !equal(n.constant, v) {
+		return fail("const", "value is not the constant")
+	}
+
+	switch val := v.(type) {
+	case json.Number:
+		if err := n.validateNumber(val, fail); err != nil {
+			return err
+		}
+	case string:
+		length := utf8.RuneCountInString(val)
+		if n.minLength != nil && length < *n.minLength {
+			return fail("minLength", "string shorter than %d", *n.minLength)
+		}
+		if n.maxLength != nil && length > *n.maxLength {
+			return fail("maxLength", "string longer than %d", *n.maxLength)
+		}
+		if n.pattern != nil && !n.pattern.MatchString(val) {
+			return fail("pattern", "string does not match %q", n.pattern.String())
+		}
+	case []interface{}:
+		if n.minItems != nil && len(val) < *n.minItems {
+			return fail("minItems", "fewer than %d items", *n.minItems)
+		}
+		if n.maxItems != nil && len(val) > *n.maxItems {
+			return fail("maxItems", "more than %d items", *n.maxItems)
+		}
+		if n.uniqueItems {
+			for i := range val {
+				for j := 0; j < i; j++ {
+					if equal(val[i], val[j]) {
+						return fail("uniqueItems", "items %d and %d are equal", j, i)
+					}
+				}
+			}
+		}
+		for i, item := range val {
+			s := n.items
+			if i < len(n.prefixItems) {
+				s = n.prefixItems[i]
+			}
+			if s == nil {
+				continue
+			}
+			if err := s.validate(item, path+"["+strconv.Itoa(i)+"]", depth); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		if err := n.validateObject(val, path, depth, fail); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range n.allOf {
+		if err := s.validate(v, path, depth); err != nil {
+			return err
+		}
+	}
+	if len(n.anyOf) > 0 {
+		matched := false
+		for _, s := range n.anyOf {
+			if s.validate(v, path, depth) == nil {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fail("anyOf", "value does not match any schema of anyOf")
+		}
+	}
+	if len(n.oneOf) > 0 {
+		matches := 0
+		for _, s := range n.oneOf {
+			if s.validate(v, path, depth) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fail("oneOf", "value matches %d schemas of oneOf", matches)
+		}
+	}
+	if n.not != nil && n.not.validate(v, path, depth) == nil {
+		return fail("not", "value matches the not schema")
+	}
+	return nil
+}
+
+func (n *node) validateNumber(num json.Number, fail func(string, string, ...interface{}) *ValidationError) *ValidationError {
+	f, err := num.Float64()
+	if err != nil {
+		return fail("type", "invalid number %s", num)
+	}
+	switch {
+	case n.minimum != nil && f < *n.minimum:
+		return fail("minimum", "%s is less than %v", num, *n.minimum)
+	case n.maximum != nil && f > *n.maximum:
+		return fail("maximum", "%s is greater than %v", num, *n.maximum)
+	case n.exclusiveMinimum != nil && f <= *n.exclusiveMinimum:
+		return fail("exclusiveMinimum", "%s is not greater than %v", num, *n.exclusiveMinimum)
+	case n.exclusiveMaximum != nil && f >= *n.exclusiveMaximum:
+		return fail("exclusiveMaximum", "%s is not less than %v", num, *n.exclusiveMaximum)
+	}
+	if n.multipleOf != nil && *n.multipleOf > 0 {
+		q := f / *n.multipleOf
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			return fail("multipleOf", "%s is not a multiple of %v", num, *n.multipleOf)
+		}
+	}
+	return nil
+}
+
+func (n *node) validateObject(obj map[string]interface{}, path string, depth int, fail func(string, string, ...interface{}) *ValidationError) *ValidationError {
+	for _, r := range n.required {
+		if _, ok := obj[r]; !ok {
+			return fail("required", "missing required property %q", r)
+		}
+	}
+	if n.minProperties != nil && len(obj) < *n.minProperties {
+		return fail("minProperties", "fewer than %d properties", *n.minProperties)
+	}
+	if n.maxProperties != nil && len(obj) > *n.maxProperties {
+		return fail("maxProperties", "more than %d properties", *n.maxProperties)
+	}
+	for _, k := range sortedKeys(obj) {
+		p := propertyPath(path, k)
+		matched := false
+		if s, ok := n.properties[k]; ok {
+			matched = true
+			if err := s.validate(obj[k], p, depth); err != nil {
+				return err
+			}
+		}
+		for _, pp := range n.patternProperties {
+			if pp.re.MatchString(k) {
+				matched = true
+				if err := pp.schema.validate(obj[k], p, depth); err != nil {
+					return err
+				}
+			}
+		}
+		if !matched && n.additionalProperties != nil {
+			if n.additionalProperties.always != nil && !*n.additionalProperties.always {
+				return &ValidationError{Path: p, Keyword: "additionalProperties", Message: "additional property is not allowed"}
+			}
+			if err := n.additionalProperties.validate(obj[k], p, depth); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// identifier matches the property names that don't need brackets
+var identifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+func propertyPath(path string, key string) string {
+	if identifier.MatchString(key) {
+		return path + "." + key
+	}
+	return path + "[" + strconv.Quote(key) + "]"
+}
+
+func matchesType(v interface{}, types []string) bool {
+	actual := typeOf(v)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func typeOf(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if f, err := val.Float64(); err == nil && f == math.Trunc(f) && !math.IsInf(f, 0) {
+			return "integer"
+		}
+		return "number"
+	}
+	return "unknown"
+}
+
+// equal compares JSON values, numbers are compared by value
+func equal(a interface{}, b interface{}) bool {
+	na, aok := a.(json.Number)
+	nb, bok := b.(json.Number)
+	if aok && bok {
+		fa, erra := na.Float64()
+		fb, errb := nb.Float64()
+		return erra == nil && errb == nil && fa == fb
+	}
+	switch av := a.(type) {
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !equal(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			if w, ok := bv[k]; !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package jsonschema
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		schema string
+		doc    string
+		// path is empty if the document is valid
+		path string
+	}{
+		{`{"type": "string"}`, `"a"`, ""},
+		{`{"type": "string"}`, `1`, "$"},
+		{`{"type": ["integer", "null"]}`, `null`, ""},
+		{`{"type": "integer"}`, `1.0`, ""},
+		{`{"type": "integer"}`, `1.5`, "$"},
+		{`{"type": "number", "minimum": 1, "exclusiveMaximum": 10}`, `10`, "$"},
+		{`{"type": "number", "maximum": 10, "exclusiveMaximum": true}`, `10`, "$"},
+		{`{"multipleOf": 0.1}`, `0.3`, ""},
+		{`{"multipleOf": 2}`, `3`, "$"},
+		{`{"minLength": 2, "maxLength": 3}`, `"ñá"`, ""},
+		{`{"minLength": 2, "maxLength": 3}`, `"abcd"`, "$"},
+		{`{"pattern": "^a"}`, `"ba"`, "$"},
+		{`{"enum": [1, "a", {"b": [1]}]}`, `{"b": [1.0]}`, ""},
+		{`{"enum": [1, "a"]}`, `"b"`, "$"},
+		{`{"const": false}`, `false`, ""},
+		{`{"items": {"type": "integer"}, "maxItems": 3}`, `[1, 2, "3"]`, "$[2]"},
+		{`{"items": [{"type": "string"}, {"type": "integer"}]}`, `["a", 1, null]`, ""},
+		{`{"items": [{"type": "string"}, {"type": "integer"}]}`, `["a", "b"]`, "$[1]"},
+		{`{"items": [{"type": "string"}], "additionalItems": false}`, `["a", 1]`, "$[1]"},
+		{`{"prefixItems": [{"type": "string"}], "items": {"type": "integer"}}`, `["a", 1, 2]`, ""},
+		{`{"prefixItems": [{"type": "string"}], "items": {"type": "integer"}}`, `[1]`, "$[0]"},
+		{`{"prefixItems": [{"type": "string"}], "items": {"type": "integer"}}`, `["a", "b"]`, "$[1]"},
+		{`{"uniqueItems": true}`, `[1, {"a": 1}, {"a": 1}]`, "$"},
+		{`{"properties": {"a b": {"type": "string"}}}`, `{"a b": 1}`, `$["a b"]`},
+		{`{"patternProperties": {"^x-": {"type": "string"}}, "additionalProperties": false}`, `{"x-a": "1", "b": 1}`, "$.b"},
+		{`{"additionalProperties": {"type": "integer"}}`, `{"a": 1, "b": "2"}`, "$.b"},
+		{`{"required": ["a"], "maxProperties": 1}`, `{"a": 1, "b": 2}`, "$"},
+		{`{"allOf": [{"type": "integer"}, {"minimum": 2}]}`, `1`, "$"},
+		{`{"anyOf": [{"type": "integer"}, {"type": "string"}]}`, `"a"`, ""},
+		{`{"oneOf": [{"type": "integer"}, {"type": "number"}]}`, `1`, "$"},
+		{`{"not": {"type": "null"}}`, `null`, "$"},
+		{`false`, `1`, "$"},
+		{`{"definitions": {"n": {"type": "object", "properties": {"next": {"$ref": "#/definitions/n"}}, "additionalProperties": false}}, "$ref": "#/definitions/n"}`, `{"next": {"next": {"x": 1}}}`, "$.next.next.x"},
+		{`{"$ref": "#"}`, `1`, "$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schema+" "+tt.doc, func(t *testing.T) {
+			s, err := Compile([]byte(tt.schema))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = s.Validate([]byte(tt.doc))
+			if tt.path == "" {
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected a validation error, got %v", err)
+			}
+			if verr.Path != tt.path {
+				t.Errorf("want path %q, have %q (%s)", tt.path, verr.Path, verr.Message)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, schema := range []string{
+		`[]`,
+		`{"pattern": "("}`,
+		`{"minimum": "1"}`,
+		`{"$ref": "#/definitions/missing"}`,
+		`{"$ref": "https://example.com/schema.json"}`,
+		`{} {}`,
+	} {
+		if _, err := Compile([]byte(schema)); err == nil {
+			t.Errorf("expected an error compiling %s", schema)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package memoize caches compiled artifacts, like regular expressions
+// and pattern matchers, so WAF instances loading the same rules share
+// them instead of compiling their own copy. Cached values must be safe
+// for concurrent use.
+//
+// Each WAF references the artifacts it uses through a Scope, artifacts
+// are evicted once every scope using them is released.
+package memoize
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+)
+
+// maxKeyLen is the length from which keys are replaced by their hash,
+// keys contain the operator arguments which can be whole files
+const maxKeyLen = 128
+
+type entry struct {
+	once  sync.Once
+	value interface{}
+	err   error
+	// refs is the number of scopes using the entry
+	refs int
+}
+
+var (
+	// mu guards the cache and the keys of the scopes
+	mu     sync.Mutex
+	cache  = map[string]*entry{}
+	hits   uint64
+	misses uint64
+)
+
+// Scope holds references to the cached artifacts used by a WAF
+type Scope struct {
+	keys map[string]struct{}
+}
+
+// NewScope returns an empty Scope
+func NewScope() *Scope {
+	return &Scope{keys: map[string]struct{}{}}
+}
+
+// Do returns the cached value for key, calling fn to build it the first
+// time. Errors are cached too, fn is called only once per key. A nil
+// Scope doesn't cache, fn is called every time.
+func (s *Scope) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	if s == nil {
+		return fn()
+	}
+	key = cacheKey(key)
+	mu.Lock()
+	e, ok := cache[key]
+	if ok {
+		atomic.AddUint64(&hits, 1)
+	} else {
+		atomic.AddUint64(&misses, 1)
+		e = &entry{}
+		cache[key] = e
+	}
+	if _, held := s.keys[key]; !held {
+		s.keys[key] = struct{}{}
+		e.refs++
+	}
+	mu.Unlock()
+	e.once.Do(func() {
+		e.value, e.err = fn()
+	})
+	return e.value, e.err
+}
+
+// Release drops the references of the scope, the artifacts no longer
+// used by another scope are evicted. Values already returned by Do stay
+// valid.
+func (s *Scope) Release() {
+	if s == nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for key := range s.keys {
+		if e, ok := cache[key]; ok {
+			e.refs--
+			if e.refs <= 0 {
+				delete(cache, key)
+			}
+		}
+	}
+	s.keys = map[string]struct{}{}
+}
+
+// cacheKey returns key, or its hash for long keys so the cache doesn't
+// keep a copy of large inputs
+func cacheKey(key string) string {
+	if len(key) <= maxKeyLen {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Len returns the number of cached artifacts
+func Len() int {
+	mu.Lock()
+	defer mu.Unlock()
+	return len(cache)
+}
+
+// Stats returns the number of cached artifacts, the number of lookups
+// served from the cache and the number of lookups building a new artifact
+func Stats() (entries int, h uint64, m uint64) {
+	return Len(), atomic.LoadUint64(&hits), atomic.LoadUint64(&misses)
+}
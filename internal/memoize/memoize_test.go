@@ -0,0 +1,81 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package memoize
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDo(t *testing.T) {
+	_, hits, misses := Stats()
+	s := NewScope()
+	defer s.Release()
+	calls := 0
+	fn := func() (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+	for i := 0; i < 3; i++ {
+		v, err := s.Do("memoize-test", fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.(int) != 1 {
+			t.Errorf("expected cached value 1, got %v", v)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected fn to be called once, got %d", calls)
+	}
+	if _, h, m := Stats(); h-hits != 2 || m-misses != 1 {
+		t.Errorf("unexpected stats, got %d hits and %d misses", h-hits, m-misses)
+	}
+
+	expectedErr := errors.New("failed")
+	if _, err := s.Do("memoize-test-err", func() (interface{}, error) { return nil, expectedErr }); err != expectedErr {
+		t.Errorf("expected error to be returned, got %v", err)
+	}
+
+	var nilScope *Scope
+	for i := 0; i < 2; i++ {
+		if _, err := nilScope.Do("memoize-test", fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("expected a nil scope not to cache, fn was called %d times", calls)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	entries := Len()
+	a, b := NewScope(), NewScope()
+	fn := func() (interface{}, error) { return 1, nil }
+	key := "memoize-release-" + strings.Repeat("a", maxKeyLen)
+	for _, s := range []*Scope{a, b} {
+		if _, err := s.Do(key, fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if Len() != entries+1 {
+		t.Fatalf("expected the scopes to share the entry, got %d new entries", Len()-entries)
+	}
+	mu.Lock()
+	_, ok := cache[key]
+	mu.Unlock()
+	if ok {
+		t.Error("expected long keys to be hashed")
+	}
+
+	a.Release()
+	if Len() != entries+1 {
+		t.Error("expected the entry to be kept while a scope uses it")
+	}
+	b.Release()
+	if Len() != entries {
+		t.Error("expected the entry to be evicted once every scope is released")
+	}
+}
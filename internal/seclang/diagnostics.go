@@ -0,0 +1,142 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package seclang
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiagnosticSeverity is the severity of a Diagnostic
+type DiagnosticSeverity int
+
+const (
+	// DiagnosticError is a problem preventing the directive from being
+	// applied
+	DiagnosticError DiagnosticSeverity = iota
+	// DiagnosticWarning is a problem that doesn't prevent the directive
+	// from being applied, like an unsupported or deprecated feature
+	DiagnosticWarning
+)
+
+// String returns the string representation of the severity
+func (s DiagnosticSeverity) String() string {
+	if s == DiagnosticWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic is a problem found while parsing the directives
+type Diagnostic struct {
+	Severity DiagnosticSeverity
+	// File is empty for the directives parsed from a string
+	File string
+	// Line and Column are 1-based, Column points to Token or to the
+	// directive if the token is unknown
+	Line   int
+	Column int
+	// Directive is the name of the directive as written
+	Directive string
+	// Token is the offending part of the directive, like an action or a
+	// variable name, it may be empty
+	Token   string
+	Message string
+}
+
+// String formats the diagnostic like file.conf:3:12: unknown action "foo"
+func (d Diagnostic) String() string {
+	sb := strings.Builder{}
+	if d.File != "" {
+		fmt.Fprintf(&sb, "%s:%d:%d: ", d.File, d.Line, d.Column)
+	} else {
+		fmt.Fprintf(&sb, "line %d, column %d: ", d.Line, d.Column)
+	}
+	if d.Severity == DiagnosticWarning {
+		sb.WriteString("warning: ")
+	}
+	sb.WriteString(d.Message)
+	if d.Token != "" && !strings.Contains(d.Message, d.Token) {
+		fmt.Fprintf(&sb, " (near %q)", d.Token)
+	}
+	return sb.String()
+}
+
+// ParseError is returned when a directive fails to be parsed, the
+// original error is available with errors.Unwrap
+type ParseError struct {
+	Diagnostic
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return e.Diagnostic.String()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// tokenError marks the part of the directive that caused the error
+type tokenError struct {
+	token string
+	err   error
+}
+
+func newTokenError(token string, err error) error {
+	return &tokenError{token: token, err: err}
+}
+
+func (e *tokenError) Error() string {
+	return e.err.Error()
+}
+
+func (e *tokenError) Unwrap() error {
+	return e.err
+}
+
+// directiveLine is a physical line of a directive
+type directiveLine struct {
+	number int
+	text   string
+}
+
+// locate returns the position of token in the lines of a directive, or
+// the position of the directive if token is not found
+func locate(lines []directiveLine, token string) (int, int) {
+	if len(lines) == 0 {
+		return 0, 0
+	}
+	if token != "" {
+		for _, l := range lines {
+			if i := strings.Index(l.text, token); i >= 0 {
+				return l.number, i + 1
+			}
+		}
+	}
+	text := lines[0].text
+	return lines[0].number, len(text) - len(strings.TrimLeft(text, " \t")) + 1
+}
+
+// unsupportedActions are the ModSecurity actions ignored by Coraza
+var unsupportedActions = map[string]bool{
+	"accuracy":               true,
+	"deprecatevar":           true,
+	"proxy":                  true,
+	"sanitisearg":            true,
+	"sanitisematched":        true,
+	"sanitisematchedbytes":   true,
+	"sanitiserequestheader":  true,
+	"sanitiseresponseheader": true,
+	"setrsc":                 true,
+	"setsid":                 true,
+	"setuid":                 true,
+	"xmlns":                  true,
+}
+
+// deprecatedDirectives maps the deprecated directives to their
+// replacement
+var deprecatedDirectives = map[string]string{
+	"secauditlogstoragedir": "SecAuditLogDir",
+}
@@ -4,15 +4,26 @@
 package seclang
 
 import (
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/internal/environment"
+	ioutils "github.com/corazawaf/coraza/v3/internal/io"
 	"github.com/corazawaf/coraza/v3/loggers"
+	"github.com/corazawaf/coraza/v3/openapi"
+	"github.com/corazawaf/coraza/v3/profiler"
+	"github.com/corazawaf/coraza/v3/regex"
+	"github.com/corazawaf/coraza/v3/transformations"
 	"github.com/corazawaf/coraza/v3/types"
 )
 
@@ -23,6 +34,17 @@ type DirectiveOptions struct {
 	Opts     string
 	Path     []string
 	Datasets map[string][]string
+	// warn reports a non fatal problem of the directive, token is the
+	// offending part of the directive, if known
+	warn func(token string, message string)
+}
+
+// Warn reports a non fatal problem of the directive, it is available in
+// the parser diagnostics
+func (o *DirectiveOptions) Warn(token string, message string) {
+	if o.warn != nil {
+		o.warn(token, message)
+	}
 }
 
 type directive = func(options *DirectiveOptions) error
@@ -54,6 +76,7 @@ func directiveSecAction(options *DirectiveOptions) error {
 		Config:       options.Config,
 		Directive:    "SecAction",
 		Data:         options.Opts,
+		warn:         options.Warn,
 	})
 	if err != nil {
 		return newCompileRuleError(err, options.Opts)
@@ -73,6 +96,7 @@ func directiveSecRule(options *DirectiveOptions) error {
 		Config:       options.Config,
 		Directive:    "SecRule",
 		Data:         options.Opts,
+		warn:         options.Warn,
 	})
 	if err != nil && !ignoreErrors {
 		return newCompileRuleError(err, options.Opts)
@@ -114,13 +138,402 @@ func directiveSecRequestBodyAccess(options *DirectiveOptions) error {
 	return nil
 }
 
+// directiveSecTransactionPool selects whether closed transactions are
+// reused, Off suits long-lived transactions: SecTransactionPool Off
+func directiveSecTransactionPool(options *DirectiveOptions) error {
+	b, err := parseBoolean(options.Opts)
+	if err != nil {
+		return newDirectiveError(err, "SecTransactionPool")
+	}
+	options.WAF.TransactionPoolDisabled = !b
+	return nil
+}
+
+// directiveSecTransactionPoolMaxBufferSize releases the buffers larger
+// than a size in bytes when a transaction is closed instead of reusing
+// them, K, M and G suffixes are accepted: SecTransactionPoolMaxBufferSize 1M
+func directiveSecTransactionPoolMaxBufferSize(options *DirectiveOptions) error {
+	size, err := parseSize(options.Opts)
+	if err != nil || size < 0 || size > math.MaxInt32 {
+		return fmt.Errorf("invalid transaction pool max buffer size %q", options.Opts)
+	}
+	options.WAF.TransactionPoolMaxBufferSize = int(size)
+	return nil
+}
+
+// directiveSecTransactionArena allocates the match data, the matched rules
+// and the collection entries of the transactions by slabs reused with the
+// pooled transactions, the matched rules must not be used once a
+// transaction is closed: SecTransactionArena On
+func directiveSecTransactionArena(options *DirectiveOptions) error {
+	b, err := parseBoolean(options.Opts)
+	if err != nil {
+		return newDirectiveError(err, "SecTransactionArena")
+	}
+	options.WAF.TransactionArena = b
+	return nil
+}
+
+// directiveSecParallelRuleWorkers tests the independent rules of a phase
+// with a number of goroutines, Off or 0 evaluates every rule sequentially:
+// SecParallelRuleWorkers 4
+func directiveSecParallelRuleWorkers(options *DirectiveOptions) error {
+	if strings.EqualFold(options.Opts, "off") {
+		options.WAF.ParallelRuleWorkers = 0
+		return nil
+	}
+	workers, err := strconv.Atoi(options.Opts)
+	if err != nil || workers < 0 {
+		return fmt.Errorf("invalid number of parallel rule workers %q", options.Opts)
+	}
+	options.WAF.ParallelRuleWorkers = workers
+	return nil
+}
+
+// directiveSecRequestBodyCharsetDecoding enables transcoding request
+// bodies declaring a charset other than UTF-8: SecRequestBodyCharsetDecoding On
+func directiveSecRequestBodyCharsetDecoding(options *DirectiveOptions) error {
+	b, err := parseBoolean(strings.ToLower(options.Opts))
+	if err != nil {
+		return newDirectiveError(err, "SecRequestBodyCharsetDecoding")
+	}
+	options.WAF.RequestBodyCharsetDecoding = b
+	return nil
+}
+
+// directiveSecRequestBodyLinesLimit sets the maximum number of documents
+// of the line delimited request bodies like NDJSON, 0 disables it:
+// SecRequestBodyLinesLimit 10000
+func directiveSecRequestBodyLinesLimit(options *DirectiveOptions) error {
+	limit, err := strconv.Atoi(options.Opts)
+	if err != nil || limit < 0 {
+		return fmt.Errorf("invalid request body lines limit %q", options.Opts)
+	}
+	options.WAF.RequestBodyLinesLimit = limit
+	return nil
+}
+
+// directiveSecRequestBodyXMLDepthLimit sets the nesting level of the XML
+// request body elements reported in REQUEST_XML_ANOMALIES as
+// depth_exceeded, 0 disables it:
+// SecRequestBodyXMLDepthLimit 256
+func directiveSecRequestBodyXMLDepthLimit(options *DirectiveOptions) error {
+	limit, err := strconv.Atoi(options.Opts)
+	if err != nil || limit < 0 {
+		return fmt.Errorf("invalid request body XML depth limit %q", options.Opts)
+	}
+	options.WAF.RequestBodyXMLDepthLimit = limit
+	return nil
+}
+
+// directiveSecRequestBodyXMLElementsLimit sets the number of XML request
+// body elements reported in REQUEST_XML_ANOMALIES as elements_exceeded,
+// 0 disables it:
+// SecRequestBodyXMLElementsLimit 50000
+func directiveSecRequestBodyXMLElementsLimit(options *DirectiveOptions) error {
+	limit, err := strconv.Atoi(options.Opts)
+	if err != nil || limit < 0 {
+		return fmt.Errorf("invalid request body XML elements limit %q", options.Opts)
+	}
+	options.WAF.RequestBodyXMLElementsLimit = limit
+	return nil
+}
+
+// directiveSecOpenAPISpec loads the JSON encoded OpenAPI 3 specification
+// enforced before the phase 1 and phase 2 rules, the violations are set in
+// OPENAPI_VIOLATIONS: SecOpenAPISpec /etc/coraza/openapi.json
+func directiveSecOpenAPISpec(options *DirectiveOptions) error {
+	path := strings.TrimSpace(options.Opts)
+	if path == "" {
+		return errors.New("syntax error: SecOpenAPISpec /path/to/openapi.json")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(options.Config.Get("parser_config_dir", "").(string), path)
+	}
+	root := options.Config.Get("parser_root", ioutils.OSFS{}).(fs.FS)
+	data, err := fs.ReadFile(root, path)
+	if err != nil {
+		return newDirectiveError(err, "SecOpenAPISpec")
+	}
+	spec, err := openapi.Load(data)
+	if err != nil {
+		return newDirectiveError(err, "SecOpenAPISpec")
+	}
+	options.WAF.OpenAPI = spec
+	return nil
+}
+
+// directiveSecOpenAPIAction selects what happens to the requests violating
+// the OpenAPI specification, Detect only sets the variables and Reject
+// interrupts them with a 400 status: SecOpenAPIAction Reject
+func directiveSecOpenAPIAction(options *DirectiveOptions) error {
+	switch strings.ToLower(options.Opts) {
+	case "detect":
+		options.WAF.OpenAPIAction = openapi.Detect
+	case "reject":
+		options.WAF.OpenAPIAction = openapi.Reject
+	default:
+		return fmt.Errorf("invalid OpenAPI action %q, expected Detect or Reject", options.Opts)
+	}
+	return nil
+}
+
+// directiveSecProfileFile loads the endpoint profile from a JSON file
+// exported by the profiler, an empty profile is used if the file doesn't
+// exist yet. In Learn mode the profile is written back to the file when
+// the WAF is closed, so it is read from the OS filesystem like it is
+// written instead of the root of the configuration:
+// SecProfileFile /var/lib/coraza/profile.json
+func directiveSecProfileFile(options *DirectiveOptions) error {
+	path := strings.TrimSpace(options.Opts)
+	if path == "" {
+		return errors.New("syntax error: SecProfileFile /path/to/profile.json")
+	}
+	if !environment.HasAccessToFS {
+		return errors.New("SecProfileFile requires filesystem access")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(options.Config.Get("parser_config_dir", "").(string), path)
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		options.WAF.Profile = profiler.New()
+	case err != nil:
+		return newDirectiveError(err, "SecProfileFile")
+	default:
+		p, err := profiler.Load(data)
+		if err != nil {
+			return newDirectiveError(err, "SecProfileFile")
+		}
+		options.WAF.Profile = p
+	}
+	options.WAF.ProfileFile = path
+	return nil
+}
+
+// directiveSecProfileMode selects whether the endpoint profile is learned
+// from the requests or enforced, the deviations are set in
+// PROFILE_VIOLATION: SecProfileMode Enforce
+func directiveSecProfileMode(options *DirectiveOptions) error {
+	switch strings.ToLower(options.Opts) {
+	case "learn":
+		options.WAF.ProfileMode = profiler.Learn
+	case "enforce":
+		options.WAF.ProfileMode = profiler.Enforce
+	default:
+		return fmt.Errorf("invalid profile mode %q, expected Learn or Enforce", options.Opts)
+	}
+	return nil
+}
+
+// directiveSecRequestBodyProcessor routes the request bodies of a media
+// type to a body processor: SecRequestBodyProcessor application/vnd.api+json JSON
+func directiveSecRequestBodyProcessor(options *DirectiveOptions) error {
+	fields := strings.Fields(options.Opts)
+	if len(fields) != 2 {
+		return fmt.Errorf("invalid request body processor %q, expected a media type and a processor", options.Opts)
+	}
+	return options.WAF.SetBodyProcessor(fields[0], fields[1])
+}
+
+// directiveSecRequestBodyMethodProcessor sets the body processor of the
+// requests of a method whose Content-Type has no processor, NONE removes
+// it: SecRequestBodyMethodProcessor PROPFIND XML
+func directiveSecRequestBodyMethodProcessor(options *DirectiveOptions) error {
+	fields := strings.Fields(options.Opts)
+	if len(fields) != 2 {
+		return fmt.Errorf("invalid request body method processor %q, expected a method and a processor", options.Opts)
+	}
+	return options.WAF.SetMethodBodyProcessor(fields[0], fields[1])
+}
+
+// directiveSecRequestBodyProcessorSniffing chooses the JSON or XML body
+// processor from the request bodies whose Content-Type has no processor:
+// SecRequestBodyProcessorSniffing On
+func directiveSecRequestBodyProcessorSniffing(options *DirectiveOptions) error {
+	b, err := parseBoolean(strings.ToLower(options.Opts))
+	if err != nil {
+		return newDirectiveError(err, "SecRequestBodyProcessorSniffing")
+	}
+	options.WAF.RequestBodyProcessorSniffing = b
+	return nil
+}
+
+// directiveSecRequestBodyDecompression enables decompressing the request
+// bodies declared with a supported Content-Encoding before parsing them:
+// SecRequestBodyDecompression On
+func directiveSecRequestBodyDecompression(options *DirectiveOptions) error {
+	b, err := parseBoolean(strings.ToLower(options.Opts))
+	if err != nil {
+		return newDirectiveError(err, "SecRequestBodyDecompression")
+	}
+	options.WAF.RequestBodyDecompression = b
+	return nil
+}
+
+// directiveSecRequestBodyDecompressionRatio bounds the decompressed
+// request body to a multiple of the compressed size, 0 disables it:
+// SecRequestBodyDecompressionRatio 100
+func directiveSecRequestBodyDecompressionRatio(options *DirectiveOptions) error {
+	ratio, err := strconv.Atoi(options.Opts)
+	if err != nil || ratio < 0 {
+		return fmt.Errorf("invalid decompression ratio %q", options.Opts)
+	}
+	options.WAF.RequestBodyDecompressionRatio = ratio
+	return nil
+}
+
+// directiveSecResponseBodyDecompression enables decompressing the response
+// bodies declared with a supported Content-Encoding before the response
+// body phase: SecResponseBodyDecompression On
+func directiveSecResponseBodyDecompression(options *DirectiveOptions) error {
+	b, err := parseBoolean(strings.ToLower(options.Opts))
+	if err != nil {
+		return newDirectiveError(err, "SecResponseBodyDecompression")
+	}
+	options.WAF.ResponseBodyDecompression = b
+	return nil
+}
+
+// directiveSecResponseBodyDecompressionRatio bounds the decompressed
+// response body to a multiple of the compressed size, 0 disables it:
+// SecResponseBodyDecompressionRatio 100
+func directiveSecResponseBodyDecompressionRatio(options *DirectiveOptions) error {
+	ratio, err := strconv.Atoi(options.Opts)
+	if err != nil || ratio < 0 {
+		return fmt.Errorf("invalid decompression ratio %q", options.Opts)
+	}
+	options.WAF.ResponseBodyDecompressionRatio = ratio
+	return nil
+}
+
+// directiveSecStreamInBodyInspection copies the raw request body to
+// STREAM_INPUT_BODY, @rsub can modify it: SecStreamInBodyInspection On
+func directiveSecStreamInBodyInspection(options *DirectiveOptions) error {
+	b, err := parseBoolean(strings.ToLower(options.Opts))
+	if err != nil {
+		return newDirectiveError(err, "SecStreamInBodyInspection")
+	}
+	options.WAF.StreamInBodyInspection = b
+	return nil
+}
+
+// directiveSecStreamOutBodyInspection copies the raw response body to
+// STREAM_OUTPUT_BODY, @rsub can modify it: SecStreamOutBodyInspection On
+func directiveSecStreamOutBodyInspection(options *DirectiveOptions) error {
+	b, err := parseBoolean(strings.ToLower(options.Opts))
+	if err != nil {
+		return newDirectiveError(err, "SecStreamOutBodyInspection")
+	}
+	options.WAF.StreamOutBodyInspection = b
+	return nil
+}
+
 func directiveSecRuleEngine(options *DirectiveOptions) error {
 	engine, err := types.ParseRuleEngineStatus(options.Opts)
 	options.WAF.RuleEngine = engine
 	return err
 }
 
+func directiveSecRuleEngineSampling(options *DirectiveOptions) error {
+	rate, key, _ := strings.Cut(options.Opts, " ")
+	r, err := strconv.ParseFloat(rate, 64)
+	if err != nil || r < 0 || r > 100 {
+		return errors.New("syntax error: SecRuleEngineSampling [0-100] [Random/ClientIP]")
+	}
+	k, err := corazawaf.ParseSamplingKey(strings.TrimSpace(key))
+	if err != nil {
+		return newDirectiveError(err, "SecRuleEngineSampling")
+	}
+	options.WAF.RuleEngineSampleRate = r
+	options.WAF.RuleEngineSampleKey = k
+	return nil
+}
+
+// directiveSecUnicodeMapFile loads the code points mapping used by
+// t:urlDecodeUni of the rules of the WAF:
+// SecUnicodeMapFile /path/to/unicode.mapping 20127
+func directiveSecUnicodeMapFile(options *DirectiveOptions) error {
+	path, cp, ok := strings.Cut(strings.TrimSpace(options.Opts), " ")
+	codePage, err := strconv.Atoi(strings.TrimSpace(cp))
+	if !ok || err != nil {
+		return errors.New("syntax error: SecUnicodeMapFile /path/to/unicode.mapping codepage")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(options.Config.Get("parser_config_dir", "").(string), path)
+	}
+	root := options.Config.Get("parser_root", ioutils.OSFS{}).(fs.FS)
+	f, err := root.Open(path)
+	if err != nil {
+		return newDirectiveError(err, "SecUnicodeMapFile")
+	}
+	defer f.Close()
+	m, err := transformations.ParseUnicodeMap(f, codePage)
+	if err != nil {
+		return newDirectiveError(err, "SecUnicodeMapFile")
+	}
+	options.WAF.UnicodeMap.Set(m)
+	return nil
+}
+
+// directiveSecRegexEngine selects the engine compiling the regular
+// expressions of the rules declared after it
+func directiveSecRegexEngine(options *DirectiveOptions) error {
+	e, err := regex.GetEngine(options.Opts)
+	if err != nil {
+		return newDirectiveError(err, "SecRegexEngine")
+	}
+	options.WAF.RegexEngine = e
+	return nil
+}
+
+// directiveSecCacheTransformations configures the transformation cache
+// with the ModSecurity syntax: SecCacheTransformations On|Off [options]
+// where options is a comma separated list of incremental:on|off,
+// minlen:N, maxlen:N and maxitems:N.
+func directiveSecCacheTransformations(options *DirectiveOptions) error {
+	status, opts, _ := strings.Cut(options.Opts, " ")
+	enabled, err := parseBoolean(status)
+	if err != nil {
+		return newDirectiveError(err, "SecCacheTransformations")
+	}
+	cfg := options.WAF.TransformationCache
+	cfg.Enabled = enabled
+	opts = strings.Trim(strings.TrimSpace(opts), `"'`)
+	if opts != "" {
+		for _, opt := range strings.Split(opts, ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(opt), ":")
+			var n int
+			switch strings.ToLower(k) {
+			case "incremental":
+				cfg.Incremental, err = parseBoolean(v)
+			case "minlen":
+				n, err = strconv.Atoi(v)
+				cfg.MinLen = n
+			case "maxlen":
+				n, err = strconv.Atoi(v)
+				cfg.MaxLen = n
+			case "maxitems":
+				n, err = strconv.Atoi(v)
+				cfg.MaxItems = n
+			default:
+				err = fmt.Errorf("unknown option %q", k)
+			}
+			if err == nil && n < 0 {
+				err = fmt.Errorf("invalid value for option %q", k)
+			}
+			if err != nil {
+				return newDirectiveError(err, "SecCacheTransformations")
+			}
+		}
+	}
+	options.WAF.TransformationCache = cfg
+	return nil
+}
+
 func directiveUnsupported(options *DirectiveOptions) error {
+	options.Warn("", "unsupported directive, it is ignored")
 	return nil
 }
 
@@ -139,6 +552,17 @@ func directiveSecServerSignature(options *DirectiveOptions) error {
 	return nil
 }
 
+// directiveSecServerSignatureMode selects how SecServerSignature changes
+// the Server response header, Rewrite, Inject or Remove: SecServerSignatureMode Inject
+func directiveSecServerSignatureMode(options *DirectiveOptions) error {
+	mode, err := types.ParseServerSignatureMode(options.Opts)
+	if err != nil {
+		return err
+	}
+	options.WAF.ServerSignatureMode = mode
+	return nil
+}
+
 func directiveSecRuleRemoveByTag(options *DirectiveOptions) error {
 	for _, r := range options.WAF.Rules.FindByTag(options.Opts) {
 		options.WAF.Rules.DeleteByID(r.ID_)
@@ -185,8 +609,128 @@ func directiveSecRequestBodyLimitAction(options *DirectiveOptions) error {
 	return nil
 }
 
+func directiveSecPauseLimit(options *DirectiveOptions) error {
+	ms, err := strconv.Atoi(options.Opts)
+	if err != nil || ms < 0 {
+		return fmt.Errorf("invalid pause limit %q", options.Opts)
+	}
+	options.WAF.PauseLimit = time.Duration(ms) * time.Millisecond
+	return nil
+}
+
+// directiveSecCookieFormat selects the format of the request cookies,
+// 0 for Netscape cookies and 1 for RFC 2965 cookies: SecCookieFormat 0
+func directiveSecCookieFormat(options *DirectiveOptions) error {
+	switch options.Opts {
+	case "0":
+		options.WAF.CookieFormat = 0
+	case "1":
+		options.WAF.CookieFormat = 1
+	default:
+		return fmt.Errorf("invalid cookie format %q", options.Opts)
+	}
+	return nil
+}
+
+// directiveSecCookieV0Separator sets the characters separating version 0
+// cookies, more than one can be set to tolerate clients using another
+// separator: SecCookieV0Separator ;,
+func directiveSecCookieV0Separator(options *DirectiveOptions) error {
+	if len(options.Opts) == 0 {
+		return errors.New("syntax error: SecCookieV0Separator ;")
+	}
+	options.WAF.CookieV0Separators = options.Opts
+	return nil
+}
+
+// directiveSecArgumentSeparator sets the characters separating the
+// urlencoded arguments of the query string and the request body, more
+// than one can be set for legacy applications using ; as well as &:
+// SecArgumentSeparator &;
+func directiveSecArgumentSeparator(options *DirectiveOptions) error {
+	if len(options.Opts) == 0 {
+		return errors.New("syntax error: SecArgumentSeparator &")
+	}
+	if strings.ContainsAny(options.Opts, "=% \t") {
+		return fmt.Errorf("invalid argument separator %q", options.Opts)
+	}
+	options.WAF.ArgumentSeparator = options.Opts
+	return nil
+}
+
+// directiveSecArgumentsLimit sets the maximum number of arguments parsed
+// from the query string and from the request body, the excess sets
+// URLENCODED_ERROR or REQBODY_ERROR: SecArgumentsLimit 1000
+func directiveSecArgumentsLimit(options *DirectiveOptions) error {
+	limit, err := strconv.Atoi(options.Opts)
+	if err != nil || limit < 0 {
+		return fmt.Errorf("invalid arguments limit %q", options.Opts)
+	}
+	options.WAF.ArgumentLimits.Count = limit
+	return nil
+}
+
+// directiveSecArgumentNameLengthLimit sets the maximum length in bytes of
+// the argument names: SecArgumentNameLengthLimit 256
+func directiveSecArgumentNameLengthLimit(options *DirectiveOptions) error {
+	limit, err := strconv.Atoi(options.Opts)
+	if err != nil || limit < 0 {
+		return fmt.Errorf("invalid argument name length limit %q", options.Opts)
+	}
+	options.WAF.ArgumentLimits.NameLength = limit
+	return nil
+}
+
+// directiveSecArgumentValueLengthLimit sets the maximum length in bytes of
+// the argument values: SecArgumentValueLengthLimit 65536
+func directiveSecArgumentValueLengthLimit(options *DirectiveOptions) error {
+	limit, err := strconv.Atoi(options.Opts)
+	if err != nil || limit < 0 {
+		return fmt.Errorf("invalid argument value length limit %q", options.Opts)
+	}
+	options.WAF.ArgumentLimits.ValueLength = limit
+	return nil
+}
+
+// directiveSecArgumentsLimitAction selects whether the transactions whose
+// arguments exceed the limits are rejected or processed with the
+// arguments parsed before the limit: SecArgumentsLimitAction Reject
+func directiveSecArgumentsLimitAction(options *DirectiveOptions) error {
+	action, err := types.ParseRequestBodyLimitAction(options.Opts)
+	if err != nil {
+		return fmt.Errorf("invalid arguments limit action %q", options.Opts)
+	}
+	options.WAF.ArgumentsLimitAction = action
+	return nil
+}
+
+// directiveSecTransactionMemoryLimit sets the approximate memory in bytes
+// the request and response data of a transaction can use, values exceeding
+// it are discarded and MEMORY_LIMIT_EXCEEDED is set: SecTransactionMemoryLimit 1048576
+func directiveSecTransactionMemoryLimit(options *DirectiveOptions) error {
+	limit, err := strconv.ParseInt(options.Opts, 10, 64)
+	if err != nil || limit < 0 {
+		return fmt.Errorf("invalid transaction memory limit %q", options.Opts)
+	}
+	options.WAF.TransactionMemoryLimit = limit
+	return nil
+}
+
+// directiveSecRulePerfTime enables timing each rule, rules whose cumulative
+// evaluation time reaches the threshold in microseconds are reported in
+// PERF_RULES: SecRulePerfTime 1000
+func directiveSecRulePerfTime(options *DirectiveOptions) error {
+	us, err := strconv.Atoi(options.Opts)
+	if err != nil || us < 0 {
+		return fmt.Errorf("invalid rule performance threshold %q", options.Opts)
+	}
+	options.WAF.RulePerfTime = time.Duration(us) * time.Microsecond
+	return nil
+}
+
 func directiveSecRequestBodyInMemoryLimit(options *DirectiveOptions) error {
-	options.WAF.RequestBodyInMemoryLimit, _ = strconv.ParseInt(options.Opts, 10, 64)
+	limit, _ := strconv.ParseInt(options.Opts, 10, 64)
+	options.WAF.SetRequestBodyInMemoryLimit(limit)
 	return nil
 }
 
@@ -229,32 +773,288 @@ func directiveSecGsbLookupDb(options *DirectiveOptions) error {
 }
 
 func directiveSecHashMethodPm(options *DirectiveOptions) error {
+	t, data, ok := strings.Cut(options.Opts, " ")
+	if !ok {
+		return errors.New("syntax error: SecHashMethodPm [HashHref/HashFormAction/...] \"word1 word2\"")
+	}
+	mt, err := corazawaf.ParseHashMethodType(t)
+	if err != nil {
+		return newDirectiveError(err, "SecHashMethodPm")
+	}
+	words := strings.Fields(strings.Trim(strings.TrimSpace(data), `"`))
+	if len(words) == 0 {
+		return newDirectiveError(errors.New("empty word list"), "SecHashMethodPm")
+	}
+	options.WAF.HashMethods = append(options.WAF.HashMethods, corazawaf.HashMethod{
+		Type:  mt,
+		Words: words,
+	})
 	return nil
 }
 
 func directiveSecHashMethodRx(options *DirectiveOptions) error {
+	t, data, ok := strings.Cut(options.Opts, " ")
+	if !ok {
+		return errors.New("syntax error: SecHashMethodRx [HashHref/HashFormAction/...] \"regex\"")
+	}
+	mt, err := corazawaf.ParseHashMethodType(t)
+	if err != nil {
+		return newDirectiveError(err, "SecHashMethodRx")
+	}
+	re, err := regexp.Compile(strings.Trim(strings.TrimSpace(data), `"`))
+	if err != nil {
+		return newDirectiveError(err, "SecHashMethodRx")
+	}
+	options.WAF.HashMethods = append(options.WAF.HashMethods, corazawaf.HashMethod{
+		Type: mt,
+		Rx:   re,
+	})
 	return nil
 }
 
 func directiveSecHashParam(options *DirectiveOptions) error {
+	if len(options.Opts) == 0 {
+		return errors.New("syntax error: SecHashParam name")
+	}
+	options.WAF.HashParam = options.Opts
 	return nil
 }
 
 func directiveSecHashKey(options *DirectiveOptions) error {
+	key, mode, _ := strings.Cut(options.Opts, " ")
+	key = strings.Trim(key, `"`)
+	if key == "" {
+		return errors.New("syntax error: SecHashKey [rand/key] [KeyOnly/SessionID/RemoteIP]")
+	}
+	km, err := corazawaf.ParseHashKeyMode(strings.TrimSpace(mode))
+	if err != nil {
+		return newDirectiveError(err, "SecHashKey")
+	}
+	hashKey := []byte(key)
+	if strings.ToLower(key) == "rand" {
+		if hashKey, err = randomKey(); err != nil {
+			return newDirectiveError(err, "SecHashKey")
+		}
+	}
+	options.WAF.HashKey = hashKey
+	options.WAF.HashKeyMode = km
 	return nil
 }
 
 func directiveSecHashEngine(options *DirectiveOptions) error {
+	b, err := parseBoolean(options.Opts)
+	if err != nil {
+		return newDirectiveError(err, "SecHashEngine")
+	}
+	if b && len(options.WAF.HashKey) == 0 {
+		if options.WAF.HashKey, err = randomKey(); err != nil {
+			return newDirectiveError(err, "SecHashEngine")
+		}
+	}
+	options.WAF.HashEngine = b
+	return nil
+}
+
+// directiveSecSignedCookies signs the cookies set by the responses with a
+// companion cookie named like SESSIONID.sig and verifies them in the
+// requests, a random key is generated if SecCookieSignKey is not set:
+// SecSignedCookies PHPSESSID JSESSIONID
+func directiveSecSignedCookies(options *DirectiveOptions) error {
+	names := strings.Fields(options.Opts)
+	if len(names) == 0 {
+		return errors.New("syntax error: SecSignedCookies name [name ...]")
+	}
+	if len(options.WAF.CookieSignKey) == 0 {
+		key, err := randomKey()
+		if err != nil {
+			return newDirectiveError(err, "SecSignedCookies")
+		}
+		options.WAF.CookieSignKey = key
+	}
+	options.WAF.SignedCookies = append(options.WAF.SignedCookies, names...)
+	return nil
+}
+
+// directiveSecCookieSignKey sets the key signing the cookies, RemoteIP
+// binds the signatures to the client address: SecCookieSignKey rand RemoteIP
+func directiveSecCookieSignKey(options *DirectiveOptions) error {
+	key, mode, _ := strings.Cut(options.Opts, " ")
+	key = strings.Trim(key, `"`)
+	if key == "" {
+		return errors.New("syntax error: SecCookieSignKey [rand/key] [KeyOnly/RemoteIP]")
+	}
+	km, err := corazawaf.ParseHashKeyMode(strings.TrimSpace(mode))
+	if err != nil || km == corazawaf.HashKeySessionID {
+		return fmt.Errorf("invalid cookie sign key mode %q", strings.TrimSpace(mode))
+	}
+	signKey := []byte(key)
+	if strings.ToLower(key) == "rand" {
+		if signKey, err = randomKey(); err != nil {
+			return newDirectiveError(err, "SecCookieSignKey")
+		}
+	}
+	options.WAF.CookieSignKey = signKey
+	options.WAF.CookieSignKeyMode = km
+	return nil
+}
+
+// directiveSecCookieSignMaxAge sets the number of seconds a cookie
+// signature is valid since the response issued it, older signatures are
+// reported as tampered: SecCookieSignMaxAge 3600
+func directiveSecCookieSignMaxAge(options *DirectiveOptions) error {
+	secs, err := strconv.Atoi(options.Opts)
+	if err != nil || secs < 0 {
+		return fmt.Errorf("invalid cookie signature max age %q", options.Opts)
+	}
+	options.WAF.CookieSignMaxAge = time.Duration(secs) * time.Second
+	return nil
+}
+
+// directiveSecCSRFProtection requires the CSRF token of the session in
+// the state changing requests, the failures are set in CSRF_ERROR. The
+// tokens are injected in the html responses if SecContentInjection is On,
+// a random key is generated if SecCSRFKey is not set: SecCSRFProtection On
+func directiveSecCSRFProtection(options *DirectiveOptions) error {
+	b, err := parseBoolean(options.Opts)
+	if err != nil {
+		return newDirectiveError(err, "SecCSRFProtection")
+	}
+	if b && len(options.WAF.CSRFKey) == 0 {
+		if options.WAF.CSRFKey, err = randomKey(); err != nil {
+			return newDirectiveError(err, "SecCSRFProtection")
+		}
+	}
+	options.WAF.CSRFProtection = b
+	return nil
+}
+
+// directiveSecCSRFKey sets the key deriving the CSRF tokens, it must be
+// shared by the instances serving the same sessions: SecCSRFKey my_secret
+func directiveSecCSRFKey(options *DirectiveOptions) error {
+	key := strings.Trim(options.Opts, `"`)
+	if key == "" {
+		return errors.New("syntax error: SecCSRFKey key")
+	}
+	options.WAF.CSRFKey = []byte(key)
+	return nil
+}
+
+// directiveSecCSRFParam sets the name of the form field storing the CSRF
+// tokens, csrf_token by default: SecCSRFParam authenticity_token
+func directiveSecCSRFParam(options *DirectiveOptions) error {
+	if len(options.Opts) == 0 {
+		return errors.New("syntax error: SecCSRFParam name")
+	}
+	options.WAF.CSRFParam = options.Opts
+	return nil
+}
+
+// directiveSecCSRFExempt adds path prefixes not requiring a CSRF token,
+// like webhooks: SecCSRFExempt /hooks/ /api/
+func directiveSecCSRFExempt(options *DirectiveOptions) error {
+	prefixes := strings.Fields(options.Opts)
+	if len(prefixes) == 0 {
+		return errors.New("syntax error: SecCSRFExempt /path [/path ...]")
+	}
+	options.WAF.CSRFExempt = append(options.WAF.CSRFExempt, prefixes...)
+	return nil
+}
+
+// directiveSecHoneypotField adds decoy fields injected in the html forms
+// if SecContentInjection is On, a value submitted for them is set in
+// HONEYPOT_FIELDS: SecHoneypotField website fax_number
+func directiveSecHoneypotField(options *DirectiveOptions) error {
+	names := strings.Fields(options.Opts)
+	if len(names) == 0 {
+		return errors.New("syntax error: SecHoneypotField name [name ...]")
+	}
+	options.WAF.HoneypotFields = append(options.WAF.HoneypotFields, names...)
 	return nil
 }
 
+// directiveSecHoneypotPath adds trap paths linked from hidden elements of
+// the html responses if SecContentInjection is On, a request for them
+// sets HONEYPOT_PATH: SecHoneypotPath /wp-admin/backup.php
+func directiveSecHoneypotPath(options *DirectiveOptions) error {
+	paths := strings.Fields(options.Opts)
+	if len(paths) == 0 {
+		return errors.New("syntax error: SecHoneypotPath /path [/path ...]")
+	}
+	for _, p := range paths {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("invalid honeypot path %q, expected an absolute path", p)
+		}
+	}
+	options.WAF.HoneypotPaths = append(options.WAF.HoneypotPaths, paths...)
+	return nil
+}
+
+// directiveSecSeverityBlock denies the requests matched by the non
+// disruptive rules at least as severe as the severity, with the status
+// or 403. Off disables it: SecSeverityBlock CRITICAL 403
+func directiveSecSeverityBlock(options *DirectiveOptions) error {
+	fields := strings.Fields(options.Opts)
+	if len(fields) == 0 || len(fields) > 2 {
+		return errors.New("syntax error: SecSeverityBlock SEVERITY|Off [status]")
+	}
+	if strings.EqualFold(fields[0], "off") {
+		if len(fields) > 1 {
+			return errors.New("syntax error: SecSeverityBlock Off takes no status")
+		}
+		options.WAF.BlockSeverityStatus = 0
+		return nil
+	}
+	severity, err := types.ParseRuleSeverity(fields[0])
+	if err != nil {
+		return err
+	}
+	status := 403
+	if len(fields) == 2 {
+		if status, err = strconv.Atoi(fields[1]); err != nil || status < 100 || status > 599 {
+			return fmt.Errorf("invalid status %q", fields[1])
+		}
+	}
+	options.WAF.BlockSeverity = severity
+	options.WAF.BlockSeverityStatus = status
+	return nil
+}
+
+// directiveSecDefaultAction sets the default actions of the rules of a
+// phase, a new declaration replaces the previous one of the same phase
+// only: SecDefaultAction "phase:2,log,auditlog,deny,status:403"
 func directiveSecDefaultAction(options *DirectiveOptions) error {
-	da, _ := options.Config.Get("rule_default_actions", []string{}).([]string)
+	phase, err := defaultActionsPhase(options.Opts)
+	if err != nil {
+		return newDirectiveError(err, "SecDefaultAction")
+	}
+	current := options.Config.Get("rule_default_actions", []string{}).([]string)
+	// the slice is copied as it may be restored at the end of a file
+	da := make([]string, 0, len(current)+1)
+	for _, actions := range current {
+		if p, _ := defaultActionsPhase(actions); p != phase {
+			da = append(da, actions)
+		}
+	}
 	da = append(da, options.Opts)
 	options.Config.Set("rule_default_actions", da)
 	return nil
 }
 
+// directiveSecDefaultActionScope selects whether the default actions
+// declared in a file are kept after it, Global, or restored once the file
+// is parsed, File. Included files always inherit the current defaults: SecDefaultActionScope File
+func directiveSecDefaultActionScope(options *DirectiveOptions) error {
+	switch strings.ToLower(options.Opts) {
+	case "global":
+		options.Config.Set("rule_default_actions_file_scope", false)
+	case "file":
+		options.Config.Set("rule_default_actions_file_scope", true)
+	default:
+		return fmt.Errorf("invalid default action scope %q", options.Opts)
+	}
+	return nil
+}
+
 func directiveSecContentInjection(options *DirectiveOptions) error {
 	b, err := parseBoolean(options.Opts)
 	if err != nil {
@@ -264,21 +1064,57 @@ func directiveSecContentInjection(options *DirectiveOptions) error {
 	return nil
 }
 
+// directiveSecConnEngine tracks the transactions of the client addresses
+// and sets the CONN_* variables, the clients exceeding the limits are
+// interrupted with status 429 if it is On, even under SecRuleEngine
+// DetectionOnly: SecConnEngine DetectionOnly
 func directiveSecConnEngine(options *DirectiveOptions) error {
-	/*
-		switch opts{
-		case "On":
-			w.ConnEngine = engine.CONN_ENGINE_ON
-			break
-		case "Off":
-			w.ConnEngine = engine.CONN_ENGINE_OFF
-			break
-		case "DetectOnly":
-			w.ConnEngine = engine.CONN_ENGINE_DETECTONLY
-			break
+	engine, err := types.ParseConnectionEngineStatus(options.Opts)
+	if err != nil {
+		return err
+	}
+	options.WAF.ConnectionEngine = engine
+	return nil
+}
+
+// directiveSecConnConcurrentLimit is the number of transactions of a
+// client address processed at once, 0 is unlimited:
+// SecConnConcurrentLimit 50
+func directiveSecConnConcurrentLimit(options *DirectiveOptions) error {
+	limit, err := strconv.Atoi(options.Opts)
+	if err != nil || limit < 0 {
+		return fmt.Errorf("invalid concurrent connection limit %q", options.Opts)
+	}
+	options.WAF.ConnectionLimit = limit
+	return nil
+}
+
+// directiveSecConnRateLimit is the number of transactions a client
+// address can start within a window, a window without unit is expressed
+// in seconds: SecConnRateLimit 600/60s
+func directiveSecConnRateLimit(options *DirectiveOptions) error {
+	t, w, ok := strings.Cut(options.Opts, "/")
+	if !ok {
+		return fmt.Errorf("invalid connection rate limit %q, expected threshold/window", options.Opts)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(t))
+	if err != nil || limit < 0 {
+		return fmt.Errorf("invalid connection rate limit threshold %q", t)
+	}
+	w = strings.TrimSpace(w)
+	window, err := time.ParseDuration(w)
+	if err != nil {
+		secs, serr := strconv.Atoi(w)
+		if serr != nil {
+			return fmt.Errorf("invalid connection rate limit window %q", w)
 		}
-		break
-	*/
+		window = time.Duration(secs) * time.Second
+	}
+	if window <= 0 {
+		return fmt.Errorf("invalid connection rate limit window %q", w)
+	}
+	options.WAF.ConnectionRateLimit = limit
+	options.WAF.ConnectionRateWindow = window
 	return nil
 }
 
@@ -306,6 +1142,9 @@ func directiveSecAuditLogType(options *DirectiveOptions) error {
 	if err != nil {
 		return err
 	}
+	if options.Config.Get("auditlog_async", false).(bool) {
+		writer = newAsyncAuditLogWriter(options, writer)
+	}
 	if err := writer.Init(options.Config); err != nil {
 		return err
 	}
@@ -313,6 +1152,148 @@ func directiveSecAuditLogType(options *DirectiveOptions) error {
 	return nil
 }
 
+// directiveSecAuditLogSyslogCA loads the PEM encoded certificates trusted
+// by the syslog writer to verify the collector: SecAuditLogSyslogCA /etc/coraza/siem-ca.pem
+func directiveSecAuditLogSyslogCA(options *DirectiveOptions) error {
+	path := strings.TrimSpace(options.Opts)
+	if path == "" {
+		return errors.New("syntax error: SecAuditLogSyslogCA /path/to/ca.pem")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(options.Config.Get("parser_config_dir", "").(string), path)
+	}
+	root := options.Config.Get("parser_root", ioutils.OSFS{}).(fs.FS)
+	ca, err := fs.ReadFile(root, path)
+	if err != nil {
+		return newDirectiveError(err, "SecAuditLogSyslogCA")
+	}
+	options.Config.Set("auditlog_syslog_ca", ca)
+	return options.WAF.AuditLogWriter.Init(options.Config)
+}
+
+// directiveSecAuditLogAsync writes the audit logs from a pool of
+// background workers instead of the transaction: SecAuditLogAsync On
+func directiveSecAuditLogAsync(options *DirectiveOptions) error {
+	b, err := parseBoolean(options.Opts)
+	if err != nil {
+		return newDirectiveError(err, "SecAuditLogAsync")
+	}
+	options.Config.Set("auditlog_async", b)
+	aw, isAsync := options.WAF.AuditLogWriter.(*loggers.AsyncWriter)
+	switch {
+	case b && !isAsync:
+		writer := newAsyncAuditLogWriter(options, options.WAF.AuditLogWriter)
+		if err := writer.Init(options.Config); err != nil {
+			return err
+		}
+		options.WAF.AuditLogWriter = writer
+	case !b && isAsync:
+		options.WAF.AuditLogWriter = aw.Unwrap()
+	}
+	return nil
+}
+
+// directiveSecAuditLogAsyncQueueSize sets the number of audit logs
+// waiting to be written: SecAuditLogAsyncQueueSize 1024
+func directiveSecAuditLogAsyncQueueSize(options *DirectiveOptions) error {
+	n, err := strconv.Atoi(options.Opts)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("invalid audit log queue size %q", options.Opts)
+	}
+	options.Config.Set("auditlog_async_queue_size", n)
+	return options.WAF.AuditLogWriter.Init(options.Config)
+}
+
+// directiveSecAuditLogAsyncWorkers sets the number of workers writing
+// the audit logs: SecAuditLogAsyncWorkers 2
+func directiveSecAuditLogAsyncWorkers(options *DirectiveOptions) error {
+	n, err := strconv.Atoi(options.Opts)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("invalid audit log workers %q", options.Opts)
+	}
+	options.Config.Set("auditlog_async_workers", n)
+	return options.WAF.AuditLogWriter.Init(options.Config)
+}
+
+// directiveSecAuditLogAsyncOverflow selects what happens when the audit
+// log queue is full, Block, Drop_Oldest or Drop_Newest: SecAuditLogAsyncOverflow Drop_Oldest
+func directiveSecAuditLogAsyncOverflow(options *DirectiveOptions) error {
+	policy, err := types.ParseAuditLogOverflowPolicy(options.Opts)
+	if err != nil {
+		return err
+	}
+	options.Config.Set("auditlog_async_overflow", policy)
+	return options.WAF.AuditLogWriter.Init(options.Config)
+}
+
+// directiveSecAuditLogMaxSize rotates the serial audit log once it
+// reaches a size in bytes, K, M and G suffixes are accepted: SecAuditLogMaxSize 100M
+func directiveSecAuditLogMaxSize(options *DirectiveOptions) error {
+	size, err := parseSize(options.Opts)
+	if err != nil || size <= 0 {
+		return fmt.Errorf("invalid audit log max size %q", options.Opts)
+	}
+	options.Config.Set("auditlog_rotate_max_size", size)
+	return options.WAF.AuditLogWriter.Init(options.Config)
+}
+
+// directiveSecAuditLogRotateInterval rotates the serial audit log after
+// a period of time: SecAuditLogRotateInterval 24h
+func directiveSecAuditLogRotateInterval(options *DirectiveOptions) error {
+	d, err := time.ParseDuration(options.Opts)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("invalid audit log rotate interval %q", options.Opts)
+	}
+	options.Config.Set("auditlog_rotate_interval", d)
+	return options.WAF.AuditLogWriter.Init(options.Config)
+}
+
+// directiveSecAuditLogMaxBackups sets the number of rotated audit logs
+// kept: SecAuditLogMaxBackups 10
+func directiveSecAuditLogMaxBackups(options *DirectiveOptions) error {
+	n, err := strconv.Atoi(options.Opts)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid audit log max backups %q", options.Opts)
+	}
+	options.Config.Set("auditlog_rotate_max_backups", n)
+	return options.WAF.AuditLogWriter.Init(options.Config)
+}
+
+// directiveSecAuditLogMaxAge removes the rotated audit logs older than a
+// number of days or a duration: SecAuditLogMaxAge 30
+func directiveSecAuditLogMaxAge(options *DirectiveOptions) error {
+	d, err := time.ParseDuration(options.Opts)
+	if err != nil {
+		days, derr := strconv.Atoi(options.Opts)
+		if derr != nil {
+			return fmt.Errorf("invalid audit log max age %q", options.Opts)
+		}
+		d = time.Duration(days) * 24 * time.Hour
+	}
+	if d < 0 {
+		return fmt.Errorf("invalid audit log max age %q", options.Opts)
+	}
+	options.Config.Set("auditlog_rotate_max_age", d)
+	return options.WAF.AuditLogWriter.Init(options.Config)
+}
+
+// directiveSecAuditLogCompress gzips the rotated audit logs: SecAuditLogCompress On
+func directiveSecAuditLogCompress(options *DirectiveOptions) error {
+	b, err := parseBoolean(options.Opts)
+	if err != nil {
+		return newDirectiveError(err, "SecAuditLogCompress")
+	}
+	options.Config.Set("auditlog_rotate_compress", b)
+	return options.WAF.AuditLogWriter.Init(options.Config)
+}
+
+func newAsyncAuditLogWriter(options *DirectiveOptions, writer loggers.LogWriter) *loggers.AsyncWriter {
+	waf := options.WAF
+	return loggers.NewAsyncWriter(writer, func(err error) {
+		waf.Logger.Error("failed to write audit log: %s", err.Error())
+	})
+}
+
 func directiveSecAuditLogFormat(options *DirectiveOptions) error {
 	if len(options.Opts) == 0 {
 		return errors.New("syntax error: SecAuditLogFormat [json/native/...]")
@@ -376,7 +1357,11 @@ func directiveSecAuditLogRelevantStatus(options *DirectiveOptions) error {
 }
 
 func directiveSecAuditLogParts(options *DirectiveOptions) error {
-	options.WAF.AuditLogParts = types.AuditLogParts(options.Opts)
+	parts, err := types.ParseAuditLogParts(options.Opts)
+	if err != nil {
+		return err
+	}
+	options.WAF.AuditLogParts = parts
 	return nil
 }
 
@@ -446,7 +1431,7 @@ func directiveSecRuleUpdateTargetByID(options *DirectiveOptions) error {
 	if err != nil {
 		return err
 	}
-	rule := options.WAF.Rules.FindByID(id)
+	rule := options.WAF.Rules.FindByIDForUpdate(id)
 	rp := &RuleParser{
 		rule:           rule,
 		options:        RuleOptions{},
@@ -490,11 +1475,25 @@ func directiveSecDataset(options *DirectiveOptions) error {
 }
 
 func newCompileRuleError(err error, opts string) error {
-	return fmt.Errorf("failed to compile rule (%s): %s", err, opts)
+	return fmt.Errorf("failed to compile rule (%w): %s", err, opts)
 }
 
 func newDirectiveError(err error, directive string) error {
-	return fmt.Errorf("syntax error for directive %s: %s", directive, err)
+	return fmt.Errorf("syntax error for directive %s: %w", directive, err)
+}
+
+// randomKeySize is the size of the generated signing keys, like the
+// output of SHA-256
+const randomKeySize = 32
+
+// randomKey returns a key for the HMAC signatures from crypto/rand, the
+// keys must not be predictable from the start time of the process
+func randomKey() ([]byte, error) {
+	key := make([]byte, randomKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate a random key: %w", err)
+	}
+	return key, nil
 }
 
 func parseBoolean(data string) (bool, error) {
@@ -509,6 +1508,28 @@ func parseBoolean(data string) (bool, error) {
 	}
 }
 
+// parseSize parses a size in bytes with an optional K, M or G suffix
+func parseSize(data string) (int64, error) {
+	data = strings.ToUpper(strings.TrimSpace(data))
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(data, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(data, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(data, "G"):
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		data = data[:len(data)-1]
+	}
+	n, err := strconv.ParseInt(data, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * mult, nil
+}
+
 var (
 	_ directive = directiveSecAction
 	_ directive = directiveSecAuditEngine
@@ -520,6 +1541,7 @@ var (
 	_ directive = directiveSecContentInjection
 	_ directive = directiveSecDataDir
 	_ directive = directiveSecDefaultAction
+	_ directive = directiveSecDefaultActionScope
 	_ directive = directiveSecDebugLog
 	_ directive = directiveSecDebugLogLevel
 	_ directive = directiveSecHashEngine
@@ -535,73 +1557,129 @@ var (
 )
 
 var directivesMap = map[string]directive{
-	"secwebappid":                    directiveSecWebAppID,
-	"secuploadkeepfiles":             directiveSecUploadKeepFiles,
-	"secuploadfilemode":              directiveSecUploadFileMode,
-	"secuploadfilelimit":             directiveSecUploadFileLimit,
-	"secuploaddir":                   directiveSecUploadDir,
-	"sectmpdir":                      directiveSecTmpDir,
-	"secserversignature":             directiveSecServerSignature,
-	"secsensorid":                    directiveSecSensorID,
-	"secruleremovebytag":             directiveSecRuleRemoveByTag,
-	"secruleremovebymsg":             directiveSecRuleRemoveByMsg,
-	"secruleremovebyid":              directiveSecRuleRemoveByID,
-	"secruleengine":                  directiveSecRuleEngine,
-	"secrule":                        directiveSecRule,
-	"secresponsebodymimetypesclear":  directiveSecResponseBodyMimeTypesClear,
-	"secresponsebodymimetype":        directiveSecResponseBodyMimeType,
-	"secresponsebodylimitaction":     directiveSecResponseBodyLimitAction,
-	"secresponsebodylimit":           directiveSecResponseBodyLimit,
-	"secresponsebodyaccess":          directiveSecResponseBodyAccess,
-	"secrequestbodynofileslimit":     directiveSecRequestBodyNoFilesLimit,
-	"secrequestbodylimitaction":      directiveSecRequestBodyLimitAction,
-	"secrequestbodylimit":            directiveSecRequestBodyLimit,
-	"secrequestbodyinmemorylimit":    directiveSecRequestBodyInMemoryLimit,
-	"secrequestbodyaccess":           directiveSecRequestBodyAccess,
-	"secremoterulesfailaction":       directiveSecRemoteRulesFailAction,
-	"secremoterules":                 directiveSecRemoteRules,
-	"secpcrematchlimitrecursion":     directiveSecPcreMatchLimitRecursion,
-	"secpcrematchlimit":              directiveSecPcreMatchLimit,
-	"secmarker":                      directiveSecMarker,
-	"sechttpblkey":                   directiveSecHTTPBlKey,
-	"sechashparam":                   directiveSecHashParam,
-	"sechashmethodrx":                directiveSecHashMethodRx,
-	"sechashmethodpm":                directiveSecHashMethodPm,
-	"sechashkey":                     directiveSecHashKey,
-	"sechashengine":                  directiveSecHashEngine,
-	"secgsblookupdb":                 directiveSecGsbLookupDb,
-	"secdefaultaction":               directiveSecDefaultAction,
-	"secdatadir":                     directiveSecDataDir,
-	"seccontentinjection":            directiveSecContentInjection,
-	"secconnwritestatelimit":         directiveSecConnWriteStateLimit,
-	"secconnreadstatelimit":          directiveSecConnReadStateLimit,
-	"secconnengine":                  directiveSecConnEngine,
-	"seccomponentsignature":          directiveSecComponentSignature,
-	"seccollectiontimeout":           directiveSecCollectionTimeout,
-	"secauditlogrelevantstatus":      directiveSecAuditLogRelevantStatus,
-	"secauditlogparts":               directiveSecAuditLogParts,
-	"secauditlogdir":                 directiveSecAuditLogDir,
-	"secauditlogstoragedir":          directiveSecAuditLogDir,
-	"secauditlog":                    directiveSecAuditLog,
-	"secauditengine":                 directiveSecAuditEngine,
-	"secaction":                      directiveSecAction,
-	"secdebuglog":                    directiveSecDebugLog,
-	"secdebugloglevel":               directiveSecDebugLogLevel,
-	"secauditlogformat":              directiveSecAuditLogFormat,
-	"secauditlogtype":                directiveSecAuditLogType,
-	"secauditlogfilemode":            directiveSecAuditLogFileMode,
-	"secauditlogdirmode":             directiveSecAuditLogDirMode,
-	"secignorerulecompilationerrors": directiveSecIgnoreRuleCompilationErrors,
-	"secdataset":                     directiveSecDataset,
+	"secwebappid":                       directiveSecWebAppID,
+	"secuploadkeepfiles":                directiveSecUploadKeepFiles,
+	"secuploadfilemode":                 directiveSecUploadFileMode,
+	"secuploadfilelimit":                directiveSecUploadFileLimit,
+	"secuploaddir":                      directiveSecUploadDir,
+	"sectmpdir":                         directiveSecTmpDir,
+	"secserversignature":                directiveSecServerSignature,
+	"secserversignaturemode":            directiveSecServerSignatureMode,
+	"secsensorid":                       directiveSecSensorID,
+	"secruleremovebytag":                directiveSecRuleRemoveByTag,
+	"secruleremovebymsg":                directiveSecRuleRemoveByMsg,
+	"secruleremovebyid":                 directiveSecRuleRemoveByID,
+	"secruleenginesampling":             directiveSecRuleEngineSampling,
+	"seccachetransformations":           directiveSecCacheTransformations,
+	"secregexengine":                    directiveSecRegexEngine,
+	"secunicodemapfile":                 directiveSecUnicodeMapFile,
+	"secruleengine":                     directiveSecRuleEngine,
+	"secrule":                           directiveSecRule,
+	"secresponsebodymimetypesclear":     directiveSecResponseBodyMimeTypesClear,
+	"secresponsebodymimetype":           directiveSecResponseBodyMimeType,
+	"secresponsebodylimitaction":        directiveSecResponseBodyLimitAction,
+	"secresponsebodylimit":              directiveSecResponseBodyLimit,
+	"secresponsebodyaccess":             directiveSecResponseBodyAccess,
+	"secrequestbodynofileslimit":        directiveSecRequestBodyNoFilesLimit,
+	"secrequestbodylimitaction":         directiveSecRequestBodyLimitAction,
+	"secrequestbodylimit":               directiveSecRequestBodyLimit,
+	"secrequestbodyinmemorylimit":       directiveSecRequestBodyInMemoryLimit,
+	"secrequestbodyaccess":              directiveSecRequestBodyAccess,
+	"secremoterulesfailaction":          directiveSecRemoteRulesFailAction,
+	"secremoterules":                    directiveSecRemoteRules,
+	"secpcrematchlimitrecursion":        directiveSecPcreMatchLimitRecursion,
+	"secpcrematchlimit":                 directiveSecPcreMatchLimit,
+	"secpauselimit":                     directiveSecPauseLimit,
+	"secruleperftime":                   directiveSecRulePerfTime,
+	"secrequestbodycharsetdecoding":     directiveSecRequestBodyCharsetDecoding,
+	"secstreaminbodyinspection":         directiveSecStreamInBodyInspection,
+	"secrequestbodydecompression":       directiveSecRequestBodyDecompression,
+	"secrequestbodyprocessor":           directiveSecRequestBodyProcessor,
+	"secrequestbodylineslimit":          directiveSecRequestBodyLinesLimit,
+	"secrequestbodyxmldepthlimit":       directiveSecRequestBodyXMLDepthLimit,
+	"secrequestbodyxmlelementslimit":    directiveSecRequestBodyXMLElementsLimit,
+	"secopenapispec":                    directiveSecOpenAPISpec,
+	"secopenapiaction":                  directiveSecOpenAPIAction,
+	"secprofilefile":                    directiveSecProfileFile,
+	"secprofilemode":                    directiveSecProfileMode,
+	"secrequestbodyprocessorsniffing":   directiveSecRequestBodyProcessorSniffing,
+	"secrequestbodymethodprocessor":     directiveSecRequestBodyMethodProcessor,
+	"secrequestbodydecompressionratio":  directiveSecRequestBodyDecompressionRatio,
+	"secresponsebodydecompression":      directiveSecResponseBodyDecompression,
+	"secresponsebodydecompressionratio": directiveSecResponseBodyDecompressionRatio,
+	"secstreamoutbodyinspection":        directiveSecStreamOutBodyInspection,
+	"seccookieformat":                   directiveSecCookieFormat,
+	"secargumentseparator":              directiveSecArgumentSeparator,
+	"secargumentslimit":                 directiveSecArgumentsLimit,
+	"secargumentnamelengthlimit":        directiveSecArgumentNameLengthLimit,
+	"secargumentvaluelengthlimit":       directiveSecArgumentValueLengthLimit,
+	"secargumentslimitaction":           directiveSecArgumentsLimitAction,
+	"sectransactionmemorylimit":         directiveSecTransactionMemoryLimit,
+	"seccookiev0separator":              directiveSecCookieV0Separator,
+	"secmarker":                         directiveSecMarker,
+	"sechttpblkey":                      directiveSecHTTPBlKey,
+	"sechashparam":                      directiveSecHashParam,
+	"sechashmethodrx":                   directiveSecHashMethodRx,
+	"sechashmethodpm":                   directiveSecHashMethodPm,
+	"sechashkey":                        directiveSecHashKey,
+	"sechashengine":                     directiveSecHashEngine,
+	"secsignedcookies":                  directiveSecSignedCookies,
+	"seccookiesignkey":                  directiveSecCookieSignKey,
+	"seccookiesignmaxage":               directiveSecCookieSignMaxAge,
+	"seccsrfprotection":                 directiveSecCSRFProtection,
+	"seccsrfkey":                        directiveSecCSRFKey,
+	"seccsrfparam":                      directiveSecCSRFParam,
+	"seccsrfexempt":                     directiveSecCSRFExempt,
+	"sechoneypotfield":                  directiveSecHoneypotField,
+	"sechoneypotpath":                   directiveSecHoneypotPath,
+	"secseverityblock":                  directiveSecSeverityBlock,
+	"sectransactionpool":                directiveSecTransactionPool,
+	"sectransactionpoolmaxbuffersize":   directiveSecTransactionPoolMaxBufferSize,
+	"sectransactionarena":               directiveSecTransactionArena,
+	"secparallelruleworkers":            directiveSecParallelRuleWorkers,
+	"secgsblookupdb":                    directiveSecGsbLookupDb,
+	"secdefaultaction":                  directiveSecDefaultAction,
+	"secdefaultactionscope":             directiveSecDefaultActionScope,
+	"secdatadir":                        directiveSecDataDir,
+	"seccontentinjection":               directiveSecContentInjection,
+	"secconnwritestatelimit":            directiveSecConnWriteStateLimit,
+	"secconnreadstatelimit":             directiveSecConnReadStateLimit,
+	"secconnengine":                     directiveSecConnEngine,
+	"secconnconcurrentlimit":            directiveSecConnConcurrentLimit,
+	"secconnratelimit":                  directiveSecConnRateLimit,
+	"seccomponentsignature":             directiveSecComponentSignature,
+	"seccollectiontimeout":              directiveSecCollectionTimeout,
+	"secauditlogrelevantstatus":         directiveSecAuditLogRelevantStatus,
+	"secauditlogparts":                  directiveSecAuditLogParts,
+	"secauditlogdir":                    directiveSecAuditLogDir,
+	"secauditlogstoragedir":             directiveSecAuditLogDir,
+	"secauditlog":                       directiveSecAuditLog,
+	"secauditengine":                    directiveSecAuditEngine,
+	"secaction":                         directiveSecAction,
+	"secdebuglog":                       directiveSecDebugLog,
+	"secdebugloglevel":                  directiveSecDebugLogLevel,
+	"secauditlogformat":                 directiveSecAuditLogFormat,
+	"secauditlogtype":                   directiveSecAuditLogType,
+	"secauditlogfilemode":               directiveSecAuditLogFileMode,
+	"secauditlogdirmode":                directiveSecAuditLogDirMode,
+	"secauditlogsyslogca":               directiveSecAuditLogSyslogCA,
+	"secauditlogasync":                  directiveSecAuditLogAsync,
+	"secauditlogasyncqueuesize":         directiveSecAuditLogAsyncQueueSize,
+	"secauditlogasyncworkers":           directiveSecAuditLogAsyncWorkers,
+	"secauditlogasyncoverflow":          directiveSecAuditLogAsyncOverflow,
+	"secauditlogmaxsize":                directiveSecAuditLogMaxSize,
+	"secauditlogrotateinterval":         directiveSecAuditLogRotateInterval,
+	"secauditlogmaxbackups":             directiveSecAuditLogMaxBackups,
+	"secauditlogmaxage":                 directiveSecAuditLogMaxAge,
+	"secauditlogcompress":               directiveSecAuditLogCompress,
+	"secignorerulecompilationerrors":    directiveSecIgnoreRuleCompilationErrors,
+	"secdataset":                        directiveSecDataset,
 
 	// Unsupported Directives
-	"secargumentseparator":     directiveUnsupported,
-	"seccookieformat":          directiveUnsupported,
 	"secruleupdatetargetbytag": directiveUnsupported,
 	"secruleupdatetargetbymsg": directiveUnsupported,
 	"secruleupdatetargetbyid":  directiveSecRuleUpdateTargetByID,
 	"secruleupdateactionbyid":  directiveUnsupported,
 	"secrulescript":            directiveUnsupported,
-	"secruleperftime":          directiveUnsupported,
-	"SecUnicodeMap":            directiveUnsupported,
+	"secunicodemap":            directiveUnsupported,
 }
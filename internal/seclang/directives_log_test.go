@@ -1,10 +1,10 @@
 // Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
 // SPDX-License-Identifier: Apache-2.0
 
-// Logs are currently disabled for tinygo
+// Log files are disabled without filesystem access
 
-//go:build !tinygo
-// +build !tinygo
+//go:build !tinygo && !coraza.no_fs_access
+// +build !tinygo,!coraza.no_fs_access
 
 package seclang
 
@@ -67,6 +67,99 @@ func TestSecAuditLogDirectivesConcurrent(t *testing.T) {
 	}
 }
 
+func TestSecAuditLogAsync(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	auditpath := filepath.Join(t.TempDir(), "audit.log")
+	parser := NewParser(waf)
+	if err := parser.FromString(fmt.Sprintf(`
+	SecAuditLogAsync On
+	SecAuditLogAsyncQueueSize 10
+	SecAuditLogAsyncWorkers 2
+	SecAuditLogAsyncOverflow Drop_Oldest
+	SecAuditLog %s
+	SecAuditLogType serial
+	`, auditpath)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := waf.AuditLogWriter.(*loggers.AsyncWriter); !ok {
+		t.Fatalf("expected an asynchronous writer, got %T", waf.AuditLogWriter)
+	}
+	id := utils.RandomString(10)
+	if err := waf.AuditLogWriter.Write(&loggers.AuditLog{
+		Parts: types.AuditLogParts("ABZ"),
+		Transaction: loggers.AuditTransaction{
+			ID: id,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Close flushes the queue
+	if err := waf.AuditLogWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(auditpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), id) {
+		t.Error("failed to write audit log")
+	}
+
+	if err := parser.FromString("SecAuditLogAsync Off"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := waf.AuditLogWriter.(*loggers.AsyncWriter); ok {
+		t.Error("expected the writer to be synchronous")
+	}
+	for _, d := range []string{"SecAuditLogAsyncQueueSize 0", "SecAuditLogAsyncWorkers many", "SecAuditLogAsyncOverflow wait"} {
+		if err := parser.FromString(d); err == nil {
+			t.Errorf("expected an error for %q", d)
+		}
+	}
+}
+
+func TestSecAuditLogRotation(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	dir := t.TempDir()
+	parser := NewParser(waf)
+	if err := parser.FromString(fmt.Sprintf(`
+	SecAuditLogType serial
+	SecAuditLogMaxSize 1K
+	SecAuditLogRotateInterval 24h
+	SecAuditLogMaxBackups 1
+	SecAuditLogMaxAge 7
+	SecAuditLogCompress On
+	SecAuditLog %s
+	`, filepath.Join(dir, "audit.log"))); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := waf.AuditLogWriter.Write(&loggers.AuditLog{
+			Parts: types.AuditLogParts("ABZ"),
+			Transaction: loggers.AuditTransaction{
+				ID: strings.Repeat("a", 1000),
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := waf.AuditLogWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || !strings.HasSuffix(entries[0].Name(), ".log.gz") || entries[1].Name() != "audit.log" {
+		t.Errorf("expected the audit log and a compressed backup, got %v", entries)
+	}
+	for _, d := range []string{"SecAuditLogMaxSize 10X", "SecAuditLogRotateInterval daily", "SecAuditLogMaxBackups -1", "SecAuditLogMaxAge week", "SecAuditLogCompress yes"} {
+		if err := parser.FromString(d); err == nil {
+			t.Errorf("expected an error for %q", d)
+		}
+	}
+}
+
 func TestDebugDirectives(t *testing.T) {
 	waf := corazawaf.NewWAF()
 	tmp := filepath.Join(t.TempDir(), "tmp.log")
@@ -94,6 +187,66 @@ func TestDebugDirectives(t *testing.T) {
 	}
 }
 
+func TestDebugLogRuleTrace(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	tmp := filepath.Join(t.TempDir(), "debug.log")
+	p := NewParser(waf)
+	if err := p.FromString(fmt.Sprintf(`
+	SecDebugLog %s
+	SecDebugLogLevel 9
+	SecRule ARGS:id "@streq abc" "id:1,phase:1,t:lowercase,t:removeWhitespace,pass"
+	`, tmp)); err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.AddArgument(types.ArgumentGET, "id", " ABC ")
+	tx.ProcessRequestHeaders()
+	data, err := os.ReadFile(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`[TRACE] Variable ARGS_GET:id expanded to " ABC " tx_id=` + tx.ID() + " rule_id=1",
+		`[TRACE] Transformation lowercase: " abc "`,
+		`[TRACE] Transformation removeWhitespace: "abc"`,
+		`against "abc": MATCH`,
+	} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("expected debug log to contain %q, got %q", expected, data)
+		}
+	}
+
+	if err := p.FromString("SecDebugLogLevel 10"); err == nil {
+		t.Error("expected error for invalid debug log level")
+	}
+}
+
+func TestDebugLogLevels(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	tmp := filepath.Join(t.TempDir(), "debug.log")
+	p := NewParser(waf)
+	if err := p.FromString(fmt.Sprintf("SecDebugLog %s\nSecDebugLogLevel 1", tmp)); err != nil {
+		t.Fatal(err)
+	}
+	waf.Logger.Debug("debug message")
+	waf.Logger.Error("error message")
+	data, err := os.ReadFile(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "debug message") || !strings.Contains(string(data), "error message") {
+		t.Errorf("unexpected debug log for level 1, got %q", data)
+	}
+
+	if err := p.FromString("SecDebugLogLevel 0"); err != nil {
+		t.Fatal(err)
+	}
+	waf.Logger.Error("disabled message")
+	if data, _ := os.ReadFile(tmp); strings.Contains(string(data), "disabled message") {
+		t.Errorf("unexpected debug log for level 0, got %q", data)
+	}
+}
+
 // Find a file by name recursively containing some string
 func findFileContaining(path string, search string) (string, error) {
 	files, err := os.ReadDir(path)
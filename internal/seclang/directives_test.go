@@ -4,9 +4,18 @@
 package seclang
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/internal/environment"
+	"github.com/corazawaf/coraza/v3/profiler"
+	"github.com/corazawaf/coraza/v3/regex"
 	"github.com/corazawaf/coraza/v3/types"
 )
 
@@ -17,11 +26,6 @@ func Test_NonImplementedDirective(t *testing.T) {
 		`SecPcreMatchLimit 1500`,
 		`SecPcreMatchLimitRecursion 1500`,
 		`SecHttpBlKey whdkfieyhtnf`,
-		`SecHashMethodRx HashHref "product_info|list_product"`,
-		`SecHashMethodPm HashHref“product_info list_product”`,
-		`SecHashParam "hmac"`,
-		`SecHashKey "this_is_my_key" KeyOnly`,
-		`SecHashEngine On`,
 	}
 	w := corazawaf.NewWAF()
 	p := NewParser(w)
@@ -33,6 +37,291 @@ func Test_NonImplementedDirective(t *testing.T) {
 	}
 }
 
+func TestHashDirectives(t *testing.T) {
+	w := corazawaf.NewWAF()
+	p := NewParser(w)
+	directives := `
+SecHashMethodRx HashHref "product_info|list_product"
+SecHashMethodPm HashFormAction "login register"
+SecHashParam "token"
+SecHashKey "this_is_my_key" RemoteIP
+SecHashEngine On
+`
+	if err := p.FromString(directives); err != nil {
+		t.Fatal(err)
+	}
+	if !w.HashEngine {
+		t.Error("failed to set SecHashEngine")
+	}
+	if string(w.HashKey) != "this_is_my_key" || w.HashKeyMode != corazawaf.HashKeyRemoteIP {
+		t.Errorf("failed to set SecHashKey, got %q", w.HashKey)
+	}
+	if w.HashParam != "token" {
+		t.Error("failed to set SecHashParam")
+	}
+	if len(w.HashMethods) != 2 {
+		t.Fatalf("expected 2 hash methods, got %d", len(w.HashMethods))
+	}
+	if !w.HashMethods[0].Matches("/list_product") || !w.HashMethods[1].Matches("/register") {
+		t.Error("unexpected hash methods")
+	}
+	if err := p.FromString("SecHashMethodRx HashUnknown \"abc\""); err == nil {
+		t.Error("expected error for unknown hash method type")
+	}
+}
+
+func TestHashRandomKey(t *testing.T) {
+	keys := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		w := corazawaf.NewWAF()
+		if err := NewParser(w).FromString("SecHashKey rand KeyOnly"); err != nil {
+			t.Fatal(err)
+		}
+		if len(w.HashKey) != randomKeySize {
+			t.Errorf("unexpected key size %d", len(w.HashKey))
+		}
+		keys[string(w.HashKey)] = true
+	}
+	if len(keys) != 2 {
+		t.Error("expected different random keys")
+	}
+}
+
+func TestSignedCookiesDirectives(t *testing.T) {
+	w := corazawaf.NewWAF()
+	p := NewParser(w)
+	if err := p.FromString("SecSignedCookies PHPSESSID JSESSIONID"); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.SignedCookies) != 2 || len(w.CookieSignKey) != randomKeySize {
+		t.Errorf("failed to set SecSignedCookies, got %v", w.SignedCookies)
+	}
+	if err := p.FromString(`SecCookieSignKey "this_is_my_key" RemoteIP`); err != nil {
+		t.Fatal(err)
+	}
+	if string(w.CookieSignKey) != "this_is_my_key" || w.CookieSignKeyMode != corazawaf.HashKeyRemoteIP {
+		t.Errorf("failed to set SecCookieSignKey, got %q", w.CookieSignKey)
+	}
+	if err := p.FromString("SecCookieSignMaxAge 3600"); err != nil {
+		t.Fatal(err)
+	}
+	if w.CookieSignMaxAge != time.Hour {
+		t.Errorf("failed to set SecCookieSignMaxAge, got %s", w.CookieSignMaxAge)
+	}
+	for _, d := range []string{"SecSignedCookies", "SecCookieSignKey", "SecCookieSignKey key SessionID", "SecCookieSignMaxAge -1"} {
+		if err := p.FromString(d); err == nil {
+			t.Errorf("expected error for %q", d)
+		}
+	}
+}
+
+func TestCSRFDirectives(t *testing.T) {
+	w := corazawaf.NewWAF()
+	p := NewParser(w)
+	directives := `
+SecCSRFProtection On
+SecCSRFKey my_secret
+SecCSRFParam authenticity_token
+SecCSRFExempt /hooks/ /api/
+`
+	if err := p.FromString(directives); err != nil {
+		t.Fatal(err)
+	}
+	if !w.CSRFProtection || string(w.CSRFKey) != "my_secret" || w.CSRFParam != "authenticity_token" {
+		t.Error("failed to set the CSRF directives")
+	}
+	if len(w.CSRFExempt) != 2 {
+		t.Errorf("expected 2 exempt paths, got %v", w.CSRFExempt)
+	}
+	random := corazawaf.NewWAF()
+	if err := NewParser(random).FromString("SecCSRFProtection On"); err != nil {
+		t.Fatal(err)
+	}
+	if len(random.CSRFKey) != randomKeySize {
+		t.Errorf("unexpected random CSRF key size %d", len(random.CSRFKey))
+	}
+	for _, d := range []string{"SecCSRFProtection Maybe", "SecCSRFKey", "SecCSRFParam", "SecCSRFExempt"} {
+		if err := p.FromString(d); err == nil {
+			t.Errorf("expected error for %q", d)
+		}
+	}
+}
+
+func TestHoneypotDirectives(t *testing.T) {
+	w := corazawaf.NewWAF()
+	p := NewParser(w)
+	if err := p.FromString("SecHoneypotField website fax\nSecHoneypotPath /trap /admin/old.php"); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.HoneypotFields) != 2 || len(w.HoneypotPaths) != 2 {
+		t.Errorf("failed to set the honeypot directives, got %v and %v", w.HoneypotFields, w.HoneypotPaths)
+	}
+	for _, d := range []string{"SecHoneypotField", "SecHoneypotPath", "SecHoneypotPath trap"} {
+		if err := p.FromString(d); err == nil {
+			t.Errorf("expected error for %q", d)
+		}
+	}
+}
+
+func TestSeverityBlockDirective(t *testing.T) {
+	w := corazawaf.NewWAF()
+	p := NewParser(w)
+	err := p.FromString(`SecRuleEngine On
+SecSeverityBlock CRITICAL 406
+SecRule ARGS:a "@streq x" "id:1,phase:1,pass,log,severity:CRITICAL"
+SecRule ARGS:b "@streq x" "id:2,phase:1,pass,log,severity:WARNING"
+SecRule ARGS:c "@streq x" "id:3,phase:1,allow,log,severity:EMERGENCY"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]int{"a": 406, "b": 0, "c": 0}
+	for arg, status := range tests {
+		tx := w.NewTransaction()
+		tx.ProcessURI("/?"+arg+"=x", "GET", "HTTP/1.1")
+		it := tx.ProcessRequestHeaders()
+		switch {
+		case status == 0 && it != nil:
+			t.Errorf("unexpected interruption %v for %s", it, arg)
+		case status != 0 && (it == nil || it.Status != status || it.RuleID != 1):
+			t.Errorf("expected rule 1 to deny with %d, got %v", status, it)
+		}
+		if status != 0 && !tx.MatchedRules()[0].Disruptive() {
+			t.Error("expected the escalated match to be disruptive")
+		}
+	}
+
+	if err := p.FromString("SecSeverityBlock Off"); err != nil || w.BlockSeverityStatus != 0 {
+		t.Errorf("failed to disable SecSeverityBlock, got %v", err)
+	}
+	for _, d := range []string{"SecSeverityBlock", "SecSeverityBlock SEVERE", "SecSeverityBlock ERROR 42", "SecSeverityBlock Off 403"} {
+		if err := p.FromString(d); err == nil {
+			t.Errorf("expected error for %q", d)
+		}
+	}
+}
+
+func TestTransactionPoolDirectives(t *testing.T) {
+	w := corazawaf.NewWAF()
+	p := NewParser(w)
+	if err := p.FromString("SecTransactionPool Off\nSecTransactionPoolMaxBufferSize 1M"); err != nil {
+		t.Fatal(err)
+	}
+	if !w.TransactionPoolDisabled || w.TransactionPoolMaxBufferSize != 1<<20 {
+		t.Error("failed to set the transaction pool directives")
+	}
+	for _, d := range []string{"SecTransactionPool Maybe", "SecTransactionPoolMaxBufferSize -1", "SecTransactionPoolMaxBufferSize 8G"} {
+		if err := p.FromString(d); err == nil {
+			t.Errorf("expected error for %q", d)
+		}
+	}
+}
+
+func TestTransactionArenaDirective(t *testing.T) {
+	w := corazawaf.NewWAF()
+	p := NewParser(w)
+	if err := p.FromString("SecTransactionArena On"); err != nil {
+		t.Fatal(err)
+	}
+	if !w.TransactionArena {
+		t.Error("failed to set the transaction arena")
+	}
+	if err := p.FromString("SecTransactionArena Maybe"); err == nil {
+		t.Error("expected error for an invalid value")
+	}
+}
+
+func TestParallelRuleWorkersDirective(t *testing.T) {
+	w := corazawaf.NewWAF()
+	p := NewParser(w)
+	if err := p.FromString("SecParallelRuleWorkers 4"); err != nil {
+		t.Fatal(err)
+	}
+	if w.ParallelRuleWorkers != 4 {
+		t.Errorf("unexpected number of workers %d", w.ParallelRuleWorkers)
+	}
+	if err := p.FromString("SecParallelRuleWorkers Off"); err != nil || w.ParallelRuleWorkers != 0 {
+		t.Errorf("failed to disable the parallel rules: %v", err)
+	}
+	for _, d := range []string{"SecParallelRuleWorkers -1", "SecParallelRuleWorkers many"} {
+		if err := p.FromString(d); err == nil {
+			t.Errorf("expected error for %q", d)
+		}
+	}
+}
+
+func TestConnectionEngineDirectives(t *testing.T) {
+	w := corazawaf.NewWAF()
+	p := NewParser(w)
+	err := p.FromString(`
+		SecConnEngine DetectionOnly
+		SecConnConcurrentLimit 50
+		SecConnRateLimit 600/60
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.ConnectionEngine != types.ConnectionEngineDetectionOnly {
+		t.Errorf("unexpected connection engine %s", w.ConnectionEngine)
+	}
+	if w.ConnectionLimit != 50 || w.ConnectionRateLimit != 600 || w.ConnectionRateWindow != time.Minute {
+		t.Errorf("unexpected limits %d, %d/%s", w.ConnectionLimit, w.ConnectionRateLimit, w.ConnectionRateWindow)
+	}
+	for _, d := range []string{"SecConnEngine Maybe", "SecConnConcurrentLimit -1", "SecConnRateLimit 600", "SecConnRateLimit 600/0s"} {
+		if err := p.FromString(d); err == nil {
+			t.Errorf("expected error for %q", d)
+		}
+	}
+}
+
+func TestProfileDirectives(t *testing.T) {
+	if !environment.HasAccessToFS {
+		return // t.Skip doesn't work on TinyGo
+	}
+	w := corazawaf.NewWAF()
+	p := NewParser(w)
+	path := filepath.Join(t.TempDir(), "profile.json")
+	if err := p.FromString("SecProfileFile " + path + "\nSecProfileMode Learn"); err != nil {
+		t.Fatal(err)
+	}
+	if w.Profile == nil || w.Profile.Endpoints() != 0 || w.ProfileMode != profiler.Learn {
+		t.Fatal("failed to set the profile directives")
+	}
+	w.Profile.Learn(profiler.Request{Method: "GET", Path: "/"})
+	if err := w.SaveProfile(); err != nil {
+		t.Fatal(err)
+	}
+
+	w = corazawaf.NewWAF()
+	p = NewParser(w)
+	if err := p.FromString("SecProfileFile " + path + "\nSecProfileMode Enforce"); err != nil {
+		t.Fatal(err)
+	}
+	if w.Profile.Endpoints() != 1 || w.ProfileMode != profiler.Enforce {
+		t.Error("failed to load the saved profile")
+	}
+
+	// the profile is read from the OS filesystem it is written to
+	w = corazawaf.NewWAF()
+	p = NewParser(w)
+	p.SetRoot(fstest.MapFS{})
+	if err := p.FromString("SecProfileFile " + path); err != nil {
+		t.Fatal(err)
+	}
+	if w.Profile.Endpoints() != 1 {
+		t.Error("expected the profile of the OS filesystem")
+	}
+
+	invalid := filepath.Join(t.TempDir(), "invalid.json")
+	if err := os.WriteFile(invalid, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{"SecProfileMode Maybe", "SecProfileFile", "SecProfileFile " + invalid} {
+		if err := p.FromString(d); err == nil {
+			t.Errorf("expected error for %q", d)
+		}
+	}
+}
+
 func Test_directive(t *testing.T) {
 	w := corazawaf.NewWAF()
 	p := NewParser(w)
@@ -197,3 +486,161 @@ func TestSecDataset(t *testing.T) {
 		t.Error("failed to add dataset")
 	}
 }
+
+func TestRuleEngineSampling(t *testing.T) {
+	w := corazawaf.NewWAF()
+	p := NewParser(w)
+	if err := p.FromString(`
+SecRuleEngine On
+SecRuleEngineSampling 50 ClientIP
+SecAction "id:1,phase:1,deny,log"
+`); err != nil {
+		t.Fatal(err)
+	}
+	if w.RuleEngineSampleRate != 50 || w.RuleEngineSampleKey != corazawaf.SamplingClientIP {
+		t.Fatalf("failed to set SecRuleEngineSampling")
+	}
+
+	enforced := map[bool]int{}
+	for i := 0; i < 200; i++ {
+		ip := fmt.Sprintf("10.0.%d.%d", i/250, i%250)
+		var interrupted bool
+		// the same client must always get the same result
+		for j := 0; j < 2; j++ {
+			tx := w.NewTransaction()
+			tx.ProcessConnection(ip, 1234, "127.0.0.1", 80)
+			it := tx.ProcessRequestHeaders()
+			if j > 0 && (it != nil) != interrupted {
+				t.Fatalf("inconsistent sampling for %s", ip)
+			}
+			interrupted = it != nil
+			if len(tx.MatchedRules()) != 1 {
+				t.Fatal("rules must be evaluated for sampled out transactions")
+			}
+			tx.Close()
+		}
+		enforced[interrupted]++
+	}
+	if enforced[true] == 0 || enforced[false] == 0 {
+		t.Errorf("expected transactions to be sampled, got %v", enforced)
+	}
+
+	tx := w.NewTransaction()
+	tx.SetRuleEngine(types.RuleEngineOn)
+	for i := 0; i < 10; i++ {
+		tx.ProcessConnection(fmt.Sprintf("10.1.0.%d", i), 1234, "127.0.0.1", 80)
+		if tx.RuleEngine != types.RuleEngineOn {
+			t.Fatal("SetRuleEngine must take precedence over sampling")
+		}
+	}
+
+	for _, d := range []string{"SecRuleEngineSampling 101", "SecRuleEngineSampling abc", "SecRuleEngineSampling 10 unknown"} {
+		if err := p.FromString(d); err == nil {
+			t.Errorf("expected error for %q", d)
+		}
+	}
+}
+
+func TestSecCacheTransformations(t *testing.T) {
+	w := corazawaf.NewWAF()
+	p := NewParser(w)
+	if err := p.FromString(`SecCacheTransformations On "incremental:off,minlen:4,maxlen:1024,maxitems:512"`); err != nil {
+		t.Fatal(err)
+	}
+	want := corazawaf.TransformationCacheConfig{Enabled: true, MinLen: 4, MaxLen: 1024, MaxItems: 512}
+	if w.TransformationCache != want {
+		t.Errorf("unexpected transformation cache config %+v", w.TransformationCache)
+	}
+	if err := p.FromString(`SecCacheTransformations Off`); err != nil {
+		t.Fatal(err)
+	}
+	if w.TransformationCache.Enabled {
+		t.Error("expected transformation cache to be disabled")
+	}
+	for _, d := range []string{
+		`SecCacheTransformations`,
+		`SecCacheTransformations On "unknown:1"`,
+		`SecCacheTransformations On "maxitems:-1"`,
+		`SecCacheTransformations On "incremental:maybe"`,
+	} {
+		if err := p.FromString(d); err == nil {
+			t.Errorf("expected error for %q", d)
+		}
+	}
+}
+
+type prefixEngine struct{}
+
+func (prefixEngine) Name() string { return "prefix" }
+
+func (prefixEngine) Compile(expr string) (regex.Regexp, error) {
+	return regexp.Compile("^" + regexp.QuoteMeta(expr))
+}
+
+func TestSecRegexEngine(t *testing.T) {
+	regex.RegisterEngine(prefixEngine{})
+	w := corazawaf.NewWAF()
+	p := NewParser(w)
+	if err := p.FromString(`
+SecRule ARGS "a+" "id:1,phase:1,log"
+SecRegexEngine prefix
+SecRule ARGS "a+" "id:2,phase:1,log"
+`); err != nil {
+		t.Fatal(err)
+	}
+	tx := w.NewTransaction()
+	tx.AddArgument(types.ArgumentGET, "x", "aaa")
+	tx.AddArgument(types.ArgumentGET, "y", "a+b")
+	tx.ProcessRequestHeaders()
+	matched := map[int]int{}
+	for _, mr := range tx.MatchedRules() {
+		matched[mr.Rule().ID()] = len(mr.MatchedDatas())
+	}
+	if matched[1] != 2 || matched[2] != 1 {
+		t.Errorf("unexpected matches %v", matched)
+	}
+
+	if err := p.FromString(`SecRegexEngine unknown`); err == nil {
+		t.Error("expected error for unknown engine")
+	}
+}
+
+func TestSecUnicodeMapFile(t *testing.T) {
+	w := corazawaf.NewWAF()
+	p := NewParser(w)
+	// the mapping applies to the rules parsed before it
+	if err := p.FromString(`
+SecRule ARGS "@streq <script>" "id:1,phase:1,t:urlDecodeUni,log"
+SecUnicodeMapFile ./testdata/unicode.mapping 20127
+`); err != nil {
+		t.Fatal(err)
+	}
+	tx := w.NewTransaction()
+	tx.AddArgument(types.ArgumentGET, "x", "%u2039script%u203a")
+	tx.ProcessRequestHeaders()
+	if len(tx.MatchedRules()) != 1 {
+		t.Error("expected best fit characters to be mapped")
+	}
+
+	// the mapping is not shared with other WAFs
+	other := corazawaf.NewWAF()
+	if err := NewParser(other).FromString(`SecRule ARGS "@streq <script>" "id:1,phase:1,t:urlDecodeUni,log"`); err != nil {
+		t.Fatal(err)
+	}
+	tx = other.NewTransaction()
+	tx.AddArgument(types.ArgumentGET, "x", "%u2039script%u203a")
+	tx.ProcessRequestHeaders()
+	if len(tx.MatchedRules()) != 0 {
+		t.Error("expected the mapping of another WAF to be ignored")
+	}
+
+	for _, d := range []string{
+		`SecUnicodeMapFile ./testdata/unicode.mapping`,
+		`SecUnicodeMapFile ./testdata/unicode.mapping 1`,
+		`SecUnicodeMapFile ./testdata/missing.mapping 20127`,
+	} {
+		if err := p.FromString(d); err == nil {
+			t.Errorf("expected error for %q", d)
+		}
+	}
+}
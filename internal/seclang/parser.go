@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -28,14 +29,33 @@ type Parser struct {
 	currentDir   string
 	root         fs.FS
 	includeCount int
+	// lines contains the physical lines of the directive being parsed
+	lines       []directiveLine
+	diagnostics []Diagnostic
+	// unknownDirective handles the directives missing from directivesMap
+	unknownDirective DirectiveHandler
+	// plugins are the CRS plugins loaded by the plugin includes
+	plugins []fs.FS
+	// pluginIncludes is the number of plugin includes parsed
+	pluginIncludes int
 }
 
+// DirectiveHandler implements directives unknown to the parser, like
+// vendor specific annotations. It returns ErrUnknownDirective for the
+// directives it doesn't implement.
+type DirectiveHandler func(directive string, opts string) error
+
+// ErrUnknownDirective is returned by a DirectiveHandler that doesn't
+// implement a directive
+var ErrUnknownDirective = errors.New("unknown directive")
+
 // FromFile imports directives from a file
 // It will return error if any directive fails to parse
 // or the file does not exist.
 // If the path contains a *, it will be expanded to all
 // files in the directory matching the pattern
 func (p *Parser) FromFile(profilePath string) error {
+	profilePath = p.resolvePath(strings.TrimSpace(profilePath))
 	var files []string
 	if strings.Contains(profilePath, "*") {
 		var err error
@@ -47,37 +67,124 @@ func (p *Parser) FromFile(profilePath string) error {
 		files = append(files, profilePath)
 	}
 	for _, profilePath := range files {
-		profilePath = strings.TrimSpace(profilePath)
-		if !strings.HasPrefix(profilePath, "/") {
-			profilePath = filepath.Join(p.currentDir, profilePath)
-		}
-		p.currentFile = profilePath
-		lastDir := p.currentDir
-		p.currentDir = filepath.Dir(profilePath)
 		file, err := fs.ReadFile(p.root, profilePath)
 		if err != nil {
 			p.options.WAF.Logger.Error(err.Error())
 			return err
 		}
+		lastFile, lastLine := p.currentFile, p.currentLine
+		p.currentFile, p.currentLine = profilePath, 0
+		lastDir := p.currentDir
+		p.currentDir = path.Dir(filepath.ToSlash(profilePath))
 
+		fileScope := p.options.Config.Get("rule_default_actions_file_scope", false).(bool)
+		defaultActions := p.options.Config.Get("rule_default_actions", []string{}).([]string)
 		err = p.FromString(string(file))
+		// restore the position in the parent file
+		p.currentFile, p.currentLine = lastFile, lastLine
 		if err != nil {
 			p.options.WAF.Logger.Error(err.Error())
 			return err
 		}
 		// restore the lastDir post processing all includes
 		p.currentDir = lastDir
+		if fileScope {
+			// the defaults declared by the file don't leak to the parent
+			p.options.Config.Set("rule_default_actions", defaultActions)
+		}
+	}
+	if hook := pluginHook(profilePath); hook != "" {
+		return p.loadPlugins(hook)
+	}
+	return nil
+}
+
+// FromFS imports the directives of the files of root matching the
+// patterns, like "coreruleset/rules/*.conf". The files referenced by the
+// loaded directives, like the included files and the @pmFromFile data
+// files, are read from root too, so a ruleset embedded with embed.FS can
+// be loaded without filesystem access.
+func (p *Parser) FromFS(root fs.FS, patterns ...string) error {
+	lastRoot, lastDir := p.root, p.currentDir
+	p.root, p.currentDir = root, ""
+	defer func() {
+		p.root, p.currentDir = lastRoot, lastDir
+	}()
+	for _, pattern := range patterns {
+		if err := p.FromFile(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolvePath returns the path of a file referenced by the directives in
+// the root file system, the relative paths are resolved from the
+// directory of the current file. The paths of a root other than the OS
+// one, like an embed.FS, are slash separated and relative to its root.
+func (p *Parser) resolvePath(name string) string {
+	if _, ok := p.root.(io.OSFS); ok {
+		if strings.HasPrefix(name, "/") {
+			return name
+		}
+		return filepath.Join(p.currentDir, name)
+	}
+	if strings.HasPrefix(name, "/") {
+		return path.Clean(strings.TrimLeft(name, "/"))
+	}
+	return path.Join(p.currentDir, name)
+}
+
+// pluginHooks are the suffixes of the files of a CRS plugin, its
+// configuration and the rules evaluated before and after the CRS rules
+var pluginHooks = []string{"-config.conf", "-before.conf", "-after.conf"}
+
+// pluginHook returns the plugin hook included by a path like
+// plugins/*-before.conf, it is empty for other paths
+func pluginHook(path string) string {
+	base := filepath.Base(path)
+	for _, h := range pluginHooks {
+		if base == "*"+h {
+			return h
+		}
+	}
+	return ""
+}
+
+// loadPlugins parses the files of the registered plugins for a hook, they
+// are read from the root of the plugins or from their plugins directory
+func (p *Parser) loadPlugins(hook string) error {
+	p.pluginIncludes++
+	for _, plugin := range p.plugins {
+		// the files are listed first, their globs would include the
+		// plugins again
+		var files []string
+		for _, pattern := range []string{"*" + hook, "plugins/*" + hook} {
+			matches, err := fs.Glob(plugin, pattern)
+			if err != nil {
+				return err
+			}
+			files = append(files, matches...)
+		}
+		if err := p.FromFS(plugin, files...); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 // FromString imports directives from a string
 // It will return error if any directive fails to parse
-// or arguments are invalid
+// or arguments are invalid. The parsing continues after a failed
+// directive, the returned error is the first one and every error and
+// warning is available with Diagnostics.
 func (p *Parser) FromString(data string) error {
 	scanner := bufio.NewScanner(strings.NewReader(data))
 	var linebuffer strings.Builder
 	inBackticks := false
+	var firstErr error
+	errCount := 0
+	p.lines = p.lines[:0]
 	for scanner.Scan() {
 		p.currentLine++
 		line := strings.TrimSpace(scanner.Text())
@@ -89,6 +196,7 @@ func (p *Parser) FromString(data string) error {
 		if line[0] == '#' {
 			continue
 		}
+		p.lines = append(p.lines, directiveLine{number: p.currentLine, text: scanner.Text()})
 
 		// Looks for a line like "SecDataset test `". The backtick starts an action list.
 		// The list will be closed only with a single "`" line.
@@ -109,17 +217,154 @@ func (p *Parser) FromString(data string) error {
 			linebuffer.WriteString(strings.TrimSuffix(line, "\\"))
 		} else {
 			linebuffer.WriteString(line)
-			err := p.evaluateLine(linebuffer.String())
-			if err != nil {
-				return err
+			if err := p.evaluateLine(linebuffer.String()); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				errCount++
 			}
 			linebuffer.Reset()
+			p.lines = p.lines[:0]
 		}
 	}
 	if inBackticks {
 		return errors.New("backticks left open")
 	}
-	return nil
+	if errCount > 1 {
+		return fmt.Errorf("%w (and %d more errors)", firstErr, errCount-1)
+	}
+	return firstErr
+}
+
+// Diagnostics returns the errors and warnings found by the parser, in
+// the order they were found
+func (p *Parser) Diagnostics() []Diagnostic {
+	return p.diagnostics
+}
+
+// ValidateMarkers checks the skipAfter targets of the loaded rules. It
+// must be called once every file is parsed, as a marker can be defined in
+// a file included after the rule using it. A target must be a SecMarker
+// following the rule, a marker only defined before the rule would skip
+// every remaining rule of the phase. The problems are warnings in lenient
+// mode. As skipAfter doesn't cross phases, the rules of other phases
+// between a rule and its target are reported as warnings unless a rule of
+// their phase skips to the same target.
+func (p *Parser) ValidateMarkers() error {
+	rules := p.options.WAF.Rules.GetRules()
+	// last contains the position of the last definition of each marker
+	last := map[string]int{}
+	// skippers contains the phases skipping to each marker
+	skippers := map[string]map[types.RulePhase]bool{}
+	for i, r := range rules {
+		if r.SecMark_ != "" {
+			last[r.SecMark_] = i
+		}
+		if r.SkipAfter != "" {
+			if skippers[r.SkipAfter] == nil {
+				skippers[r.SkipAfter] = map[types.RulePhase]bool{}
+			}
+			skippers[r.SkipAfter][r.Phase_] = true
+		}
+	}
+	severity := DiagnosticError
+	if p.options.Config.Get("parser_lenient", false).(bool) {
+		severity = DiagnosticWarning
+	}
+	var firstErr error
+	errCount := 0
+	for i, r := range rules {
+		if r.SkipAfter == "" {
+			continue
+		}
+		var message string
+		if pos, ok := last[r.SkipAfter]; !ok {
+			message = fmt.Sprintf("skipAfter target %q is not defined by any SecMarker", r.SkipAfter)
+		} else if pos < i {
+			message = fmt.Sprintf("skipAfter target %q is only defined before rule %d, the rest of phase %d would be skipped", r.SkipAfter, r.ID_, r.Phase_)
+		} else {
+			if message = phaseMismatch(rules, i, skippers[r.SkipAfter]); message != "" {
+				p.markerDiagnostic(DiagnosticWarning, r, message)
+			}
+			continue
+		}
+		d := p.markerDiagnostic(severity, r, message)
+		if severity == DiagnosticWarning {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = &ParseError{Diagnostic: d, Err: errors.New(message)}
+		}
+		errCount++
+	}
+	if errCount > 1 {
+		return fmt.Errorf("%w (and %d more errors)", firstErr, errCount-1)
+	}
+	return firstErr
+}
+
+// phaseMismatch returns a message if the rule at position i skips no rule
+// of its phase before its target, or if a rule of another phase before
+// the target isn't skipped by a rule of that phase
+func phaseMismatch(rules []*corazawaf.Rule, i int, skippers map[types.RulePhase]bool) string {
+	r := rules[i]
+	skipped := false
+	var other *corazawaf.Rule
+	for j := i + 1; j < len(rules) && rules[j].SecMark_ != r.SkipAfter; j++ {
+		switch phase := rules[j].Phase_; {
+		case phase == 0:
+		case phase == r.Phase_:
+			skipped = true
+		case other == nil && !skippers[phase]:
+			other = rules[j]
+		}
+	}
+	switch {
+	case !skipped:
+		return fmt.Sprintf("skipAfter target %q of rule %d skips no rule of phase %d", r.SkipAfter, r.ID_, r.Phase_)
+	case other != nil:
+		return fmt.Sprintf("rule %d of phase %d before the skipAfter target %q of rule %d is not skipped, skipAfter doesn't cross phases", other.ID_, other.Phase_, r.SkipAfter, r.ID_)
+	}
+	return ""
+}
+
+// markerDiagnostic records a diagnostic for the skipAfter action of r,
+// warnings are logged
+func (p *Parser) markerDiagnostic(severity DiagnosticSeverity, r *corazawaf.Rule, message string) Diagnostic {
+	directive, _, _ := strings.Cut(r.Raw_, " ")
+	d := Diagnostic{
+		Severity:  severity,
+		File:      r.File_,
+		Line:      r.Line_,
+		Column:    1,
+		Directive: directive,
+		Token:     r.SkipAfter,
+		Message:   message,
+	}
+	p.diagnostics = append(p.diagnostics, d)
+	if severity == DiagnosticWarning {
+		p.options.WAF.Logger.Warn("%s", d.String())
+	}
+	return d
+}
+
+// diagnose records a diagnostic for the directive made of lines
+func (p *Parser) diagnose(severity DiagnosticSeverity, lines []directiveLine, directive string, token string, message string) Diagnostic {
+	line, column := locate(lines, token)
+	d := Diagnostic{
+		Severity:  severity,
+		File:      p.currentFile,
+		Line:      line,
+		Column:    column,
+		Directive: directive,
+		Token:     token,
+		Message:   message,
+	}
+	p.diagnostics = append(p.diagnostics, d)
+	if severity == DiagnosticWarning {
+		p.options.WAF.Logger.Warn("%s", d.String())
+	}
+	return d
 }
 
 func (p *Parser) evaluateLine(data string) error {
@@ -130,6 +375,36 @@ func (p *Parser) evaluateLine(data string) error {
 	dir, opts, _ := strings.Cut(data, " ")
 	p.options.WAF.Logger.Debug("parsing directive %q", data)
 	directive := strings.ToLower(dir)
+	// the lines are copied as includes reuse them
+	lines := append([]directiveLine(nil), p.lines...)
+	p.options.warn = func(token string, message string) {
+		p.diagnose(DiagnosticWarning, lines, dir, token, message)
+	}
+	if replacement, ok := deprecatedDirectives[directive]; ok {
+		p.options.warn(dir, fmt.Sprintf("%s is deprecated, use %s", dir, replacement))
+	}
+	err := p.evaluateDirective(dir, opts)
+	if err == nil {
+		return nil
+	}
+	var pe *ParseError
+	if errors.As(err, &pe) {
+		// the error comes from an included file
+		return err
+	}
+	token := ""
+	var te *tokenError
+	if errors.As(err, &te) {
+		token = te.token
+	}
+	return &ParseError{
+		Diagnostic: p.diagnose(DiagnosticError, lines, dir, token, err.Error()),
+		Err:        err,
+	}
+}
+
+func (p *Parser) evaluateDirective(dir string, opts string) error {
+	directive := strings.ToLower(dir)
 
 	if len(opts) >= 3 && opts[0] == '"' && opts[len(opts)-1] == '"' {
 		opts = strings.Trim(opts, `"`)
@@ -147,27 +422,45 @@ func (p *Parser) evaluateLine(data string) error {
 	}
 	d, ok := directivesMap[directive]
 	if !ok || d == nil {
-		return p.log("Unsupported directive " + directive)
+		if h := p.unknownDirective; h != nil {
+			if err := h(dir, opts); !errors.Is(err, ErrUnknownDirective) {
+				return err
+			}
+		}
+		if p.options.Config.Get("parser_lenient", false).(bool) {
+			p.options.Warn(dir, fmt.Sprintf("unknown directive %q, it is ignored", dir))
+			return nil
+		}
+		p.options.WAF.Logger.Error("[%d] unsupported directive %s", p.currentLine, directive)
+		return newTokenError(dir, fmt.Errorf("unsupported directive %q", dir))
 	}
 
 	p.options.Opts = opts
-	p.options.Config.Set("last_profile_line", p.currentLine)
+	p.options.Config.Set("parser_last_line", p.currentLine)
 	p.options.Config.Set("parser_config_file", p.currentFile)
 	p.options.Config.Set("parser_config_dir", p.currentDir)
 	p.options.Config.Set("parser_root", p.root)
-	wd, err := os.Getwd()
-	if err != nil {
-		return err
+	// the working directory is only searched on the OS filesystem, some
+	// WASM targets don't have one
+	wd := ""
+	if _, ok := p.root.(io.OSFS); ok {
+		wd, _ = os.Getwd()
 	}
 	p.options.Config.Set("working_dir", wd)
 
 	return d(p.options)
 }
 
-func (p *Parser) log(msg string) error {
-	msg = fmt.Sprintf("[Parser] [Line %d] %s", p.currentLine, msg)
-	p.options.WAF.Logger.Error("[%d] %s", p.currentLine, msg)
-	return errors.New(msg)
+// SetLenient selects whether the unknown directives and actions fail
+// the parsing, the default, or are ignored with a warning
+func (p *Parser) SetLenient(lenient bool) {
+	p.options.Config.Set("parser_lenient", lenient)
+}
+
+// SetUnknownDirectiveHandler sets the handler called for the directives
+// unknown to the parser, before failing or ignoring them
+func (p *Parser) SetUnknownDirectiveHandler(h DirectiveHandler) {
+	p.unknownDirective = h
 }
 
 // SetRoot sets the root of the filesystem for resolving paths. If not set, the OS's
@@ -180,6 +473,21 @@ func (p *Parser) SetRoot(root fs.FS) {
 	p.root = root
 }
 
+// AddPlugin registers a CRS 4 plugin, its *-config.conf, *-before.conf
+// and *-after.conf files are parsed where the rules include the files of
+// the same kind of the CRS plugins directory, like
+// Include @owasp_crs/plugins/*-before.conf. The plugin files are read
+// from the root of plugin or from its plugins directory.
+func (p *Parser) AddPlugin(plugin fs.FS) {
+	p.plugins = append(p.plugins, plugin)
+}
+
+// PluginIncludes returns the number of plugin includes parsed, the
+// registered plugins are not loaded if the rules don't include them
+func (p *Parser) PluginIncludes() int {
+	return p.pluginIncludes
+}
+
 // NewParser creates a new parser from a WAF instance
 // Rules and settings will be inserted into the WAF
 // rule container (RuleGroup).
@@ -6,11 +6,14 @@ package seclang
 import (
 	"bufio"
 	"embed"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	coraza "github.com/corazawaf/coraza/v3/internal/corazawaf"
 )
@@ -208,3 +211,389 @@ func BenchmarkParseFromString(b *testing.B) {
 		_ = parser.FromString(parsingRule)
 	}
 }
+
+func FuzzSeclangParse(f *testing.F) {
+	for _, tc := range []string{
+		`SecRuleEngine On`,
+		`SecRule ARGS "@rx abc" "id:1,phase:1,deny,t:lowercase,msg:'%{MATCHED_VAR}'"`,
+		`SecRule REQUEST_HEADERS:User-Agent|!ARGS:/^id$/ "!@pm a b" "id:2,chain"` + "\n" + `SecRule &ARGS "@gt 1" ""`,
+		`SecAction "id:3,setvar:'tx.score=+%{tx.critical}',ctl:ruleRemoveById=1-10"`,
+		`SecRuleUpdateTargetById 1 "!ARGS:foo"`,
+		"SecMarker END\nSecRule ARGS \"@eq 1\" \"id:4,skipAfter:END\"",
+	} {
+		f.Add(tc)
+	}
+	f.Fuzz(func(t *testing.T, directives string) {
+		// directives touching the filesystem are not fuzzed
+		lower := strings.ToLower(directives)
+		for _, d := range []string{"include", "secauditlog", "secdebuglog", "secdatadir", "sectmpdir", "secuploaddir", "secunicodemapfile"} {
+			if strings.Contains(lower, d) {
+				t.Skip()
+			}
+		}
+		waf := coraza.NewWAF()
+		_ = NewParser(waf).FromString(directives)
+	})
+}
+
+func TestDefaultActionScopes(t *testing.T) {
+	root := fstest.MapFS{
+		"crs.conf": &fstest.MapFile{Data: []byte(`SecDefaultAction "phase:1,log,deny,status:403"
+SecRule ARGS:crs "@rx ." "id:1,phase:1,block"`)},
+	}
+	tests := map[string]struct {
+		scope  string
+		status int
+	}{
+		"global": {scope: "Global", status: 403},
+		"file":   {scope: "File", status: 402},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			waf := coraza.NewWAF()
+			p := NewParser(waf)
+			p.SetRoot(root)
+			if err := p.FromString(fmt.Sprintf(`SecRuleEngine On
+SecDefaultActionScope %s
+SecDefaultAction "phase:1,log,deny,status:402"
+Include crs.conf
+SecRule ARGS:custom "@rx ." "id:2,phase:1,block"
+SecRule ARGS:other "@rx ." "id:3,phase:2"`, tt.scope)); err != nil {
+				t.Fatal(err)
+			}
+			tx := waf.NewTransaction()
+			tx.ProcessURI("/?crs=1", "GET", "HTTP/1.1")
+			if it := tx.ProcessRequestHeaders(); it == nil || it.Status != 403 {
+				t.Errorf("expected the included defaults to apply to the included rules, got %v", it)
+			}
+			tx = waf.NewTransaction()
+			tx.ProcessURI("/?custom=1", "GET", "HTTP/1.1")
+			if it := tx.ProcessRequestHeaders(); it == nil || it.Status != tt.status {
+				t.Errorf("expected status %d, got %v", tt.status, it)
+			}
+			// the phase 2 built-in defaults are kept
+			tx = waf.NewTransaction()
+			tx.ProcessURI("/?other=1", "GET", "HTTP/1.1")
+			tx.ProcessRequestHeaders()
+			if it, _ := tx.ProcessRequestBody(); it != nil || len(tx.MatchedRules()) != 1 {
+				t.Errorf("expected rule 3 to pass, got %v", it)
+			}
+		})
+	}
+	waf := coraza.NewWAF()
+	p := NewParser(waf)
+	for _, d := range []string{`SecDefaultAction "log,deny"`, `SecDefaultAction "phase:1,log"`, "SecDefaultActionScope rule"} {
+		if err := p.FromString(d); err == nil {
+			t.Errorf("expected an error for %q", d)
+		}
+	}
+}
+
+func TestCRSPlugins(t *testing.T) {
+	root := fstest.MapFS{
+		"crs/plugins/empty-config.conf": &fstest.MapFile{Data: []byte(`# placeholder`)},
+		"crs/plugins/empty-before.conf": &fstest.MapFile{Data: []byte(`# placeholder`)},
+		"crs/plugins/empty-after.conf":  &fstest.MapFile{Data: []byte(`# placeholder`)},
+		"crs/rules/REQUEST-942.conf": &fstest.MapFile{Data: []byte(
+			`SecRule ARGS "@rx attack" "id:942100,phase:1,deny,status:403"`)},
+	}
+	plugin := fstest.MapFS{
+		"plugins/wordpress-config.conf": &fstest.MapFile{Data: []byte(
+			`SecRule &TX:wordpress-plugin_enabled "@eq 0" "id:9507010,phase:1,pass,nolog,setvar:'tx.wordpress-plugin_enabled=1'"`)},
+		"plugins/wordpress-before.conf": &fstest.MapFile{Data: []byte(`SecRule TX:wordpress-plugin_enabled "@eq 0" "id:9507099,phase:1,pass,nolog,skipAfter:END-WORDPRESS"
+SecRule REQUEST_FILENAME "@streq /wp-admin/post.php" "id:9507100,phase:1,pass,nolog,ctl:ruleRemoveTargetById=942100;ARGS:content"
+SecMarker END-WORDPRESS`)},
+		"wordpress-after.conf": &fstest.MapFile{Data: []byte(`SecRule ARGS "@rx late" "id:9507200,phase:1,deny,status:402"`)},
+	}
+	setup := `SecRuleEngine On
+%s
+Include crs/plugins/*-config.conf
+Include crs/plugins/*-before.conf
+Include crs/rules/*.conf
+Include crs/plugins/*-after.conf`
+	tests := map[string]struct {
+		disable string
+		status  int
+	}{
+		"enabled":  {status: 0},
+		"disabled": {disable: `SecAction "id:1,phase:1,pass,nolog,setvar:'tx.wordpress-plugin_enabled=0'"`, status: 403},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			waf := coraza.NewWAF()
+			p := NewParser(waf)
+			p.SetRoot(root)
+			p.AddPlugin(plugin)
+			if err := p.FromString(fmt.Sprintf(setup, tt.disable)); err != nil {
+				t.Fatal(err)
+			}
+			if p.PluginIncludes() != 3 {
+				t.Errorf("expected 3 plugin includes, got %d", p.PluginIncludes())
+			}
+			var ids []int
+			for _, r := range waf.Rules.GetRules() {
+				if r.ID_ >= 9507000 || r.ID_ == 942100 {
+					ids = append(ids, r.ID_)
+				}
+			}
+			if fmt.Sprint(ids) != "[9507010 9507099 9507100 942100 9507200]" {
+				t.Errorf("unexpected rule order %v", ids)
+			}
+			tx := waf.NewTransaction()
+			tx.ProcessURI("/wp-admin/post.php?content=attack", "POST", "HTTP/1.1")
+			it := tx.ProcessRequestHeaders()
+			if tt.status == 0 && it != nil {
+				t.Errorf("unexpected interruption %v", it)
+			}
+			if tt.status != 0 && (it == nil || it.Status != tt.status) {
+				t.Errorf("expected status %d, got %v", tt.status, it)
+			}
+			tx = waf.NewTransaction()
+			tx.ProcessURI("/?a=late", "GET", "HTTP/1.1")
+			if it := tx.ProcessRequestHeaders(); it == nil || it.Status != 402 {
+				t.Errorf("expected the after rule to run, got %v", it)
+			}
+		})
+	}
+}
+
+func TestFromFS(t *testing.T) {
+	root := fstest.MapFS{
+		"crs/crs-setup.conf": &fstest.MapFile{Data: []byte(`SecRuleEngine On
+Include rules/*.conf`)},
+		"crs/rules/REQUEST-913.conf": &fstest.MapFile{Data: []byte(`SecRule REQUEST_HEADERS:User-Agent "@pmFromFile scanners-user-agents.data" "id:913100,phase:1,deny,status:403"
+SecRule ARGS "@pmFromFile /crs/rules/words.data" "id:913101,phase:1,deny,status:402"`)},
+		"crs/rules/scanners-user-agents.data": &fstest.MapFile{Data: []byte("nikto\nsqlmap")},
+		"crs/rules/words.data":                &fstest.MapFile{Data: []byte("forbidden")},
+	}
+	waf := coraza.NewWAF()
+	p := NewParser(waf)
+	if err := p.FromFS(root, "crs/crs-setup.conf"); err != nil {
+		t.Fatal(err)
+	}
+	if waf.Rules.Count() != 2 {
+		t.Fatalf("expected 2 rules, got %d", waf.Rules.Count())
+	}
+	tx := waf.NewTransaction()
+	tx.AddRequestHeader("User-Agent", "sqlmap/1.0")
+	if it := tx.ProcessRequestHeaders(); it == nil || it.Status != 403 {
+		t.Errorf("expected the relative data file to be loaded, got %v", it)
+	}
+	tx = waf.NewTransaction()
+	tx.ProcessURI("/?a=forbidden", "GET", "HTTP/1.1")
+	if it := tx.ProcessRequestHeaders(); it == nil || it.Status != 402 {
+		t.Errorf("expected the absolute data file to be loaded, got %v", it)
+	}
+	// the root is restored
+	if err := p.FromString("Include ../../coraza.conf-recommended"); err != nil {
+		t.Error(err)
+	}
+	if err := p.FromFS(root, "crs/missing.conf"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	root := fstest.MapFS{
+		"rules.conf": &fstest.MapFile{Data: []byte(`# comment
+SecRule ARGS "@rx a" "id:1,phase:1,pass,sanitiseArg:password"
+SecRule ARGS \
+    "@unknown a" "id:2,phase:1,pass"
+SecRule ARGS "@rx a" "id:3,phase:1,pass,explode"
+SecAuditLogStorageDir /tmp
+SecRuleScript /tmp/script.lua`)},
+	}
+	waf := coraza.NewWAF()
+	p := NewParser(waf)
+	p.SetRoot(root)
+	err := p.FromString("SecRuleEngine On\nInclude rules.conf\nSecAction \"id:4,phase:1,pass\"")
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+	if want := `rules.conf:4:7: failed to compile rule (operator unknown not found)`; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("expected error %q, got %q", want, err.Error())
+	}
+	// the parsing continued after the errors
+	if waf.Rules.FindByID(1) == nil || waf.Rules.FindByID(4) == nil {
+		t.Error("expected the valid rules to be added")
+	}
+	want := []Diagnostic{
+		{Severity: DiagnosticWarning, File: "rules.conf", Line: 2, Column: 41, Directive: "SecRule", Token: "sanitiseArg"},
+		{Severity: DiagnosticError, File: "rules.conf", Line: 4, Column: 7, Directive: "SecRule", Token: "unknown"},
+		{Severity: DiagnosticError, File: "rules.conf", Line: 5, Column: 41, Directive: "SecRule", Token: "explode"},
+		{Severity: DiagnosticWarning, File: "rules.conf", Line: 6, Column: 1, Directive: "SecAuditLogStorageDir", Token: "SecAuditLogStorageDir"},
+		{Severity: DiagnosticWarning, File: "rules.conf", Line: 7, Column: 1, Directive: "SecRuleScript"},
+	}
+	diags := p.Diagnostics()
+	if len(diags) != len(want) {
+		t.Fatalf("expected %d diagnostics, got %v", len(want), diags)
+	}
+	for i, d := range diags {
+		d.Message = ""
+		if d != want[i] {
+			t.Errorf("unexpected diagnostic %d, want %+v, got %+v", i, want[i], d)
+		}
+	}
+}
+
+func TestLenientParsing(t *testing.T) {
+	directives := `SecVendorAnnotation "team:edge"
+SecUnknownDirective On
+SecRule ARGS "@rx a" "id:1,phase:1,pass,vendorAction:1"`
+
+	p := NewParser(coraza.NewWAF())
+	if err := p.FromString(directives); err == nil {
+		t.Error("expected an error in strict mode")
+	}
+
+	waf := coraza.NewWAF()
+	p = NewParser(waf)
+	p.SetLenient(true)
+	var annotations []string
+	p.SetUnknownDirectiveHandler(func(directive string, opts string) error {
+		if directive != "SecVendorAnnotation" {
+			return ErrUnknownDirective
+		}
+		annotations = append(annotations, opts)
+		return nil
+	})
+	if err := p.FromString(directives); err != nil {
+		t.Fatal(err)
+	}
+	if len(annotations) != 1 || annotations[0] != "team:edge" {
+		t.Errorf("expected the annotation to be handled, got %v", annotations)
+	}
+	if waf.Rules.FindByID(1) == nil {
+		t.Error("expected the rule with an unknown action to be added")
+	}
+	diags := p.Diagnostics()
+	if len(diags) != 2 || diags[0].Token != "SecUnknownDirective" || diags[1].Token != "vendorAction" {
+		t.Fatalf("expected two warnings, got %v", diags)
+	}
+	for _, d := range diags {
+		if d.Severity != DiagnosticWarning {
+			t.Errorf("expected a warning, got %v", d)
+		}
+	}
+
+	p = NewParser(coraza.NewWAF())
+	p.SetUnknownDirectiveHandler(func(directive string, opts string) error {
+		return errors.New("invalid annotation")
+	})
+	if err := p.FromString(`SecVendorAnnotation ""`); err == nil || !strings.Contains(err.Error(), "invalid annotation") {
+		t.Errorf("expected the handler error, got %v", err)
+	}
+}
+
+func TestValidateMarkers(t *testing.T) {
+	root := fstest.MapFS{
+		"setup.conf": &fstest.MapFile{Data: []byte(`Include rules.conf
+Include end.conf`)},
+		"rules.conf": &fstest.MapFile{Data: []byte(`SecAction "id:1,phase:1,pass,nolog,skipAfter:END-RULES"
+SecRule ARGS "@rx a" "id:2,phase:1,deny,status:403"`)},
+		"end.conf": &fstest.MapFile{Data: []byte(`SecMarker END-RULES`)},
+	}
+	waf := coraza.NewWAF()
+	p := NewParser(waf)
+	if err := p.FromFS(root, "setup.conf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ValidateMarkers(); err != nil {
+		t.Fatalf("expected the marker of the later included file to be found, got %v", err)
+	}
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/?a=a", "GET", "HTTP/1.1")
+	if it := tx.ProcessRequestHeaders(); it != nil {
+		t.Errorf("expected rule 2 to be skipped, got %v", it)
+	}
+
+	directives := `SecMarker BEGIN
+SecAction "id:1,phase:1,pass,nolog,skipAfter:BEGIN"
+SecAction "id:2,phase:2,pass,nolog,skipAfter:MISSING"`
+	p = NewParser(coraza.NewWAF())
+	if err := p.FromString(directives); err != nil {
+		t.Fatal(err)
+	}
+	err := p.ValidateMarkers()
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+	if want := `line 2, column 1: skipAfter target "BEGIN" is only defined before rule 1, the rest of phase 1 would be skipped (and 1 more errors)`; err.Error() != want {
+		t.Errorf("expected error %q, got %q", want, err.Error())
+	}
+	diags := p.Diagnostics()
+	if len(diags) != 2 || diags[1].Line != 3 || diags[1].Token != "MISSING" || diags[1].Directive != "SecAction" {
+		t.Errorf("unexpected diagnostics %v", diags)
+	}
+
+	p = NewParser(coraza.NewWAF())
+	p.SetLenient(true)
+	if err := p.FromString(directives); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ValidateMarkers(); err != nil {
+		t.Errorf("expected warnings in lenient mode, got %v", err)
+	}
+	for _, d := range p.Diagnostics() {
+		if d.Severity != DiagnosticWarning {
+			t.Errorf("expected a warning, got %v", d)
+		}
+	}
+}
+
+func TestValidateMarkersPhases(t *testing.T) {
+	tests := []struct {
+		name       string
+		directives string
+		warning    string
+	}{
+		{
+			"consistent",
+			`SecAction "id:1,phase:1,pass,nolog,skipAfter:END"
+			SecAction "id:2,phase:2,pass,nolog,skipAfter:END"
+			SecRule ARGS "@rx a" "id:3,phase:1,deny"
+			SecRule ARGS "@rx a" "id:4,phase:2,deny"
+			SecMarker END`,
+			"",
+		},
+		{
+			"other phase",
+			`SecAction "id:1,phase:1,pass,nolog,skipAfter:END"
+			SecRule ARGS "@rx a" "id:3,phase:1,deny"
+			SecRule ARGS "@rx a" "id:4,phase:2,deny"
+			SecMarker END`,
+			`rule 4 of phase 2 before the skipAfter target "END" of rule 1 is not skipped, skipAfter doesn't cross phases`,
+		},
+		{
+			"nothing skipped",
+			`SecAction "id:1,phase:1,pass,nolog,skipAfter:END"
+			SecAction "id:2,phase:2,pass,nolog,skipAfter:END"
+			SecRule ARGS "@rx a" "id:4,phase:2,deny"
+			SecMarker END`,
+			`skipAfter target "END" of rule 1 skips no rule of phase 1`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewParser(coraza.NewWAF())
+			if err := p.FromString(tt.directives); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.ValidateMarkers(); err != nil {
+				t.Fatalf("expected warnings only, got %v", err)
+			}
+			diags := p.Diagnostics()
+			if tt.warning == "" {
+				if len(diags) > 0 {
+					t.Errorf("unexpected diagnostics %v", diags)
+				}
+				return
+			}
+			if len(diags) != 1 || diags[0].Severity != DiagnosticWarning || diags[0].Message != tt.warning || diags[0].Line != 1 {
+				t.Errorf("unexpected diagnostics %v", diags)
+			}
+		})
+	}
+}
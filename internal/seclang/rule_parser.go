@@ -34,6 +34,8 @@ type RuleParser struct {
 	rule           *corazawaf.Rule
 	defaultActions map[types.RulePhase][]ruleAction
 	options        RuleOptions
+	// chained is true for the rules following a chain starter
+	chained bool
 }
 
 // ParseVariables parses variables from a string and transforms it into
@@ -71,7 +73,7 @@ func (p *RuleParser) ParseVariables(vars string) error {
 			}
 			v, err := variables.Parse(string(curVar))
 			if err != nil {
-				return err
+				return newTokenError(string(curVar), err)
 			}
 			// fmt.Printf("(PREVIOUS %s) %s:%s (%t %t)\n", vars, curvar, curkey, iscount, isnegation)
 			if isquoted {
@@ -190,11 +192,13 @@ func (p *RuleParser) ParseOperator(operator string) error {
 			p.options.Config.Get("parser_config_dir", "").(string),
 			p.options.Config.Get("working_dir", "").(string),
 		},
-		Root: p.options.Config.Get("parser_root", io.OSFS{}).(fs.FS),
+		Root:        p.options.Config.Get("parser_root", io.OSFS{}).(fs.FS),
+		RegexEngine: p.options.WAF.RegexEngine,
+		Memoizer:    p.options.WAF.Memoizer,
 	}
 	opfn, err := operators.Get(op, opts)
 	if err != nil {
-		return err
+		return newTokenError(op, err)
 	}
 	p.rule.SetOperator(opfn, opRaw, opdata)
 	return nil
@@ -208,10 +212,11 @@ func (p *RuleParser) ParseOperator(operator string) error {
 // Each rule on the indicated phase will inherit the previously declared actions
 // If the user overwrites the default actions, the default actions will be overwritten
 func (p *RuleParser) ParseDefaultActions(actions string) error {
-	act, err := parseActions(actions)
+	act, err := parseActions(actions, p.options.Config.Get("parser_lenient", false).(bool))
 	if err != nil {
 		return err
 	}
+	act = supportedActions(act, nil)
 	phase := types.RulePhase(0)
 	defaultDisruptive := ""
 	for _, action := range act {
@@ -236,14 +241,27 @@ func (p *RuleParser) ParseDefaultActions(actions string) error {
 	return nil
 }
 
+// defaultActionsPhase validates the default actions and returns their phase
+func defaultActionsPhase(actions string) (types.RulePhase, error) {
+	rp := &RuleParser{defaultActions: map[types.RulePhase][]ruleAction{}}
+	if err := rp.ParseDefaultActions(actions); err != nil {
+		return 0, err
+	}
+	for phase := range rp.defaultActions {
+		return phase, nil
+	}
+	return 0, nil
+}
+
 // ParseActions parses a comma separated list of actions:arguments
 // Arguments can be wrapper inside quotes
 func (p *RuleParser) ParseActions(actions string) error {
 	disabledActions := p.options.Config.Get("disabled_rule_actions", []string{}).([]string)
-	act, err := parseActions(actions)
+	act, err := parseActions(actions, p.options.Config.Get("parser_lenient", false).(bool))
 	if err != nil {
 		return err
 	}
+	act = supportedActions(act, p.options.warn)
 	// check if forbidden action:
 	for _, a := range act {
 		if utils.InSlice(a.Key, disabledActions) {
@@ -259,10 +277,21 @@ func (p *RuleParser) ParseActions(actions string) error {
 		}
 	}
 
-	phase := p.rule.Phase_
-
-	defaults := p.defaultActions[phase]
-	if defaults != nil {
+	if p.chained {
+		// chained rules don't inherit the default actions, the disruptive
+		// and flow actions of the chain are set by the chain starter
+		chainActs := act[:0]
+		for _, a := range act {
+			if a.Atype == rules.ActionTypeDisruptive || a.Key == "skip" || a.Key == "skipafter" {
+				if w := p.options.WAF; w != nil {
+					w.Logger.Warn("Ignoring action %s, it can only be specified by chain starter rules", a.Key)
+				}
+				continue
+			}
+			chainActs = append(chainActs, a)
+		}
+		act = chainActs
+	} else if defaults := p.defaultActions[p.rule.Phase_]; defaults != nil {
 		act = mergeActions(act, defaults)
 	}
 
@@ -293,6 +322,8 @@ type RuleOptions struct {
 	Config       types.Config
 	Directive    string
 	Data         string
+	// warn reports the non fatal problems of the rule
+	warn func(token string, message string)
 }
 
 // ruleTokenRegex splits the sections operator and actions.
@@ -309,15 +340,18 @@ func ParseRule(options RuleOptions) (*corazawaf.Rule, error) {
 	}
 
 	var err error
+	parent := getLastRuleExpectingChain(options.WAF)
 	rp := &RuleParser{
 		options:        options,
 		rule:           corazawaf.NewRule(),
 		defaultActions: map[types.RulePhase][]ruleAction{},
+		chained:        parent != nil,
 	}
+	rp.rule.UnicodeMap = options.WAF.UnicodeMap
 
-	defaultActions := options.Config.Get("rule_default_actions", []string{
-		defaultActionsPhase2,
-	}).([]string)
+	// the built-in defaults are kept for the phases without a declaration
+	defaultActions := append([]string{defaultActionsPhase2},
+		options.Config.Get("rule_default_actions", []string{}).([]string)...)
 	disabledRuleOperators := options.Config.Get("disabled_rule_operators", []string{}).([]string)
 
 	for _, da := range defaultActions {
@@ -366,13 +400,12 @@ func ParseRule(options RuleOptions) (*corazawaf.Rule, error) {
 	rule.File_ = options.Config.Get("parser_config_file", "").(string)
 	rule.Line_ = options.Config.Get("parser_last_line", 0).(int)
 
-	if parent := getLastRuleExpectingChain(options.WAF); parent != nil {
+	if parent != nil {
 		rule.ParentID_ = parent.ID_
 		lastChain := parent
 		for lastChain.Chain != nil {
 			lastChain = lastChain.Chain
 		}
-		// TODO we must remove defaultactions from chains
 		rule.Phase_ = 0
 		lastChain.Chain = rule
 		return nil, nil
@@ -400,7 +433,8 @@ func getLastRuleExpectingChain(w *corazawaf.WAF) *corazawaf.Rule {
 // parseActions will assign the function name, arguments and
 // function (pkg.actions) for each action split by comma (,)
 // Action arguments are allowed to wrap values between colons(”)
-func parseActions(actions string) ([]ruleAction, error) {
+// Unknown actions are returned without function if lenient is true
+func parseActions(actions string, lenient bool) ([]ruleAction, error) {
 	iskey := true
 	ckey := ""
 	cval := ""
@@ -413,16 +447,11 @@ actionLoop:
 			// skip whitespaces in key
 			continue actionLoop
 		case !quoted && c == ',':
-			f, err := actionsmod.Get(ckey)
+			a, err := newRuleAction(ckey, cval, lenient)
 			if err != nil {
 				return nil, err
 			}
-			res = append(res, ruleAction{
-				Key:   ckey,
-				Value: cval,
-				F:     f,
-				Atype: f.Type(),
-			})
+			res = append(res, a)
 			ckey = ""
 			cval = ""
 			iskey = true
@@ -445,21 +474,58 @@ actionLoop:
 			ckey += string(c)
 		}
 		if i+1 == len(actions) {
-			f, err := actionsmod.Get(ckey)
+			a, err := newRuleAction(ckey, cval, lenient)
 			if err != nil {
 				return nil, err
 			}
-			res = append(res, ruleAction{
-				Key:   ckey,
-				Value: cval,
-				F:     f,
-				Atype: f.Type(),
-			})
+			res = append(res, a)
 		}
 	}
 	return res, nil
 }
 
+// newRuleAction returns the action named key, the ModSecurity actions
+// unsupported by Coraza, and the unknown ones if lenient is true, are
+// returned without function
+func newRuleAction(key string, value string, lenient bool) (ruleAction, error) {
+	if unsupportedActions[strings.ToLower(key)] {
+		return ruleAction{Key: key, Value: value}, nil
+	}
+	f, err := actionsmod.Get(key)
+	if err != nil {
+		if lenient {
+			return ruleAction{Key: key, Value: value}, nil
+		}
+		return ruleAction{}, newTokenError(key, err)
+	}
+	return ruleAction{
+		Key:   key,
+		Value: value,
+		F:     f,
+		Atype: f.Type(),
+	}, nil
+}
+
+// supportedActions removes the unsupported actions, warn is called for
+// each of them if it is not nil
+func supportedActions(act []ruleAction, warn func(token string, message string)) []ruleAction {
+	res := act[:0]
+	for _, a := range act {
+		if a.F == nil {
+			switch {
+			case warn == nil:
+			case unsupportedActions[strings.ToLower(a.Key)]:
+				warn(a.Key, fmt.Sprintf("action %q is not supported, it is ignored", a.Key))
+			default:
+				warn(a.Key, fmt.Sprintf("unknown action %q, it is ignored", a.Key))
+			}
+			continue
+		}
+		res = append(res, a)
+	}
+	return res
+}
+
 /*
 So here is my research:
 SecDefaultAction must contain a phase and a disruptive action
@@ -471,12 +537,23 @@ SecDefaultAction "phase:2,deny,status:403,log"
 Then we have a Rule:
 SecAction "id:1, phase:2, block, nolog"
 The rule ID 1 will inherit default actions and become
-SecAction "id:1, phase:2, status:403, log, nolog, deny"
-In the future I shall optimize that redundant log and nolog, it won't actually change anything but would look cooler
+SecAction "id:1, phase:2, status:403, nolog, deny"
+The default log is dropped as the rule sets its own logging
 */
 func mergeActions(origin []ruleAction, defaults []ruleAction) []ruleAction {
 	var res []ruleAction
 	var da ruleAction // Disruptive action
+	// the logging actions of the rule replace the default ones, log and
+	// nolog also replace the default auditlog and noauditlog they imply
+	logSet, auditSet := false, false
+	for _, action := range origin {
+		switch strings.ToLower(action.Key) {
+		case "log", "nolog":
+			logSet, auditSet = true, true
+		case "auditlog", "noauditlog":
+			auditSet = true
+		}
+	}
 	for _, action := range defaults {
 		if action.Atype == rules.ActionTypeDisruptive {
 			da = action
@@ -485,6 +562,16 @@ func mergeActions(origin []ruleAction, defaults []ruleAction) []ruleAction {
 		if action.Atype == rules.ActionTypeMetadata {
 			continue
 		}
+		switch strings.ToLower(action.Key) {
+		case "log", "nolog":
+			if logSet {
+				continue
+			}
+		case "auditlog", "noauditlog":
+			if auditSet {
+				continue
+			}
+		}
 		res = append(res, action)
 	}
 	hasDa := false
@@ -4,6 +4,7 @@
 package seclang
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
@@ -108,8 +109,9 @@ func TestSecRuleUpdateTargetVariableNegation(t *testing.T) {
 		SecRule REQUEST_URI|REQUEST_COOKIES "abc" "id:8,phase:2"
 		SecRuleUpdateTargetById 8 "!REQUEST_HEADERS:"
 	`)
-	if err.Error() != "unknown variable" {
-		t.Errorf("Error should be unknown variable, got %s", err.Error())
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Err.Error() != "unknown variable" || pe.Token != "REQUEST_HEADERS:" {
+		t.Errorf("Error should be unknown variable, got %v", err)
 	}
 
 	// Try to update undefined rule
@@ -117,7 +119,7 @@ func TestSecRuleUpdateTargetVariableNegation(t *testing.T) {
 		SecRule REQUEST_URI|REQUEST_COOKIES "abc" "id:9,phase:2"
 		SecRuleUpdateTargetById 99 "!REQUEST_HEADERS:xyz"
 	`)
-	if err.Error() != "cannot create a variable exception for an undefined rule" {
+	if !errors.As(err, &pe) || pe.Err.Error() != "cannot create a variable exception for an undefined rule" {
 		t.Error("Error should be cannot create a variable exception for an undefined rule, got ",
 			err)
 	}
@@ -130,8 +132,9 @@ func TestErrorLine(t *testing.T) {
 	if err == nil {
 		t.Error("expected error")
 	}
-	if !strings.Contains(err.Error(), "Line 3") {
-		t.Errorf("failed to find error line, got %s", err.Error())
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Line != 3 || pe.Column != 1 || pe.Token != "Somefaulty" {
+		t.Errorf("failed to find error line, got %v", err)
 	}
 }
 
@@ -155,3 +158,37 @@ func TestDefaultActionsForPhase2(t *testing.T) {
 		t.Error("phase 1 rules shouldn't have log set by default actions")
 	}
 }
+
+func TestLoggingActions(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	p := NewParser(waf)
+	err := p.FromString(`
+	SecDefaultAction "phase:1,log,auditlog,pass"
+	SecAction "id:1,phase:1"
+	SecAction "id:2,phase:1,nolog"
+	SecAction "id:3,phase:1,auditlog,nolog"
+	SecAction "id:4,phase:1,noauditlog,log"
+	SecAction "id:5,phase:1,noauditlog"
+	SecAction "id:6,phase:2,nolog,auditlog"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		id    int
+		log   bool
+		audit bool
+	}{
+		{1, true, true},
+		{2, false, false},
+		{3, false, true},
+		{4, true, false},
+		{5, true, false},
+		{6, false, true},
+	}
+	for _, tt := range tests {
+		r := waf.Rules.FindByID(tt.id)
+		if r.Log != tt.log || r.Audit != tt.audit {
+			t.Errorf("unexpected logging of rule %d, want log %t and audit %t, got %t and %t", tt.id, tt.log, tt.audit, r.Log, r.Audit)
+		}
+	}
+}
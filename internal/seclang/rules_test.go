@@ -4,9 +4,16 @@
 package seclang
 
 import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
 
 	"github.com/corazawaf/coraza/v3/internal/corazawaf"
 	"github.com/corazawaf/coraza/v3/types"
@@ -188,6 +195,84 @@ func TestRuleChains(t *testing.T) {
 	}
 }
 
+func TestChainFlowControl(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	parser := NewParser(waf)
+	err := parser.FromString(`
+		SecRuleEngine DetectionOnly
+		SecDefaultAction "phase:1,log,auditlog,pass,t:lowercase"
+		SecRule ARGS:a "@streq 1" "id:1,phase:1,skipAfter:END_CHAINS,chain"
+			SecRule ARGS:b "@streq X" "deny"
+		SecAction "id:2,phase:1,log"
+		SecMarker END_CHAINS
+		SecAction "id:3,phase:1,log,skip:1"
+		SecMarker UNUSED
+		SecAction "id:4,phase:1,log"
+		SecAction "id:5,phase:1,log"
+		SecAction "id:6,phase:1,log,skipAfter:MISSING"
+		SecAction "id:7,phase:1,log"
+		SecAction "id:8,phase:2,log"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chained := waf.Rules.FindByID(1).Chain
+	if chained.Disruptive {
+		t.Error("expected the disruptive action of the chained rule to be ignored")
+	}
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/?a=1&b=X", "GET", "HTTP/1.1")
+	tx.ProcessRequestHeaders()
+	if _, err := tx.ProcessRequestBody(); err != nil {
+		t.Fatal(err)
+	}
+	var matched []int
+	for _, mr := range tx.MatchedRules() {
+		matched = append(matched, mr.Rule().ID())
+	}
+	// the chained rule doesn't inherit t:lowercase, skip doesn't count
+	// markers and skipAfter doesn't cross phases
+	if fmt.Sprint(matched) != "[1 3 5 6 8]" {
+		t.Errorf("unexpected matched rules %v", matched)
+	}
+}
+
+func TestMatchedRuleDetails(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	parser := NewParser(waf)
+	err := parser.FromString(`
+		SecRule ARGS:user "@rx ^(adm)(in)$" "phase:1,id:1,log,capture,t:lowercase,chain"
+			SecRule REQUEST_METHOD "@streq POST" "t:none"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/?user=ADMIN", "POST", "HTTP/1.1")
+	tx.ProcessRequestHeaders()
+	if len(tx.MatchedRules()) != 1 {
+		t.Fatalf("expected 1 matched rule, got %d", len(tx.MatchedRules()))
+	}
+	mr := tx.MatchedRules()[0]
+	if len(mr.Chain()) != 2 || mr.Chain()[0].ID() != 1 || mr.Chain()[1] == mr.Rule() {
+		t.Errorf("unexpected chain %v", mr.Chain())
+	}
+	mds := mr.ChainMatches(0)
+	if len(mds) != 1 {
+		t.Fatalf("expected 1 match for the chain starter, got %d", len(mds))
+	}
+	if mds[0].Value() != "admin" || mds[0].RawValue() != "ADMIN" {
+		t.Errorf("unexpected values %q and %q", mds[0].Value(), mds[0].RawValue())
+	}
+	if c := mds[0].Captures(); len(c) != 3 || c[0] != "admin" || c[1] != "adm" || c[2] != "in" {
+		t.Errorf("unexpected captures %q", c)
+	}
+	mds = mr.ChainMatches(1)
+	if len(mds) != 1 || mds[0].Value() != "POST" || len(mds[0].Captures()) != 0 {
+		t.Errorf("unexpected chained matches %v", mds)
+	}
+}
+
 func TestTagsAreNotPrintedTwice(t *testing.T) {
 	waf := corazawaf.NewWAF()
 	var logs []string
@@ -975,3 +1060,888 @@ BINARYDATA
 		t.Error("failed test for rx captured")
 	}
 }
+
+func TestRawInputOperator(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	parser := NewParser(waf)
+	err := parser.FromString(`
+		SecRule ARGS "@validateByteRange 32-126" "id:1,phase:1,t:urlDecode,log,pass"
+		SecRule ARGS "@validateByteRange raw:32-126" "id:2,phase:1,t:urlDecode,log,pass"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.AddArgument(types.ArgumentGET, "id", "a%00b")
+	tx.ProcessRequestHeaders()
+	if len(tx.MatchedRules()) != 1 || tx.MatchedRules()[0].Rule().ID() != 1 {
+		t.Errorf("expected only the transformed rule to match, got %d matches", len(tx.MatchedRules()))
+	}
+}
+
+func TestPauseAction(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	parser := NewParser(waf)
+	err := parser.FromString(`
+		SecPauseLimit 1500
+		SecRule ARGS:id "@eq 1" "id:1,phase:1,pause:1000,log"
+		SecRule ARGS:id "@eq 1" "id:2,phase:1,pause:1000~200,log"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.AddArgument(types.ArgumentGET, "id", "1")
+	tx.ProcessRequestHeaders()
+	if tx.Interruption() != nil {
+		t.Error("pause must not interrupt the transaction")
+	}
+	if d := tx.PauseDuration(); d != 1500*time.Millisecond {
+		t.Errorf("expected pause to be capped to 1.5s, got %s", d)
+	}
+	if err := parser.FromString(`SecRule ARGS "@eq 1" "id:3,phase:1,pause:abc"`); err == nil {
+		t.Error("expected error for invalid pause duration")
+	}
+}
+
+func TestSecRulePerfTime(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	parser := NewParser(waf)
+	err := parser.FromString(`
+		SecRulePerfTime 0
+		SecRule ARGS:id "@eq 1" "id:1,phase:1,pass,nolog"
+		SecRule PERF_RULES "@gt 0" "id:2,phase:2,pass,log"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.AddArgument(types.ArgumentGET, "id", "1")
+	tx.ProcessRequestHeaders()
+	if _, err := tx.ProcessRequestBody(); err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.PerfStats().Rules) != 0 {
+		t.Error("rules must not be timed without a threshold")
+	}
+	for _, mr := range tx.MatchedRules() {
+		if mr.Rule().ID() == 2 {
+			t.Error("PERF_RULES must be empty without a threshold")
+		}
+	}
+
+	if err := parser.FromString("SecRulePerfTime 1"); err != nil {
+		t.Fatal(err)
+	}
+	if waf.RulePerfTime != time.Microsecond {
+		t.Errorf("unexpected threshold %s", waf.RulePerfTime)
+	}
+	if err := parser.FromString("SecRulePerfTime abc"); err == nil {
+		t.Error("expected error for invalid threshold")
+	}
+}
+
+func TestArgumentSeparator(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	parser := NewParser(waf)
+	err := parser.FromString(`
+		SecRequestBodyAccess On
+		SecArgumentSeparator &;
+		SecRule ARGS_GET:b "@streq 2" "id:1,phase:1,pass,log"
+		SecRule ARGS_POST:d "@streq 4" "id:2,phase:2,pass,log"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/?a=1;b=2", "POST", "HTTP/1.1")
+	tx.AddRequestHeader("Content-Type", "application/x-www-form-urlencoded")
+	tx.ProcessRequestHeaders()
+	if _, _, err := tx.WriteRequestBody([]byte("c=3;d=4")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ProcessRequestBody(); err != nil {
+		t.Fatal(err)
+	}
+	matched := map[int]bool{}
+	for _, mr := range tx.MatchedRules() {
+		matched[mr.Rule().ID()] = true
+	}
+	for _, id := range []int{1, 2} {
+		if !matched[id] {
+			t.Errorf("expected rule %d to match", id)
+		}
+	}
+
+	if err := parser.FromString("SecArgumentSeparator"); err == nil {
+		t.Error("expected error for missing separator")
+	}
+	if err := parser.FromString("SecArgumentSeparator ="); err == nil {
+		t.Error("expected error for invalid separator")
+	}
+}
+
+func TestBodyArgumentsCaseInsensitive(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	parser := NewParser(waf)
+	err := parser.FromString(`
+		SecRequestBodyAccess On
+		SecRule ARGS_POST:UserName "@streq admin" "id:1,phase:2,pass,log,msg:'%{MATCHED_VAR_NAME}'"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/", "POST", "HTTP/1.1")
+	tx.AddRequestHeader("Content-Type", "application/x-www-form-urlencoded")
+	tx.ProcessRequestHeaders()
+	if _, _, err := tx.WriteRequestBody([]byte("userName=admin")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ProcessRequestBody(); err != nil {
+		t.Fatal(err)
+	}
+	mr := tx.MatchedRules()
+	if len(mr) != 1 {
+		t.Fatal("expected the body argument to match regardless of its casing")
+	}
+	if mr[0].Message() != "ARGS_POST:userName" {
+		t.Errorf("expected the original casing in the logs, got %q", mr[0].Message())
+	}
+}
+
+func TestArgumentsLimit(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	parser := NewParser(waf)
+	err := parser.FromString(`
+		SecRequestBodyAccess On
+		SecArgumentsLimit 2
+		SecArgumentValueLengthLimit 4
+		SecRule URLENCODED_ERROR "@contains more than 2 arguments" "id:1,phase:1,pass,log"
+		SecRule &ARGS_GET "@eq 2" "id:2,phase:1,pass,log"
+		SecRule REQBODY_ERROR "@eq 1" "id:3,phase:2,pass,log"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/?a=1&b=2&c=3", "POST", "HTTP/1.1")
+	tx.AddRequestHeader("Content-Type", "application/x-www-form-urlencoded")
+	if it := tx.ProcessRequestHeaders(); it != nil {
+		t.Fatal("unexpected interruption")
+	}
+	if _, _, err := tx.WriteRequestBody([]byte("a=12345")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ProcessRequestBody(); err != nil {
+		t.Fatal(err)
+	}
+	matched := map[int]bool{}
+	for _, mr := range tx.MatchedRules() {
+		matched[mr.Rule().ID()] = true
+	}
+	for _, id := range []int{1, 2, 3} {
+		if !matched[id] {
+			t.Errorf("expected rule %d to match", id)
+		}
+	}
+
+	if err := parser.FromString("SecArgumentsLimitAction Reject"); err != nil {
+		t.Fatal(err)
+	}
+	tx = waf.NewTransaction()
+	tx.ProcessURI("/?a=1&b=2&c=3", "GET", "HTTP/1.1")
+	if it := tx.ProcessRequestHeaders(); it == nil || it.Status != 403 {
+		t.Errorf("expected the transaction to be rejected, got %v", it)
+	}
+
+	// DetectionOnly flags the transaction without rejecting it
+	if err := parser.FromString(`
+		SecRuleEngine DetectionOnly
+		SecRule INBOUND_ERROR_DATA "@eq 1" "id:4,phase:1,pass,log"
+	`); err != nil {
+		t.Fatal(err)
+	}
+	tx = waf.NewTransaction()
+	tx.ProcessURI("/?a=1&b=2&c=3", "GET", "HTTP/1.1")
+	if it := tx.ProcessRequestHeaders(); it != nil {
+		t.Errorf("unexpected interruption %v", it)
+	}
+	matched = map[int]bool{}
+	for _, mr := range tx.MatchedRules() {
+		matched[mr.Rule().ID()] = true
+	}
+	if !matched[4] {
+		t.Error("expected INBOUND_ERROR_DATA to be set")
+	}
+
+	for _, d := range []string{"SecArgumentsLimit -1", "SecArgumentNameLengthLimit a", "SecArgumentsLimitAction Drop"} {
+		if err := parser.FromString(d); err == nil {
+			t.Errorf("expected error for %q", d)
+		}
+	}
+}
+
+func TestTransactionMemoryLimit(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	parser := NewParser(waf)
+	err := parser.FromString(`
+		SecTransactionMemoryLimit 1024
+		SecRule MEMORY_LIMIT_EXCEEDED "@eq 1" "id:1,phase:1,pass,log"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	for i := 0; i < 100; i++ {
+		tx.AddRequestHeader(fmt.Sprintf("X-Header-%d", i), "value")
+	}
+	tx.ProcessRequestHeaders()
+	if len(tx.MatchedRules()) != 1 {
+		t.Error("expected the memory limit to be exceeded")
+	}
+	if n := len(tx.Variables().RequestHeaders().FindAll()); n == 0 || n == 100 {
+		t.Errorf("expected some headers to be discarded, got %d", n)
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the usage is reset with the pooled transactions
+	tx = waf.NewTransaction()
+	tx.AddRequestHeader("Host", "example.com")
+	tx.ProcessRequestHeaders()
+	if len(tx.MatchedRules()) != 0 {
+		t.Error("unexpected memory limit exceeded")
+	}
+
+	if err := parser.FromString("SecTransactionMemoryLimit -1"); err == nil {
+		t.Error("expected error for invalid limit")
+	}
+}
+
+func TestStreamBodyInspection(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	parser := NewParser(waf)
+	err := parser.FromString(`
+		SecRequestBodyAccess On
+		SecResponseBodyAccess On
+		SecStreamInBodyInspection On
+		SecStreamOutBodyInspection On
+		SecRule STREAM_INPUT_BODY "@rsub s/password=[^&]*/password=xxx/" "id:1,phase:2,pass,log,t:none"
+		SecRule ARGS_POST:password "@streq xxx" "id:2,phase:2,pass,log"
+		SecRule STREAM_OUTPUT_BODY "@rsub s/secret/[redacted]/" "id:3,phase:4,pass,log,t:none"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/", "POST", "HTTP/1.1")
+	tx.AddRequestHeader("Content-Type", "application/x-www-form-urlencoded")
+	tx.ProcessRequestHeaders()
+	if _, _, err := tx.WriteRequestBody([]byte("user=admin&password=1234")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ProcessRequestBody(); err != nil {
+		t.Fatal(err)
+	}
+	tx.AddResponseHeader("Content-Type", "text/html")
+	tx.ProcessResponseHeaders(200, "HTTP/1.1")
+	if _, err := tx.ResponseBodyBuffer.Write([]byte("the secret is a secret")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ProcessResponseBody(); err != nil {
+		t.Fatal(err)
+	}
+	matched := map[int]bool{}
+	for _, mr := range tx.MatchedRules() {
+		matched[mr.Rule().ID()] = true
+	}
+	// the arguments are parsed before the substitution
+	if !matched[1] || matched[2] || !matched[3] {
+		t.Errorf("unexpected matched rules %v", matched)
+	}
+	reader, err := tx.RequestBodyReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb := strings.Builder{}
+	if _, err := io.Copy(&sb, reader); err != nil {
+		t.Fatal(err)
+	}
+	if sb.String() != "user=admin&password=xxx" {
+		t.Errorf("unexpected request body %q", sb.String())
+	}
+	reader, err = tx.ResponseBodyReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb.Reset()
+	if _, err := io.Copy(&sb, reader); err != nil {
+		t.Fatal(err)
+	}
+	if sb.String() != "the [redacted] is a [redacted]" {
+		t.Errorf("unexpected response body %q", sb.String())
+	}
+}
+
+func brotliCompressed(t *testing.T, data string) []byte {
+	t.Helper()
+	buf := bytes.Buffer{}
+	bw := brotli.NewWriter(&buf)
+	if _, err := bw.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestResponseBodyDecompression(t *testing.T) {
+	gzipped := func(data string) []byte {
+		buf := bytes.Buffer{}
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	waf := corazawaf.NewWAF()
+	parser := NewParser(waf)
+	err := parser.FromString(`
+		SecResponseBodyAccess On
+		SecResponseBodyDecompressionRatio 10
+		SecRule RESPONSE_BODY "@contains secret" "id:1,phase:4,pass,log"
+		SecRule RESPONSE_BODY_DECOMPRESSION_ERROR "@eq 1" "id:2,phase:4,pass,log"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		matched  map[int]bool
+	}{
+		{"gzip", "gzip", gzipped("the secret"), map[int]bool{1: true}},
+		{"br", "br", brotliCompressed(t, "the secret"), map[int]bool{1: true}},
+		{"identity", "", []byte("the secret"), map[int]bool{1: true}},
+		// unsupported codings are inspected as is
+		{"unsupported", "compress", []byte("the secret"), map[int]bool{1: true}},
+		{"invalid", "gzip", []byte("not compressed"), map[int]bool{2: true}},
+		{"empty", "gzip", nil, map[int]bool{}},
+		{"bomb", "gzip", gzipped("the secret" + strings.Repeat("a", 10000)), map[int]bool{1: true, 2: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := waf.NewTransaction()
+			tx.AddResponseHeader("Content-Type", "text/html")
+			if tt.encoding != "" {
+				tx.AddResponseHeader("Content-Encoding", tt.encoding)
+			}
+			tx.ProcessResponseHeaders(200, "HTTP/1.1")
+			if _, err := tx.ResponseBodyBuffer.Write(tt.body); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tx.ProcessResponseBody(); err != nil {
+				t.Fatal(err)
+			}
+			matched := map[int]bool{}
+			for _, mr := range tx.MatchedRules() {
+				matched[mr.Rule().ID()] = true
+			}
+			if fmt.Sprint(matched) != fmt.Sprint(tt.matched) {
+				t.Errorf("want matched rules %v, have %v", tt.matched, matched)
+			}
+			// the response is not modified
+			reader, err := tx.ResponseBodyReader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body, _ := io.ReadAll(reader); !bytes.Equal(body, tt.body) {
+				t.Error("unexpected response body change")
+			}
+		})
+	}
+
+	if err := parser.FromString("SecResponseBodyDecompressionRatio -1"); err == nil {
+		t.Error("expected error for invalid ratio")
+	}
+}
+
+func TestRequestBodyDecompression(t *testing.T) {
+	gzipped := func(data string) []byte {
+		buf := bytes.Buffer{}
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	tests := []struct {
+		name       string
+		directives string
+		encoding   string
+		body       []byte
+		matched    map[int]bool
+		reject     bool
+	}{
+		{"gzip", "", "gzip", gzipped("q=attack"), map[int]bool{1: true}, false},
+		{"br", "", "br", brotliCompressed(t, "q=attack"), map[int]bool{1: true}, false},
+		{"disabled", "SecRequestBodyDecompression Off", "gzip", gzipped("q=attack"), map[int]bool{}, false},
+		{"invalid", "", "gzip", []byte("q=attack"), map[int]bool{1: true, 2: true}, false},
+		{"br bomb", "SecRequestBodyDecompressionRatio 10", "br", brotliCompressed(t, "q=attack"+strings.Repeat("a", 10000)), map[int]bool{2: true}, false},
+		{"bomb", "SecRequestBodyDecompressionRatio 10", "gzip", gzipped("q=attack" + strings.Repeat("a", 10000)), map[int]bool{2: true}, false},
+		{"bomb rejected", "SecRequestBodyDecompressionRatio 10", "gzip", gzipped("q=attack" + strings.Repeat("a", 10000)), map[int]bool{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waf := corazawaf.NewWAF()
+			parser := NewParser(waf)
+			err := parser.FromString(`
+				SecRequestBodyAccess On
+				SecRule ARGS_POST:q "@streq attack" "id:1,phase:2,pass,log"
+				SecRule REQUEST_BODY_DECOMPRESSION_ERROR "@eq 1" "id:2,phase:2,pass,log"
+			` + tt.directives)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.reject {
+				waf.RequestBodyLimitAction = types.RequestBodyLimitActionReject
+			}
+			tx := waf.NewTransaction()
+			tx.ProcessURI("/", "POST", "HTTP/1.1")
+			tx.AddRequestHeader("Content-Type", "application/x-www-form-urlencoded")
+			tx.AddRequestHeader("Content-Encoding", tt.encoding)
+			tx.ProcessRequestHeaders()
+			if _, _, err := tx.WriteRequestBody(tt.body); err != nil {
+				t.Fatal(err)
+			}
+			it, err := tx.ProcessRequestBody()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (it != nil) != tt.reject {
+				t.Errorf("unexpected interruption %v", it)
+			}
+			matched := map[int]bool{}
+			for _, mr := range tx.MatchedRules() {
+				matched[mr.Rule().ID()] = true
+			}
+			if fmt.Sprint(matched) != fmt.Sprint(tt.matched) {
+				t.Errorf("want matched rules %v, have %v", tt.matched, matched)
+			}
+		})
+	}
+}
+
+func TestRequestBodyProcessorRouting(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	parser := NewParser(waf)
+	err := parser.FromString(`
+		SecRequestBodyAccess On
+		SecRequestBodyProcessor application/x-ndjson-custom JSON
+		SecRequestBodyProcessorSniffing On
+		SecRule REQBODY_PROCESSOR "@rx ^(?:JSON|XML)$" "id:1,phase:2,pass,log"
+		SecRule ARGS_POST:json.user "@streq admin" "id:2,phase:2,pass,log"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		contentType string
+		body        string
+		matched     map[int]bool
+	}{
+		{"application/x-ndjson-custom", `{"user":"admin"}`, map[int]bool{1: true, 2: true}},
+		{"", "  \n[{\"user\":\"admin\"}]", map[int]bool{1: true}},
+		{"text/plain", "<a>b</a>", map[int]bool{1: true}},
+		{"text/plain", "user=admin", map[int]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType+tt.body, func(t *testing.T) {
+			tx := waf.NewTransaction()
+			tx.ProcessURI("/", "POST", "HTTP/1.1")
+			if tt.contentType != "" {
+				tx.AddRequestHeader("Content-Type", tt.contentType)
+			}
+			tx.ProcessRequestHeaders()
+			if _, _, err := tx.WriteRequestBody([]byte(tt.body)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tx.ProcessRequestBody(); err != nil {
+				t.Fatal(err)
+			}
+			matched := map[int]bool{}
+			for _, mr := range tx.MatchedRules() {
+				matched[mr.Rule().ID()] = true
+			}
+			if fmt.Sprint(matched) != fmt.Sprint(tt.matched) {
+				t.Errorf("want matched rules %v, have %v", tt.matched, matched)
+			}
+		})
+	}
+
+	for _, d := range []string{"SecRequestBodyProcessor application/json", "SecRequestBodyProcessor application/json UNKNOWN"} {
+		if err := parser.FromString(d); err == nil {
+			t.Errorf("expected error for %q", d)
+		}
+	}
+}
+
+func TestRequestBodyMethodProcessors(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	parser := NewParser(waf)
+	err := parser.FromString(`
+		SecRequestBodyAccess On
+		SecRequestBodyMethodProcessor MKCOL JSON
+		SecRequestBodyMethodProcessor proppatch none
+		SecRule REQBODY_PROCESSOR "@streq XML" "id:1,phase:2,pass,log"
+		SecRule REQBODY_PROCESSOR "@streq JSON" "id:2,phase:2,pass,log"
+		SecRule ARGS_POST:a "@streq b" "id:3,phase:2,pass,log"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		method      string
+		contentType string
+		body        string
+		matched     map[int]bool
+	}{
+		{"PROPFIND", "text/xml", `<propfind xmlns="DAV:"><allprop/></propfind>`, map[int]bool{1: true}},
+		{"REPORT", "", `<sync-collection xmlns="DAV:"/>`, map[int]bool{1: true}},
+		// the Content-Type wins over the method
+		{"SEARCH", "application/x-www-form-urlencoded", "a=b", map[int]bool{3: true}},
+		{"MKCOL", "", `{"a":"b"}`, map[int]bool{2: true}},
+		{"PROPPATCH", "text/xml", "a=b", map[int]bool{}},
+		{"POST", "text/xml", `<a>b</a>`, map[int]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			tx := waf.NewTransaction()
+			tx.ProcessURI("/dav/", tt.method, "HTTP/1.1")
+			if tt.contentType != "" {
+				tx.AddRequestHeader("Content-Type", tt.contentType)
+			}
+			tx.ProcessRequestHeaders()
+			if _, _, err := tx.WriteRequestBody([]byte(tt.body)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tx.ProcessRequestBody(); err != nil {
+				t.Fatal(err)
+			}
+			matched := map[int]bool{}
+			for _, mr := range tx.MatchedRules() {
+				matched[mr.Rule().ID()] = true
+			}
+			if fmt.Sprint(matched) != fmt.Sprint(tt.matched) {
+				t.Errorf("want matched rules %v, have %v", tt.matched, matched)
+			}
+		})
+	}
+
+	for _, d := range []string{"SecRequestBodyMethodProcessor PROPFIND", "SecRequestBodyMethodProcessor PROPFIND UNKNOWN"} {
+		if err := parser.FromString(d); err == nil {
+			t.Errorf("expected error for %q", d)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	parser := NewParser(waf)
+	err := parser.FromString(`
+		SecRuleEngine On
+		SecRequestBodyAccess On
+		SecOpenAPISpec ./testdata/openapi.json
+		SecRule OPENAPI_OPERATION "@streq getUser" "id:1,phase:1,pass,log"
+		SecRule OPENAPI_VIOLATIONS:unknown_path "@streq path" "id:2,phase:1,pass,log"
+		SecRule &OPENAPI_VIOLATIONS:type_mismatch "@gt 0" "id:3,phase:2,pass,log"
+		SecAction "id:4,phase:1,pass,nolog,ctl:requestBodyProcessor=JSON"
+		SecRule ARGS_POST:json.name "@streq a" "id:5,phase:2,pass,log"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		method  string
+		uri     string
+		body    string
+		matched map[int]bool
+	}{
+		{"GET", "/users/1", "", map[int]bool{1: true, 4: true}},
+		{"GET", "/admin", "", map[int]bool{2: true, 4: true}},
+		{"GET", "/users/a", "", map[int]bool{1: true, 3: true, 4: true}},
+		{"PUT", "/users/1", `{"name": 1}`, map[int]bool{3: true, 4: true}},
+		// the validated body is parsed again by the body processor
+		{"PUT", "/users/1", `{"name": "a"}`, map[int]bool{4: true, 5: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.uri, func(t *testing.T) {
+			tx := waf.NewTransaction()
+			tx.ProcessURI(tt.uri, tt.method, "HTTP/1.1")
+			tx.AddRequestHeader("Content-Type", "application/json")
+			tx.ProcessRequestHeaders()
+			if _, _, err := tx.WriteRequestBody([]byte(tt.body)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tx.ProcessRequestBody(); err != nil {
+				t.Fatal(err)
+			}
+			if it := tx.Interruption(); it != nil {
+				t.Fatalf("unexpected interruption in detection mode %v", it)
+			}
+			matched := map[int]bool{}
+			for _, mr := range tx.MatchedRules() {
+				matched[mr.Rule().ID()] = true
+			}
+			if fmt.Sprint(matched) != fmt.Sprint(tt.matched) {
+				t.Errorf("want matched rules %v, have %v", tt.matched, matched)
+			}
+		})
+	}
+
+	if err := parser.FromString("SecOpenAPIAction Reject"); err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/users/1", "PUT", "HTTP/1.1")
+	tx.AddRequestHeader("Content-Type", "application/json")
+	if it := tx.ProcessRequestHeaders(); it != nil {
+		t.Fatalf("unexpected interruption %v", it)
+	}
+	it, err := tx.ProcessRequestBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if it == nil || it.Status != 400 {
+		t.Errorf("expected the missing body to be rejected, got %v", it)
+	}
+
+	for _, d := range []string{"SecOpenAPIAction Block", "SecOpenAPISpec ./testdata/unicode.mapping", "SecOpenAPISpec ./testdata/missing.json"} {
+		if err := parser.FromString(d); err == nil {
+			t.Errorf("expected error for %q", d)
+		}
+	}
+}
+
+func TestCookieParsing(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	parser := NewParser(waf)
+	err := parser.FromString(`
+		SecCookieFormat 0
+		SecCookieV0Separator ;,
+		SecRule &REQUEST_COOKIES:a "@eq 2" "id:1,phase:1,pass,log"
+		SecRule REQUEST_COOKIES:b "@streq 2" "id:2,phase:1,pass,log"
+		SecRule REQUEST_COOKIES_ERROR "@eq 1" "id:3,phase:1,pass,log,msg:'%{REQUEST_COOKIES_ERROR_MSG}'"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.AddRequestHeader("Cookie", "a=1, b=2; a=3; =x")
+	tx.ProcessRequestHeaders()
+	matched := map[int]string{}
+	for _, mr := range tx.MatchedRules() {
+		matched[mr.Rule().ID()] = mr.Message()
+	}
+	for _, id := range []int{1, 2, 3} {
+		if _, ok := matched[id]; !ok {
+			t.Errorf("expected rule %d to match", id)
+		}
+	}
+	if matched[3] != "empty cookie name" {
+		t.Errorf("unexpected error message %q", matched[3])
+	}
+
+	if err := parser.FromString("SecCookieFormat 2"); err == nil {
+		t.Error("expected error for invalid cookie format")
+	}
+	if err := parser.FromString("SecCookieV0Separator"); err == nil {
+		t.Error("expected error for missing separator")
+	}
+}
+
+func TestRequestBodyCharsetDecoding(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		waf := corazawaf.NewWAF()
+		parser := NewParser(waf)
+		directive := "SecRequestBodyCharsetDecoding On"
+		if !enabled {
+			directive = "SecRequestBodyCharsetDecoding Off"
+		}
+		err := parser.FromString(directive + `
+			SecRequestBodyAccess On
+			SecRule ARGS_POST:q "@streq café" "id:1,phase:2,pass,log"
+		`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx := waf.NewTransaction()
+		tx.AddRequestHeader("Content-Type", "application/x-www-form-urlencoded; charset=ISO-8859-1")
+		tx.ProcessRequestHeaders()
+		if _, _, err := tx.WriteRequestBody([]byte("q=caf%E9")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx.ProcessRequestBody(); err != nil {
+			t.Fatal(err)
+		}
+		if matched := len(tx.MatchedRules()) == 1; matched != enabled {
+			t.Errorf("expected match to be %t with charset decoding %t", enabled, enabled)
+		}
+	}
+	if err := NewParser(corazawaf.NewWAF()).FromString("SecRequestBodyCharsetDecoding maybe"); err == nil {
+		t.Error("expected error for invalid value")
+	}
+}
+
+func TestRuleTrace(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	parser := NewParser(waf)
+	err := parser.FromString(`
+		SecRuleEngine On
+		SecRule ARGS:id "@streq abc" "id:1,phase:1,t:lowercase,setvar:tx.score=1,chain,deny"
+			SecRule ARGS:name "@streq admin" ""
+		SecRule ARGS:id "@streq xyz" "id:2,phase:1,log"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := waf.NewTransaction()
+	tx.AddArgument(types.ArgumentGET, "id", "ABC")
+	tx.AddArgument(types.ArgumentGET, "name", "admin")
+	tx.ProcessRequestHeaders()
+	if len(tx.Trace()) != 0 {
+		t.Error("expected no trace before enabling tracing")
+	}
+
+	tx = waf.NewTransaction()
+	tx.EnableTracing()
+	tx.AddArgument(types.ArgumentGET, "id", "ABC")
+	tx.AddArgument(types.ArgumentGET, "name", "admin")
+	tx.ProcessRequestHeaders()
+	trace := tx.Trace()
+	if len(trace) != 1 {
+		t.Fatalf("expected 1 traced rule before the interruption, got %d", len(trace))
+	}
+	rt := trace[0]
+	if rt.RuleID != 1 || rt.Phase != types.PhaseRequestHeaders || !rt.Matched {
+		t.Errorf("unexpected rule trace %+v", rt)
+	}
+	if len(rt.Variables) != 2 {
+		t.Fatalf("expected 2 inspected variables, got %d", len(rt.Variables))
+	}
+	if v := rt.Variables[0]; v.Key != "id" || v.Value != "ABC" || v.TransformedValue != "abc" || v.Operator != "@streq abc" || !v.Matched {
+		t.Errorf("unexpected variable trace %+v", v)
+	}
+	if v := rt.Variables[1]; v.Key != "name" || !v.Matched {
+		t.Errorf("unexpected chained variable trace %+v", v)
+	}
+	if actions := strings.Join(rt.Actions, ","); !strings.Contains(actions, "setvar") || !strings.HasSuffix(actions, "deny") {
+		t.Errorf("unexpected actions %v", rt.Actions)
+	}
+
+	tx = waf.NewTransaction()
+	tx.EnableTracing()
+	tx.AddArgument(types.ArgumentGET, "id", "ABC")
+	tx.ProcessRequestHeaders()
+	trace = tx.Trace()
+	if len(trace) != 2 {
+		t.Fatalf("expected 2 traced rules, got %d", len(trace))
+	}
+	if trace[0].Matched || len(trace[0].Variables) != 1 {
+		t.Errorf("expected chain mismatch to be traced, got %+v", trace[0])
+	}
+	for _, a := range trace[0].Actions {
+		if a == "deny" {
+			t.Error("unexpected disruptive action for unmatched chain")
+		}
+	}
+	if trace[1].RuleID != 2 || trace[1].Matched {
+		t.Errorf("unexpected rule trace %+v", trace[1])
+	}
+}
+
+func TestServerSignature(t *testing.T) {
+	tests := []struct {
+		mode      string
+		server    string
+		mutations []types.HeaderMutation
+	}{
+		{"Rewrite", "nginx/1.22", []types.HeaderMutation{{Action: types.HeaderMutationSet, Name: "Server", Value: "Microsoft-IIS/6.0"}}},
+		{"Rewrite", "", nil},
+		{"Inject", "", []types.HeaderMutation{{Action: types.HeaderMutationSet, Name: "Server", Value: "Microsoft-IIS/6.0"}}},
+		{"Remove", "nginx/1.22", []types.HeaderMutation{{Action: types.HeaderMutationRemove, Name: "Server"}}},
+		{"Remove", "", nil},
+	}
+	for _, tt := range tests {
+		waf := corazawaf.NewWAF()
+		err := NewParser(waf).FromString(`
+			SecServerSignature "Microsoft-IIS/6.0"
+			SecServerSignatureMode ` + tt.mode + `
+			SecRule RESPONSE_HEADERS:Server "@streq nginx/1.22" "id:1,phase:3,pass,log"
+		`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx := waf.NewTransaction()
+		if tt.server != "" {
+			tx.AddResponseHeader("Server", tt.server)
+		}
+		tx.ProcessResponseHeaders(200, "HTTP/1.1")
+		if got := tx.ResponseHeaderMutations(); len(got) != len(tt.mutations) || (len(got) == 1 && got[0] != tt.mutations[0]) {
+			t.Errorf("%s with server %q: expected mutations %v, got %v", tt.mode, tt.server, tt.mutations, got)
+		}
+		// rules inspect the header sent by the upstream
+		if matched := len(tx.MatchedRules()) == 1; matched != (tt.server != "") {
+			t.Errorf("%s with server %q: unexpected matched rules %d", tt.mode, tt.server, len(tx.MatchedRules()))
+		}
+	}
+	if err := NewParser(corazawaf.NewWAF()).FromString("SecServerSignatureMode Hide"); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+}
+
+func TestMessageExpansion(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	parser := NewParser(waf)
+	err := parser.FromString(`
+	SecRule REQUEST_METHOD "@rx ^POST$" "id:1,phase:1,pass,log,chain,\
+		msg:'Matched %{MATCHED_VAR_NAME}',\
+		logdata:'Matched Data: %{TX.0} found within %{MATCHED_VAR_NAME}: %{MATCHED_VAR}'"
+		SecRule ARGS "@rx attack(\d+)" "capture"
+	SecAction "id:2,phase:1,pass,log,msg:'Method %{REQUEST_METHOD}'"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/?q=attack42", "POST", "HTTP/1.1")
+	tx.ProcessRequestHeaders()
+	mrs := tx.MatchedRules()
+	if len(mrs) != 2 {
+		t.Fatalf("expected 2 matched rules, got %d", len(mrs))
+	}
+	if want := "Matched ARGS:q"; mrs[0].Message() != want {
+		t.Errorf("expected message %q, got %q", want, mrs[0].Message())
+	}
+	if want := "Matched Data: attack42 found within ARGS:q: attack42"; mrs[0].Data() != want {
+		t.Errorf("expected data %q, got %q", want, mrs[0].Data())
+	}
+	if want := "Method POST"; mrs[1].Message() != want || mrs[1].MatchedDatas()[0].Message() != want {
+		t.Errorf("expected message %q, got %q", want, mrs[1].Message())
+	}
+	for _, m := range tx.AuditLog().Messages {
+		if m.Message == "" || strings.Contains(m.Message, "%{") {
+			t.Errorf("unexpected audit message %q", m.Message)
+		}
+	}
+}
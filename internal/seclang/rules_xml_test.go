@@ -0,0 +1,72 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// the XML body processor is not supported by tinygo
+//go:build !tinygo
+// +build !tinygo
+
+package seclang
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+)
+
+func TestRequestBodyXMLAnomalies(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	parser := NewParser(waf)
+	err := parser.FromString(`
+		SecRequestBodyAccess On
+		SecRequestBodyXMLDepthLimit 3
+		SecRequestBodyXMLElementsLimit 10
+		SecRequestBodyProcessor text/xml XML
+		SecRule REQUEST_XML_ANOMALIES:depth_exceeded "@eq 1" "id:2,phase:2,pass,log"
+		SecRule REQUEST_XML_ANOMALIES:soap_action_mismatch "@eq 1" "id:3,phase:2,pass,log"
+		SecRule REQUEST_SOAP:operation "@streq Transfer" "id:4,phase:2,pass,log"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope := `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><Transfer/></s:Body></s:Envelope>`
+	tests := []struct {
+		body    string
+		action  string
+		matched map[int]bool
+	}{
+		{envelope, "urn:bank/Transfer", map[int]bool{4: true}},
+		{envelope, "urn:bank/Balance", map[int]bool{3: true, 4: true}},
+		{"<a><b><c><d/></c></b></a>", "", map[int]bool{2: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.body+tt.action, func(t *testing.T) {
+			tx := waf.NewTransaction()
+			tx.ProcessURI("/", "POST", "HTTP/1.1")
+			tx.AddRequestHeader("Content-Type", "text/xml")
+			if tt.action != "" {
+				tx.AddRequestHeader("SOAPAction", tt.action)
+			}
+			tx.ProcessRequestHeaders()
+			if _, _, err := tx.WriteRequestBody([]byte(tt.body)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tx.ProcessRequestBody(); err != nil {
+				t.Fatal(err)
+			}
+			matched := map[int]bool{}
+			for _, mr := range tx.MatchedRules() {
+				matched[mr.Rule().ID()] = true
+			}
+			if fmt.Sprint(matched) != fmt.Sprint(tt.matched) {
+				t.Errorf("want matched rules %v, have %v", tt.matched, matched)
+			}
+		})
+	}
+
+	for _, d := range []string{"SecRequestBodyXMLDepthLimit -1", "SecRequestBodyXMLElementsLimit many"} {
+		if err := parser.FromString(d); err == nil {
+			t.Errorf("expected error for %q", d)
+		}
+	}
+}
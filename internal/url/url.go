@@ -9,12 +9,22 @@ import (
 
 // ParseQuery parses the URL-encoded query string and returns the corresponding map.
 // It takes separators as parameter, for example: & or ; or &;
-// It returns error if the query string is malformed.
-func ParseQuery(query string, separator byte) map[string][]string {
+func ParseQuery(query string, separators string) map[string][]string {
 	m := make(map[string][]string)
+	ForEachQueryPair(query, separators, func(key string, value string) bool {
+		m[key] = append(m[key], value)
+		return true
+	})
+	return m
+}
+
+// ForEachQueryPair calls fn with the unescaped key and value of each
+// argument of the URL-encoded query string, in order, until fn returns
+// false.
+func ForEachQueryPair(query string, separators string, fn func(key string, value string) bool) {
 	for query != "" {
 		key := query
-		if i := strings.IndexByte(key, separator); i >= 0 {
+		if i := strings.IndexAny(key, separators); i >= 0 {
 			key, query = key[:i], key[i+1:]
 		} else {
 			query = ""
@@ -26,11 +36,10 @@ func ParseQuery(query string, separator byte) map[string][]string {
 		if i := strings.IndexByte(key, '='); i >= 0 {
 			key, value = key[:i], key[i+1:]
 		}
-		key = QueryUnescape(key)
-		value = QueryUnescape(value)
-		m[key] = append(m[key], value)
+		if !fn(QueryUnescape(key), QueryUnescape(value)) {
+			return
+		}
 	}
-	return m
 }
 
 // QueryUnescape is a non-strict version of net/url.QueryUnescape.
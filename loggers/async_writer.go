@@ -0,0 +1,163 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package loggers
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+const (
+	defaultAsyncQueueSize = 1024
+	defaultAsyncWorkers   = 1
+)
+
+var errAsyncWriterClosed = errors.New("audit log writer is closed")
+
+// AsyncWriter moves the formatting and writing of audit logs out of the
+// transaction, entries are queued in a bounded channel and written by a
+// pool of workers. When the queue is full the overflow policy decides
+// whether the transaction waits or an entry is discarded.
+//
+// The queue is configured by Init with the following keys, their values
+// are only used before the first entry is written:
+//   - auditlog_async_queue_size (int): capacity of the queue, 1024 by default
+//   - auditlog_async_workers (int): number of workers, 1 by default
+//   - auditlog_async_overflow (types.AuditLogOverflowPolicy): block by default
+//
+// Close waits for the queued entries to be written before closing the
+// wrapped writer.
+type AsyncWriter struct {
+	// dropped is first to be 64-bit aligned for atomic operations on
+	// 32-bit platforms
+	dropped uint64
+
+	w       LogWriter
+	onError func(error)
+
+	queueSize int
+	workers   int
+	overflow  types.AuditLogOverflowPolicy
+
+	start sync.Once
+	queue chan *AuditLog
+	wg    sync.WaitGroup
+	// mu guards closed, writers hold the read lock while queueing
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAsyncWriter returns a writer queueing the entries for w, onError
+// receives the errors of w and may be nil
+func NewAsyncWriter(w LogWriter, onError func(error)) *AsyncWriter {
+	if onError == nil {
+		onError = func(error) {}
+	}
+	return &AsyncWriter{
+		w:         w,
+		onError:   onError,
+		queueSize: defaultAsyncQueueSize,
+		workers:   defaultAsyncWorkers,
+	}
+}
+
+// Init reads the queue configuration and initializes the wrapped writer
+func (aw *AsyncWriter) Init(c types.Config) error {
+	if n := c.Get("auditlog_async_queue_size", aw.queueSize).(int); n > 0 {
+		aw.queueSize = n
+	}
+	if n := c.Get("auditlog_async_workers", aw.workers).(int); n > 0 {
+		aw.workers = n
+	}
+	aw.overflow = c.Get("auditlog_async_overflow", aw.overflow).(types.AuditLogOverflowPolicy)
+	return aw.w.Init(c)
+}
+
+// Write queues the audit log, it only fails if the writer is closed.
+// Errors writing the entry are sent to the error callback.
+func (aw *AsyncWriter) Write(al *AuditLog) error {
+	aw.start.Do(aw.run)
+
+	aw.mu.RLock()
+	defer aw.mu.RUnlock()
+	if aw.closed {
+		return errAsyncWriterClosed
+	}
+	switch aw.overflow {
+	case types.AuditLogOverflowBlock:
+		aw.queue <- al
+		return nil
+	case types.AuditLogOverflowDropNewest:
+		select {
+		case aw.queue <- al:
+		default:
+			atomic.AddUint64(&aw.dropped, 1)
+		}
+		return nil
+	}
+	for {
+		select {
+		case aw.queue <- al:
+			return nil
+		default:
+		}
+		// the queue is full, make room discarding the oldest entry, the
+		// workers or other writers may have already taken the slot
+		select {
+		case <-aw.queue:
+			atomic.AddUint64(&aw.dropped, 1)
+		default:
+		}
+	}
+}
+
+// Close writes the queued entries and closes the wrapped writer
+func (aw *AsyncWriter) Close() error {
+	aw.mu.Lock()
+	if aw.closed {
+		aw.mu.Unlock()
+		return nil
+	}
+	aw.closed = true
+	aw.mu.Unlock()
+
+	started := true
+	aw.start.Do(func() { started = false })
+	if started {
+		close(aw.queue)
+		aw.wg.Wait()
+	}
+	return aw.w.Close()
+}
+
+// Dropped returns the number of entries discarded by the overflow policy
+func (aw *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&aw.dropped)
+}
+
+// Unwrap returns the wrapped writer
+func (aw *AsyncWriter) Unwrap() LogWriter {
+	return aw.w
+}
+
+// run starts the workers
+func (aw *AsyncWriter) run() {
+	aw.queue = make(chan *AuditLog, aw.queueSize)
+	aw.wg.Add(aw.workers)
+	for i := 0; i < aw.workers; i++ {
+		go func() {
+			defer aw.wg.Done()
+			for al := range aw.queue {
+				if err := aw.w.Write(al); err != nil {
+					aw.onError(err)
+				}
+			}
+		}()
+	}
+}
+
+var _ LogWriter = (*AsyncWriter)(nil)
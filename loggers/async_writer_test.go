@@ -0,0 +1,109 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package loggers
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+// blockingWriter records the written transactions, writes are notified
+// to writing and wait until release is closed
+type blockingWriter struct {
+	mu      sync.Mutex
+	ids     []string
+	writing chan struct{}
+	release chan struct{}
+	closed  bool
+}
+
+func (w *blockingWriter) Init(types.Config) error { return nil }
+
+func (w *blockingWriter) Write(al *AuditLog) error {
+	w.writing <- struct{}{}
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if al.Transaction.ID == "fail" {
+		return errors.New("write failed")
+	}
+	w.ids = append(w.ids, al.Transaction.ID)
+	return nil
+}
+
+func (w *blockingWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func newAsyncTestWriter(t *testing.T, policy types.AuditLogOverflowPolicy) (*AsyncWriter, *blockingWriter, *[]error) {
+	t.Helper()
+	bw := &blockingWriter{writing: make(chan struct{}, 10), release: make(chan struct{})}
+	var errs []error
+	aw := NewAsyncWriter(bw, func(err error) { errs = append(errs, err) })
+	c := types.Config{}
+	c.Set("auditlog_async_queue_size", 2)
+	c.Set("auditlog_async_overflow", policy)
+	if err := aw.Init(c); err != nil {
+		t.Fatal(err)
+	}
+	return aw, bw, &errs
+}
+
+func writeIDs(t *testing.T, aw *AsyncWriter, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		if err := aw.Write(&AuditLog{Transaction: AuditTransaction{ID: id}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAsyncWriterOverflow(t *testing.T) {
+	tests := map[types.AuditLogOverflowPolicy][]string{
+		types.AuditLogOverflowDropNewest: {"1", "2", "3"},
+		types.AuditLogOverflowDropOldest: {"1", "4", "5"},
+	}
+	for policy, want := range tests {
+		aw, bw, _ := newAsyncTestWriter(t, policy)
+		// the worker takes the first entry and waits, the queue fills up
+		writeIDs(t, aw, "1")
+		<-bw.writing
+		writeIDs(t, aw, "2", "3", "4", "5")
+		close(bw.release)
+		if err := aw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bw.closed {
+			t.Error("expected the wrapped writer to be closed")
+		}
+		if len(bw.ids) != len(want) || bw.ids[0] != want[0] || bw.ids[1] != want[1] || bw.ids[2] != want[2] {
+			t.Errorf("expected %v to be written for policy %d, got %v", want, policy, bw.ids)
+		}
+		if aw.Dropped() != 2 {
+			t.Errorf("expected 2 dropped entries, got %d", aw.Dropped())
+		}
+	}
+}
+
+func TestAsyncWriterClose(t *testing.T) {
+	aw, bw, errs := newAsyncTestWriter(t, types.AuditLogOverflowBlock)
+	close(bw.release)
+	writeIDs(t, aw, "1", "fail", "2", "3", "4")
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(bw.ids) != 4 || len(*errs) != 1 {
+		t.Errorf("expected every entry to be flushed, got %v and errors %v", bw.ids, *errs)
+	}
+	if err := aw.Write(&AuditLog{}); err == nil {
+		t.Error("expected writes to fail after Close")
+	}
+	if err := aw.Close(); err != nil {
+		t.Errorf("unexpected error closing twice: %v", err)
+	}
+}
@@ -39,6 +39,21 @@ type AuditTransaction struct {
 	Request    AuditTransactionRequest  `json:"request"`
 	Response   AuditTransactionResponse `json:"response"`
 	Producer   AuditTransactionProducer `json:"producer"`
+
+	// ClientCertificate identifies the mTLS client, it is nil if the
+	// connector didn't set a client certificate
+	ClientCertificate *AuditClientCertificate `json:"client_certificate,omitempty"`
+}
+
+// AuditClientCertificate contains the identity of an mTLS client
+type AuditClientCertificate struct {
+	// Verify is the verification result, like SUCCESS or FAILED:reason
+	Verify  string `json:"verify"`
+	Subject string `json:"subject"`
+	Issuer  string `json:"issuer"`
+	Serial  string `json:"serial"`
+	// NotAfter is the end of the validity in RFC 3339 format
+	NotAfter string `json:"not_after"`
 }
 
 // AuditTransactionResponse contains response specific
@@ -59,6 +74,9 @@ type AuditTransactionProducer struct {
 	RuleEngine string   `json:"rule_engine"`
 	Stopwatch  string   `json:"stopwatch"`
 	Rulesets   []string `json:"rulesets"`
+	// RulesPerformance lists the rules exceeding SecRulePerfTime
+	// like id=usec, id=usec
+	RulesPerformance string `json:"rules_performance,omitempty"`
 }
 
 // AuditTransactionRequest contains request specific
@@ -99,11 +117,13 @@ type AuditMessageData struct {
 	Msg      string             `json:"msg"`
 	Data     string             `json:"data"`
 	Severity types.RuleSeverity `json:"severity"`
-	Ver      string             `json:"ver"`
-	Maturity int                `json:"maturity"`
-	Accuracy int                `json:"accuracy"`
-	Tags     []string           `json:"tags"`
-	Raw      string             `json:"raw"`
+	// HasSeverity is false if the rule doesn't declare a severity
+	HasSeverity bool     `json:"-"`
+	Ver         string   `json:"ver"`
+	Maturity    int      `json:"maturity"`
+	Accuracy    int      `json:"accuracy"`
+	Tags        []string `json:"tags"`
+	Raw         string   `json:"raw"`
 }
 
 // LEGACY FORMAT
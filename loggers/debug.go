@@ -4,7 +4,9 @@
 package loggers
 
 import (
+	"fmt"
 	"io"
+	"strings"
 )
 
 // DebugLogger is used to log SecDebugLog messages
@@ -26,6 +28,105 @@ type DebugLogger interface {
 	SetOutput(w io.WriteCloser)
 }
 
+// FieldLogger is an optional interface for debug loggers that can add
+// fields to their messages, it is used to correlate messages with
+// transactions and rules.
+type FieldLogger interface {
+	DebugLogger
+	// With returns a logger that adds the fields to every message
+	With(fields ...Field) DebugLogger
+}
+
+// With returns a logger that adds the fields to the messages of l. If l
+// doesn't implement FieldLogger the field values prefix the messages, like
+// "[tx_id] message".
+func With(l DebugLogger, fields ...Field) DebugLogger {
+	if fl, ok := l.(FieldLogger); ok {
+		return fl.With(fields...)
+	}
+	if len(fields) == 0 {
+		return l
+	}
+	return &prefixDebugLogger{DebugLogger: l, prefix: fieldsPrefix(fields)}
+}
+
+func fieldsPrefix(fields []Field) string {
+	sb := strings.Builder{}
+	for _, f := range fields {
+		fmt.Fprintf(&sb, "[%v] ", f.Value)
+	}
+	return sb.String()
+}
+
+// prefixDebugLogger writes the field values before the messages of loggers
+// that don't support fields
+type prefixDebugLogger struct {
+	DebugLogger
+	prefix string
+}
+
+var _ FieldLogger = (*prefixDebugLogger)(nil)
+
+// Info logs an info message
+func (l *prefixDebugLogger) Info(message string, args ...interface{}) {
+	l.DebugLogger.Info("%s"+message, l.args(args)...)
+}
+
+// Warn logs a warning message
+func (l *prefixDebugLogger) Warn(message string, args ...interface{}) {
+	l.DebugLogger.Warn("%s"+message, l.args(args)...)
+}
+
+// Error logs an error message
+func (l *prefixDebugLogger) Error(message string, args ...interface{}) {
+	l.DebugLogger.Error("%s"+message, l.args(args)...)
+}
+
+// Debug logs a debug message
+func (l *prefixDebugLogger) Debug(message string, args ...interface{}) {
+	l.DebugLogger.Debug("%s"+message, l.args(args)...)
+}
+
+// Trace logs a trace message
+func (l *prefixDebugLogger) Trace(message string, args ...interface{}) {
+	l.DebugLogger.Trace("%s"+message, l.args(args)...)
+}
+
+// args prepends the prefix to the arguments of a message, the message is
+// only formatted by l.DebugLogger if its level is enabled
+func (l *prefixDebugLogger) args(args []interface{}) []interface{} {
+	return append([]interface{}{l.prefix}, args...)
+}
+
+// With returns a logger with the current and the new field values as prefix
+func (l *prefixDebugLogger) With(fields ...Field) DebugLogger {
+	return &prefixDebugLogger{DebugLogger: l.DebugLogger, prefix: l.prefix + fieldsPrefix(fields)}
+}
+
+// Field is a key/value pair attached to debug log messages
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string field
+func String(key string, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Int returns an integer field
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Common field keys used by Coraza
+const (
+	// FieldTransactionID is the key for the transaction ID field
+	FieldTransactionID = "tx_id"
+	// FieldRuleID is the key for the rule ID field
+	FieldRuleID = "rule_id"
+)
+
 // LogLevel is the type of log level
 type LogLevel int
 
@@ -40,13 +141,20 @@ const (
 	LogLevelError
 	// LogLevelDebug is the level of logging for debug messages
 	LogLevelDebug
-	// LogLevelTrace is the highest level of logging
+	// LogLevelTrace is the highest level of logging, it includes
+	// the evaluation trace of every rule
 	LogLevelTrace
 )
 
+// LogLevelNoLog disables logging, it is below every level so no message
+// is written
+const LogLevelNoLog LogLevel = -1
+
 // String returns the string representation of the log level
 func (level LogLevel) String() string {
 	switch level {
+	case LogLevelNoLog:
+		return "NOLOG"
 	case LogLevelInfo:
 		return "INFO"
 	case LogLevelWarn:
@@ -63,5 +171,28 @@ func (level LogLevel) String() string {
 
 // Invalid returns true if the log level is invalid
 func (level LogLevel) Invalid() bool {
-	return level < LogLevelInfo || level > LogLevelTrace
+	return level != LogLevelNoLog && (level < LogLevelInfo || level > LogLevelTrace)
+}
+
+// ModSecurityLogLevel translates a ModSecurity debug log level (0-9) used
+// by SecDebugLogLevel to the closest LogLevel:
+//
+//	0: LogLevelNoLog, logging is disabled
+//	1-3: LogLevelError, for errors, warnings and notices
+//	4: LogLevelDebug, for the transaction processing
+//	5-9: LogLevelTrace, for every piece of information handled including
+//	     variable expansions, transformations and operator results for
+//	     each rule
+func ModSecurityLogLevel(level int) (LogLevel, error) {
+	switch {
+	case level == 0:
+		return LogLevelNoLog, nil
+	case level >= 1 && level <= 3:
+		return LogLevelError, nil
+	case level == 4:
+		return LogLevelDebug, nil
+	case level >= 5 && level <= 9:
+		return LogLevelTrace, nil
+	}
+	return LogLevelUnknown, fmt.Errorf("invalid debug log level %d, it must be between 0 and 9", level)
 }
@@ -0,0 +1,91 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package loggers
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestModSecurityLogLevel(t *testing.T) {
+	tests := map[int]LogLevel{
+		0: LogLevelNoLog,
+		1: LogLevelError,
+		3: LogLevelError,
+		4: LogLevelDebug,
+		5: LogLevelTrace,
+		6: LogLevelTrace,
+		9: LogLevelTrace,
+	}
+	for lvl, want := range tests {
+		have, err := ModSecurityLogLevel(lvl)
+		if err != nil {
+			t.Errorf("unexpected error for %d: %s", lvl, err.Error())
+		}
+		if have != want {
+			t.Errorf("unexpected level for %d, want %s, have %s", lvl, want, have)
+		}
+	}
+	for _, lvl := range []int{-1, 10} {
+		if _, err := ModSecurityLogLevel(lvl); err == nil {
+			t.Errorf("expected an error for %d", lvl)
+		}
+	}
+	if LogLevelNoLog.Invalid() || !LogLevelUnknown.Invalid() {
+		t.Error("unexpected validity of the levels")
+	}
+}
+
+// plainDebugLogger doesn't implement FieldLogger, a quiet logger drops
+// the messages without formatting them
+type plainDebugLogger struct {
+	messages []string
+	quiet    bool
+}
+
+func (l *plainDebugLogger) log(message string, args ...interface{}) {
+	if l.quiet {
+		return
+	}
+	l.messages = append(l.messages, fmt.Sprintf(message, args...))
+}
+
+func (l *plainDebugLogger) Info(message string, args ...interface{})  { l.log(message, args...) }
+func (l *plainDebugLogger) Warn(message string, args ...interface{})  { l.log(message, args...) }
+func (l *plainDebugLogger) Error(message string, args ...interface{}) { l.log(message, args...) }
+func (l *plainDebugLogger) Debug(message string, args ...interface{}) { l.log(message, args...) }
+func (l *plainDebugLogger) Trace(message string, args ...interface{}) { l.log(message, args...) }
+func (l *plainDebugLogger) SetLevel(LogLevel)                         {}
+func (l *plainDebugLogger) SetOutput(io.WriteCloser)                  {}
+
+func TestWithPrefixesPlainLoggers(t *testing.T) {
+	l := &plainDebugLogger{}
+	if With(l) != DebugLogger(l) {
+		t.Error("expected the logger to be returned as is without fields")
+	}
+	txl := With(l, String(FieldTransactionID, "abc%d"))
+	txl.Info("done")
+	With(txl, Int(FieldRuleID, 1)).Debug("matched %d", 2)
+	want := []string{"[abc%d] done", "[abc%d] [1] matched 2"}
+	if fmt.Sprint(l.messages) != fmt.Sprint(want) {
+		t.Errorf("unexpected messages, want %q, have %q", want, l.messages)
+	}
+}
+
+// formatCounter counts how many times it is formatted
+type formatCounter int
+
+func (c *formatCounter) String() string {
+	*c++
+	return "formatted"
+}
+
+func TestWithPrefixDoesNotFormatDroppedMessages(t *testing.T) {
+	var c formatCounter
+	With(&plainDebugLogger{quiet: true}, String(FieldTransactionID, "abc")).Debug("matched %s", &c)
+	if c != 0 {
+		t.Errorf("expected the dropped message not to be formatted, formatted %d times", c)
+	}
+}
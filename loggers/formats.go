@@ -9,6 +9,8 @@
 // - JSON
 // - Coraza
 // - Native
+// - CEF
+// - ECS
 //
 // The following log writers are supported:
 //
@@ -0,0 +1,154 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package loggers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+// cefFormatter writes the audit log as an ArcSight CEF line, the
+// signature is the first matched rule, or 0 if no rule matched, and the
+// severity the highest severity of the matched rules, 0 if none declares
+// a severity
+//
+//	CEF:0|coraza|coraza-waf|3.0|942100|SQL Injection Attack|8|rt=... src=10.0.0.1 ...
+func cefFormatter(al *AuditLog) ([]byte, error) {
+	tx := al.Transaction
+	signature, name, severity := "0", "Transaction logged", 0
+	ids, tags := auditLogRules(al)
+	for i, m := range al.Messages {
+		if i == 0 {
+			signature, name = strconv.Itoa(m.Data.ID), m.Message
+			if name == "" {
+				name = m.Data.Msg
+			}
+		}
+		if s := cefSeverity(m.Data.Severity); m.Data.HasSeverity && s > severity {
+			severity = s
+		}
+	}
+	version := tx.Producer.Version
+	if version == "" {
+		version = "3"
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("CEF:0|coraza|coraza-waf|")
+	b.WriteString(cefHeaderEscaper.Replace(version))
+	b.WriteString("|")
+	b.WriteString(signature)
+	b.WriteString("|")
+	b.WriteString(cefHeaderEscaper.Replace(name))
+	b.WriteString("|")
+	b.WriteString(strconv.Itoa(severity))
+	b.WriteString("|")
+
+	ext := []struct {
+		key   string
+		value string
+	}{
+		{"rt", strconv.FormatInt(tx.UnixTimestamp/1e6, 10)},
+		{"src", tx.ClientIP},
+		{"spt", cefPort(tx.ClientPort)},
+		{"dst", tx.HostIP},
+		{"dpt", cefPort(tx.HostPort)},
+		{"requestMethod", tx.Request.Method},
+		{"request", tx.Request.URI},
+		{"app", tx.Request.Protocol},
+		{"requestClientApplication", headerValue(tx.Request.Headers, "user-agent")},
+		{"outcome", strconv.Itoa(tx.Response.Status)},
+		{"externalId", tx.ID},
+		{"cs1Label", "ruleIds"},
+		{"cs1", strings.Join(ids, ",")},
+		{"cs2Label", "tags"},
+		{"cs2", strings.Join(tags, ",")},
+	}
+	first := true
+	for _, e := range ext {
+		if e.value == "" {
+			continue
+		}
+		if !first {
+			b.WriteString(" ")
+		}
+		first = false
+		b.WriteString(e.key)
+		b.WriteString("=")
+		b.WriteString(cefExtensionEscaper.Replace(e.value))
+	}
+	return []byte(b.String()), nil
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+// cefSeverity maps the rule severity to the 0-10 CEF scale
+func cefSeverity(s types.RuleSeverity) int {
+	switch s {
+	case types.RuleSeverityEmergency:
+		return 10
+	case types.RuleSeverityAlert:
+		return 9
+	case types.RuleSeverityCritical:
+		return 8
+	case types.RuleSeverityError:
+		return 7
+	case types.RuleSeverityWarning:
+		return 5
+	case types.RuleSeverityNotice:
+		return 4
+	case types.RuleSeverityInfo:
+		return 3
+	}
+	return 1
+}
+
+func cefPort(port int) string {
+	if port == 0 {
+		return ""
+	}
+	return strconv.Itoa(port)
+}
+
+// auditLogRules returns the IDs and tags of the matched rules without
+// duplicates, in matching order
+func auditLogRules(al *AuditLog) ([]string, []string) {
+	var ids, tags []string
+	seen := map[string]bool{}
+	for _, m := range al.Messages {
+		id := strconv.Itoa(m.Data.ID)
+		if seen["id:"+id] {
+			continue
+		}
+		seen["id:"+id] = true
+		ids = append(ids, id)
+		for _, tag := range m.Data.Tags {
+			if !seen["tag:"+tag] {
+				seen["tag:"+tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return ids, tags
+}
+
+// headerValue returns the first value of a header, names are compared
+// case insensitively
+func headerValue(headers map[string][]string, name string) string {
+	for k, v := range headers {
+		if len(v) > 0 && strings.EqualFold(k, name) {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+var (
+	_ LogFormatter = cefFormatter
+)
@@ -0,0 +1,198 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// JSON loggers not supported on TinyGo yet.
+//go:build !tinygo
+// +build !tinygo
+
+package loggers
+
+import (
+	"encoding/json"
+	"net/url"
+	"time"
+)
+
+// ecsVersion is the version of the Elastic Common Schema implemented by
+// ecsFormatter
+const ecsVersion = "8.4.0"
+
+type ecsDocument struct {
+	Timestamp   string          `json:"@timestamp"`
+	ECS         ecsVersionField `json:"ecs"`
+	Event       ecsEvent        `json:"event"`
+	Observer    ecsObserver     `json:"observer"`
+	Transaction ecsID           `json:"transaction"`
+	Client      ecsEndpoint     `json:"client"`
+	Server      ecsEndpoint     `json:"server"`
+	HTTP        ecsHTTP         `json:"http"`
+	URL         ecsURL          `json:"url"`
+	UserAgent   *ecsUserAgent   `json:"user_agent,omitempty"`
+	TLS         *ecsTLS         `json:"tls,omitempty"`
+	Rule        *ecsRule        `json:"rule,omitempty"`
+	Tags        []string        `json:"tags,omitempty"`
+	Coraza      ecsCoraza       `json:"coraza"`
+}
+
+type ecsVersionField struct {
+	Version string `json:"version"`
+}
+
+type ecsEvent struct {
+	Kind     string   `json:"kind"`
+	Category []string `json:"category"`
+	Type     []string `json:"type"`
+	Module   string   `json:"module"`
+	Dataset  string   `json:"dataset"`
+	Severity int      `json:"severity,omitempty"`
+}
+
+type ecsObserver struct {
+	Vendor  string `json:"vendor"`
+	Product string `json:"product"`
+	Type    string `json:"type"`
+	Version string `json:"version,omitempty"`
+}
+
+type ecsID struct {
+	ID string `json:"id"`
+}
+
+type ecsEndpoint struct {
+	IP   string `json:"ip,omitempty"`
+	Port int    `json:"port,omitempty"`
+}
+
+type ecsHTTP struct {
+	Version  string      `json:"version,omitempty"`
+	Request  ecsRequest  `json:"request"`
+	Response ecsResponse `json:"response"`
+}
+
+type ecsRequest struct {
+	Method string   `json:"method,omitempty"`
+	Body   *ecsBody `json:"body,omitempty"`
+}
+
+type ecsResponse struct {
+	StatusCode int      `json:"status_code,omitempty"`
+	Body       *ecsBody `json:"body,omitempty"`
+}
+
+type ecsBody struct {
+	Content string `json:"content"`
+}
+
+type ecsURL struct {
+	Original string `json:"original,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Query    string `json:"query,omitempty"`
+}
+
+type ecsTLS struct {
+	Client ecsTLSClient `json:"client"`
+}
+
+type ecsTLSClient struct {
+	Subject  string `json:"subject,omitempty"`
+	Issuer   string `json:"issuer,omitempty"`
+	NotAfter string `json:"not_after,omitempty"`
+}
+
+type ecsUserAgent struct {
+	Original string `json:"original"`
+}
+
+type ecsRule struct {
+	ID      []string `json:"id"`
+	Ruleset []string `json:"ruleset,omitempty"`
+	Version string   `json:"version,omitempty"`
+}
+
+// ecsCoraza contains the fields without an ECS equivalent
+type ecsCoraza struct {
+	Messages   []AuditMessage `json:"messages,omitempty"`
+	RuleEngine string         `json:"rule_engine,omitempty"`
+}
+
+// ecsFormatter writes the audit log as an Elastic Common Schema document,
+// the matched rules are also kept under coraza.messages. event.severity
+// uses the same 0-10 scale as the CEF formatter.
+func ecsFormatter(al *AuditLog) ([]byte, error) {
+	tx := al.Transaction
+	ids, tags := auditLogRules(al)
+	doc := ecsDocument{
+		Timestamp: time.Unix(0, tx.UnixTimestamp).UTC().Format(time.RFC3339Nano),
+		ECS:       ecsVersionField{Version: ecsVersion},
+		Event: ecsEvent{
+			Kind:     "event",
+			Category: []string{"web"},
+			Type:     []string{"access"},
+			Module:   "coraza",
+			Dataset:  "coraza.audit",
+		},
+		Observer: ecsObserver{
+			Vendor:  "OWASP",
+			Product: "Coraza",
+			Type:    "waf",
+			Version: tx.Producer.Version,
+		},
+		Transaction: ecsID{ID: tx.ID},
+		Client:      ecsEndpoint{IP: tx.ClientIP, Port: tx.ClientPort},
+		Server:      ecsEndpoint{IP: tx.HostIP, Port: tx.HostPort},
+		HTTP: ecsHTTP{
+			Version: tx.Request.HTTPVersion,
+			Request: ecsRequest{Method: tx.Request.Method},
+			Response: ecsResponse{
+				StatusCode: tx.Response.Status,
+			},
+		},
+		URL:  ecsURL{Original: tx.Request.URI},
+		Tags: tags,
+		Coraza: ecsCoraza{
+			Messages:   al.Messages,
+			RuleEngine: tx.Producer.RuleEngine,
+		},
+	}
+	if u, err := url.ParseRequestURI(tx.Request.URI); err == nil {
+		doc.URL.Path = u.Path
+		doc.URL.Query = u.RawQuery
+	}
+	if ua := headerValue(tx.Request.Headers, "user-agent"); ua != "" {
+		doc.UserAgent = &ecsUserAgent{Original: ua}
+	}
+	if c := tx.ClientCertificate; c != nil {
+		doc.TLS = &ecsTLS{Client: ecsTLSClient{Subject: c.Subject, Issuer: c.Issuer, NotAfter: c.NotAfter}}
+	}
+	if tx.Request.Body != "" {
+		doc.HTTP.Request.Body = &ecsBody{Content: tx.Request.Body}
+	}
+	if tx.Response.Body != "" {
+		doc.HTTP.Response.Body = &ecsBody{Content: tx.Response.Body}
+	}
+	if len(ids) > 0 {
+		doc.Event.Kind = "alert"
+		doc.Event.Category = append(doc.Event.Category, "intrusion_detection")
+		doc.Event.Type = append(doc.Event.Type, "info")
+		doc.Rule = &ecsRule{
+			ID:      ids,
+			Ruleset: tx.Producer.Rulesets,
+		}
+		for _, m := range al.Messages {
+			if doc.Rule.Version == "" {
+				doc.Rule.Version = m.Data.Ver
+			}
+			if s := cefSeverity(m.Data.Severity); m.Data.HasSeverity && s > doc.Event.Severity {
+				doc.Event.Severity = s
+			}
+		}
+	}
+	if tx.Response.Status >= 400 {
+		doc.Event.Type = append(doc.Event.Type, "denied")
+	}
+	return json.Marshal(doc)
+}
+
+var (
+	_ LogFormatter = ecsFormatter
+)
@@ -9,6 +9,8 @@ package loggers
 import (
 	"encoding/json"
 	"testing"
+
+	"github.com/corazawaf/coraza/v3/types"
 )
 
 /*
@@ -67,3 +69,60 @@ func TestLegacyFormatter(t *testing.T) {
 		t.Errorf("failed to match legacy formatter, \ngot: %s\nexpected: %s", legacyAl.AuditData.Messages[0], "some message")
 	}
 }
+
+func TestECSFormatter(t *testing.T) {
+	al := createAuditLog()
+	al.Transaction.ClientIP = "10.0.0.1"
+	al.Transaction.Request.URI = "/test.php?a=b"
+	al.Transaction.Response.Status = 403
+	al.Messages[0].Data.ID = 942100
+	al.Messages[0].Data.Ver = "OWASP_CRS/4.0.0"
+	al.Messages[0].Data.Severity = types.RuleSeverityCritical
+	al.Messages[0].Data.HasSeverity = true
+	al.Transaction.ClientCertificate = &AuditClientCertificate{Verify: "SUCCESS", Subject: "CN=client", NotAfter: "2030-01-01T00:00:00Z"}
+	data, err := ecsFormatter(al)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	get := func(path ...string) interface{} {
+		var v interface{} = doc
+		for _, p := range path {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			v = m[p]
+		}
+		return v
+	}
+	for _, tt := range []struct {
+		path []string
+		want interface{}
+	}{
+		{[]string{"@timestamp"}, "1970-01-01T00:00:00Z"},
+		{[]string{"event", "kind"}, "alert"},
+		{[]string{"event", "severity"}, float64(8)},
+		{[]string{"client", "ip"}, "10.0.0.1"},
+		{[]string{"transaction", "id"}, "123"},
+		{[]string{"http", "response", "status_code"}, float64(403)},
+		{[]string{"url", "path"}, "/test.php"},
+		{[]string{"url", "query"}, "a=b"},
+		{[]string{"tls", "client", "subject"}, "CN=client"},
+		{[]string{"tls", "client", "not_after"}, "2030-01-01T00:00:00Z"},
+		{[]string{"rule", "version"}, "OWASP_CRS/4.0.0"},
+	} {
+		if got := get(tt.path...); got != tt.want {
+			t.Errorf("unexpected %v, want %v got %v", tt.path, tt.want, got)
+		}
+	}
+	if ids, ok := get("rule", "id").([]interface{}); !ok || len(ids) != 1 || ids[0] != "942100" {
+		t.Errorf("unexpected rule.id %v", get("rule", "id"))
+	}
+	if eventTypes, ok := get("event", "type").([]interface{}); !ok || len(eventTypes) != 3 || eventTypes[2] != "denied" {
+		t.Errorf("unexpected event.type %v", get("event", "type"))
+	}
+}
@@ -6,6 +6,8 @@ package loggers
 import (
 	"bytes"
 	"testing"
+
+	"github.com/corazawaf/coraza/v3/types"
 )
 
 func TestNativeFormatter(t *testing.T) {
@@ -20,6 +22,36 @@ func TestNativeFormatter(t *testing.T) {
 	}
 }
 
+func TestCEFFormatter(t *testing.T) {
+	al := createAuditLog()
+	al.Transaction.ClientIP = "10.0.0.1"
+	al.Transaction.Request.URI = "/test.php?a=b|c"
+	al.Transaction.Request.Headers["User-Agent"] = []string{"curl"}
+	al.Messages[0].Message = "Attack | detected"
+	al.Messages[0].Data.ID = 942100
+	al.Messages[0].Data.Severity = types.RuleSeverityCritical
+	al.Messages[0].Data.HasSeverity = true
+	al.Messages[0].Data.Tags = []string{"attack-sqli"}
+	al.Messages = append(al.Messages, al.Messages[0])
+	data, err := cefFormatter(al)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `CEF:0|coraza|coraza-waf|3|942100|Attack \| detected|8|rt=0 src=10.0.0.1 requestMethod=GET request=/test.php?a\=b|c ` +
+		`requestClientApplication=curl outcome=200 externalId=123 cs1Label=ruleIds cs1=942100 cs2Label=tags cs2=attack-sqli`
+	if string(data) != want {
+		t.Errorf("unexpected CEF line\ngot:  %s\nwant: %s", data, want)
+	}
+
+	// rules without severity don't raise the event severity
+	al.Messages = al.Messages[:1]
+	al.Messages[0].Data.HasSeverity = false
+	data, _ = cefFormatter(al)
+	if !bytes.Contains(data, []byte("|Attack \\| detected|0|")) {
+		t.Errorf("unexpected CEF line %s", data)
+	}
+}
+
 func createAuditLog() *AuditLog {
 	return &AuditLog{
 		Transaction: AuditTransaction{
@@ -7,14 +7,12 @@
 package loggers
 
 func init() {
-	RegisterLogWriter("concurrent", func() LogWriter {
-		return &concurrentWriter{}
-	})
-	RegisterLogWriter("serial", func() LogWriter {
-		return &serialWriter{}
-	})
-
 	RegisterLogFormatter("json", jsonFormatter)
 	RegisterLogFormatter("jsonlegacy", legacyJSONFormatter)
 	RegisterLogFormatter("native", nativeFormatter)
+	RegisterLogFormatter("cef", cefFormatter)
+	RegisterLogFormatter("ecs", ecsFormatter)
+	RegisterLogWriter("syslog", func() LogWriter {
+		return NewSyslogWriter(SyslogOptions{})
+	})
 }
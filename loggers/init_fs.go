@@ -0,0 +1,16 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !tinygo && !coraza.no_fs_access
+// +build !tinygo,!coraza.no_fs_access
+
+package loggers
+
+func init() {
+	RegisterLogWriter("concurrent", func() LogWriter {
+		return &concurrentWriter{}
+	})
+	RegisterLogWriter("serial", func() LogWriter {
+		return &serialWriter{}
+	})
+}
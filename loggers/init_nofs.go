@@ -0,0 +1,18 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build tinygo || coraza.no_fs_access
+// +build tinygo coraza.no_fs_access
+
+package loggers
+
+// The file writers are replaced so configurations using them still load,
+// audit logs can be sent with a custom writer instead.
+func init() {
+	RegisterLogWriter("concurrent", func() LogWriter {
+		return noopWriter{}
+	})
+	RegisterLogWriter("serial", func() LogWriter {
+		return noopWriter{}
+	})
+}
@@ -7,14 +7,9 @@
 package loggers
 
 func init() {
-	RegisterLogWriter("concurrent", func() LogWriter {
-		return noopWriter{}
-	})
-	RegisterLogWriter("serial", func() LogWriter {
-		return noopWriter{}
-	})
-
 	RegisterLogFormatter("json", noopFormater)
 	RegisterLogFormatter("jsonlegacy", noopFormater)
 	RegisterLogFormatter("native", nativeFormatter)
+	RegisterLogFormatter("cef", cefFormatter)
+	RegisterLogFormatter("ecs", noopFormater)
 }
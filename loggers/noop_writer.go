@@ -1,9 +1,9 @@
 // Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
 // SPDX-License-Identifier: Apache-2.0
 
-// Currently only used with TinyGo
-//go:build tinygo
-// +build tinygo
+// Only used without filesystem access
+//go:build tinygo || coraza.no_fs_access
+// +build tinygo coraza.no_fs_access
 
 package loggers
 
@@ -0,0 +1,241 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !tinygo && !coraza.no_fs_access
+// +build !tinygo,!coraza.no_fs_access
+
+package loggers
+
+import (
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is appended to the name of rotated files, it sorts
+// lexicographically
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// rotateOptions configures the rotation of a log file, zero values
+// disable each policy
+type rotateOptions struct {
+	// maxSize is the size in bytes triggering a rotation
+	maxSize int64
+	// interval is the maximum time a file is written before rotating it
+	interval time.Duration
+	// maxBackups is the number of rotated files kept
+	maxBackups int
+	// maxAge is the maximum age of the rotated files
+	maxAge time.Duration
+	// compress gzips the rotated files
+	compress bool
+}
+
+func (o rotateOptions) enabled() bool {
+	return o.maxSize > 0 || o.interval > 0
+}
+
+// rotatingFile is a log file renamed to name-<timestamp>.ext once it
+// reaches the size or age limits, writes are never split between files.
+// The file is owned by the writer so external tools don't need to
+// signal it to reopen the file.
+type rotatingFile struct {
+	mu       sync.Mutex
+	name     string
+	mode     fs.FileMode
+	opts     rotateOptions
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	// lastBackup keeps the backup names unique when rotating several
+	// times in the same millisecond
+	lastBackup time.Time
+	// wg tracks the background compression and cleanup
+	wg  sync.WaitGroup
+	now func() time.Time
+}
+
+func openRotatingFile(name string, mode fs.FileMode, opts rotateOptions) (*rotatingFile, error) {
+	rf := &rotatingFile{
+		name: name,
+		mode: mode,
+		opts: opts,
+		now:  time.Now,
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// open opens or creates the log file, it must be called with the lock
+// held
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, rf.mode)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file = f
+	rf.size = st.Size()
+	rf.openedAt = rf.now()
+	return nil
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+	var rerr error
+	if rf.shouldRotate(int64(len(p))) {
+		// the entry is still written to the current file if the rotation
+		// fails, it is retried with the next write
+		if rerr = rf.rotate(); rf.file == nil {
+			return 0, rerr
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	if err == nil {
+		err = rerr
+	}
+	return n, err
+}
+
+func (rf *rotatingFile) shouldRotate(n int64) bool {
+	if rf.size == 0 {
+		return false
+	}
+	if rf.opts.maxSize > 0 && rf.size+n > rf.opts.maxSize {
+		return true
+	}
+	return rf.opts.interval > 0 && rf.now().Sub(rf.openedAt) >= rf.opts.interval
+}
+
+// rotate renames the current file and opens a new one, the current file
+// is opened again if it can't be renamed. It must be called with the lock
+// held
+func (rf *rotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+	rf.file = nil
+	ts := rf.now().Truncate(time.Millisecond)
+	if !ts.After(rf.lastBackup) {
+		ts = rf.lastBackup.Add(time.Millisecond)
+	}
+	rf.lastBackup = ts
+	ext := filepath.Ext(rf.name)
+	backup := strings.TrimSuffix(rf.name, ext) + "-" + ts.Format(backupTimeFormat) + ext
+	if err := os.Rename(rf.name, backup); err != nil {
+		if oerr := rf.open(); oerr != nil {
+			return oerr
+		}
+		return err
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+	rf.wg.Add(1)
+	go func() {
+		defer rf.wg.Done()
+		if rf.opts.compress {
+			// a failed compression keeps the uncompressed backup
+			_ = compressFile(backup, rf.mode)
+		}
+		rf.removeBackups()
+	}()
+	return nil
+}
+
+// removeBackups deletes the rotated files exceeding maxBackups or maxAge
+func (rf *rotatingFile) removeBackups() {
+	if rf.opts.maxBackups <= 0 && rf.opts.maxAge <= 0 {
+		return
+	}
+	ext := filepath.Ext(rf.name)
+	prefix := filepath.Base(strings.TrimSuffix(rf.name, ext)) + "-"
+	entries, err := os.ReadDir(filepath.Dir(rf.name))
+	if err != nil {
+		return
+	}
+	type backup struct {
+		name string
+		t    time.Time
+	}
+	var backups []backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		ts := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		t, err := time.ParseInLocation(backupTimeFormat, strings.TrimPrefix(ts, prefix), time.Local)
+		if err == nil {
+			backups = append(backups, backup{name, t})
+		}
+	}
+	// newest first
+	sort.Slice(backups, func(i, j int) bool { return backups[i].t.After(backups[j].t) })
+	cutoff := rf.now().Add(-rf.opts.maxAge)
+	for i, b := range backups {
+		if (rf.opts.maxBackups > 0 && i >= rf.opts.maxBackups) || (rf.opts.maxAge > 0 && b.t.Before(cutoff)) {
+			_ = os.Remove(filepath.Join(filepath.Dir(rf.name), b.name))
+		}
+	}
+}
+
+// Close closes the file and waits for the pending compressions
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	var err error
+	if rf.file != nil {
+		err = rf.file.Close()
+		rf.file = nil
+	}
+	rf.wg.Wait()
+	return err
+}
+
+// compressFile replaces name with name.gz
+func compressFile(name string, mode fs.FileMode) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		zw.Close()
+		dst.Close()
+		_ = os.Remove(name + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		_ = os.Remove(name + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(name + ".gz")
+		return err
+	}
+	return os.Remove(name)
+}
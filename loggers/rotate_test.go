@@ -0,0 +1,183 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !tinygo && !coraza.no_fs_access
+// +build !tinygo,!coraza.no_fs_access
+
+package loggers
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRotatingFileMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "audit.log")
+	rf, err := openRotatingFile(name, 0600, rotateOptions{maxSize: 10, maxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	names := listDir(t, dir)
+	if len(names) != 3 || names[2] != "audit.log" {
+		t.Fatalf("expected the log and two backups, got %v", names)
+	}
+	if data, _ := os.ReadFile(name); string(data) != "fourth\n" {
+		t.Errorf("unexpected log content %q", data)
+	}
+	// the oldest backup was removed
+	if data, _ := os.ReadFile(filepath.Join(dir, names[0])); string(data) != "second\n" {
+		t.Errorf("unexpected backup content %q", data)
+	}
+	if _, err := rf.Write([]byte("closed")); err == nil {
+		t.Error("expected an error writing a closed file")
+	}
+}
+
+func TestRotatingFileRenameFailure(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "audit.log")
+	rf, err := openRotatingFile(name, 0600, rotateOptions{maxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.Local)
+	rf.now = func() time.Time { return now }
+	if _, err := rf.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	// a non empty directory with the backup name makes the rename fail
+	backup := filepath.Join(dir, "audit-2022-01-01T00-00-00.000.log")
+	if err := os.MkdirAll(filepath.Join(backup, "dir"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := rf.Write([]byte("second\n")); err == nil || n != len("second\n") {
+		t.Fatalf("expected the entry to be written with the rotation error, got %d bytes and error %v", n, err)
+	}
+	if data, _ := os.ReadFile(name); string(data) != "first\nsecond\n" {
+		t.Errorf("unexpected log content %q", data)
+	}
+
+	// the rotation is retried with the next write
+	now = now.Add(time.Second)
+	if _, err := rf.Write([]byte("third\n")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(name); string(data) != "third\n" {
+		t.Errorf("unexpected log content %q", data)
+	}
+}
+
+func TestRotatingFileInterval(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "audit.log")
+	rf, err := openRotatingFile(name, 0600, rotateOptions{interval: time.Hour, compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.Local)
+	rf.now = func() time.Time { return now }
+	rf.openedAt = now
+	if _, err := rf.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Minute)
+	if _, err := rf.Write([]byte("second\n")); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Minute)
+	if _, err := rf.Write([]byte("third\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	names := listDir(t, dir)
+	if len(names) != 2 || names[0] != "audit-2022-01-01T01-00-00.000.log.gz" {
+		t.Fatalf("expected a compressed backup, got %v", names)
+	}
+	f, err := os.Open(filepath.Join(dir, names[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "first\nsecond\n" {
+		t.Errorf("unexpected backup content %q", data)
+	}
+}
+
+func TestRotatingFileMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "audit.log")
+	old := filepath.Join(dir, "audit-2000-01-01T00-00-00.000.log.gz")
+	unrelated := filepath.Join(dir, "audit-old.log")
+	for _, f := range []string{old, unrelated} {
+		if err := os.WriteFile(f, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rf, err := openRotatingFile(name, 0600, rotateOptions{maxSize: 1, maxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := rf.Write([]byte("log\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("expected the old backup to be removed")
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Error("expected unrelated files to be kept")
+	}
+	var backups int
+	for _, n := range listDir(t, dir) {
+		if strings.HasPrefix(n, "audit-2") && !strings.HasPrefix(n, "audit-2000") {
+			backups++
+		}
+	}
+	if backups != 1 {
+		t.Errorf("expected a backup, got %d", backups)
+	}
+}
@@ -1,8 +1,8 @@
 // Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
 // SPDX-License-Identifier: Apache-2.0
 
-//go:build !tinygo
-// +build !tinygo
+//go:build !tinygo && !coraza.no_fs_access
+// +build !tinygo,!coraza.no_fs_access
 
 package loggers
 
@@ -11,11 +11,13 @@ import (
 	"io/fs"
 	"log"
 	"os"
+	"time"
 
 	"github.com/corazawaf/coraza/v3/types"
 )
 
-// serialWriter is used to store logs in a single file
+// serialWriter is used to store logs in a single file, the file is
+// rotated when auditlog_rotate_max_size or auditlog_rotate_interval are set
 type serialWriter struct {
 	closer    func() error
 	log       log.Logger
@@ -28,14 +30,29 @@ func (sl *serialWriter) Init(c types.Config) error {
 
 	fileName := c.Get("auditlog_file", "").(string)
 	var w io.Writer
-	if fileName != "" {
+	rotate := rotateOptions{
+		maxSize:    c.Get("auditlog_rotate_max_size", int64(0)).(int64),
+		interval:   c.Get("auditlog_rotate_interval", time.Duration(0)).(time.Duration),
+		maxBackups: c.Get("auditlog_rotate_max_backups", 0).(int),
+		maxAge:     c.Get("auditlog_rotate_max_age", time.Duration(0)).(time.Duration),
+		compress:   c.Get("auditlog_rotate_compress", false).(bool),
+	}
+	switch {
+	case fileName != "" && rotate.enabled():
+		f, err := openRotatingFile(fileName, fileMode, rotate)
+		if err != nil {
+			return err
+		}
+		w = f
+		sl.closer = f.Close
+	case fileName != "":
 		f, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, fileMode)
 		if err != nil {
 			return err
 		}
 		w = f
 		sl.closer = f.Close
-	} else {
+	default:
 		w = io.Discard
 		sl.closer = func() error { return nil }
 	}
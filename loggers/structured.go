@@ -0,0 +1,95 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package loggers
+
+import (
+	"fmt"
+	"io"
+)
+
+// StructuredLogger is a minimal interface that structured logging
+// libraries like zap or zerolog can implement with a few lines, it
+// is adapted to a DebugLogger with NewStructuredDebugLogger.
+type StructuredLogger interface {
+	// Log writes a formatted message with its fields
+	Log(level LogLevel, message string, fields []Field)
+}
+
+// NewStructuredDebugLogger returns a DebugLogger that formats the messages
+// and sends them with their fields to a StructuredLogger.
+// SetOutput is a no-op as the output is managed by the structured logger.
+func NewStructuredDebugLogger(l StructuredLogger) DebugLogger {
+	return &structuredDebugLogger{
+		state: &structuredLoggerState{
+			logger: l,
+			level:  LogLevelInfo,
+		},
+	}
+}
+
+// structuredLoggerState is shared between a logger and its children
+type structuredLoggerState struct {
+	logger StructuredLogger
+	level  LogLevel
+}
+
+type structuredDebugLogger struct {
+	state  *structuredLoggerState
+	fields []Field
+}
+
+var _ FieldLogger = (*structuredDebugLogger)(nil)
+
+func (l *structuredDebugLogger) log(level LogLevel, message string, args ...interface{}) {
+	if l.state.level < level {
+		return
+	}
+	if len(args) > 0 {
+		message = fmt.Sprintf(message, args...)
+	}
+	l.state.logger.Log(level, message, l.fields)
+}
+
+// Info logs an info message
+func (l *structuredDebugLogger) Info(message string, args ...interface{}) {
+	l.log(LogLevelInfo, message, args...)
+}
+
+// Warn logs a warning message
+func (l *structuredDebugLogger) Warn(message string, args ...interface{}) {
+	l.log(LogLevelWarn, message, args...)
+}
+
+// Error logs an error message
+func (l *structuredDebugLogger) Error(message string, args ...interface{}) {
+	l.log(LogLevelError, message, args...)
+}
+
+// Debug logs a debug message
+func (l *structuredDebugLogger) Debug(message string, args ...interface{}) {
+	l.log(LogLevelDebug, message, args...)
+}
+
+// Trace logs a trace message
+func (l *structuredDebugLogger) Trace(message string, args ...interface{}) {
+	l.log(LogLevelTrace, message, args...)
+}
+
+// SetLevel sets the log level
+func (l *structuredDebugLogger) SetLevel(level LogLevel) {
+	if level.Invalid() {
+		level = LogLevelInfo
+	}
+	l.state.level = level
+}
+
+// SetOutput is a no-op, the output is managed by the structured logger
+func (l *structuredDebugLogger) SetOutput(w io.WriteCloser) {}
+
+// With returns a logger with the current and the new fields
+func (l *structuredDebugLogger) With(fields ...Field) DebugLogger {
+	fs := make([]Field, 0, len(l.fields)+len(fields))
+	fs = append(append(fs, l.fields...), fields...)
+	return &structuredDebugLogger{state: l.state, fields: fs}
+}
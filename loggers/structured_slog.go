@@ -0,0 +1,50 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build go1.21
+// +build go1.21
+
+package loggers
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LevelTrace is the slog level used for trace messages
+const LevelTrace = slog.LevelDebug - 4
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+func (l slogLogger) Log(level LogLevel, message string, fields []Field) {
+	var lvl slog.Level
+	switch level {
+	case LogLevelError:
+		lvl = slog.LevelError
+	case LogLevelWarn:
+		lvl = slog.LevelWarn
+	case LogLevelDebug:
+		lvl = slog.LevelDebug
+	case LogLevelTrace:
+		lvl = LevelTrace
+	default:
+		lvl = slog.LevelInfo
+	}
+	ctx := context.Background()
+	if !l.logger.Enabled(ctx, lvl) {
+		return
+	}
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, f := range fields {
+		attrs = append(attrs, slog.Any(f.Key, f.Value))
+	}
+	l.logger.LogAttrs(ctx, lvl, message, attrs...)
+}
+
+// NewSlogDebugLogger returns a DebugLogger that writes to a slog.Logger,
+// messages must pass both the DebugLogger level and the slog handler level.
+func NewSlogDebugLogger(l *slog.Logger) DebugLogger {
+	return NewStructuredDebugLogger(slogLogger{logger: l})
+}
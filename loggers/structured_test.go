@@ -0,0 +1,46 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package loggers
+
+import (
+	"fmt"
+	"testing"
+)
+
+type testStructuredLogger struct {
+	entries []string
+}
+
+func (l *testStructuredLogger) Log(level LogLevel, message string, fields []Field) {
+	l.entries = append(l.entries, fmt.Sprintf("%s %s %v", level, message, fields))
+}
+
+func TestStructuredDebugLogger(t *testing.T) {
+	sl := &testStructuredLogger{}
+	l := NewStructuredDebugLogger(sl)
+	txl := With(l, String(FieldTransactionID, "abc"))
+	rl := With(txl, Int(FieldRuleID, 1))
+
+	rl.Debug("filtered %d", 1)
+	if len(sl.entries) != 0 {
+		t.Fatalf("expected debug message to be filtered, got %v", sl.entries)
+	}
+
+	// the level is shared with the children
+	l.SetLevel(LogLevelDebug)
+	rl.Debug("matched %d", 1)
+	txl.Info("done")
+	want := []string{
+		"DEBUG matched 1 [{tx_id abc} {rule_id 1}]",
+		"INFO done [{tx_id abc}]",
+	}
+	if len(sl.entries) != len(want) {
+		t.Fatalf("unexpected entries %v", sl.entries)
+	}
+	for i, w := range want {
+		if sl.entries[i] != w {
+			t.Errorf("unexpected entry, want %q, have %q", w, sl.entries[i])
+		}
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !tinygo
+// +build !tinygo
+
+package loggers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+const (
+	// syslogEnterpriseID is used in the structured data IDs, it is the
+	// number reserved for documentation by RFC 5612
+	syslogEnterpriseID = "32473"
+
+	defaultSyslogFacility   = 16 // local0
+	defaultSyslogBufferSize = 1000
+	syslogDialTimeout       = 5 * time.Second
+	syslogWriteTimeout      = 5 * time.Second
+	syslogRetryInterval     = time.Second
+
+	// syslogTimestamp is the RFC 5424 timestamp, which allows at most
+	// six digits of fractional seconds
+	syslogTimestamp = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// SyslogOptions configures a SyslogWriter
+type SyslogOptions struct {
+	// Address of the collector like udp://siem:514, tcp://siem:601 or
+	// tls://siem:6514
+	Address string
+	// TLSConfig is used by the tls transport, the system roots are used
+	// if it is nil
+	TLSConfig *tls.Config
+	// Facility of the messages, local0 (16) by default
+	Facility int
+	// Hostname and AppName identify the sender, they default to the
+	// host name and coraza
+	Hostname string
+	AppName  string
+	// BufferSize is the number of messages kept while the collector is
+	// unreachable, the oldest messages are discarded when it is full
+	BufferSize int
+	// Formatter serializes the audit logs, JSON by default
+	Formatter LogFormatter
+}
+
+// SyslogWriter sends the audit logs, and optionally the error logs, to
+// a syslog collector using the RFC 5424 format. TCP and TLS messages are
+// framed with octet counting as described by RFC 6587 and RFC 5425.
+//
+// The transaction and the matched rules are sent as structured data with
+// the coraza@32473 and rules@32473 IDs, the message is the formatted
+// audit log.
+//
+// Messages are buffered while the collector is unreachable and sent once
+// the connection is established again.
+type SyslogWriter struct {
+	mu      sync.Mutex
+	opts    SyslogOptions
+	network string
+	host    string
+	procID  string
+	conn    net.Conn
+	pending [][]byte
+	// lastDial is the time of the last failed connection attempt
+	lastDial      time.Time
+	retryInterval time.Duration
+	// dialing is true while the lock is released to connect
+	dialing bool
+	// generation changes when the connection is reset or closed, a
+	// connection established meanwhile is discarded
+	generation int
+}
+
+// NewSyslogWriter returns a writer configured with opts, it is also
+// registered as the syslog audit log type, in that case it is
+// configured with SecAuditLog tls://siem:6514 and the CA of the
+// collector with SecAuditLogSyslogCA.
+func NewSyslogWriter(opts SyslogOptions) *SyslogWriter {
+	w := &SyslogWriter{
+		procID:        strconv.Itoa(os.Getpid()),
+		retryInterval: syslogRetryInterval,
+	}
+	w.configure(opts)
+	return w
+}
+
+func (w *SyslogWriter) configure(opts SyslogOptions) {
+	if opts.Facility == 0 {
+		opts.Facility = defaultSyslogFacility
+	}
+	if opts.Hostname == "" {
+		opts.Hostname, _ = os.Hostname()
+	}
+	if opts.AppName == "" {
+		opts.AppName = "coraza"
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaultSyslogBufferSize
+	}
+	if opts.Formatter == nil {
+		opts.Formatter = jsonFormatter
+	}
+	w.opts = opts
+}
+
+// Init reads the collector address from auditlog_file, the formatter
+// from auditlog_formatter and the PEM encoded CA certificates of the
+// collector from auditlog_syslog_ca. The connection is established on
+// the first write.
+func (w *SyslogWriter) Init(c types.Config) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	opts := w.opts
+	opts.Address = c.Get("auditlog_file", opts.Address).(string)
+	opts.Formatter = c.Get("auditlog_formatter", opts.Formatter).(LogFormatter)
+	if ca := c.Get("auditlog_syslog_ca", []byte(nil)).([]byte); len(ca) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return errors.New("syslog: invalid CA certificates")
+		}
+		opts.TLSConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	w.configure(opts)
+	return w.reset()
+}
+
+// reset parses the address and closes the current connection, it must
+// be called with the lock held
+func (w *SyslogWriter) reset() error {
+	w.generation++
+	if w.conn != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	w.lastDial = time.Time{}
+	if w.opts.Address == "" {
+		w.network, w.host = "", ""
+		return nil
+	}
+	u, err := url.Parse(w.opts.Address)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("syslog: invalid address %q", w.opts.Address)
+	}
+	switch u.Scheme {
+	case "udp", "tcp", "tls":
+	default:
+		return fmt.Errorf("syslog: unsupported transport %q", u.Scheme)
+	}
+	w.network, w.host = u.Scheme, u.Host
+	return nil
+}
+
+// Write sends the audit log, if the collector is unreachable the
+// message is buffered and the error returned
+func (w *SyslogWriter) Write(al *AuditLog) error {
+	w.mu.Lock()
+	formatter := w.opts.Formatter
+	w.mu.Unlock()
+	msg, err := formatter(al)
+	if err != nil {
+		return err
+	}
+
+	sd := &strings.Builder{}
+	sd.WriteString("[coraza@" + syslogEnterpriseID)
+	writeSDParam(sd, "id", al.Transaction.ID)
+	writeSDParam(sd, "client_ip", al.Transaction.ClientIP)
+	writeSDParam(sd, "method", al.Transaction.Request.Method)
+	writeSDParam(sd, "uri", al.Transaction.Request.URI)
+	writeSDParam(sd, "status", strconv.Itoa(al.Transaction.Response.Status))
+	sd.WriteString("]")
+	if len(al.Messages) > 0 {
+		sd.WriteString("[rules@" + syslogEnterpriseID)
+		for _, m := range al.Messages {
+			writeSDParam(sd, "id", strconv.Itoa(m.Data.ID))
+		}
+		sd.WriteString("]")
+	}
+	ts := time.Unix(0, al.Transaction.UnixTimestamp)
+	return w.send(ts, types.RuleSeverityInfo, "audit", sd.String(), msg)
+}
+
+// WriteError sends the error log of a matched rule, it can be used as
+// the error callback of the WAF
+func (w *SyslogWriter) WriteError(mr types.MatchedRule) {
+	r := mr.Rule()
+	sd := &strings.Builder{}
+	sd.WriteString("[rule@" + syslogEnterpriseID)
+	writeSDParam(sd, "id", strconv.Itoa(r.ID()))
+	writeSDParam(sd, "severity", r.Severity().String())
+	if r.Version() != "" {
+		writeSDParam(sd, "ver", r.Version())
+	}
+	for _, tag := range r.Tags() {
+		writeSDParam(sd, "tag", tag)
+	}
+	writeSDParam(sd, "tx_id", mr.TransactionID())
+	sd.WriteString("]")
+	severity := types.RuleSeverityWarning
+	if mr.Disruptive() {
+		severity = types.RuleSeverityError
+	}
+	// the error is buffered and sent with the next message
+	_ = w.send(time.Now(), severity, "error", sd.String(), []byte(strings.TrimSpace(mr.ErrorLog(0))))
+}
+
+// send formats the RFC 5424 message and writes it with the buffered ones
+func (w *SyslogWriter) send(ts time.Time, severity types.RuleSeverity, msgID string, sd string, msg []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.network == "" {
+		return errors.New("syslog: no collector address configured")
+	}
+	pri := w.opts.Facility*8 + int(severity)
+	header := fmt.Sprintf("<%d>1 %s %s %s %s %s %s ", pri, ts.UTC().Format(syslogTimestamp),
+		headerField(w.opts.Hostname), headerField(w.opts.AppName), w.procID, msgID, sd)
+	line := append([]byte(header), msg...)
+	if len(w.pending) >= w.opts.BufferSize {
+		w.pending = w.pending[1:]
+	}
+	w.pending = append(w.pending, line)
+	return w.flush()
+}
+
+// flush sends the pending messages, it must be called with the lock held.
+// The lock is released while connecting so writers aren't blocked by an
+// unreachable collector, their messages are buffered meanwhile.
+func (w *SyslogWriter) flush() error {
+	if w.conn == nil {
+		if w.dialing || time.Since(w.lastDial) < w.retryInterval {
+			return fmt.Errorf("syslog: collector %s unavailable, %d messages buffered", w.host, len(w.pending))
+		}
+		w.dialing = true
+		generation, network, host, cfg := w.generation, w.network, w.host, w.opts.TLSConfig
+		w.mu.Unlock()
+		conn, err := dialSyslog(network, host, cfg)
+		w.mu.Lock()
+		w.dialing = false
+		if err != nil {
+			w.lastDial = time.Now()
+			return fmt.Errorf("syslog: %s, %d messages buffered", err.Error(), len(w.pending))
+		}
+		if w.generation != generation {
+			_ = conn.Close()
+			return fmt.Errorf("syslog: writer reset while connecting to %s, %d messages buffered", host, len(w.pending))
+		}
+		w.conn = conn
+	}
+	for len(w.pending) > 0 {
+		line := w.pending[0]
+		if w.network != "udp" {
+			line = append([]byte(strconv.Itoa(len(line))+" "), line...)
+		}
+		_ = w.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+		if _, err := w.conn.Write(line); err != nil {
+			_ = w.conn.Close()
+			w.conn = nil
+			return fmt.Errorf("syslog: %s, %d messages buffered", err.Error(), len(w.pending))
+		}
+		w.pending[0] = nil
+		w.pending = w.pending[1:]
+	}
+	return nil
+}
+
+func dialSyslog(network, host string, cfg *tls.Config) (net.Conn, error) {
+	d := &net.Dialer{Timeout: syslogDialTimeout}
+	if network != "tls" {
+		return d.Dial(network, host)
+	}
+	if cfg == nil {
+		cfg = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if cfg.ServerName == "" {
+		cfg = cfg.Clone()
+		cfg.ServerName, _, _ = net.SplitHostPort(host)
+	}
+	return tls.DialWithDialer(d, "tcp", host, cfg)
+}
+
+// Close sends the buffered messages if possible and closes the
+// connection
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var err error
+	if len(w.pending) > 0 && w.network != "" {
+		w.lastDial = time.Time{}
+		err = w.flush()
+	}
+	w.generation++
+	if w.conn != nil {
+		if cerr := w.conn.Close(); err == nil {
+			err = cerr
+		}
+		w.conn = nil
+	}
+	return err
+}
+
+// headerField returns the value of a header field, they can't be empty
+// or contain spaces
+func headerField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(s, " ", "_")
+}
+
+// writeSDParam writes a structured data parameter escaping the value
+func writeSDParam(sd *strings.Builder, name string, value string) {
+	sd.WriteString(" " + name + "=\"")
+	for _, c := range value {
+		if c == '"' || c == '\\' || c == ']' {
+			sd.WriteByte('\\')
+		}
+		sd.WriteRune(c)
+	}
+	sd.WriteString("\"")
+}
+
+var _ LogWriter = (*SyslogWriter)(nil)
@@ -0,0 +1,258 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !tinygo
+// +build !tinygo
+
+package loggers
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/corazawaf/coraza/v3/internal/corazarules"
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+var syslogTestLog = &AuditLog{
+	Transaction: AuditTransaction{
+		UnixTimestamp: time.Date(2022, 1, 1, 0, 0, 0, 123456789, time.UTC).UnixNano(),
+		ID:            "abc",
+		ClientIP:      "10.0.0.1",
+		Request:       AuditTransactionRequest{Method: "GET", URI: `/?q="]`},
+		Response:      AuditTransactionResponse{Status: 403},
+	},
+	Messages: []AuditMessage{{Data: AuditMessageData{ID: 942100}}, {Data: AuditMessageData{ID: 949110}}},
+}
+
+// the timestamp is truncated to microseconds
+const syslogTestPrefix = `<134>1 2022-01-01T00:00:00.123456Z host coraza `
+
+const syslogTestSD = ` audit [coraza@32473 id="abc" client_ip="10.0.0.1" method="GET" uri="/?q=\"\]" status="403"][rules@32473 id="942100" id="949110"] `
+
+// readFrame reads an octet counted message
+func readFrame(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	n, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := strconv.Atoi(strings.TrimSpace(n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
+
+func checkSyslogMessage(t *testing.T, msg string) {
+	t.Helper()
+	if !strings.HasPrefix(msg, syslogTestPrefix) || !strings.Contains(msg, syslogTestSD) || !strings.HasSuffix(msg, "abc") {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func newSyslogTestWriter(t *testing.T, address string, tlsConfig *tls.Config) *SyslogWriter {
+	t.Helper()
+	w := NewSyslogWriter(SyslogOptions{
+		Address:   address,
+		TLSConfig: tlsConfig,
+		Hostname:  "host",
+		Formatter: func(al *AuditLog) ([]byte, error) { return []byte(al.Transaction.ID), nil },
+	})
+	if err := w.reset(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = w.Close() })
+	return w
+}
+
+func TestSyslogWriterUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	w := newSyslogTestWriter(t, "udp://"+conn.LocalAddr().String(), nil)
+	if err := w.Write(syslogTestLog); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSyslogMessage(t, string(buf[:n]))
+}
+
+func TestSyslogWriterTCPReconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	// the collector is down
+	l.Close()
+
+	w := newSyslogTestWriter(t, "tcp://"+addr, nil)
+	w.retryInterval = 0
+	if err := w.Write(syslogTestLog); err == nil {
+		t.Fatal("expected an error while the collector is down")
+	}
+
+	l, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("failed to listen again on %s: %v", addr, err)
+	}
+	defer l.Close()
+	w.WriteError(&corazarules.MatchedRule{
+		TransactionID_: "abc",
+		Disruptive_:    true,
+		MatchedDatas_:  []types.MatchData{&corazarules.MatchData{Message_: "attack"}},
+		Rule_: &corazarules.RuleMetadata{
+			ID_:       100,
+			Severity_: types.RuleSeverityCritical,
+			Tags_:     []string{"attack"},
+		},
+	})
+	if len(w.pending) != 0 {
+		t.Fatalf("expected the buffered messages to be sent, got %d", len(w.pending))
+	}
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	checkSyslogMessage(t, readFrame(t, r))
+	if msg := readFrame(t, r); !strings.HasPrefix(msg, "<131>1 ") || !strings.Contains(msg, ` error [rule@32473 id="100" severity="critical" tag="attack" tx_id="abc"] [client`) || !strings.Contains(msg, "Coraza: Access denied") {
+		t.Errorf("unexpected error message %q", msg)
+	}
+}
+
+func TestSyslogWriterTLS(t *testing.T) {
+	cert, pool := newTestCertificate(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	w := newSyslogTestWriter(t, "tls://"+l.Addr().String(), &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12})
+	errc := make(chan error, 1)
+	go func() { errc <- w.Write(syslogTestLog) }()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	checkSyslogMessage(t, readFrame(t, bufio.NewReader(conn)))
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyslogWriterWritesWhileConnecting(t *testing.T) {
+	// the collector accepts the connection but never completes the TLS
+	// handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	w := newSyslogTestWriter(t, "tls://"+l.Addr().String(), nil)
+	errc := make(chan error, 1)
+	go func() { errc <- w.Write(syslogTestLog) }()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- w.Write(syslogTestLog) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected the message to be buffered while connecting")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the write not to wait for the connection")
+	}
+
+	conn.Close()
+	if err := <-errc; err == nil {
+		t.Error("expected the handshake to fail")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.pending) != 2 {
+		t.Errorf("expected 2 buffered messages, got %d", len(w.pending))
+	}
+}
+
+func TestSyslogWriterInit(t *testing.T) {
+	w := NewSyslogWriter(SyslogOptions{})
+	c := types.Config{}
+	for _, address := range []string{"/var/log/audit.log", "http://siem:514"} {
+		c.Set("auditlog_file", address)
+		if err := w.Init(c); err == nil {
+			t.Errorf("expected an error for %q", address)
+		}
+	}
+	c.Set("auditlog_file", "tls://siem:6514")
+	c.Set("auditlog_syslog_ca", []byte("invalid"))
+	if err := w.Init(c); err == nil {
+		t.Error("expected an error for invalid CA certificates")
+	}
+}
+
+// newTestCertificate returns a self signed certificate for 127.0.0.1
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	cert, err := tls.X509KeyPair(certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	return cert, pool
+}
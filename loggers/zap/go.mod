@@ -0,0 +1,16 @@
+module github.com/corazawaf/coraza/v3/loggers/zap
+
+go 1.18
+
+require (
+	github.com/corazawaf/coraza/v3 v3.0.0-20220914101451-05d352c89b24
+	go.uber.org/zap v1.23.0
+)
+
+require (
+	go.uber.org/atomic v1.7.0 // indirect
+	go.uber.org/multierr v1.6.0 // indirect
+)
+
+// the adapter uses APIs that are not released yet
+replace github.com/corazawaf/coraza/v3 => ../../
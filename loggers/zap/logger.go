@@ -0,0 +1,55 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package zap writes the debug logs of Coraza to a zap.Logger, it is a
+// module on its own so Coraza doesn't depend on zap:
+//
+//	logger, _ := zap.NewProduction()
+//	waf, _ := coraza.NewWAF(coraza.NewWAFConfig().
+//		WithDebugLogger(corazazap.NewDebugLogger(logger)))
+package zap
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/corazawaf/coraza/v3/loggers"
+)
+
+// LevelTrace is the zap level used for trace messages
+const LevelTrace = zapcore.DebugLevel - 1
+
+type zapLogger struct {
+	logger *zap.Logger
+}
+
+func (l zapLogger) Log(level loggers.LogLevel, message string, fields []loggers.Field) {
+	var lvl zapcore.Level
+	switch level {
+	case loggers.LogLevelError:
+		lvl = zapcore.ErrorLevel
+	case loggers.LogLevelWarn:
+		lvl = zapcore.WarnLevel
+	case loggers.LogLevelDebug:
+		lvl = zapcore.DebugLevel
+	case loggers.LogLevelTrace:
+		lvl = LevelTrace
+	default:
+		lvl = zapcore.InfoLevel
+	}
+	ce := l.logger.Check(lvl, message)
+	if ce == nil {
+		return
+	}
+	zf := make([]zap.Field, 0, len(fields))
+	for _, f := range fields {
+		zf = append(zf, zap.Any(f.Key, f.Value))
+	}
+	ce.Write(zf...)
+}
+
+// NewDebugLogger returns a DebugLogger that writes to a zap.Logger,
+// messages must pass both the DebugLogger level and the zap core level.
+func NewDebugLogger(l *zap.Logger) loggers.DebugLogger {
+	return loggers.NewStructuredDebugLogger(zapLogger{logger: l})
+}
@@ -0,0 +1,38 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package zap
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/corazawaf/coraza/v3/loggers"
+)
+
+func TestDebugLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	l := NewDebugLogger(zap.New(core))
+	l.SetLevel(loggers.LogLevelTrace)
+	rl := loggers.With(l, loggers.String(loggers.FieldTransactionID, "abc"), loggers.Int(loggers.FieldRuleID, 1))
+
+	rl.Debug("matched %d", 1)
+	// below the level of the zap core
+	rl.Trace("evaluated %d", 1)
+
+	entries := logs.AllUntimed()
+	if len(entries) != 1 {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	e := entries[0]
+	if e.Level != zapcore.DebugLevel || e.Message != "matched 1" {
+		t.Errorf("unexpected entry %v", e)
+	}
+	fields := e.ContextMap()
+	if fields[loggers.FieldTransactionID] != "abc" || fields[loggers.FieldRuleID] != int64(1) {
+		t.Errorf("unexpected fields %v", fields)
+	}
+}
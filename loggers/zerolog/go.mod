@@ -0,0 +1,17 @@
+module github.com/corazawaf/coraza/v3/loggers/zerolog
+
+go 1.18
+
+require (
+	github.com/corazawaf/coraza/v3 v3.0.0-20220914101451-05d352c89b24
+	github.com/rs/zerolog v1.28.0
+)
+
+require (
+	github.com/mattn/go-colorable v0.1.12 // indirect
+	github.com/mattn/go-isatty v0.0.14 // indirect
+	golang.org/x/sys v0.2.0 // indirect
+)
+
+// the adapter uses APIs that are not released yet
+replace github.com/corazawaf/coraza/v3 => ../../
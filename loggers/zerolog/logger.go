@@ -0,0 +1,50 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package zerolog writes the debug logs of Coraza to a zerolog.Logger, it
+// is a module on its own so Coraza doesn't depend on zerolog:
+//
+//	logger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+//	waf, _ := coraza.NewWAF(coraza.NewWAFConfig().
+//		WithDebugLogger(corazazerolog.NewDebugLogger(logger)))
+package zerolog
+
+import (
+	"github.com/rs/zerolog"
+
+	"github.com/corazawaf/coraza/v3/loggers"
+)
+
+type zerologLogger struct {
+	logger zerolog.Logger
+}
+
+func (l zerologLogger) Log(level loggers.LogLevel, message string, fields []loggers.Field) {
+	var lvl zerolog.Level
+	switch level {
+	case loggers.LogLevelError:
+		lvl = zerolog.ErrorLevel
+	case loggers.LogLevelWarn:
+		lvl = zerolog.WarnLevel
+	case loggers.LogLevelDebug:
+		lvl = zerolog.DebugLevel
+	case loggers.LogLevelTrace:
+		lvl = zerolog.TraceLevel
+	default:
+		lvl = zerolog.InfoLevel
+	}
+	e := l.logger.WithLevel(lvl)
+	if e == nil {
+		return
+	}
+	for _, f := range fields {
+		e = e.Interface(f.Key, f.Value)
+	}
+	e.Msg(message)
+}
+
+// NewDebugLogger returns a DebugLogger that writes to a zerolog.Logger,
+// messages must pass both the DebugLogger level and the zerolog level.
+func NewDebugLogger(l zerolog.Logger) loggers.DebugLogger {
+	return loggers.NewStructuredDebugLogger(zerologLogger{logger: l})
+}
@@ -0,0 +1,29 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package zerolog
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/corazawaf/coraza/v3/loggers"
+)
+
+func TestDebugLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewDebugLogger(zerolog.New(buf).Level(zerolog.DebugLevel))
+	l.SetLevel(loggers.LogLevelTrace)
+	rl := loggers.With(l, loggers.String(loggers.FieldTransactionID, "abc"), loggers.Int(loggers.FieldRuleID, 1))
+
+	rl.Debug("matched %d", 1)
+	// below the level of the zerolog logger
+	rl.Trace("evaluated %d", 1)
+
+	want := `{"level":"debug","tx_id":"abc","rule_id":1,"message":"matched 1"}` + "\n"
+	if have := buf.String(); have != want {
+		t.Errorf("unexpected log, want %q, have %q", want, have)
+	}
+}
@@ -28,11 +28,17 @@ func NewMacro(data string) (Macro, error) {
 }
 
 type macroToken struct {
-	text     string
-	variable *variables.RuleVariable
+	text string
+	// variable and key are resolved at compile time, variable is
+	// Unknown for text tokens
+	variable variables.RuleVariable
 	key      string
 }
 
+// maxStackTokens is the number of tokens expanded without allocating
+// a slice to hold the expanded values
+const maxStackTokens = 8
+
 // macro is used to create tokenized strings that can be
 // "expanded" at high speed and concurrent-safe.
 // A macro contains tokens for strings and expansions
@@ -44,34 +50,56 @@ type macroToken struct {
 type macro struct {
 	original string
 	tokens   []macroToken
+	// expandable is false when the macro contains only text
+	expandable bool
 }
 
-// Expand the pre-compiled macro expression into a string
+// Expand the pre-compiled macro expression into a string, the expanded
+// values are collected first so the result is built with a single
+// allocation
 func (m *macro) Expand(tx rules.TransactionState) string {
-	if len(m.tokens) == 1 {
-		return expandToken(tx, m.tokens[0])
+	switch {
+	case !m.expandable:
+		return m.original
+	case len(m.tokens) == 1:
+		return expandToken(tx, &m.tokens[0])
+	}
+	var (
+		stack  [maxStackTokens]string
+		values []string
+	)
+	if len(m.tokens) <= maxStackTokens {
+		values = stack[:len(m.tokens)]
+	} else {
+		values = make([]string, len(m.tokens))
+	}
+	size := 0
+	for i := range m.tokens {
+		values[i] = expandToken(tx, &m.tokens[i])
+		size += len(values[i])
 	}
 	res := strings.Builder{}
-	for _, token := range m.tokens {
-		res.WriteString(expandToken(tx, token))
+	res.Grow(size)
+	for _, v := range values {
+		res.WriteString(v)
 	}
 	return res.String()
 }
 
-func expandToken(tx rules.TransactionState, token macroToken) string {
-	if token.variable == nil {
+func expandToken(tx rules.TransactionState, token *macroToken) string {
+	if token.variable == variables.Unknown {
 		return token.text
 	}
-	switch col := tx.Collection(*token.variable).(type) {
+	switch col := tx.Collection(token.variable).(type) {
 	case *collection.Map:
-		if c := col.Get(token.key); len(c) > 0 {
-			return c[0]
+		if v, ok := col.First(token.key); ok {
+			return v
 		}
 	case *collection.Simple:
 		return col.String()
 	case *collection.Proxy:
-		if c := col.Get(token.key); len(c) > 0 {
-			return c[0]
+		if v, ok := col.First(token.key); ok {
+			return v
 		}
 	case *collection.TranslationProxy:
 		if c := col.Get(0); len(c) > 0 {
@@ -94,14 +122,12 @@ func (m *macro) compile(input string) error {
 	ismacro := false
 	for i := 0; i < len(input); i++ {
 		c := input[i]
-		if c == '%' && (i <= len(input) && input[i+1] == '{') {
+		if c == '%' && i+1 < len(input) && input[i+1] == '{' {
 			// we have a macro
 			if currentToken.Len() > 0 {
 				// we add the text token
 				m.tokens = append(m.tokens, macroToken{
-					text:     currentToken.String(),
-					variable: nil,
-					key:      "",
+					text: currentToken.String(),
 				})
 			}
 			currentToken.Reset()
@@ -115,15 +141,16 @@ func (m *macro) compile(input string) error {
 				ismacro = false
 				varName, key, _ := strings.Cut(currentToken.String(), ".")
 				v, err := variables.Parse(varName)
-				if err != nil {
+				if err != nil || v == variables.Unknown {
 					return fmt.Errorf("invalid variable %s", varName)
 				}
 				// we add the variable token
 				m.tokens = append(m.tokens, macroToken{
 					text:     currentToken.String(),
-					variable: &v,
+					variable: v,
 					key:      strings.ToLower(key),
 				})
+				m.expandable = true
 				currentToken.Reset()
 				continue
 			}
@@ -133,12 +160,15 @@ func (m *macro) compile(input string) error {
 		// we have a normal character
 		currentToken.WriteByte(c)
 	}
+	// an unclosed macro is kept as text
+	if ismacro {
+		currentToken.Reset()
+		currentToken.WriteString(input[strings.LastIndex(input, "%{"):])
+	}
 	// if there is something left
 	if currentToken.Len() > 0 {
 		m.tokens = append(m.tokens, macroToken{
-			text:     currentToken.String(),
-			variable: nil,
-			key:      "",
+			text: currentToken.String(),
 		})
 	}
 	return nil
@@ -149,7 +179,7 @@ func (m *macro) String() string {
 	return m.original
 }
 
-// IsExpandable return true if there are macro expanadable tokens
+// IsExpandable return true if there are macro expandable tokens
 func (m *macro) IsExpandable() bool {
-	return len(m.tokens) > 1
+	return m.expandable
 }
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 
 	"github.com/magefile/mage/mg"
@@ -21,6 +22,11 @@ var addLicenseVersion = "v1.0.0" // https://github.com/google/addlicense
 var golangCILintVer = "v1.48.0"  // https://github.com/golangci/golangci-lint/releases
 var gosImportsVer = "v0.1.5"     // https://github.com/rinchsan/gosimports/releases/tag/v0.1.5
 
+// integrationModules are the modules with their own dependencies, like the
+// framework integrations, they replace coraza with the local tree and are
+// tested on their own
+var integrationModules = []string{"fasthttp", "fiber", "gin", "echo", "grpc", "envoy/extproc", "regex/re2", "loggers/zap", "loggers/zerolog"}
+
 var errRunGoModTidy = errors.New("go.mod/sum not formatted, commit changes")
 var errNoGitDir = errors.New("no .git directory found")
 
@@ -29,6 +35,11 @@ func Format() error {
 	if err := sh.RunV("go", "mod", "tidy"); err != nil {
 		return err
 	}
+	for _, m := range integrationModules {
+		if err := runInModule(m, "go", "mod", "tidy"); err != nil {
+			return err
+		}
+	}
 	// addlicense strangely logs skipped files to stderr despite not being erroneous, so use the long sh.Exec form to
 	// discard stderr too.
 	if _, err := sh.Exec(map[string]string{}, io.Discard, io.Discard, "go", "run", fmt.Sprintf("github.com/google/addlicense@%s", addLicenseVersion),
@@ -60,6 +71,20 @@ func Lint() error {
 		return errRunGoModTidy
 	}
 
+	// the go.sum of the integrations must be committed too
+	for _, m := range integrationModules {
+		if err := runInModule(m, "go", "mod", "tidy"); err != nil {
+			return err
+		}
+		out, err := sh.Output("git", "status", "--porcelain", "--", filepath.Join(m, "go.mod"), filepath.Join(m, "go.sum"))
+		if err != nil {
+			return err
+		}
+		if out != "" {
+			return errRunGoModTidy
+		}
+	}
+
 	return nil
 }
 
@@ -68,6 +93,10 @@ func Test() error {
 	if err := sh.RunV("go", "test", "./..."); err != nil {
 		return err
 	}
+	// The reduced builds are tested with their tags, TinyGo implies them
+	if err := sh.RunV("go", "test", "-tags=coraza.no_fs_access", "./..."); err != nil {
+		return err
+	}
 	if err := sh.RunV("go", "test", "./examples/http-server"); err != nil {
 		return err
 	}
@@ -75,9 +104,30 @@ func Test() error {
 		return err
 	}
 
+	return Integrations()
+}
+
+// Integrations runs the tests of the framework integrations.
+func Integrations() error {
+	for _, m := range integrationModules {
+		if err := runInModule(m, "go", "test", "-race", "./..."); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// runInModule runs a command in the directory of a module, outside of
+// the workspace so the go.mod and go.sum of the module are used
+func runInModule(dir string, cmd string, args ...string) error {
+	c := exec.Command(cmd, args...)
+	c.Dir = dir
+	c.Env = append(os.Environ(), "GOWORK=off")
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
 // Coverage runs tests with coverage and race detector enabled.
 func Coverage() error {
 	if err := os.MkdirAll("build", 0755); err != nil {
@@ -97,6 +147,9 @@ func Coverage() error {
 	if err := sh.RunV("go", "test", "-race", "-tags=tinygo", "-coverprofile=build/coverage-tinygo.txt", "-covermode=atomic", "-coverpkg=./...", "./..."); err != nil {
 		return err
 	}
+	if err := Integrations(); err != nil {
+		return err
+	}
 
 	return sh.RunV("go", "tool", "cover", "-html=build/coverage.txt", "-o", "build/coverage.html")
 }
@@ -108,6 +161,24 @@ func Fuzz() error {
 		pkg   string
 		tests []string
 	}{
+		{
+			pkg: "./bodyprocessors",
+			tests: []string{
+				"FuzzBodyProcessors",
+			},
+		},
+		{
+			pkg: "./internal/corazawaf",
+			tests: []string{
+				"FuzzParseRequestReader",
+			},
+		},
+		{
+			pkg: "./internal/seclang",
+			tests: []string{
+				"FuzzSeclangParse",
+			},
+		},
 		{
 			pkg: "./operators",
 			tests: []string{
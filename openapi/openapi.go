@@ -0,0 +1,538 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package openapi enforces an OpenAPI 3 specification as an allow list,
+// the requests are checked before the phase 1 and phase 2 rules:
+//
+//	spec, _ := openapi.Load(data)
+//	waf, _ := coraza.NewWAF(coraza.NewWAFConfig().WithOpenAPI(spec, openapi.Reject))
+//
+// The unknown paths and methods, the undeclared query parameters and
+// body properties, the values not matching their schema and the missing
+// required parameters are exposed to the rules with the OPENAPI_OPERATION
+// and OPENAPI_VIOLATIONS variables. Only JSON specifications are
+// supported, and only JSON request bodies are validated.
+package openapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/internal/jsonschema"
+)
+
+// Action is applied to the requests violating the specification
+type Action int
+
+const (
+	// Detect only sets the variables, rules decide what to do
+	Detect Action = iota
+	// Reject interrupts the requests with a 400 status if the rule engine
+	// is On
+	Reject
+)
+
+func (a Action) String() string {
+	switch a {
+	case Detect:
+		return "detect"
+	case Reject:
+		return "reject"
+	}
+	return "unknown"
+}
+
+// Kinds of Violation
+const (
+	UnknownPath         = "unknown_path"
+	UnknownMethod       = "unknown_method"
+	UndeclaredParameter = "undeclared_parameter"
+	TypeMismatch        = "type_mismatch"
+	MissingRequired     = "missing_required"
+	UnknownContentType  = "unknown_content_type"
+)
+
+// Violation is a part of the request not allowed by the specification
+type Violation struct {
+	// Kind is one of the violation constants, like UnknownPath
+	Kind string
+	// Location is the invalid part of the request, like query.limit,
+	// header.x-api-key or body.items[0].quantity
+	Location string
+	Message  string
+}
+
+// Request contains the parts of a request checked against the
+// specification, the parameter names are compared case insensitively
+type Request struct {
+	Method string
+	// Path is the decoded path, without query string
+	Path   string
+	Query  map[string][]string
+	Header map[string][]string
+	Cookie map[string][]string
+}
+
+// Spec is a compiled OpenAPI specification, it is safe for concurrent use
+type Spec struct {
+	// basePaths are the paths of the servers, longest first
+	basePaths []string
+	routes    []*route
+}
+
+type route struct {
+	template string
+	re       *regexp.Regexp
+	// params is the number of templated segments, literal paths are
+	// matched first
+	params     int
+	operations map[string]*Operation
+}
+
+// Operation is an operation of the specification
+type Operation struct {
+	id         string
+	parameters []*parameter
+	body       *requestBody
+}
+
+type parameter struct {
+	name     string
+	in       string
+	required bool
+	// schema is nil if any value is allowed, the items schema for arrays
+	schema *jsonschema.Schema
+	array  bool
+	// explode is false if array values are separated by commas
+	explode bool
+}
+
+type requestBody struct {
+	required bool
+	// content maps the media types to their schema, which is nil if any
+	// body is allowed
+	content map[string]*jsonschema.Schema
+}
+
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// loader resolves the references of the specification while compiling it
+type loader struct {
+	doc      map[string]interface{}
+	compiler *jsonschema.Compiler
+}
+
+// Load compiles a JSON encoded OpenAPI 3 specification
+func Load(data []byte) (*Spec, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI specification, only JSON is supported: %w", err)
+	}
+	version, _ := doc["openapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q", version)
+	}
+	compiler, err := jsonschema.NewCompiler(data)
+	if err != nil {
+		return nil, err
+	}
+	l := &loader{doc: doc, compiler: compiler}
+	s := &Spec{}
+
+	servers, _ := doc["servers"].([]interface{})
+	for _, srv := range servers {
+		u, _ := object(srv)["url"].(string)
+		if parsed, err := url.Parse(u); err == nil && !strings.Contains(u, "{") {
+			if p := strings.TrimSuffix(parsed.Path, "/"); p != "" {
+				s.basePaths = append(s.basePaths, p)
+			}
+		}
+	}
+	sort.Slice(s.basePaths, func(i, j int) bool { return len(s.basePaths[i]) > len(s.basePaths[j]) })
+
+	paths := object(doc["paths"])
+	if len(paths) == 0 {
+		return nil, errors.New("the specification doesn't declare any path")
+	}
+	for template, item := range paths {
+		r, err := l.route(template, object(item))
+		if err != nil {
+			return nil, fmt.Errorf("path %q: %w", template, err)
+		}
+		s.routes = append(s.routes, r)
+	}
+	sort.Slice(s.routes, func(i, j int) bool {
+		a, b := s.routes[i], s.routes[j]
+		if a.params != b.params {
+			return a.params < b.params
+		}
+		return a.template < b.template
+	})
+	return s, nil
+}
+
+// templateParam matches the parameters of the path templates like {id}
+var templateParam = regexp.MustCompile(`\{[^{}/]+\}`)
+
+func (l *loader) route(template string, item map[string]interface{}) (*route, error) {
+	r := &route{template: template, operations: map[string]*Operation{}}
+	var expr strings.Builder
+	last := 0
+	for _, loc := range templateParam.FindAllStringIndex(template, -1) {
+		expr.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		expr.WriteString(`([^/]+)`)
+		last = loc[1]
+		r.params++
+	}
+	expr.WriteString(regexp.QuoteMeta(template[last:]))
+	re, err := regexp.Compile("^" + expr.String() + "$")
+	if err != nil {
+		return nil, err
+	}
+	r.re = re
+	itemPtr := "#/paths/" + escapePointer(template)
+	shared, err := l.parameters(item["parameters"], itemPtr+"/parameters")
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range methods {
+		op, ok := item[m]
+		if !ok {
+			continue
+		}
+		o, err := l.operation(strings.ToUpper(m)+" "+template, object(op), shared, itemPtr+"/"+m)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", m, err)
+		}
+		r.operations[strings.ToUpper(m)] = o
+	}
+	return r, nil
+}
+
+func (l *loader) operation(name string, op map[string]interface{}, shared []*parameter, ptr string) (*Operation, error) {
+	o := &Operation{id: name}
+	if id, ok := op["operationId"].(string); ok && id != "" {
+		o.id = id
+	}
+	params, err := l.parameters(op["parameters"], ptr+"/parameters")
+	if err != nil {
+		return nil, err
+	}
+	// the operation parameters override the path item ones
+	o.parameters = params
+	for _, sp := range shared {
+		overridden := false
+		for _, p := range params {
+			if strings.EqualFold(p.name, sp.name) && p.in == sp.in {
+				overridden = true
+			}
+		}
+		if !overridden {
+			o.parameters = append(o.parameters, sp)
+		}
+	}
+	if rb, ok := op["requestBody"]; ok {
+		if o.body, err = l.requestBody(rb, ptr+"/requestBody"); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+func (l *loader) parameters(v interface{}, ptr string) ([]*parameter, error) {
+	list, _ := v.([]interface{})
+	var params []*parameter
+	for i, item := range list {
+		obj, p, err := l.resolve(object(item), ptr+"/"+strconv.Itoa(i))
+		if err != nil {
+			return nil, err
+		}
+		param := &parameter{explode: true}
+		param.name, _ = obj["name"].(string)
+		param.in, _ = obj["in"].(string)
+		param.required, _ = obj["required"].(bool)
+		if param.name == "" || param.in == "" {
+			return nil, fmt.Errorf("invalid parameter at %s", p)
+		}
+		style, _ := obj["style"].(string)
+		if explode, ok := obj["explode"].(bool); ok {
+			param.explode = explode
+		} else if style != "" && style != "form" {
+			param.explode = false
+		}
+		if schema, ok := obj["schema"]; ok {
+			schemaPtr := p + "/schema"
+			if s, _, err := l.resolve(object(schema), schemaPtr); err == nil && s["type"] == "array" {
+				param.array = true
+				schemaPtr += "/items"
+				if _, ok := s["items"]; !ok {
+					schemaPtr = ""
+				}
+			}
+			if schemaPtr != "" {
+				if param.schema, err = l.compiler.Compile(schemaPtr); err != nil {
+					return nil, fmt.Errorf("parameter %q: %w", param.name, err)
+				}
+			}
+		}
+		params = append(params, param)
+	}
+	return params, nil
+}
+
+func (l *loader) requestBody(v interface{}, ptr string) (*requestBody, error) {
+	obj, p, err := l.resolve(object(v), ptr)
+	if err != nil {
+		return nil, err
+	}
+	rb := &requestBody{content: map[string]*jsonschema.Schema{}}
+	rb.required, _ = obj["required"].(bool)
+	for mt, media := range object(obj["content"]) {
+		var schema *jsonschema.Schema
+		if _, ok := object(media)["schema"]; ok && isJSON(mt) {
+			if schema, err = l.compiler.Compile(p + "/content/" + escapePointer(mt) + "/schema"); err != nil {
+				return nil, fmt.Errorf("request body %q: %w", mt, err)
+			}
+		}
+		rb.content[strings.ToLower(mt)] = schema
+	}
+	return rb, nil
+}
+
+// resolve follows the $ref of obj, it returns the referenced object and
+// its JSON pointer
+func (l *loader) resolve(obj map[string]interface{}, ptr string) (map[string]interface{}, string, error) {
+	for i := 0; i < 16; i++ {
+		ref, ok := obj["$ref"].(string)
+		if !ok {
+			return obj, ptr, nil
+		}
+		if !strings.HasPrefix(ref, "#/") {
+			return nil, "", fmt.Errorf("unsupported reference %q", ref)
+		}
+		var v interface{} = l.doc
+		for _, token := range strings.Split(ref[2:], "/") {
+			token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+			v = object(v)[token]
+		}
+		if obj = object(v); obj == nil {
+			return nil, "", fmt.Errorf("invalid reference %q", ref)
+		}
+		ptr = ref
+	}
+	return nil, "", fmt.Errorf("too many nested references at %s", ptr)
+}
+
+func object(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+func isJSON(mediaType string) bool {
+	mt := strings.ToLower(mediaType)
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// CheckRequest returns the operation matching the request and the
+// violations of its path, method and parameters. The operation is nil
+// for unknown paths and methods.
+func (s *Spec) CheckRequest(r Request) (*Operation, []Violation) {
+	path := r.Path
+	for _, base := range s.basePaths {
+		if path == base || strings.HasPrefix(path, base+"/") {
+			path = path[len(base):]
+			break
+		}
+	}
+	if path == "" {
+		path = "/"
+	}
+	var (
+		matched *route
+		values  []string
+	)
+	for _, rt := range s.routes {
+		if m := rt.re.FindStringSubmatch(path); m != nil {
+			matched, values = rt, m[1:]
+			break
+		}
+	}
+	if matched == nil {
+		return nil, []Violation{{Kind: UnknownPath, Location: "path", Message: fmt.Sprintf("path %q is not declared", r.Path)}}
+	}
+	op, ok := matched.operations[strings.ToUpper(r.Method)]
+	if !ok {
+		return nil, []Violation{{Kind: UnknownMethod, Location: "method", Message: fmt.Sprintf("method %s is not declared for %s", r.Method, matched.template)}}
+	}
+
+	pathValues := map[string][]string{}
+	for i, name := range templateParam.FindAllString(matched.template, -1) {
+		pathValues[strings.ToLower(strings.Trim(name, "{}"))] = []string{values[i]}
+	}
+	sources := map[string]map[string][]string{
+		"path":   pathValues,
+		"query":  lowerKeys(r.Query),
+		"header": lowerKeys(r.Header),
+		"cookie": lowerKeys(r.Cookie),
+	}
+	var violations []Violation
+	for _, p := range op.parameters {
+		location := p.in + "." + p.name
+		vals, ok := sources[p.in][strings.ToLower(p.name)]
+		if !ok {
+			if p.required {
+				violations = append(violations, Violation{Kind: MissingRequired, Location: location, Message: "required parameter is missing"})
+			}
+			continue
+		}
+		if v := p.check(location, vals); v != nil {
+			violations = append(violations, *v)
+		}
+	}
+	var undeclared []string
+	for name := range sources["query"] {
+		if !op.declares("query", name) {
+			undeclared = append(undeclared, name)
+		}
+	}
+	sort.Strings(undeclared)
+	for _, name := range undeclared {
+		violations = append(violations, Violation{Kind: UndeclaredParameter, Location: "query." + name, Message: "parameter is not declared"})
+	}
+	return op, violations
+}
+
+// ID returns the operationId of the operation, or its method and path
+// template, like GET /users/{id}
+func (o *Operation) ID() string {
+	return o.id
+}
+
+func (o *Operation) declares(in string, name string) bool {
+	for _, p := range o.parameters {
+		if p.in == in && strings.EqualFold(p.name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// check validates the values of the parameter
+func (p *parameter) check(location string, values []string) *Violation {
+	if p.schema == nil {
+		return nil
+	}
+	if !p.array && len(values) > 1 {
+		return &Violation{Kind: TypeMismatch, Location: location, Message: "parameter is repeated"}
+	}
+	if p.array && !p.explode {
+		var split []string
+		for _, v := range values {
+			split = append(split, strings.Split(v, ",")...)
+		}
+		values = split
+	}
+	for _, v := range values {
+		if err := validateString(p.schema, v); err != nil {
+			return &Violation{Kind: TypeMismatch, Location: location, Message: err.Message}
+		}
+	}
+	return nil
+}
+
+// validateString validates a parameter value, it is valid if the schema
+// accepts it either as a string or as a JSON number, boolean or null
+func validateString(s *jsonschema.Schema, value string) *jsonschema.ValidationError {
+	var scalar interface{}
+	if err := json.Unmarshal([]byte(value), &scalar); err == nil {
+		switch scalar.(type) {
+		case float64, bool, nil:
+			if s.Validate([]byte(value)) == nil {
+				return nil
+			}
+		}
+	}
+	quoted, _ := json.Marshal(value)
+	var verr *jsonschema.ValidationError
+	if err := s.Validate(quoted); errors.As(err, &verr) {
+		return verr
+	}
+	return nil
+}
+
+func lowerKeys(m map[string][]string) map[string][]string {
+	res := make(map[string][]string, len(m))
+	for k, v := range m {
+		k = strings.ToLower(k)
+		res[k] = append(res[k], v...)
+	}
+	return res
+}
+
+// CheckBody returns the violations of the request body read from body,
+// JSON bodies are validated as they are decoded. An empty or nil body is
+// only checked if the operation requires one.
+func (o *Operation) CheckBody(contentType string, body io.Reader) []Violation {
+	var br *bufio.Reader
+	if body != nil {
+		br = bufio.NewReader(body)
+	}
+	if br == nil || isEmpty(br) {
+		if o.body != nil && o.body.required {
+			return []Violation{{Kind: MissingRequired, Location: "body", Message: "request body is required"}}
+		}
+		return nil
+	}
+	if o.body == nil {
+		return []Violation{{Kind: UndeclaredParameter, Location: "body", Message: "request body is not declared"}}
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	schema, ok := o.body.content[mt]
+	if !ok {
+		if i := strings.IndexByte(mt, '/'); i >= 0 {
+			schema, ok = o.body.content[mt[:i]+"/*"]
+		}
+	}
+	if !ok {
+		schema, ok = o.body.content["*/*"]
+	}
+	if !ok {
+		return []Violation{{Kind: UnknownContentType, Location: "body", Message: fmt.Sprintf("content type %q is not declared", contentType)}}
+	}
+	if schema == nil || !isJSON(mt) {
+		return nil
+	}
+	var verr *jsonschema.ValidationError
+	if err := schema.ValidateReader(br); !errors.As(err, &verr) {
+		return nil
+	}
+	kind := TypeMismatch
+	switch verr.Keyword {
+	case "required":
+		kind = MissingRequired
+	case "additionalProperties":
+		kind = UndeclaredParameter
+	}
+	return []Violation{{Kind: kind, Location: "body" + strings.TrimPrefix(verr.Path, "$"), Message: verr.Message}}
+}
+
+func isEmpty(br *bufio.Reader) bool {
+	_, err := br.Peek(1)
+	return err != nil
+}
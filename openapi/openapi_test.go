@@ -0,0 +1,169 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package openapi
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSpec = `{
+  "openapi": "3.0.3",
+  "servers": [{"url": "https://api.example.com/v1"}],
+  "paths": {
+    "/users": {
+      "get": {
+        "operationId": "listUsers",
+        "parameters": [
+          {"name": "limit", "in": "query", "schema": {"type": "integer", "maximum": 100}},
+          {"name": "tags", "in": "query", "explode": false, "schema": {"type": "array", "items": {"type": "string", "maxLength": 3}}},
+          {"$ref": "#/components/parameters/key"}
+        ]
+      },
+      "post": {
+        "requestBody": {"$ref": "#/components/requestBodies/user"}
+      }
+    },
+    "/users/{id}": {
+      "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+      "get": {"operationId": "getUser"},
+      "put": {
+        "requestBody": {"content": {"text/*": {}}}
+      }
+    },
+    "/users/me": {
+      "get": {"operationId": "me"}
+    }
+  },
+  "components": {
+    "parameters": {
+      "key": {"name": "X-API-Key", "in": "header", "required": true, "schema": {"type": "string"}}
+    },
+    "requestBodies": {
+      "user": {
+        "required": true,
+        "content": {
+          "application/json": {
+            "schema": {
+              "type": "object",
+              "required": ["name"],
+              "additionalProperties": false,
+              "properties": {
+                "name": {"type": "string"},
+                "age": {"type": "integer", "nullable": true}
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+func TestCheckRequest(t *testing.T) {
+	s, err := Load([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := map[string][]string{"x-api-key": {"a"}}
+	tests := []struct {
+		req Request
+		op  string
+		// violations contains the kind and location of the violations
+		violations []string
+	}{
+		{Request{Method: "GET", Path: "/v1/users", Header: key}, "listUsers", nil},
+		{Request{Method: "get", Path: "/v1/users", Query: map[string][]string{"limit": {"10"}, "tags": {"a,b"}}, Header: key}, "listUsers", nil},
+		{Request{Method: "GET", Path: "/v1/users", Query: map[string][]string{"limit": {"x"}}, Header: key}, "listUsers", []string{"type_mismatch query.limit"}},
+		{Request{Method: "GET", Path: "/v1/users", Query: map[string][]string{"limit": {"1", "2"}}, Header: key}, "listUsers", []string{"type_mismatch query.limit"}},
+		{Request{Method: "GET", Path: "/v1/users", Query: map[string][]string{"tags": {"a,abcd"}}, Header: key}, "listUsers", []string{"type_mismatch query.tags"}},
+		{Request{Method: "GET", Path: "/v1/users", Query: map[string][]string{"debug": {"1"}}}, "listUsers", []string{"missing_required header.X-API-Key", "undeclared_parameter query.debug"}},
+		{Request{Method: "GET", Path: "/v1/users/12"}, "getUser", nil},
+		{Request{Method: "GET", Path: "/v1/users/me"}, "me", nil},
+		{Request{Method: "GET", Path: "/v1/users/abc"}, "getUser", []string{"type_mismatch path.id"}},
+		{Request{Method: "PUT", Path: "/v1/users/12"}, "PUT /users/{id}", nil},
+		{Request{Method: "DELETE", Path: "/v1/users/12"}, "", []string{"unknown_method method"}},
+		{Request{Method: "GET", Path: "/v1/admin"}, "", []string{"unknown_path path"}},
+		{Request{Method: "GET", Path: "/users/12"}, "getUser", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.req.Method+" "+tt.req.Path, func(t *testing.T) {
+			op, violations := s.CheckRequest(tt.req)
+			if tt.op == "" {
+				if op != nil {
+					t.Errorf("unexpected operation %q", op.ID())
+				}
+			} else if op == nil || op.ID() != tt.op {
+				t.Errorf("expected operation %q, got %v", tt.op, op)
+			}
+			if len(violations) != len(tt.violations) {
+				t.Fatalf("expected violations %v, got %v", tt.violations, violations)
+			}
+			for i, v := range violations {
+				if have := v.Kind + " " + v.Location; have != tt.violations[i] {
+					t.Errorf("expected violation %q, got %q", tt.violations[i], have)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckBody(t *testing.T) {
+	s, err := Load([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, _ := s.CheckRequest(Request{Method: "POST", Path: "/v1/users"})
+	put, _ := s.CheckRequest(Request{Method: "PUT", Path: "/v1/users/1"})
+	get, _ := s.CheckRequest(Request{Method: "GET", Path: "/v1/users/1"})
+	tests := []struct {
+		op          *Operation
+		contentType string
+		body        string
+		violation   string
+	}{
+		{post, "application/json; charset=utf-8", `{"name": "a", "age": null}`, ""},
+		{post, "application/json", `{"name": "a", "age": "1"}`, "type_mismatch body.age"},
+		{post, "application/json", `{"age": 1}`, "missing_required body"},
+		{post, "application/json", `{"name": "a", "admin": true}`, "undeclared_parameter body.admin"},
+		{post, "application/json", `{"name":`, "type_mismatch body"},
+		{post, "application/json", ``, "missing_required body"},
+		{post, "application/xml", `<a/>`, "unknown_content_type body"},
+		{put, "text/plain", `anything`, ""},
+		{put, "", ``, ""},
+		{get, "text/plain", `a`, "undeclared_parameter body"},
+	}
+	for _, tt := range tests {
+		violations := tt.op.CheckBody(tt.contentType, strings.NewReader(tt.body))
+		if tt.violation == "" {
+			if len(violations) != 0 {
+				t.Errorf("unexpected violations %v for %s", violations, tt.body)
+			}
+			continue
+		}
+		if len(violations) != 1 || violations[0].Kind+" "+violations[0].Location != tt.violation {
+			t.Errorf("expected violation %q for %s, got %v", tt.violation, tt.body, violations)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, spec := range []string{
+		`openapi: 3.0.0`,
+		`{"swagger": "2.0", "paths": {"/": {}}}`,
+		`{"openapi": "3.0.0", "paths": {}}`,
+		`{"openapi": "3.0.0", "paths": {"/": {"get": {"parameters": [{"$ref": "#/components/parameters/missing"}]}}}}`,
+		`{"openapi": "3.0.0", "paths": {"/": {"get": {"parameters": [{"name": "a", "in": "query", "schema": {"pattern": "("}}]}}}}`,
+	} {
+		if _, err := Load([]byte(spec)); err == nil {
+			t.Errorf("expected an error loading %s", spec)
+		}
+	}
+}
+
+func TestActionString(t *testing.T) {
+	if Detect.String() != "detect" || Reject.String() != "reject" {
+		t.Error("unexpected action names")
+	}
+}
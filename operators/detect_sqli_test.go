@@ -28,3 +28,20 @@ func FuzzSQLi(f *testing.F) {
 		_ = sqli.Evaluate(tx, tc)
 	})
 }
+
+func TestDetectSQLiCapturesFingerprint(t *testing.T) {
+	sqli := &detectSQLi{}
+	waf := corazawaf.NewWAF()
+	tx := waf.NewTransaction()
+	defer tx.Close()
+	tx.Capture = true
+	if sqli.Evaluate(tx, "this is not isqli") {
+		t.Fatal("unexpected match")
+	}
+	if !sqli.Evaluate(tx, "1' or '1'='1") {
+		t.Fatal("expected match")
+	}
+	if v := tx.Variables().TX().Get("0"); len(v) != 1 || v[0] != "s&sos" {
+		t.Errorf("unexpected fingerprint %q", v)
+	}
+}
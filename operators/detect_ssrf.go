@@ -0,0 +1,171 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !coraza.disabled_operators.detectSSRF
+
+package operators
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/internal/iptrie"
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+// ssrfInternalNetworks are the loopback, private, link-local and
+// reserved networks requests should never be forwarded to
+var ssrfInternalNetworks = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+}
+
+// ssrfInternalHosts are names resolving to internal services, including
+// the metadata endpoints of cloud providers
+var ssrfInternalHosts = []string{
+	"localhost",
+	"metadata",
+	"metadata.google.internal",
+	"instance-data",
+}
+
+// ssrfSchemes can reach internal services even without an internal host
+var ssrfSchemes = map[string]struct{}{
+	"dict":   {},
+	"file":   {},
+	"gopher": {},
+	"jar":    {},
+	"ldap":   {},
+	"netdoc": {},
+	"tftp":   {},
+}
+
+var ssrfURLRx = regexp.MustCompile(`(?i)[a-z][a-z0-9+.\-]*://[^\s"'<>]+`)
+
+// detectSSRF matches values containing URLs that target internal
+// networks, either with a literal address in any of the encodings
+// accepted by inet_aton, like decimal, octal or hexadecimal, an
+// IPv4-mapped IPv6 address, an internal host name or a dangerous scheme.
+// Arguments are an optional comma separated list of additional internal
+// networks and domains, like 203.0.113.0/24,corp.example.com.
+// The offending URL is captured into TX:0.
+type detectSSRF struct {
+	networks *iptrie.Trie
+	hosts    []string
+}
+
+var _ rules.Operator = (*detectSSRF)(nil)
+
+func newDetectSSRF(options rules.OperatorOptions) (rules.Operator, error) {
+	o := &detectSSRF{
+		networks: iptrie.New(),
+		hosts:    append([]string(nil), ssrfInternalHosts...),
+	}
+	for _, n := range ssrfInternalNetworks {
+		_, subnet, _ := net.ParseCIDR(n)
+		o.networks.Insert(subnet)
+	}
+	for _, zone := range strings.Split(options.Arguments, ",") {
+		zone = strings.ToLower(strings.TrimSpace(zone))
+		switch {
+		case zone == "":
+		case strings.Contains(zone, "/"):
+			_, subnet, err := net.ParseCIDR(zone)
+			if err != nil {
+				return nil, fmt.Errorf("invalid internal network %q: %s", zone, err.Error())
+			}
+			o.networks.Insert(subnet)
+		default:
+			if ip := net.ParseIP(zone); ip != nil {
+				o.networks.Insert(&net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+				continue
+			}
+			o.hosts = append(o.hosts, strings.TrimPrefix(zone, "."))
+		}
+	}
+	return o, nil
+}
+
+func (o *detectSSRF) Evaluate(tx rules.TransactionState, value string) bool {
+	for _, candidate := range ssrfURLRx.FindAllString(value, -1) {
+		if o.isInternal(candidate) {
+			tx.CaptureField(0, candidate)
+			return true
+		}
+	}
+	return false
+}
+
+func (o *detectSSRF) isInternal(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	if _, ok := ssrfSchemes[strings.ToLower(u.Scheme)]; ok {
+		return true
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return false
+	}
+	if ip := parseHostIP(host); ip != nil {
+		return o.networks.Contains(ip)
+	}
+	for _, h := range o.hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHostIP parses IPv6 addresses and IPv4 addresses in any of the
+// forms accepted by inet_aton, like 2130706433, 0x7f.1 or 0177.0.0.1
+func parseHostIP(host string) net.IP {
+	if strings.Contains(host, ":") {
+		return net.ParseIP(host)
+	}
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+	values := make([]uint64, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 0, 32)
+		if err != nil {
+			return nil
+		}
+		values[i] = v
+	}
+	// the last part fills the remaining bytes of the address
+	var addr uint64
+	last := len(values) - 1
+	for i, v := range values[:last] {
+		if v > 0xff {
+			return nil
+		}
+		addr |= v << (24 - 8*uint(i))
+	}
+	if values[last] >= 1<<(32-8*uint(last)) {
+		return nil
+	}
+	addr |= values[last]
+	return net.IPv4(byte(addr>>24), byte(addr>>16), byte(addr>>8), byte(addr))
+}
+
+func init() {
+	Register("detectSSRF", newDetectSSRF)
+}
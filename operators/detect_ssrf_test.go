@@ -0,0 +1,74 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package operators
+
+import (
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+func TestDetectSSRF(t *testing.T) {
+	op, err := newDetectSSRF(rules.OperatorOptions{Arguments: "203.0.113.0/24, corp.example.com, 198.51.100.7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"https://example.com/", false},
+		{"no urls here", false},
+		{"http://8.8.8.8/", false},
+		{"http://127.0.0.1/", true},
+		{"url=http://169.254.169.254/latest/meta-data/", true},
+		{"http://10.1.2.3:8080/admin", true},
+		{"http://192.168.0.1", true},
+		{"http://172.16.5.4", true},
+		{"http://2130706433/", true},
+		{"http://0x7f000001/", true},
+		{"http://0177.0.0.1/", true},
+		{"http://127.1/", true},
+		{"http://0/", true},
+		{"http://[::1]/", true},
+		{"http://[::ffff:127.0.0.1]/", true},
+		{"http://[::ffff:7f00:1]/", true},
+		{"http://[fe80::1]/", true},
+		{"http://localhost/", true},
+		{"http://LOCALHOST./", true},
+		{"http://app.localhost/", true},
+		{"http://metadata.google.internal/computeMetadata/v1/", true},
+		{"http://user@127.0.0.1/", true},
+		{"http://127.0.0.1.nip.io/", false},
+		{"file:///etc/passwd", true},
+		{"gopher://example.com:6379/_INFO", true},
+		{"http://203.0.113.10/", true},
+		{"http://198.51.100.7/", true},
+		{"http://api.corp.example.com/", true},
+		{"http://notcorp.example.com/", false},
+		{"http://256.0.0.1/", false},
+		{"http://1.2.3.4.5/", false},
+	}
+	waf := corazawaf.NewWAF()
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			tx := waf.NewTransaction()
+			defer tx.Close()
+			tx.Capture = true
+			if got := op.Evaluate(tx, tt.value); got != tt.want {
+				t.Fatalf("want %t, got %t", tt.want, got)
+			}
+			if tt.want {
+				if v := tx.Variables().TX().Get("0"); len(v) != 1 || v[0] == "" {
+					t.Errorf("expected URL to be captured, got %q", v)
+				}
+			}
+		})
+	}
+
+	if _, err := newDetectSSRF(rules.OperatorOptions{Arguments: "10.0.0.0/33"}); err == nil {
+		t.Error("expected error for invalid network")
+	}
+}
@@ -19,8 +19,14 @@ func newDetectXSS(rules.OperatorOptions) (rules.Operator, error) {
 	return &detectXSS{}, nil
 }
 
-func (o *detectXSS) Evaluate(_ rules.TransactionState, value string) bool {
-	return libinjection.IsXSS(value)
+func (o *detectXSS) Evaluate(tx rules.TransactionState, value string) bool {
+	if !libinjection.IsXSS(value) {
+		return false
+	}
+	// libinjection has no XSS fingerprints, like ModSecurity the
+	// matched input is captured instead
+	tx.CaptureField(0, value)
+	return true
 }
 
 func init() {
@@ -29,3 +29,21 @@ func FuzzXSS(f *testing.F) {
 		_ = xss.Evaluate(tx, tc)
 	})
 }
+
+func TestDetectXSSCapturesInput(t *testing.T) {
+	xss := &detectXSS{}
+	waf := corazawaf.NewWAF()
+	tx := waf.NewTransaction()
+	defer tx.Close()
+	tx.Capture = true
+	if xss.Evaluate(tx, "this is not an XSS") {
+		t.Fatal("unexpected match")
+	}
+	input := "<script>alert(1)</script>"
+	if !xss.Evaluate(tx, input) {
+		t.Fatal("expected match")
+	}
+	if v := tx.Variables().TX().Get("0"); len(v) != 1 || v[0] != input {
+		t.Errorf("unexpected captured value %q", v)
+	}
+}
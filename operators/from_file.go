@@ -8,12 +8,20 @@ import (
 	"io/fs"
 	"os"
 	"path"
+	"strings"
+
+	ioutils "github.com/corazawaf/coraza/v3/internal/io"
 )
 
 var errEmptyPaths = errors.New("empty paths")
 
 func loadFromFile(filepath string, paths []string, root fs.FS) ([]byte, error) {
 	if path.IsAbs(filepath) {
+		// the file systems other than the OS one, like embed.FS, only
+		// accept paths relative to their root
+		if _, ok := root.(ioutils.OSFS); !ok {
+			filepath = strings.TrimLeft(filepath, "/")
+		}
 		return fs.ReadFile(root, filepath)
 	}
 
@@ -83,3 +83,17 @@ func TestLoadFromCustomFS(t *testing.T) {
 		t.Errorf("unexpected content, want %q, have %q", want, have)
 	}
 }
+
+func TestLoadFromCustomFSAbsolutePath(t *testing.T) {
+	fs := fstest.MapFS{}
+	fs["animals/bear.txt"] = &fstest.MapFile{Data: []byte("pooh"), Mode: 0755}
+
+	content, err := loadFromFile("/animals/bear.txt", nil, fs)
+	if err != nil {
+		t.Errorf("failed to load from file: %s", err.Error())
+	}
+
+	if want, have := "pooh", string(content); want != have {
+		t.Errorf("unexpected content, want %q, have %q", want, have)
+	}
+}
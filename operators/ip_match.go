@@ -9,11 +9,14 @@ import (
 	"net"
 	"strings"
 
+	"github.com/corazawaf/coraza/v3/internal/iptrie"
 	"github.com/corazawaf/coraza/v3/rules"
 )
 
+// ipMatch compiles the networks into a radix tree, so the evaluation
+// cost does not depend on the number of networks
 type ipMatch struct {
-	subnets []net.IPNet
+	subnets *iptrie.Trie
 }
 
 var _ rules.Operator = (*ipMatch)(nil)
@@ -21,7 +24,7 @@ var _ rules.Operator = (*ipMatch)(nil)
 func newIPMatch(options rules.OperatorOptions) (rules.Operator, error) {
 	data := options.Arguments
 
-	var subnets []net.IPNet
+	subnets := iptrie.New()
 	for _, sb := range strings.Split(data, ",") {
 		sb = strings.TrimSpace(sb)
 		if sb == "" {
@@ -38,19 +41,13 @@ func newIPMatch(options rules.OperatorOptions) (rules.Operator, error) {
 		if err != nil {
 			continue
 		}
-		subnets = append(subnets, *subnet)
+		subnets.Insert(subnet)
 	}
 	return &ipMatch{subnets: subnets}, nil
 }
 
 func (o *ipMatch) Evaluate(tx rules.TransactionState, value string) bool {
-	ip := net.ParseIP(value)
-	for _, subnet := range o.subnets {
-		if subnet.Contains(ip) {
-			return true
-		}
-	}
-	return false
+	return o.subnets.Contains(net.ParseIP(value))
 }
 
 func init() {
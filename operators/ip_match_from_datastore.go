@@ -0,0 +1,40 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !coraza.disabled_operators.ipMatchFromDatastore
+
+package operators
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/datastore"
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+// ipMatchFromDatastore matches IP addresses against an IPSet registered
+// in the datastore package, the set can be updated at runtime
+type ipMatchFromDatastore struct {
+	set *datastore.IPSet
+}
+
+var _ rules.Operator = (*ipMatchFromDatastore)(nil)
+
+func newIPMatchFromDatastore(options rules.OperatorOptions) (rules.Operator, error) {
+	name := strings.TrimSpace(options.Arguments)
+	set, ok := datastore.GetIPSet(name)
+	if !ok {
+		return nil, fmt.Errorf("ip datastore %q not found", name)
+	}
+	return &ipMatchFromDatastore{set: set}, nil
+}
+
+func (o *ipMatchFromDatastore) Evaluate(tx rules.TransactionState, value string) bool {
+	return o.set.Contains(net.ParseIP(value))
+}
+
+func init() {
+	Register("ipMatchFromDatastore", newIPMatchFromDatastore)
+}
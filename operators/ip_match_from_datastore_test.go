@@ -0,0 +1,37 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package operators
+
+import (
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/datastore"
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+func TestIPMatchFromDatastore(t *testing.T) {
+	set := datastore.NewIPSet()
+	datastore.RegisterIPSet("blocklist", set)
+	op, err := newIPMatchFromDatastore(rules.OperatorOptions{Arguments: "blocklist"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op.Evaluate(nil, "1.2.3.4") {
+		t.Error("unexpected match for empty set")
+	}
+	// updates apply without creating the operator again
+	if err := set.Add("1.2.3.0/24"); err != nil {
+		t.Fatal(err)
+	}
+	if !op.Evaluate(nil, "1.2.3.4") {
+		t.Error("expected match after updating the set")
+	}
+	if op.Evaluate(nil, "invalid") {
+		t.Error("unexpected match for invalid address")
+	}
+
+	if _, err := newIPMatchFromDatastore(rules.OperatorOptions{Arguments: "unknown"}); err == nil {
+		t.Error("expected error for unknown datastore")
+	}
+}
@@ -9,16 +9,41 @@ import (
 	"bufio"
 	"bytes"
 	"strings"
+	"sync/atomic"
 
 	"github.com/corazawaf/coraza/v3/rules"
 )
 
+// ipMatchFromFile is an ipMatch operator loading the networks from a
+// file, the radix tree is rebuilt when the operator is reloaded
+type ipMatchFromFile struct {
+	options rules.OperatorOptions
+	// match contains the current rules.Operator built by newIPMatch
+	match atomic.Value
+}
+
+var (
+	_ rules.Operator           = (*ipMatchFromFile)(nil)
+	_ rules.ReloadableOperator = (*ipMatchFromFile)(nil)
+)
+
 func newIPMatchFromFile(options rules.OperatorOptions) (rules.Operator, error) {
-	path := options.Arguments
+	o := &ipMatchFromFile{options: options}
+	if err := o.Reload(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *ipMatchFromFile) Evaluate(tx rules.TransactionState, value string) bool {
+	return o.match.Load().(rules.Operator).Evaluate(tx, value)
+}
 
-	data, err := loadFromFile(path, options.Path, options.Root)
+// Reload implements rules.ReloadableOperator
+func (o *ipMatchFromFile) Reload() error {
+	data, err := loadFromFile(o.options.Arguments, o.options.Path, o.options.Root)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	dataParsed := strings.Builder{}
@@ -39,7 +64,12 @@ func newIPMatchFromFile(options rules.OperatorOptions) (rules.Operator, error) {
 	opts := rules.OperatorOptions{
 		Arguments: dataParsed.String(),
 	}
-	return newIPMatch(opts)
+	m, err := newIPMatch(opts)
+	if err != nil {
+		return err
+	}
+	o.match.Store(m)
+	return nil
 }
 
 func init() {
@@ -4,6 +4,7 @@
 package operators
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -40,3 +41,38 @@ func TestFromFile(t *testing.T) {
 		})
 	}
 }
+
+func TestFromFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.dat")
+	if err := os.WriteFile(path, []byte("10.0.0.1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ipm, err := newIPMatchFromFile(rules.OperatorOptions{Arguments: path, Root: io.OSFS{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ipm.Evaluate(nil, "10.0.0.1") || ipm.Evaluate(nil, "10.0.0.2") {
+		t.Fatal("unexpected result before the reload")
+	}
+
+	if err := os.WriteFile(path, []byte("10.0.0.2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipm.(rules.ReloadableOperator).Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if ipm.Evaluate(nil, "10.0.0.1") || !ipm.Evaluate(nil, "10.0.0.2") {
+		t.Error("unexpected result after the reload")
+	}
+
+	// a failed reload keeps the previous networks
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipm.(rules.ReloadableOperator).Reload(); err == nil {
+		t.Error("expected an error reloading a missing file")
+	}
+	if !ipm.Evaluate(nil, "10.0.0.2") {
+		t.Error("expected the previous networks to be kept")
+	}
+}
@@ -19,6 +19,15 @@ func Get(name string, options rules.OperatorOptions) (rules.Operator, error) {
 	return nil, fmt.Errorf("operator %s not found", name)
 }
 
+// memoize returns the artifact for key from the memoizer of the
+// options, fn is called directly if there is none
+func memoize(options rules.OperatorOptions, key string, fn func() (interface{}, error)) (interface{}, error) {
+	if options.Memoizer == nil {
+		return fn()
+	}
+	return options.Memoizer.Do(key, fn)
+}
+
 // Register registers a new operator
 // If the operator already exists it will be overwritten
 func Register(name string, op rules.OperatorFactory) {
@@ -49,9 +49,6 @@ func TestOperators(t *testing.T) {
 	notImplemented := []string{
 		"containsWord",
 		"strmatch",
-		"verifyCC",
-		"verifycpf",
-		"verifyssn",
 		"verifysvnr",
 	}
 
@@ -64,7 +61,7 @@ func TestOperators(t *testing.T) {
 	for _, f := range files {
 		cases := unmarshalTests(t, f)
 		for _, data := range cases {
-			if utils.InSlice("containsWord", notImplemented) {
+			if utils.InSlice(data.Name, notImplemented) {
 				continue
 			}
 			for capName, capVal := range captureMatrix {
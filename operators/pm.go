@@ -27,15 +27,17 @@ func newPM(options rules.OperatorOptions) (rules.Operator, error) {
 
 	data = strings.ToLower(data)
 	dict := strings.Split(data, " ")
-	builder := ahocorasick.NewAhoCorasickBuilder(ahocorasick.Opts{
-		AsciiCaseInsensitive: true,
-		MatchOnlyWholeWords:  false,
-		MatchKind:            ahocorasick.LeftMostLongestMatch,
-		DFA:                  true,
-	})
-
 	// TODO this operator is supposed to support snort data syntax: "@pm A|42|C|44|F"
-	return &pm{matcher: builder.Build(dict)}, nil
+	m, _ := memoize(options, "pm:"+data, func() (interface{}, error) {
+		builder := ahocorasick.NewAhoCorasickBuilder(ahocorasick.Opts{
+			AsciiCaseInsensitive: true,
+			MatchOnlyWholeWords:  false,
+			MatchKind:            ahocorasick.LeftMostLongestMatch,
+			DFA:                  true,
+		})
+		return builder.Build(dict), nil
+	})
+	return &pm{matcher: m.(ahocorasick.AhoCorasick)}, nil
 }
 
 func (o *pm) Evaluate(tx rules.TransactionState, value string) bool {
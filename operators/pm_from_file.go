@@ -9,16 +9,59 @@ import (
 	"bufio"
 	"bytes"
 	"strings"
+	"sync/atomic"
 
 	ahocorasick "github.com/petar-dambovaliev/aho-corasick"
 
 	"github.com/corazawaf/coraza/v3/rules"
 )
 
+// pmFromFile is a pm operator loading the patterns from a file, the
+// automaton is rebuilt when the operator is reloaded
+type pmFromFile struct {
+	options rules.OperatorOptions
+	// matcher contains the current ahocorasick.AhoCorasick
+	matcher atomic.Value
+}
+
+var (
+	_ rules.Operator           = (*pmFromFile)(nil)
+	_ rules.ReloadableOperator = (*pmFromFile)(nil)
+)
+
 func newPMFromFile(options rules.OperatorOptions) (rules.Operator, error) {
-	path := options.Arguments
+	lines, err := loadPMFromFile(options)
+	if err != nil {
+		return nil, err
+	}
+
+	m, _ := memoize(options, "pmFromFile:"+strings.Join(lines, "\n"), func() (interface{}, error) {
+		return buildPMFromFile(lines), nil
+	})
+	o := &pmFromFile{options: options}
+	o.matcher.Store(m.(ahocorasick.AhoCorasick))
+	return o, nil
+}
+
+func (o *pmFromFile) Evaluate(tx rules.TransactionState, value string) bool {
+	return pmEvaluate(o.matcher.Load().(ahocorasick.AhoCorasick), tx, value)
+}
 
-	data, err := loadFromFile(path, options.Path, options.Root)
+// Reload implements rules.ReloadableOperator, the automaton is not
+// memoized as the previous versions of the file are no longer used
+func (o *pmFromFile) Reload() error {
+	lines, err := loadPMFromFile(o.options)
+	if err != nil {
+		return err
+	}
+	o.matcher.Store(buildPMFromFile(lines))
+	return nil
+}
+
+// loadPMFromFile returns the lowercased patterns of the file, the empty
+// lines and the comments are skipped
+func loadPMFromFile(options rules.OperatorOptions) ([]string, error) {
+	data, err := loadFromFile(options.Arguments, options.Path, options.Root)
 	if err != nil {
 		return nil, err
 	}
@@ -36,15 +79,17 @@ func newPMFromFile(options rules.OperatorOptions) (rules.Operator, error) {
 		}
 		lines = append(lines, strings.ToLower(l))
 	}
+	return lines, nil
+}
 
+func buildPMFromFile(lines []string) ahocorasick.AhoCorasick {
 	builder := ahocorasick.NewAhoCorasickBuilder(ahocorasick.Opts{
 		AsciiCaseInsensitive: true,
 		MatchOnlyWholeWords:  false,
 		MatchKind:            ahocorasick.LeftMostLongestMatch,
 		DFA:                  false,
 	})
-
-	return &pm{matcher: builder.Build(lines)}, nil
+	return builder.Build(lines)
 }
 
 func init() {
@@ -0,0 +1,115 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !coraza.disabled_operators.rateLimit
+
+package operators
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/corazawaf/coraza/v3/macro"
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+// rateLimit counts the evaluations of a key within a sliding window and
+// matches once the threshold is exceeded. Arguments are the threshold and
+// window like 100/60s, optionally followed by a key expression like
+// %{REMOTE_ADDR}:%{REQUEST_URI}. Without a key expression the evaluated
+// value is used as key. Counters are kept in the WAF rate limit store.
+//
+// A key is counted once per transaction, the evaluations of the same key
+// by the rule for the transaction, like a key expression evaluated for
+// every argument, reuse the first count.
+type rateLimit struct {
+	threshold int
+	window    time.Duration
+	key       macro.Macro
+	// namespace avoids sharing counters between different limits
+	namespace string
+}
+
+var _ rules.Operator = (*rateLimit)(nil)
+
+// rateLimitHitsKey is the key of the hits counted by a rule for a
+// transaction
+type rateLimitHitsKey struct {
+	op *rateLimit
+}
+
+func newRateLimit(options rules.OperatorOptions) (rules.Operator, error) {
+	data := strings.TrimSpace(options.Arguments)
+	limit, key, _ := strings.Cut(data, " ")
+	threshold, window, err := parseRateLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	o := &rateLimit{
+		threshold: threshold,
+		window:    window,
+		namespace: data,
+	}
+	if key = strings.TrimSpace(key); key != "" {
+		if o.key, err = macro.NewMacro(key); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// parseRateLimit parses limits like 100/60s, a window without unit is
+// expressed in seconds
+func parseRateLimit(limit string) (int, time.Duration, error) {
+	t, w, ok := strings.Cut(limit, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid rate limit %q, expected threshold/window", limit)
+	}
+	threshold, err := strconv.Atoi(t)
+	if err != nil || threshold < 0 {
+		return 0, 0, fmt.Errorf("invalid rate limit threshold %q", t)
+	}
+	if n, err := strconv.Atoi(w); err == nil {
+		w = strconv.Itoa(n) + "s"
+	}
+	window, err := time.ParseDuration(w)
+	if err != nil || window <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate limit window %q", w)
+	}
+	return threshold, window, nil
+}
+
+func (o *rateLimit) Evaluate(tx rules.TransactionState, value string) bool {
+	store := tx.RateLimitStore()
+	if store == nil {
+		return false
+	}
+	key := value
+	if o.key != nil {
+		key = o.key.Expand(tx)
+	}
+	counted := tx.OperatorState(rateLimitHitsKey{o}, func() interface{} { return map[string]int{} }).(map[string]int)
+	hits, ok := counted[key]
+	if !ok {
+		var err error
+		hits, err = store.Increment(o.namespace+"|"+key, time.Now(), o.window)
+		if err != nil {
+			tx.DebugLogger().Error("failed to increment rate limit counter: %s", err.Error())
+			return false
+		}
+		counted[key] = hits
+	}
+	if hits <= o.threshold {
+		return false
+	}
+	if tx.Capturing() {
+		tx.CaptureField(0, strconv.Itoa(hits))
+	}
+	return true
+}
+
+func init() {
+	Register("rateLimit", newRateLimit)
+}
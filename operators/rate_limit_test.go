@@ -0,0 +1,99 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package operators
+
+import (
+	"testing"
+	"time"
+
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+func TestRateLimit(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	op, err := newRateLimit(rules.OperatorOptions{Arguments: "2/1m %{REMOTE_ADDR}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTx := func(addr string) *corazawaf.Transaction {
+		tx := waf.NewTransaction()
+		tx.ProcessConnection(addr, 1234, "", 0)
+		return tx
+	}
+
+	for i := 0; i < 2; i++ {
+		if op.Evaluate(newTx("10.0.0.1"), "") {
+			t.Fatalf("unexpected match for hit %d", i+1)
+		}
+	}
+	if !op.Evaluate(newTx("10.0.0.1"), "") {
+		t.Error("expected match once the threshold is exceeded")
+	}
+	if op.Evaluate(newTx("10.0.0.2"), "") {
+		t.Error("unexpected match for a different key")
+	}
+
+	// other limits don't share counters
+	other, err := newRateLimit(rules.OperatorOptions{Arguments: "5/1m %{REMOTE_ADDR}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Evaluate(newTx("10.0.0.1"), "") {
+		t.Error("unexpected match for a different limit")
+	}
+}
+
+func TestRateLimitValueKey(t *testing.T) {
+	waf := corazawaf.NewWAF()
+	op, err := newRateLimit(rules.OperatorOptions{Arguments: "1/10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	if op.Evaluate(tx, "a") || op.Evaluate(tx, "b") {
+		t.Error("unexpected match for first hits")
+	}
+	// a key is counted once per transaction
+	if op.Evaluate(tx, "a") {
+		t.Error("unexpected match for the same transaction")
+	}
+	if !op.Evaluate(waf.NewTransaction(), "a") {
+		t.Error("expected match for second hit")
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		limit     string
+		threshold int
+		window    time.Duration
+		err       bool
+	}{
+		{"100/60s", 100, time.Minute, false},
+		{"10/30", 10, 30 * time.Second, false},
+		{"1/1h", 1, time.Hour, false},
+		{"100", 0, 0, true},
+		{"a/1s", 0, 0, true},
+		{"-1/1s", 0, 0, true},
+		{"1/0s", 0, 0, true},
+		{"1/x", 0, 0, true},
+	}
+	for _, tt := range tests {
+		threshold, window, err := parseRateLimit(tt.limit)
+		if tt.err {
+			if err == nil {
+				t.Errorf("expected error for %q", tt.limit)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", tt.limit, err.Error())
+			continue
+		}
+		if threshold != tt.threshold || window != tt.window {
+			t.Errorf("unexpected limit for %q: %d/%s", tt.limit, threshold, window)
+		}
+	}
+}
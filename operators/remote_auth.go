@@ -0,0 +1,189 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !tinygo && !coraza.disabled_operators.remoteAuth
+// +build !tinygo,!coraza.disabled_operators.remoteAuth
+
+package operators
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+const (
+	// remoteAuthTimeout is the default timeout of the authorizer calls
+	remoteAuthTimeout = 200 * time.Millisecond
+	// remoteAuthMaxFailures is the number of consecutive failures opening
+	// the circuit breaker
+	remoteAuthMaxFailures = 5
+	// remoteAuthCooldown is the time the circuit breaker stays open
+	remoteAuthCooldown = 30 * time.Second
+	// remoteAuthMaxResponse is the maximum size of a verdict
+	remoteAuthMaxResponse = 64 * 1024
+	// remoteAuthMaxCalls is the number of authorizer calls allowed per
+	// transaction, shared by all the remoteAuth rules
+	remoteAuthMaxCalls = 10
+)
+
+// remoteAuthCallsKey is the key of the number of calls made for a
+// transaction
+type remoteAuthCallsKey struct{}
+
+// remoteAuth posts the value to an external authorizer and matches if its
+// verdict says so. Arguments are the URL of the authorizer, optionally
+// followed by the timeout, like https://authz.internal/score 100ms.
+//
+// The request is a JSON object with the transaction_id, value, client_ip,
+// method and uri fields, the response a JSON object like
+// {"match": true, "message": "score 97"}. When capturing, TX:0 contains
+// the message.
+//
+// Timeouts, errors and invalid verdicts don't match. After 5 consecutive
+// failures the authorizer is not called for 30 seconds.
+//
+// Calls are blocking and made once per evaluated value, a transaction makes
+// at most 10 calls across all the remoteAuth rules so it waits at most 10
+// times the timeout. The values evaluated once the budget is spent don't
+// match, rules should target few values, like REQUEST_HEADERS:Authorization
+// rather than ARGS.
+type remoteAuth struct {
+	url    string
+	client *http.Client
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+}
+
+var _ rules.Operator = (*remoteAuth)(nil)
+
+type remoteAuthRequest struct {
+	TransactionID string `json:"transaction_id"`
+	Value         string `json:"value"`
+	ClientIP      string `json:"client_ip"`
+	Method        string `json:"method"`
+	URI           string `json:"uri"`
+}
+
+type remoteAuthVerdict struct {
+	Match   *bool  `json:"match"`
+	Message string `json:"message"`
+}
+
+func newRemoteAuth(options rules.OperatorOptions) (rules.Operator, error) {
+	fields := strings.Fields(options.Arguments)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("invalid remoteAuth arguments %q, expected an URL and an optional timeout", options.Arguments)
+	}
+	u, err := url.Parse(fields[0])
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid remoteAuth URL %q", fields[0])
+	}
+	timeout := remoteAuthTimeout
+	if len(fields) == 2 {
+		if timeout, err = time.ParseDuration(fields[1]); err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid remoteAuth timeout %q", fields[1])
+		}
+	}
+	return &remoteAuth{
+		url:    u.String(),
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (o *remoteAuth) Evaluate(tx rules.TransactionState, value string) bool {
+	calls := tx.OperatorState(remoteAuthCallsKey{}, func() interface{} { return new(int) }).(*int)
+	if *calls >= remoteAuthMaxCalls {
+		tx.DebugLogger().Warn("remoteAuth budget of %d calls per transaction spent, skipping the call to %s", remoteAuthMaxCalls, o.url)
+		return false
+	}
+	if !o.allow() {
+		return false
+	}
+	*calls++
+	verdict, err := o.call(tx, value)
+	o.done(err)
+	if err != nil {
+		tx.DebugLogger().Error("remoteAuth call to %s failed: %s", o.url, err.Error())
+		return false
+	}
+	if *verdict.Match && tx.Capturing() {
+		tx.CaptureField(0, verdict.Message)
+	}
+	return *verdict.Match
+}
+
+func (o *remoteAuth) call(tx rules.TransactionState, value string) (*remoteAuthVerdict, error) {
+	v := tx.Variables()
+	body, err := json.Marshal(remoteAuthRequest{
+		TransactionID: tx.ID(),
+		Value:         value,
+		ClientIP:      v.RemoteAddr().String(),
+		Method:        v.RequestMethod().String(),
+		URI:           v.RequestURI().String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	res, err := o.client.Post(o.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	verdict := &remoteAuthVerdict{}
+	if err := json.NewDecoder(io.LimitReader(res.Body, remoteAuthMaxResponse)).Decode(verdict); err != nil {
+		return nil, err
+	}
+	if verdict.Match == nil {
+		return nil, errors.New("the verdict has no match field")
+	}
+	return verdict, nil
+}
+
+// allow returns false while the circuit breaker is open, a single call is
+// let through once the cooldown expired
+func (o *remoteAuth) allow() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.failures < remoteAuthMaxFailures {
+		return true
+	}
+	if time.Since(o.openedAt) < remoteAuthCooldown {
+		return false
+	}
+	// half open, the next failure opens it again
+	o.openedAt = time.Now()
+	return true
+}
+
+// done records the result of a call
+func (o *remoteAuth) done(err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err == nil {
+		o.failures = 0
+		return
+	}
+	o.failures++
+	if o.failures >= remoteAuthMaxFailures {
+		o.openedAt = time.Now()
+	}
+}
+
+func init() {
+	Register("remoteAuth", newRemoteAuth)
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !tinygo
+// +build !tinygo
+
+package operators
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+func TestRemoteAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req remoteAuthRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch req.Value {
+		case "fraud":
+			_, _ = w.Write([]byte(`{"match": true, "message": "score 97 for ` + req.ClientIP + `"}`))
+		case "slow":
+			time.Sleep(200 * time.Millisecond)
+			_, _ = w.Write([]byte(`{"match": true}`))
+		case "broken":
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			_, _ = w.Write([]byte(`{"match": false}`))
+		}
+	}))
+	defer srv.Close()
+
+	op, err := newRemoteAuth(rules.OperatorOptions{Arguments: srv.URL + " 50ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waf := corazawaf.NewWAF()
+	for _, tt := range []struct {
+		value string
+		want  bool
+	}{
+		{"fraud", true},
+		{"legit", false},
+		{"slow", false},
+		{"broken", false},
+	} {
+		tx := waf.NewTransaction()
+		tx.Capture = true
+		tx.ProcessConnection("10.0.0.1", 1234, "", 0)
+		if have := op.Evaluate(tx, tt.value); have != tt.want {
+			t.Errorf("unexpected result %t for %q", have, tt.value)
+		}
+		if tt.want {
+			if msg := tx.Variables().TX().Get("0"); len(msg) != 1 || msg[0] != "score 97 for 10.0.0.1" {
+				t.Errorf("unexpected captured message %v", msg)
+			}
+		}
+	}
+
+	for _, args := range []string{"", "ftp://example.com", "http://example.com 0s", "http://example.com 1s extra"} {
+		if _, err := newRemoteAuth(rules.OperatorOptions{Arguments: args}); err == nil {
+			t.Errorf("expected an error for %q", args)
+		}
+	}
+}
+
+func TestRemoteAuthCircuitBreaker(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	op, err := newRemoteAuth(rules.OperatorOptions{Arguments: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := corazawaf.NewWAF().NewTransaction()
+	for i := 0; i < remoteAuthMaxFailures+3; i++ {
+		if op.Evaluate(tx, "value") {
+			t.Fatal("expected failures not to match")
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != remoteAuthMaxFailures {
+		t.Errorf("expected the breaker to open after %d calls, got %d", remoteAuthMaxFailures, n)
+	}
+
+	// the cooldown expired, a single call is let through
+	ra := op.(*remoteAuth)
+	ra.openedAt = time.Now().Add(-remoteAuthCooldown)
+	op.Evaluate(tx, "value")
+	op.Evaluate(tx, "value")
+	if n := atomic.LoadInt32(&calls); n != remoteAuthMaxFailures+1 {
+		t.Errorf("expected a single half open call, got %d calls", n)
+	}
+}
+
+func TestRemoteAuthCallBudget(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		_, _ = w.Write([]byte(`{"match": true}`))
+	}))
+	defer srv.Close()
+
+	op, err := newRemoteAuth(rules.OperatorOptions{Arguments: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waf := corazawaf.NewWAF()
+	tx := waf.NewTransaction()
+	for i := 0; i < remoteAuthMaxCalls+5; i++ {
+		if have, want := op.Evaluate(tx, "value"), i < remoteAuthMaxCalls; have != want {
+			t.Errorf("unexpected result %t for call %d", have, i)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != remoteAuthMaxCalls {
+		t.Errorf("expected %d calls, got %d", remoteAuthMaxCalls, n)
+	}
+
+	// the budget is per transaction
+	if !op.Evaluate(waf.NewTransaction(), "value") {
+		t.Error("expected a new transaction to call the authorizer")
+	}
+}
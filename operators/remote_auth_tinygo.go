@@ -0,0 +1,24 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build tinygo && !coraza.disabled_operators.remoteAuth
+// +build tinygo,!coraza.disabled_operators.remoteAuth
+
+package operators
+
+import (
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+// remoteAuth never matches with TinyGo, like a failing authorizer
+type remoteAuth struct{}
+
+func newRemoteAuth(rules.OperatorOptions) (rules.Operator, error) {
+	return &remoteAuth{}, nil
+}
+
+func (*remoteAuth) Evaluate(rules.TransactionState, string) bool { return false }
+
+func init() {
+	Register("remoteAuth", newRemoteAuth)
+}
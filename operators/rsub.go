@@ -0,0 +1,94 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !coraza.disabled_operators.rsub
+
+package operators
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/macro"
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+// rsub substitutes the matches of a regular expression in the body
+// streams, the argument uses the s/regex/replacement/flags syntax. The
+// replacement can reference the groups with $1 and contain macros, the i
+// flag makes the expression case insensitive and / is escaped with \/.
+// The value is also substituted in STREAM_INPUT_BODY or STREAM_OUTPUT_BODY
+// if it is the current content of the stream, other values only match.
+type rsub struct {
+	re          *regexp.Regexp
+	replacement macro.Macro
+}
+
+var _ rules.Operator = (*rsub)(nil)
+
+var errRsubSyntax = errors.New("syntax error: @rsub s/regex/replacement/[i]")
+
+func newRsub(options rules.OperatorOptions) (rules.Operator, error) {
+	data := options.Arguments
+	if !strings.HasPrefix(data, "s/") {
+		return nil, errRsubSyntax
+	}
+	parts := splitRsub(data[2:])
+	if len(parts) != 3 || parts[0] == "" || strings.Trim(parts[2], "i") != "" {
+		return nil, errRsubSyntax
+	}
+	expr := parts[0]
+	if parts[2] != "" {
+		expr = "(?i)" + expr
+	}
+	re, err := memoize(options, "rsub:"+expr, func() (interface{}, error) { return regexp.Compile(expr) })
+	if err != nil {
+		return nil, err
+	}
+	replacement, err := macro.NewMacro(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return &rsub{re: re.(*regexp.Regexp), replacement: replacement}, nil
+}
+
+// splitRsub splits the expression, replacement and flags at the
+// unescaped slashes
+func splitRsub(s string) []string {
+	var parts []string
+	part := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == '/':
+			part.WriteByte('/')
+			i++
+		case s[i] == '/':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(s[i])
+		}
+	}
+	return append(parts, part.String())
+}
+
+func (o *rsub) Evaluate(tx rules.TransactionState, value string) bool {
+	if !o.re.MatchString(value) {
+		return false
+	}
+	v := tx.Variables()
+	for _, stream := range []interface {
+		String() string
+		Set(string)
+	}{v.StreamInputBody(), v.StreamOutputBody()} {
+		if s := stream.String(); s != "" && s == value {
+			stream.Set(o.re.ReplaceAllString(value, o.replacement.Expand(tx)))
+		}
+	}
+	return true
+}
+
+func init() {
+	Register("rsub", newRsub)
+}
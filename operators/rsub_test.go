@@ -0,0 +1,52 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package operators
+
+import (
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+func TestRsub(t *testing.T) {
+	tests := []struct {
+		arguments string
+		input     string
+		want      string
+	}{
+		{"s/secret/[redacted]/", "the secret is a secret", "the [redacted] is a [redacted]"},
+		{"s/SECRET/x/i", "a secret", "a x"},
+		{`s/(\d{4})-\d{4}/$1-xxxx/`, "card 1234-5678", "card 1234-xxxx"},
+		{`s/a\/b/c/`, "path a/b", "path c"},
+		{"s/^(.*)$/%{tx.word}/", "data", "replacement"},
+		{"s/missing/x/", "data", "data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arguments, func(t *testing.T) {
+			op, err := newRsub(rules.OperatorOptions{Arguments: tt.arguments})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tx := corazawaf.NewWAF().NewTransaction()
+			tx.Variables().TX().Set("word", []string{"replacement"})
+			tx.Variables().StreamOutputBody().Set(tt.input)
+			if res := op.Evaluate(tx, tt.input); res != (tt.want != tt.input) {
+				t.Errorf("unexpected result %t", res)
+			}
+			if have := tx.Variables().StreamOutputBody().String(); have != tt.want {
+				t.Errorf("want %q, have %q", tt.want, have)
+			}
+			if tx.Variables().StreamInputBody().String() != "" {
+				t.Error("unexpected STREAM_INPUT_BODY")
+			}
+		})
+	}
+
+	for _, arguments := range []string{"", "secret", "s/secret/", "s//x/", "s/a/b/g", "s/(/x/"} {
+		if _, err := newRsub(rules.OperatorOptions{Arguments: arguments}); err == nil {
+			t.Errorf("expected an error for %q", arguments)
+		}
+	}
+}
@@ -6,25 +6,44 @@
 package operators
 
 import (
-	"regexp"
-
+	"github.com/corazawaf/coraza/v3/regex"
 	"github.com/corazawaf/coraza/v3/rules"
 )
 
 type rx struct {
-	re *regexp.Regexp
+	re regex.Regexp
+	// literals contains the literals required by the expression, they
+	// are only extracted for the RE2 syntax of the default engine
+	literals []string
 }
 
-var _ rules.Operator = (*rx)(nil)
+var (
+	_ rules.Operator        = (*rx)(nil)
+	_ rules.LiteralOperator = (*rx)(nil)
+)
 
 func newRX(options rules.OperatorOptions) (rules.Operator, error) {
 	data := options.Arguments
 
-	re, err := regexp.Compile(data)
+	engine := options.RegexEngine
+	if engine == nil {
+		engine = regex.Default
+	}
+
+	re, err := memoize(options, "rx:"+engine.Name()+":"+data, func() (interface{}, error) { return engine.Compile(data) })
 	if err != nil {
 		return nil, err
 	}
-	return &rx{re: re}, nil
+	o := &rx{re: re.(regex.Regexp)}
+	if engine == regex.Default {
+		o.literals = requiredLiterals(data)
+	}
+	return o, nil
+}
+
+// Literals implements rules.LiteralOperator
+func (o *rx) Literals() []string {
+	return o.literals
 }
 
 func (o *rx) Evaluate(tx rules.TransactionState, value string) bool {
@@ -0,0 +1,112 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !coraza.disabled_operators.rx
+
+package operators
+
+import (
+	"regexp/syntax"
+	"unicode/utf8"
+)
+
+// maxRequiredLiterals bounds the literals of an expression, a larger set
+// of alternatives doesn't pre-qualify the values efficiently
+const maxRequiredLiterals = 32
+
+// requiredLiterals returns a set of lowercase literals such that every
+// match of the RE2 expression contains one of them, or nil if there is no
+// such set
+func requiredLiterals(expr string) []string {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	return literals(re.Simplify())
+}
+
+func literals(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		lit := string(re.Rune)
+		if re.Flags&syntax.FoldCase != 0 {
+			// the literals are matched ignoring the ASCII case only, the
+			// longest part without other case foldings is required
+			lit = longestASCIIFold(re.Rune)
+		}
+		if lit == "" {
+			return nil
+		}
+		return []string{asciiLower(lit)}
+	case syntax.OpCapture, syntax.OpPlus:
+		return literals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min >= 1 {
+			return literals(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		// any of the subexpressions with literals is required, the one
+		// with the longest literals is the most selective
+		var best []string
+		for _, sub := range re.Sub {
+			if l := literals(sub); l != nil && (best == nil || shortest(l) > shortest(best)) {
+				best = l
+			}
+		}
+		return best
+	case syntax.OpAlternate:
+		var all []string
+		for _, sub := range re.Sub {
+			l := literals(sub)
+			if l == nil || len(all)+len(l) > maxRequiredLiterals {
+				return nil
+			}
+			all = append(all, l...)
+		}
+		return all
+	}
+	return nil
+}
+
+// longestASCIIFold returns the longest part of the runes whose case
+// folding is the ASCII one: k and s also match the Kelvin sign and the
+// long s, and the non ASCII letters have their own foldings
+func longestASCIIFold(runes []rune) string {
+	best, start := "", 0
+	for i := 0; i <= len(runes); i++ {
+		if i < len(runes) {
+			switch r := runes[i]; {
+			case r >= utf8.RuneSelf, r == 'k', r == 'K', r == 's', r == 'S':
+			default:
+				continue
+			}
+		}
+		if i-start > len(best) {
+			best = string(runes[start:i])
+		}
+		start = i + 1
+	}
+	return best
+}
+
+// asciiLower lowercases the ASCII letters only, like the matching of the
+// literals
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+func shortest(literals []string) int {
+	n := -1
+	for _, l := range literals {
+		if n < 0 || len(l) < n {
+			n = len(l)
+		}
+	}
+	return n
+}
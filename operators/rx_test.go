@@ -5,6 +5,7 @@ package operators
 
 import (
 	"fmt"
+	"reflect"
 	"regexp"
 	"testing"
 
@@ -71,6 +72,34 @@ func TestRx(t *testing.T) {
 	}
 }
 
+func TestRxLiterals(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{pattern: "som(.*)ta", want: []string{"som"}},
+		{pattern: "Attack", want: []string{"attack"}},
+		{pattern: "(?i)<script", want: []string{"cript"}},
+		{pattern: "(?i)union\\s+all", want: []string{"union"}},
+		{pattern: "foo|bar", want: []string{"foo", "bar"}},
+		{pattern: "(?:eval|exec)\\(", want: []string{"val", "xec"}},
+		{pattern: "ハロー", want: []string{"ハロー"}},
+		{pattern: "(?i)ハロー", want: nil},
+		{pattern: "(?i)sks", want: nil},
+		{pattern: "a?b*", want: nil},
+		{pattern: "foo|\\d+", want: nil},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.pattern, func(t *testing.T) {
+			if got := requiredLiterals(tt.pattern); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
 func BenchmarkRxSubstringVsMatch(b *testing.B) {
 	str := "hello world; heelloo Woorld; hello; heeeelloooo wooooooorld;hello world; heelloo Woorld; hello; heeeelloooo wooooooorld;hello world; heelloo Woorld; hello; heeeelloooo wooooooorld;hello world; heelloo Woorld; hello; heeeelloooo wooooooorld;hello world; heelloo Woorld; hello; heeeelloooo wooooooorld;hello world; heelloo Woorld; hello; heeeelloooo wooooooorld;hello world; heelloo Woorld; hello; heeeelloooo wooooooorld;"
 	rx := regexp.MustCompile(`((h.*e.*l.*l.*o.*)|\d+)`)
@@ -13,53 +13,100 @@ import (
 	"github.com/corazawaf/coraza/v3/rules"
 )
 
+// validateByteRange matches if any byte of the input is outside the
+// allowed ranges. Ranges are separated by commas and may be excluded
+// with a leading exclamation mark, for example "1-255,!37,!60-62".
+// The "raw:" prefix evaluates the value before transformations.
+// When capturing, TX:0 contains the offset of the first invalid byte
+// and TX:1 its value.
 type validateByteRange struct {
 	validBytes [256]bool // array, not slice, so don't pass as-is to functions
+	raw        bool
 }
 
-var _ rules.Operator = (*validateByteRange)(nil)
+var (
+	_ rules.Operator         = (*validateByteRange)(nil)
+	_ rules.RawInputOperator = (*validateByteRange)(nil)
+)
 
 func newValidateByteRange(options rules.OperatorOptions) (rules.Operator, error) {
 	data := options.Arguments
 
+	raw := strings.HasPrefix(data, "raw:")
+	if raw {
+		data = data[len("raw:"):]
+	}
+
 	if data == "" {
 		return &unconditionalMatch{}, nil
 	}
 
-	var validBytes [256]bool
+	type byteRange struct {
+		start, end int
+		exclude    bool
+	}
+	var (
+		ranges     []byteRange
+		onlyExcl   = true
+		validBytes [256]bool
+	)
 	for _, br := range strings.Split(data, ",") {
 		br = strings.TrimSpace(br)
-		start, end, ok := strings.Cut(br, "-")
-
-		if !ok {
-			if b, err := strconv.Atoi(start); err != nil {
-				return nil, err
-			} else if err := validateByte(b); err != nil {
-				return nil, err
-			} else {
-				validBytes[b] = true
-			}
-			continue
+		exclude := strings.HasPrefix(br, "!")
+		if exclude {
+			br = br[1:]
 		}
-		s, err := strconv.Atoi(start)
+		s, e, err := parseByteRange(br)
 		if err != nil {
 			return nil, err
 		}
-		if err := validateByte(s); err != nil {
-			return nil, err
-		}
-		e, err := strconv.Atoi(end)
-		if err != nil {
-			return nil, err
-		}
-		if err := validateByte(e); err != nil {
-			return nil, err
-		}
-		for i := s; i <= e; i++ {
+		onlyExcl = onlyExcl && exclude
+		ranges = append(ranges, byteRange{s, e, exclude})
+	}
+	if onlyExcl {
+		// only exclusions were provided, so every other byte is valid
+		for i := range validBytes {
 			validBytes[i] = true
 		}
 	}
-	return &validateByteRange{validBytes: validBytes}, nil
+	// exclusions win over ranges regardless of their position
+	for _, exclude := range []bool{false, true} {
+		for _, r := range ranges {
+			if r.exclude != exclude {
+				continue
+			}
+			for i := r.start; i <= r.end; i++ {
+				validBytes[i] = !exclude
+			}
+		}
+	}
+	return &validateByteRange{validBytes: validBytes, raw: raw}, nil
+}
+
+// parseByteRange parses a single byte like "10" or a range like "32-126"
+func parseByteRange(br string) (int, int, error) {
+	start, end, ok := strings.Cut(br, "-")
+	s, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := validateByte(s); err != nil {
+		return 0, 0, err
+	}
+	if !ok {
+		return s, s, nil
+	}
+	e, err := strconv.Atoi(end)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := validateByte(e); err != nil {
+		return 0, 0, err
+	}
+	if e < s {
+		return 0, 0, fmt.Errorf("invalid byte range %q", br)
+	}
+	return s, e, nil
 }
 
 func validateByte(b int) error {
@@ -78,12 +125,20 @@ func (o *validateByteRange) Evaluate(tx rules.TransactionState, data string) boo
 	for i := 0; i < len(data); i++ {
 		c := data[i]
 		if !o.validBytes[c] {
+			if tx != nil && tx.Capturing() {
+				tx.CaptureField(0, strconv.Itoa(i))
+				tx.CaptureField(1, strconv.Itoa(int(c)))
+			}
 			return true
 		}
 	}
 	return false
 }
 
+func (o *validateByteRange) RawInput() bool {
+	return o.raw
+}
+
 func init() {
 	Register("validateByteRange", newValidateByteRange)
 }
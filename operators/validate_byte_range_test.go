@@ -58,3 +58,50 @@ func BenchmarkValidateByteRange(b *testing.B) {
 		op.Evaluate(nil, "/\ufffdindex.html?test=test1")
 	}
 }
+
+func TestValidateByteRangeExclusions(t *testing.T) {
+	tests := []struct {
+		ranges string
+		input  string
+		match  bool
+	}{
+		{"32-126,!60-62", "hello world", false},
+		{"32-126,!60-62", "<script>", true},
+		{"!60-62,32-126", "<script>", true},
+		{"!0", "abc", false},
+		{"!0", "a\x00c", true},
+	}
+	for _, tt := range tests {
+		op, err := newValidateByteRange(rules.OperatorOptions{Arguments: tt.ranges})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := op.Evaluate(nil, tt.input); m != tt.match {
+			t.Errorf("ranges %q against %q: expected %t, got %t", tt.ranges, tt.input, tt.match, m)
+		}
+	}
+	if _, err := newValidateByteRange(rules.OperatorOptions{Arguments: "20-10"}); err == nil {
+		t.Error("expected error for inverted range")
+	}
+}
+
+func TestValidateByteRangeCapturesOffset(t *testing.T) {
+	op, err := newValidateByteRange(rules.OperatorOptions{Arguments: "raw:32-126"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ro, ok := op.(rules.RawInputOperator); !ok || !ro.RawInput() {
+		t.Error("expected raw input operator")
+	}
+	tx := getTransaction()
+	tx.Capture = true
+	if !op.Evaluate(tx, "abc\x01d") {
+		t.Fatal("expected match")
+	}
+	if v := tx.Variables().TX().Get("0"); len(v) == 0 || v[0] != "3" {
+		t.Errorf("expected offset 3, got %v", v)
+	}
+	if v := tx.Variables().TX().Get("1"); len(v) == 0 || v[0] != "1" {
+		t.Errorf("expected byte 1, got %v", v)
+	}
+}
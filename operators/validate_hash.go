@@ -0,0 +1,43 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !coraza.disabled_operators.validateHash
+
+package operators
+
+import (
+	"regexp"
+
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+// validateHash matches when the input matches the regular expression and
+// the request does not carry a valid signature generated by the hash engine.
+// It must be used with REQUEST_URI or similar variables containing the query.
+type validateHash struct {
+	re *regexp.Regexp
+}
+
+var _ rules.Operator = (*validateHash)(nil)
+
+func newValidateHash(options rules.OperatorOptions) (rules.Operator, error) {
+	re, err := regexp.Compile(options.Arguments)
+	if err != nil {
+		return nil, err
+	}
+	return &validateHash{re: re}, nil
+}
+
+func (o *validateHash) Evaluate(tx rules.TransactionState, value string) bool {
+	if !o.re.MatchString(value) {
+		return false
+	}
+	if !tx.HashEnforced() {
+		return false
+	}
+	return !tx.ValidateHash(value)
+}
+
+func init() {
+	Register("validateHash", newValidateHash)
+}
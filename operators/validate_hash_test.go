@@ -0,0 +1,38 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package operators
+
+import (
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+func TestValidateHash(t *testing.T) {
+	op, err := newValidateHash(rules.OperatorOptions{Arguments: "product"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waf := corazawaf.NewWAF()
+	waf.HashEngine = true
+	waf.HashKey = []byte("secret")
+	tx := waf.NewTransaction()
+	signed := tx.SignLink("/product?id=1")
+
+	if op.Evaluate(tx, signed) {
+		t.Errorf("unexpected match for the signed link %q", signed)
+	}
+	if !op.Evaluate(tx, "/product?id=1") {
+		t.Error("expected match for the unsigned link")
+	}
+	if op.Evaluate(tx, "/other") {
+		t.Error("unexpected match for a link not matching the expression")
+	}
+
+	tx.HashEnforcement = false
+	if op.Evaluate(tx, "/product?id=1") {
+		t.Error("unexpected match without enforcement")
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !coraza.disabled_operators.validateSchema
+
+package operators
+
+import (
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/internal/jsonschema"
+	"github.com/corazawaf/coraza/v3/internal/xsd"
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+// validateSchema matches if the input, usually REQUEST_BODY, is not valid
+// for the JSON Schema or XML Schema file in the argument. Files ending
+// with .xsd or starting with < are XML Schemas, otherwise JSON Schemas.
+// Empty inputs are not validated.
+// When capturing, TX:0 contains the path of the first violation, like
+// $.items[2].name or /order/item[2]/@quantity, and TX:1 its description.
+type validateSchema struct {
+	schema schemaValidator
+}
+
+// schemaValidator is implemented by the compiled JSON and XML Schemas
+type schemaValidator interface {
+	Validate(data []byte) error
+}
+
+var _ rules.Operator = (*validateSchema)(nil)
+
+func newValidateSchema(options rules.OperatorOptions) (rules.Operator, error) {
+	data, err := loadFromFile(options.Arguments, options.Path, options.Root)
+	if err != nil {
+		return nil, err
+	}
+	isXSD := strings.EqualFold(path.Ext(options.Arguments), ".xsd") ||
+		strings.HasPrefix(strings.TrimSpace(string(data)), "<")
+	// the schemas are compiled once no matter how many rules use them
+	key := "validateSchema:json:"
+	if isXSD {
+		key = "validateSchema:xsd:"
+	}
+	schema, err := memoize(options, key+string(data), func() (interface{}, error) {
+		if isXSD {
+			return xsd.Compile(data)
+		}
+		return jsonschema.Compile(data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &validateSchema{schema: schema.(schemaValidator)}, nil
+}
+
+func (o *validateSchema) Evaluate(tx rules.TransactionState, value string) bool {
+	if value == "" {
+		return false
+	}
+	err := o.schema.Validate([]byte(value))
+	if err == nil {
+		return false
+	}
+	if tx.Capturing() {
+		var jsonErr *jsonschema.ValidationError
+		var xsdErr *xsd.ValidationError
+		switch {
+		case errors.As(err, &jsonErr):
+			tx.CaptureField(0, jsonErr.Path)
+			tx.CaptureField(1, jsonErr.Message)
+		case errors.As(err, &xsdErr):
+			tx.CaptureField(0, xsdErr.Path)
+			tx.CaptureField(1, xsdErr.Message)
+		}
+	}
+	return true
+}
+
+func init() {
+	Register("validateSchema", newValidateSchema)
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package operators
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/internal/io"
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+func TestValidateSchema(t *testing.T) {
+	tests := []struct {
+		schema string
+		input  string
+		path   string
+	}{
+		{"order.schema", `{"id": 1, "items": [{"sku": "ABC-1234", "quantity": 2}]}`, ""},
+		{"order.schema", `{"id": 1, "items": [{"sku": "ABC-1234", "quantity": 2}, {"sku": "abc", "quantity": 1}]}`, "$.items[1].sku"},
+		{"order.schema", `{"id": 1, "items": [], "admin": true}`, "$.admin"},
+		{"order.schema", `{"items": []}`, "$"},
+		{"order.schema", `{"id": 1,`, "$"},
+		{"order.schema", "", ""},
+		{"order.xsd", `<order id="1"><item quantity="2"><sku>ABC-1234</sku></item></order>`, ""},
+		{"order.xsd", `<order id="1"><item quantity="2"><sku>ABC-1234</sku></item><item quantity="x"><sku>ABC-1234</sku></item></order>`, "/order/item[2]/@quantity"},
+		{"order.xsd", `<order id="1"><item quantity="2"><sku>ABC-1234</sku><price/></item></order>`, "/order/item/price"},
+		{"order.xsd", `<order id="1"></order>`, "/order"},
+		{"order.xsd", `<order id="1">`, "/"},
+	}
+	waf := corazawaf.NewWAF()
+	for _, tt := range tests {
+		t.Run(tt.schema+" "+tt.input, func(t *testing.T) {
+			op, err := newValidateSchema(rules.OperatorOptions{
+				Arguments: filepath.Join("testdata", "op", tt.schema),
+				Path:      []string{"."},
+				Root:      io.OSFS{},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tx := waf.NewTransaction()
+			tx.Capture = true
+			if res := op.Evaluate(tx, tt.input); res != (tt.path != "") {
+				t.Fatalf("unexpected result %t", res)
+			}
+			if tt.path == "" {
+				return
+			}
+			if have := tx.Variables().TX().Get("0"); len(have) != 1 || have[0] != tt.path {
+				t.Errorf("want violation path %q, have %v", tt.path, have)
+			}
+			if have := tx.Variables().TX().Get("1"); len(have) != 1 || have[0] == "" {
+				t.Error("expected the violation message to be captured")
+			}
+		})
+	}
+
+	if _, err := newValidateSchema(rules.OperatorOptions{
+		Arguments: filepath.Join("testdata", "op", "netranges.dat"),
+		Path:      []string{"."},
+		Root:      io.OSFS{},
+	}); err == nil {
+		t.Error("expected an error for an invalid schema")
+	}
+}
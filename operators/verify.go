@@ -0,0 +1,109 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package operators
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+// verifyDigits is the base of the data leakage operators, the argument
+// is a regular expression matching the candidates and fn validates them
+// ignoring any non digit character. The valid candidates are captured
+// with all the digits masked but the last four, so they can be logged.
+type verifyDigits struct {
+	re *regexp.Regexp
+	fn func(digits string) bool
+}
+
+var _ rules.Operator = (*verifyDigits)(nil)
+
+func newVerifyDigits(options rules.OperatorOptions, fn func(digits string) bool) (rules.Operator, error) {
+	expr := options.Arguments
+	re, err := memoize(options, "verify:"+expr, func() (interface{}, error) { return regexp.Compile(expr) })
+	if err != nil {
+		return nil, err
+	}
+	return &verifyDigits{re: re.(*regexp.Regexp), fn: fn}, nil
+}
+
+func (o *verifyDigits) Evaluate(tx rules.TransactionState, value string) bool {
+	matches := o.re.FindAllString(value, 10)
+	res := false
+	for _, m := range matches {
+		if !o.fn(onlyDigits(m)) {
+			continue
+		}
+		if !res && tx.Capturing() {
+			tx.CaptureField(0, maskDigits(m))
+		}
+		res = true
+	}
+	return res
+}
+
+// onlyDigits removes the non digit characters of s
+func onlyDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < '0' || r > '9' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// maskDigits replaces all the digits of s with * but the last four
+func maskDigits(s string) string {
+	visible := 4
+	b := []byte(s)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < '0' || b[i] > '9' {
+			continue
+		}
+		if visible > 0 {
+			visible--
+			continue
+		}
+		b[i] = '*'
+	}
+	return string(b)
+}
+
+var nonDigit = regexp.MustCompile(`[^\d]`)
+
+func nidUs(nid string) bool {
+	nid = nonDigit.ReplaceAllString(nid, "")
+	if len(nid) < 9 {
+		return false
+	}
+	area, _ := strconv.Atoi(nid[0:3])
+	group, _ := strconv.Atoi(nid[3:5])
+	serial, _ := strconv.Atoi(nid[5:9])
+	if area == 0 || group == 0 || serial == 0 || area >= 740 || area == 666 {
+		return false
+	}
+
+	sequence := true
+	equals := true
+	prev := digitToInt(nid[0])
+	for i := 1; i < len(nid); i++ {
+		curr := digitToInt(nid[i])
+		if prev != curr {
+			equals = false
+		}
+		if curr != prev+1 {
+			sequence = false
+		}
+		prev = curr
+	}
+
+	return !(sequence || equals)
+}
+
+func digitToInt(d byte) int {
+	return int(d - '0')
+}
@@ -0,0 +1,41 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !coraza.disabled_operators.verifyCC
+
+package operators
+
+import (
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+// newVerifyCC returns an operator matching the credit card numbers found
+// by the regular expression that pass the Luhn check
+func newVerifyCC(options rules.OperatorOptions) (rules.Operator, error) {
+	return newVerifyDigits(options, luhn)
+}
+
+// luhn validates the check digit of card numbers between 13 and 19 digits
+func luhn(digits string) bool {
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digitToInt(digits[i])
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func init() {
+	Register("verifyCC", newVerifyCC)
+}
@@ -0,0 +1,43 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !coraza.disabled_operators.verifyCPF
+
+package operators
+
+import (
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+// newVerifyCPF returns an operator matching the Brazilian CPF numbers
+// found by the regular expression with valid check digits
+func newVerifyCPF(options rules.OperatorOptions) (rules.Operator, error) {
+	return newVerifyDigits(options, cpf)
+}
+
+func cpf(digits string) bool {
+	if len(digits) != 11 || digits == strings.Repeat(digits[:1], 11) {
+		return false
+	}
+	// the check digits are computed over the 9 and 10 leading digits
+	for n := 9; n <= 10; n++ {
+		sum := 0
+		for i := 0; i < n; i++ {
+			sum += digitToInt(digits[i]) * (n + 1 - i)
+		}
+		dv := sum * 10 % 11
+		if dv == 10 {
+			dv = 0
+		}
+		if dv != digitToInt(digits[n]) {
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	Register("verifyCPF", newVerifyCPF)
+}
@@ -0,0 +1,23 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !coraza.disabled_operators.verifySSN
+
+package operators
+
+import (
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+// newVerifySSN returns an operator matching the US social security
+// numbers found by the regular expression that have a valid area, group
+// and serial number
+func newVerifySSN(options rules.OperatorOptions) (rules.Operator, error) {
+	return newVerifyDigits(options, func(digits string) bool {
+		return len(digits) == 9 && nidUs(digits)
+	})
+}
+
+func init() {
+	Register("verifySSN", newVerifySSN)
+}
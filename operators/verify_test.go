@@ -0,0 +1,62 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package operators
+
+import (
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+func TestVerifyDigits(t *testing.T) {
+	const (
+		ccExpr  = `(?:^|[^\d])(\d{4}\-?\d{4}\-?\d{2}\-?\d{2}\-?\d{1,4})(?:[^\d]|$)`
+		ssnExpr = `\d{3}-?\d{2}-?\d{4}`
+		cpfExpr = `([0-9]{3}\.){2}[0-9]{3}-[0-9]{2}`
+	)
+	tests := []struct {
+		name    string
+		expr    string
+		input   string
+		capture string
+	}{
+		{"verifyCC", ccExpr, "5484605089158216", "************8216"},
+		{"verifyCC", ccExpr, "card: 5484-6050-8915-8216.", " ****-****-****-8216."},
+		{"verifyCC", ccExpr, "4556324125126", "*********5126"},
+		{"verifyCC", ccExpr, "5484605089158217", ""},
+		{"verifyCC", ccExpr, "5484 6050 8915 8216", ""},
+		{"verifyCC", ccExpr, "15484605089158216", ""},
+		{"verifyCC", `\d+`, "0000000000", ""},
+		{"verifySSN", ssnExpr, "asdf 574-57-8065 asdf", "***-**-8065"},
+		{"verifySSN", ssnExpr, "asdf 800-57-8065 asdf", ""},
+		{"verifySSN", ssnExpr, "asdf 123-45-6789 asdf", ""},
+		{"verifySSN", ssnExpr, "asdf 666-45-6788 asdf", ""},
+		{"verifyCPF", cpfExpr, "asdf 010.817.514-60 asdf", "***.***.*14-60"},
+		{"verifyCPF", cpfExpr, "asdf 010.817.514-61 asdf", ""},
+		{"verifyCPF", cpfExpr, "asdf 111.111.111-11 asdf", ""},
+		{"verifyCPF", cpfExpr, "asdf 010.817 asdf", ""},
+	}
+	waf := corazawaf.NewWAF()
+	for _, tt := range tests {
+		t.Run(tt.name+" "+tt.input, func(t *testing.T) {
+			op, err := Get(tt.name, rules.OperatorOptions{Arguments: tt.expr})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tx := waf.NewTransaction()
+			tx.Capture = true
+			if res := op.Evaluate(tx, tt.input); res != (tt.capture != "") {
+				t.Fatalf("unexpected result %t", res)
+			}
+			if have := tx.Variables().TX().Get("0"); tt.capture != "" && (len(have) != 1 || have[0] != tt.capture) {
+				t.Errorf("want masked capture %q, have %v", tt.capture, have)
+			}
+		})
+	}
+
+	if _, err := newVerifyCC(rules.OperatorOptions{Arguments: "("}); err == nil {
+		t.Error("expected an error for an invalid expression")
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package coraza
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/corazawaf/coraza/v3/loggers"
+)
+
+// Option configures a WAF created with NewWAFWithOptions, the options are
+// applied in order and the invalid ones fail the creation of the WAF.
+type Option func(c *wafConfig) error
+
+// NewWAFWithOptions creates a new WAF instance configured by the options:
+//
+//	waf, err := coraza.NewWAFWithOptions(
+//		coraza.WithRootFS(coreruleset.FS),
+//		coraza.WithDirectives("Include @coraza.conf-recommended"),
+//		coraza.WithRequestBodyLimit(1<<20),
+//	)
+//
+// The limits set by the options override the directives. The resulting
+// configuration is validated, inconsistent limits like an in-memory limit
+// above the request body limit are rejected.
+func NewWAFWithOptions(opts ...Option) (WAF, error) {
+	c := &wafConfig{}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, fmt.Errorf("invalid WAF option: %w", err)
+		}
+	}
+	return NewWAF(c)
+}
+
+// WithConfig starts from a WAFConfig, for the settings without option. It
+// replaces the options applied before it.
+func WithConfig(config WAFConfig) Option {
+	return func(c *wafConfig) error {
+		wc, ok := config.(*wafConfig)
+		if !ok || wc == nil {
+			return errors.New("unsupported WAF config")
+		}
+		*c = *wc.clone()
+		return nil
+	}
+}
+
+// WithDirectives parses the directives from the given string and adds them
+// to the WAF.
+func WithDirectives(directives string) Option {
+	return func(c *wafConfig) error {
+		c.rules = append(c.rules, wafRule{str: directives})
+		return nil
+	}
+}
+
+// WithDirectivesFromFile parses the directives from the given file and
+// adds them to the WAF.
+func WithDirectivesFromFile(path string) Option {
+	return func(c *wafConfig) error {
+		if path == "" {
+			return errors.New("empty directives file path")
+		}
+		c.rules = append(c.rules, wafRule{file: path})
+		return nil
+	}
+}
+
+// WithRootFS configures the root file system of the directives files.
+func WithRootFS(root fs.FS) Option {
+	return func(c *wafConfig) error {
+		if root == nil {
+			return errors.New("nil root file system")
+		}
+		c.fsRoot = root
+		return nil
+	}
+}
+
+// WithDebugLogger configures a debug logger.
+func WithDebugLogger(logger loggers.DebugLogger) Option {
+	return func(c *wafConfig) error {
+		if logger == nil {
+			return errors.New("nil debug logger")
+		}
+		c.debugLogger = logger
+		return nil
+	}
+}
+
+// WithRequestBodyLimit enables the access to the request body and sets its
+// limit in bytes. The default in-memory limit is lowered to the limit if
+// it is above it.
+func WithRequestBodyLimit(limit int64) Option {
+	return func(c *wafConfig) error {
+		if limit <= 0 {
+			return fmt.Errorf("request body limit should be bigger than 0, got %d", limit)
+		}
+		c.requestBodyLimit = limit
+		return nil
+	}
+}
+
+// WithRequestBodyInMemoryLimit sets the number of bytes of the request
+// body kept in memory, the rest is buffered to disk. It can't exceed the
+// request body limit.
+func WithRequestBodyInMemoryLimit(limit int64) Option {
+	return func(c *wafConfig) error {
+		if limit <= 0 {
+			return fmt.Errorf("request body in-memory limit should be bigger than 0, got %d", limit)
+		}
+		c.requestBodyInMemoryLimit = limit
+		return nil
+	}
+}
+
+// WithResponseBodyLimit enables the access to the response body and sets
+// its limit in bytes.
+func WithResponseBodyLimit(limit int64) Option {
+	return func(c *wafConfig) error {
+		if limit <= 0 {
+			return fmt.Errorf("response body limit should be bigger than 0, got %d", limit)
+		}
+		c.responseBodyLimit = limit
+		return nil
+	}
+}
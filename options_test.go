@@ -0,0 +1,85 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package coraza
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestNewWAFWithOptions(t *testing.T) {
+	root := fstest.MapFS{
+		"rules.conf": &fstest.MapFile{Data: []byte(`SecRule REQUEST_URI "@streq /blocked" "id:1,phase:1,deny,status:403"`)},
+	}
+	waf, err := NewWAFWithOptions(
+		WithRootFS(root),
+		WithDirectives("SecRuleEngine On\nSecResponseBodyLimit 1024"),
+		WithDirectivesFromFile("rules.conf"),
+		WithRequestBodyLimit(1000),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := waf.(wafWrapper).waf
+	if !w.RequestBodyAccess || w.RequestBodyLimit != 1000 {
+		t.Errorf("unexpected request body access %t with limit %d", w.RequestBodyAccess, w.RequestBodyLimit)
+	}
+	// the default in-memory limit follows the smaller body limit
+	if w.RequestBodyInMemoryLimit != 1000 {
+		t.Errorf("unexpected in-memory limit %d", w.RequestBodyInMemoryLimit)
+	}
+	if w.ResponseBodyLimit != 1024 {
+		t.Errorf("unexpected response body limit %d", w.ResponseBodyLimit)
+	}
+	tx := waf.NewTransaction()
+	defer tx.Close()
+	tx.ProcessURI("/blocked", "GET", "HTTP/1.1")
+	if it := tx.ProcessRequestHeaders(); it == nil {
+		t.Error("expected the rule of the file to interrupt the transaction")
+	}
+}
+
+func TestNewWAFWithOptionsConfig(t *testing.T) {
+	waf, err := NewWAFWithOptions(
+		WithConfig(NewWAFConfig().WithDirectives("SecRuleEngine DetectionOnly")),
+		WithResponseBodyLimit(2048),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := waf.(wafWrapper).waf
+	if w.RuleEngine.String() != "DetectionOnly" || !w.ResponseBodyAccess || w.ResponseBodyLimit != 2048 {
+		t.Errorf("unexpected configuration %s, %t, %d", w.RuleEngine, w.ResponseBodyAccess, w.ResponseBodyLimit)
+	}
+}
+
+func TestNewWAFWithOptionsValidation(t *testing.T) {
+	tests := map[string][]Option{
+		"negative body limit":       {WithRequestBodyLimit(-1)},
+		"zero response limit":       {WithResponseBodyLimit(0)},
+		"nil root":                  {WithRootFS(nil)},
+		"nil logger":                {WithDebugLogger(nil)},
+		"in-memory above the limit": {WithRequestBodyLimit(1000), WithRequestBodyInMemoryLimit(2000)},
+		"inconsistent directives":   {WithDirectives("SecRequestBodyLimit 1000\nSecRequestBodyInMemoryLimit 2000")},
+		"nil config":                {WithConfig(nil)},
+	}
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewWAFWithOptions(opts...); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestNewWAFDefaultInMemoryLimit(t *testing.T) {
+	waf, err := NewWAF(NewWAFConfig().WithDirectives("SecRequestBodyAccess On\nSecRequestBodyLimit 65536"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the default in-memory limit follows the smaller body limit
+	if l := waf.(wafWrapper).waf.RequestBodyInMemoryLimit; l != 65536 {
+		t.Errorf("unexpected in-memory limit %d", l)
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package coraza
+
+import "github.com/corazawaf/coraza/v3/internal/memoize"
+
+// PatternCacheStats describes the cache of compiled patterns. Operators
+// like @rx and @pm with the same arguments share a single compiled
+// pattern across rules and WAF instances of the process.
+type PatternCacheStats struct {
+	// Entries is the number of compiled patterns
+	Entries int
+	// Hits is the number of rules reusing an already compiled pattern
+	Hits uint64
+	// Misses is the number of patterns compiled
+	Misses uint64
+}
+
+// GetPatternCacheStats returns the current stats of the pattern cache
+func GetPatternCacheStats() PatternCacheStats {
+	entries, hits, misses := memoize.Stats()
+	return PatternCacheStats{
+		Entries: entries,
+		Hits:    hits,
+		Misses:  misses,
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package coraza
+
+import "testing"
+
+func TestPatternCacheSharedAcrossRules(t *testing.T) {
+	before := GetPatternCacheStats()
+	// the pattern is unique to this test so it is compiled once and then
+	// reused by the second rule and the second WAF
+	directives := `
+SecRule ARGS "@rx pattern-cache-test-[0-9]+" "id:1,phase:1,log"
+SecRule REQUEST_URI "@rx pattern-cache-test-[0-9]+" "id:2,phase:1,log"
+`
+	var wafs []WAF
+	for i := 0; i < 2; i++ {
+		waf, err := NewWAF(NewWAFConfig().WithDirectives(directives))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wafs = append(wafs, waf)
+	}
+	after := GetPatternCacheStats()
+	if n := after.Misses - before.Misses; n != 1 {
+		t.Errorf("expected pattern to be compiled once, got %d", n)
+	}
+	if n := after.Hits - before.Hits; n != 3 {
+		t.Errorf("expected pattern to be reused 3 times, got %d", n)
+	}
+	if after.Entries != before.Entries+1 {
+		t.Errorf("expected a single new entry, got %d", after.Entries-before.Entries)
+	}
+
+	// the pattern is evicted once no WAF uses it
+	for _, waf := range wafs {
+		if err := waf.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := GetPatternCacheStats().Entries; n != before.Entries {
+		t.Errorf("expected the pattern to be evicted, got %d new entries", n-before.Entries)
+	}
+}
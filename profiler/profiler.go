@@ -0,0 +1,422 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package profiler learns the arguments of every endpoint of an
+// application and reports the requests deviating from them:
+//
+//	p := profiler.New()
+//	waf, _ := coraza.NewWAF(coraza.NewWAFConfig().WithProfile(p, profiler.Learn))
+//	// once enough traffic was seen
+//	data, _ := p.Export()
+//
+// Endpoints are identified by the method and the path template, where
+// the numeric, UUID and long hexadecimal path segments are replaced by
+// placeholders. For every query and body argument the profile records how
+// often it is sent, its type and, booleans excepted, its length range. In
+// Enforce mode the deviations are exposed to the rules with the
+// PROFILE_VIOLATION variable.
+package profiler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Mode selects whether the requests are learned or checked
+type Mode int
+
+const (
+	// Learn records the arguments of the requests not interrupted by the
+	// WAF
+	Learn Mode = iota
+	// Enforce checks the requests against the profile
+	Enforce
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Learn:
+		return "learn"
+	case Enforce:
+		return "enforce"
+	}
+	return "unknown"
+}
+
+// Kinds of Violation
+const (
+	UnknownEndpoint  = "unknown_endpoint"
+	UnknownParameter = "unknown_parameter"
+	MissingParameter = "missing_parameter"
+	TypeMismatch     = "type_mismatch"
+	LengthOutOfRange = "length_out_of_range"
+)
+
+// Types of the learned arguments, an argument seen with several types
+// gets the most generic one
+const (
+	TypeBoolean = "boolean"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeString  = "string"
+)
+
+const (
+	// DefaultMinSamples is the number of requests learned for an endpoint
+	// before it is enforced
+	DefaultMinSamples = 10
+	// maxEndpoints and maxParameters bound the memory used while learning
+	// from traffic with random paths or argument names
+	maxEndpoints  = 1000
+	maxParameters = 100
+)
+
+// Violation is a part of the request deviating from the profile
+type Violation struct {
+	// Kind is one of the violation constants, like UnknownParameter
+	Kind string
+	// Location is the deviating part of the request, like query.id or
+	// body.comment
+	Location string
+	Message  string
+}
+
+// Request contains the parts of a request that are learned and checked
+type Request struct {
+	Method string
+	// Path is the decoded path, without query string
+	Path  string
+	Query map[string][]string
+	Body  map[string][]string
+}
+
+// Parameter contains the learned properties of an argument
+type Parameter struct {
+	// Seen is the number of requests sending the argument
+	Seen int `json:"seen"`
+	// Values is the number of values, an argument can be repeated
+	Values     int     `json:"values"`
+	Type       string  `json:"type"`
+	MinLength  int     `json:"min_length"`
+	MaxLength  int     `json:"max_length"`
+	MeanLength float64 `json:"mean_length"`
+}
+
+// Endpoint contains the learned arguments of a method and path template
+type Endpoint struct {
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	Requests int    `json:"requests"`
+	// Parameters are indexed by location, like query.id
+	Parameters map[string]*Parameter `json:"parameters"`
+}
+
+// Profile contains the learned endpoints, it is safe for concurrent use
+type Profile struct {
+	// MinSamples is the number of requests learned for an endpoint before
+	// it is enforced, it must not be modified while the profile is used
+	MinSamples int
+
+	mu        sync.RWMutex
+	endpoints map[string]*Endpoint
+}
+
+// New returns an empty profile
+func New() *Profile {
+	return &Profile{
+		MinSamples: DefaultMinSamples,
+		endpoints:  map[string]*Endpoint{},
+	}
+}
+
+// profileFile is the JSON representation of a profile
+type profileFile struct {
+	MinSamples int         `json:"min_samples"`
+	Endpoints  []*Endpoint `json:"endpoints"`
+}
+
+// Load parses a profile exported with Export
+func Load(data []byte) (*Profile, error) {
+	var f profileFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid profile: %s", err.Error())
+	}
+	p := New()
+	if f.MinSamples > 0 {
+		p.MinSamples = f.MinSamples
+	}
+	for _, e := range f.Endpoints {
+		if e == nil || e.Method == "" || !strings.HasPrefix(e.Path, "/") {
+			return nil, errors.New("invalid profile: endpoints require a method and a path")
+		}
+		if e.Parameters == nil {
+			e.Parameters = map[string]*Parameter{}
+		}
+		for loc, param := range e.Parameters {
+			if param == nil {
+				return nil, fmt.Errorf("invalid profile: empty parameter %q", loc)
+			}
+			switch param.Type {
+			case TypeBoolean, TypeInteger, TypeNumber, TypeString:
+			default:
+				return nil, fmt.Errorf("invalid profile: unknown type %q for parameter %q", param.Type, loc)
+			}
+		}
+		e.Method = strings.ToUpper(e.Method)
+		p.endpoints[endpointKey(e.Method, e.Path)] = e
+	}
+	return p, nil
+}
+
+// Export returns the JSON representation of the profile, the endpoints
+// are sorted by path and method
+func (p *Profile) Export() ([]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	f := profileFile{MinSamples: p.MinSamples, Endpoints: make([]*Endpoint, 0, len(p.endpoints))}
+	for _, e := range p.endpoints {
+		f.Endpoints = append(f.Endpoints, e)
+	}
+	sort.Slice(f.Endpoints, func(i, j int) bool {
+		if f.Endpoints[i].Path != f.Endpoints[j].Path {
+			return f.Endpoints[i].Path < f.Endpoints[j].Path
+		}
+		return f.Endpoints[i].Method < f.Endpoints[j].Method
+	})
+	return json.MarshalIndent(f, "", "  ")
+}
+
+// Endpoints returns the number of learned endpoints
+func (p *Profile) Endpoints() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.endpoints)
+}
+
+// Learn records the arguments of the request
+func (p *Profile) Learn(r Request) {
+	method := strings.ToUpper(r.Method)
+	path := Template(r.Path)
+	key := endpointKey(method, path)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e, ok := p.endpoints[key]
+	if !ok {
+		if len(p.endpoints) >= maxEndpoints {
+			return
+		}
+		e = &Endpoint{Method: method, Path: path, Parameters: map[string]*Parameter{}}
+		p.endpoints[key] = e
+	}
+	e.Requests++
+	learnArgs(e, "query", r.Query)
+	learnArgs(e, "body", r.Body)
+}
+
+func learnArgs(e *Endpoint, in string, args map[string][]string) {
+	for name, values := range args {
+		loc := in + "." + name
+		param, ok := e.Parameters[loc]
+		if !ok {
+			if len(e.Parameters) >= maxParameters {
+				continue
+			}
+			param = &Parameter{MinLength: -1}
+			e.Parameters[loc] = param
+		}
+		param.Seen++
+		for _, v := range values {
+			l := len(v)
+			param.Values++
+			param.MeanLength += (float64(l) - param.MeanLength) / float64(param.Values)
+			if param.MinLength < 0 || l < param.MinLength {
+				param.MinLength = l
+			}
+			if l > param.MaxLength {
+				param.MaxLength = l
+			}
+			param.Type = widen(param.Type, valueType(v))
+		}
+	}
+}
+
+// Check returns the deviations of the request from the profile, the
+// endpoints learned from less than MinSamples requests are not checked
+func (p *Profile) Check(r Request) []Violation {
+	method := strings.ToUpper(r.Method)
+	path := Template(r.Path)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	e, ok := p.endpoints[endpointKey(method, path)]
+	if !ok {
+		return []Violation{{
+			Kind:     UnknownEndpoint,
+			Location: "path",
+			Message:  fmt.Sprintf("endpoint %s %s was not learned", method, path),
+		}}
+	}
+	if e.Requests < p.MinSamples {
+		return nil
+	}
+	var violations []Violation
+	violations = checkArgs(violations, e, "query", r.Query)
+	violations = checkArgs(violations, e, "body", r.Body)
+
+	var missing []string
+	for loc, param := range e.Parameters {
+		if param.Seen < e.Requests {
+			continue
+		}
+		in, name, _ := strings.Cut(loc, ".")
+		args := r.Query
+		if in == "body" {
+			args = r.Body
+		}
+		if _, ok := args[name]; !ok {
+			missing = append(missing, loc)
+		}
+	}
+	sort.Strings(missing)
+	for _, loc := range missing {
+		violations = append(violations, Violation{
+			Kind:     MissingParameter,
+			Location: loc,
+			Message:  "the parameter was sent by every learned request",
+		})
+	}
+	return violations
+}
+
+func checkArgs(violations []Violation, e *Endpoint, in string, args map[string][]string) []Violation {
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		loc := in + "." + name
+		param, ok := e.Parameters[loc]
+		if !ok {
+			violations = append(violations, Violation{
+				Kind:     UnknownParameter,
+				Location: loc,
+				Message:  "the parameter was not learned",
+			})
+			continue
+		}
+		for _, v := range args[name] {
+			if t := valueType(v); widen(param.Type, t) != param.Type {
+				violations = append(violations, Violation{
+					Kind:     TypeMismatch,
+					Location: loc,
+					Message:  fmt.Sprintf("expected %s, got %s", param.Type, t),
+				})
+				break
+			}
+			if l := len(v); param.Type != TypeBoolean && (l < param.MinLength || l > param.MaxLength) {
+				violations = append(violations, Violation{
+					Kind:     LengthOutOfRange,
+					Location: loc,
+					Message:  fmt.Sprintf("length %d is out of the learned range %d-%d", l, param.MinLength, param.MaxLength),
+				})
+				break
+			}
+		}
+	}
+	return violations
+}
+
+// Template returns the path template of an endpoint, the numeric, UUID
+// and long hexadecimal segments are replaced by {int}, {uuid} and {hex}
+func Template(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		switch {
+		case s == "":
+		case isInteger(s):
+			segments[i] = "{int}"
+		case isUUID(s):
+			segments[i] = "{uuid}"
+		case len(s) >= 16 && isHex(s):
+			segments[i] = "{hex}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func endpointKey(method string, path string) string {
+	return method + " " + path
+}
+
+func valueType(v string) string {
+	switch {
+	case v == "true" || v == "false":
+		return TypeBoolean
+	case isInteger(v):
+		return TypeInteger
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return TypeNumber
+	}
+	return TypeString
+}
+
+// widen returns the most specific type accepting both types, an empty
+// type accepts any type
+func widen(a string, b string) string {
+	switch {
+	case a == "" || a == b:
+		return b
+	case (a == TypeInteger && b == TypeNumber) || (a == TypeNumber && b == TypeInteger):
+		return TypeNumber
+	}
+	return TypeString
+}
+
+func isInteger(s string) bool {
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+	}
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') && (c < 'A' || c > 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if i == 8 || i == 13 || i == 18 || i == 23 {
+			if s[i] != '-' {
+				return false
+			}
+		} else if !isHex(s[i : i+1]) {
+			return false
+		}
+	}
+	return true
+}
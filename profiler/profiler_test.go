@@ -0,0 +1,121 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package profiler
+
+import (
+	"strconv"
+	"testing"
+)
+
+func learned(t *testing.T) *Profile {
+	t.Helper()
+	p := New()
+	for i := 0; i < DefaultMinSamples; i++ {
+		p.Learn(Request{
+			Method: "get",
+			Path:   "/users/" + strconv.Itoa(i+1),
+			Query:  map[string][]string{"fields": {"name"}, "limit": {strconv.Itoa(i * 10)}},
+		})
+		p.Learn(Request{
+			Method: "POST",
+			Path:   "/orders/6f1c2b6e-0c1d-4c1e-9b1a-1d2e3f4a5b6c/items",
+			Body:   map[string][]string{"quantity": {"1.5", "2"}, "gift": {"true"}},
+		})
+	}
+	return p
+}
+
+func TestCheck(t *testing.T) {
+	p := learned(t)
+	tests := []struct {
+		req Request
+		// violations contains the kind and location of the violations
+		violations []string
+	}{
+		{Request{Method: "GET", Path: "/users/77", Query: map[string][]string{"fields": {"mail"}, "limit": {"5"}}}, nil},
+		{Request{Method: "GET", Path: "/users/77", Query: map[string][]string{"fields": {"mail"}}}, []string{"missing_parameter query.limit"}},
+		{Request{Method: "GET", Path: "/users/77", Query: map[string][]string{"fields": {"name"}, "limit": {"x"}, "debug": {"1"}}}, []string{"unknown_parameter query.debug", "type_mismatch query.limit"}},
+		{Request{Method: "GET", Path: "/users/77", Query: map[string][]string{"fields": {"name' OR 1=1"}, "limit": {"1"}}}, []string{"length_out_of_range query.fields"}},
+		{Request{Method: "POST", Path: "/orders/00000000-0000-0000-0000-000000000000/items", Body: map[string][]string{"quantity": {"3"}, "gift": {"false"}}}, nil},
+		{Request{Method: "POST", Path: "/orders/00000000-0000-0000-0000-000000000000/items", Body: map[string][]string{"gift": {"1"}}}, []string{"type_mismatch body.gift", "missing_parameter body.quantity"}},
+		{Request{Method: "DELETE", Path: "/users/77"}, []string{"unknown_endpoint path"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.req.Method+" "+tt.req.Path, func(t *testing.T) {
+			violations := p.Check(tt.req)
+			if len(violations) != len(tt.violations) {
+				t.Fatalf("expected violations %v, got %v", tt.violations, violations)
+			}
+			for i, v := range violations {
+				if have := v.Kind + " " + v.Location; have != tt.violations[i] {
+					t.Errorf("expected violation %q, got %q", tt.violations[i], have)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckMinSamples(t *testing.T) {
+	p := New()
+	p.Learn(Request{Method: "GET", Path: "/"})
+	if v := p.Check(Request{Method: "GET", Path: "/", Query: map[string][]string{"a": {"b"}}}); len(v) != 0 {
+		t.Errorf("unexpected violations %v before MinSamples requests", v)
+	}
+}
+
+func TestExportLoad(t *testing.T) {
+	p := learned(t)
+	data, err := p.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Endpoints() != 2 {
+		t.Fatalf("expected 2 endpoints, got %d", loaded.Endpoints())
+	}
+	exported, err := loaded.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(exported) != string(data) {
+		t.Errorf("unexpected export of the loaded profile\n%s\n%s", exported, data)
+	}
+	if v := loaded.Check(Request{Method: "GET", Path: "/users/1", Query: map[string][]string{"limit": {"1"}}}); len(v) != 1 || v[0].Kind != MissingParameter {
+		t.Errorf("unexpected violations %v", v)
+	}
+
+	for _, data := range []string{
+		`[]`,
+		`{"endpoints": [{"path": "/"}]}`,
+		`{"endpoints": [{"method": "GET", "path": "/", "parameters": {"query.a": {"type": "date"}}}]}`,
+	} {
+		if _, err := Load([]byte(data)); err == nil {
+			t.Errorf("expected an error loading %s", data)
+		}
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	tests := map[string]string{
+		"/":                          "/",
+		"/users/12/":                 "/users/{int}/",
+		"/v1/files/deadbeefdeadbeef": "/v1/files/{hex}",
+		"/v1/files/deadbeef":         "/v1/files/deadbeef",
+		"/a/6F1C2B6E-0C1D-4C1E-9B1A-1D2E3F4A5B6C": "/a/{uuid}",
+	}
+	for path, want := range tests {
+		if have := Template(path); have != want {
+			t.Errorf("unexpected template %q for %q, want %q", have, path, want)
+		}
+	}
+}
+
+func TestModeString(t *testing.T) {
+	if Learn.String() != "learn" || Enforce.String() != "enforce" {
+		t.Error("unexpected mode names")
+	}
+}
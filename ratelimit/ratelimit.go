@@ -0,0 +1,89 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package ratelimit contains the stores used by the @rateLimit operator
+// to count requests with sliding windows.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Store counts hits per key, implementations may be shared between
+// WAF instances or backed by an external database for distributed
+// rate limiting. Implementations must be concurrent safe.
+type Store interface {
+	// Increment records a hit for the key and returns the number of
+	// hits within the sliding window ending at now, including this one
+	Increment(key string, now time.Time, window time.Duration) (int, error)
+}
+
+type counter struct {
+	// start of the current fixed window
+	start time.Time
+	// hits of the current and previous fixed windows
+	current  int
+	previous int
+}
+
+// memoryStore approximates sliding windows by weighting the hits of the
+// previous fixed window, it uses constant memory per key
+type memoryStore struct {
+	mu       sync.Mutex
+	counters map[counterKey]*counter
+	ops      int
+}
+
+type counterKey struct {
+	key    string
+	window time.Duration
+}
+
+// sweepInterval is the number of increments between expired
+// counters cleanups
+const sweepInterval = 10000
+
+// NewMemoryStore returns a Store keeping the counters in memory,
+// counters are not shared between processes
+func NewMemoryStore() Store {
+	return &memoryStore{
+		counters: map[counterKey]*counter{},
+	}
+}
+
+func (s *memoryStore) Increment(key string, now time.Time, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ops++
+	if s.ops%sweepInterval == 0 {
+		s.sweep(now)
+	}
+
+	k := counterKey{key, window}
+	c, ok := s.counters[k]
+	start := now.Truncate(window)
+	switch {
+	case !ok:
+		c = &counter{start: start}
+		s.counters[k] = c
+	case start.Sub(c.start) >= 2*window:
+		c.start, c.current, c.previous = start, 0, 0
+	case start.Sub(c.start) >= window:
+		c.start, c.current, c.previous = start, 0, c.current
+	}
+	c.current++
+
+	elapsed := float64(now.Sub(c.start)) / float64(window)
+	return c.current + int(float64(c.previous)*(1-elapsed)), nil
+}
+
+// sweep removes the counters that don't affect the windows anymore
+func (s *memoryStore) sweep(now time.Time) {
+	for k, c := range s.counters {
+		if now.Sub(c.start) >= 2*k.window {
+			delete(s.counters, k)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+	window := time.Minute
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 1; i <= 10; i++ {
+		n, err := s.Increment("a", start.Add(time.Duration(i)*time.Second), window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != i {
+			t.Fatalf("expected %d hits, got %d", i, n)
+		}
+	}
+	if n, _ := s.Increment("b", start, window); n != 1 {
+		t.Errorf("keys must be counted independently, got %d", n)
+	}
+	if n, _ := s.Increment("a", start, time.Hour); n != 1 {
+		t.Errorf("windows must be counted independently, got %d", n)
+	}
+
+	// half of the previous window is still inside the sliding window
+	if n, _ := s.Increment("a", start.Add(window+window/2), window); n != 6 {
+		t.Errorf("expected 6 hits in the sliding window, got %d", n)
+	}
+	// the previous window is not relevant anymore
+	if n, _ := s.Increment("a", start.Add(3*window), window); n != 1 {
+		t.Errorf("expected counter to be reset, got %d", n)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	s := NewMemoryStore().(*memoryStore)
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, _ = s.Increment("old", start, time.Second)
+	s.sweep(start.Add(time.Minute))
+	if len(s.counters) != 0 {
+		t.Errorf("expected expired counters to be removed, got %d", len(s.counters))
+	}
+}
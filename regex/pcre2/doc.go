@@ -0,0 +1,18 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package pcre2 registers the "pcre2" regex engine backed by the PCRE2
+// library, it supports the PCRE syntax of ModSecurity rules like
+// lookarounds and backreferences. The engine uses cgo and is only built
+// with the pcre2 build tag, the library and its headers must be installed
+// (libpcre2-dev on Debian):
+//
+//	import _ "github.com/corazawaf/coraza/v3/regex/pcre2"
+//
+//	go build -tags pcre2
+//
+// and selected with SecRegexEngine pcre2. Like ModSecurity, expressions
+// are compiled with PCRE2_DOTALL and PCRE2_DOLLAR_ENDONLY and matched with
+// the JIT compiler when available. PCRE2 uses backtracking, expressions
+// exceeding the match limit of the library don't match.
+package pcre2
@@ -0,0 +1,153 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build pcre2 && cgo
+
+package pcre2
+
+/*
+#cgo LDFLAGS: -lpcre2-8
+#define PCRE2_CODE_UNIT_WIDTH 8
+#include <stdlib.h>
+#include <pcre2.h>
+
+static pcre2_code *coraza_pcre2_compile(const char *pattern, size_t length, int *errcode, size_t *erroffset) {
+	pcre2_code *code = pcre2_compile((PCRE2_SPTR)pattern, length, PCRE2_DOTALL | PCRE2_DOLLAR_ENDONLY, errcode, erroffset, NULL);
+	if (code != NULL) {
+		// the interpreter is used if JIT is not supported
+		pcre2_jit_compile(code, PCRE2_JIT_COMPLETE);
+	}
+	return code;
+}
+
+static void coraza_pcre2_error(int errcode, char *buf, size_t length) {
+	pcre2_get_error_message(errcode, (PCRE2_UCHAR *)buf, length);
+}
+
+// coraza_pcre2_match returns the number of captured groups, or a negative
+// error code, ovector receives the offsets of the groups
+static int coraza_pcre2_match(pcre2_code *code, const char *subject, size_t length, size_t *ovector, int ovecsize) {
+	pcre2_match_data *md = pcre2_match_data_create_from_pattern(code, NULL);
+	if (md == NULL) {
+		return PCRE2_ERROR_NOMEMORY;
+	}
+	int rc = pcre2_match(code, (PCRE2_SPTR)subject, length, 0, 0, md, NULL);
+	if (rc > 0 && ovector != NULL) {
+		PCRE2_SIZE *ov = pcre2_get_ovector_pointer(md);
+		if (rc > ovecsize) {
+			rc = ovecsize;
+		}
+		for (int i = 0; i < 2 * rc; i++) {
+			ovector[i] = ov[i];
+		}
+	}
+	pcre2_match_data_free(md);
+	return rc;
+}
+
+static int coraza_pcre2_groups(pcre2_code *code) {
+	uint32_t n = 0;
+	pcre2_pattern_info(code, PCRE2_INFO_CAPTURECOUNT, &n);
+	return (int)n + 1;
+}
+
+static int coraza_pcre2_unset(size_t offset) {
+	return offset == PCRE2_UNSET;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"github.com/corazawaf/coraza/v3/regex"
+)
+
+// Engine compiles regular expressions with PCRE2
+type Engine struct{}
+
+var _ regex.Engine = Engine{}
+
+// Name implements regex.Engine
+func (Engine) Name() string {
+	return "pcre2"
+}
+
+// Compile implements regex.Engine
+func (Engine) Compile(expr string) (regex.Regexp, error) {
+	pattern := C.CString(expr)
+	defer C.free(unsafe.Pointer(pattern))
+	var (
+		errcode   C.int
+		erroffset C.size_t
+	)
+	code := C.coraza_pcre2_compile(pattern, C.size_t(len(expr)), &errcode, &erroffset)
+	if code == nil {
+		buf := make([]byte, 256)
+		C.coraza_pcre2_error(errcode, (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf)))
+		return nil, fmt.Errorf("pcre2: %s at offset %d", C.GoString((*C.char)(unsafe.Pointer(&buf[0]))), int(erroffset))
+	}
+	re := &Regexp{expr: expr, code: code, groups: int(C.coraza_pcre2_groups(code))}
+	runtime.SetFinalizer(re, func(re *Regexp) {
+		C.pcre2_code_free(re.code)
+	})
+	return re, nil
+}
+
+// Regexp is a compiled PCRE2 expression, it is safe for concurrent use
+type Regexp struct {
+	expr   string
+	code   *C.pcre2_code
+	groups int
+}
+
+var _ regex.Regexp = (*Regexp)(nil)
+
+// match runs the expression on s, ovector receives the offsets of the
+// groups if it is not nil
+func (re *Regexp) match(s string, ovector []C.size_t) int {
+	// the subject is copied as Go memory can't be retained by C
+	subject := C.CString(s)
+	defer C.free(unsafe.Pointer(subject))
+	var ov *C.size_t
+	if len(ovector) > 0 {
+		ov = &ovector[0]
+	}
+	rc := C.coraza_pcre2_match(re.code, subject, C.size_t(len(s)), ov, C.int(len(ovector)/2))
+	runtime.KeepAlive(re)
+	return int(rc)
+}
+
+// MatchString implements regex.Regexp
+func (re *Regexp) MatchString(s string) bool {
+	return re.match(s, nil) > 0
+}
+
+// FindStringSubmatch implements regex.Regexp
+func (re *Regexp) FindStringSubmatch(s string) []string {
+	ovector := make([]C.size_t, 2*re.groups)
+	rc := re.match(s, ovector)
+	if rc <= 0 {
+		return nil
+	}
+	res := make([]string, re.groups)
+	for i := 0; i < rc; i++ {
+		start, end := ovector[2*i], ovector[2*i+1]
+		if C.coraza_pcre2_unset(start) != 0 {
+			continue
+		}
+		res[i] = s[start:end]
+	}
+	return res
+}
+
+// String implements regex.Regexp
+func (re *Regexp) String() string {
+	return re.expr
+}
+
+func init() {
+	regex.RegisterEngine(Engine{})
+}
@@ -0,0 +1,40 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build pcre2 && cgo
+
+package pcre2
+
+import (
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/regex"
+)
+
+func TestEngine(t *testing.T) {
+	e, err := regex.GetEngine("pcre2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// backreferences and lookarounds are not supported by RE2
+	re, err := e.Compile(`(?<=x)(a)(b+)?\1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := re.FindStringSubmatch("-xabba"); len(m) != 3 || m[0] != "abba" || m[2] != "bb" {
+		t.Errorf("unexpected submatches %q", m)
+	}
+	if m := re.FindStringSubmatch("xaa"); len(m) != 3 || m[0] != "aa" || m[2] != "" {
+		t.Errorf("unexpected submatches %q", m)
+	}
+	if re.MatchString("abba") {
+		t.Error("unexpected match without the lookbehind")
+	}
+	// compiled with PCRE2_DOTALL
+	if re, _ := e.Compile(`a.b`); !re.MatchString("a\nb") {
+		t.Error("expected the dot to match new lines")
+	}
+	if _, err := e.Compile(`a(`); err == nil {
+		t.Error("expected error for invalid expression")
+	}
+}
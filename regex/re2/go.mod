@@ -0,0 +1,23 @@
+module github.com/corazawaf/coraza/v3/regex/re2
+
+go 1.18
+
+require (
+	github.com/corazawaf/coraza/v3 v3.0.0-20220914101451-05d352c89b24
+	github.com/wasilibs/go-re2 v1.3.0
+)
+
+require (
+	github.com/andybalholm/brotli v1.0.4 // indirect
+	github.com/corazawaf/libinjection-go v0.1.2 // indirect
+	github.com/magefile/mage v1.14.0 // indirect
+	github.com/petar-dambovaliev/aho-corasick v0.0.0-20211021192214-5ab2d9280aa9 // indirect
+	github.com/tetratelabs/wazero v1.2.1 // indirect
+	github.com/tidwall/gjson v1.14.3 // indirect
+	github.com/tidwall/match v1.1.1 // indirect
+	github.com/tidwall/pretty v1.2.1 // indirect
+	golang.org/x/net v0.1.0 // indirect
+)
+
+// the engine registry is not released yet
+replace github.com/corazawaf/coraza/v3 => ../../
@@ -0,0 +1,38 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package re2 registers the "re2" regex engine backed by the RE2 C++
+// library, compiled to WebAssembly so it doesn't require cgo. It is
+// selected with the SecRegexEngine directive after importing the package:
+//
+//	import _ "github.com/corazawaf/coraza/v3/regex/re2"
+//
+//	SecRegexEngine re2
+//
+// RE2 shares the syntax of the Go engine and is usually faster for the
+// large alternations of the CRS.
+package re2
+
+import (
+	"github.com/corazawaf/coraza/v3/regex"
+	"github.com/wasilibs/go-re2"
+)
+
+// Engine compiles regular expressions with RE2
+type Engine struct{}
+
+var _ regex.Engine = Engine{}
+
+// Name implements regex.Engine
+func (Engine) Name() string {
+	return "re2"
+}
+
+// Compile implements regex.Engine
+func (Engine) Compile(expr string) (regex.Regexp, error) {
+	return re2.Compile(expr)
+}
+
+func init() {
+	regex.RegisterEngine(Engine{})
+}
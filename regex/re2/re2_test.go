@@ -0,0 +1,48 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package re2
+
+import (
+	"testing"
+
+	"github.com/corazawaf/coraza/v3"
+	"github.com/corazawaf/coraza/v3/regex"
+)
+
+func TestEngine(t *testing.T) {
+	e, err := regex.GetEngine("re2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	re, err := e.Compile(`a(b+)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := re.FindStringSubmatch("xabbx"); len(m) != 2 || m[1] != "bb" {
+		t.Errorf("unexpected submatches %q", m)
+	}
+	if re.MatchString("xyz") {
+		t.Error("unexpected match")
+	}
+	if _, err := e.Compile(`a(`); err == nil {
+		t.Error("expected error for invalid expression")
+	}
+}
+
+func TestSecRegexEngine(t *testing.T) {
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(`
+		SecRuleEngine On
+		SecRegexEngine re2
+		SecRule ARGS:id "@rx ^(\d+)$" "id:1,phase:1,deny,capture"
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	defer tx.Close()
+	tx.ProcessURI("/?id=123", "GET", "HTTP/1.1")
+	if it := tx.ProcessRequestHeaders(); it == nil || it.RuleID != 1 {
+		t.Errorf("expected the rule to interrupt, got %v", it)
+	}
+}
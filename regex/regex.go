@@ -0,0 +1,73 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package regex abstracts the regular expression engine used by the @rx
+// operator. The Go standard library engine is always available, other
+// engines register themselves with RegisterEngine, usually from an init
+// function, and are selected per WAF with the SecRegexEngine directive.
+// The regex/pcre2 package (pcre2 build tag, cgo) and the regex/re2 module
+// provide the PCRE2 and RE2 engines.
+package regex
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// Regexp is a compiled regular expression
+type Regexp interface {
+	// MatchString reports whether the string contains any match
+	MatchString(s string) bool
+	// FindStringSubmatch returns the leftmost match and its submatches,
+	// nil indicates no match
+	FindStringSubmatch(s string) []string
+	// String returns the source text used to compile the expression
+	String() string
+}
+
+// Engine compiles regular expressions
+type Engine interface {
+	// Name identifies the engine, it is used to select it in SecRegexEngine
+	Name() string
+	// Compile parses a regular expression
+	Compile(expr string) (Regexp, error)
+}
+
+type stdlibEngine struct{}
+
+func (stdlibEngine) Name() string {
+	return "go"
+}
+
+func (stdlibEngine) Compile(expr string) (Regexp, error) {
+	return regexp.Compile(expr)
+}
+
+// Default is the engine backed by the Go standard library, it uses RE2
+// syntax and guarantees linear time matching
+var Default Engine = stdlibEngine{}
+
+var (
+	enginesMu sync.RWMutex
+	engines   = map[string]Engine{Default.Name(): Default}
+)
+
+// RegisterEngine makes an engine available by its name, registering an
+// engine with an existing name replaces it
+func RegisterEngine(e Engine) {
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+	engines[e.Name()] = e
+}
+
+// GetEngine returns a registered engine by its name
+func GetEngine(name string) (Engine, error) {
+	enginesMu.RLock()
+	defer enginesMu.RUnlock()
+	e, ok := engines[name]
+	if !ok {
+		return nil, fmt.Errorf("regex engine %q is not registered", name)
+	}
+	return e, nil
+}
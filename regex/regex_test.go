@@ -0,0 +1,59 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package regex
+
+import (
+	"strings"
+	"testing"
+)
+
+// literalEngine matches substrings, it is only used to test the registry
+type literalEngine struct{}
+
+func (literalEngine) Name() string { return "literal" }
+
+func (literalEngine) Compile(expr string) (Regexp, error) { return literal(expr), nil }
+
+type literal string
+
+func (l literal) MatchString(s string) bool { return strings.Contains(s, string(l)) }
+
+func (l literal) FindStringSubmatch(s string) []string {
+	if !l.MatchString(s) {
+		return nil
+	}
+	return []string{string(l)}
+}
+
+func (l literal) String() string { return string(l) }
+
+func TestEngines(t *testing.T) {
+	e, err := GetEngine("go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	re, err := e.Compile(`a(b+)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := re.FindStringSubmatch("xabbx"); len(m) != 2 || m[1] != "bb" {
+		t.Errorf("unexpected submatches %q", m)
+	}
+	if _, err := e.Compile(`a(`); err == nil {
+		t.Error("expected error for invalid expression")
+	}
+
+	if _, err := GetEngine("literal"); err == nil {
+		t.Error("expected error for unregistered engine")
+	}
+	RegisterEngine(literalEngine{})
+	e, err = GetEngine("literal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	re, _ = e.Compile("a(")
+	if !re.MatchString("xa(x") {
+		t.Error("expected literal match")
+	}
+}
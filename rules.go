@@ -0,0 +1,77 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package coraza
+
+import (
+	"github.com/corazawaf/coraza/v3/internal/corazawaf"
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+// Rules gives read only access to the rules loaded in a WAF, for example
+// to display or audit the policy. The metadata includes where each rule
+// was defined (File, Line and Raw) and the version set with the ver
+// action, like OWASP_CRS/4.0.0.
+//
+// SecMarker directives and chained rules are not listed, the Raw text of
+// a chain starter only contains its own directive.
+type Rules interface {
+	// All returns the rules in evaluation order
+	All() []types.RuleMetadata
+
+	// FindByID returns the rule with the given ID and true, or false if
+	// it does not exist
+	FindByID(id int) (types.RuleMetadata, bool)
+
+	// FindByTag returns the rules with the given tag in evaluation order
+	FindByTag(tag string) []types.RuleMetadata
+
+	// Count returns the number of rules
+	Count() int
+}
+
+type rulesWrapper struct {
+	rules *corazawaf.RuleGroup
+}
+
+// All implements the same method on Rules.
+func (r rulesWrapper) All() []types.RuleMetadata {
+	return r.metadata(r.rules.GetRules())
+}
+
+// FindByID implements the same method on Rules.
+func (r rulesWrapper) FindByID(id int) (types.RuleMetadata, bool) {
+	rule := r.rules.FindByID(id)
+	if rule == nil || rule.SecMark_ != "" {
+		return nil, false
+	}
+	return &rule.RuleMetadata, true
+}
+
+// FindByTag implements the same method on Rules.
+func (r rulesWrapper) FindByTag(tag string) []types.RuleMetadata {
+	return r.metadata(r.rules.FindByTag(tag))
+}
+
+// Count implements the same method on Rules.
+func (r rulesWrapper) Count() int {
+	n := 0
+	for _, rule := range r.rules.GetRules() {
+		if rule.SecMark_ == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// metadata returns the metadata of the rules skipping markers
+func (r rulesWrapper) metadata(rules []*corazawaf.Rule) []types.RuleMetadata {
+	res := make([]types.RuleMetadata, 0, len(rules))
+	for _, rule := range rules {
+		if rule.SecMark_ != "" {
+			continue
+		}
+		res = append(res, &rule.RuleMetadata)
+	}
+	return res
+}
@@ -3,7 +3,11 @@
 
 package rules
 
-import "io/fs"
+import (
+	"io/fs"
+
+	"github.com/corazawaf/coraza/v3/regex"
+)
 
 // OperatorOptions is used to store the options for a rule operator
 type OperatorOptions struct {
@@ -18,6 +22,21 @@ type OperatorOptions struct {
 
 	// Datasets contains input datasets or dictionaries
 	Datasets map[string][]string
+
+	// RegexEngine compiles the regular expressions of the operator,
+	// regex.Default is used if nil
+	RegexEngine regex.Engine
+
+	// Memoizer shares the artifacts compiled by the operator with the
+	// other rules and WAFs, they are compiled for the operator if nil
+	Memoizer Memoizer
+}
+
+// Memoizer caches the artifacts compiled by operators, like regular
+// expressions or pattern matchers
+type Memoizer interface {
+	// Do returns the artifact cached for key, fn builds it the first time
+	Do(key string, fn func() (interface{}, error)) (interface{}, error)
 }
 
 // Operator interface is used to define rule @operators
@@ -28,4 +47,36 @@ type Operator interface {
 	Evaluate(TransactionState, string) bool
 }
 
+// RawInputOperator is an optional interface implemented by operators
+// that may be evaluated against the variable value before the rule
+// transformations are applied
+type RawInputOperator interface {
+	Operator
+	// RawInput returns true if the operator must receive the
+	// untransformed value
+	RawInput() bool
+}
+
+// ReloadableOperator is an optional interface implemented by operators
+// loading their data from files, like @pmFromFile, so the files can be
+// updated without reloading the rules
+type ReloadableOperator interface {
+	Operator
+	// Reload reads the data files again, the operator keeps its previous
+	// data if it fails
+	Reload() error
+}
+
+// LiteralOperator is an optional interface implemented by operators that
+// only match values containing at least one of a set of literals, like
+// @rx with a pattern requiring a literal. The rules are pre-qualified by
+// scanning the values once for the literals of every rule.
+type LiteralOperator interface {
+	Operator
+	// Literals returns the lowercase literals, a value matches only if
+	// it contains one of them ignoring the ASCII case. It returns nil if
+	// the operator has no such literals.
+	Literals() []string
+}
+
 type OperatorFactory func(options OperatorOptions) (Operator, error)
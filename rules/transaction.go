@@ -8,6 +8,7 @@ import (
 
 	"github.com/corazawaf/coraza/v3/collection"
 	"github.com/corazawaf/coraza/v3/loggers"
+	"github.com/corazawaf/coraza/v3/ratelimit"
 	"github.com/corazawaf/coraza/v3/types"
 	"github.com/corazawaf/coraza/v3/types/variables"
 )
@@ -40,6 +41,22 @@ type TransactionState interface {
 	Capturing() bool // TODO(anuraaga): Only needed in operators?
 	// CaptureField captures a field.
 	CaptureField(idx int, value string)
+
+	// OperatorState returns the value kept for the transaction under key,
+	// init creates it the first time. Operators use it for state that must
+	// not outlive the transaction, like call budgets.
+	OperatorState(key interface{}, init func() interface{}) interface{}
+
+	// RateLimitStore returns the store keeping the rate limit counters,
+	// it is nil if rate limiting is disabled.
+	RateLimitStore() ratelimit.Store
+
+	// HashEnforced returns whether the hash engine enforces the signatures
+	// of the links for this transaction.
+	HashEnforced() bool
+	// ValidateHash returns whether the uri carries a valid signature
+	// generated by the hash engine.
+	ValidateHash(uri string) bool
 }
 
 // TransactionVariables has pointers to all the variables of the transaction
@@ -47,6 +64,45 @@ type TransactionVariables interface {
 	// Simple Variables
 	UserID() *collection.Simple
 	UrlencodedError() *collection.Simple
+	RuleError() *collection.Simple
+	RuleErrorMsg() *collection.Simple
+	RequestCookiesError() *collection.Simple
+	RequestCookiesErrorMsg() *collection.Simple
+	AccessListAction() *collection.Simple
+	AccessListEntry() *collection.Simple
+	OpenAPIOperation() *collection.Simple
+	CSRFToken() *collection.Simple
+	CSRFError() *collection.Simple
+	CSRFErrorMsg() *collection.Simple
+	TLSJA3() *collection.Simple
+	TLSJA3Hash() *collection.Simple
+	TLSJA4() *collection.Simple
+	SSLClientVerify() *collection.Simple
+	SSLClientSDN() *collection.Simple
+	SSLClientSDNCN() *collection.Simple
+	SSLClientIDN() *collection.Simple
+	SSLClientMSerial() *collection.Simple
+	SSLClientVStart() *collection.Simple
+	SSLClientVEnd() *collection.Simple
+	SSLClientVRemain() *collection.Simple
+	HoneypotPath() *collection.Simple
+	RequestURIScheme() *collection.Simple
+	RequestURIHost() *collection.Simple
+	RequestURIUserinfo() *collection.Simple
+	RequestURIFragment() *collection.Simple
+	RequestURIExtraQuery() *collection.Simple
+	ConnConcurrent() *collection.Simple
+	ConnRate() *collection.Simple
+	ConnLimitExceeded() *collection.Simple
+	RequestBodyDuration() *collection.Simple
+	RequestBodyChunks() *collection.Simple
+	RequestBodyChunkInterval() *collection.Simple
+	RequestBodyChunkSize() *collection.Simple
+	MemoryLimitExceeded() *collection.Simple
+	StreamInputBody() *collection.Simple
+	StreamOutputBody() *collection.Simple
+	ResponseBodyDecompressionError() *collection.Simple
+	RequestBodyDecompressionError() *collection.Simple
 	ResponseContentType() *collection.Simple
 	UniqueID() *collection.Simple
 	ArgsCombinedSize() *collection.SizeProxy
@@ -133,8 +189,22 @@ type TransactionVariables interface {
 	XML() *collection.Map
 	RequestXML() *collection.Map
 	ResponseXML() *collection.Map
+	RequestPseudoHeaders() *collection.Map
+	RequestProtocolAnomalies() *collection.Map
+	RequestSOAP() *collection.Map
+	RequestXMLAnomalies() *collection.Map
+	OpenAPIViolations() *collection.Map
+	RequestCookiesTampered() *collection.Map
+	RequestCookiesUnsigned() *collection.Map
+	SSLClientSAN() *collection.Map
+	ProfileViolation() *collection.Map
+	HoneypotFields() *collection.Map
 	// Persistent variables
 	IP() *collection.Map
+	Global() *collection.Map
+	Session() *collection.Map
+	User() *collection.Map
+	Resource() *collection.Map
 	// Translation Proxy Variables
 	ArgsNames() *collection.TranslationProxy
 	ArgsGetNames() *collection.TranslationProxy
@@ -1,10 +1,10 @@
 // Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
 // SPDX-License-Identifier: Apache-2.0
 
-// Audit logs are currently disabled for tinygo
+// Audit log files are disabled without filesystem access
 
-//go:build !tinygo
-// +build !tinygo
+//go:build !tinygo && !coraza.no_fs_access
+// +build !tinygo,!coraza.no_fs_access
 
 package testing
 
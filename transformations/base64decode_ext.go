@@ -0,0 +1,29 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import "strings"
+
+// base64decodeExt decodes Base64 ignoring invalid characters and
+// padding, like ModSecurity it is meant for forgiving decoding of
+// values crafted to evade base64Decode
+func base64decodeExt(data string) (string, error) {
+	var res strings.Builder
+	res.Grow(len(data) * 3 / 4)
+	var acc, bits uint
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if c > 127 || base64DecMap[c] >= 64 {
+			// invalid characters and padding are skipped
+			continue
+		}
+		acc = acc<<6 | uint(base64DecMap[c])
+		bits += 6
+		if bits >= 8 {
+			bits -= 8
+			res.WriteByte(byte(acc >> bits))
+		}
+	}
+	return res.String(), nil
+}
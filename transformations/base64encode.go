@@ -0,0 +1,10 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import "encoding/base64"
+
+func base64encode(data string) (string, error) {
+	return base64.StdEncoding.EncodeToString([]byte(data)), nil
+}
@@ -0,0 +1,16 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import "github.com/corazawaf/coraza/v3/internal/strings"
+
+// hexDecode decodes pairs of hexadecimal digits, like ModSecurity
+// invalid digits are not validated and a trailing odd digit is dropped
+func hexDecode(data string) (string, error) {
+	res := make([]byte, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		res = append(res, strings.X2c(data[i:]))
+	}
+	return strings.WrapUnsafe(res), nil
+}
@@ -5,9 +5,17 @@ package transformations
 
 import (
 	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	utils "github.com/corazawaf/coraza/v3/internal/strings"
 )
 
+// maxPathDecodings bounds the decodings of the repeated percent encodings
+const maxPathDecodings = 4
+
 func normalisePath(data string) (string, error) {
+	data = decodePath(data)
 	leng := len(data)
 	if leng < 1 {
 		return data, nil
@@ -16,8 +24,139 @@ func normalisePath(data string) (string, error) {
 	if clean == "." {
 		return "", nil
 	}
-	if data[len(data)-1] == '/' {
+	if data[len(data)-1] == '/' && clean != "/" {
 		return clean + "/", nil
 	}
 	return clean, nil
 }
+
+// decodePath decodes the encodings used to evade the path normalization:
+// the percent encodings of the path characters, repeated or not, and the
+// overlong UTF-8 encodings of the ASCII characters, like C0 AF for '/'.
+// The segments are then truncated at their null byte, like the servers
+// written in C do with file names.
+func decodePath(data string) string {
+	for i := 0; i < maxPathDecodings; i++ {
+		decoded, changed := decodePathPercent(data)
+		if !changed {
+			break
+		}
+		data = decoded
+	}
+	return truncateNulls(decodeOverlong(data))
+}
+
+// truncateNulls removes the bytes from every null byte to the next
+// separator
+func truncateNulls(data string) string {
+	i := strings.IndexByte(data, 0)
+	if i == -1 {
+		return data
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:i]...)
+	skip := false
+	for ; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == 0:
+			skip = true
+		case c == '/' || c == '\\':
+			skip = false
+			out = append(out, c)
+		case !skip:
+			out = append(out, c)
+		}
+	}
+	return string(out)
+}
+
+// decodePathPercent decodes the percent encodings of the dots, the
+// separators, the percent sign, the null byte and the non ASCII bytes,
+// the other encodings are kept
+func decodePathPercent(data string) (string, bool) {
+	i := strings.IndexByte(data, '%')
+	if i == -1 {
+		return data, false
+	}
+	changed := false
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:i]...)
+	for ; i < len(data); i++ {
+		c := data[i]
+		if c == '%' && i+2 < len(data) && utils.ValidHex(data[i+1]) && utils.ValidHex(data[i+2]) {
+			if d := utils.X2c(data[i+1 : i+3]); isPathByte(d) {
+				out = append(out, d)
+				i += 2
+				changed = true
+				continue
+			}
+		}
+		out = append(out, c)
+	}
+	return string(out), changed
+}
+
+func isPathByte(c byte) bool {
+	switch c {
+	case '.', '/', '\\', '%', 0:
+		return true
+	}
+	return c >= utf8.RuneSelf
+}
+
+// decodeOverlong replaces the overlong UTF-8 encodings of the ASCII
+// characters by the characters
+func decodeOverlong(data string) string {
+	var out []byte
+	for i := 0; i < len(data); i++ {
+		c, n := overlongASCII(data[i:])
+		if n == 0 {
+			if out != nil {
+				out = append(out, data[i])
+			}
+			continue
+		}
+		if out == nil {
+			out = append(make([]byte, 0, len(data)), data[:i]...)
+		}
+		out = append(out, c)
+		i += n - 1
+	}
+	if out == nil {
+		return data
+	}
+	return string(out)
+}
+
+// overlongASCII returns the ASCII character encoded by the overlong UTF-8
+// sequence starting the string and the length of the sequence, or a zero
+// length if the string doesn't start with such a sequence
+func overlongASCII(s string) (byte, int) {
+	var n int
+	var v uint32
+	switch c := s[0]; {
+	case c < 0xC0:
+		return 0, 0
+	case c&0xE0 == 0xC0:
+		n, v = 2, uint32(c&0x1F)
+	case c&0xF0 == 0xE0:
+		n, v = 3, uint32(c&0x0F)
+	case c&0xF8 == 0xF0:
+		n, v = 4, uint32(c&0x07)
+	default:
+		return 0, 0
+	}
+	if len(s) < n {
+		return 0, 0
+	}
+	for i := 1; i < n; i++ {
+		if s[i]&0xC0 != 0x80 {
+			return 0, 0
+		}
+		v = v<<6 | uint32(s[i]&0x3F)
+	}
+	if v >= utf8.RuneSelf {
+		return 0, 0
+	}
+	return byte(v), n
+}
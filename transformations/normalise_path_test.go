@@ -0,0 +1,40 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import "testing"
+
+func TestNormalisePathEvasions(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		unix  string
+		win   string
+	}{
+		{name: "mixed separators", input: "/a\\..\\b/x/../c", unix: "/a\\..\\b/c", win: "/b/c"},
+		{name: "encoded dots", input: "/a/%2e%2E/b", unix: "/b", win: "/b"},
+		{name: "double encoding", input: "/a/%252e%252e%252fb", unix: "/b", win: "/b"},
+		{name: "encoded backslash", input: "/a/..%5cb", unix: "/a/..\\b", win: "/b"},
+		{name: "other encodings", input: "/a%20b/%41", unix: "/a%20b/%41", win: "/a%20b/%41"},
+		{name: "overlong slash", input: "/a/..\xc0\xafb", unix: "/b", win: "/b"},
+		{name: "encoded overlong", input: "/a/%c0%ae%c0%ae/b", unix: "/b", win: "/b"},
+		{name: "three bytes overlong", input: "/a\xe0\x80\xaf..\xe0\x80\xafb", unix: "/b", win: "/b"},
+		{name: "overlong backslash", input: "/a/..\xc1\x9cb", unix: "/a/..\\b", win: "/b"},
+		{name: "valid utf8", input: "/h\xc3\xa9/x", unix: "/h\xc3\xa9/x", win: "/h\xc3\xa9/x"},
+		{name: "null byte", input: "/etc/passwd%00.jpg", unix: "/etc/passwd", win: "/etc/passwd"},
+		{name: "null segment", input: "/a/b\x00x/../c", unix: "/a/c", win: "/a/c"},
+		{name: "root", input: "/./", unix: "/", win: "/"},
+	}
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.name, func(t *testing.T) {
+			if out, _ := normalisePath(tt.input); out != tt.unix {
+				t.Errorf("normalisePath: want %q, got %q", tt.unix, out)
+			}
+			if out, _ := normalisePathWin(tt.input); out != tt.win {
+				t.Errorf("normalisePathWin: want %q, got %q", tt.win, out)
+			}
+		})
+	}
+}
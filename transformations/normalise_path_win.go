@@ -9,6 +9,7 @@ import (
 )
 
 func normalisePathWin(data string) (string, error) {
+	data = decodePath(data)
 	leng := len(data)
 	cl := clean(data)
 	cl = strings.ReplaceAll(cl, "\\", "/")
@@ -18,7 +19,7 @@ func normalisePathWin(data string) (string, error) {
 	if leng >= 2 && cl[0] == '.' && cl[1] == '/' {
 		cl = cl[2:]
 	}
-	if data[leng-1] == '\\' {
+	if isPathSeparator(data[leng-1]) && cl != "/" {
 		return cl + "/", nil
 	}
 	return cl, nil
@@ -99,8 +100,9 @@ func clean(path string) string {
 	return filepath.FromSlash(out.string())
 }
 
+// isPathSeparator accepts both separators, the paths can mix them
 func isPathSeparator(c uint8) bool {
-	return c == '\\'
+	return c == '\\' || c == '/'
 }
 
 func volumeNameLen(path string) int {
@@ -0,0 +1,52 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+// hasOddParity returns true if the 7 lower bits of c contain
+// an odd number of ones
+func hasOddParity(c byte) bool {
+	c &= 0x7f
+	c ^= c >> 4
+	c &= 0xf
+	return (0x6996>>c)&1 == 1
+}
+
+// parity7bit applies fn to every byte of data
+func parity7bit(data string, fn func(byte) byte) string {
+	res := make([]byte, len(data))
+	for i := 0; i < len(data); i++ {
+		res[i] = fn(data[i])
+	}
+	return string(res)
+}
+
+// parityEven7bit calculates even parity of 7-bit data replacing the
+// 8th bit of each target byte with the calculated parity bit
+func parityEven7bit(data string) (string, error) {
+	return parity7bit(data, func(c byte) byte {
+		if hasOddParity(c) {
+			return c | 0x80
+		}
+		return c & 0x7f
+	}), nil
+}
+
+// parityOdd7bit calculates odd parity of 7-bit data replacing the
+// 8th bit of each target byte with the calculated parity bit
+func parityOdd7bit(data string) (string, error) {
+	return parity7bit(data, func(c byte) byte {
+		if hasOddParity(c) {
+			return c & 0x7f
+		}
+		return c | 0x80
+	}), nil
+}
+
+// parityZero7bit sets the 8th bit of every byte to zero, it can be
+// used to detect attacks after a parity transformation was applied
+func parityZero7bit(data string) (string, error) {
+	return parity7bit(data, func(c byte) byte {
+		return c & 0x7f
+	}), nil
+}
@@ -0,0 +1,26 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import "github.com/corazawaf/coraza/v3/internal/strings"
+
+// sqlHexDecode decodes SQL hex literals like 0x414243 found in the
+// data, the rest of the data is kept untouched
+func sqlHexDecode(data string) (string, error) {
+	res := make([]byte, 0, len(data))
+	for i := 0; i < len(data); {
+		if data[i] == '0' && i+3 < len(data) && (data[i+1] == 'x' || data[i+1] == 'X') &&
+			strings.ValidHex(data[i+2]) && strings.ValidHex(data[i+3]) {
+			i += 2
+			for i+1 < len(data) && strings.ValidHex(data[i]) && strings.ValidHex(data[i+1]) {
+				res = append(res, strings.X2c(data[i:]))
+				i += 2
+			}
+			continue
+		}
+		res = append(res, data[i])
+		i++
+	}
+	return strings.WrapUnsafe(res), nil
+}
@@ -0,0 +1,24 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import "testing"
+
+func TestSQLHexDecode(t *testing.T) {
+	tests := map[string]string{
+		"":                                "",
+		"no hex":                          "no hex",
+		"SELECT 0x414243":                 "SELECT ABC",
+		"a=0x61646d696e AND b=0X6F72":     "a=admin AND b=or",
+		"0x4":                             "0x4",
+		"0xZZ":                            "0xZZ",
+		"0x41424":                         "AB4",
+		"UNION SELECT 0x3c7363726970743e": "UNION SELECT <script>",
+	}
+	for in, want := range tests {
+		if got, _ := sqlHexDecode(in); got != want {
+			t.Errorf("unexpected output for %q: %q", in, got)
+		}
+	}
+}
@@ -29,10 +29,13 @@ func GetTransformation(name string) (rules.Transformation, error) {
 
 func init() {
 	RegisterPlugin("base64Decode", base64decode)
+	RegisterPlugin("base64DecodeExt", base64decodeExt)
+	RegisterPlugin("base64Encode", base64encode)
 	RegisterPlugin("cmdLine", cmdLine)
 	RegisterPlugin("compressWhitespace", compressWhitespace)
 	RegisterPlugin("cssDecode", cssDecode)
 	RegisterPlugin("escapeSeqDecode", escapeSeqDecode)
+	RegisterPlugin("hexDecode", hexDecode)
 	RegisterPlugin("hexEncode", hexEncode)
 	RegisterPlugin("htmlEntityDecode", htmlEntityDecode)
 	RegisterPlugin("jsDecode", jsDecode)
@@ -44,6 +47,9 @@ func init() {
 	RegisterPlugin("normalisePathWin", normalisePathWin)
 	RegisterPlugin("normalizePath", normalisePath)
 	RegisterPlugin("normalizePathWin", normalisePathWin)
+	RegisterPlugin("parityEven7bit", parityEven7bit)
+	RegisterPlugin("parityOdd7bit", parityOdd7bit)
+	RegisterPlugin("parityZero7bit", parityZero7bit)
 	RegisterPlugin("removeComments", removeComments)
 	RegisterPlugin("removeCommentsChar", removeCommentsChar)
 	RegisterPlugin("removeNulls", removeNulls)
@@ -51,6 +57,11 @@ func init() {
 	RegisterPlugin("replaceComments", replaceComments)
 	RegisterPlugin("replaceNulls", replaceNulls)
 	RegisterPlugin("sha1", sha1T)
+	RegisterPlugin("sqlHexDecode", sqlHexDecode)
+	RegisterPlugin("trim", trim)
+	RegisterPlugin("trimLeft", trimLeft)
+	RegisterPlugin("trimRight", trimRight)
+	RegisterPlugin("uppercase", upperCase)
 	RegisterPlugin("urlDecode", urlDecode)
 	RegisterPlugin("urlDecodeUni", urlDecodeUni)
 	RegisterPlugin("urlEncode", urlEncode)
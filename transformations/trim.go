@@ -0,0 +1,22 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import "strings"
+
+// spaces are the characters removed by the trim transformations,
+// they match the C isspace function used by ModSecurity
+const spaces = " \t\n\v\f\r"
+
+func trim(data string) (string, error) {
+	return strings.Trim(data, spaces), nil
+}
+
+func trimLeft(data string) (string, error) {
+	return strings.TrimLeft(data, spaces), nil
+}
+
+func trimRight(data string) (string, error) {
+	return strings.TrimRight(data, spaces), nil
+}
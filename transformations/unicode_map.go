@@ -0,0 +1,86 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/corazawaf/coraza/v3/rules"
+)
+
+// UnicodeMap maps the %u encoded code points decoded by urlDecodeUni to
+// bytes. Every WAF owns one, it is set while the WAF is configured and
+// only read by the transformations.
+type UnicodeMap struct {
+	m map[uint16]byte
+}
+
+// Set replaces the mapping, a nil map restores the default behavior of
+// keeping the lower byte
+func (u *UnicodeMap) Set(m map[uint16]byte) {
+	u.m = m
+}
+
+func (u *UnicodeMap) lookup(code uint16) (byte, bool) {
+	if u == nil {
+		return 0, false
+	}
+	b, ok := u.m[code]
+	return b, ok
+}
+
+// URLDecodeUni returns the urlDecodeUni transformation converting the %u
+// encoded code points with m, the registered urlDecodeUni doesn't map
+// them
+func URLDecodeUni(m *UnicodeMap) rules.Transformation {
+	return func(data string) (string, error) {
+		return urlDecodeUniMap(data, m)
+	}
+}
+
+// ParseUnicodeMap reads the mapping of a code page from a file in the
+// ModSecurity unicode.mapping format, where every code page starts with
+// a line like "20127 (US-ASCII)" followed by code:byte hex pairs like
+// "ff01:21 ff02:22".
+func ParseUnicodeMap(r io.Reader, codePage int) (map[uint16]byte, error) {
+	m := map[uint16]byte{}
+	found, inPage := false, false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if first, _, _ := strings.Cut(line, " "); !strings.Contains(first, ":") {
+			// code page header
+			cp, err := strconv.Atoi(first)
+			inPage = err == nil && cp == codePage
+			found = found || inPage
+			continue
+		}
+		if !inPage {
+			continue
+		}
+		for _, pair := range strings.Fields(line) {
+			code, b, ok := strings.Cut(pair, ":")
+			c, err1 := strconv.ParseUint(code, 16, 16)
+			v, err2 := strconv.ParseUint(b, 16, 8)
+			if !ok || err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("invalid unicode mapping %q", pair)
+			}
+			m[uint16(c)] = byte(v)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("code page %d not found", codePage)
+	}
+	return m, nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import (
+	"strings"
+	"testing"
+)
+
+const testUnicodeMapping = `
+1252 (ANSI - Latin I)
+00a0:20 2018:27
+
+20127 (US-ASCII)
+00a0:20 00a2:63
+2039:3c 203a:3e
+`
+
+func TestParseUnicodeMap(t *testing.T) {
+	m, err := ParseUnicodeMap(strings.NewReader(testUnicodeMapping), 20127)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint16]byte{0x00a0: 0x20, 0x00a2: 0x63, 0x2039: 0x3c, 0x203a: 0x3e}
+	if len(m) != len(want) {
+		t.Fatalf("unexpected mapping %v", m)
+	}
+	for k, v := range want {
+		if m[k] != v {
+			t.Errorf("unexpected mapping for %04x: %02x", k, m[k])
+		}
+	}
+
+	if _, err := ParseUnicodeMap(strings.NewReader(testUnicodeMapping), 1); err == nil {
+		t.Error("expected error for missing code page")
+	}
+	if _, err := ParseUnicodeMap(strings.NewReader("1 (test)\nzz:20\n"), 1); err == nil {
+		t.Error("expected error for invalid mapping")
+	}
+}
+
+func TestURLDecodeUniWithUnicodeMap(t *testing.T) {
+	m, err := ParseUnicodeMap(strings.NewReader(testUnicodeMapping), 20127)
+	if err != nil {
+		t.Fatal(err)
+	}
+	um := &UnicodeMap{}
+	um.Set(m)
+	decode := URLDecodeUni(um)
+
+	tests := map[string]string{
+		// best fit mappings of the code page
+		"%u2039script%u203a": "<script>",
+		"%u00a2at":           "cat",
+		// full width characters keep the default mapping
+		"%uff1cscript%uff1e": "<script>",
+		"%u0041":             "A",
+	}
+	for in, want := range tests {
+		if got, _ := decode(in); got != want {
+			t.Errorf("unexpected output for %q: %q", in, got)
+		}
+	}
+
+	if got, _ := urlDecodeUni("%u2039"); got != "9" {
+		t.Errorf("expected the lower byte without mapping, got %q", got)
+	}
+	um.Set(nil)
+	if got, _ := decode("%u2039"); got != "9" {
+		t.Errorf("expected the lower byte once the mapping is removed, got %q", got)
+	}
+}
@@ -0,0 +1,12 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package transformations
+
+import (
+	"strings"
+)
+
+func upperCase(data string) (string, error) {
+	return strings.ToUpper(data), nil
+}
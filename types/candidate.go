@@ -0,0 +1,24 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+// RuleSetDiff reports the divergences between the active ruleset and a
+// candidate ruleset evaluated in shadow mode for the same transaction
+type RuleSetDiff struct {
+	// TransactionID is the ID of the evaluated transaction
+	TransactionID string
+
+	// ActiveOnly contains the IDs of the rules matched only by the active ruleset
+	ActiveOnly []int
+
+	// CandidateOnly contains the IDs of the rules matched only by the candidate ruleset
+	CandidateOnly []int
+
+	// ActiveInterruption is the interruption triggered by the active ruleset, if any
+	ActiveInterruption *Interruption
+
+	// CandidateInterruption is the interruption the candidate ruleset would
+	// have triggered, candidate rulesets never interrupt transactions
+	CandidateInterruption *Interruption
+}
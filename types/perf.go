@@ -0,0 +1,38 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import "time"
+
+// PerfStats contains the time spent evaluating the rules of a transaction
+type PerfStats struct {
+	// Phases contains the cumulative duration of each evaluated phase
+	Phases map[RulePhase]time.Duration
+
+	// Combined is the sum of the duration of all phases
+	Combined time.Duration
+
+	// Rules contains the cumulative duration of each rule by ID, rules
+	// are only timed when the WAF rule performance threshold is set and
+	// only rules exceeding it are included
+	Rules map[int]time.Duration
+}
+
+// RuleStats contains the rule matches counted by a WAF since it was
+// created, in every rule engine mode
+type RuleStats struct {
+	// Rules contains the matches of each rule by ID
+	Rules map[int]uint64
+
+	// Tags contains the matches of the rules having each tag
+	Tags map[string]uint64
+
+	// Phases contains the matches of the rules of each phase
+	Phases map[RulePhase]uint64
+
+	// Skipped contains the evaluations of each rule skipped because its
+	// targets were empty, like the ARGS_POST rules of a request without
+	// body
+	Skipped map[int]uint64
+}
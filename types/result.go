@@ -0,0 +1,52 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+// Result is the verdict of a transaction, connectors and access logs can
+// record it instead of inspecting the transaction
+type Result struct {
+	// Action is the action of the interruption, like deny, or pass if the
+	// transaction was not interrupted
+	Action string
+
+	// Status is the status of the interruption, 0 if the transaction was
+	// not interrupted
+	Status int
+
+	// RuleID is the ID of the interrupting rule, it is 0 if the
+	// transaction was not interrupted or if it was interrupted by the
+	// engine, like for the body limits
+	RuleID int
+
+	// RuleEngine is the rule engine status of the transaction, the
+	// disruptive rules don't interrupt it in DetectionOnly
+	RuleEngine RuleEngineStatus
+
+	// InboundAnomalyScore and OutboundAnomalyScore are the blocking anomaly
+	// scores of the CRS, AnomalyScore is their sum. They are 0 without CRS.
+	AnomalyScore         int
+	InboundAnomalyScore  int
+	OutboundAnomalyScore int
+
+	// MatchedRules contains the matched rules in match order
+	MatchedRules []ResultRule
+
+	// Perf contains the time spent evaluating each phase
+	Perf PerfStats
+
+	// RequestBodyTruncated and ResponseBodyTruncated are true if the
+	// bodies exceeded their limit and were partially inspected
+	RequestBodyTruncated  bool
+	ResponseBodyTruncated bool
+}
+
+// ResultRule is a matched rule of a Result
+type ResultRule struct {
+	ID    int
+	Phase RulePhase
+	// Severity is only meaningful if HasSeverity is true
+	Severity    RuleSeverity
+	HasSeverity bool
+	Disruptive  bool
+}
@@ -14,12 +14,21 @@ type MatchData interface {
 	Variable() variables.RuleVariable
 	// Key of the variable, blank if no key is required
 	Key() string
-	// Value of the current VARIABLE:KEY
+	// Value of the current VARIABLE:KEY, for matched rules it is the
+	// value after the transformations, the one the operator matched
 	Value() string
+	// RawValue is the value of the variable before the transformations
+	RawValue() string
 	// Message is the expanded macro message
 	Message() string
 	// Data is the expanded logdata of the macro
 	Data() string
+	// Captures are the groups captured by the operator when the rule
+	// has the capture action, index 0 is the full match
+	Captures() []string
+	// ChainLevel is 0 for the matches of the chain starter, 1 for the
+	// first chained rule and so on
+	ChainLevel() int
 	// IsNil is used to check whether the MatchData is empty
 	IsNil() bool
 }
@@ -41,11 +50,45 @@ type MatchedRule interface {
 	ServerIPAddress() string
 	// ClientIPAddress is the address of the client
 	ClientIPAddress() string
-	// MatchedDatas is the matched variables.
+	// MatchedDatas is the matched variables, including the matches of
+	// the chained rules
 	MatchedDatas() []MatchData
 
 	Rule() RuleMetadata
+	// Chain returns the chain starter followed by the chained rules, the
+	// index is the ChainLevel of their matches
+	Chain() []RuleMetadata
+	// ChainMatches returns the matched variables of a chain member
+	ChainMatches(level int) []MatchData
 
 	AuditLog(code int) string
 	ErrorLog(code int) string
 }
+
+// ErrorEvent is the structured representation of a matched rule
+// delivered to the error event callback, it avoids parsing the output of
+// MatchedRule.ErrorLog
+type ErrorEvent struct {
+	RuleID int
+	Tags   []string
+	// Severity is only meaningful if HasSeverity is true, rules without
+	// the severity action have no severity
+	Severity    RuleSeverity
+	HasSeverity bool
+	// Message and Data are the macro expanded msg and logdata
+	Message string
+	Data    string
+	// Variable, Key and Value describe the first matched variable
+	Variable string
+	Key      string
+	Value    string
+	// MatchedDatas contains every matched variable, including the chained
+	// rules
+	MatchedDatas  []MatchData
+	Disruptive    bool
+	TransactionID string
+	ClientIP      string
+	URI           string
+	// MatchedRule is the match the event was created from
+	MatchedRule MatchedRule
+}
@@ -0,0 +1,49 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import "time"
+
+// RuleTrace records the evaluation of a rule, traces are only
+// generated after calling Transaction.EnableTracing
+type RuleTrace struct {
+	// RuleID is the ID of the evaluated rule
+	RuleID int
+
+	// Phase in which the rule was evaluated
+	Phase RulePhase
+
+	// Variables contains the values inspected by the rule and its chains
+	Variables []VariableTrace
+
+	// Matched is true if the rule and its chains matched
+	Matched bool
+
+	// Actions contains the names of the executed actions
+	Actions []string
+
+	// Duration of the rule evaluation
+	Duration time.Duration
+}
+
+// VariableTrace records the evaluation of the operator against a value
+type VariableTrace struct {
+	// Variable is the name of the variable, like ARGS
+	Variable string
+
+	// Key of the variable, blank if the variable has no key
+	Key string
+
+	// Value before transformations
+	Value string
+
+	// TransformedValue is the value the operator was evaluated against
+	TransformedValue string
+
+	// Operator is the operator and its arguments, like @rx ^a
+	Operator string
+
+	// Matched is the result of the operator
+	Matched bool
+}
@@ -4,7 +4,9 @@
 package types
 
 import (
+	"crypto/x509"
 	"io"
+	"time"
 )
 
 // ArgumentType is used to define types of argument for transactions
@@ -30,12 +32,43 @@ const (
 // It is safe to manage multiple transactions but transactions themself are not
 // thread safe
 type Transaction interface {
+	// ID returns the ID of the transaction, it is the ID passed to
+	// NewTransactionWithID or the one returned by the ID generator
+	ID() string
+
 	// ProcessConnection should be called at very beginning of a request process, it is
 	// expected to be executed prior to the virtual host resolution, when the
 	// connection arrives on the server.
 	// Important: Remember to check for a possible intervention.
 	ProcessConnection(client string, cPort int, server string, sPort int)
 
+	// SetTLSFingerprint sets the fingerprints of the TLS client hello for
+	// connectors terminating TLS, it must be called before
+	// ProcessRequestHeaders. ja3 is the JA3 string, like
+	// 771,4865-4866,0-23-65281,29-23,0, or its MD5 hash, ja4 is the JA4
+	// fingerprint. Empty fingerprints are ignored.
+	SetTLSFingerprint(ja3 string, ja4 string)
+
+	// SetClientCertificate sets the SSL_CLIENT variables from the
+	// certificate presented by the client for connectors terminating mTLS,
+	// it must be called before ProcessRequestHeaders. verifyErr is the
+	// result of the chain verification, SSL_CLIENT_VERIFY is SUCCESS if it
+	// is nil, FAILED:reason otherwise and NONE without certificate.
+	SetClientCertificate(cert *x509.Certificate, verifyErr error)
+
+	// SetRequestStartTime sets when the connector started receiving the
+	// request, REQUEST_BODY_DURATION is measured from it. Without it the
+	// duration is measured from the first request body chunk.
+	SetRequestStartTime(t time.Time)
+
+	// NotifyBodyChunk records a request body chunk of size bytes received
+	// by the connector at t, it sets the REQUEST_BODY_DURATION,
+	// REQUEST_BODY_CHUNKS, REQUEST_BODY_CHUNK_INTERVAL and
+	// REQUEST_BODY_CHUNK_SIZE variables so rules can flag slow body
+	// attacks. The chunk must still be written with WriteRequestBody or
+	// ReadRequestBodyFrom.
+	NotifyBodyChunk(size int, t time.Time)
+
 	// ProcessURI Performs the analysis on the URI and all the query string variables.
 	// This method should be called at very beginning of a request process, it is
 	// expected to be executed prior to the virtual host resolution, when the
@@ -66,6 +99,10 @@ type Transaction interface {
 	// RequestBodyReader returns a reader for content that has been written by
 	// request body buffer. This can be useful for buffering the request body
 	// within the Transaction while also passing it further in an HTTP framework.
+	// The reader returns the exact bytes inspected, including the ones spooled
+	// to disk, so connectors don't need their own copy. Each call returns a new
+	// reader starting at the beginning of the body, valid until the transaction
+	// is closed. Readers also implement io.Seeker and io.WriterTo.
 	RequestBodyReader() (io.Reader, error)
 
 	// AddArgument Add arguments GET or POST
@@ -120,6 +157,8 @@ type Transaction interface {
 	// ResponseBodyReader returns a reader for content that has been written by
 	// ResponseBodyWriter. This can be useful for buffering the response body
 	// within the Transaction while also passing it further in an HTTP framework.
+	// Like RequestBodyReader, it reads the buffered body from memory or disk
+	// and is valid until the transaction is closed.
 	ResponseBodyReader() (io.Reader, error)
 
 	// ProcessResponseBody Perform the request body (if any)
@@ -140,6 +179,11 @@ type Transaction interface {
 	// IsRuleEngineOff will return true if RuleEngine is set to Off
 	IsRuleEngineOff() bool
 
+	// SetRuleEngine overrides the rule engine status for this transaction,
+	// for example to enforce the rules only for some clients. It takes
+	// precedence over the WAF sampling policy.
+	SetRuleEngine(status RuleEngineStatus)
+
 	// IsRequestBodyAccessible will return true if RequestBody access has been enabled by RequestBodyAccess
 	//
 	// This can be used to perform checks just before calling request body related functions.
@@ -175,6 +219,32 @@ type Transaction interface {
 	// MatchedRules returns the rules that have matched the requests with associated information.
 	MatchedRules() []MatchedRule
 
+	// EnableTracing records the evaluation of each rule from now on, the trace
+	// can be retrieved with Trace after each phase. Tracing is expensive and
+	// should only be used for debugging and testing.
+	EnableTracing()
+
+	// Trace returns the evaluation trace of the rules evaluated since EnableTracing was called.
+	Trace() []RuleTrace
+
+	// PerfStats returns the time spent evaluating each phase and, when
+	// rule performance tracking is enabled, the slowest rules.
+	PerfStats() PerfStats
+
+	// Result returns the verdict of the transaction: the interruption, the
+	// anomaly scores, the matched rules, the phase timings and whether the
+	// bodies were truncated. It must be called before Close.
+	Result() Result
+
+	// ResponseHeaderMutations returns the response header changes scheduled by
+	// the rules, connectors should apply them before sending the response headers.
+	ResponseHeaderMutations() []HeaderMutation
+
+	// PauseDuration returns the time the connector should delay the transaction
+	// before sending the response, as requested by the pause action. Connectors
+	// must not block the whole server while waiting.
+	PauseDuration() time.Duration
+
 	// Closer closes the transaction and releases any resources associated with it such as request/response bodies.
 	io.Closer
 }
@@ -4,5 +4,6 @@
 package types
 
 // VariablesCount contains the number of variables handled by the variables package
-// It is used to create arrays of the correct size
-const VariablesCount = 92
+// It is used to create arrays of the correct size, it must be bumped
+// with every new variable
+const VariablesCount = 166
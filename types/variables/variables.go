@@ -145,7 +145,7 @@ const (
 	// InboundErrorData will be set to 1 when the request body size
 	// is above the setting configured by SecRequesteBodyLimit
 	InboundErrorData
-	// Duration contains the time in miliseconds from
+	// Duration contains the time in milliseconds from
 	// the beginning of the transaction until this point
 	Duration
 	// ResponseHeadersNames contains the names of the response headers
@@ -225,101 +225,383 @@ const (
 	XML
 	// MultipartPartHeaders contains the multipart headers
 	MultipartPartHeaders
+	// RuleError equals 1 if the evaluation of a rule failed unexpectedly
+	RuleError
+	// RuleErrorMsg contains the error message of the last failed rule evaluation
+	RuleErrorMsg
+	// Global is a collection created on demand by setvar, it is not persisted
+	Global
+	// Session is a collection created on demand by setvar, it is not persisted
+	Session
+	// User is a collection created on demand by setvar, it is not persisted
+	User
+	// Resource is a collection created on demand by setvar, it is not persisted
+	Resource
+	// Time is the current local time formatted as hh:mm:ss
+	Time
+	// TimeDay is the current day of the month (01-31)
+	TimeDay
+	// TimeEpoch is the number of seconds since the unix epoch
+	TimeEpoch
+	// TimeHour is the current hour (00-23)
+	TimeHour
+	// TimeMin is the current minute (00-59)
+	TimeMin
+	// TimeMon is the current month (0-11)
+	TimeMon
+	// TimeSec is the current second (00-59)
+	TimeSec
+	// TimeWday is the current day of the week (0-6), starting on Sunday
+	TimeWday
+	// TimeYear is the current year (yyyy)
+	TimeYear
+	// PerfPhase1 is the time in microseconds spent evaluating phase 1
+	PerfPhase1
+	// PerfPhase2 is the time in microseconds spent evaluating phase 2
+	PerfPhase2
+	// PerfPhase3 is the time in microseconds spent evaluating phase 3
+	PerfPhase3
+	// PerfPhase4 is the time in microseconds spent evaluating phase 4
+	PerfPhase4
+	// PerfPhase5 is the time in microseconds spent evaluating phase 5
+	PerfPhase5
+	// PerfCombined is the time in microseconds spent evaluating all phases
+	PerfCombined
+	// PerfRules contains the time in microseconds spent by each rule
+	// exceeding SecRulePerfTime, keyed by rule ID
+	PerfRules
+	// RequestHeadersRaw contains the request headers in the order they were
+	// received and with their original casing, one "Name: value" per line
+	RequestHeadersRaw
+	// RequestCookiesError equals 1 if a request cookie is malformed
+	RequestCookiesError
+	// RequestCookiesErrorMsg describes the first malformed request cookie
+	RequestCookiesErrorMsg
+	// AccessListAction is the action of the access list entry matching
+	// the request, allow or deny
+	AccessListAction
+	// AccessListEntry is the ID of the access list entry matching the
+	// request
+	AccessListEntry
+	// MemoryLimitExceeded equals 1 if the request data exceeded the
+	// transaction memory limit and some values were discarded
+	MemoryLimitExceeded
+	// StreamInputBody contains the raw request body when
+	// SecStreamInBodyInspection is enabled, changes to it are written
+	// back to the request body
+	StreamInputBody
+	// StreamOutputBody contains the raw response body when
+	// SecStreamOutBodyInspection is enabled, changes to it are written
+	// back to the response body
+	StreamOutputBody
+	// ResponseBodyDecompressionError equals 1 if the response body could
+	// not be decompressed or exceeded the decompression ratio, like
+	// decompression bombs do
+	ResponseBodyDecompressionError
+	// RequestBodyDecompressionError equals 1 if the request body could not
+	// be decompressed or exceeded the decompression ratio
+	RequestBodyDecompressionError
+	// RequestPseudoHeaders contains the HTTP/2 and HTTP/3 pseudo headers
+	// of the request without the leading colon, like authority and path
+	RequestPseudoHeaders
+	// RequestProtocolAnomalies contains the ambiguities found between the
+	// pseudo headers, the request line and the headers, like a Host header
+	// different from :authority, keyed by name
+	RequestProtocolAnomalies
+	// RequestSOAP contains the summary of a SOAP envelope parsed by the
+	// XML body processor, like the version, the operation, the fault and
+	// the WS-Security header, keyed by name
+	RequestSOAP
+	// RequestXMLAnomalies contains the problems found by the XML body
+	// processor that don't prevent parsing it, like exceeding the depth
+	// limit or a SOAPAction different from the operation, keyed by name
+	RequestXMLAnomalies
+	// OpenAPIOperation is the operationId of the OpenAPI operation matching
+	// the request, or its method and path template
+	OpenAPIOperation
+	// OpenAPIViolations contains the locations of the request not allowed
+	// by the OpenAPI specification, keyed by kind like unknown_path or
+	// type_mismatch
+	OpenAPIViolations
+	// RequestCookiesTampered contains the values of the signed request
+	// cookies not matching their signature, keyed by name
+	RequestCookiesTampered
+	// RequestCookiesUnsigned contains the values of the signed request
+	// cookies sent without signature, keyed by name
+	RequestCookiesUnsigned
+	// CSRFToken is the CSRF token of the session, set if SESSIONID is set
+	// and SecCSRFProtection is On
+	CSRFToken
+	// CSRFError is set to 1 if a state changing request of a session
+	// carries no CSRF token or an invalid one
+	CSRFError
+	// CSRFErrorMsg describes the CSRF error
+	CSRFErrorMsg
+	// TLSJA3 is the JA3 string of the TLS client hello set by the connector
+	TLSJA3
+	// TLSJA3Hash is the MD5 hash of the JA3 string
+	TLSJA3Hash
+	// TLSJA4 is the JA4 fingerprint of the TLS client hello set by the
+	// connector
+	TLSJA4
+	// SSLClientVerify is the result of the client certificate
+	// verification, NONE, SUCCESS or FAILED:reason
+	SSLClientVerify
+	// SSLClientSDN is the subject distinguished name of the client
+	// certificate
+	SSLClientSDN
+	// SSLClientSDNCN is the common name of the client certificate subject
+	SSLClientSDNCN
+	// SSLClientIDN is the issuer distinguished name of the client
+	// certificate
+	SSLClientIDN
+	// SSLClientMSerial is the hex encoded serial of the client certificate
+	SSLClientMSerial
+	// SSLClientVStart is the start of the client certificate validity,
+	// like Jan  2 15:04:05 2006 GMT
+	SSLClientVStart
+	// SSLClientVEnd is the end of the client certificate validity
+	SSLClientVEnd
+	// SSLClientVRemain is the number of days until the client certificate
+	// expires, negative if it expired
+	SSLClientVRemain
+	// SSLClientSAN contains the subject alternative names of the client
+	// certificate, keyed by type: dns, email, ip and uri
+	SSLClientSAN
+	// ProfileViolation contains the deviations of the request from the
+	// learned endpoint profile, keyed by kind, the values are the
+	// locations like query.id
+	ProfileViolation
+	// HoneypotPath is the trap path requested by the client, see
+	// SecHoneypotPath
+	HoneypotPath
+	// HoneypotFields contains the decoy form fields submitted with a value,
+	// keyed by name, see SecHoneypotField
+	HoneypotFields
+	// RequestURILowercase is REQUEST_URI lowercased, it is computed once
+	// per request instead of by the rules using t:lowercase
+	RequestURILowercase
+	// RequestFilenameDecoded is REQUEST_FILENAME decoded like
+	// t:urlDecodeUni, including the %u encoding and the remaining
+	// double encoding
+	RequestFilenameDecoded
+	// RequestFilenameNormalized is REQUEST_FILENAME_DECODED normalized
+	// like t:normalizePathWin, without dot segments, repeated separators
+	// and evasion encodings, backslashes are separators too
+	RequestFilenameNormalized
+	// PathNormalizationChanged equals 1 if the normalization changed
+	// REQUEST_FILENAME_DECODED, 0 otherwise. Browsers send normalized
+	// paths, a change is a strong sign of path traversal.
+	PathNormalizationChanged
+	// RequestURIScheme is the scheme of an absolute-form request target,
+	// like http in GET http://example.com/ HTTP/1.1
+	RequestURIScheme
+	// RequestURIHost is the host and port of an absolute-form request
+	// target or the authority-form target of a CONNECT request
+	RequestURIHost
+	// RequestURIUserinfo is the userinfo of an absolute-form request
+	// target, like user:password, it is deprecated for HTTP
+	RequestURIUserinfo
+	// RequestURIFragment is the fragment of the request target starting
+	// with #, browsers don't send it and it is removed from REQUEST_URI
+	RequestURIFragment
+	// RequestURIExtraQuery is the part of the request target starting with
+	// its second ?, it is also part of QUERY_STRING and of the last
+	// argument before it
+	RequestURIExtraQuery
+	// ConnConcurrent is the number of transactions of the client address
+	// being processed, including this one, it is set if SecConnEngine is
+	// not Off
+	ConnConcurrent
+	// ConnRate is the number of transactions started by the client address
+	// within the window of SecConnRateLimit
+	ConnRate
+	// ConnLimitExceeded is 1 if the client address exceeded the limits of
+	// the connection engine
+	ConnLimitExceeded
+	// RequestBodyDuration is the number of milliseconds between the start of
+	// the request and the last request body chunk notified by the connector
+	RequestBodyDuration
+	// RequestBodyChunks is the number of request body chunks notified by
+	// the connector
+	RequestBodyChunks
+	// RequestBodyChunkInterval is the average number of milliseconds between
+	// two request body chunks, slow body attacks send small chunks at long
+	// intervals
+	RequestBodyChunkInterval
+	// RequestBodyChunkSize is the average size of the request body chunks
+	// notified by the connector
+	RequestBodyChunkSize
+	// new variables must bump types.VariablesCount
 )
 
 var rulemap = map[RuleVariable]string{
-	Unknown:                       "UNKNOWN",
-	UrlencodedError:               "URLENCODED_ERROR",
-	ResponseContentType:           "RESPONSE_CONTENT_TYPE",
-	UniqueID:                      "UNIQUE_ID",
-	ArgsCombinedSize:              "ARGS_COMBINED_SIZE",
-	AuthType:                      "AUTH_TYPE",
-	FilesCombinedSize:             "FILES_COMBINED_SIZE",
-	FullRequest:                   "FULL_REQUEST",
-	FullRequestLength:             "FULL_REQUEST_LENGTH",
-	InboundDataError:              "INBOUND_DATA_ERROR",
-	MatchedVar:                    "MATCHED_VAR",
-	MatchedVarName:                "MATCHED_VAR_NAME",
-	MultipartBoundaryQuoted:       "MULTIPART_BOUNDARY_QUOTED",
-	MultipartBoundaryWhitespace:   "MULTIPART_BOUNDARY_WHITESPACE",
-	MultipartCrlfLfLines:          "MULTIPART_CRLF_LF_LINES",
-	MultipartDataAfter:            "MULTIPART_DATA_AFTER",
-	MultipartDataBefore:           "MULTIPART_DATA_BEFORE",
-	MultipartFileLimitExceeded:    "MULTIPART_FILE_LIMIT_EXCEEDED",
-	MultipartHeaderFolding:        "MULTIPART_HEADER_FOLDING",
-	MultipartInvalidHeaderFolding: "MULTIPART_INVALID_HEADER_FOLDING",
-	MultipartInvalidPart:          "MULTIPART_INVALID_PART",
-	MultipartInvalidQuoting:       "MULTIPART_INVALID_QUOTING",
-	MultipartLfLine:               "MULTIPART_LF_LINE",
-	MultipartMissingSemicolon:     "MULTIPART_MISSING_SEMICOLON",
-	MultipartStrictError:          "MULTIPART_STRICT_ERROR",
-	MultipartUnmatchedBoundary:    "MULTIPART_UNMATCHED_BOUNDARY",
-	OutboundDataError:             "OUTBOUND_DATA_ERROR",
-	PathInfo:                      "PATH_INFO",
-	QueryString:                   "QUERY_STRING",
-	RemoteAddr:                    "REMOTE_ADDR",
-	RemoteHost:                    "REMOTE_HOST",
-	RemotePort:                    "REMOTE_PORT",
-	ReqbodyError:                  "REQBODY_ERROR",
-	ReqbodyErrorMsg:               "REQBODY_ERROR_MSG",
-	ReqbodyProcessorError:         "REQBODY_PROCESSOR_ERROR",
-	ReqbodyProcessorErrorMsg:      "REQBODY_PROCESSOR_ERROR_MSG",
-	ReqbodyProcessor:              "REQBODY_PROCESSOR",
-	RequestBasename:               "REQUEST_BASENAME",
-	RequestBody:                   "REQUEST_BODY",
-	RequestBodyLength:             "REQUEST_BODY_LENGTH",
-	RequestFilename:               "REQUEST_FILENAME",
-	RequestLine:                   "REQUEST_LINE",
-	RequestMethod:                 "REQUEST_METHOD",
-	RequestProtocol:               "REQUEST_PROTOCOL",
-	RequestURI:                    "REQUEST_URI",
-	RequestURIRaw:                 "REQUEST_URI_RAW",
-	ResponseBody:                  "RESPONSE_BODY",
-	ResponseContentLength:         "RESPONSE_CONTENT_LENGTH",
-	ResponseProtocol:              "RESPONSE_PROTOCOL",
-	ResponseStatus:                "RESPONSE_STATUS",
-	ServerAddr:                    "SERVER_ADDR",
-	ServerName:                    "SERVER_NAME",
-	ServerPort:                    "SERVER_PORT",
-	Sessionid:                     "SESSIONID",
-	HighestSeverity:               "HIGHEST_SEVERITY",
-	StatusLine:                    "STATUS_LINE",
-	InboundErrorData:              "INBOUND_ERROR_DATA",
-	Duration:                      "DURATION",
-	ResponseHeadersNames:          "RESPONSE_HEADERS_NAMES",
-	RequestHeadersNames:           "REQUEST_HEADERS_NAMES",
-	Userid:                        "USERID",
-	Args:                          "ARGS",
-	ArgsGet:                       "ARGS_GET",
-	ArgsPost:                      "ARGS_POST",
-	ArgsPath:                      "ARGS_PATH",
-	FilesSizes:                    "FILES_SIZES",
-	FilesNames:                    "FILES_NAMES",
-	FilesTmpContent:               "FILES_TMP_CONTENT",
-	MultipartFilename:             "MULTIPART_FILENAME",
-	MultipartName:                 "MULTIPART_NAME",
-	MatchedVarsNames:              "MATCHED_VARS_NAMES",
-	MatchedVars:                   "MATCHED_VARS",
-	Files:                         "FILES",
-	RequestCookies:                "REQUEST_COOKIES",
-	RequestHeaders:                "REQUEST_HEADERS",
-	ResponseHeaders:               "RESPONSE_HEADERS",
-	Geo:                           "GEO",
-	RequestCookiesNames:           "REQUEST_COOKIES_NAMES",
-	FilesTmpNames:                 "FILES_TMPNAMES",
-	ArgsNames:                     "ARGS_NAMES",
-	ArgsGetNames:                  "ARGS_GET_NAMES",
-	ArgsPostNames:                 "ARGS_POST_NAMES",
-	TX:                            "TX",
-	Rule:                          "RULE",
-	XML:                           "XML",
-	JSON:                          "JSON",
-	Env:                           "ENV",
-	IP:                            "IP",
-	RequestXML:                    "REQUEST_XML",
-	ResponseXML:                   "RESPONSE_XML",
-	ResponseArgs:                  "RESPONSE_ARGS",
-	MultipartPartHeaders:          "MULTIPART_PART_HEADERS",
+	Unknown:                        "UNKNOWN",
+	UrlencodedError:                "URLENCODED_ERROR",
+	ResponseContentType:            "RESPONSE_CONTENT_TYPE",
+	UniqueID:                       "UNIQUE_ID",
+	ArgsCombinedSize:               "ARGS_COMBINED_SIZE",
+	AuthType:                       "AUTH_TYPE",
+	FilesCombinedSize:              "FILES_COMBINED_SIZE",
+	FullRequest:                    "FULL_REQUEST",
+	FullRequestLength:              "FULL_REQUEST_LENGTH",
+	InboundDataError:               "INBOUND_DATA_ERROR",
+	MatchedVar:                     "MATCHED_VAR",
+	MatchedVarName:                 "MATCHED_VAR_NAME",
+	MultipartBoundaryQuoted:        "MULTIPART_BOUNDARY_QUOTED",
+	MultipartBoundaryWhitespace:    "MULTIPART_BOUNDARY_WHITESPACE",
+	MultipartCrlfLfLines:           "MULTIPART_CRLF_LF_LINES",
+	MultipartDataAfter:             "MULTIPART_DATA_AFTER",
+	MultipartDataBefore:            "MULTIPART_DATA_BEFORE",
+	MultipartFileLimitExceeded:     "MULTIPART_FILE_LIMIT_EXCEEDED",
+	MultipartHeaderFolding:         "MULTIPART_HEADER_FOLDING",
+	MultipartInvalidHeaderFolding:  "MULTIPART_INVALID_HEADER_FOLDING",
+	MultipartInvalidPart:           "MULTIPART_INVALID_PART",
+	MultipartInvalidQuoting:        "MULTIPART_INVALID_QUOTING",
+	MultipartLfLine:                "MULTIPART_LF_LINE",
+	MultipartMissingSemicolon:      "MULTIPART_MISSING_SEMICOLON",
+	MultipartStrictError:           "MULTIPART_STRICT_ERROR",
+	MultipartUnmatchedBoundary:     "MULTIPART_UNMATCHED_BOUNDARY",
+	OutboundDataError:              "OUTBOUND_DATA_ERROR",
+	PathInfo:                       "PATH_INFO",
+	QueryString:                    "QUERY_STRING",
+	RemoteAddr:                     "REMOTE_ADDR",
+	RemoteHost:                     "REMOTE_HOST",
+	RemotePort:                     "REMOTE_PORT",
+	ReqbodyError:                   "REQBODY_ERROR",
+	ReqbodyErrorMsg:                "REQBODY_ERROR_MSG",
+	ReqbodyProcessorError:          "REQBODY_PROCESSOR_ERROR",
+	ReqbodyProcessorErrorMsg:       "REQBODY_PROCESSOR_ERROR_MSG",
+	ReqbodyProcessor:               "REQBODY_PROCESSOR",
+	RequestBasename:                "REQUEST_BASENAME",
+	RequestBody:                    "REQUEST_BODY",
+	RequestBodyLength:              "REQUEST_BODY_LENGTH",
+	RequestFilename:                "REQUEST_FILENAME",
+	RequestLine:                    "REQUEST_LINE",
+	RequestMethod:                  "REQUEST_METHOD",
+	RequestProtocol:                "REQUEST_PROTOCOL",
+	RequestURI:                     "REQUEST_URI",
+	RequestURIRaw:                  "REQUEST_URI_RAW",
+	ResponseBody:                   "RESPONSE_BODY",
+	ResponseContentLength:          "RESPONSE_CONTENT_LENGTH",
+	ResponseProtocol:               "RESPONSE_PROTOCOL",
+	ResponseStatus:                 "RESPONSE_STATUS",
+	ServerAddr:                     "SERVER_ADDR",
+	ServerName:                     "SERVER_NAME",
+	ServerPort:                     "SERVER_PORT",
+	Sessionid:                      "SESSIONID",
+	HighestSeverity:                "HIGHEST_SEVERITY",
+	StatusLine:                     "STATUS_LINE",
+	InboundErrorData:               "INBOUND_ERROR_DATA",
+	Duration:                       "DURATION",
+	ResponseHeadersNames:           "RESPONSE_HEADERS_NAMES",
+	RequestHeadersNames:            "REQUEST_HEADERS_NAMES",
+	Userid:                         "USERID",
+	Args:                           "ARGS",
+	ArgsGet:                        "ARGS_GET",
+	ArgsPost:                       "ARGS_POST",
+	ArgsPath:                       "ARGS_PATH",
+	FilesSizes:                     "FILES_SIZES",
+	FilesNames:                     "FILES_NAMES",
+	FilesTmpContent:                "FILES_TMP_CONTENT",
+	MultipartFilename:              "MULTIPART_FILENAME",
+	MultipartName:                  "MULTIPART_NAME",
+	MatchedVarsNames:               "MATCHED_VARS_NAMES",
+	MatchedVars:                    "MATCHED_VARS",
+	Files:                          "FILES",
+	RequestCookies:                 "REQUEST_COOKIES",
+	RequestHeaders:                 "REQUEST_HEADERS",
+	ResponseHeaders:                "RESPONSE_HEADERS",
+	Geo:                            "GEO",
+	RequestCookiesNames:            "REQUEST_COOKIES_NAMES",
+	FilesTmpNames:                  "FILES_TMPNAMES",
+	ArgsNames:                      "ARGS_NAMES",
+	ArgsGetNames:                   "ARGS_GET_NAMES",
+	ArgsPostNames:                  "ARGS_POST_NAMES",
+	TX:                             "TX",
+	Rule:                           "RULE",
+	XML:                            "XML",
+	JSON:                           "JSON",
+	Env:                            "ENV",
+	IP:                             "IP",
+	RequestXML:                     "REQUEST_XML",
+	ResponseXML:                    "RESPONSE_XML",
+	ResponseArgs:                   "RESPONSE_ARGS",
+	MultipartPartHeaders:           "MULTIPART_PART_HEADERS",
+	RuleError:                      "RULE_ERROR",
+	RuleErrorMsg:                   "RULE_ERROR_MSG",
+	Global:                         "GLOBAL",
+	Session:                        "SESSION",
+	User:                           "USER",
+	Resource:                       "RESOURCE",
+	Time:                           "TIME",
+	TimeDay:                        "TIME_DAY",
+	TimeEpoch:                      "TIME_EPOCH",
+	TimeHour:                       "TIME_HOUR",
+	TimeMin:                        "TIME_MIN",
+	TimeMon:                        "TIME_MON",
+	TimeSec:                        "TIME_SEC",
+	TimeWday:                       "TIME_WDAY",
+	TimeYear:                       "TIME_YEAR",
+	PerfPhase1:                     "PERF_PHASE1",
+	PerfPhase2:                     "PERF_PHASE2",
+	PerfPhase3:                     "PERF_PHASE3",
+	PerfPhase4:                     "PERF_PHASE4",
+	PerfPhase5:                     "PERF_PHASE5",
+	PerfCombined:                   "PERF_COMBINED",
+	PerfRules:                      "PERF_RULES",
+	RequestHeadersRaw:              "REQUEST_HEADERS_RAW",
+	RequestCookiesError:            "REQUEST_COOKIES_ERROR",
+	RequestCookiesErrorMsg:         "REQUEST_COOKIES_ERROR_MSG",
+	AccessListAction:               "ACCESS_LIST_ACTION",
+	AccessListEntry:                "ACCESS_LIST_ENTRY",
+	MemoryLimitExceeded:            "MEMORY_LIMIT_EXCEEDED",
+	StreamInputBody:                "STREAM_INPUT_BODY",
+	StreamOutputBody:               "STREAM_OUTPUT_BODY",
+	ResponseBodyDecompressionError: "RESPONSE_BODY_DECOMPRESSION_ERROR",
+	RequestBodyDecompressionError:  "REQUEST_BODY_DECOMPRESSION_ERROR",
+	RequestPseudoHeaders:           "REQUEST_PSEUDO_HEADERS",
+	RequestProtocolAnomalies:       "REQUEST_PROTOCOL_ANOMALIES",
+	RequestSOAP:                    "REQUEST_SOAP",
+	RequestXMLAnomalies:            "REQUEST_XML_ANOMALIES",
+	OpenAPIOperation:               "OPENAPI_OPERATION",
+	OpenAPIViolations:              "OPENAPI_VIOLATIONS",
+	RequestCookiesTampered:         "REQUEST_COOKIES_TAMPERED",
+	RequestCookiesUnsigned:         "REQUEST_COOKIES_UNSIGNED",
+	CSRFToken:                      "CSRF_TOKEN",
+	CSRFError:                      "CSRF_ERROR",
+	CSRFErrorMsg:                   "CSRF_ERROR_MSG",
+	TLSJA3:                         "TLS_JA3",
+	TLSJA3Hash:                     "TLS_JA3_HASH",
+	TLSJA4:                         "TLS_JA4",
+	SSLClientVerify:                "SSL_CLIENT_VERIFY",
+	SSLClientSDN:                   "SSL_CLIENT_S_DN",
+	SSLClientSDNCN:                 "SSL_CLIENT_S_DN_CN",
+	SSLClientIDN:                   "SSL_CLIENT_I_DN",
+	SSLClientMSerial:               "SSL_CLIENT_M_SERIAL",
+	SSLClientVStart:                "SSL_CLIENT_V_START",
+	SSLClientVEnd:                  "SSL_CLIENT_V_END",
+	SSLClientVRemain:               "SSL_CLIENT_V_REMAIN",
+	SSLClientSAN:                   "SSL_CLIENT_SAN",
+	ProfileViolation:               "PROFILE_VIOLATION",
+	HoneypotPath:                   "HONEYPOT_PATH",
+	HoneypotFields:                 "HONEYPOT_FIELDS",
+	RequestURILowercase:            "REQUEST_URI_LOWERCASE",
+	RequestFilenameDecoded:         "REQUEST_FILENAME_DECODED",
+	RequestFilenameNormalized:      "REQUEST_FILENAME_NORMALIZED",
+	PathNormalizationChanged:       "PATH_NORMALIZATION_CHANGED",
+	RequestURIScheme:               "REQUEST_URI_SCHEME",
+	RequestURIHost:                 "REQUEST_URI_HOST",
+	RequestURIUserinfo:             "REQUEST_URI_USERINFO",
+	RequestURIFragment:             "REQUEST_URI_FRAGMENT",
+	RequestURIExtraQuery:           "REQUEST_URI_EXTRA_QUERY",
+	ConnConcurrent:                 "CONN_CONCURRENT",
+	ConnRate:                       "CONN_RATE",
+	ConnLimitExceeded:              "CONN_LIMIT_EXCEEDED",
+	RequestBodyDuration:            "REQUEST_BODY_DURATION",
+	RequestBodyChunks:              "REQUEST_BODY_CHUNKS",
+	RequestBodyChunkInterval:       "REQUEST_BODY_CHUNK_INTERVAL",
+	RequestBodyChunkSize:           "REQUEST_BODY_CHUNK_SIZE",
 }
 
 var rulemapRev = map[string]RuleVariable{}
@@ -0,0 +1,21 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"testing"
+
+	"github.com/corazawaf/coraza/v3/types/variables"
+)
+
+func TestVariablesCount(t *testing.T) {
+	// arrays indexed by variable panic if a variable is added without
+	// bumping VariablesCount
+	if last := variables.RequestBodyChunkSize; int(last) != VariablesCount-1 {
+		t.Errorf("VariablesCount is %d, expected %d", VariablesCount, int(last)+1)
+	}
+	if name := variables.RuleVariable(VariablesCount).Name(); name != "INVALID_VARIABLE" {
+		t.Errorf("variable %s is not counted by VariablesCount", name)
+	}
+}
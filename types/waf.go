@@ -97,6 +97,50 @@ func (re RuleEngineStatus) String() string {
 	return "unknown"
 }
 
+// ConnectionEngineStatus represents the functionality
+// of the connection engine.
+type ConnectionEngineStatus int
+
+const (
+	// ConnectionEngineOn tracks the connections of the clients and
+	// interrupts the ones exceeding the limits, whether the rule engine
+	// is On or DetectionOnly
+	ConnectionEngineOn ConnectionEngineStatus = iota
+	// ConnectionEngineDetectionOnly tracks the connections of the clients
+	// but won't interrupt them
+	ConnectionEngineDetectionOnly ConnectionEngineStatus = iota
+	// ConnectionEngineOff will not track the connections
+	ConnectionEngineOff ConnectionEngineStatus = iota
+)
+
+// ParseConnectionEngineStatus parses the connection engine status,
+// DetectOnly is accepted for DetectionOnly
+func ParseConnectionEngineStatus(ce string) (ConnectionEngineStatus, error) {
+	switch strings.ToLower(ce) {
+	case "on":
+		return ConnectionEngineOn, nil
+	case "detectiononly", "detectonly":
+		return ConnectionEngineDetectionOnly, nil
+	case "off":
+		return ConnectionEngineOff, nil
+	}
+	return -1, fmt.Errorf("invalid connection engine status: %s", ce)
+}
+
+// String returns the string representation of the
+// connection engine status
+func (ce ConnectionEngineStatus) String() string {
+	switch ce {
+	case ConnectionEngineOn:
+		return "on"
+	case ConnectionEngineDetectionOnly:
+		return "DetectionOnly"
+	case ConnectionEngineOff:
+		return "off"
+	}
+	return "unknown"
+}
+
 // RequestBodyLimitAction represents the action
 // to take when the request body size exceeds
 // the configured limit.
@@ -122,6 +166,63 @@ func ParseRequestBodyLimitAction(rbla string) (RequestBodyLimitAction, error) {
 	return -1, fmt.Errorf("invalid request body limit action: %s", rbla)
 }
 
+// ServerSignatureMode controls how the signature configured with
+// SecServerSignature changes the Server response header
+type ServerSignatureMode int
+
+const (
+	// ServerSignatureRewrite replaces the Server header sent by the
+	// upstream, responses without it are not changed
+	ServerSignatureRewrite ServerSignatureMode = iota
+	// ServerSignatureInject sets the Server header even if the upstream
+	// didn't send one, it can be used to advertise a decoy server
+	ServerSignatureInject
+	// ServerSignatureRemove removes the Server header, the signature is
+	// ignored
+	ServerSignatureRemove
+)
+
+// ParseServerSignatureMode parses the mode of SecServerSignatureMode
+func ParseServerSignatureMode(mode string) (ServerSignatureMode, error) {
+	switch strings.ToLower(mode) {
+	case "rewrite":
+		return ServerSignatureRewrite, nil
+	case "inject":
+		return ServerSignatureInject, nil
+	case "remove":
+		return ServerSignatureRemove, nil
+	}
+	return -1, fmt.Errorf("invalid server signature mode: %s", mode)
+}
+
+// AuditLogOverflowPolicy controls what an asynchronous audit log writer
+// does with new entries when its queue is full
+type AuditLogOverflowPolicy int
+
+const (
+	// AuditLogOverflowBlock waits until there is room in the queue, the
+	// transaction is delayed until the writer catches up
+	AuditLogOverflowBlock AuditLogOverflowPolicy = iota
+	// AuditLogOverflowDropOldest discards the oldest queued entry to make
+	// room for the new one
+	AuditLogOverflowDropOldest
+	// AuditLogOverflowDropNewest discards the new entry
+	AuditLogOverflowDropNewest
+)
+
+// ParseAuditLogOverflowPolicy parses the policy of SecAuditLogAsyncOverflow
+func ParseAuditLogOverflowPolicy(policy string) (AuditLogOverflowPolicy, error) {
+	switch strings.ToLower(policy) {
+	case "block":
+		return AuditLogOverflowBlock, nil
+	case "drop_oldest":
+		return AuditLogOverflowDropOldest, nil
+	case "drop_newest":
+		return AuditLogOverflowDropNewest, nil
+	}
+	return -1, fmt.Errorf("invalid audit log overflow policy: %s", policy)
+}
+
 type auditLogPart byte
 
 // AuditLogParts represents the parts of the audit log
@@ -166,6 +267,78 @@ const (
 	AuditLogPartFinalBoundary auditLogPart = 'Z'
 )
 
+// ParseAuditLogParts parses the audit log parts of SecAuditLogParts, like
+// ABCFHZ
+func ParseAuditLogParts(opts string) (AuditLogParts, error) {
+	parts := make(AuditLogParts, 0, len(opts))
+	for i := 0; i < len(opts); i++ {
+		if !isAuditLogPart(opts[i]) {
+			return nil, fmt.Errorf("invalid audit log part %q", opts[i])
+		}
+		parts = append(parts, auditLogPart(opts[i]))
+	}
+	return parts, nil
+}
+
+// Modify returns the parts modified by opts, either a complete list of
+// parts like ABCFHZ, or the parts to add or to remove prefixed by + or -,
+// like +E or -C. The parts are not modified in place.
+func (p AuditLogParts) Modify(opts string) (AuditLogParts, error) {
+	if opts == "" || (opts[0] != '+' && opts[0] != '-') {
+		return ParseAuditLogParts(opts)
+	}
+	changes, err := ParseAuditLogParts(opts[1:])
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("invalid audit log parts %q, no part follows %q", opts, opts[0])
+	}
+	res := make(AuditLogParts, 0, len(p)+len(changes))
+	if opts[0] == '+' {
+		res = append(res, p...)
+		for _, c := range changes {
+			if !res.Has(c) {
+				res = append(res, c)
+			}
+		}
+		return res, nil
+	}
+	for _, part := range p {
+		if !changes.Has(part) {
+			res = append(res, part)
+		}
+	}
+	return res, nil
+}
+
+// Has returns true if the part is included
+func (p AuditLogParts) Has(part auditLogPart) bool {
+	for _, x := range p {
+		if x == part {
+			return true
+		}
+	}
+	return false
+}
+
+func isAuditLogPart(c byte) bool {
+	return (c >= 'A' && c <= 'K') || c == 'Z'
+}
+
+// Actions that can be set to Interruption.Action, connectors must handle
+// each of them to match the ModSecurity semantics
+const (
+	// InterruptionActionDeny stops the transaction and returns Interruption.Status
+	InterruptionActionDeny = "deny"
+	// InterruptionActionDrop stops the transaction and closes the connection,
+	// connectors must not send any response, for HTTP/2 the stream is reset
+	InterruptionActionDrop = "drop"
+	// InterruptionActionRedirect stops the transaction and redirects
+	// the client to Interruption.Data
+	InterruptionActionRedirect = "redirect"
+)
+
 // Interruption is used to notify the Coraza implementation
 // that the transaction must be disrupted, for example:
 //
@@ -176,7 +349,7 @@ type Interruption struct {
 	// Rule that caused the interruption
 	RuleID int
 
-	// drop, deny, redirect
+	// drop, deny, redirect, see the InterruptionAction constants
 	Action string
 
 	// Force this status code
@@ -184,6 +357,44 @@ type Interruption struct {
 
 	// Parameters used by proxy and redirect
 	Data string
+
+	// Body is the response body the connector should return, it is
+	// empty unless the rule defines one with responseBody
+	Body string
+
+	// ContentType is the content type of Body
+	ContentType string
+}
+
+// IsDrop returns true if the connector must close the connection
+// instead of sending a response
+func (it *Interruption) IsDrop() bool {
+	return it != nil && it.Action == InterruptionActionDrop
+}
+
+// HeaderMutationAction is the operation a HeaderMutation performs
+type HeaderMutationAction int
+
+const (
+	// HeaderMutationSet overwrites any previous value of the header
+	HeaderMutationSet HeaderMutationAction = iota
+	// HeaderMutationAdd appends a value to the header
+	HeaderMutationAdd
+	// HeaderMutationRemove removes the header
+	HeaderMutationRemove
+)
+
+// HeaderMutation is a change to the response headers scheduled by a
+// rule, connectors must apply them in order before sending the response
+type HeaderMutation struct {
+	// Action to perform
+	Action HeaderMutationAction
+
+	// Name of the header
+	Name string
+
+	// Value of the header, empty for removals
+	Value string
 }
 
 // BodyBufferOptions is used to feed a coraza.BodyBuffer with parameters
@@ -9,6 +9,7 @@ import (
 
 	"github.com/corazawaf/coraza/v3/internal/corazawaf"
 	"github.com/corazawaf/coraza/v3/internal/seclang"
+	"github.com/corazawaf/coraza/v3/loggers"
 	"github.com/corazawaf/coraza/v3/types"
 )
 
@@ -23,14 +24,48 @@ type WAF interface {
 	// NewTransaction Creates a new initialized transaction for this WAF instance
 	NewTransaction() types.Transaction
 	NewTransactionWithID(id string) types.Transaction
+
+	// CloneWithOverrides returns a child WAF sharing the parsed rules and
+	// configuration of this WAF, the provided configuration is applied on
+	// top of them, for example to add tenant specific rules, exclusions or
+	// limits. The parent WAF is not modified.
+	CloneWithOverrides(config WAFConfig) (WAF, error)
+
+	// Rules returns the rules loaded in the WAF
+	Rules() Rules
+
+	// ReloadDataFiles reads the data files of the @pmFromFile and
+	// @ipMatchFromFile operators again without reloading the rules, for
+	// example after a blocklist was updated. It is safe to call while
+	// transactions are evaluated. Every operator is reloaded even if one
+	// fails, those keep their previous data.
+	ReloadDataFiles() error
+
+	// RuleStats returns the matches of each rule, tag and phase counted
+	// since the WAF was created, for example to find the noisy rules. The
+	// WAFs returned by CloneWithOverrides have their own counters.
+	RuleStats() types.RuleStats
+
+	// Close flushes and closes the audit log writer, saves the learned
+	// profile and releases the compiled patterns no other WAF uses, it
+	// must be called once the WAF stops creating transactions.
+	// WAFs returned by CloneWithOverrides share the writer of their parent
+	// unless they configure their own, it is closed by the WAF that
+	// created it.
+	Close() error
 }
 
 // NewWAF creates a new WAF instance with the provided configuration.
 func NewWAF(config WAFConfig) (WAF, error) {
-	c := config.(*wafConfig)
-
 	waf := corazawaf.NewWAF()
+	if err := applyConfig(waf, config.(*wafConfig)); err != nil {
+		return nil, err
+	}
+	return wafWrapper{waf: waf}, nil
+}
 
+// applyConfig configures the WAF, it is used both for new and cloned instances
+func applyConfig(waf *corazawaf.WAF, c *wafConfig) error {
 	if c.debugLogger != nil {
 		waf.Logger = c.debugLogger
 	}
@@ -40,23 +75,36 @@ func NewWAF(config WAFConfig) (WAF, error) {
 	if c.fsRoot != nil {
 		parser.SetRoot(c.fsRoot)
 	}
+	parser.SetLenient(c.lenient)
+	if c.unknownDirective != nil {
+		parser.SetUnknownDirectiveHandler(c.unknownDirective)
+	}
+	for _, plugin := range c.crsPlugins {
+		parser.AddPlugin(plugin)
+	}
 
 	for _, r := range c.rules {
 		switch {
 		case r.rule != nil:
 			if err := waf.Rules.Add(r.rule); err != nil {
-				return nil, fmt.Errorf("invalid WAF config: %w", err)
+				return fmt.Errorf("invalid WAF config: %w", err)
 			}
 		case r.str != "":
 			if err := parser.FromString(r.str); err != nil {
-				return nil, fmt.Errorf("invalid WAF config: %w", err)
+				return fmt.Errorf("invalid WAF config: %w", err)
 			}
 		case r.file != "":
 			if err := parser.FromFile(r.file); err != nil {
-				return nil, fmt.Errorf("invalid WAF config: %w", err)
+				return fmt.Errorf("invalid WAF config: %w", err)
 			}
 		}
 	}
+	if err := parser.ValidateMarkers(); err != nil {
+		return fmt.Errorf("invalid WAF config: %w", err)
+	}
+	if len(c.crsPlugins) > 0 && parser.PluginIncludes() == 0 {
+		return errors.New("invalid WAF config: the CRS plugins are registered but the directives don't include the plugin files")
+	}
 
 	if a := c.auditLog; a != nil {
 		// TODO(anuraaga): Can't override AuditEngineOn from rules to off this way.
@@ -79,34 +127,127 @@ func NewWAF(config WAFConfig) (WAF, error) {
 
 	if r := c.requestBody; r != nil {
 		if r.limit <= 0 {
-			return nil, errors.New("request body limit should be bigger than 0")
+			return errors.New("request body limit should be bigger than 0")
 		}
 
 		if r.limit < r.inMemoryLimit {
-			return nil, errors.New("request body limit should be at least the memory limit")
+			return errors.New("request body limit should be at least the memory limit")
 		}
 		waf.RequestBodyAccess = true
 		waf.RequestBodyLimit = int64(r.limit)
-		waf.RequestBodyInMemoryLimit = int64(r.inMemoryLimit)
+		waf.SetRequestBodyInMemoryLimit(int64(r.inMemoryLimit))
 	}
 
 	if r := c.responseBody; r != nil {
 		if r.limit <= 0 {
-			return nil, errors.New("response body limit should be bigger than 0")
+			return errors.New("response body limit should be bigger than 0")
 		}
 		waf.ResponseBodyAccess = true
 		waf.ResponseBodyLimit = int64(r.limit)
 	}
 
+	// the limits of the options override the directives
+	if c.requestBodyLimit > 0 {
+		waf.RequestBodyAccess = true
+		waf.RequestBodyLimit = c.requestBodyLimit
+	}
+	if c.requestBodyInMemoryLimit > 0 {
+		waf.SetRequestBodyInMemoryLimit(c.requestBodyInMemoryLimit)
+	}
+	if c.responseBodyLimit > 0 {
+		waf.ResponseBodyAccess = true
+		waf.ResponseBodyLimit = c.responseBodyLimit
+	}
+
 	if c.errorCallback != nil {
 		waf.ErrorLogCb = c.errorCallback
 	}
 
-	return wafWrapper{waf: waf}, nil
+	if e := c.errorEvents; e != nil && e.cb != nil {
+		waf.SetErrorEventCallback(e.cb, e.severities...)
+	}
+
+	if c.rateLimitStore != nil {
+		waf.RateLimitStore = c.rateLimitStore
+	}
+
+	if c.idGenerator != nil {
+		waf.SetIDGenerator(c.idGenerator)
+	}
+
+	for _, r := range c.bodyProcessors {
+		if err := waf.SetBodyProcessor(r.mediaType, r.processor); err != nil {
+			return fmt.Errorf("invalid WAF config: %w", err)
+		}
+	}
+	for _, r := range c.methodBodyProcessors {
+		if err := waf.SetMethodBodyProcessor(r.mediaType, r.processor); err != nil {
+			return fmt.Errorf("invalid WAF config: %w", err)
+		}
+	}
+	if c.bodyProcessorSniffing {
+		waf.RequestBodyProcessorSniffing = true
+	}
+
+	waf.AccessList = c.accessList
+	if c.openAPI != nil {
+		waf.OpenAPI = c.openAPI
+		waf.OpenAPIAction = c.openAPIAction
+	}
+	if c.profile != nil {
+		waf.Profile = c.profile
+		waf.ProfileMode = c.profileMode
+	}
+	if p := c.txPool; p != nil {
+		waf.TransactionPoolDisabled = !p.enabled
+		waf.TransactionPoolMaxBufferSize = p.maxBufferSize
+	}
+	if c.txArena {
+		waf.TransactionArena = true
+	}
+	if c.parallelRuleWorkers > 0 {
+		waf.ParallelRuleWorkers = c.parallelRuleWorkers
+	}
+	waf.Rules.Plan()
+	if c.blockSeverityStatus != 0 {
+		waf.BlockSeverity = c.blockSeverity
+		waf.BlockSeverityStatus = c.blockSeverityStatus
+	}
+
+	if c.candidate != "" {
+		candidate := waf.NewCandidate()
+		candidateParser := seclang.NewParser(candidate)
+		if c.fsRoot != nil {
+			candidateParser.SetRoot(c.fsRoot)
+		}
+		candidateParser.SetLenient(c.lenient)
+		if c.unknownDirective != nil {
+			candidateParser.SetUnknownDirectiveHandler(c.unknownDirective)
+		}
+		for _, plugin := range c.crsPlugins {
+			candidateParser.AddPlugin(plugin)
+		}
+		if err := candidateParser.FromString(c.candidate); err != nil {
+			return fmt.Errorf("invalid WAF candidate config: %w", err)
+		}
+		if err := candidateParser.ValidateMarkers(); err != nil {
+			return fmt.Errorf("invalid WAF candidate config: %w", err)
+		}
+		candidate.Rules.Plan()
+		waf.SetCandidate(candidate, c.candidateDiffCb)
+	}
+
+	if err := waf.Validate(); err != nil {
+		return fmt.Errorf("invalid WAF config: %w", err)
+	}
+	return nil
 }
 
 type wafWrapper struct {
 	waf *corazawaf.WAF
+	// inheritedWriter is the audit log writer of the parent of a cloned
+	// WAF, it is closed by the parent
+	inheritedWriter loggers.LogWriter
 }
 
 // NewTransaction implements the same method on WAF.
@@ -118,3 +259,40 @@ func (w wafWrapper) NewTransaction() types.Transaction {
 func (w wafWrapper) NewTransactionWithID(id string) types.Transaction {
 	return w.waf.NewTransactionWithID(id)
 }
+
+// CloneWithOverrides implements the same method on WAF.
+func (w wafWrapper) CloneWithOverrides(config WAFConfig) (WAF, error) {
+	waf := w.waf.CloneWithOverrides()
+	if err := applyConfig(waf, config.(*wafConfig)); err != nil {
+		return nil, err
+	}
+	return wafWrapper{waf: waf, inheritedWriter: w.waf.AuditLogWriter}, nil
+}
+
+// Close implements the same method on WAF.
+func (w wafWrapper) Close() error {
+	w.waf.Memoizer.Release()
+	err := w.waf.SaveProfile()
+	if w.waf.AuditLogWriter == w.inheritedWriter {
+		return err
+	}
+	if cerr := w.waf.AuditLogWriter.Close(); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// ReloadDataFiles implements the same method on WAF.
+func (w wafWrapper) ReloadDataFiles() error {
+	return w.waf.ReloadDataFiles()
+}
+
+// RuleStats implements the same method on WAF.
+func (w wafWrapper) RuleStats() types.RuleStats {
+	return w.waf.RuleStats()
+}
+
+// Rules implements the same method on WAF.
+func (w wafWrapper) Rules() Rules {
+	return rulesWrapper{rules: &w.waf.Rules}
+}
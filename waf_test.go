@@ -3,7 +3,20 @@
 
 package coraza
 
-import "testing"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/corazawaf/coraza/v3/accesslist"
+	"github.com/corazawaf/coraza/v3/openapi"
+	"github.com/corazawaf/coraza/v3/profiler"
+	"github.com/corazawaf/coraza/v3/types"
+)
 
 func TestNewWAFLimits(t *testing.T) {
 	testCases := map[string]struct {
@@ -41,3 +54,556 @@ func TestNewWAFLimits(t *testing.T) {
 		})
 	}
 }
+
+func TestNewWAFCandidateDirectives(t *testing.T) {
+	var diff *types.RuleSetDiff
+	waf, err := NewWAF(NewWAFConfig().
+		WithDirectives(`SecRule ARGS:id "@eq 1" "id:1,phase:1,deny,log"`).
+		WithCandidateDirectives(`SecRule ARGS:id "@eq 2" "id:2,phase:1,deny,log"`, func(d types.RuleSetDiff) {
+			diff = &d
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.AddArgument(types.ArgumentGET, "id", "2")
+	if it := tx.ProcessRequestHeaders(); it != nil {
+		t.Errorf("unexpected interruption %v", it)
+	}
+	tx.ProcessLogging()
+	if diff == nil || len(diff.CandidateOnly) != 1 || diff.CandidateInterruption == nil {
+		t.Errorf("unexpected diff %+v", diff)
+	}
+
+	if _, err := NewWAF(NewWAFConfig().WithCandidateDirectives("SecInvalid", nil)); err == nil {
+		t.Error("expected error for invalid candidate directives")
+	}
+}
+
+func TestCloneWithOverrides(t *testing.T) {
+	base, err := NewWAF(NewWAFConfig().WithDirectives(`
+SecRuleEngine On
+SecRule ARGS "@streq attack" "id:1,phase:1,deny,log"
+SecRule ARGS "@streq other" "id:2,phase:1,deny,log"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenant, err := base.CloneWithOverrides(NewWAFConfig().
+		WithDirectives(`
+SecRuleRemoveById 2
+SecRuleUpdateTargetById 1 "!ARGS:comment"
+SecRule ARGS "@streq tenant" "id:100,phase:1,deny,log"
+`).
+		WithRequestBodyAccess(NewRequestBodyConfig().WithLimit(10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		waf        WAF
+		key, value string
+		interrupt  bool
+	}{
+		{"base rule", base, "id", "attack", true},
+		{"base rule in tenant", tenant, "id", "attack", true},
+		{"base exclusion", base, "comment", "attack", true},
+		{"tenant exclusion", tenant, "comment", "attack", false},
+		{"base removed rule", base, "id", "other", true},
+		{"tenant removed rule", tenant, "id", "other", false},
+		{"tenant rule in base", base, "id", "tenant", false},
+		{"tenant rule", tenant, "id", "tenant", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tx := tc.waf.NewTransaction()
+			defer tx.Close()
+			tx.AddArgument(types.ArgumentGET, tc.key, tc.value)
+			if it := tx.ProcessRequestHeaders(); (it != nil) != tc.interrupt {
+				t.Errorf("unexpected interruption %v", it)
+			}
+		})
+	}
+
+	if tx := tenant.NewTransaction(); !tx.IsRequestBodyAccessible() {
+		t.Error("expected tenant override to enable request body access")
+	}
+	if tx := base.NewTransaction(); tx.IsRequestBodyAccessible() {
+		t.Error("expected base WAF not to be modified")
+	}
+}
+
+func TestNewWAFAccessList(t *testing.T) {
+	list := accesslist.New()
+	waf, err := NewWAF(NewWAFConfig().
+		WithDirectives(`SecRuleEngine On
+SecRule ARGS:id "@eq 1" "id:1,phase:1,deny,status:401,log"
+SecRule ACCESS_LIST_ENTRY "@rx ." "id:2,phase:5,pass,log,msg:'%{ACCESS_LIST_ACTION} %{ACCESS_LIST_ENTRY}'"`).
+		WithAccessList(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Add(accesslist.Entry{ID: "blocked", Action: accesslist.Deny, Network: "203.0.113.0/24", PathPrefix: "/login"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Add(accesslist.Entry{ID: "trusted", Action: accesslist.Allow, Network: "10.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		ip      string
+		ruleID  int
+		status  int
+		message string
+	}{
+		"denied":  {ip: "203.0.113.7", status: 403, message: "deny blocked"},
+		"allowed": {ip: "10.0.0.1", message: "allow trusted"},
+		"rules":   {ip: "10.0.0.2", ruleID: 1, status: 401},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tx := waf.NewTransaction()
+			tx.ProcessConnection(tt.ip, 1234, "", 0)
+			tx.ProcessURI("/login?id=1", "POST", "HTTP/1.1")
+			it := tx.ProcessRequestHeaders()
+			if tt.status == 0 && it != nil {
+				t.Errorf("unexpected interruption %+v", it)
+			}
+			if tt.status != 0 && (it == nil || it.Status != tt.status || it.RuleID != tt.ruleID) {
+				t.Errorf("unexpected interruption %+v", it)
+			}
+			tx.ProcessLogging()
+			message := ""
+			for _, mr := range tx.MatchedRules() {
+				if mr.Rule().ID() == 2 {
+					message = mr.Message()
+				}
+			}
+			if message != tt.message {
+				t.Errorf("expected message %q, got %q", tt.message, message)
+			}
+		})
+	}
+}
+
+func TestNewWAFOpenAPI(t *testing.T) {
+	spec, err := openapi.Load([]byte(`{"openapi": "3.0.0", "paths": {"/items": {"get": {"operationId": "listItems"}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waf, err := NewWAF(NewWAFConfig().
+		WithDirectives(`SecRuleEngine On`).
+		WithOpenAPI(spec, openapi.Reject))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		method string
+		uri    string
+		status int
+	}{
+		"declared":       {method: "GET", uri: "/items"},
+		"unknown path":   {method: "GET", uri: "/admin", status: 400},
+		"unknown method": {method: "DELETE", uri: "/items", status: 400},
+		"undeclared":     {method: "GET", uri: "/items?debug=1", status: 400},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tx := waf.NewTransaction()
+			tx.ProcessURI(tt.uri, tt.method, "HTTP/1.1")
+			it := tx.ProcessRequestHeaders()
+			if tt.status == 0 && it != nil {
+				t.Errorf("unexpected interruption %+v", it)
+			}
+			if tt.status != 0 && (it == nil || it.Status != tt.status) {
+				t.Errorf("unexpected interruption %+v", it)
+			}
+		})
+	}
+}
+
+func TestNewWAFProfile(t *testing.T) {
+	profile := profiler.New()
+	waf, err := NewWAF(NewWAFConfig().WithProfile(profile, profiler.Learn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < profiler.DefaultMinSamples; i++ {
+		tx := waf.NewTransaction()
+		tx.ProcessURI("/items/"+strconv.Itoa(i)+"?sort=name", "GET", "HTTP/1.1")
+		tx.ProcessRequestHeaders()
+		tx.ProcessLogging()
+	}
+	// requests answered with an error are not learned
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/items/1?debug=1", "GET", "HTTP/1.1")
+	tx.ProcessRequestHeaders()
+	tx.ProcessResponseHeaders(500, "HTTP/1.1")
+	tx.ProcessLogging()
+	if err := waf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	waf, err = NewWAF(NewWAFConfig().
+		WithDirectives(`SecRuleEngine On
+SecRule PROFILE_VIOLATION "@rx ." "id:1,phase:2,deny,status:403"`).
+		WithProfile(profile, profiler.Enforce))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		uri    string
+		status int
+	}{
+		"learned":        {uri: "/items/42?sort=date"},
+		"unknown":        {uri: "/items/42?sort=name&debug=1", status: 403},
+		"type mismatch":  {uri: "/items/42?sort=1", status: 403},
+		"missing":        {uri: "/items/42", status: 403},
+		"unknown path":   {uri: "/admin", status: 403},
+		"length overrun": {uri: "/items/42?sort=name%27%20OR%201%3D1", status: 403},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tx := waf.NewTransaction()
+			tx.ProcessURI(tt.uri, "GET", "HTTP/1.1")
+			tx.ProcessRequestHeaders()
+			it, err := tx.ProcessRequestBody()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.status == 0 && it != nil {
+				t.Errorf("unexpected interruption %+v", it)
+			}
+			if tt.status != 0 && (it == nil || it.Status != tt.status) {
+				t.Errorf("unexpected interruption %+v", it)
+			}
+		})
+	}
+}
+
+func TestNewWAFCRSPlugin(t *testing.T) {
+	plugin := fstest.MapFS{
+		"plugins/test-before.conf": &fstest.MapFile{Data: []byte(`SecRule ARGS "@rx plugin" "id:9500100,phase:1,deny,status:403"`)},
+	}
+	if _, err := NewWAF(NewWAFConfig().WithCRSPlugin(plugin).WithDirectives(`SecRuleEngine On`)); err == nil {
+		t.Error("expected an error if the plugin files are not included")
+	}
+	waf, err := NewWAF(NewWAFConfig().
+		WithCRSPlugin(plugin).
+		WithRootFS(fstest.MapFS{}).
+		WithDirectives("SecRuleEngine On\nInclude plugins/*-before.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/?a=plugin", "GET", "HTTP/1.1")
+	if it := tx.ProcessRequestHeaders(); it == nil || it.Status != 403 {
+		t.Errorf("expected the plugin rule to deny, got %v", it)
+	}
+}
+
+func TestNewWAFSkipAfterTargets(t *testing.T) {
+	// the markers can be defined by later directives
+	if _, err := NewWAF(NewWAFConfig().
+		WithDirectives(`SecAction "id:1,phase:1,pass,nolog,skipAfter:END"`).
+		WithDirectives(`SecMarker END`)); err != nil {
+		t.Error(err)
+	}
+	if _, err := NewWAF(NewWAFConfig().WithDirectives(`SecAction "id:1,phase:1,pass,nolog,skipAfter:END"`)); err == nil {
+		t.Error("expected an error for a missing marker")
+	}
+}
+
+func TestNewWAFSeverityBlock(t *testing.T) {
+	waf, err := NewWAF(NewWAFConfig().
+		WithSeverityBlock(types.RuleSeverityError, 403).
+		WithDirectives(`SecRuleEngine On
+SecRule ARGS "@streq x" "id:1,phase:1,pass,nolog,severity:CRITICAL"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/?a=x", "GET", "HTTP/1.1")
+	if it := tx.ProcessRequestHeaders(); it == nil || it.Status != 403 {
+		t.Errorf("expected the critical match to deny, got %v", it)
+	}
+}
+
+func TestRuleStats(t *testing.T) {
+	waf, err := NewWAF(NewWAFConfig().WithDirectives(`SecRule ARGS "@streq x" "id:1,phase:1,pass,nolog,tag:noisy"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, uri := range []string{"/?a=x", "/?a=y", "/?a=x&b=x"} {
+		tx := waf.NewTransaction()
+		tx.ProcessURI(uri, "GET", "HTTP/1.1")
+		tx.ProcessRequestHeaders()
+	}
+	if stats := waf.RuleStats(); stats.Rules[1] != 2 || stats.Tags["noisy"] != 2 {
+		t.Errorf("expected 2 matches of rule 1, got %v", stats)
+	}
+}
+
+func TestNewWAFTransactionArena(t *testing.T) {
+	waf, err := NewWAF(NewWAFConfig().
+		WithTransactionArena().
+		WithDirectives(`SecRule ARGS "@rx ^(x|y)$" "id:1,phase:1,pass,log,capture,msg:'%{TX.1} in %{MATCHED_VAR_NAME}'"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, arg := range []string{"a=x", "b=y", "c=x"} {
+		tx := waf.NewTransaction()
+		tx.ProcessURI("/?"+arg, "GET", "HTTP/1.1")
+		tx.ProcessRequestHeaders()
+		name, value, _ := strings.Cut(arg, "=")
+		mrs := tx.MatchedRules()
+		if len(mrs) != 1 || mrs[0].Message() != value+" in ARGS:"+name {
+			t.Errorf("unexpected matched rules for %q: %v", arg, mrs)
+		} else if mds := mrs[0].MatchedDatas(); len(mds) != 1 || mds[0].Key() != name || mds[0].Value() != value {
+			t.Errorf("unexpected match data for %q: %v", arg, mds)
+		}
+		if err := tx.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNewWAFParallelRules(t *testing.T) {
+	directives := `SecRuleEngine On
+SecRule ARGS "@rx ^select" "id:1,phase:1,pass,log,setvar:tx.score=+5"
+SecRule ARGS "@pm union drop" "id:2,phase:1,pass,log,setvar:tx.score=+5,skipAfter:END"
+SecRule REQUEST_URI "@contains /admin" "id:3,phase:1,pass,log,setvar:tx.score=+5"
+SecMarker END
+SecRule ARGS "@streq chained" "id:4,phase:1,pass,log,chain"
+	SecRule REQUEST_METHOD "@streq POST" ""
+SecRule TX:score "@ge 10" "id:5,phase:1,deny,status:403,log"`
+	newWAF := func(config WAFConfig) WAF {
+		waf, err := NewWAF(config.WithDirectives(directives))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return waf
+	}
+	sequential, parallel := newWAF(NewWAFConfig()), newWAF(NewWAFConfig().WithParallelRules(4))
+	eval := func(waf WAF, method string, uri string) ([]int, int) {
+		tx := waf.NewTransaction()
+		defer tx.Close()
+		tx.ProcessURI(uri, method, "HTTP/1.1")
+		status := 0
+		if it := tx.ProcessRequestHeaders(); it != nil {
+			status = it.Status
+		}
+		var ids []int
+		for _, mr := range tx.MatchedRules() {
+			ids = append(ids, mr.Rule().ID())
+		}
+		return ids, status
+	}
+	for _, uri := range []string{"/?q=a", "/?q=select&r=union", "/admin?q=select", "/admin?q=drop", "/?q=chained"} {
+		for _, method := range []string{"GET", "POST"} {
+			seqIDs, seqStatus := eval(sequential, method, uri)
+			parIDs, parStatus := eval(parallel, method, uri)
+			if fmt.Sprint(seqIDs, seqStatus) != fmt.Sprint(parIDs, parStatus) {
+				t.Errorf("unexpected parallel evaluation of %s %s: %v %d, want %v %d", method, uri, parIDs, parStatus, seqIDs, seqStatus)
+			}
+		}
+	}
+}
+
+func TestReloadDataFiles(t *testing.T) {
+	agents := filepath.Join(t.TempDir(), "agents.data")
+	if err := os.WriteFile(agents, []byte("nikto\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	waf, err := NewWAF(NewWAFConfig().WithDirectives(`SecRuleEngine On
+SecRule REQUEST_METHOD "@streq GET" "id:1,phase:1,deny,status:403,chain"
+	SecRule REQUEST_HEADERS:User-Agent "@pmFromFile ` + agents + `" ""`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocked := func(ua string) bool {
+		tx := waf.NewTransaction()
+		tx.ProcessURI("/", "GET", "HTTP/1.1")
+		tx.AddRequestHeader("User-Agent", ua)
+		return tx.ProcessRequestHeaders() != nil
+	}
+	if !blocked("nikto") || blocked("sqlmap") {
+		t.Fatal("unexpected result before the reload")
+	}
+
+	if err := os.WriteFile(agents, []byte("sqlmap\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := waf.ReloadDataFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if blocked("nikto") || !blocked("sqlmap") {
+		t.Error("unexpected result after the reload")
+	}
+
+	// a failed reload keeps the previous patterns
+	if err := os.Remove(agents); err != nil {
+		t.Fatal(err)
+	}
+	if err := waf.ReloadDataFiles(); err == nil {
+		t.Error("expected an error reloading a missing file")
+	}
+	if !blocked("sqlmap") {
+		t.Error("expected the previous patterns to be kept")
+	}
+}
+
+func TestWAFRules(t *testing.T) {
+	root := fstest.MapFS{
+		"crs.conf": &fstest.MapFile{Data: []byte(`SecMarker BEGIN
+SecRule ARGS "@rx attack" "id:1,phase:2,deny,tag:attack-sqli,ver:'OWASP_CRS/4.0.0'"
+
+SecRule ARGS "@rx other" "id:2,phase:2,deny,tag:attack-xss,chain"
+	SecRule ARGS "@rx other" ""`)},
+	}
+	waf, err := NewWAF(NewWAFConfig().WithRootFS(root).WithDirectivesFromFile("crs.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := waf.Rules()
+	if n := rules.Count(); n != 2 || len(rules.All()) != 2 {
+		t.Fatalf("expected 2 rules, got %d", n)
+	}
+	r, ok := rules.FindByID(1)
+	if !ok {
+		t.Fatal("expected rule 1 to be found")
+	}
+	if r.File() != "crs.conf" || r.Line() != 2 || r.Version() != "OWASP_CRS/4.0.0" || !strings.HasPrefix(r.Raw(), "SecRule ARGS") {
+		t.Errorf("unexpected provenance %s:%d %q %q", r.File(), r.Line(), r.Version(), r.Raw())
+	}
+	if _, ok := rules.FindByID(3); ok {
+		t.Error("expected rule 3 not to be found")
+	}
+	if found := rules.FindByTag("attack-xss"); len(found) != 1 || found[0].ID() != 2 {
+		t.Errorf("unexpected rules for tag %v", found)
+	}
+}
+
+func TestNewWAFErrorEventCallback(t *testing.T) {
+	var events []types.ErrorEvent
+	waf, err := NewWAF(NewWAFConfig().
+		WithDirectives(`SecRuleEngine On
+SecRule ARGS:id "@eq 1" "id:1,phase:1,pass,log,severity:WARNING,tag:attack,msg:'warning'"
+SecRule ARGS:id "@eq 1" "id:2,phase:1,pass,log,msg:'no severity'"
+SecRule ARGS:id "@eq 1" "id:3,phase:1,deny,status:403,log,severity:CRITICAL,msg:'blocked',logdata:'%{MATCHED_VAR}'"`).
+		WithErrorEventCallback(NewErrorCallbackConfig().
+			WithCallback(func(event types.ErrorEvent) { events = append(events, event) }).
+			WithMinSeverity(types.RuleSeverityWarning)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.ProcessConnection("10.0.0.1", 1234, "", 0)
+	tx.ProcessURI("/?id=1", "GET", "HTTP/1.1")
+	if it := tx.ProcessRequestHeaders(); it == nil {
+		t.Fatal("expected an interruption")
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if e := events[0]; e.RuleID != 1 || e.Disruptive || e.Severity != types.RuleSeverityWarning ||
+		len(e.Tags) != 1 || e.Tags[0] != "attack" || e.Message != "warning" ||
+		e.Variable != "ARGS_GET" || e.Key != "id" || e.Value != "1" || e.ClientIP != "10.0.0.1" || e.URI != "/?id=1" {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if e := events[1]; e.RuleID != 3 || !e.Disruptive || !e.HasSeverity || e.Severity != types.RuleSeverityCritical ||
+		e.Data != "1" || e.TransactionID == "" || e.MatchedRule == nil {
+		t.Errorf("unexpected event %+v", e)
+	}
+}
+
+func TestNewWAFUnknownDirectives(t *testing.T) {
+	directives := `SecVendorOwner "edge-team"
+SecRule ARGS "@rx a" "id:1,phase:1,pass,vendorAction"`
+	if _, err := NewWAF(NewWAFConfig().WithDirectives(directives)); err == nil {
+		t.Error("expected an error for the unknown directive")
+	}
+
+	var owner string
+	_, err := NewWAF(NewWAFConfig().
+		WithLenientParsing().
+		WithUnknownDirectiveHandler(func(directive string, args string) error {
+			if directive != "SecVendorOwner" {
+				return ErrUnknownDirective
+			}
+			owner = args
+			return nil
+		}).
+		WithDirectives(directives))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != "edge-team" {
+		t.Errorf("expected the handler to be called, got %q", owner)
+	}
+}
+
+func TestNewWAFIDGenerator(t *testing.T) {
+	waf, err := NewWAF(NewWAFConfig().WithIDGenerator(func() string { return "request-1" }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := waf.NewTransaction().ID(); id != "request-1" {
+		t.Errorf("expected the generated ID, got %q", id)
+	}
+	if id := waf.NewTransactionWithID("trace-2").ID(); id != "trace-2" {
+		t.Errorf("expected the explicit ID, got %q", id)
+	}
+}
+
+func TestNewWAFBodyProcessor(t *testing.T) {
+	waf, err := NewWAF(NewWAFConfig().
+		WithDirectives(`
+			SecRequestBodyAccess On
+			SecRule ARGS_POST:json.user "@streq admin" "id:1,phase:2,deny,status:403"
+		`).
+		WithBodyProcessor("application/vnd.api+json", "JSON"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/", "POST", "HTTP/1.1")
+	tx.AddRequestHeader("Content-Type", "application/vnd.api+json; charset=utf-8")
+	tx.ProcessRequestHeaders()
+	if _, _, err := tx.WriteRequestBody([]byte(`{"user":"admin"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if it, err := tx.ProcessRequestBody(); err != nil || it == nil {
+		t.Errorf("expected the JSON body to be parsed, got %v, %v", it, err)
+	}
+
+	if _, err := NewWAF(NewWAFConfig().WithBodyProcessor("application/x-custom", "unknown")); err == nil {
+		t.Error("expected an error for an unknown body processor")
+	}
+}
+
+func TestNewWAFMethodBodyProcessor(t *testing.T) {
+	waf, err := NewWAF(NewWAFConfig().
+		WithDirectives(`
+			SecRequestBodyAccess On
+			SecRule ARGS_POST:json.user "@streq admin" "id:1,phase:2,deny,status:403"
+		`).
+		WithMethodBodyProcessor("QUERY", "JSON"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := waf.NewTransaction()
+	tx.ProcessURI("/", "QUERY", "HTTP/1.1")
+	tx.ProcessRequestHeaders()
+	if _, _, err := tx.WriteRequestBody([]byte(`{"user":"admin"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if it, err := tx.ProcessRequestBody(); err != nil || it == nil {
+		t.Errorf("expected the JSON body to be parsed, got %v, %v", it, err)
+	}
+
+	if _, err := NewWAF(NewWAFConfig().WithMethodBodyProcessor("QUERY", "unknown")); err == nil {
+		t.Error("expected an error for an unknown body processor")
+	}
+}
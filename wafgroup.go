@@ -0,0 +1,103 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package coraza
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// WAFGroup maps hostnames or arbitrary keys to independent WAF instances,
+// it is used by multi-tenant proxies to apply a different ruleset per tenant.
+// Compiled artifacts like regular expressions and pattern matchers are shared
+// between the instances loading the same rules.
+// Tenants can be added and removed at runtime, WAFGroup is concurrent safe.
+type WAFGroup struct {
+	mu       sync.RWMutex
+	wafs     map[string]WAF
+	fallback WAF
+}
+
+// NewWAFGroup creates an empty WAFGroup
+func NewWAFGroup() *WAFGroup {
+	return &WAFGroup{
+		wafs: map[string]WAF{},
+	}
+}
+
+// Add registers the WAF for the key, replacing the previous one if any.
+// Keys are case insensitive, a key like *.example.com matches every
+// subdomain of example.com when looked up with ForHost.
+func (g *WAFGroup) Add(key string, waf WAF) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.wafs[strings.ToLower(key)] = waf
+}
+
+// Remove unregisters the WAF for the key, transactions already created
+// by it are not affected
+func (g *WAFGroup) Remove(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.wafs, strings.ToLower(key))
+}
+
+// SetDefault sets the WAF used for keys without a registered WAF,
+// nil removes the default WAF
+func (g *WAFGroup) SetDefault(waf WAF) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.fallback = waf
+}
+
+// Get returns the WAF registered for the key or the default WAF
+func (g *WAFGroup) Get(key string) (WAF, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if waf, ok := g.wafs[strings.ToLower(key)]; ok {
+		return waf, true
+	}
+	return g.fallback, g.fallback != nil
+}
+
+// ForHost returns the WAF for a Host header value, the port is ignored.
+// Exact matches take precedence over wildcard keys like *.example.com,
+// the most specific wildcard wins.
+func (g *WAFGroup) ForHost(host string) (WAF, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if waf, ok := g.wafs[host]; ok {
+		return waf, true
+	}
+	for domain := host; ; {
+		i := strings.IndexByte(domain, '.')
+		if i == -1 {
+			break
+		}
+		domain = domain[i+1:]
+		if waf, ok := g.wafs["*."+domain]; ok {
+			return waf, true
+		}
+	}
+	return g.fallback, g.fallback != nil
+}
+
+// Keys returns the sorted keys of the registered WAFs
+func (g *WAFGroup) Keys() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	keys := make([]string, 0, len(g.wafs))
+	for k := range g.wafs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 Juan Pablo Tosso and the OWASP Coraza contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package coraza
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWAFGroup(t *testing.T) {
+	newWAF := func(directives string) WAF {
+		t.Helper()
+		waf, err := NewWAF(NewWAFConfig().WithDirectives(directives))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return waf
+	}
+	tenantA := newWAF(`SecRule REQUEST_URI "@rx ^/admin" "id:1,phase:1,deny,log"`)
+	tenantB := newWAF(`SecRule REQUEST_URI "@rx ^/admin" "id:1,phase:1,pass,log"`)
+	fallback := newWAF(`SecRuleEngine Off`)
+
+	g := NewWAFGroup()
+	g.Add("a.example.com", tenantA)
+	g.Add("*.example.com", tenantB)
+
+	tests := map[string]WAF{
+		"a.example.com":      tenantA,
+		"A.Example.com:8080": tenantA,
+		"b.example.com":      tenantB,
+		"x.y.example.com":    tenantB,
+		"example.com":        nil,
+		"other.org":          nil,
+	}
+	for host, expected := range tests {
+		waf, ok := g.ForHost(host)
+		if ok != (expected != nil) || waf != expected {
+			t.Errorf("unexpected WAF for %q", host)
+		}
+	}
+
+	g.SetDefault(fallback)
+	if waf, ok := g.ForHost("other.org"); !ok || waf != fallback {
+		t.Error("expected default WAF")
+	}
+	if waf, ok := g.Get("A.EXAMPLE.COM"); !ok || waf != tenantA {
+		t.Error("expected case insensitive keys")
+	}
+	if keys := g.Keys(); !reflect.DeepEqual(keys, []string{"*.example.com", "a.example.com"}) {
+		t.Errorf("unexpected keys %v", keys)
+	}
+
+	g.Remove("a.example.com")
+	if waf, _ := g.ForHost("a.example.com"); waf != tenantB {
+		t.Error("expected wildcard WAF after removing the tenant")
+	}
+
+	tx := tenantA.NewTransaction()
+	tx.ProcessURI("/admin", "GET", "HTTP/1.1")
+	if tx.ProcessRequestHeaders() == nil {
+		t.Error("expected tenant A to keep working after being removed")
+	}
+}